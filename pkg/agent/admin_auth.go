@@ -40,6 +40,7 @@ func (rt *Runtime) authorizeAdminRequest(ctx context.Context, r *http.Request, i
 	}
 
 	allowed, err := rt.adminPolicyEngine.Authorize(ctx, input)
+	rt.metrics.PolicyDecision("admin_opa", adminRoute(r), allowed, err)
 	if err != nil {
 		rt.logger.Error("Admin API authorization error", "path", r.URL.Path, "error", err)
 		return false, err
@@ -72,6 +73,9 @@ func (rt *Runtime) buildAdminTLSConfig() (*tls.Config, bool) {
 			return nil, false
 		}
 		tlsConfig.ClientCAs = pool
+		// A verified client certificate identifies the caller, see
+		// clientCertSubject.
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
 		if rt.adminTLSRequireClientCert {
 			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
 		}
@@ -119,6 +123,19 @@ func (rt *Runtime) checkRateLimit(w http.ResponseWriter, r *http.Request) bool {
 	return true
 }
 
+// clientCertSubject returns the common name of the caller's client
+// certificate when it was verified against admin_tls_client_ca, or "".
+func clientCertSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+// createAuthzInput describes the caller for admin API authorization. The
+// caller is identified only by credentials the agent verified: the admin API
+// key, a client certificate signed by admin_tls_client_ca, or a connection
+// from the loopback interface. Request headers naming a peer are ignored.
 func (rt *Runtime) createAuthzInput(r *http.Request) map[string]interface{} {
 	input := map[string]interface{}{
 		"method": r.Method,
@@ -130,6 +147,14 @@ func (rt *Runtime) createAuthzInput(r *http.Request) map[string]interface{} {
 		input["transport"] = "https"
 	}
 
+	peerID := ""
+	if subject := clientCertSubject(r); subject != "" {
+		input["user"] = subject
+		input["client_cert_subject"] = subject
+		// The certificate subject is the peer the admin policy checks.
+		peerID = subject
+	}
+
 	if rt.adminAPIKey != "" {
 		if token := parseBearerToken(r.Header.Get("Authorization")); token != "" {
 			if token == rt.adminAPIKey {
@@ -157,7 +182,6 @@ func (rt *Runtime) createAuthzInput(r *http.Request) map[string]interface{} {
 		input["agent_is_admin"] = isAdmin
 	}
 
-	peerID := r.Header.Get("X-Peer-ID")
 	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
 		host = r.RemoteAddr
@@ -217,5 +241,16 @@ func (rt *Runtime) appendAudit(action string, input map[string]interface{}) {
 
 	if err := rt.auditLogger.Append(entry); err != nil {
 		rt.logger.Error("Failed to append audit entry", "action", action, "error", err)
+		return
+	}
+	rt.metrics.AuditEntry()
+}
+
+// adminRoute returns the mux pattern that matched r, for use as a metric
+// label. Raw paths would give the label unbounded cardinality.
+func adminRoute(r *http.Request) string {
+	if r.Pattern != "" {
+		return r.Pattern
 	}
+	return "unmatched"
 }
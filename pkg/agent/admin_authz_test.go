@@ -1,6 +1,9 @@
 package agent
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
@@ -10,6 +13,15 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// withClientCert marks req as sent with a client certificate for subject
+// that the TLS handshake verified.
+func withClientCert(req *http.Request, subject string) *http.Request {
+	req.TLS = &tls.ConnectionState{
+		VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: subject}}}},
+	}
+	return req
+}
+
 func TestCreateAuthzInput(t *testing.T) {
 	// Create a logger
 	logger := slog.Default()
@@ -24,9 +36,8 @@ func TestCreateAuthzInput(t *testing.T) {
 	testPeerID := "QmTestPeer"
 	rt.adminPeerManager.AddAdminPeer(testPeerID)
 
-	// Create a test HTTP request with peer ID header
-	req := httptest.NewRequest(http.MethodGet, "/admin/health", nil)
-	req.Header.Set("X-Peer-ID", testPeerID)
+	// Create a test HTTP request with a client certificate for the peer
+	req := withClientCert(httptest.NewRequest(http.MethodGet, "/admin/health", nil), testPeerID)
 
 	// Test creating authz input
 	input := rt.createAuthzInput(req)
@@ -35,7 +46,16 @@ func TestCreateAuthzInput(t *testing.T) {
 	assert.Equal(t, http.MethodGet, input["method"])
 	assert.Equal(t, "/admin/health", input["path"])
 	assert.Equal(t, testPeerID, input["peer_id"])
+	assert.Equal(t, testPeerID, input["user"])
 	assert.Equal(t, true, input["peer_is_admin"])
+
+	// A peer ID header alone does not identify the caller.
+	req = httptest.NewRequest(http.MethodGet, "/admin/health", nil)
+	req.Header.Set("X-Peer-ID", testPeerID)
+	input = rt.createAuthzInput(req)
+	assert.NotContains(t, input, "peer_id")
+	assert.NotContains(t, input, "peer_is_admin")
+	assert.Equal(t, "anonymous", input["user"])
 }
 
 func TestAdminAuthorization(t *testing.T) {
@@ -53,9 +73,8 @@ func TestAdminAuthorization(t *testing.T) {
 	testPeerID := "QmTestPeer"
 	rt.adminPeerManager.AddAdminPeer(testPeerID)
 
-	// Create a test HTTP request with peer ID header
-	req := httptest.NewRequest(http.MethodGet, "/admin/health", nil)
-	req.Header.Set("X-Peer-ID", testPeerID)
+	// Create a test HTTP request with a client certificate for the peer
+	req := withClientCert(httptest.NewRequest(http.MethodGet, "/admin/health", nil), testPeerID)
 
 	// Test creating authz input
 	input := rt.createAuthzInput(req)
@@ -65,7 +84,7 @@ func TestAdminAuthorization(t *testing.T) {
 
 	// Test with a non-admin peer
 	nonAdminPeerID := "QmNonAdminPeer"
-	req.Header.Set("X-Peer-ID", nonAdminPeerID)
+	req = withClientCert(httptest.NewRequest(http.MethodGet, "/admin/health", nil), nonAdminPeerID)
 	input = rt.createAuthzInput(req)
 	assert.Equal(t, false, input["peer_is_admin"])
 }
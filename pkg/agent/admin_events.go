@@ -0,0 +1,223 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	eventsKeepAlive    = 15 * time.Second
+	eventsWriteTimeout = 10 * time.Second
+	eventsDefaultLimit = 100
+)
+
+var eventsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// eventsHandler serves the lifecycle event stream. Depending on the request
+// it answers with a JSON array of retained events, a Server-Sent Events
+// stream (Accept: text/event-stream) or a WebSocket of JSON events.
+//
+// Query parameters: type (comma separated, "module.*" style prefixes allowed),
+// source, subject, severity (minimum), since (event ID) and, for the JSON
+// form, limit. SSE clients resume with the Last-Event-ID header.
+func (rt *Runtime) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// Streams can stay open for hours, so audit on connect rather than on return.
+	rt.appendAudit("events", input)
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case websocket.IsWebSocketUpgrade(r):
+		rt.streamEventsWebSocket(w, r, filter)
+	case strings.Contains(r.Header.Get("Accept"), "text/event-stream"):
+		rt.streamEventsSSE(w, r, filter)
+	default:
+		limit := eventsDefaultLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+				writeJSONError(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rt.events.Recent(filter, limit)); err != nil {
+			rt.logger.Error("Failed to encode events", "error", err)
+		}
+	}
+}
+
+func parseEventFilter(r *http.Request) (EventFilter, error) {
+	q := r.URL.Query()
+	filter := EventFilter{
+		Types:   splitQueryList(q["type"]),
+		Sources: splitQueryList(q["source"]),
+		Subject: q.Get("subject"),
+	}
+
+	switch sev := EventSeverity(q.Get("severity")); sev {
+	case "", SeverityInfo, SeverityWarning, SeverityError:
+		filter.MinSeverity = sev
+	default:
+		return filter, fmt.Errorf("invalid severity %q", sev)
+	}
+
+	since := q.Get("since")
+	if since == "" {
+		since = r.Header.Get("Last-Event-ID")
+	}
+	if since != "" {
+		id, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since parameter %q", since)
+		}
+		filter.SinceID = id
+	}
+	return filter, nil
+}
+
+// splitQueryList flattens repeated and comma-separated query values.
+func splitQueryList(values []string) []string {
+	var out []string
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+func (rt *Runtime) streamEventsSSE(w http.ResponseWriter, r *http.Request, filter EventFilter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSONError(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	backlog, ch, cancel := rt.events.Subscribe(filter, 0)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(ev Event) error {
+		data, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+		return err
+	}
+
+	for _, ev := range backlog {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-ch:
+			if err := write(ev); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func (rt *Runtime) streamEventsWebSocket(w http.ResponseWriter, r *http.Request, filter EventFilter) {
+	conn, err := eventsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		rt.logger.Warn("Failed to upgrade event stream to WebSocket", "error", err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	backlog, ch, cancel := rt.events.Subscribe(filter, 0)
+	defer cancel()
+
+	// The read loop only exists to process control frames and notice when
+	// the client goes away; clients are not expected to send anything.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(ev Event) error {
+		_ = conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout))
+		return conn.WriteJSON(ev)
+	}
+
+	for _, ev := range backlog {
+		if err := write(ev); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(eventsKeepAlive)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-closed:
+			return
+		case ev := <-ch:
+			if err := write(ev); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
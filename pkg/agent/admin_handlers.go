@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -77,6 +78,7 @@ func (rt *Runtime) statusHandler(w http.ResponseWriter, r *http.Request) {
 		Version:       rt.updateManager.CurrentVersion(),
 		PeerID:        rt.identity.PeerID.String(),
 		LoadedModules: rt.moduleManager.ListModules(),
+		Degradation:   rt.degradationStatus(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -338,7 +340,7 @@ func (rt *Runtime) updateHandler(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodPost:
-		go rt.updateManager.CheckForUpdate()
+		go rt.updateManager.CheckForUpdate(context.WithoutCancel(r.Context()))
 		w.WriteHeader(http.StatusAccepted)
 		_, _ = fmt.Fprintln(w, "Update check initiated.")
 	default:
@@ -367,7 +369,9 @@ func (rt *Runtime) peerCopyHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := rt.recoveryController.RequestPeerCopy(r.Context(), peerID, moduleName); err != nil {
+	err := rt.recoveryController.RequestPeerCopy(r.Context(), peerID, moduleName)
+	rt.emitHealing("peer_copy", moduleName, "admin", err)
+	if err != nil {
 		rt.logger.Error("Failed to request peer copy", "peer_id", peerID, "module_name", moduleName, "error", err)
 		writeJSONError(w, "Failed to request peer copy: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -389,7 +393,9 @@ func (rt *Runtime) triggerRegenerationHandler(w http.ResponseWriter, r *http.Req
 	}
 	defer rt.appendAudit("trigger_regeneration", input)
 
-	if err := rt.regenerator.TriggerRegeneration(r.Context()); err != nil {
+	err := rt.regenerator.TriggerRegeneration(r.Context())
+	rt.emitHealing("regenerate", rt.binaryPath, "admin", err)
+	if err != nil {
 		rt.logger.Error("Failed to trigger regeneration", "error", err)
 		writeJSONError(w, "Failed to trigger regeneration: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
+)
+
+// runAlertEvents feeds lifecycle events into the alerting engine for event
+// and absence rules.
+func (rt *Runtime) runAlertEvents(ctx context.Context) {
+	backlog, ch, cancel := rt.events.Subscribe(EventFilter{}, 256)
+	defer cancel()
+	for _, ev := range backlog {
+		rt.alerts.ObserveEvent(ev.Time, string(ev.Type), ev.Subject)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev, ok := <-ch:
+			if !ok {
+				return
+			}
+			rt.alerts.ObserveEvent(ev.Time, string(ev.Type), ev.Subject)
+		}
+	}
+}
+
+type alertsResponse struct {
+	Alerts   []alerting.Alert   `json:"alerts"`
+	Silences []alerting.Silence `json:"silences"`
+}
+
+func (rt *Runtime) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("alerts", input)
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rt.alerts == nil {
+		writeJSONError(w, "Alerting not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	resp := alertsResponse{Alerts: rt.alerts.Alerts(), Silences: rt.alerts.Silences()}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		rt.logger.Error("Failed to encode alerts response", "error", err)
+	}
+}
+
+func (rt *Runtime) silencesHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("alert-silences", input)
+
+	if rt.alerts == nil {
+		writeJSONError(w, "Alerting not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rt.alerts.Silences()); err != nil {
+			rt.logger.Error("Failed to encode silences response", "error", err)
+		}
+	case http.MethodPost:
+		var req struct {
+			Matchers map[string]string `json:"matchers"`
+			Duration string            `json:"duration"`
+			EndsAt   time.Time         `json:"ends_at"`
+			Comment  string            `json:"comment"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		endsAt := req.EndsAt
+		if req.Duration != "" {
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				writeJSONError(w, "Invalid duration", http.StatusBadRequest)
+				return
+			}
+			endsAt = time.Now().Add(d)
+		}
+		user, _ := input["user"].(string)
+		silence, err := rt.alerts.AddSilence(alerting.Silence{
+			Matchers:  req.Matchers,
+			EndsAt:    endsAt,
+			CreatedBy: user,
+			Comment:   req.Comment,
+		})
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rt.logger.Info("Alert silence created", "id", silence.ID, "matchers", silence.Matchers, "ends_at", silence.EndsAt)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(silence); err != nil {
+			rt.logger.Error("Failed to encode silence response", "error", err)
+		}
+	case http.MethodDelete:
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			writeJSONError(w, "Missing silence id", http.StatusBadRequest)
+			return
+		}
+		if err := rt.alerts.ExpireSilence(id); err != nil {
+			writeJSONError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		rt.logger.Info("Alert silence expired", "id", id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,74 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
+)
+
+func TestAlertsAndSilencesHandlers(t *testing.T) {
+	engine, err := alerting.NewEngine(nil, alerting.Config{Enabled: true}, nil)
+	require.NoError(t, err)
+	rt := &Runtime{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		rateLimiters: make(map[string]*rate.Limiter),
+		alerts:       engine,
+	}
+	engine.Raise(alerting.Alert{Name: "Tamper", Severity: alerting.SeverityCritical, Labels: map[string]string{"node": "a"}})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/alerts", rt.alertsHandler)
+	mux.HandleFunc("/admin/alerts/silences", rt.silencesHandler)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/admin/alerts/silences", "application/json",
+		strings.NewReader(`{"matchers":{"alertname":"Tamper"},"duration":"1h","comment":"rebuild"}`))
+	require.NoError(t, err)
+	var silence alerting.Silence
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&silence))
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Equal(t, "anonymous", silence.CreatedBy)
+
+	resp, err = http.Get(ts.URL + "/admin/alerts")
+	require.NoError(t, err)
+	var body alertsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	require.Len(t, body.Alerts, 1)
+	require.True(t, body.Alerts[0].Silenced)
+	require.Len(t, body.Silences, 1)
+
+	resp, err = http.Post(ts.URL+"/admin/alerts/silences", "application/json", strings.NewReader(`{"duration":"1h"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/admin/alerts/silences?id="+silence.ID, nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Empty(t, engine.Silences())
+}
+
+func TestAlertsHandlerDisabled(t *testing.T) {
+	rt := &Runtime{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		rateLimiters: make(map[string]*rate.Limiter),
+	}
+	rec := httptest.NewRecorder()
+	rt.alertsHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/alerts", nil))
+	require.Equal(t, http.StatusNotImplemented, rec.Code)
+}
@@ -0,0 +1,204 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/naviNBRuas/APA/pkg/approval"
+	"github.com/naviNBRuas/APA/pkg/rbac"
+)
+
+// approvalSweepInterval is how often pending approvals are checked for
+// expiry and auto-approval.
+const approvalSweepInterval = 15 * time.Second
+
+// initApprovals creates the queue that holds disruptive healing and response
+// actions for approval. Approvers are checked against the RBAC policy when
+// one is configured; otherwise admin API authorization alone decides.
+func (rt *Runtime) initApprovals(cfg approval.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid approvals config: %w", err)
+	}
+	q := approval.NewQueue(rt.logger, cfg)
+	if cfg.RBACPolicyPath != "" {
+		policy, err := rbac.NewOPARBAC(rt.logger, &rbac.Config{PolicyFile: cfg.RBACPolicyPath})
+		if err != nil {
+			return fmt.Errorf("failed to load approvals RBAC policy: %w", err)
+		}
+		q.SetAuthorizer(policy)
+	} else {
+		rt.logger.Warn("No approvals RBAC policy configured; any authorized admin API caller may approve disruptive actions")
+	}
+	q.OnChange(rt.onApprovalChange)
+	rt.approvals = q
+	return nil
+}
+
+// onApprovalChange publishes approval requests and decisions on the event
+// bus and audits the decisions no operator made through the admin API.
+func (rt *Runtime) onApprovalChange(req approval.Request) {
+	data := map[string]interface{}{
+		"id":     req.ID,
+		"action": req.Action.Name,
+		"source": req.Action.Source,
+		"status": req.Status,
+	}
+	switch req.Status {
+	case approval.StatusPending:
+		rt.emit(EventApprovalRequested, SeverityWarning, "approvals", req.Action.Subject,
+			fmt.Sprintf("%s awaits approval: %s", req.Action.Name, req.Action.Reason), data)
+		return
+	case approval.StatusApproved:
+		return
+	}
+
+	if req.DecidedBy != "" {
+		data["decided_by"] = req.DecidedBy
+	}
+	severity := SeverityInfo
+	if req.Error != "" {
+		data["error"] = req.Error
+		severity = SeverityError
+	}
+	rt.emit(EventApprovalDecided, severity, "approvals", req.Action.Subject,
+		fmt.Sprintf("%s %s", req.Action.Name, req.Status), data)
+
+	if rt.auditLogger == nil {
+		return
+	}
+	actor := req.DecidedBy
+	if req.Status == approval.StatusExpired {
+		actor = "approvals"
+	}
+	details := map[string]interface{}{
+		"id":      req.ID,
+		"subject": req.Action.Subject,
+		"status":  req.Status,
+	}
+	if req.Error != "" {
+		details["error"] = req.Error
+	}
+	if err := rt.auditLogger.Append(AuditEntry{Actor: actor, Action: "approval." + req.Action.Name, Details: details}); err != nil {
+		rt.logger.Error("Failed to append audit entry", "action", req.Action.Name, "error", err)
+		return
+	}
+	rt.metrics.AuditEntry()
+}
+
+// approverName identifies the caller deciding an approval from the
+// credentials createAuthzInput verified: the admin API key user, the client
+// certificate subject, or for a local request the agent's own peer ID. It
+// returns "" for a caller that is not authenticated.
+func approverName(input map[string]interface{}) string {
+	if user, _ := input["user"].(string); user != "" && user != "anonymous" {
+		return user
+	}
+	if peerID, _ := input["peer_id"].(string); peerID != "" {
+		return peerID
+	}
+	return ""
+}
+
+// approvalsHandler lists approval requests at /admin/approvals and decides
+// one with POST /admin/approvals/{id}/approve or /reject.
+func (rt *Runtime) approvalsHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("approvals", input)
+
+	if rt.approvals == nil {
+		writeJSONError(w, "Approvals not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/approvals"), "/")
+	if rest == "" {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rt.approvals.List(r.URL.Query().Get("status"))); err != nil {
+			rt.logger.Error("Failed to encode approvals response", "error", err)
+		}
+		return
+	}
+
+	id, decision, _ := strings.Cut(rest, "/")
+	if decision == "" {
+		if r.Method != http.MethodGet {
+			writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req, ok := rt.approvals.Get(id)
+		if !ok {
+			writeJSONError(w, "Approval request not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(req); err != nil {
+			rt.logger.Error("Failed to encode approval response", "error", err)
+		}
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Comment string `json:"comment"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	approver := approverName(input)
+	if approver == "" {
+		writeJSONError(w, "Deciding approvals requires an authenticated caller", http.StatusForbidden)
+		return
+	}
+	var (
+		req approval.Request
+		err error
+	)
+	switch decision {
+	case "approve":
+		req, err = rt.approvals.Approve(r.Context(), id, approver, body.Comment)
+	case "reject":
+		req, err = rt.approvals.Reject(r.Context(), id, approver, body.Comment)
+	default:
+		writeJSONError(w, "Unknown decision", http.StatusNotFound)
+		return
+	}
+	switch {
+	case errors.Is(err, approval.ErrNotFound):
+		writeJSONError(w, "Approval request not found", http.StatusNotFound)
+		return
+	case errors.Is(err, approval.ErrForbidden):
+		writeJSONError(w, err.Error(), http.StatusForbidden)
+		return
+	case err != nil:
+		writeJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(req); err != nil {
+		rt.logger.Error("Failed to encode approval response", "error", err)
+	}
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/approval"
+)
+
+func TestApprovalsHandler(t *testing.T) {
+	rt := newEventsTestRuntime(10)
+	rt.adminAPIKey = "secret"
+	rt.auditLogger = NewAuditLogger(rt.logger, filepath.Join(t.TempDir(), "audit.log"))
+	policy := filepath.Join(t.TempDir(), "rbac.yaml")
+	require.NoError(t, os.WriteFile(policy, []byte(`
+roles:
+  - name: operator
+    permissions:
+      - action: approve
+        resource: "*"
+users:
+  - name: admin-api-key
+    roles: [operator]
+`), 0o644))
+	require.NoError(t, rt.initApprovals(approval.Config{RBACPolicyPath: policy}))
+
+	runs := 0
+	req, err := rt.approvals.Submit(approval.Action{Name: "healing.restart-process", Source: "selfhealing", Subject: "net-ctl"},
+		func(ctx context.Context) error { runs++; return nil })
+	require.NoError(t, err)
+	require.Len(t, rt.events.Recent(EventFilter{Types: []string{string(EventApprovalRequested)}}, 0), 1)
+
+	rec := httptest.NewRecorder()
+	rt.approvalsHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/approvals?status=pending", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var pending []approval.Request
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &pending))
+	require.Len(t, pending, 1)
+	require.Equal(t, req.ID, pending[0].ID)
+
+	// Callers without an approver role are refused.
+	rec = httptest.NewRecorder()
+	rt.approvalsHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/approvals/"+req.ID+"/approve", nil))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, 0, runs)
+
+	// Naming an approver in a header does not authenticate the caller.
+	httpReq := httptest.NewRequest(http.MethodPost, "/admin/approvals/"+req.ID+"/approve", nil)
+	httpReq.Header.Set("X-Peer-ID", "admin-api-key")
+	rec = httptest.NewRecorder()
+	rt.approvalsHandler(rec, httpReq)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Contains(t, rec.Body.String(), "authenticated caller")
+	require.Equal(t, 0, runs)
+
+	// Nor does a client certificate for a user without an approver role.
+	rec = httptest.NewRecorder()
+	rt.approvalsHandler(rec, withClientCert(httptest.NewRequest(http.MethodPost, "/admin/approvals/"+req.ID+"/approve", nil), "viewer"))
+	require.Equal(t, http.StatusForbidden, rec.Code)
+	require.Equal(t, 0, runs)
+
+	httpReq = httptest.NewRequest(http.MethodPost, "/admin/approvals/"+req.ID+"/approve", nil)
+	httpReq.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	rt.approvalsHandler(rec, httpReq)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var decided approval.Request
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &decided))
+	require.Equal(t, approval.StatusExecuted, decided.Status)
+	require.Equal(t, "admin-api-key", decided.DecidedBy)
+	require.Equal(t, 1, runs)
+
+	// Deciding twice conflicts.
+	httpReq = httptest.NewRequest(http.MethodPost, "/admin/approvals/"+req.ID+"/reject", nil)
+	httpReq.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	rt.approvalsHandler(rec, httpReq)
+	require.Equal(t, http.StatusConflict, rec.Code)
+
+	httpReq = httptest.NewRequest(http.MethodPost, "/admin/approvals/unknown/approve", nil)
+	httpReq.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	rt.approvalsHandler(rec, httpReq)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	events := rt.events.Recent(EventFilter{Types: []string{string(EventApprovalDecided)}}, 0)
+	require.Len(t, events, 1)
+	require.Equal(t, approval.StatusExecuted, events[0].Data["status"])
+
+	entries, err := rt.auditLogger.ReadRecent(20)
+	require.NoError(t, err)
+	found := false
+	for _, e := range entries {
+		if e.Action == "approval.healing.restart-process" {
+			found = true
+			require.Equal(t, "admin-api-key", e.Actor)
+		}
+	}
+	require.True(t, found, "decision audited")
+}
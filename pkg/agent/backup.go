@@ -0,0 +1,374 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/naviNBRuas/APA/pkg/backup"
+	"github.com/naviNBRuas/APA/pkg/networking"
+	"github.com/naviNBRuas/APA/pkg/swarm"
+)
+
+// backupTarget builds the store for the backup repository: the local
+// directory, mirrored to every configured remote target.
+func (rt *Runtime) backupTarget(cfg backup.Config) (backup.Target, error) {
+	rt.backupMirror = nil
+	local := backup.NewDirTarget(cfg.Dir)
+	var remotes []backup.Target
+	for i, tc := range cfg.Targets {
+		var (
+			target backup.Target
+			err    error
+		)
+		switch tc.Type {
+		case "s3":
+			target, err = backup.NewS3Target(tc.S3)
+		case "sftp":
+			target, err = backup.NewSFTPTarget(tc.SFTP)
+		case "peer":
+			target = rt.peerBackupTarget(tc.Peer)
+		default:
+			err = fmt.Errorf("unknown backup target type %q", tc.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("target %d: %w", i, err)
+		}
+		remotes = append(remotes, target)
+	}
+	if len(remotes) == 0 {
+		return local, nil
+	}
+	rt.backupMirror = backup.NewMirrorTarget(local, remotes...)
+	return rt.backupMirror, nil
+}
+
+// peerBackupTarget replicates backup objects to connected peers that are
+// listed as trusted or whose reputation exceeds the configured minimum, most
+// reputable first. The outcome of every request feeds back into the peer's
+// reputation.
+func (rt *Runtime) peerBackupTarget(cfg backup.PeerConfig) *backup.PeerTarget {
+	minReputation := cfg.MinReputation
+	if minReputation <= 0 {
+		minReputation = backup.DefaultMinReputation
+	}
+	return &backup.PeerTarget{
+		Store:    rt.p2p,
+		Replicas: cfg.Replicas,
+		Peers: func() []string {
+			var peers []string
+			for _, id := range rt.p2p.GetConnectedPeers() {
+				if backup.TrustedPeer(cfg.TrustedPeers, minReputation, id.String(), rt.reputationSystem.GetScore(id.String())) {
+					peers = append(peers, id.String())
+				}
+			}
+			sort.SliceStable(peers, func(i, j int) bool {
+				return rt.reputationSystem.GetScore(peers[i]) > rt.reputationSystem.GetScore(peers[j])
+			})
+			return peers
+		},
+		OnResult: func(peerID string, err error) {
+			result := swarm.Success
+			if err != nil {
+				result = swarm.Failure
+			}
+			rt.reputationSystem.RecordInteraction(peerID, swarm.NetworkConnection, result)
+		},
+	}
+}
+
+// serveBackupObject keeps backup objects for peers that are listed as
+// trusted or whose reputation exceeds the peer storage minimum.
+func (rt *Runtime) serveBackupObject(ctx context.Context, from peer.ID, req *networking.BackupRequest) *networking.BackupResponse {
+	cfg := rt.config.Backup.WithDefaults().PeerStorage
+	if !backup.TrustedPeer(cfg.TrustedPeers, cfg.MinReputation, from.String(), rt.reputationSystem.GetScore(from.String())) {
+		rt.logger.Warn("Refused backup request from untrusted peer", "peer", from)
+		return &networking.BackupResponse{Error: "peer not trusted for backup storage"}
+	}
+
+	var (
+		resp networking.BackupResponse
+		err  error
+	)
+	switch req.Op {
+	case "put":
+		err = rt.backupPeers.Put(from.String(), req.Name, req.Data)
+	case "get":
+		resp.Data, err = rt.backupPeers.Get(from.String(), req.Name)
+	case "delete":
+		err = rt.backupPeers.Delete(from.String(), req.Name)
+	case "has":
+		resp.Exists, err = rt.backupPeers.Has(from.String(), req.Name)
+	case "list":
+		resp.Names, err = rt.backupPeers.List(from.String(), req.Name)
+	default:
+		err = fmt.Errorf("unknown backup operation %q", req.Op)
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return &networking.BackupResponse{NotFound: true}
+	}
+	if err != nil {
+		rt.logger.Warn("Failed to serve backup request", "peer", from, "op", req.Op, "error", err)
+		return &networking.BackupResponse{Error: err.Error()}
+	}
+	return &resp
+}
+
+// backupNow stores the running config and a summary of the agent's state,
+// along with the configured files, as a new snapshot and applies the
+// retention policy.
+func (rt *Runtime) backupNow() (string, error) {
+	config := map[string]interface{}{}
+	if data, err := json.Marshal(rt.config); err == nil {
+		_ = json.Unmarshal(data, &config)
+	}
+	var modules []string
+	if rt.moduleManager != nil {
+		for _, m := range rt.moduleManager.ListModules() {
+			modules = append(modules, m.Name+"@"+m.Version)
+		}
+	}
+	state := map[string]interface{}{
+		"peer_id": rt.identity.PeerID.String(),
+		"modules": modules,
+	}
+
+	id, err := rt.backups.CreateBackup(config, state, nil)
+	if err != nil {
+		rt.emit(EventBackupCompleted, SeverityError, "backup", "", "Backup failed", map[string]interface{}{"error": err.Error()})
+		return "", err
+	}
+	rt.emit(EventBackupCompleted, SeverityInfo, "backup", id, "Backup created", nil)
+	if err := rt.backups.Maintain(); err != nil {
+		rt.logger.Error("Failed to apply backup retention", "error", err)
+	}
+	rt.reportBackupTargets(id)
+	return id, nil
+}
+
+// reportBackupTargets raises an event for every remote target that failed
+// while backup id was taken. The backup itself is complete in the local
+// repository; the next one copies what the target missed.
+func (rt *Runtime) reportBackupTargets(id string) {
+	if rt.backupMirror == nil {
+		return
+	}
+	targets := rt.config.Backup.Targets
+	for _, f := range rt.backupMirror.RemoteFailures() {
+		data := map[string]interface{}{"target": f.Remote, "failures": f.Count, "error": f.Err.Error()}
+		if f.Remote < len(targets) {
+			data["type"] = targets[f.Remote].Type
+		}
+		rt.logger.Warn("Backup target failed", "target", f.Remote, "failures", f.Count, "error", f.Err)
+		rt.emit(EventBackupCompleted, SeverityWarning, "backup", id, "Backup not copied to every target", data)
+	}
+}
+
+// runBackups takes a backup every Interval.
+func (rt *Runtime) runBackups(ctx context.Context) {
+	ticker := time.NewTicker(rt.config.Backup.WithDefaults().Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := rt.backupNow(); err != nil {
+				rt.logger.Error("Scheduled backup failed", "error", err)
+			}
+		}
+	}
+}
+
+// backupsHandler lists the backup catalogue (GET) or takes a backup now
+// (POST).
+func (rt *Runtime) backupsHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("backups", input)
+
+	if rt.backups == nil {
+		writeJSONError(w, "Backups not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var resp interface{}
+	switch r.Method {
+	case http.MethodGet:
+		snaps, err := rt.backups.Snapshots()
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = snaps
+	case http.MethodPost:
+		id, err := rt.backupNow()
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = map[string]string{"id": id}
+	default:
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		rt.logger.Error("Failed to encode backups response", "error", err)
+	}
+}
+
+// backupCheckHandler verifies the backup repository. With ?read_data=true
+// every chunk is read and checked, not just listed.
+func (rt *Runtime) backupCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("backups-check", input)
+
+	if r.Method != http.MethodPost {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rt.backups == nil {
+		writeJSONError(w, "Backups not enabled", http.StatusNotImplemented)
+		return
+	}
+	result, err := rt.backups.Check(r.URL.Query().Get("read_data") == "true")
+	if err != nil {
+		writeJSONError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		rt.logger.Error("Failed to encode backup check response", "error", err)
+	}
+}
+
+// backupKeyRequest adds a backup key slot, or rotates one when Slot is set.
+type backupKeyRequest struct {
+	Slot       string `json:"slot,omitempty"`
+	Type       string `json:"type"` // passphrase or recovery
+	Label      string `json:"label,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+}
+
+// backupKeysHandler lists the backup repository's key slots (GET), adds or
+// rotates a passphrase or recovery slot (POST) and removes a slot (DELETE
+// with ?id=). A new recovery key is returned once and never stored.
+func (rt *Runtime) backupKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("backups-keys", input)
+
+	if rt.backups == nil {
+		writeJSONError(w, "Backups not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	var resp interface{}
+	switch r.Method {
+	case http.MethodGet:
+		slots, err := rt.backups.KeySlots()
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = slots
+	case http.MethodPost:
+		var req backupKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		var cred backup.Credential
+		var recoveryKey string
+		switch req.Type {
+		case backup.SlotPassphrase:
+			if req.Passphrase == "" {
+				writeJSONError(w, "passphrase is required", http.StatusBadRequest)
+				return
+			}
+			cred = backup.PassphraseCredential(req.Passphrase)
+		case backup.SlotRecovery:
+			var err error
+			if recoveryKey, cred, err = backup.NewRecoveryKey(); err != nil {
+				writeJSONError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		default:
+			writeJSONError(w, "type must be passphrase or recovery", http.StatusBadRequest)
+			return
+		}
+		var slot backup.KeySlot
+		var warning string
+		var err error
+		if req.Slot != "" {
+			// The agent reads its passphrase from passphrase_file at
+			// start, so the file has to follow a rotation of its slot.
+			stale := req.Type == backup.SlotPassphrase && rt.backups.PassphraseOpens(req.Slot)
+			slot, err = rt.backups.RotateKeySlot(req.Slot, cred)
+			if err == nil && stale {
+				warning = fmt.Sprintf("the passphrase in backup.passphrase_file (%s) no longer opens key slot %s; write the new passphrase to it before the agent restarts", rt.config.Backup.PassphraseFile, slot.ID)
+				rt.logger.Warn("Rotated the backup key slot of the configured passphrase; update the passphrase file", "slot", slot.ID, "passphrase_file", rt.config.Backup.PassphraseFile)
+			}
+		} else {
+			slot, err = rt.backups.AddKeySlot(req.Label, cred)
+		}
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp = struct {
+			backup.KeySlot
+			RecoveryKey string `json:"recovery_key,omitempty"`
+			Warning     string `json:"warning,omitempty"`
+		}{slot, recoveryKey, warning}
+	case http.MethodDelete:
+		if err := rt.backups.RemoveKeySlot(r.URL.Query().Get("id")); err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp = map[string]string{"status": "removed"}
+	default:
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		rt.logger.Error("Failed to encode backup keys response", "error", err)
+	}
+}
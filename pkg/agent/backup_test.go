@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/naviNBRuas/APA/pkg/backup"
+	"github.com/naviNBRuas/APA/pkg/networking"
+	"github.com/naviNBRuas/APA/pkg/swarm"
+)
+
+func TestBackupsHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	moduleDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "m.wasm"), []byte("wasm"), 0644))
+
+	rt := &Runtime{
+		logger:       logger,
+		rateLimiters: make(map[string]*rate.Limiter),
+		config:       &Config{ModulePath: moduleDir},
+		identity:     &Identity{PeerID: "peer-a"},
+		events:       NewEventBus(16),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(rt.backupsHandler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	rt.backups = backup.NewBackupManager(logger, t.TempDir(), "test-passphrase")
+	rt.backups.SetPaths(moduleDir)
+
+	resp, err = http.Post(ts.URL, "application/json", nil)
+	require.NoError(t, err)
+	var created map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NotEmpty(t, created["id"])
+
+	resp, err = http.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var snaps []backup.Snapshot
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&snaps))
+	require.Len(t, snaps, 1)
+	require.Equal(t, created["id"], snaps[0].ID)
+	require.Equal(t, 2, snaps[0].Stats.Files)
+
+	data, err := rt.backups.RestoreBackup(created["id"])
+	require.NoError(t, err)
+	require.Equal(t, rt.identity.PeerID.String(), data.State["peer_id"])
+	require.Equal(t, moduleDir, data.Config["ModulePath"])
+
+	events := rt.events.Recent(EventFilter{}, 0)
+	require.Len(t, events, 1)
+	require.Equal(t, EventBackupCompleted, events[0].Type)
+}
+
+func TestBackupKeysHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	rt := &Runtime{
+		logger:       logger,
+		rateLimiters: make(map[string]*rate.Limiter),
+		config:       &Config{Backup: backup.Config{PassphraseFile: "/etc/apa/backup-passphrase"}},
+		backups:      backup.NewBackupManager(logger, dir, "test-passphrase"),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(rt.backupKeysHandler))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL, "application/json", strings.NewReader(`{"type":"recovery","label":"safe"}`))
+	require.NoError(t, err)
+	var added struct {
+		backup.KeySlot
+		RecoveryKey string `json:"recovery_key"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&added))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, backup.SlotRecovery, added.Type)
+	require.NotEmpty(t, added.RecoveryKey)
+
+	resp, err = http.Get(ts.URL)
+	require.NoError(t, err)
+	var slots []backup.KeySlot
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&slots))
+	resp.Body.Close()
+	require.Len(t, slots, 2)
+
+	// Rotate the passphrase slot; the recovery key still opens the
+	// repository. The passphrase file no longer does, which is reported.
+	body := `{"slot":"` + slots[0].ID + `","type":"passphrase","passphrase":"rotated"}`
+	resp, err = http.Post(ts.URL, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	var rotated struct {
+		Warning string `json:"warning"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&rotated))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Contains(t, rotated.Warning, "/etc/apa/backup-passphrase")
+	_, err = backup.NewBackupManager(logger, dir, "rotated").KeySlots()
+	require.NoError(t, err)
+	cred, err := backup.RecoveryKeyCredential(added.RecoveryKey)
+	require.NoError(t, err)
+	byRecovery := backup.NewBackupManager(logger, dir, "")
+	byRecovery.SetCredentials(cred)
+	_, err = byRecovery.KeySlots()
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"?id="+added.ID, nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = byRecovery.KeySlots()
+	require.NoError(t, err, "an opened manager keeps its keys")
+	_, err = backup.NewBackupManager(logger, dir, "").KeySlots()
+	require.Error(t, err)
+
+	resp, err = http.Post(ts.URL, "application/json", strings.NewReader(`{"type":"identity"}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestServeBackupObject(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rt := &Runtime{
+		logger:           logger,
+		config:           &Config{Backup: backup.Config{PeerStorage: backup.PeerStorageConfig{Enabled: true, MinReputation: 40}}},
+		reputationSystem: swarm.NewReputationSystem(logger),
+		backupPeers:      backup.NewPeerHost(t.TempDir(), 1<<20),
+	}
+	ctx := context.Background()
+	from := peer.ID("peer-a")
+
+	resp := rt.serveBackupObject(ctx, from, &networking.BackupRequest{Op: "put", Name: "data/ab/ab01", Data: []byte("sealed")})
+	require.Empty(t, resp.Error)
+	resp = rt.serveBackupObject(ctx, from, &networking.BackupRequest{Op: "get", Name: "data/ab/ab01"})
+	require.Equal(t, "sealed", string(resp.Data))
+	resp = rt.serveBackupObject(ctx, from, &networking.BackupRequest{Op: "list", Name: "data"})
+	require.Equal(t, []string{"data/ab/ab01"}, resp.Names)
+	resp = rt.serveBackupObject(ctx, from, &networking.BackupRequest{Op: "get", Name: "data/ab/ab02"})
+	require.True(t, resp.NotFound)
+
+	// Objects are kept per peer.
+	resp = rt.serveBackupObject(ctx, "peer-b", &networking.BackupRequest{Op: "has", Name: "data/ab/ab01"})
+	require.Empty(t, resp.Error)
+	require.False(t, resp.Exists)
+
+	// A peer whose reputation falls below the minimum is refused.
+	for i := 0; i < 10; i++ {
+		rt.reputationSystem.RecordInteraction(from.String(), swarm.NetworkConnection, swarm.Failure)
+	}
+	require.Less(t, rt.reputationSystem.GetScore(from.String()), 40.0)
+	resp = rt.serveBackupObject(ctx, from, &networking.BackupRequest{Op: "get", Name: "data/ab/ab01"})
+	require.NotEmpty(t, resp.Error)
+	require.Nil(t, resp.Data)
+
+	// With the default minimum, a peer with no history is refused unless it
+	// is listed as trusted.
+	rt.config.Backup.PeerStorage.MinReputation = 0
+	resp = rt.serveBackupObject(ctx, "peer-c", &networking.BackupRequest{Op: "has", Name: "data/ab/ab01"})
+	require.Equal(t, "peer not trusted for backup storage", resp.Error)
+	rt.config.Backup.PeerStorage.TrustedPeers = []string{peer.ID("peer-c").String()}
+	resp = rt.serveBackupObject(ctx, "peer-c", &networking.BackupRequest{Op: "has", Name: "data/ab/ab01"})
+	require.Empty(t, resp.Error)
+}
@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
@@ -17,22 +18,30 @@ import (
 	"github.com/libp2p/go-libp2p/core/peer"
 	"golang.org/x/time/rate"
 
+	"github.com/naviNBRuas/APA/pkg/alerting"
+	"github.com/naviNBRuas/APA/pkg/backup"
 	"github.com/naviNBRuas/APA/pkg/controller"
 	manager "github.com/naviNBRuas/APA/pkg/controller/manager"
 	task_orchestrator "github.com/naviNBRuas/APA/pkg/controller/task-orchestrator"
 	"github.com/naviNBRuas/APA/pkg/controlplane"
+	"github.com/naviNBRuas/APA/pkg/fleet"
 	"github.com/naviNBRuas/APA/pkg/health"
+	"github.com/naviNBRuas/APA/pkg/metrics"
 	"github.com/naviNBRuas/APA/pkg/module"
 	"github.com/naviNBRuas/APA/pkg/networking"
 	"github.com/naviNBRuas/APA/pkg/networking/mesh"
 	"github.com/naviNBRuas/APA/pkg/obfuscation"
 	"github.com/naviNBRuas/APA/pkg/opa"
+	"github.com/naviNBRuas/APA/pkg/patch"
 	"github.com/naviNBRuas/APA/pkg/persistence"
 	"github.com/naviNBRuas/APA/pkg/policy"
 	"github.com/naviNBRuas/APA/pkg/polymorphic"
 	"github.com/naviNBRuas/APA/pkg/recovery"
 	"github.com/naviNBRuas/APA/pkg/regeneration"
+	"github.com/naviNBRuas/APA/pkg/store"
 	"github.com/naviNBRuas/APA/pkg/swarm"
+	"github.com/naviNBRuas/APA/pkg/tracing"
+	"github.com/naviNBRuas/APA/pkg/transfer"
 	"github.com/naviNBRuas/APA/pkg/update"
 )
 
@@ -50,6 +59,12 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	}
 	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel}))
 
+	tracingShutdown, err := tracing.Setup(ctx, logger, config.Tracing, version)
+	if err != nil {
+		return fmt.Errorf("failed to initialize tracing: %w", err)
+	}
+	rt.tracingShutdown = tracingShutdown
+
 	identity, err := NewIdentity(config.IdentityFilePath)
 	if err != nil {
 		return fmt.Errorf("failed to initialize identity: %w", err)
@@ -64,6 +79,29 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	rt.ephemeralIDs = ephemeralMgr
 	rt.startTime = time.Now().UTC()
 	rt.rateLimiters = make(map[string]*rate.Limiter)
+	agentMetrics := metrics.New(rt.startTime)
+	rt.metrics = agentMetrics
+
+	// The state store keeps agent state that must survive a restart, next
+	// to the identity file.
+	state, err := store.New(filepath.Join(filepath.Dir(config.IdentityFilePath), "agent-state.json"), logger)
+	if err != nil {
+		return fmt.Errorf("failed to open state store: %w", err)
+	}
+	state.SetMetrics(agentMetrics)
+	rt.state = state
+	// Keep the bus across ApplyConfig so open event streams survive a reload.
+	if rt.events == nil {
+		rt.events = NewEventBus(config.Events.BufferSize)
+	}
+	rt.alerts = nil
+	if config.Alerting.Enabled {
+		alerts, err := alerting.NewEngine(logger, config.Alerting, agentMetrics.Registry())
+		if err != nil {
+			return fmt.Errorf("failed to initialize alerting: %w", err)
+		}
+		rt.alerts = alerts
+	}
 
 	analysis := obfuscation.NewAntiAnalysis(logger)
 	if analysis.DetectDebugger() {
@@ -87,15 +125,17 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 		signingPrivKey = ed25519.PrivateKey(signingPrivKeyDecoded)
 	}
 
-	policyEnforcer, err := policy.NewPolicyEnforcer(config.PolicyPath)
+	basePolicyEnforcer, err := policy.NewPolicyEnforcer(config.PolicyPath)
 	if err != nil {
 		return fmt.Errorf("failed to initialize policy enforcer: %w", err)
 	}
+	policyEnforcer := policy.NewInstrumentedEnforcer(basePolicyEnforcer, agentMetrics)
 
 	moduleManager, err := module.NewManager(ctx, logger, config.ModulePath, signingPrivKey, policyEnforcer)
 	if err != nil {
 		return fmt.Errorf("failed to initialize module manager: %w", err)
 	}
+	moduleManager.SetMetrics(agentMetrics)
 
 	repSystem := swarm.NewReputationSystem(logger)
 	routingMgr := swarm.NewRoutingManager(logger, repSystem)
@@ -105,6 +145,7 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	if err != nil {
 		return fmt.Errorf("failed to initialize P2P networking: %w", err)
 	}
+	p2p.SetMetrics(agentMetrics)
 
 	if config.Mesh.NodeName == "" {
 		config.Mesh.NodeName = identity.PeerID.String()[:12]
@@ -150,11 +191,31 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	if err != nil {
 		return fmt.Errorf("failed to initialize update manager: %w", err)
 	}
+	updateManager.SetMetrics(agentMetrics)
 
 	healthController := health.NewHealthController(logger)
-	healthController.RegisterCheck(health.NewProcessLivenessCheck())
+	healthController.Configure(config.Health)
+	healthController.RegisterCheckWithOptions(health.NewProcessLivenessCheck(), health.CheckOptions{Critical: true, Liveness: true})
+	healthController.OnCheckFailed = func(result health.CheckResult) {
+		rt.emit(EventHealthCheckFailed, SeverityWarning, "health", result.Name, "Health check failed", map[string]interface{}{"error": result.Message, "component": result.Component, "critical": result.Critical})
+	}
 
 	controllerManager := manager.NewManager(logger, config.ControllerPath, policyEnforcer)
+	controllerManager.SetMetrics(agentMetrics)
+	controllerManager.OnControllerStart = func(name string, restart bool, err error) {
+		if err != nil {
+			rt.emit(EventControllerFailed, SeverityError, "controller", name, "Controller failed to start", map[string]interface{}{"restart": restart, "error": err.Error()})
+			return
+		}
+		rt.emit(EventControllerStarted, SeverityInfo, "controller", name, "Controller started", map[string]interface{}{"restart": restart})
+	}
+	controllerManager.OnControllerExit = func(name string, err error) {
+		data := map[string]interface{}{}
+		if err != nil {
+			data["error"] = err.Error()
+		}
+		rt.emit(EventControllerCrashed, SeverityError, "controller", name, "Controller process exited unexpectedly", data)
+	}
 
 	var controllers []controller.Controller
 	taskOrchestrator := task_orchestrator.NewTaskOrchestrator(logger, identity.PeerID.String())
@@ -183,6 +244,7 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	rt.controllerManager = controllerManager
 	rt.controllers = controllers
 	rt.advanced = advancedRuntime
+	rt.applyResilience(config.Resilience)
 
 	activateCount := 0
 	advancedRuntime.SetActions(AutonomousActions{
@@ -219,6 +281,55 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	})
 	rt.controlPlane = controlplane.New(logger, cpTransport, config.ControlPlane)
 
+	rt.rollout = nil
+	if config.Update.Rollout.Enabled {
+		rt.rollout = update.NewRollout(logger, config.Update.Rollout, identity.PeerID.String(), rt.controlPlane)
+		if err := rt.rollout.SetSigningKey(identity.PrivKey); err != nil {
+			return fmt.Errorf("failed to set rollout signing key: %w", err)
+		}
+		rt.rollout.SetState(rt.state)
+		updateManager.SetRollout(rt.rollout)
+	}
+
+	rt.transfer = nil
+	if config.Transfer.Enabled {
+		store, err := transfer.NewStore(config.Transfer.WithDefaults().Dir)
+		if err != nil {
+			return fmt.Errorf("failed to initialize transfer store: %w", err)
+		}
+		rt.transfer = transfer.New(logger, config.Transfer, store, p2p)
+		rt.transfer.SetMetrics(agentMetrics)
+		p2p.SetContentSource(store)
+		updateManager.SetContentStore(rt.transfer)
+	}
+
+	rt.patches = nil
+	if config.Patch.Enabled {
+		keys, err := patch.ParseKeys(config.Patch.TrustedKeys)
+		if err != nil {
+			return fmt.Errorf("invalid patch config: %w", err)
+		}
+		rt.patches = patch.NewPatchManager(logger)
+		rt.patches.SetTrustedKeys(keys...)
+		rt.patches.SetCurrentVersion("agent", "", version)
+		drivers := patch.FileHandler{Dir: config.Patch.WithDefaults().DriverDir}
+		driverVersions, err := drivers.Versions()
+		if err != nil {
+			return fmt.Errorf("failed to read patched driver versions: %w", err)
+		}
+		for name, v := range driverVersions {
+			rt.patches.SetCurrentVersion("driver", name, v)
+		}
+		rt.patches.SetState(rt.state)
+		rt.patches.RegisterHandler("module", patch.ModuleHandler{Modules: moduleManager})
+		rt.patches.RegisterHandler("driver", drivers)
+		rt.patches.RegisterHandler("agent", patch.AgentHandler{Stager: updateManager})
+		rt.patches.SetTransport(p2p)
+		p2p.SetPatchHandler(rt.receivePatch)
+	}
+
+	rt.fleet = fleet.NewAggregator(identity.PeerID.String(), config.Fleet)
+
 	rt.adminPeerManager = NewAdminPeerManager(logger)
 	rt.adminPeerManager.AddAdminPeer(identity.PeerID.String())
 
@@ -244,8 +355,99 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	rt.auditLogger = NewAuditLogger(logger, auditPath)
 	rt.logger.Info("Admin audit log initialized", "path", auditPath)
 
+	rt.backups = nil
+	if config.Backup.Enabled {
+		backupConfig := config.Backup.WithDefaults()
+		passphrase, err := os.ReadFile(backupConfig.PassphraseFile)
+		if err != nil {
+			return fmt.Errorf("failed to read backup passphrase: %w", err)
+		}
+		rt.backups = backup.NewBackupManager(logger, backupConfig.Dir, strings.TrimSpace(string(passphrase)))
+		rt.backups.SetIdentityKey(privBytes)
+		if backupConfig.RecoveryKeyFile != "" {
+			recoveryKey, err := os.ReadFile(backupConfig.RecoveryKeyFile)
+			if err != nil {
+				return fmt.Errorf("failed to read backup recovery key: %w", err)
+			}
+			cred, err := backup.RecoveryKeyCredential(string(recoveryKey))
+			if err != nil {
+				return fmt.Errorf("failed to read backup recovery key: %w", err)
+			}
+			rt.backups.SetCredentials(cred)
+		}
+		rt.backups.SetPaths(append([]string{config.ModulePath, config.ControllerPath, config.IdentityFilePath, auditPath}, backupConfig.Paths...)...)
+		rt.backups.SetRetention(backupConfig.Retention)
+		target, err := rt.backupTarget(backupConfig)
+		if err != nil {
+			return fmt.Errorf("failed to configure backup targets: %w", err)
+		}
+		rt.backups.SetTarget(target)
+	}
+	rt.backupPeers = nil
+	if config.Backup.PeerStorage.Enabled {
+		peerStorage := config.Backup.WithDefaults().PeerStorage
+		rt.backupPeers = backup.NewPeerHost(peerStorage.Dir, peerStorage.Quota)
+		p2p.SetBackupHandler(rt.serveBackupObject)
+	}
+
 	recoveryController := recovery.NewRecoveryController(logger, config, rt.ApplyConfig, p2p, moduleManager, controllerManager)
 	rt.recoveryController = recoveryController
+	recoveryController.OnQuarantine = func(nodeID string) {
+		rt.emit(EventNodeQuarantined, SeverityWarning, "recovery", nodeID, "Node quarantined", nil)
+	}
+
+	rt.p2pRecovery = nil
+	if config.Recovery.Enabled {
+		rt.p2pRecovery = recovery.NewP2PRecoveryManager(logger, p2p, moduleManager, controllerManager, nil, recoveryReputation{repSystem})
+		if err := rt.p2pRecovery.Configure(config.Recovery); err != nil {
+			return fmt.Errorf("invalid recovery config: %w", err)
+		}
+		rt.p2pRecovery.SetIdentity(identity.PeerID, identity.PrivKey)
+		rt.p2pRecovery.SetTransport(p2p)
+		rt.p2pRecovery.SetPolicyEnforcer(policyEnforcer)
+		if signingPrivKey != nil {
+			rt.p2pRecovery.AddModuleKeys(signingPrivKey.Public().(ed25519.PublicKey))
+		}
+		rt.p2pRecovery.SetLocalState(recovery.LocalState{
+			Config:      rt.shareableConfig,
+			ApplyConfig: rt.applyRecoveredConfig,
+			State:       rt.recoveryState,
+			ApplyState:  rt.applyRecoveryState,
+		})
+		p2p.SetRecoveryHandler(rt.p2pRecovery.HandleRequest)
+	}
+
+	rt.registerHealthChecks(config)
+
+	if config.Approvals.Enabled {
+		if err := rt.initApprovals(config.Approvals); err != nil {
+			return err
+		}
+	}
+
+	if err := rt.initFaults(config.Faults); err != nil {
+		return fmt.Errorf("invalid faults config: %w", err)
+	}
+
+	rt.shedder = nil
+	if config.Degradation.Enabled {
+		if err := rt.initDegradation(config); err != nil {
+			return err
+		}
+	}
+
+	if config.Healing.Enabled {
+		moduleKeys, err := config.Recovery.TrustedModuleKeys()
+		if err != nil {
+			return fmt.Errorf("invalid recovery config: %w", err)
+		}
+		if signingPrivKey != nil {
+			moduleKeys = append(moduleKeys, signingPrivKey.Public().(ed25519.PublicKey))
+		}
+		if err := rt.initHealing(config.Healing, moduleKeys); err != nil {
+			return err
+		}
+	}
 
 	execPath, err := os.Executable()
 	if err != nil {
@@ -279,7 +481,8 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	rt.propagationManager = persistence.NewPropagationManager(logger, execPath, p2p, identity.PeerID.String())
 
 	moduleManager.OnModuleLoad = func(manifest module.Manifest) {
-		if err := p2p.AnnounceModule(context.Background(), manifest); err != nil {
+		rt.emit(EventModuleLoaded, SeverityInfo, "module", manifest.Name, "Module loaded", map[string]interface{}{"version": manifest.Version})
+		if err := p2p.AnnounceModuleContent(context.Background(), manifest, rt.publishModule(manifest)); err != nil {
 			logger.Error("Failed to announce module", "name", manifest.Name, "error", err)
 		}
 		if rt.meshNetwork != nil {
@@ -307,7 +510,10 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 				if ctx == nil {
 					ctx = context.Background()
 				}
-				manifest, wasmBytes, err := p2p.FetchModule(ctx, peerID, announcement.Manifest.Name, announcement.Manifest.Version)
+				manifest, wasmBytes, err := rt.fetchModuleContent(ctx, peerID, announcement)
+				if err != nil {
+					manifest, wasmBytes, err = p2p.FetchModule(ctx, peerID, announcement.Manifest.Name, announcement.Manifest.Version)
+				}
 				if err != nil {
 					logger.Error("Failed to fetch module", "name", announcement.Manifest.Name, "error", err)
 					return
@@ -343,6 +549,39 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 	}
 
 	updateManager.OnUpdateReady = rt.Stop
+	updateManager.OnCheckComplete = func(result, version string, err error) {
+		data := map[string]interface{}{"result": result, "current_version": updateManager.CurrentVersion()}
+		if version != "" {
+			data["release_version"] = version
+		}
+		if err != nil {
+			data["error"] = err.Error()
+		}
+		switch {
+		case result == "rolled_back":
+			rt.emit(EventUpdateReady, SeverityWarning, "update", version, "Restarting to roll back to the previous binary", data)
+		case err != nil:
+			rt.emit(EventUpdateChecked, SeverityError, "update", version, "Update check failed", data)
+		case result == "updated":
+			rt.emit(EventUpdateReady, SeverityInfo, "update", version, "Update downloaded and verified; restarting to apply", data)
+		case result == "deferred":
+			rt.emit(EventUpdateChecked, SeverityInfo, "update", version, "Update deferred by staged rollout", data)
+		case result == "skipped":
+			rt.emit(EventUpdateChecked, SeverityWarning, "update", version, "Release skipped; it failed post-update probation before", data)
+		case result == "confirmed":
+			rt.emit(EventUpdateChecked, SeverityInfo, "update", version, "Update passed post-update probation", data)
+		default:
+			rt.emit(EventUpdateChecked, SeverityInfo, "update", version, "Agent is up to date", data)
+		}
+	}
+
+	p2p.SetPeerEventHandler(func(id peer.ID, connected bool) {
+		if connected {
+			rt.emit(EventPeerJoined, SeverityInfo, "p2p", id.String(), "Peer connected", nil)
+		} else {
+			rt.emit(EventPeerLeft, SeverityInfo, "p2p", id.String(), "Peer disconnected", nil)
+		}
+	})
 
 	if config.Update.EnableP2P {
 		updateManager.SetP2PNetwork(p2p)
@@ -350,6 +589,9 @@ func (rt *Runtime) init(ctx context.Context, config *Config, version string) err
 			logger.Info("Received request for update", "version", version)
 			return rt.GetCurrentRelease()
 		})
+		p2p.SetFetchUpdateDeltaHandler(func(version, baseSHA256 string) (*update.ReleaseInfo, []byte, error) {
+			return updateManager.GetReleaseDelta(baseSHA256)
+		})
 	}
 
 	if rt.topologyManager != nil {
@@ -43,5 +43,32 @@ func validateConfig(c *Config) error {
 	if c.AdminTLSRequireClientCert && c.AdminTLSClientCA == "" {
 		return fmt.Errorf("admin_tls_client_ca is required when admin_tls_require_client_cert is true")
 	}
+	if c.Update.Rollout.Enabled {
+		if err := c.Update.Rollout.Validate(); err != nil {
+			return fmt.Errorf("invalid update rollout config: %w", err)
+		}
+	}
+	if c.Alerting.Enabled {
+		if err := c.Alerting.Validate(); err != nil {
+			return fmt.Errorf("invalid alerting config: %w", err)
+		}
+	}
+	if c.Backup.Enabled && c.Backup.PassphraseFile == "" {
+		return fmt.Errorf("backup.passphrase_file is required when backups are enabled")
+	}
+	if err := c.Resilience.Validate(); err != nil {
+		return fmt.Errorf("invalid resilience config: %w", err)
+	}
+	if err := c.Degradation.Validate(); err != nil {
+		return fmt.Errorf("invalid degradation config: %w", err)
+	}
+	if err := c.Faults.Validate(); err != nil {
+		return fmt.Errorf("invalid faults config: %w", err)
+	}
+	for i, target := range c.Backup.Targets {
+		if err := target.Validate(); err != nil {
+			return fmt.Errorf("invalid backup.targets[%d]: %w", i, err)
+		}
+	}
 	return nil
 }
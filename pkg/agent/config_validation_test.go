@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/robustness"
 )
 
 func TestValidateConfig(t *testing.T) {
@@ -20,6 +22,14 @@ func TestValidateConfig(t *testing.T) {
 	err = validateConfig(cfg)
 	require.NoError(t, err, "unexpected error after populating required fields")
 
+	cfg.Resilience.PeerFetches.CircuitBreaker.FailureRateThreshold = 1.5
+	require.Error(t, validateConfig(cfg), "expected error for a failure rate above 1")
+	cfg.Resilience.PeerFetches.CircuitBreaker.FailureRateThreshold = 0
+
+	cfg.Degradation.Profiles = []robustness.DegradationProfile{{Level: "overloaded", Enter: robustness.PressureThresholds{CPU: 90}}}
+	require.Error(t, validateConfig(cfg), "expected error for an unknown degradation level")
+	cfg.Degradation.Profiles = nil
+
 	cfg.AdminTLSRequireClientCert = true
 	cfg.AdminTLSClientCA = ""
 	err = validateConfig(cfg)
@@ -0,0 +1,327 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/mem"
+
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/naviNBRuas/APA/pkg/robustness"
+	"github.com/naviNBRuas/APA/pkg/store"
+)
+
+// degradationStateKey is where the active level is kept in the state store
+// so that an agent restarting under pressure resumes shedding at once.
+const degradationStateKey = "degradation"
+
+// DegradationConfig configures load shedding under resource pressure. The
+// profiles decide when each level is entered; the lists below decide what
+// the non_critical_modules and optional_controllers features cover.
+type DegradationConfig struct {
+	robustness.DegradationConfig `yaml:",inline"`
+	CriticalModules              []string `yaml:"critical_modules"`     // modules never paused
+	OptionalControllers          []string `yaml:"optional_controllers"` // controllers stopped when shedding
+}
+
+// DegradationStatus is the load shedding state reported by /admin/status.
+type DegradationStatus struct {
+	Level              robustness.DegradationLevel `json:"level"`
+	Since              time.Time                   `json:"since"`
+	IntervalFactor     float64                     `json:"interval_factor"`
+	DisabledFeatures   []string                    `json:"disabled_features,omitempty"`
+	PausedModules      []string                    `json:"paused_modules,omitempty"`
+	StoppedControllers []string                    `json:"stopped_controllers,omitempty"`
+	Usage              *robustness.ResourceUsage   `json:"usage,omitempty"`
+}
+
+// sheddableModules pauses and resumes modules.
+type sheddableModules interface {
+	RunningModules() []*module.Manifest
+	StopModule(name string) error
+	RestartModule(ctx context.Context, name string) error
+}
+
+// sheddableControllers stops and starts controllers.
+type sheddableControllers interface {
+	StopController(ctx context.Context, name string) error
+	StartController(ctx context.Context, name string) error
+}
+
+// loadShedder applies the profile of the current degradation level to the
+// agent and undoes it when the level drops.
+type loadShedder struct {
+	cfg         DegradationConfig
+	manager     *robustness.DegradationManager
+	modules     sheddableModules
+	controllers sheddableControllers
+	sample      func() *robustness.HealthMetrics
+
+	mu       sync.Mutex
+	runCtx   context.Context
+	since    time.Time
+	factor   float64
+	disabled []string
+	paused   []string
+	stopped  []string
+	usage    *robustness.ResourceUsage
+}
+
+// persistedDegradation is the level kept in the state store.
+type persistedDegradation struct {
+	Level robustness.DegradationLevel `json:"level"`
+	Since time.Time                   `json:"since"`
+}
+
+// initDegradation creates the load shedder. It stretches the flush interval
+// of the state store opened at startup.
+func (rt *Runtime) initDegradation(config *Config) error {
+	cfg := config.Degradation
+	cfg.DegradationConfig = cfg.DegradationConfig.WithDefaults()
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid degradation config: %w", err)
+	}
+
+	stateDir := filepath.Dir(config.IdentityFilePath)
+	rt.newLoadShedder(cfg, func() *robustness.HealthMetrics { return sampleResourceUsage(stateDir) })
+	rt.shedder.modules = rt.moduleManager
+	rt.shedder.controllers = rt.controllerManager
+	return nil
+}
+
+// newLoadShedder wires a load shedder for cfg into the runtime.
+func (rt *Runtime) newLoadShedder(cfg DegradationConfig, sample func() *robustness.HealthMetrics) {
+	dm := robustness.NewDegradationManager(rt.logger, cfg.DegradationConfig)
+	rt.shedder = &loadShedder{
+		cfg:     cfg,
+		manager: dm,
+		sample:  sample,
+		since:   time.Now(),
+		factor:  1,
+		runCtx:  context.Background(),
+	}
+	dm.OnChange(rt.onDegradationChange)
+}
+
+// sampleResourceUsage reads CPU and memory usage and the usage of the disk
+// holding the agent's state.
+func sampleResourceUsage(stateDir string) *robustness.HealthMetrics {
+	usage := &robustness.ResourceUsage{}
+	if pct, err := cpu.Percent(0, false); err == nil && len(pct) > 0 {
+		usage.CPU = pct[0]
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		usage.Memory = vm.UsedPercent
+	}
+	if du, err := disk.Usage(stateDir); err == nil {
+		usage.Disk = du.UsedPercent
+	}
+	return &robustness.HealthMetrics{ResourceUsage: usage}
+}
+
+// runDegradation samples resource usage every interval and moves between
+// degradation levels until ctx is done. A level persisted by a previous run
+// is restored first.
+func (rt *Runtime) runDegradation(ctx context.Context) {
+	s := rt.shedder
+	s.mu.Lock()
+	s.runCtx = ctx
+	s.mu.Unlock()
+
+	if rt.state != nil {
+		var saved persistedDegradation
+		if err := rt.state.Get(degradationStateKey, &saved); err == nil && saved.Level != robustness.DegradationNone {
+			rt.logger.Info("Resuming degradation level from previous run", "level", saved.Level)
+			s.manager.ApplyDegradation(saved.Level)
+		}
+	}
+
+	ticker := time.NewTicker(s.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		rt.assessDegradation()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// assessDegradation samples resource usage once and applies the level it
+// calls for.
+func (rt *Runtime) assessDegradation() {
+	s := rt.shedder
+	metrics := s.sample()
+	s.mu.Lock()
+	s.usage = metrics.ResourceUsage
+	s.mu.Unlock()
+	s.manager.ApplyAssessment(s.manager.AssessDegradationLevel(metrics), metrics)
+}
+
+// onDegradationChange sheds or restores load for the new level.
+func (rt *Runtime) onDegradationChange(from, to robustness.DegradationLevel, profile *robustness.DegradationProfile) {
+	s := rt.shedder
+	var disabled []string
+	factor := 1.0
+	if profile != nil {
+		disabled = profile.DisabledFeatures
+		if profile.IntervalFactor > 1 {
+			factor = profile.IntervalFactor
+		}
+	}
+
+	since := time.Now()
+	s.mu.Lock()
+	ctx := s.runCtx
+	s.since = since
+	s.factor = factor
+	s.disabled = disabled
+	s.mu.Unlock()
+
+	if containsString(disabled, robustness.FeatureNonCriticalModules) {
+		rt.pauseModules()
+	} else {
+		rt.resumeModules(ctx)
+	}
+	if containsString(disabled, robustness.FeatureOptionalControllers) {
+		rt.stopOptionalControllers(ctx)
+	} else {
+		rt.startOptionalControllers(ctx)
+	}
+
+	if rt.p2p != nil {
+		rt.p2p.SetHeartbeatScale(factor)
+	}
+	if rt.state != nil {
+		rt.state.SetFlushInterval(time.Duration(float64(store.DefaultFlushInterval) * factor))
+		if err := rt.state.Set(degradationStateKey, persistedDegradation{Level: to, Since: since}); err != nil {
+			rt.logger.Error("Failed to record degradation level", "error", err)
+		}
+	}
+
+	severity, message := SeverityWarning, "Shedding load under resource pressure"
+	if to == robustness.DegradationNone {
+		severity, message = SeverityInfo, "Resource pressure cleared; load restored"
+	} else if to.Rank() < from.Rank() {
+		severity, message = SeverityInfo, "Resource pressure easing; restoring some load"
+	}
+	rt.logger.Info("Degradation level changed", "from", from, "to", to, "interval_factor", factor)
+	rt.emit(EventDegradationChanged, severity, "degradation", string(to), message, map[string]interface{}{
+		"from":              string(from),
+		"to":                string(to),
+		"interval_factor":   factor,
+		"disabled_features": disabled,
+	})
+}
+
+// pauseModules stops every running module not listed as critical. Modules
+// that are loaded but not running are left alone, so resuming does not start
+// them.
+func (rt *Runtime) pauseModules() {
+	s := rt.shedder
+	if s.modules == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.modules.RunningModules() {
+		if containsString(s.cfg.CriticalModules, m.Name) || containsString(s.paused, m.Name) {
+			continue
+		}
+		if err := s.modules.StopModule(m.Name); err != nil {
+			rt.logger.Warn("Failed to pause module", "name", m.Name, "error", err)
+			continue
+		}
+		s.paused = append(s.paused, m.Name)
+	}
+}
+
+// resumeModules runs the modules paused by pauseModules again, each in a
+// new instance since stopping a module closes it.
+func (rt *Runtime) resumeModules(ctx context.Context) {
+	s := rt.shedder
+	s.mu.Lock()
+	paused := s.paused
+	s.paused = nil
+	s.mu.Unlock()
+	for _, name := range paused {
+		go func(name string) {
+			if err := s.modules.RestartModule(ctx, name); err != nil {
+				rt.logger.Error("Failed to resume module", "name", name, "error", err)
+				rt.emit(EventModuleFailed, SeverityError, "module", name, "Module run failed", map[string]interface{}{"error": err.Error()})
+			}
+		}(name)
+	}
+}
+
+// stopOptionalControllers stops the controllers listed as optional.
+func (rt *Runtime) stopOptionalControllers(ctx context.Context) {
+	s := rt.shedder
+	if s.controllers == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, name := range s.cfg.OptionalControllers {
+		if containsString(s.stopped, name) {
+			continue
+		}
+		if err := s.controllers.StopController(ctx, name); err != nil {
+			rt.logger.Warn("Failed to stop optional controller", "name", name, "error", err)
+			continue
+		}
+		s.stopped = append(s.stopped, name)
+	}
+}
+
+// startOptionalControllers starts the controllers stopped by
+// stopOptionalControllers again.
+func (rt *Runtime) startOptionalControllers(ctx context.Context) {
+	s := rt.shedder
+	s.mu.Lock()
+	stopped := s.stopped
+	s.stopped = nil
+	s.mu.Unlock()
+	for _, name := range stopped {
+		if err := s.controllers.StartController(ctx, name); err != nil {
+			rt.logger.Error("Failed to restart optional controller", "name", name, "error", err)
+		}
+	}
+}
+
+// intervalFactor is how much periodic gossip is currently stretched.
+func (rt *Runtime) intervalFactor() float64 {
+	if rt.shedder == nil {
+		return 1
+	}
+	rt.shedder.mu.Lock()
+	defer rt.shedder.mu.Unlock()
+	return rt.shedder.factor
+}
+
+// degradationStatus reports the load shedding state, or nil when
+// degradation is not enabled.
+func (rt *Runtime) degradationStatus() *DegradationStatus {
+	s := rt.shedder
+	if s == nil {
+		return nil
+	}
+	level := s.manager.GetCurrentLevel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return &DegradationStatus{
+		Level:              level,
+		Since:              s.since,
+		IntervalFactor:     s.factor,
+		DisabledFeatures:   append([]string(nil), s.disabled...),
+		PausedModules:      append([]string(nil), s.paused...),
+		StoppedControllers: append([]string(nil), s.stopped...),
+		Usage:              s.usage,
+	}
+}
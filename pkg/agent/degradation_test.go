@@ -0,0 +1,237 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/naviNBRuas/APA/pkg/robustness"
+	"github.com/naviNBRuas/APA/pkg/store"
+)
+
+type fakeSheddable struct {
+	mu      sync.Mutex
+	modules []string
+	running map[string]bool
+}
+
+func newFakeSheddable(names ...string) *fakeSheddable {
+	f := &fakeSheddable{modules: names, running: make(map[string]bool)}
+	for _, n := range names {
+		f.running[n] = true
+	}
+	return f
+}
+
+func (f *fakeSheddable) RunningModules() []*module.Manifest {
+	var out []*module.Manifest
+	for _, n := range f.modules {
+		if f.isRunning(n) {
+			out = append(out, &module.Manifest{Name: n})
+		}
+	}
+	return out
+}
+
+func (f *fakeSheddable) set(name string, running bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.running[name] = running
+	return nil
+}
+
+func (f *fakeSheddable) isRunning(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.running[name]
+}
+
+func (f *fakeSheddable) StopModule(name string) error { return f.set(name, false) }
+func (f *fakeSheddable) RestartModule(ctx context.Context, name string) error {
+	return f.set(name, true)
+}
+func (f *fakeSheddable) StopController(ctx context.Context, name string) error {
+	return f.set(name, false)
+}
+func (f *fakeSheddable) StartController(ctx context.Context, name string) error {
+	return f.set(name, true)
+}
+
+func TestLoadSheddingFollowsPressure(t *testing.T) {
+	rt := newEventsTestRuntime(20)
+	state, err := store.New(filepath.Join(t.TempDir(), "agent-state.json"), slog.Default())
+	require.NoError(t, err)
+	rt.state = state
+
+	usage := &robustness.ResourceUsage{CPU: 20}
+	cfg := DegradationConfig{CriticalModules: []string{"core"}, OptionalControllers: []string{"net-ctl"}}
+	cfg.RecoveryDelay = time.Nanosecond
+	cfg.DegradationConfig = cfg.DegradationConfig.WithDefaults()
+	rt.newLoadShedder(cfg, func() *robustness.HealthMetrics {
+		u := *usage
+		return &robustness.HealthMetrics{ResourceUsage: &u}
+	})
+	modules := newFakeSheddable("core", "scanner")
+	controllers := newFakeSheddable("net-ctl")
+	rt.shedder.modules = modules
+	rt.shedder.controllers = controllers
+
+	rt.assessDegradation()
+	require.Equal(t, robustness.DegradationNone, rt.degradationStatus().Level)
+
+	// Severe pressure pauses non-critical modules and optional controllers.
+	usage.CPU = 93
+	rt.assessDegradation()
+	status := rt.degradationStatus()
+	require.Equal(t, robustness.DegradationSevere, status.Level)
+	require.Equal(t, 8.0, status.IntervalFactor)
+	require.Equal(t, 8.0, rt.intervalFactor())
+	require.Equal(t, []string{"scanner"}, status.PausedModules)
+	require.Equal(t, []string{"net-ctl"}, status.StoppedControllers)
+	require.True(t, modules.isRunning("core"))
+	require.False(t, modules.isRunning("scanner"))
+	require.False(t, controllers.isRunning("net-ctl"))
+	require.Equal(t, 8*store.DefaultFlushInterval, state.FlushInterval())
+
+	var saved persistedDegradation
+	require.NoError(t, state.Get(degradationStateKey, &saved))
+	require.Equal(t, robustness.DegradationSevere, saved.Level)
+
+	// Within the hysteresis band nothing changes.
+	usage.CPU = 85
+	rt.assessDegradation()
+	require.Equal(t, robustness.DegradationSevere, rt.degradationStatus().Level)
+
+	// Once pressure clears, everything shed is restored.
+	usage.CPU = 20
+	rt.assessDegradation()
+	time.Sleep(time.Millisecond)
+	rt.assessDegradation()
+	status = rt.degradationStatus()
+	require.Equal(t, robustness.DegradationNone, status.Level)
+	require.Empty(t, status.PausedModules)
+	require.Empty(t, status.StoppedControllers)
+	require.Equal(t, 1.0, rt.intervalFactor())
+	require.Eventually(t, func() bool { return modules.isRunning("scanner") }, time.Second, time.Millisecond)
+	require.True(t, controllers.isRunning("net-ctl"))
+	require.Equal(t, store.DefaultFlushInterval, state.FlushInterval())
+
+	events := rt.events.Recent(EventFilter{Types: []string{string(EventDegradationChanged)}}, 0)
+	require.Len(t, events, 2)
+	require.Equal(t, SeverityWarning, events[0].Severity)
+	require.Equal(t, SeverityInfo, events[1].Severity)
+}
+
+func TestStatusReportsDegradation(t *testing.T) {
+	rt := newEventsTestRuntime(10)
+	rt.newLoadShedder(DegradationConfig{DegradationConfig: robustness.DegradationConfig{}.WithDefaults()}, nil)
+	rt.shedder.manager.ApplyDegradation(robustness.DegradationMinimal)
+
+	status := rt.degradationStatus()
+	require.NotNil(t, status)
+	require.Equal(t, robustness.DegradationMinimal, status.Level)
+	require.Equal(t, 2.0, status.IntervalFactor)
+
+	data, err := json.Marshal(StatusResponse{Degradation: status})
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"level":"minimal"`)
+
+	rt = newEventsTestRuntime(10)
+	require.Nil(t, rt.degradationStatus())
+	require.Equal(t, 1.0, rt.intervalFactor())
+}
+
+// loopingWasm is a module whose run export loops until the module is
+// closed: (module (func (export "run") (loop (br 0)))).
+var loopingWasm = []byte{
+	0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00,
+	0x01, 0x04, 0x01, 0x60, 0x00, 0x00, // type: () -> ()
+	0x03, 0x02, 0x01, 0x00, // function 0 has type 0
+	0x07, 0x07, 0x01, 0x03, 'r', 'u', 'n', 0x00, 0x00, // export "run"
+	0x0a, 0x09, 0x01, 0x07, 0x00, 0x03, 0x40, 0x0c, 0x00, 0x0b, 0x0b, // loop br 0 end end
+}
+
+type allowModules struct{}
+
+func (allowModules) Authorize(ctx context.Context, subject, action, resource string) (bool, string, error) {
+	return true, "", nil
+}
+
+func writeLoopingModule(t *testing.T, dir, name string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, name), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name, name+".wasm"), loopingWasm, 0o644))
+	sum := sha256.Sum256(loopingWasm)
+	data, err := json.Marshal(module.Manifest{Name: name, Version: "1.0.0", WasmFile: name + ".wasm", Entry: "run", Hash: hex.EncodeToString(sum[:])})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name, "manifest.json"), data, 0o644))
+}
+
+func runningModuleNames(m *module.Manager) []string {
+	var names []string
+	for _, mf := range m.RunningModules() {
+		names = append(names, mf.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestLoadSheddingPausesRealModules(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"core", "idle", "scanner"} {
+		writeLoopingModule(t, dir, name)
+	}
+	modules, err := module.NewManager(context.Background(), slog.Default(), dir, nil, allowModules{})
+	require.NoError(t, err)
+	defer modules.Shutdown()
+	require.NoError(t, modules.LoadModulesFromDir())
+	require.Len(t, modules.ListModules(), 3)
+
+	// idle is loaded but never run.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, name := range []string{"core", "scanner"} {
+		go func(name string) { _ = modules.RunModule(ctx, name) }(name)
+	}
+	require.Eventually(t, func() bool { return len(modules.RunningModules()) == 2 }, 5*time.Second, time.Millisecond)
+
+	rt := newEventsTestRuntime(20)
+	usage := &robustness.ResourceUsage{CPU: 20}
+	cfg := DegradationConfig{CriticalModules: []string{"core"}}
+	cfg.RecoveryDelay = time.Nanosecond
+	cfg.DegradationConfig = cfg.DegradationConfig.WithDefaults()
+	rt.newLoadShedder(cfg, func() *robustness.HealthMetrics {
+		u := *usage
+		return &robustness.HealthMetrics{ResourceUsage: &u}
+	})
+	rt.shedder.modules = modules
+	rt.shedder.runCtx = ctx
+
+	// Only the running non-critical module is paused, and it stops running.
+	usage.CPU = 93
+	rt.assessDegradation()
+	require.Equal(t, []string{"scanner"}, rt.degradationStatus().PausedModules)
+	require.Eventually(t, func() bool { return len(modules.RunningModules()) == 1 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, []string{"core"}, runningModuleNames(modules))
+
+	// Resuming runs scanner again in a new instance, and does not start idle.
+	usage.CPU = 20
+	rt.assessDegradation()
+	time.Sleep(time.Millisecond)
+	rt.assessDegradation()
+	require.Empty(t, rt.degradationStatus().PausedModules)
+	require.Eventually(t, func() bool { return len(modules.RunningModules()) == 2 }, 5*time.Second, time.Millisecond)
+	require.Equal(t, []string{"core", "scanner"}, runningModuleNames(modules))
+	require.Empty(t, rt.events.Recent(EventFilter{Types: []string{string(EventModuleFailed)}}, 0), "resume failed")
+}
@@ -0,0 +1,268 @@
+package agent
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType identifies the kind of lifecycle event. Types are dotted
+// "<subsystem>.<what>" names so clients can subscribe to a whole subsystem
+// with a "<subsystem>.*" pattern.
+type EventType string
+
+const (
+	EventModuleLoaded       EventType = "module.loaded"
+	EventModuleFailed       EventType = "module.failed"
+	EventControllerStarted  EventType = "controller.started"
+	EventControllerFailed   EventType = "controller.start_failed"
+	EventControllerCrashed  EventType = "controller.crashed"
+	EventPeerJoined         EventType = "peer.joined"
+	EventPeerLeft           EventType = "peer.left"
+	EventNodeQuarantined    EventType = "node.quarantined"
+	EventLeaderChanged      EventType = "leader.changed"
+	EventUpdateChecked      EventType = "update.checked"
+	EventUpdateReady        EventType = "update.ready"
+	EventUpdateRollout      EventType = "update.rollout"
+	EventPatchReceived      EventType = "patch.received"
+	EventBackupCompleted    EventType = "backup.completed"
+	EventHealthCheckFailed  EventType = "health.check_failed"
+	EventHealingAttempted   EventType = "healing.attempted"
+	EventApprovalRequested  EventType = "approval.requested"
+	EventApprovalDecided    EventType = "approval.decided"
+	EventDegradationChanged EventType = "degradation.changed"
+	EventTamperDetected     EventType = "security.tamper_detected"
+)
+
+// EventSeverity orders events by importance.
+type EventSeverity string
+
+const (
+	SeverityInfo    EventSeverity = "info"
+	SeverityWarning EventSeverity = "warning"
+	SeverityError   EventSeverity = "error"
+)
+
+func (s EventSeverity) rank() int {
+	switch s {
+	case SeverityWarning:
+		return 1
+	case SeverityError:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Event is a typed agent lifecycle event.
+type Event struct {
+	ID       uint64                 `json:"id"`
+	Time     time.Time              `json:"time"`
+	Type     EventType              `json:"type"`
+	Severity EventSeverity          `json:"severity"`
+	Source   string                 `json:"source"`            // publishing subsystem, e.g. "module", "p2p"
+	Subject  string                 `json:"subject,omitempty"` // module/controller/peer the event is about
+	Message  string                 `json:"message"`
+	Data     map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventFilter selects events. Empty fields match everything.
+type EventFilter struct {
+	Types       []string      // exact types or "<prefix>.*" patterns
+	Sources     []string      // publishing subsystems
+	Subject     string        // exact subject
+	MinSeverity EventSeverity // lowest severity to include
+	SinceID     uint64        // only events with a greater ID
+}
+
+// Match reports whether ev passes the filter.
+func (f EventFilter) Match(ev Event) bool {
+	if ev.ID <= f.SinceID {
+		return false
+	}
+	if f.Subject != "" && ev.Subject != f.Subject {
+		return false
+	}
+	if ev.Severity.rank() < f.MinSeverity.rank() {
+		return false
+	}
+	if len(f.Sources) > 0 && !containsString(f.Sources, ev.Source) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if prefix, ok := strings.CutSuffix(t, "*"); ok {
+			if strings.HasPrefix(string(ev.Type), prefix) {
+				return true
+			}
+		} else if string(ev.Type) == t {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultEventBufferSize is the number of events retained when no size is configured.
+const DefaultEventBufferSize = 1024
+
+// EventBus fans lifecycle events out to subscribers and retains the most
+// recent ones in a bounded ring so late subscribers can catch up. A nil
+// *EventBus discards everything, so publishers need no guards.
+type EventBus struct {
+	mu     sync.Mutex
+	ring   []Event
+	head   int // index of the next write
+	count  int
+	lastID uint64
+	subs   map[*eventSubscription]struct{}
+}
+
+type eventSubscription struct {
+	filter EventFilter
+	ch     chan Event
+}
+
+// NewEventBus creates a bus retaining up to capacity events.
+func NewEventBus(capacity int) *EventBus {
+	if capacity <= 0 {
+		capacity = DefaultEventBufferSize
+	}
+	return &EventBus{
+		ring: make([]Event, capacity),
+		subs: make(map[*eventSubscription]struct{}),
+	}
+}
+
+// Publish assigns ev an ID and timestamp, stores it and delivers it to
+// matching subscribers. Slow subscribers miss events rather than blocking
+// the publisher; they can spot the gap from the event IDs.
+func (b *EventBus) Publish(ev Event) Event {
+	if b == nil {
+		return ev
+	}
+	if ev.Severity == "" {
+		ev.Severity = SeverityInfo
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.lastID++
+	ev.ID = b.lastID
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	b.ring[b.head] = ev
+	b.head = (b.head + 1) % len(b.ring)
+	if b.count < len(b.ring) {
+		b.count++
+	}
+
+	for sub := range b.subs {
+		if !sub.filter.Match(ev) {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+		}
+	}
+	return ev
+}
+
+// Recent returns up to limit of the newest retained events matching filter,
+// oldest first. A limit <= 0 returns every match.
+func (b *EventBus) Recent(filter EventFilter, limit int) []Event {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.recentLocked(filter, limit)
+}
+
+func (b *EventBus) recentLocked(filter EventFilter, limit int) []Event {
+	out := make([]Event, 0)
+	start := (b.head - b.count + len(b.ring)) % len(b.ring)
+	for i := 0; i < b.count; i++ {
+		ev := b.ring[(start+i)%len(b.ring)]
+		if filter.Match(ev) {
+			out = append(out, ev)
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// Subscribe returns the retained events matching filter together with a
+// channel of future matches; no event is delivered twice or missed between
+// the two. The cancel function must be called to release the subscription.
+func (b *EventBus) Subscribe(filter EventFilter, buffer int) ([]Event, <-chan Event, func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	sub := &eventSubscription{filter: filter, ch: make(chan Event, buffer)}
+	if b == nil {
+		return nil, sub.ch, func() {}
+	}
+
+	b.mu.Lock()
+	backlog := b.recentLocked(filter, 0)
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, sub)
+			b.mu.Unlock()
+		})
+	}
+	return backlog, sub.ch, cancel
+}
+
+// SubscriberCount returns the number of active subscriptions.
+func (b *EventBus) SubscriberCount() int {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// emit publishes an event on the runtime bus.
+func (rt *Runtime) emit(typ EventType, severity EventSeverity, source, subject, message string, data map[string]interface{}) {
+	rt.events.Publish(Event{
+		Type:     typ,
+		Severity: severity,
+		Source:   source,
+		Subject:  subject,
+		Message:  message,
+		Data:     data,
+	})
+}
+
+// emitHealing publishes the outcome of a self-healing attempt.
+func (rt *Runtime) emitHealing(action, subject, trigger string, err error) {
+	data := map[string]interface{}{"action": action, "trigger": trigger, "success": err == nil}
+	severity, message := SeverityInfo, "Self-healing attempt succeeded"
+	if err != nil {
+		data["error"] = err.Error()
+		severity, message = SeverityError, "Self-healing attempt failed"
+	}
+	rt.emit(EventHealingAttempted, severity, "healing", subject, message, data)
+}
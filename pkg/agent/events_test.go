@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func newEventsTestRuntime(capacity int) *Runtime {
+	return &Runtime{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		rateLimiters: make(map[string]*rate.Limiter),
+		events:       NewEventBus(capacity),
+	}
+}
+
+func TestEventBusRingIsBounded(t *testing.T) {
+	bus := NewEventBus(3)
+	for i := 0; i < 5; i++ {
+		bus.Publish(Event{Type: EventModuleLoaded})
+	}
+
+	events := bus.Recent(EventFilter{}, 0)
+	require.Len(t, events, 3)
+	require.Equal(t, []uint64{3, 4, 5}, []uint64{events[0].ID, events[1].ID, events[2].ID})
+	require.Len(t, bus.Recent(EventFilter{}, 2), 2)
+	require.Equal(t, uint64(5), bus.Recent(EventFilter{}, 1)[0].ID)
+}
+
+func TestEventBusNilIsNoop(t *testing.T) {
+	var bus *EventBus
+	bus.Publish(Event{Type: EventPeerJoined})
+	require.Nil(t, bus.Recent(EventFilter{}, 0))
+	backlog, _, cancel := bus.Subscribe(EventFilter{}, 1)
+	cancel()
+	require.Empty(t, backlog)
+}
+
+func TestEventFilterMatch(t *testing.T) {
+	ev := Event{ID: 7, Type: EventControllerCrashed, Severity: SeverityError, Source: "controller", Subject: "ctrl-a"}
+
+	require.True(t, EventFilter{}.Match(ev))
+	require.True(t, EventFilter{Types: []string{"controller.*"}}.Match(ev))
+	require.True(t, EventFilter{Types: []string{"peer.joined", "controller.crashed"}}.Match(ev))
+	require.False(t, EventFilter{Types: []string{"controller.started"}}.Match(ev))
+	require.True(t, EventFilter{MinSeverity: SeverityWarning}.Match(ev))
+	require.False(t, EventFilter{MinSeverity: SeverityError}.Match(Event{ID: 1, Severity: SeverityWarning}))
+	require.False(t, EventFilter{Sources: []string{"p2p"}}.Match(ev))
+	require.False(t, EventFilter{Subject: "ctrl-b"}.Match(ev))
+	require.False(t, EventFilter{SinceID: 7}.Match(ev))
+}
+
+func TestEventBusSubscribeReplaysThenStreams(t *testing.T) {
+	bus := NewEventBus(10)
+	bus.Publish(Event{Type: EventPeerJoined, Subject: "a"})
+	bus.Publish(Event{Type: EventModuleLoaded, Subject: "m"})
+
+	backlog, ch, cancel := bus.Subscribe(EventFilter{Types: []string{"peer.*"}}, 4)
+	defer cancel()
+	require.Len(t, backlog, 1)
+	require.Equal(t, "a", backlog[0].Subject)
+
+	bus.Publish(Event{Type: EventModuleLoaded})
+	bus.Publish(Event{Type: EventPeerLeft, Subject: "a"})
+	select {
+	case ev := <-ch:
+		require.Equal(t, EventPeerLeft, ev.Type)
+		require.Equal(t, uint64(4), ev.ID)
+	case <-time.After(time.Second):
+		t.Fatal("expected live event")
+	}
+
+	require.Equal(t, 1, bus.SubscriberCount())
+	cancel()
+	require.Equal(t, 0, bus.SubscriberCount())
+}
+
+func TestEventsHandlerJSON(t *testing.T) {
+	rt := newEventsTestRuntime(10)
+	rt.emit(EventModuleLoaded, SeverityInfo, "module", "m1", "Module loaded", nil)
+	rt.emit(EventModuleFailed, SeverityError, "module", "m1", "Module run failed", nil)
+	rt.emit(EventPeerJoined, SeverityInfo, "p2p", "peer", "Peer connected", nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(rt.eventsHandler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?type=module.*&severity=error")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var events []Event
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&events))
+	require.Len(t, events, 1)
+	require.Equal(t, EventModuleFailed, events[0].Type)
+
+	resp2, err := http.Get(ts.URL + "?severity=critical")
+	require.NoError(t, err)
+	resp2.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp2.StatusCode)
+}
+
+func TestEventsHandlerSSE(t *testing.T) {
+	rt := newEventsTestRuntime(10)
+	rt.emit(EventPeerJoined, SeverityInfo, "p2p", "old", "Peer connected", nil)
+	rt.emit(EventPeerJoined, SeverityInfo, "p2p", "resumed", "Peer connected", nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(rt.eventsHandler))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"?type=peer.*", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Last-Event-ID", "1")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	readEvent := func() Event {
+		t.Helper()
+		var ev Event
+		for {
+			line, err := reader.ReadString('\n')
+			require.NoError(t, err)
+			if data, ok := strings.CutPrefix(line, "data: "); ok {
+				require.NoError(t, json.Unmarshal([]byte(data), &ev))
+				return ev
+			}
+		}
+	}
+
+	require.Equal(t, "resumed", readEvent().Subject)
+
+	require.Eventually(t, func() bool { return rt.events.SubscriberCount() == 1 }, time.Second, 10*time.Millisecond)
+	rt.emit(EventModuleLoaded, SeverityInfo, "module", "ignored", "Module loaded", nil)
+	rt.emit(EventPeerLeft, SeverityInfo, "p2p", "live", "Peer disconnected", nil)
+	ev := readEvent()
+	require.Equal(t, EventPeerLeft, ev.Type)
+	require.Equal(t, "live", ev.Subject)
+}
+
+func TestEventsHandlerWebSocket(t *testing.T) {
+	rt := newEventsTestRuntime(10)
+	rt.emit(EventNodeQuarantined, SeverityWarning, "recovery", "node-1", "Node quarantined", nil)
+
+	ts := httptest.NewServer(http.HandlerFunc(rt.eventsHandler))
+	defer ts.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "?severity=warning"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var ev Event
+	require.NoError(t, conn.ReadJSON(&ev))
+	require.Equal(t, EventNodeQuarantined, ev.Type)
+
+	require.Eventually(t, func() bool { return rt.events.SubscriberCount() == 1 }, time.Second, 10*time.Millisecond)
+	rt.emit(EventPeerJoined, SeverityInfo, "p2p", "filtered", "Peer connected", nil)
+	rt.emitHealing("regenerate", "/usr/local/bin/agentd", "tamper_detected", io.ErrUnexpectedEOF)
+	require.NoError(t, conn.ReadJSON(&ev))
+	require.Equal(t, EventHealingAttempted, ev.Type)
+	require.Equal(t, SeverityError, ev.Severity)
+	require.Equal(t, false, ev.Data["success"])
+
+	require.NoError(t, conn.Close())
+	require.Eventually(t, func() bool { return rt.events.SubscriberCount() == 0 }, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/naviNBRuas/APA/pkg/faults"
+)
+
+// FaultsResponse is the fault injection state served at /admin/faults.
+type FaultsResponse struct {
+	Seed  int64               `json:"seed"`
+	Rules []faults.RuleStatus `json:"rules"`
+}
+
+// initFaults arms the configured injection points. In builds without the
+// "faults" tag the configuration is ignored with a warning, so a config
+// meant for chaos runs cannot break a production agent.
+func (rt *Runtime) initFaults(cfg faults.Config) error {
+	if !faults.Enabled {
+		if cfg.Enabled {
+			rt.logger.Warn("Fault injection configured but not compiled in; build with -tags faults to use it")
+		}
+		return nil
+	}
+	if err := faults.Configure(cfg); err != nil {
+		return err
+	}
+	if cfg.Enabled {
+		rt.logger.Warn("Fault injection enabled", "seed", cfg.Seed, "rules", len(cfg.Rules))
+	}
+	return nil
+}
+
+// faultsHandler lists armed injection rules at GET /admin/faults, adds or
+// replaces one with POST, and clears them with DELETE, optionally limited by
+// the point and target query parameters.
+func (rt *Runtime) faultsHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("faults", input)
+
+	if !faults.Enabled {
+		writeJSONError(w, faults.ErrNotCompiled.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var rule faults.Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := faults.Set(rule); err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rt.logger.Warn("Fault injection rule set", "point", rule.Point, "target", rule.Target)
+	case http.MethodDelete:
+		if point := r.URL.Query().Get("point"); point != "" {
+			faults.Clear(faults.Point(point), r.URL.Query().Get("target"))
+		} else {
+			faults.Reset()
+		}
+	default:
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(FaultsResponse{Seed: faults.Seed(), Rules: faults.Rules()}); err != nil {
+		rt.logger.Error("Failed to encode faults response", "error", err)
+	}
+}
@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/faults"
+)
+
+func TestFaultsHandler(t *testing.T) {
+	rt := newEventsTestRuntime(10)
+
+	if !faults.Enabled {
+		require.NoError(t, rt.initFaults(faults.Config{Enabled: true, Rules: []faults.Rule{{Point: faults.StoreWrite}}}),
+			"a faults config is ignored by builds without the tag")
+		rec := httptest.NewRecorder()
+		rt.faultsHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/faults", nil))
+		require.Equal(t, http.StatusNotImplemented, rec.Code)
+		return
+	}
+	t.Cleanup(faults.Reset)
+	require.NoError(t, rt.initFaults(faults.Config{Enabled: true, Seed: 9, Rules: []faults.Rule{{Point: faults.StoreWrite}}}))
+
+	rec := httptest.NewRecorder()
+	rt.faultsHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/faults",
+		strings.NewReader(`{"point":"module.trap","target":"scanner","count":1}`)))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var resp FaultsResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.EqualValues(t, 9, resp.Seed)
+	require.Len(t, resp.Rules, 2)
+
+	rec = httptest.NewRecorder()
+	rt.faultsHandler(rec, httptest.NewRequest(http.MethodPost, "/admin/faults", strings.NewReader(`{"point":"disk.melt"}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = httptest.NewRecorder()
+	rt.faultsHandler(rec, httptest.NewRequest(http.MethodDelete, "/admin/faults?point=store.write", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+	require.Len(t, resp.Rules, 1)
+	require.Equal(t, faults.ModuleTrap, resp.Rules[0].Point)
+
+	rec = httptest.NewRecorder()
+	rt.faultsHandler(rec, httptest.NewRequest(http.MethodDelete, "/admin/faults", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, faults.Rules())
+}
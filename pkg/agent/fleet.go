@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/naviNBRuas/APA/pkg/faults"
+	"github.com/naviNBRuas/APA/pkg/fleet"
+)
+
+// localFleetStatus summarises this agent for the fleet status topic.
+func (rt *Runtime) localFleetStatus() fleet.Status {
+	status := fleet.Status{
+		PeerID:        rt.identity.PeerID.String(),
+		Role:          fleet.RoleFollower,
+		Tier:          rt.config.Fleet.WithDefaults().Tier,
+		Health:        fleet.HealthHealthy,
+		Modules:       []fleet.ModuleInfo{},
+		Controllers:   []string{},
+		UptimeSeconds: int64(time.Since(rt.startTime).Seconds()),
+		Timestamp:     faults.Now().UTC(),
+	}
+
+	if rt.updateManager != nil {
+		status.Version = rt.updateManager.CurrentVersion()
+	}
+
+	rt.runMu.RLock()
+	if rt.currentLeader == rt.identity.PeerID {
+		status.Role = fleet.RoleLeader
+	}
+	rt.runMu.RUnlock()
+
+	if rt.healthController != nil {
+		if failing := rt.healthController.FailingChecks(); len(failing) > 0 {
+			status.Health = fleet.HealthDegraded
+			status.FailingChecks = failing
+		}
+	}
+
+	if rt.moduleManager != nil {
+		for _, m := range rt.moduleManager.ListModules() {
+			status.Modules = append(status.Modules, fleet.ModuleInfo{Name: m.Name, Version: m.Version})
+		}
+		sort.Slice(status.Modules, func(i, j int) bool { return status.Modules[i].Name < status.Modules[j].Name })
+	}
+
+	if rt.controllerManager != nil {
+		for _, m := range rt.controllerManager.ListControllers() {
+			status.Controllers = append(status.Controllers, m.Name)
+		}
+	}
+	for _, c := range rt.controllers {
+		status.Controllers = append(status.Controllers, c.Name())
+	}
+	sort.Strings(status.Controllers)
+
+	if rt.p2p != nil {
+		status.PeerCount = rt.p2p.PeerCount()
+	}
+	return status
+}
+
+// publishFleetStatus signs the local status, records it in the local
+// aggregate and gossips it to the fleet.
+func (rt *Runtime) publishFleetStatus(ctx context.Context) {
+	signed, err := fleet.Sign(rt.localFleetStatus(), rt.identity.PrivKey)
+	if err != nil {
+		rt.logger.Error("Failed to sign fleet status", "error", err)
+		return
+	}
+	if err := rt.fleet.Observe(signed, ""); err != nil {
+		rt.logger.Error("Failed to record local fleet status", "error", err)
+	}
+
+	data, err := json.Marshal(signed)
+	if err != nil {
+		rt.logger.Error("Failed to marshal fleet status", "error", err)
+		return
+	}
+	if err := rt.p2p.PublishFleetStatus(ctx, data); err != nil {
+		rt.logger.Warn("Failed to publish fleet status", "error", err)
+	}
+}
+
+// runFleetStatus publishes the local status every PublishInterval and merges
+// the statuses received from other agents.
+func (rt *Runtime) runFleetStatus(ctx context.Context) {
+	if err := rt.p2p.JoinFleetStatusTopic(ctx); err != nil {
+		rt.logger.Error("Failed to join fleet status topic", "error", err)
+		return
+	}
+
+	msgCh, err := rt.p2p.SubscribeFleetStatus(ctx)
+	if err != nil {
+		rt.logger.Error("Failed to subscribe to fleet status", "error", err)
+		return
+	}
+
+	// The interval is stretched while load is being shed.
+	interval := rt.config.Fleet.WithDefaults().PublishInterval
+	timer := time.NewTimer(time.Duration(float64(interval) * rt.intervalFactor()))
+	defer timer.Stop()
+
+	rt.publishFleetStatus(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			rt.publishFleetStatus(ctx)
+			timer.Reset(time.Duration(float64(interval) * rt.intervalFactor()))
+		case msg, ok := <-msgCh:
+			if !ok {
+				return
+			}
+			var signed fleet.SignedStatus
+			if err := json.Unmarshal(msg.Data, &signed); err != nil {
+				rt.logger.Warn("Failed to decode fleet status", "sender", msg.SenderPeerID, "error", err)
+				continue
+			}
+			if err := rt.fleet.Observe(&signed, msg.SenderPeerID); err != nil {
+				rt.logger.Warn("Rejected fleet status", "sender", msg.SenderPeerID, "error", err)
+			}
+		}
+	}
+}
+
+func (rt *Runtime) fleetHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("fleet", input)
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rt.fleet == nil {
+		writeJSONError(w, "Fleet aggregation not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rt.fleet.View()); err != nil {
+		rt.logger.Error("Failed to encode fleet view", "error", err)
+	}
+}
@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/naviNBRuas/APA/pkg/fleet"
+)
+
+func TestFleetHandlerReportsLocalStatus(t *testing.T) {
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+
+	rt := &Runtime{
+		logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+		rateLimiters: make(map[string]*rate.Limiter),
+		identity:     &Identity{PeerID: id, PrivKey: priv},
+		config:       &Config{Fleet: fleet.Config{Tier: "relay"}},
+		startTime:    time.Now().Add(-time.Minute),
+		fleet:        fleet.NewAggregator(id.String(), fleet.Config{}),
+	}
+	rt.setLeader(id)
+
+	status := rt.localFleetStatus()
+	require.Equal(t, fleet.RoleLeader, status.Role)
+	require.Equal(t, fleet.HealthHealthy, status.Health)
+	require.Equal(t, "relay", status.Tier)
+
+	signed, err := fleet.Sign(rt.localFleetStatus(), priv)
+	require.NoError(t, err)
+	require.NoError(t, rt.fleet.Observe(signed, ""))
+
+	ts := httptest.NewServer(http.HandlerFunc(rt.fleetHandler))
+	defer ts.Close()
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var view fleet.View
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&view))
+	require.Equal(t, id.String(), view.Aggregator)
+	require.Len(t, view.Nodes, 1)
+	require.True(t, view.Nodes[0].Self)
+	require.Equal(t, "relay", view.Nodes[0].Tier)
+	require.Equal(t, 1, view.Summary.Roles[fleet.RoleLeader])
+}
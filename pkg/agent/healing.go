@@ -0,0 +1,265 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/naviNBRuas/APA/pkg/selfhealing"
+)
+
+// initHealing creates the self-healing framework fed by the health
+// controller, registers the strategies the agent's components support,
+// loads the playbooks, and wires escalation alerts and the fleet-wide
+// healing slots kept in the control plane. Modules fetched again from
+// peers must be signed by one of moduleKeys.
+func (rt *Runtime) initHealing(cfg selfhealing.Config, moduleKeys []ed25519.PublicKey) error {
+	hf := selfhealing.NewHealingFramework(rt.logger, rt.healthController, healingEvents{rt: rt})
+	strategies := []selfhealing.HealingStrategy{selfhealing.NewMemoryOptimizationStrategy()}
+	if rt.controllerManager != nil {
+		strategies = append(strategies, selfhealing.NewRestartProcessStrategy(healingControllers{rt: rt}))
+	}
+	if rt.moduleManager != nil {
+		strategies = append(strategies, selfhealing.NewRebuildModuleStrategy(healingModules{rt: rt, keys: moduleKeys}))
+	}
+	if rt.p2p != nil {
+		strategies = append(strategies, selfhealing.NewNetworkReconnectStrategy(healingPeers{rt: rt}))
+	}
+	for _, s := range strategies {
+		if err := hf.RegisterStrategy(s); err != nil {
+			return err
+		}
+	}
+	if cfg.PlaybooksPath != "" {
+		playbooks, err := selfhealing.LoadPlaybooks(cfg.PlaybooksPath)
+		if err != nil {
+			return fmt.Errorf("failed to load healing playbooks: %w", err)
+		}
+		if err := hf.SetPlaybooks(playbooks); err != nil {
+			return fmt.Errorf("invalid healing playbooks: %w", err)
+		}
+	}
+	if rt.alerts != nil {
+		hf.SetAlertSink(rt.alerts)
+	}
+	if rt.approvals != nil {
+		hf.SetApprovalGate(rt.approvals)
+	}
+	if rt.controlPlane != nil {
+		leasePeers := make(map[string]bool, len(cfg.LeasePeers))
+		for _, id := range cfg.LeasePeers {
+			leasePeers[id] = true
+		}
+		admitted := func(id string) bool {
+			if leasePeers[id] {
+				return true
+			}
+			pid, err := peer.Decode(id)
+			return err == nil && rt.p2p.IsPeerAdmitted(pid)
+		}
+		if err := hf.SetLeaseStore(rt.controlPlane, rt.identity.PrivKey, admitted); err != nil {
+			return fmt.Errorf("failed to set healing lease store: %w", err)
+		}
+	}
+	rt.healing = hf
+	return nil
+}
+
+// healingEvents publishes healing outcomes on the event bus.
+type healingEvents struct {
+	rt *Runtime
+}
+
+func (h healingEvents) OnHealingAttempt(issue *selfhealing.HealthIssue, strategy selfhealing.HealingStrategy, result *selfhealing.HealingResult) {
+	h.rt.emitHealing(strategy.Name(), issue.Component, "health_check", fmt.Errorf("%s", result.Message))
+}
+
+func (h healingEvents) OnHealingFailure(issue *selfhealing.HealthIssue, strategy selfhealing.HealingStrategy, err error) {
+	h.rt.emitHealing(strategy.Name(), issue.Component, "health_check", err)
+}
+
+func (h healingEvents) OnHealingSuccess(issue *selfhealing.HealthIssue, strategy selfhealing.HealingStrategy, result *selfhealing.HealingResult) {
+	h.rt.emitHealing(strategy.Name(), issue.Component, "health_check", nil)
+}
+
+// auditHealing records an action a healing strategy took on subject.
+func (rt *Runtime) auditHealing(action, subject string, err error) {
+	if rt.auditLogger == nil {
+		return
+	}
+	entry := AuditEntry{
+		Actor:   "self-healing",
+		Action:  action,
+		Details: map[string]interface{}{"subject": subject, "success": err == nil},
+	}
+	if err != nil {
+		entry.Details["error"] = err.Error()
+	}
+	if appendErr := rt.auditLogger.Append(entry); appendErr != nil {
+		rt.logger.Error("Failed to append audit entry", "action", action, "error", appendErr)
+		return
+	}
+	rt.metrics.AuditEntry()
+}
+
+// healingControllers restarts controllers through the controller manager.
+type healingControllers struct {
+	rt *Runtime
+}
+
+func (h healingControllers) ExitedControllers() []string {
+	return h.rt.controllerManager.ExitedControllers()
+}
+
+func (h healingControllers) RestartController(ctx context.Context, name string) error {
+	err := h.rt.controllerManager.RestartController(ctx, name)
+	h.rt.auditHealing("healing.restart_controller", name, err)
+	return err
+}
+
+// healingModules reloads modules through the module manager and fetches
+// them again from peers.
+type healingModules struct {
+	rt   *Runtime
+	keys []ed25519.PublicKey
+}
+
+// moduleFetchTimeout bounds fetching a module from one peer.
+const moduleFetchTimeout = 20 * time.Second
+
+func (h healingModules) UnloadedModules() []string {
+	return h.rt.moduleManager.UnloadedModules()
+}
+
+func (h healingModules) ReloadModule(ctx context.Context, name string) error {
+	err := h.rt.moduleManager.LoadModule(name)
+	h.rt.auditHealing("healing.reload_module", name, err)
+	return err
+}
+
+// RefetchModule fetches the installed version of a module from the
+// connected peers, most reputable first, and installs the first copy whose
+// hash and signature verify.
+func (h healingModules) RefetchModule(ctx context.Context, name string) (err error) {
+	defer func() { h.rt.auditHealing("healing.refetch_module", name, err) }()
+	if h.rt.p2p == nil {
+		return fmt.Errorf("P2P network not available")
+	}
+	installed, err := h.rt.moduleManager.InstalledManifest(name)
+	if err != nil {
+		return fmt.Errorf("installed version of module %s unknown: %w", name, err)
+	}
+
+	peers := h.rt.p2p.GetConnectedPeers()
+	sort.Slice(peers, func(i, j int) bool {
+		return h.rt.p2p.GetReputationScore(peers[i]) > h.rt.p2p.GetReputationScore(peers[j])
+	})
+	lastErr := fmt.Errorf("no connected peers")
+	for _, p := range peers {
+		fetchCtx, cancel := context.WithTimeout(ctx, moduleFetchTimeout)
+		manifest, wasmBytes, fetchErr := h.rt.p2p.FetchModule(fetchCtx, p, name, installed.Version)
+		cancel()
+		if fetchErr != nil {
+			lastErr = fetchErr
+			continue
+		}
+		if verifyErr := verifyFetchedModule(manifest, wasmBytes, installed, h.keys); verifyErr != nil {
+			h.rt.logger.Warn("Rejected module fetched for healing", "module", name, "peer", p, "error", verifyErr)
+			lastErr = verifyErr
+			continue
+		}
+		if err := h.rt.moduleManager.SaveAndLoadModule(manifest, wasmBytes); err != nil {
+			return fmt.Errorf("failed to install module %s from %s: %w", name, p, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to fetch module %s %s from peers: %w", name, installed.Version, lastErr)
+}
+
+// verifyFetchedModule checks that a fetched module is the installed name and
+// version, that its bytes match the manifest hash, and that the manifest is
+// signed by a trusted key.
+func verifyFetchedModule(manifest *module.Manifest, wasmBytes []byte, installed *module.Manifest, keys []ed25519.PublicKey) error {
+	if manifest == nil {
+		return fmt.Errorf("peer returned no manifest")
+	}
+	if manifest.Name != installed.Name || manifest.Version != installed.Version {
+		return fmt.Errorf("peer returned %s %s, asked for %s %s", manifest.Name, manifest.Version, installed.Name, installed.Version)
+	}
+	sum := sha256.Sum256(wasmBytes)
+	if hex.EncodeToString(sum[:]) != manifest.Hash {
+		return fmt.Errorf("module bytes do not match the manifest hash")
+	}
+	return manifest.VerifySignature(keys)
+}
+
+// healingPeers redials peers through the P2P layer.
+type healingPeers struct {
+	rt *Runtime
+}
+
+func (h healingPeers) DisconnectedPeers(limit int) []string {
+	ids := h.rt.p2p.DisconnectedPeers(limit)
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
+
+func (h healingPeers) ReconnectPeer(ctx context.Context, id string) error {
+	pid, err := peer.Decode(id)
+	if err == nil {
+		err = h.rt.p2p.ReconnectPeer(ctx, pid)
+	}
+	h.rt.auditHealing("healing.reconnect_peer", id, err)
+	return err
+}
+
+// healingStatus is the response of /admin/healing.
+type healingStatus struct {
+	Enabled    bool                      `json:"enabled"`
+	Strategies []string                  `json:"strategies"`
+	Runs       []selfhealing.PlaybookRun `json:"runs"`
+}
+
+// healingHandler reports the registered strategies and the playbook runs
+// within their windows.
+func (rt *Runtime) healingHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("healing", input)
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status := healingStatus{Strategies: []string{}, Runs: []selfhealing.PlaybookRun{}}
+	if rt.healing != nil {
+		status.Enabled = true
+		status.Strategies = rt.healing.ListStrategies()
+		status.Runs = rt.healing.PlaybookRuns()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		rt.logger.Error("Failed to encode healing status", "error", err)
+	}
+}
@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/controller/manager"
+	"github.com/naviNBRuas/APA/pkg/health"
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/naviNBRuas/APA/pkg/selfhealing"
+)
+
+func TestHealingPlaybookRunsFromHealthChecks(t *testing.T) {
+	rt := newEventsTestRuntime(10)
+	rt.healthController = health.NewHealthController(rt.logger)
+	rt.healthController.RegisterCheck(health.NewCheckFunc("heap", "memory", func(ctx context.Context) error {
+		return errors.New("heap above limit")
+	}))
+
+	path := filepath.Join(t.TempDir(), "playbooks.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+playbooks:
+  - name: memory-pressure
+    match:
+      check: heap
+    steps:
+      - strategy: memory-optimization
+        max_attempts: 2
+`), 0o644))
+	require.NoError(t, rt.initHealing(selfhealing.Config{PlaybooksPath: path}, nil))
+
+	rt.healthController.RunChecks(context.Background())
+	require.NoError(t, rt.healing.DetectAndHeal(context.Background()))
+
+	events := rt.events.Recent(EventFilter{Types: []string{string(EventHealingAttempted)}}, 0)
+	require.Len(t, events, 1)
+	require.Equal(t, "memory-optimization", events[0].Data["action"])
+	require.Equal(t, true, events[0].Data["success"])
+
+	rec := httptest.NewRecorder()
+	rt.healingHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/healing", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var status healingStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &status))
+	require.True(t, status.Enabled)
+	require.Equal(t, []string{"memory-optimization"}, status.Strategies, "no components to act on")
+	require.Len(t, status.Runs, 1)
+	require.Equal(t, "memory-pressure", status.Runs[0].Playbook)
+	require.Len(t, status.Runs[0].Attempts, 1)
+
+	require.Error(t, rt.initHealing(selfhealing.Config{PlaybooksPath: filepath.Join(t.TempDir(), "missing.yaml")}, nil))
+}
+
+func TestHealingActionsAreAudited(t *testing.T) {
+	rt := newEventsTestRuntime(10)
+	rt.auditLogger = NewAuditLogger(rt.logger, filepath.Join(t.TempDir(), "audit.log"))
+	rt.controllerManager = manager.NewManager(rt.logger, t.TempDir(), nil)
+
+	err := healingControllers{rt: rt}.RestartController(context.Background(), "missing")
+	require.Error(t, err)
+	require.Error(t, healingPeers{rt: rt}.ReconnectPeer(context.Background(), "not-a-peer-id"))
+
+	entries, err := rt.auditLogger.ReadRecent(10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	require.Equal(t, "self-healing", entries[0].Actor)
+	require.Equal(t, "healing.restart_controller", entries[0].Action)
+	require.Equal(t, "missing", entries[0].Details["subject"])
+	require.Equal(t, false, entries[0].Details["success"])
+	require.Equal(t, "healing.reconnect_peer", entries[1].Action)
+}
+
+func TestVerifyFetchedModule(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	wasm := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	sum := sha256.Sum256(wasm)
+	signed := func() *module.Manifest {
+		return &module.Manifest{
+			Name:       "mod",
+			Version:    "v1",
+			Hash:       hex.EncodeToString(sum[:]),
+			Signatures: []string{hex.EncodeToString(ed25519.Sign(priv, sum[:]))},
+		}
+	}
+	installed := &module.Manifest{Name: "mod", Version: "v1"}
+	keys := []ed25519.PublicKey{pub}
+
+	require.NoError(t, verifyFetchedModule(signed(), wasm, installed, keys))
+	require.Error(t, verifyFetchedModule(signed(), append([]byte{}, wasm[:7]...), installed, keys), "tampered bytes")
+	require.Error(t, verifyFetchedModule(signed(), wasm, &module.Manifest{Name: "mod", Version: "v2"}, keys), "wrong version")
+	unsigned := signed()
+	unsigned.Signatures = nil
+	require.Error(t, verifyFetchedModule(unsigned, wasm, installed, keys), "unsigned")
+	require.Error(t, verifyFetchedModule(nil, wasm, installed, keys))
+}
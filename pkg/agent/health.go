@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/naviNBRuas/APA/pkg/health"
+)
+
+// registerHealthChecks registers the built-in checks not disabled under
+// health.disabled. Resources whose loss stops the agent from working are
+// critical; network and clock checks only degrade the status.
+func (rt *Runtime) registerHealthChecks(config *Config) {
+	hc := rt.healthController
+	cfg := config.Health.WithDefaults()
+	stateDir := filepath.Dir(config.IdentityFilePath)
+	critical := health.CheckOptions{Critical: true}
+
+	register := func(check health.HealthCheck, opts health.CheckOptions) {
+		if cfg.Enabled(check.Name()) {
+			hc.RegisterCheckWithOptions(check, opts)
+		}
+	}
+	register(health.NewDiskCheck(health.CheckDiskModules, config.ModulePath, cfg.Disk), critical)
+	register(health.NewDiskCheck(health.CheckDiskState, stateDir, cfg.Disk), critical)
+	register(health.NewStoreCheck(filepath.Join(stateDir, "health-probe.json"), rt.logger), critical)
+	register(health.NewModuleRuntimeCheck(rt.moduleManager.CheckRuntime), critical)
+	register(health.NewControllerCheck(rt.controllerManager.ExitedControllers), health.CheckOptions{})
+	register(health.NewTopicCheck(rt.p2p.GetTopicHealth), health.CheckOptions{})
+	register(health.NewPeerCountCheck(rt.p2p.PeerCount, cfg.Peers.Min), health.CheckOptions{})
+	register(health.NewClockSkewCheck(rt.fleet.ClockSkews, cfg.ClockSkew.Max), health.CheckOptions{Interval: time.Minute})
+	if config.AdminTLSCertPath != "" {
+		register(health.NewCertificateCheck(health.CheckAdminTLSCert, config.AdminTLSCertPath, cfg.Certificate.WarnBefore), health.CheckOptions{Interval: time.Hour})
+	}
+}
+
+// Probe endpoints for orchestrators such as Kubernetes. Plain probes are
+// served without authentication, since they only reveal pass or fail;
+// ?verbose lists every check and goes through the admin authorization.
+
+// livezHandler passes while no liveness check has failed.
+func (rt *Runtime) livezHandler(w http.ResponseWriter, r *http.Request) {
+	rt.serveProbe(w, r, "livez", func(report health.Report) (bool, []health.CheckResult) {
+		return report.Live, rt.healthController.Liveness()
+	})
+}
+
+// readyzHandler passes once every critical check has run and none failed.
+func (rt *Runtime) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	rt.serveProbe(w, r, "readyz", func(report health.Report) (bool, []health.CheckResult) {
+		var critical []health.CheckResult
+		for _, c := range report.Checks {
+			if c.Critical {
+				critical = append(critical, c)
+			}
+		}
+		return report.Ready, critical
+	})
+}
+
+// healthzHandler passes while the overall status is ok or degraded.
+func (rt *Runtime) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	rt.serveProbe(w, r, "healthz", func(report health.Report) (bool, []health.CheckResult) {
+		return report.Status == health.StatusOK || report.Status == health.StatusDegraded, report.Checks
+	})
+}
+
+func (rt *Runtime) serveProbe(w http.ResponseWriter, r *http.Request, probe string, evaluate func(health.Report) (bool, []health.CheckResult)) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_, verbose := r.URL.Query()["verbose"]
+	if verbose {
+		if !rt.checkRateLimit(w, r) {
+			return
+		}
+		input := rt.createAuthzInput(r)
+		if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+			writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+			return
+		} else if !allowed {
+			writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	if rt.healthController == nil {
+		health.WriteProbe(w, probe, false, nil, verbose)
+		return
+	}
+	passed, checks := evaluate(rt.healthController.Report())
+	health.WriteProbe(w, probe, passed, checks, verbose)
+}
+
+// healthChecksHandler returns the aggregated health report, or with ?name=
+// the recent results of one check, oldest first.
+func (rt *Runtime) healthChecksHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("health-checks", input)
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rt.healthController == nil {
+		writeJSONError(w, "Health checks not running", http.StatusServiceUnavailable)
+		return
+	}
+	var resp interface{} = rt.healthController.Report()
+	if name := r.URL.Query().Get("name"); name != "" {
+		history := rt.healthController.History(name)
+		if history == nil {
+			writeJSONError(w, "Unknown health check", http.StatusNotFound)
+			return
+		}
+		resp = history
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		rt.logger.Error("Failed to encode health report", "error", err)
+	}
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/naviNBRuas/APA/pkg/health"
+)
+
+func TestHealthProbes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	hc := health.NewHealthController(logger)
+	hc.RegisterCheckWithOptions(health.NewProcessLivenessCheck(), health.CheckOptions{Critical: true, Liveness: true})
+	hc.RegisterCheckWithOptions(health.NewCheckFunc("peers", "p2p", func(ctx context.Context) error {
+		return errors.New("no peers connected")
+	}), health.CheckOptions{})
+	rt := &Runtime{
+		logger:           logger,
+		rateLimiters:     make(map[string]*rate.Limiter),
+		healthController: hc,
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", rt.livezHandler)
+	mux.HandleFunc("/readyz", rt.readyzHandler)
+	mux.HandleFunc("/healthz", rt.healthzHandler)
+	mux.HandleFunc("/admin/health/checks", rt.healthChecksHandler)
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(ts.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// Nothing has run yet: live, but not ready.
+	code, _ := get("/livez")
+	require.Equal(t, http.StatusOK, code)
+	code, _ = get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, code)
+
+	hc.RunChecks(context.Background())
+	code, body := get("/readyz")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "ok\n", body)
+
+	// The non-critical peers check degrades the agent without failing it.
+	code, body = get("/healthz?verbose")
+	require.Equal(t, http.StatusOK, code)
+	require.Contains(t, body, "[+]process-liveness ok\n")
+	require.Contains(t, body, "[-]peers failed: no peers connected\n")
+	require.Contains(t, body, "healthz check passed")
+
+	code, body = get("/admin/health/checks")
+	require.Equal(t, http.StatusOK, code)
+	var report health.Report
+	require.NoError(t, json.Unmarshal([]byte(body), &report))
+	require.Equal(t, health.StatusDegraded, report.Status)
+	require.Len(t, report.Checks, 2)
+
+	code, body = get("/admin/health/checks?name=peers")
+	require.Equal(t, http.StatusOK, code)
+	var history []health.CheckResult
+	require.NoError(t, json.Unmarshal([]byte(body), &history))
+	require.Len(t, history, 1)
+	require.Equal(t, "p2p", history[0].Component)
+
+	code, _ = get("/admin/health/checks?name=missing")
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestRegisterHealthChecks(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	config := &Config{
+		ModulePath:       dir,
+		IdentityFilePath: filepath.Join(dir, "state", "identity.json"),
+		Health:           health.Config{Disabled: []string{health.CheckPeers}},
+	}
+	rt := &Runtime{logger: logger, healthController: health.NewHealthController(logger)}
+	rt.registerHealthChecks(config)
+
+	var names []string
+	for _, c := range rt.healthController.Report().Checks {
+		names = append(names, c.Name)
+	}
+	require.ElementsMatch(t, []string{
+		health.CheckDiskModules, health.CheckDiskState, health.CheckStore, health.CheckModuleRuntime,
+		health.CheckControllers, health.CheckPubsubTopics, health.CheckClockSkew,
+	}, names, "peers is disabled and no admin TLS certificate is configured")
+
+	config.AdminTLSCertPath = filepath.Join(dir, "admin.crt")
+	config.Health.Disabled = nil
+	rt.healthController = health.NewHealthController(logger)
+	rt.registerHealthChecks(config)
+	require.NotNil(t, rt.healthController.History(health.CheckAdminTLSCert))
+	require.NotNil(t, rt.healthController.History(health.CheckPeers))
+}
@@ -7,15 +7,18 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
 
 	"github.com/naviNBRuas/APA/pkg/controller"
 	"github.com/naviNBRuas/APA/pkg/networking"
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
 func (rt *Runtime) ApplyConfig(configData []byte) error {
@@ -48,8 +51,9 @@ func (rt *Runtime) Start(ctx context.Context, cancel context.CancelFunc) {
 	rt.runMu.Unlock()
 
 	go rt.updateManager.StartPeriodicCheck(ctx, rt.config.Update.CheckInterval)
+	go rt.updateManager.StartProbation(ctx, rt.probationCheck)
 
-	go rt.healthController.StartHealthChecks(ctx, 10*time.Second)
+	go rt.healthController.StartHealthChecks(ctx, 0)
 
 	if rt.regenerator != nil {
 		rt.regenerator.Start(ctx)
@@ -88,6 +92,7 @@ func (rt *Runtime) Start(ctx context.Context, cancel context.CancelFunc) {
 		go func(c controller.Controller) {
 			if err := c.Start(ctx); err != nil {
 				rt.logger.Error("Failed to start controller", "name", c.Name(), "error", err)
+				rt.emit(EventControllerFailed, SeverityError, "controller", c.Name(), "Controller failed to start", map[string]interface{}{"error": err.Error()})
 			}
 		}(ctrl)
 	}
@@ -124,6 +129,41 @@ func (rt *Runtime) Start(ctx context.Context, cancel context.CancelFunc) {
 		rt.logger.Error("Failed to join leader election topic", "error", err)
 	}
 
+	go rt.runFleetStatus(ctx)
+
+	if rt.alerts != nil {
+		go rt.alerts.Run(ctx)
+		go rt.runAlertEvents(ctx)
+	}
+
+	if rt.rollout != nil {
+		go rt.runRollout(ctx)
+	}
+
+	if rt.transfer != nil {
+		go rt.transfer.Reprovide(ctx)
+	}
+
+	if rt.backups != nil {
+		go rt.runBackups(ctx)
+	}
+
+	if rt.approvals != nil {
+		go rt.approvals.Run(ctx, approvalSweepInterval)
+	}
+
+	if rt.state != nil {
+		go rt.state.Run(ctx)
+	}
+
+	if rt.shedder != nil {
+		go rt.runDegradation(ctx)
+	}
+
+	if rt.healing != nil {
+		go rt.healing.SchedulePeriodicHealing(ctx, rt.config.Healing.WithDefaults().Interval)
+	}
+
 	go func() {
 		msgCh, err := rt.p2p.SubscribeControllerMessages(ctx)
 		if err != nil {
@@ -141,9 +181,16 @@ func (rt *Runtime) Start(ctx context.Context, cancel context.CancelFunc) {
 					continue
 				}
 				rt.logger.Debug("Dispatching controller message", "type", msg.Type, "sender", msg.SenderPeerID)
+				msgCtx := tracing.Extract(ctx, msg.TraceContext)
 				for _, ctrl := range rt.controllers {
 					go func(c controller.Controller, message networking.ControllerMessage) {
-						if err := c.HandleMessage(ctx, message); err != nil {
+						hctx, span := tracing.Start(msgCtx, "controller.HandleMessage",
+							attribute.String("controller.name", c.Name()),
+							attribute.String("message.type", message.Type),
+							attribute.String("message.sender", message.SenderPeerID))
+						err := c.HandleMessage(hctx, message)
+						tracing.End(span, err)
+						if err != nil {
 							rt.logger.Error("Failed to dispatch message to controller", "controller", c.Name(), "error", err)
 						}
 					}(ctrl, *msg)
@@ -191,9 +238,7 @@ func (rt *Runtime) Start(ctx context.Context, cancel context.CancelFunc) {
 						rt.logger.Error("Failed to publish leader election message", "error", err)
 					}
 					if isLeader {
-						rt.runMu.Lock()
-						rt.currentLeader = myID
-						rt.runMu.Unlock()
+						rt.setLeader(myID)
 						rt.logger.Info("Agent is the current leader", "peer_id", myID)
 					} else {
 						rt.logger.Info("Agent is not the leader")
@@ -224,9 +269,7 @@ func (rt *Runtime) Start(ctx context.Context, cancel context.CancelFunc) {
 
 				rt.logger.Debug("Received leader election message", "candidate", msg.CandidateID, "is_leader", msg.IsLeader, "from", msg.SenderPeerID)
 				if msg.IsLeader {
-					rt.runMu.Lock()
-					rt.currentLeader = peerID
-					rt.runMu.Unlock()
+					rt.setLeader(peerID)
 					rt.logger.Info("Leader identified", "leader_id", peerID)
 				}
 			}
@@ -236,11 +279,17 @@ func (rt *Runtime) Start(ctx context.Context, cancel context.CancelFunc) {
 	if err := rt.moduleManager.LoadModulesFromDir(); err != nil {
 		rt.logger.Error("Failed to load modules", "error", err)
 	}
+	if rt.patches != nil {
+		for _, manifest := range rt.moduleManager.ListModules() {
+			rt.patches.SetCurrentVersion("module", manifest.Name, manifest.Version)
+		}
+	}
 
 	for _, manifest := range rt.moduleManager.ListModules() {
 		go func(name string) {
-			if err := rt.moduleManager.RunModule(name); err != nil {
+			if err := rt.moduleManager.RunModule(ctx, name); err != nil {
 				rt.logger.Error("Failed to run module", "name", name, "error", err)
+				rt.emit(EventModuleFailed, SeverityError, "module", name, "Module run failed", map[string]interface{}{"error": err.Error()})
 			}
 		}(manifest.Name)
 	}
@@ -257,21 +306,39 @@ func (rt *Runtime) Start(ctx context.Context, cancel context.CancelFunc) {
 	mux.HandleFunc("/admin/metrics", rt.metricsHandler)
 	mux.HandleFunc("/admin/audit", rt.auditHandler)
 	mux.HandleFunc("/admin/status", rt.statusHandler)
+	mux.HandleFunc("/admin/faults", rt.faultsHandler)
 	mux.HandleFunc("/admin/health", rt.healthHandler)
+	mux.HandleFunc("/admin/health/checks", rt.healthChecksHandler)
+	mux.HandleFunc("/livez", rt.livezHandler)
+	mux.HandleFunc("/readyz", rt.readyzHandler)
+	mux.HandleFunc("/healthz", rt.healthzHandler)
 	mux.HandleFunc("/admin/modules", rt.modulesHandler)
 	mux.HandleFunc("/admin/controllers", rt.controllersHandler)
 	mux.HandleFunc("/admin/config", rt.configHandler)
 	mux.HandleFunc("/admin/update", rt.updateHandler)
+	mux.HandleFunc("/admin/update/rollout", rt.rolloutHandler)
+	mux.HandleFunc("/admin/patches", rt.patchesHandler)
+	mux.HandleFunc("/admin/backups", rt.backupsHandler)
+	mux.HandleFunc("/admin/backups/check", rt.backupCheckHandler)
+	mux.HandleFunc("/admin/backups/keys", rt.backupKeysHandler)
 	mux.HandleFunc("/admin/peer-copy", rt.peerCopyHandler)
+	mux.HandleFunc("/admin/recovery/p2p", rt.p2pRecoveryHandler)
+	mux.HandleFunc("/admin/healing", rt.healingHandler)
+	mux.HandleFunc("/admin/approvals", rt.approvalsHandler)
+	mux.HandleFunc("/admin/approvals/", rt.approvalsHandler)
 	mux.HandleFunc("/admin/regenerate", rt.triggerRegenerationHandler)
 	mux.HandleFunc("/admin/propagate", rt.triggerPropagationHandler)
 	mux.HandleFunc("/admin/mesh", rt.meshHandler)
+	mux.HandleFunc("/admin/events", rt.eventsHandler)
+	mux.HandleFunc("/admin/fleet", rt.fleetHandler)
+	mux.HandleFunc("/admin/alerts", rt.alertsHandler)
+	mux.HandleFunc("/admin/alerts/silences", rt.silencesHandler)
 	mux.Handle("/metrics", rt.prometheusHandler())
 
 	tlsConfig, serveTLS := rt.buildAdminTLSConfig()
 	rt.server = &http.Server{
 		Addr:              rt.config.AdminListenAddress,
-		Handler:           mux,
+		Handler:           tracing.Middleware(mux),
 		TLSConfig:         tlsConfig,
 		ReadHeaderTimeout: 10 * time.Second,
 	}
@@ -350,9 +417,40 @@ func (rt *Runtime) Stop() {
 			rt.logger.Error("Admin API server shutdown failed", "error", err)
 		}
 	}
+
+	if rt.tracingShutdown != nil {
+		tracingCtx, tracingCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer tracingCancel()
+		if err := rt.tracingShutdown(tracingCtx); err != nil {
+			rt.logger.Error("Failed to flush traces", "error", err)
+		}
+	}
 	rt.logger.Info("Agent runtime shut down gracefully.")
 }
 
+// setLeader records the current leader and announces changes on the event bus.
+func (rt *Runtime) setLeader(id peer.ID) {
+	rt.runMu.Lock()
+	changed := rt.currentLeader != id
+	rt.currentLeader = id
+	rt.runMu.Unlock()
+	if changed {
+		rt.emit(EventLeaderChanged, SeverityInfo, "consensus", id.String(), "Leader changed", nil)
+	}
+}
+
+// probationCheck reports whether the agent is healthy enough for a freshly
+// applied version to be confirmed good.
+func (rt *Runtime) probationCheck() error {
+	if rt.healthController == nil {
+		return nil
+	}
+	if failing := rt.healthController.FailingChecks(); len(failing) > 0 {
+		return fmt.Errorf("failing health checks: %s", strings.Join(failing, ", "))
+	}
+	return nil
+}
+
 func (rt *Runtime) waitForShutdown(cancel context.CancelFunc) {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -55,3 +55,32 @@ func TestAuditEndpoint_NoLogger(t *testing.T) {
 	defer resp.Body.Close()
 	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
 }
+
+func TestPrometheusEndpointReportsLiveValues(t *testing.T) {
+	rt := &Runtime{}
+	rt.startTime = time.Now().Add(-time.Minute)
+	ts := httptest.NewServer(rt.prometheusHandler())
+	defer ts.Close()
+
+	rt.metrics.AuditEntry()
+
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "apa_audit_entries_total 1")
+	require.NotContains(t, string(body), "apa_uptime_seconds 0\n")
+}
+
+func TestAdminRouteUsesMuxPattern(t *testing.T) {
+	var route string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/approvals/", func(w http.ResponseWriter, r *http.Request) { route = adminRoute(r) })
+
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin/approvals/3f9c1a", nil))
+	require.Equal(t, "/admin/approvals/", route, "IDs in the path must not reach the metric label")
+	require.Equal(t, "unmatched", adminRoute(httptest.NewRequest(http.MethodGet, "/admin/probe-1234", nil)))
+}
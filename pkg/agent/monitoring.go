@@ -6,22 +6,16 @@ import (
 	"os"
 	"time"
 
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/naviNBRuas/APA/pkg/metrics"
 )
 
+// prometheusHandler serves the runtime's shared metrics registry. Runtimes
+// built without init (as in tests) get a registry of their own.
 func (rt *Runtime) prometheusHandler() http.Handler {
-	reg := prometheus.NewRegistry()
-	collectors := []prometheus.Collector{
-		prometheus.NewGauge(prometheus.GaugeOpts{Name: "apa_uptime_seconds", Help: "Agent uptime in seconds"}),
-		prometheus.NewGauge(prometheus.GaugeOpts{Name: "apa_goroutines", Help: "Number of goroutines"}),
-		prometheus.NewGauge(prometheus.GaugeOpts{Name: "apa_peers", Help: "Number of connected peers"}),
-		prometheus.NewCounter(prometheus.CounterOpts{Name: "apa_audit_entries_total", Help: "Total audit log entries"}),
+	if rt.metrics == nil {
+		rt.metrics = metrics.New(rt.startTime)
 	}
-	for _, c := range collectors {
-		reg.MustRegister(c)
-	}
-	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+	return rt.metrics.Handler()
 }
 
 func (rt *Runtime) monitorBinaryIntegrity(ctx context.Context, interval time.Duration) {
@@ -39,10 +33,13 @@ func (rt *Runtime) monitorBinaryIntegrity(ctx context.Context, interval time.Dur
 		}
 		if ok := rt.antiTamper.VerifyIntegrity(data); !ok {
 			rt.logger.Error("Binary integrity check failed", "binary", rt.binaryPath)
+			rt.emit(EventTamperDetected, SeverityError, "integrity", rt.binaryPath, "Binary integrity check failed", nil)
 			if rt.regenerator != nil {
-				if err := rt.regenerator.TriggerRegeneration(ctx); err != nil {
+				err := rt.regenerator.TriggerRegeneration(ctx)
+				if err != nil {
 					rt.logger.Error("Failed to trigger regeneration after tamper detection", "error", err)
 				}
+				rt.emitHealing("regenerate", rt.binaryPath, "tamper_detected", err)
 			}
 		}
 	}
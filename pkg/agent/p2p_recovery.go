@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gopkg.in/yaml.v3"
+
+	"github.com/naviNBRuas/APA/pkg/swarm"
+)
+
+// recoveryReputation adapts the swarm reputation system to
+// recovery.ReputationService.
+type recoveryReputation struct {
+	*swarm.ReputationSystem
+}
+
+func (r recoveryReputation) GetPeerScore(peerID string) float64 {
+	return r.GetScore(peerID)
+}
+
+// shareableConfig is the configuration served to recovering peers: the
+// sanitized config without node-specific fields, so agents running the same
+// configuration serve identical bytes and can agree on it.
+func (rt *Runtime) shareableConfig() ([]byte, error) {
+	c := rt.sanitizedConfig()
+	if c == nil {
+		return nil, fmt.Errorf("configuration not loaded")
+	}
+	c.Mesh.NodeName = ""
+	return yaml.Marshal(c)
+}
+
+// applyRecoveredConfig applies a configuration recovered from peers,
+// keeping the local credentials and node-specific fields shareableConfig
+// leaves out.
+func (rt *Runtime) applyRecoveredConfig(data []byte) error {
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("failed to unmarshal recovered configuration: %w", err)
+	}
+	c.AdminAPIKey = rt.config.AdminAPIKey
+	c.SigningPrivKeyPath = rt.config.SigningPrivKeyPath
+	c.AdminTLSCertPath = rt.config.AdminTLSCertPath
+	c.AdminTLSKeyPath = rt.config.AdminTLSKeyPath
+	c.AdminTLSClientCA = rt.config.AdminTLSClientCA
+	c.Alerting.Receivers = rt.config.Alerting.Receivers
+	c.Mesh.NodeName = rt.config.Mesh.NodeName
+	merged, err := yaml.Marshal(&c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal recovered configuration: %w", err)
+	}
+	return rt.ApplyConfig(merged)
+}
+
+// recoveryState is the operational state served to recovering peers.
+func (rt *Runtime) recoveryState() (map[string]interface{}, error) {
+	return map[string]interface{}{"quarantine_list": rt.recoveryController.ListQuarantined()}, nil
+}
+
+// applyRecoveryState quarantines the nodes a peer has quarantined.
+func (rt *Runtime) applyRecoveryState(state map[string]interface{}) error {
+	ids, _ := state["quarantine_list"].([]interface{})
+	for _, v := range ids {
+		id, ok := v.(string)
+		if !ok || rt.recoveryController.IsQuarantined(id) {
+			continue
+		}
+		if err := rt.recoveryController.QuarantineNode(context.Background(), id); err != nil {
+			return fmt.Errorf("failed to quarantine %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// p2pRecoveryRequest lists the peers to recover from; empty means every
+// connected peer.
+type p2pRecoveryRequest struct {
+	Peers []string `json:"peers"`
+}
+
+// p2pRecoveryHandler lists the recovery inventories peers have offered
+// (GET) and recovers the agent's state from trusted peers (POST).
+func (rt *Runtime) p2pRecoveryHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("p2p-recovery", input)
+
+	if rt.p2pRecovery == nil {
+		writeJSONError(w, "Peer-to-peer recovery not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rt.p2pRecovery.Offers()); err != nil {
+			rt.logger.Error("Failed to encode recovery offers", "error", err)
+		}
+	case http.MethodPost:
+		var req p2pRecoveryRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+		}
+		var peers []peer.ID
+		for _, p := range req.Peers {
+			id, err := peer.Decode(p)
+			if err != nil {
+				writeJSONError(w, fmt.Sprintf("Invalid peer ID %q", p), http.StatusBadRequest)
+				return
+			}
+			peers = append(peers, id)
+		}
+		if len(peers) == 0 {
+			peers = rt.p2p.GetConnectedPeers()
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Minute)
+		defer cancel()
+		err := rt.p2pRecovery.RecoverAgentState(ctx, peers)
+		rt.emitHealing("p2p_recovery", "agent", "admin", err)
+		if err != nil {
+			rt.logger.Error("Peer-to-peer recovery failed", "error", err)
+			writeJSONError(w, "Peer-to-peer recovery failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(map[string]interface{}{"recovered": true, "peers": len(peers)}); err != nil {
+			rt.logger.Error("Failed to encode recovery response", "error", err)
+		}
+	default:
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
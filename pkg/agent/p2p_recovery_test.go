@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/naviNBRuas/APA/pkg/recovery"
+	"github.com/naviNBRuas/APA/pkg/swarm"
+)
+
+func TestShareableConfig(t *testing.T) {
+	newRuntime := func(apiKey, node string) *Runtime {
+		cfg := &Config{LogLevel: "info", ModulePath: "/var/lib/apa/modules", AdminAPIKey: apiKey}
+		cfg.Mesh.NodeName = node
+		return &Runtime{config: cfg}
+	}
+	a, err := newRuntime("secret-a", "node-a").shareableConfig()
+	require.NoError(t, err)
+	b, err := newRuntime("secret-b", "node-b").shareableConfig()
+	require.NoError(t, err)
+
+	require.Equal(t, a, b, "agents with the same configuration serve identical bytes")
+	require.NotContains(t, string(a), "secret-a")
+	require.Contains(t, string(a), "/var/lib/apa/modules")
+}
+
+func TestP2PRecoveryHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	rt := &Runtime{
+		logger:       logger,
+		rateLimiters: make(map[string]*rate.Limiter),
+	}
+	ts := httptest.NewServer(http.HandlerFunc(rt.p2pRecoveryHandler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	rt.p2pRecovery = recovery.NewP2PRecoveryManager(logger, nil, nil, nil, nil, recoveryReputation{swarm.NewReputationSystem(logger)})
+	resp, err = http.Get(ts.URL)
+	require.NoError(t, err)
+	var offers map[string]recovery.RecoveryInventory
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&offers))
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Empty(t, offers)
+
+	resp, err = http.Post(ts.URL, "application/json", strings.NewReader(`{"peers":["not-a-peer"]}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
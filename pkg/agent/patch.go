@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/naviNBRuas/APA/pkg/patch"
+)
+
+// receivePatch verifies and applies a patch pushed by a peer and reports the
+// outcome as an event.
+func (rt *Runtime) receivePatch(ctx context.Context, from peer.ID, p *patch.Patch) patch.DeliveryResult {
+	result := rt.patches.HandleIncoming(ctx, from.String(), p)
+	data := map[string]interface{}{
+		"from":     from.String(),
+		"target":   p.Target,
+		"name":     p.Name,
+		"version":  p.Version,
+		"severity": p.Severity,
+		"status":   result.Status,
+	}
+	severity, message := SeverityInfo, "Patch applied"
+	if result.Status != patch.DeliveryApplied {
+		data["error"] = result.Error
+		severity, message = SeverityError, "Patch not applied"
+	}
+	rt.emit(EventPatchReceived, severity, "patch", p.ID, message, data)
+	return result
+}
+
+type patchDistributeRequest struct {
+	Patch *patch.Patch `json:"patch"`
+	Peers []string     `json:"peers"` // defaults to every connected peer
+	Local bool         `json:"local"` // also apply the patch on this agent
+}
+
+type patchDistributeResponse struct {
+	PatchID string                 `json:"patch_id"`
+	Local   *patch.DeliveryResult  `json:"local,omitempty"`
+	Results []patch.DeliveryResult `json:"results"`
+}
+
+// patchesHandler lists the patches applied on this agent (GET) or delivers
+// a signed patch to peers and reports their acknowledgements (POST).
+func (rt *Runtime) patchesHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("patches", input)
+
+	if rt.patches == nil {
+		writeJSONError(w, "Patch distribution not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(rt.patches.AppliedPatches()); err != nil {
+			rt.logger.Error("Failed to encode patches response", "error", err)
+		}
+	case http.MethodPost:
+		var req patchDistributeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Patch == nil {
+			writeJSONError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := rt.patches.AddPatch(req.Patch); err != nil {
+			writeJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp := patchDistributeResponse{PatchID: req.Patch.ID}
+		if req.Local {
+			local := rt.receivePatch(r.Context(), rt.identity.PeerID, req.Patch)
+			resp.Local = &local
+		}
+		peers := req.Peers
+		if len(peers) == 0 {
+			for _, id := range rt.p2p.GetConnectedPeers() {
+				peers = append(peers, id.String())
+			}
+		}
+		results, err := rt.patches.DistributePatch(r.Context(), req.Patch.ID, peers)
+		if err != nil {
+			writeJSONError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Results = results
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			rt.logger.Error("Failed to encode patch distribution response", "error", err)
+		}
+	default:
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
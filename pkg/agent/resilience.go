@@ -0,0 +1,47 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/naviNBRuas/APA/pkg/controller/manager"
+	"github.com/naviNBRuas/APA/pkg/networking"
+	"github.com/naviNBRuas/APA/pkg/robustness"
+	"github.com/naviNBRuas/APA/pkg/update"
+)
+
+// ResilienceConfig tunes the timeouts, retries, circuit breakers and
+// concurrency limits of the agent's outbound calls. Unset fields keep the
+// defaults of each component.
+type ResilienceConfig struct {
+	UpdateDownloads robustness.PolicyConfig `yaml:"update_downloads"`
+	PeerFetches     robustness.PolicyConfig `yaml:"peer_fetches"`
+	ControllerRPC   robustness.PolicyConfig `yaml:"controller_rpc"`
+}
+
+// Validate checks each configured policy.
+func (c ResilienceConfig) Validate() error {
+	for name, p := range map[string]robustness.PolicyConfig{
+		"update_downloads": c.UpdateDownloads,
+		"peer_fetches":     c.PeerFetches,
+		"controller_rpc":   c.ControllerRPC,
+	} {
+		if err := p.Validate(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// applyResilience replaces the default policies of the update manager, the
+// P2P layer and the controller manager with the configured ones, and
+// exports their circuit breaker states.
+func (rt *Runtime) applyResilience(cfg ResilienceConfig) {
+	policy := func(name string, c, defaults robustness.PolicyConfig) *robustness.Policy {
+		p := robustness.NewPolicy(rt.logger, name, c.Merge(defaults))
+		p.SetMetrics(rt.metrics)
+		return p
+	}
+	rt.updateManager.SetDownloadPolicy(policy("update", cfg.UpdateDownloads, update.DefaultDownloadPolicy))
+	rt.p2p.SetFetchPolicy(policy("peer-fetch", cfg.PeerFetches, networking.DefaultPeerFetchPolicy))
+	rt.controllerManager.SetRPCPolicy(policy("controller-rpc", cfg.ControllerRPC, manager.DefaultRPCPolicy))
+}
@@ -0,0 +1,148 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/naviNBRuas/APA/pkg/fleet"
+	"github.com/naviNBRuas/APA/pkg/update"
+)
+
+// rolloutReports converts the aggregated fleet view into rollout health
+// reports. Agents that stopped reporting count as unhealthy, since a
+// crash-looping agent never stays up long enough to publish. Fleet statuses
+// are signed by whoever publishes them, so only nodes for which trusted
+// returns true are reported; otherwise made-up peers could halt a rollout.
+func rolloutReports(view fleet.View, trusted func(peerID string) bool) []update.NodeReport {
+	reports := make([]update.NodeReport, 0, len(view.Nodes))
+	for _, n := range view.Nodes {
+		if !trusted(n.PeerID) {
+			continue
+		}
+		reports = append(reports, update.NodeReport{
+			PeerID:  n.PeerID,
+			Version: n.Version,
+			Healthy: n.Health == fleet.HealthHealthy && !n.Stale,
+		})
+	}
+	return reports
+}
+
+// coordinateRollout advances the plan for the newest known release when
+// this agent is a configured coordinator and leads the fleet (or is the only
+// coordinator), then rolls back the running version if its rollout was
+// halted.
+func (rt *Runtime) coordinateRollout(ctx context.Context) {
+	rt.runMu.RLock()
+	leader := rt.currentLeader == rt.identity.PeerID
+	rt.runMu.RUnlock()
+
+	if release := rt.updateManager.LatestRelease(); rt.rollout.ShouldCoordinate(leader) && release != nil {
+		plan, changed, err := rt.rollout.Coordinate(ctx, release.Version, rolloutReports(rt.fleet.View(), rt.rolloutReporter))
+		if err != nil {
+			rt.logger.Error("Failed to coordinate rollout", "version", release.Version, "error", err)
+		} else if changed {
+			severity := SeverityInfo
+			if plan.State == update.RolloutHalted {
+				severity = SeverityError
+			}
+			rt.emit(EventUpdateRollout, severity, "update", plan.Version, "Rollout plan "+plan.State, map[string]interface{}{
+				"wave":     plan.Wave + 1,
+				"percent":  plan.Percent,
+				"state":    plan.State,
+				"reason":   plan.Reason,
+				"rollback": plan.Rollback,
+			})
+		}
+	}
+
+	rt.updateManager.EnforceRollout()
+}
+
+// rolloutReporter reports whether the fleet status of peerID counts towards
+// a rollout: it is this agent, an admitted peer or listed in report_peers.
+func (rt *Runtime) rolloutReporter(peerID string) bool {
+	if peerID == rt.identity.PeerID.String() {
+		return true
+	}
+	for _, id := range rt.config.Update.Rollout.ReportPeers {
+		if id == peerID {
+			return true
+		}
+	}
+	pid, err := peer.Decode(peerID)
+	return err == nil && rt.p2p.IsPeerAdmitted(pid)
+}
+
+// runRollout coordinates and enforces staged rollouts every PollInterval.
+func (rt *Runtime) runRollout(ctx context.Context) {
+	ticker := time.NewTicker(rt.config.Update.Rollout.WithDefaults().PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rt.coordinateRollout(ctx)
+		}
+	}
+}
+
+type rolloutResponse struct {
+	Channel        string              `json:"channel"`
+	CurrentVersion string              `json:"current_version"`
+	LatestVersion  string              `json:"latest_version,omitempty"`
+	Bucket         *int                `json:"bucket,omitempty"`
+	Admitted       *bool               `json:"admitted,omitempty"`
+	Reason         string              `json:"reason,omitempty"`
+	Plan           *update.RolloutPlan `json:"plan,omitempty"`
+}
+
+func (rt *Runtime) rolloutHandler(w http.ResponseWriter, r *http.Request) {
+	if !rt.checkRateLimit(w, r) {
+		return
+	}
+	input := rt.createAuthzInput(r)
+	if allowed, err := rt.authorizeAdminRequest(r.Context(), r, input); err != nil {
+		writeJSONError(w, "Authorization error", http.StatusInternalServerError)
+		return
+	} else if !allowed {
+		writeJSONError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	defer rt.appendAudit("update-rollout", input)
+
+	if r.Method != http.MethodGet {
+		writeJSONError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if rt.rollout == nil {
+		writeJSONError(w, "Staged rollouts not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	resp := rolloutResponse{
+		Channel:        rt.config.Update.Rollout.WithDefaults().Channel,
+		CurrentVersion: rt.updateManager.CurrentVersion(),
+	}
+	if release := rt.updateManager.LatestRelease(); release != nil {
+		bucket := update.Bucket(rt.identity.PeerID.String(), release.Version)
+		admitted, reason := rt.rollout.Admit(release)
+		resp.LatestVersion = release.Version
+		resp.Bucket = &bucket
+		resp.Admitted = &admitted
+		resp.Reason = reason
+		if plan, ok := rt.rollout.Plan(release.Version); ok {
+			resp.Plan = plan
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		rt.logger.Error("Failed to encode rollout response", "error", err)
+	}
+}
@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+
+	"github.com/naviNBRuas/APA/pkg/fleet"
+	"github.com/naviNBRuas/APA/pkg/update"
+)
+
+type mapRolloutStore map[string][]byte
+
+func (s mapRolloutStore) Get(key string) ([]byte, bool) {
+	v, ok := s[key]
+	return v, ok
+}
+
+func (s mapRolloutStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s[key] = value
+	return nil
+}
+
+func TestRolloutReportsTreatStaleNodesAsUnhealthy(t *testing.T) {
+	view := fleet.View{Nodes: []fleet.NodeView{
+		{Status: fleet.Status{PeerID: "a", Version: "v1.2.0", Health: fleet.HealthHealthy}},
+		{Status: fleet.Status{PeerID: "b", Version: "v1.2.0", Health: fleet.HealthDegraded}},
+		{Status: fleet.Status{PeerID: "c", Version: "v1.2.0", Health: fleet.HealthHealthy}, Stale: true},
+	}}
+	reports := rolloutReports(view, func(string) bool { return true })
+	require.Len(t, reports, 3)
+	require.True(t, reports[0].Healthy)
+	require.False(t, reports[1].Healthy)
+	require.False(t, reports[2].Healthy)
+}
+
+func TestRolloutIgnoresReportsFromUntrustedPeers(t *testing.T) {
+	newPeer := func() (crypto.PrivKey, peer.ID) {
+		priv, _, err := crypto.GenerateEd25519Key(nil)
+		require.NoError(t, err)
+		id, err := peer.IDFromPrivateKey(priv)
+		require.NoError(t, err)
+		return priv, id
+	}
+	priv, id := newPeer()
+	self := id.String()
+	cfg := update.RolloutConfig{Enabled: true, MinReports: 1, AutoRollback: true, Coordinators: []string{self}}
+	rt := &Runtime{
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		identity: &Identity{PeerID: id, PrivKey: priv},
+		config:   &Config{},
+	}
+	rt.config.Update.Rollout = cfg
+
+	// Made-up peers publish statuses claiming the release is unhealthy.
+	view := fleet.View{Nodes: []fleet.NodeView{
+		{Status: fleet.Status{PeerID: self, Version: "v1.1.0", Health: fleet.HealthHealthy}},
+	}}
+	var fakes []string
+	for i := 0; i < 5; i++ {
+		_, fake := newPeer()
+		fakes = append(fakes, fake.String())
+		view.Nodes = append(view.Nodes, fleet.NodeView{Status: fleet.Status{PeerID: fake.String(), Version: "v1.2.0", Health: fleet.HealthDegraded}})
+	}
+
+	store := mapRolloutStore{}
+	rollout := update.NewRollout(rt.logger, cfg, self, store)
+	require.NoError(t, rollout.SetSigningKey(priv))
+	ctx := context.Background()
+	_, _, err := rollout.Coordinate(ctx, "v1.2.0", nil)
+	require.NoError(t, err)
+
+	reports := rolloutReports(view, rt.rolloutReporter)
+	require.Len(t, reports, 1, "only this agent's own status counts")
+	plan, _, err := rollout.Coordinate(ctx, "v1.2.0", reports)
+	require.NoError(t, err)
+	require.Equal(t, update.RolloutActive, plan.State)
+
+	// Peers listed in report_peers count.
+	rt.config.Update.Rollout.ReportPeers = fakes
+	plan, _, err = rollout.Coordinate(ctx, "v1.2.0", rolloutReports(view, rt.rolloutReporter))
+	require.NoError(t, err)
+	require.Equal(t, update.RolloutHalted, plan.State)
+}
+
+func TestRolloutHandler(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	manager, err := update.NewManager(logger, update.Config{PublicKey: "0000000000000000000000000000000000000000000000000000000000000000"}, "v1.1.0")
+	require.NoError(t, err)
+
+	rt := &Runtime{
+		logger:        logger,
+		rateLimiters:  make(map[string]*rate.Limiter),
+		config:        &Config{},
+		updateManager: manager,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(rt.rolloutHandler))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+
+	rt.rollout = update.NewRollout(logger, update.RolloutConfig{Channel: update.ChannelBeta}, "peer-a", mapRolloutStore{})
+	rt.config.Update.Rollout = update.RolloutConfig{Enabled: true, Channel: update.ChannelBeta}
+	resp, err = http.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got rolloutResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&got))
+	require.Equal(t, update.ChannelBeta, got.Channel)
+	require.Equal(t, "v1.1.0", got.CurrentVersion)
+	require.Nil(t, got.Plan)
+}
@@ -10,20 +10,31 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/peer"
 
+	"github.com/naviNBRuas/APA/pkg/alerting"
+	"github.com/naviNBRuas/APA/pkg/approval"
+	"github.com/naviNBRuas/APA/pkg/backup"
 	"github.com/naviNBRuas/APA/pkg/controller"
 	manager "github.com/naviNBRuas/APA/pkg/controller/manager"
 	"github.com/naviNBRuas/APA/pkg/controller/task-orchestrator"
 	"github.com/naviNBRuas/APA/pkg/controlplane"
+	"github.com/naviNBRuas/APA/pkg/faults"
+	"github.com/naviNBRuas/APA/pkg/fleet"
 	"github.com/naviNBRuas/APA/pkg/health"
+	"github.com/naviNBRuas/APA/pkg/metrics"
 	"github.com/naviNBRuas/APA/pkg/module"
 	"github.com/naviNBRuas/APA/pkg/networking"
 	"github.com/naviNBRuas/APA/pkg/networking/mesh"
 	"github.com/naviNBRuas/APA/pkg/obfuscation"
 	"github.com/naviNBRuas/APA/pkg/opa"
+	"github.com/naviNBRuas/APA/pkg/patch"
 	"github.com/naviNBRuas/APA/pkg/persistence"
 	"github.com/naviNBRuas/APA/pkg/recovery"
 	"github.com/naviNBRuas/APA/pkg/regeneration"
+	"github.com/naviNBRuas/APA/pkg/selfhealing"
+	"github.com/naviNBRuas/APA/pkg/store"
 	"github.com/naviNBRuas/APA/pkg/swarm"
+	"github.com/naviNBRuas/APA/pkg/tracing"
+	"github.com/naviNBRuas/APA/pkg/transfer"
 	"github.com/naviNBRuas/APA/pkg/update"
 	"golang.org/x/time/rate"
 )
@@ -32,6 +43,7 @@ type StatusResponse struct {
 	Version       string             `json:"version"`
 	PeerID        string             `json:"peer_id"`
 	LoadedModules []*module.Manifest `json:"loaded_modules"`
+	Degradation   *DegradationStatus `json:"degradation,omitempty"`
 }
 
 type Config struct {
@@ -53,6 +65,25 @@ type Config struct {
 	ControlPlane              controlplane.Config `yaml:"control_plane"`
 	EphemeralIdentity         EphemeralConfig     `yaml:"ephemeral_identity"`
 	Mesh                      mesh.MeshConfig     `yaml:"mesh"`
+	Tracing                   tracing.Config      `yaml:"tracing"`
+	Events                    EventsConfig        `yaml:"events"`
+	Fleet                     fleet.Config        `yaml:"fleet"`
+	Alerting                  alerting.Config     `yaml:"alerting"`
+	Transfer                  transfer.Config     `yaml:"transfer"`
+	Patch                     patch.Config        `yaml:"patch"`
+	Backup                    backup.Config       `yaml:"backup"`
+	Recovery                  recovery.Config     `yaml:"recovery"`
+	Health                    health.Config       `yaml:"health"`
+	Healing                   selfhealing.Config  `yaml:"healing"`
+	Approvals                 approval.Config     `yaml:"approvals"`
+	Resilience                ResilienceConfig    `yaml:"resilience"`
+	Degradation               DegradationConfig   `yaml:"degradation"`
+	Faults                    faults.Config       `yaml:"faults"`
+}
+
+// EventsConfig controls the lifecycle event stream served at /admin/events.
+type EventsConfig struct {
+	BufferSize int `yaml:"buffer_size"` // retained events, defaults to DefaultEventBufferSize
 }
 
 type Runtime struct {
@@ -88,6 +119,22 @@ type Runtime struct {
 	adminTLSClientCA          string
 	adminTLSRequireClientCert bool
 	auditLogger               *AuditLogger
+	metrics                   *metrics.Metrics
+	events                    *EventBus
+	fleet                     *fleet.Aggregator
+	alerts                    *alerting.Engine
+	rollout                   *update.Rollout
+	transfer                  *transfer.Transfer
+	patches                   *patch.PatchManager
+	backups                   *backup.BackupManager
+	backupMirror              *backup.MirrorTarget // set when remote backup targets are configured
+	backupPeers               *backup.PeerHost
+	p2pRecovery               *recovery.P2PRecoveryManager
+	healing                   *selfhealing.HealingFramework
+	approvals                 *approval.Queue
+	shedder                   *loadShedder
+	state                     *store.Store
+	tracingShutdown           tracing.ShutdownFunc
 	antiTamper                *obfuscation.AntiTampering
 	binaryPath                string
 	controlPlane              *controlplane.ControlPlane
@@ -126,6 +173,18 @@ func (rt *Runtime) sanitizedConfig() *Config {
 	c.AdminTLSCertPath = ""
 	c.AdminTLSKeyPath = ""
 	c.AdminTLSClientCA = ""
+	if len(c.Alerting.Receivers) > 0 {
+		// Webhook headers and Slack URLs carry credentials.
+		receivers := make([]alerting.ReceiverConfig, len(c.Alerting.Receivers))
+		for i, rc := range c.Alerting.Receivers {
+			rc.Headers = nil
+			if rc.Type == alerting.ReceiverSlack {
+				rc.URL = ""
+			}
+			receivers[i] = rc
+		}
+		c.Alerting.Receivers = receivers
+	}
 	return &c
 }
 
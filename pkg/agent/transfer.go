@@ -0,0 +1,54 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/naviNBRuas/APA/pkg/networking"
+)
+
+var errNoModuleContent = errors.New("module announced without chunked content")
+
+// publishModule stores a loaded module's wasm bytes for chunked transfer and
+// returns the content root to announce, or "" when transfer is disabled or
+// publishing failed.
+func (rt *Runtime) publishModule(manifest module.Manifest) string {
+	if rt.transfer == nil {
+		return ""
+	}
+	_, wasm, err := rt.moduleManager.GetModuleData(manifest.Name, manifest.Version)
+	if err != nil {
+		rt.logger.Warn("Failed to read module for publishing", "name", manifest.Name, "error", err)
+		return ""
+	}
+	ctx := rt.runCtx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m, err := rt.transfer.Publish(ctx, fmt.Sprintf("module %s %s", manifest.Name, manifest.Version), wasm)
+	if err != nil {
+		rt.logger.Warn("Failed to publish module", "name", manifest.Name, "error", err)
+		return ""
+	}
+	return m.Root
+}
+
+// fetchModuleContent fetches an announced module in chunks from the announcer
+// and every other provider. The wasm hash is verified against the manifest
+// when the module is loaded.
+func (rt *Runtime) fetchModuleContent(ctx context.Context, announcer peer.ID, announcement networking.ModuleAnnouncementMessage) (*module.Manifest, []byte, error) {
+	if rt.transfer == nil || announcement.Content == "" {
+		return nil, nil, errNoModuleContent
+	}
+	wasm, err := rt.transfer.Fetch(ctx, announcement.Content, announcer)
+	if err != nil {
+		rt.logger.Warn("Chunked module fetch failed, requesting it from the announcer", "name", announcement.Manifest.Name, "error", err)
+		return nil, nil, err
+	}
+	manifest := announcement.Manifest
+	return &manifest, wasm, nil
+}
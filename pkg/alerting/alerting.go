@@ -0,0 +1,767 @@
+// Package alerting evaluates alert rules against the agent's Prometheus
+// registry and lifecycle events, and delivers grouped, deduplicated
+// notifications to webhook, Slack-compatible, SMTP and file receivers.
+//
+// Alerts can also be raised directly by subsystems (EDR responses, the
+// robustness health monitor) through the Sink interface; they share the same
+// silencing, grouping and routing as rule-based alerts.
+package alerting
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Rule kinds accepted in Rule.Kind.
+const (
+	KindThreshold = "threshold" // metric value compared with Value
+	KindRate      = "rate"      // per-second increase of a metric over Window
+	KindAbsence   = "absence"   // metric series missing, or no matching event within Window
+	KindEvent     = "event"     // number of matching events within Window
+)
+
+// Alert severities.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Alert states.
+const (
+	StatePending  = "pending"
+	StateFiring   = "firing"
+	StateResolved = "resolved"
+)
+
+// Labels added to every alert.
+const (
+	LabelAlertName = "alertname"
+	LabelSeverity  = "severity"
+)
+
+const (
+	defaultEvaluationInterval = 15 * time.Second
+	defaultRepeatInterval     = 4 * time.Hour
+	defaultResolveTimeout     = 5 * time.Minute
+	defaultWindow             = 5 * time.Minute
+	maxRetainedEvents         = 10000
+)
+
+// Config holds the alerting configuration.
+type Config struct {
+	Enabled            bool             `yaml:"enabled"`
+	EvaluationInterval time.Duration    `yaml:"evaluation_interval"` // defaults to 15s
+	RepeatInterval     time.Duration    `yaml:"repeat_interval"`     // re-notify still-firing alerts, defaults to 4h
+	ResolveTimeout     time.Duration    `yaml:"resolve_timeout"`     // raised alerts resolve when not raised again, defaults to 5m
+	GroupBy            []string         `yaml:"group_by"`            // defaults to [alertname]
+	DefaultReceiver    string           `yaml:"default_receiver"`
+	Routes             []Route          `yaml:"routes"`
+	Receivers          []ReceiverConfig `yaml:"receivers"`
+	Rules              []Rule           `yaml:"rules"`
+}
+
+// WithDefaults fills unset intervals.
+func (c Config) WithDefaults() Config {
+	if c.EvaluationInterval <= 0 {
+		c.EvaluationInterval = defaultEvaluationInterval
+	}
+	if c.RepeatInterval <= 0 {
+		c.RepeatInterval = defaultRepeatInterval
+	}
+	if c.ResolveTimeout <= 0 {
+		c.ResolveTimeout = defaultResolveTimeout
+	}
+	if len(c.GroupBy) == 0 {
+		c.GroupBy = []string{LabelAlertName}
+	}
+	return c
+}
+
+// Validate checks rules, routes and receivers for consistency.
+func (c Config) Validate() error {
+	receivers := make(map[string]bool, len(c.Receivers))
+	for _, r := range c.Receivers {
+		if r.Name == "" {
+			return fmt.Errorf("alerting receiver without name")
+		}
+		if receivers[r.Name] {
+			return fmt.Errorf("duplicate alerting receiver %q", r.Name)
+		}
+		receivers[r.Name] = true
+	}
+	if c.DefaultReceiver != "" && !receivers[c.DefaultReceiver] {
+		return fmt.Errorf("unknown default alerting receiver %q", c.DefaultReceiver)
+	}
+	for i, route := range c.Routes {
+		if !receivers[route.Receiver] {
+			return fmt.Errorf("alerting route %d references unknown receiver %q", i, route.Receiver)
+		}
+	}
+
+	names := make(map[string]bool, len(c.Rules))
+	for _, rule := range c.Rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate alert rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return nil
+}
+
+// Rule describes a condition that raises an alert once it has held for For.
+type Rule struct {
+	Name     string            `yaml:"name"`
+	Kind     string            `yaml:"kind"`     // threshold | rate | absence | event
+	Metric   string            `yaml:"metric"`   // metric family; histograms expose <name>_count and <name>_sum
+	Match    map[string]string `yaml:"match"`    // metric label matchers, "prefix*" allowed
+	Event    string            `yaml:"event"`    // event type for event and absence rules, "prefix.*" allowed
+	Op       string            `yaml:"op"`       // > >= < <= == !=, defaults to >
+	Value    float64           `yaml:"value"`    // threshold compared with the metric value, rate or event count
+	Window   time.Duration     `yaml:"window"`   // rate, absence and event window, defaults to 5m
+	For      time.Duration     `yaml:"for"`      // how long the condition must hold before firing
+	Severity string            `yaml:"severity"` // info | warning | critical, defaults to warning
+	Summary  string            `yaml:"summary"`
+	Labels   map[string]string `yaml:"labels"` // extra labels attached to the alert
+}
+
+func (r Rule) validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("alert rule without name")
+	}
+	switch r.Kind {
+	case KindThreshold, KindRate:
+		if r.Metric == "" {
+			return fmt.Errorf("alert rule %q: %s rules require a metric", r.Name, r.Kind)
+		}
+	case KindAbsence:
+		if (r.Metric == "") == (r.Event == "") {
+			return fmt.Errorf("alert rule %q: absence rules require exactly one of metric or event", r.Name)
+		}
+	case KindEvent:
+		if r.Event == "" {
+			return fmt.Errorf("alert rule %q: event rules require an event type", r.Name)
+		}
+	default:
+		return fmt.Errorf("alert rule %q: unknown kind %q", r.Name, r.Kind)
+	}
+	if _, ok := comparators[r.op()]; !ok {
+		return fmt.Errorf("alert rule %q: unknown operator %q", r.Name, r.Op)
+	}
+	switch r.Severity {
+	case "", SeverityInfo, SeverityWarning, SeverityCritical:
+	default:
+		return fmt.Errorf("alert rule %q: unknown severity %q", r.Name, r.Severity)
+	}
+	return nil
+}
+
+func (r Rule) op() string {
+	if r.Op == "" {
+		return ">"
+	}
+	return r.Op
+}
+
+func (r Rule) window() time.Duration {
+	if r.Window <= 0 {
+		return defaultWindow
+	}
+	return r.Window
+}
+
+func (r Rule) severity() string {
+	if r.Severity == "" {
+		return SeverityWarning
+	}
+	return r.Severity
+}
+
+// Route sends alerts whose labels match to a receiver. Routes are tried in
+// order; the first match wins unless Continue is set.
+type Route struct {
+	Receiver string            `yaml:"receiver"`
+	Match    map[string]string `yaml:"match"`    // label matchers, "prefix*" allowed
+	GroupBy  []string          `yaml:"group_by"` // overrides Config.GroupBy
+	Continue bool              `yaml:"continue"`
+}
+
+// Alert is a single alert instance identified by its labels.
+type Alert struct {
+	Fingerprint string            `json:"fingerprint"`
+	Name        string            `json:"name"`
+	Labels      map[string]string `json:"labels"`
+	Severity    string            `json:"severity"`
+	Summary     string            `json:"summary,omitempty"`
+	Value       float64           `json:"value"`
+	State       string            `json:"state"`
+	Silenced    bool              `json:"silenced"`
+	ActiveSince time.Time         `json:"active_since"`
+	ResolvedAt  *time.Time        `json:"resolved_at,omitempty"`
+}
+
+// Sink accepts alerts raised outside the rule engine. A raised alert fires
+// immediately and resolves once it has not been raised again for
+// Config.ResolveTimeout.
+type Sink interface {
+	Raise(alert Alert)
+}
+
+// Silence mutes notifications for alerts whose labels match every matcher
+// until EndsAt.
+type Silence struct {
+	ID        string            `json:"id"`
+	Matchers  map[string]string `json:"matchers"`
+	StartsAt  time.Time         `json:"starts_at"`
+	EndsAt    time.Time         `json:"ends_at"`
+	CreatedBy string            `json:"created_by,omitempty"`
+	Comment   string            `json:"comment,omitempty"`
+}
+
+func (s Silence) active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+type alertState struct {
+	alert        Alert
+	raised       bool
+	lastSeen     time.Time
+	lastNotified time.Time
+}
+
+type point struct {
+	at    time.Time
+	value float64
+}
+
+type eventSample struct {
+	at      time.Time
+	typ     string
+	subject string
+}
+
+// Engine evaluates rules, tracks alert state and dispatches notifications.
+type Engine struct {
+	logger    *slog.Logger
+	cfg       Config
+	gatherer  prometheus.Gatherer
+	notifiers map[string]Notifier
+	receivers map[string]ReceiverConfig
+	now       func() time.Time
+	started   time.Time
+	maxWindow time.Duration
+
+	mu          sync.Mutex
+	alerts      map[string]*alertState
+	history     map[string][]point
+	events      []eventSample
+	silences    map[string]Silence
+	nextSilence int
+}
+
+// NewEngine validates cfg, builds its receivers and returns an engine that
+// reads metrics from gatherer (which may be nil when only event rules are used).
+func NewEngine(logger *slog.Logger, cfg Config, gatherer prometheus.Gatherer) (*Engine, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	cfg = cfg.WithDefaults()
+
+	e := &Engine{
+		logger:    logger,
+		cfg:       cfg,
+		gatherer:  gatherer,
+		notifiers: make(map[string]Notifier, len(cfg.Receivers)),
+		receivers: make(map[string]ReceiverConfig, len(cfg.Receivers)),
+		now:       time.Now,
+		alerts:    make(map[string]*alertState),
+		history:   make(map[string][]point),
+		silences:  make(map[string]Silence),
+	}
+	e.started = e.now()
+	for _, rc := range cfg.Receivers {
+		n, err := NewNotifier(rc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create alerting receiver %q: %w", rc.Name, err)
+		}
+		e.notifiers[rc.Name] = n
+		e.receivers[rc.Name] = rc
+	}
+	for _, rule := range cfg.Rules {
+		if (rule.Kind == KindEvent || rule.Event != "") && rule.window() > e.maxWindow {
+			e.maxWindow = rule.window()
+		}
+	}
+	return e, nil
+}
+
+// SetNotifier replaces (or adds) the notifier used for receiver name.
+func (e *Engine) SetNotifier(name string, n Notifier) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.notifiers[name] = n
+	if _, ok := e.receivers[name]; !ok {
+		e.receivers[name] = ReceiverConfig{Name: name}
+	}
+}
+
+// Run evaluates rules every EvaluationInterval until ctx is cancelled.
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.cfg.EvaluationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Evaluate(ctx); err != nil {
+				e.logger.Warn("Alert evaluation failed", "error", err)
+			}
+		}
+	}
+}
+
+// ObserveEvent records a lifecycle event for event and absence rules.
+func (e *Engine) ObserveEvent(at time.Time, eventType, subject string) {
+	if e.maxWindow == 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, eventSample{at: at, typ: eventType, subject: subject})
+	if len(e.events) > maxRetainedEvents {
+		e.events = e.events[len(e.events)-maxRetainedEvents:]
+	}
+}
+
+// Raise records an externally raised alert; see Sink.
+func (e *Engine) Raise(alert Alert) {
+	if alert.Name == "" {
+		return
+	}
+	if alert.Severity == "" {
+		alert.Severity = SeverityWarning
+	}
+	now := e.now()
+	alert.Labels = alertLabels(alert.Name, alert.Severity, alert.Labels)
+	alert.Fingerprint = fingerprint(alert.Labels)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if st, ok := e.alerts[alert.Fingerprint]; ok && st.alert.State == StateFiring {
+		st.lastSeen = now
+		st.alert.Summary = alert.Summary
+		st.alert.Value = alert.Value
+		return
+	}
+	alert.State = StateFiring
+	alert.ActiveSince = now
+	alert.ResolvedAt = nil
+	e.alerts[alert.Fingerprint] = &alertState{alert: alert, raised: true, lastSeen: now}
+}
+
+// Alerts returns the pending and firing alerts sorted by name and fingerprint.
+func (e *Engine) Alerts() []Alert {
+	now := e.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Alert, 0, len(e.alerts))
+	for _, st := range e.alerts {
+		if st.alert.State == StateResolved {
+			continue
+		}
+		a := st.alert
+		a.Silenced = e.silencedLocked(a.Labels, now)
+		out = append(out, a)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// AddSilence registers a silence. StartsAt defaults to now; EndsAt must be
+// in the future and at least one matcher is required.
+func (e *Engine) AddSilence(s Silence) (Silence, error) {
+	now := e.now()
+	if len(s.Matchers) == 0 {
+		return Silence{}, fmt.Errorf("silence requires at least one matcher")
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if !s.EndsAt.After(now) || !s.EndsAt.After(s.StartsAt) {
+		return Silence{}, fmt.Errorf("silence must end in the future and after it starts")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextSilence++
+	s.ID = strconv.Itoa(e.nextSilence)
+	e.silences[s.ID] = s
+	return s, nil
+}
+
+// ExpireSilence removes the silence with the given ID.
+func (e *Engine) ExpireSilence(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.silences[id]; !ok {
+		return fmt.Errorf("silence %s not found", id)
+	}
+	delete(e.silences, id)
+	return nil
+}
+
+// Silences returns the silences that have not ended, ordered by ID.
+func (e *Engine) Silences() []Silence {
+	now := e.now()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Silence, 0, len(e.silences))
+	for id, s := range e.silences {
+		if !now.Before(s.EndsAt) {
+			delete(e.silences, id)
+			continue
+		}
+		out = append(out, s)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, _ := strconv.Atoi(out[i].ID)
+		b, _ := strconv.Atoi(out[j].ID)
+		return a < b
+	})
+	return out
+}
+
+func (e *Engine) silencedLocked(labels map[string]string, now time.Time) bool {
+	for _, s := range e.silences {
+		if s.active(now) && matchLabels(s.Matchers, labels) {
+			return true
+		}
+	}
+	return false
+}
+
+// Evaluate runs every rule once, updates alert state and sends the resulting
+// notifications. It returns an error only when metrics could not be gathered.
+func (e *Engine) Evaluate(ctx context.Context) error {
+	now := e.now()
+
+	var samples map[string][]sample
+	var gatherErr error
+	if e.gatherer != nil && e.hasMetricRules() {
+		samples, gatherErr = gatherSamples(e.gatherer)
+	}
+
+	e.mu.Lock()
+	e.pruneEventsLocked(now)
+	for _, rule := range e.cfg.Rules {
+		if rule.Metric != "" && samples == nil {
+			// Leave metric alerts untouched when the registry is unavailable.
+			continue
+		}
+		active := e.evaluateRuleLocked(rule, samples, now)
+		e.transitionLocked(rule, active, now)
+	}
+	for fp, st := range e.alerts {
+		if st.raised && st.alert.State == StateFiring && now.Sub(st.lastSeen) > e.cfg.ResolveTimeout {
+			e.resolveLocked(fp, now)
+		}
+	}
+	batches := e.collectLocked(now)
+	e.mu.Unlock()
+
+	e.dispatch(ctx, batches)
+	if gatherErr != nil {
+		return fmt.Errorf("failed to gather metrics: %w", gatherErr)
+	}
+	return nil
+}
+
+func (e *Engine) hasMetricRules() bool {
+	for _, r := range e.cfg.Rules {
+		if r.Metric != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionLocked moves the alerts of rule between pending, firing and
+// resolved according to the instances active in this evaluation.
+func (e *Engine) transitionLocked(rule Rule, active []instance, now time.Time) {
+	seen := make(map[string]bool, len(active))
+	for _, inst := range active {
+		labels := alertLabels(rule.Name, rule.severity(), mergeLabels(rule.Labels, inst.labels))
+		fp := fingerprint(labels)
+		seen[fp] = true
+
+		st, ok := e.alerts[fp]
+		if !ok || st.alert.State == StateResolved {
+			st = &alertState{alert: Alert{
+				Fingerprint: fp,
+				Name:        rule.Name,
+				Labels:      labels,
+				Severity:    rule.severity(),
+				State:       StatePending,
+				ActiveSince: now,
+			}}
+			e.alerts[fp] = st
+		}
+		st.alert.Value = inst.value
+		st.alert.Summary = expandSummary(rule.Summary, labels, inst.value)
+		st.lastSeen = now
+		if st.alert.State == StatePending && now.Sub(st.alert.ActiveSince) >= rule.For {
+			st.alert.State = StateFiring
+		}
+	}
+
+	for fp, st := range e.alerts {
+		if st.raised || st.alert.Name != rule.Name || seen[fp] {
+			continue
+		}
+		switch st.alert.State {
+		case StatePending:
+			delete(e.alerts, fp)
+		case StateFiring:
+			e.resolveLocked(fp, now)
+		}
+	}
+}
+
+func (e *Engine) resolveLocked(fp string, now time.Time) {
+	st := e.alerts[fp]
+	resolvedAt := now
+	st.alert.State = StateResolved
+	st.alert.ResolvedAt = &resolvedAt
+}
+
+type batchKey struct {
+	receiver string
+	group    string
+}
+
+type batch struct {
+	notification *Notification
+	fps          []string
+}
+
+// collectLocked selects the alerts due for notification, routes them to
+// receivers and groups them. Firing alerts are sent once and then again
+// every RepeatInterval; resolved alerts are sent once (to receivers with
+// SendResolved) and then forgotten.
+func (e *Engine) collectLocked(now time.Time) []*batch {
+	groups := make(map[batchKey]*batch)
+	var order []batchKey
+
+	for fp, st := range e.alerts {
+		a := st.alert
+		silenced := e.silencedLocked(a.Labels, now)
+		var due bool
+		switch a.State {
+		case StateFiring:
+			due = !silenced && (st.lastNotified.IsZero() || now.Sub(st.lastNotified) >= e.cfg.RepeatInterval)
+		case StateResolved:
+			due = !silenced && !st.lastNotified.IsZero()
+			delete(e.alerts, fp)
+		}
+		if !due {
+			continue
+		}
+		if a.State == StateFiring {
+			st.lastNotified = now
+		}
+
+		for _, rt := range e.routesFor(a.Labels) {
+			if a.State == StateResolved && !e.receivers[rt.Receiver].SendResolved {
+				continue
+			}
+			groupLabels := make(map[string]string, len(rt.groupBy))
+			for _, l := range rt.groupBy {
+				groupLabels[l] = a.Labels[l]
+			}
+			key := batchKey{receiver: rt.Receiver, group: labelString(groupLabels)}
+			b, ok := groups[key]
+			if !ok {
+				b = &batch{notification: &Notification{
+					Receiver:    rt.Receiver,
+					GroupKey:    key.group,
+					GroupLabels: groupLabels,
+				}}
+				groups[key] = b
+				order = append(order, key)
+			}
+			b.notification.Alerts = append(b.notification.Alerts, a)
+			if a.State == StateFiring {
+				b.fps = append(b.fps, fp)
+			}
+		}
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].receiver != order[j].receiver {
+			return order[i].receiver < order[j].receiver
+		}
+		return order[i].group < order[j].group
+	})
+	out := make([]*batch, 0, len(order))
+	for _, key := range order {
+		b := groups[key]
+		n := b.notification
+		sort.Slice(n.Alerts, func(i, j int) bool { return n.Alerts[i].Fingerprint < n.Alerts[j].Fingerprint })
+		n.Status = StateResolved
+		for _, a := range n.Alerts {
+			if a.State == StateFiring {
+				n.Status = StateFiring
+				break
+			}
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+type resolvedRoute struct {
+	Receiver string
+	groupBy  []string
+}
+
+func (e *Engine) routesFor(labels map[string]string) []resolvedRoute {
+	var out []resolvedRoute
+	for _, r := range e.cfg.Routes {
+		if !matchLabels(r.Match, labels) {
+			continue
+		}
+		groupBy := r.GroupBy
+		if len(groupBy) == 0 {
+			groupBy = e.cfg.GroupBy
+		}
+		out = append(out, resolvedRoute{Receiver: r.Receiver, groupBy: groupBy})
+		if !r.Continue {
+			return out
+		}
+	}
+	if len(out) == 0 && e.cfg.DefaultReceiver != "" {
+		out = append(out, resolvedRoute{Receiver: e.cfg.DefaultReceiver, groupBy: e.cfg.GroupBy})
+	}
+	return out
+}
+
+// dispatch sends each batch outside the engine lock. When delivery fails the
+// firing alerts in the batch are marked un-notified so the next evaluation
+// retries them.
+func (e *Engine) dispatch(ctx context.Context, batches []*batch) {
+	for _, b := range batches {
+		e.mu.Lock()
+		n, ok := e.notifiers[b.notification.Receiver]
+		e.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		err := n.Notify(ctx, b.notification)
+		if err == nil {
+			e.logger.Info("Alert notification sent", "receiver", b.notification.Receiver, "group", b.notification.GroupKey, "status", b.notification.Status, "alerts", len(b.notification.Alerts))
+			continue
+		}
+		e.logger.Error("Failed to send alert notification", "receiver", b.notification.Receiver, "group", b.notification.GroupKey, "error", err)
+		e.mu.Lock()
+		for _, fp := range b.fps {
+			if st, ok := e.alerts[fp]; ok {
+				st.lastNotified = time.Time{}
+			}
+		}
+		e.mu.Unlock()
+	}
+}
+
+func alertLabels(name, severity string, extra map[string]string) map[string]string {
+	labels := make(map[string]string, len(extra)+2)
+	for k, v := range extra {
+		labels[k] = v
+	}
+	labels[LabelAlertName] = name
+	labels[LabelSeverity] = severity
+	return labels
+}
+
+func mergeLabels(a, b map[string]string) map[string]string {
+	out := make(map[string]string, len(a)+len(b))
+	for k, v := range a {
+		out[k] = v
+	}
+	for k, v := range b {
+		out[k] = v
+	}
+	return out
+}
+
+// labelString renders labels as a stable, sorted k="v" list.
+func labelString(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strconv.Quote(labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func fingerprint(labels map[string]string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(labelString(labels)))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// matchLabels reports whether labels satisfy every matcher. A matcher value
+// ending in "*" matches by prefix.
+func matchLabels(matchers, labels map[string]string) bool {
+	for k, want := range matchers {
+		got, ok := labels[k]
+		if !ok {
+			return false
+		}
+		if prefix, wildcard := strings.CutSuffix(want, "*"); wildcard {
+			if !strings.HasPrefix(got, prefix) {
+				return false
+			}
+		} else if got != want {
+			return false
+		}
+	}
+	return true
+}
+
+// expandSummary replaces {{value}} and {{labels.<name>}} in a rule summary.
+func expandSummary(summary string, labels map[string]string, value float64) string {
+	if !strings.Contains(summary, "{{") {
+		return summary
+	}
+	out := strings.ReplaceAll(summary, "{{value}}", strconv.FormatFloat(value, 'g', 6, 64))
+	for k, v := range labels {
+		out = strings.ReplaceAll(out, "{{labels."+k+"}}", v)
+	}
+	return out
+}
@@ -0,0 +1,267 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []*Notification
+	err  error
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, n *Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.sent = append(r.sent, n)
+	return nil
+}
+
+func (r *recordingNotifier) take() []*Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := r.sent
+	r.sent = nil
+	return out
+}
+
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestEngine(t *testing.T, cfg Config, g prometheus.Gatherer) (*Engine, *recordingNotifier, *testClock) {
+	t.Helper()
+	if cfg.DefaultReceiver == "" {
+		cfg.Receivers = append(cfg.Receivers, ReceiverConfig{Name: "rec", Type: ReceiverFile, Path: t.TempDir() + "/alerts.jsonl", SendResolved: true})
+		cfg.DefaultReceiver = "rec"
+	}
+	e, err := NewEngine(nil, cfg, g)
+	require.NoError(t, err)
+	clock := &testClock{t: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	e.now = clock.now
+	e.started = clock.t
+	rec := &recordingNotifier{}
+	e.SetNotifier(cfg.DefaultReceiver, rec)
+	return e, rec, clock
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.Error(t, Config{Rules: []Rule{{Name: "x", Kind: "bogus"}}}.Validate())
+	require.Error(t, Config{Rules: []Rule{{Name: "x", Kind: KindThreshold}}}.Validate())
+	require.Error(t, Config{Rules: []Rule{{Name: "x", Kind: KindAbsence, Metric: "m", Event: "e"}}}.Validate())
+	require.Error(t, Config{Rules: []Rule{{Name: "x", Kind: KindThreshold, Metric: "m", Op: "=~"}}}.Validate())
+	require.Error(t, Config{Routes: []Route{{Receiver: "missing"}}}.Validate())
+	require.Error(t, Config{Rules: []Rule{{Name: "x", Kind: KindEvent, Event: "a"}, {Name: "x", Kind: KindEvent, Event: "b"}}}.Validate())
+	require.NoError(t, Config{Rules: []Rule{{Name: "x", Kind: KindRate, Metric: "m", Op: ">=", Value: 1}}}.Validate())
+}
+
+func TestThresholdRuleForDurationAndDedup(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	peers := prometheus.NewGauge(prometheus.GaugeOpts{Name: "apa_peers"})
+	reg.MustRegister(peers)
+
+	e, rec, clock := newTestEngine(t, Config{
+		RepeatInterval: time.Hour,
+		Rules: []Rule{{
+			Name: "NoPeers", Kind: KindThreshold, Metric: "apa_peers", Op: "<", Value: 1,
+			For: time.Minute, Severity: SeverityCritical, Summary: "only {{value}} peers",
+		}},
+	}, reg)
+	ctx := context.Background()
+
+	require.NoError(t, e.Evaluate(ctx))
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, StatePending, alerts[0].State)
+	require.Empty(t, rec.take())
+
+	clock.advance(time.Minute)
+	require.NoError(t, e.Evaluate(ctx))
+	sent := rec.take()
+	require.Len(t, sent, 1)
+	require.Equal(t, StateFiring, sent[0].Status)
+	require.Equal(t, "[FIRING:1] NoPeers", sent[0].Title())
+	require.Equal(t, "only 0 peers", sent[0].Alerts[0].Summary)
+	require.Equal(t, SeverityCritical, sent[0].Alerts[0].Labels[LabelSeverity])
+
+	// Still firing: deduplicated until the repeat interval passes.
+	clock.advance(10 * time.Minute)
+	require.NoError(t, e.Evaluate(ctx))
+	require.Empty(t, rec.take())
+	clock.advance(time.Hour)
+	require.NoError(t, e.Evaluate(ctx))
+	require.Len(t, rec.take(), 1)
+
+	peers.Set(3)
+	require.NoError(t, e.Evaluate(ctx))
+	sent = rec.take()
+	require.Len(t, sent, 1)
+	require.Equal(t, StateResolved, sent[0].Status)
+	require.NotNil(t, sent[0].Alerts[0].ResolvedAt)
+	require.Empty(t, e.Alerts())
+}
+
+func TestPendingAlertClearsWithoutNotification(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGauge(prometheus.GaugeOpts{Name: "load"})
+	reg.MustRegister(g)
+	g.Set(10)
+
+	e, rec, clock := newTestEngine(t, Config{
+		Rules: []Rule{{Name: "HighLoad", Kind: KindThreshold, Metric: "load", Value: 5, For: time.Minute}},
+	}, reg)
+	require.NoError(t, e.Evaluate(context.Background()))
+	g.Set(1)
+	clock.advance(2 * time.Minute)
+	require.NoError(t, e.Evaluate(context.Background()))
+	require.Empty(t, e.Alerts())
+	require.Empty(t, rec.take())
+}
+
+func TestRateRulePerSeries(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	failures := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "apa_module_failures_total"}, []string{"module"})
+	reg.MustRegister(failures)
+	failures.WithLabelValues("a").Add(0)
+	failures.WithLabelValues("b").Add(0)
+
+	e, rec, clock := newTestEngine(t, Config{
+		Rules: []Rule{{Name: "ModuleFailing", Kind: KindRate, Metric: "apa_module_failures_total", Value: 0.5, Window: time.Minute}},
+	}, reg)
+	ctx := context.Background()
+
+	require.NoError(t, e.Evaluate(ctx))
+	clock.advance(10 * time.Second)
+	failures.WithLabelValues("a").Add(20)
+	failures.WithLabelValues("b").Add(1)
+	require.NoError(t, e.Evaluate(ctx))
+
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	require.Equal(t, "a", alerts[0].Labels["module"])
+	require.InDelta(t, 2.0, alerts[0].Value, 0.001)
+	require.Len(t, rec.take(), 1)
+}
+
+func TestAbsenceAndEventRules(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	e, rec, clock := newTestEngine(t, Config{
+		Rules: []Rule{
+			{Name: "NoUpdateCheck", Kind: KindAbsence, Metric: "apa_update_checks_total"},
+			{Name: "NoPeers", Kind: KindAbsence, Event: "peer.*", Window: time.Minute},
+			{Name: "ControllerCrashLoop", Kind: KindEvent, Event: "controller.crashed", Op: ">=", Value: 3, Window: time.Minute},
+		},
+	}, reg)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		e.ObserveEvent(clock.t, "controller.crashed", "ctrl-a")
+	}
+	e.ObserveEvent(clock.t, "controller.crashed", "ctrl-b")
+	require.NoError(t, e.Evaluate(ctx))
+
+	names := map[string]Alert{}
+	for _, a := range e.Alerts() {
+		names[a.Name] = a
+	}
+	require.Contains(t, names, "NoUpdateCheck")
+	require.NotContains(t, names, "NoPeers", "absence windows start at engine start")
+	require.Equal(t, "ctrl-a", names["ControllerCrashLoop"].Labels["subject"])
+	rec.take()
+
+	clock.advance(2 * time.Minute)
+	require.NoError(t, e.Evaluate(ctx))
+	names = map[string]Alert{}
+	for _, a := range e.Alerts() {
+		names[a.Name] = a
+	}
+	require.Contains(t, names, "NoPeers")
+	require.NotContains(t, names, "ControllerCrashLoop", "events age out of the window")
+
+	e.ObserveEvent(clock.t, "peer.joined", "p1")
+	require.NoError(t, e.Evaluate(ctx))
+	for _, a := range e.Alerts() {
+		require.NotEqual(t, "NoPeers", a.Name)
+	}
+}
+
+func TestSilencesSuppressNotifications(t *testing.T) {
+	e, rec, clock := newTestEngine(t, Config{}, nil)
+	ctx := context.Background()
+
+	_, err := e.AddSilence(Silence{Matchers: map[string]string{"source": "edr*"}, EndsAt: clock.t})
+	require.Error(t, err)
+	s, err := e.AddSilence(Silence{Matchers: map[string]string{"source": "edr*"}, EndsAt: clock.t.Add(time.Hour), Comment: "maintenance"})
+	require.NoError(t, err)
+
+	e.Raise(Alert{Name: "ProcessTerminated", Severity: SeverityCritical, Labels: map[string]string{"source": "edr-response"}})
+	require.NoError(t, e.Evaluate(ctx))
+	require.Empty(t, rec.take())
+	alerts := e.Alerts()
+	require.Len(t, alerts, 1)
+	require.True(t, alerts[0].Silenced)
+
+	require.NoError(t, e.ExpireSilence(s.ID))
+	require.Error(t, e.ExpireSilence(s.ID))
+	require.NoError(t, e.Evaluate(ctx))
+	require.Len(t, rec.take(), 1)
+	require.Empty(t, e.Silences())
+}
+
+func TestGroupingAndRouting(t *testing.T) {
+	e, rec, _ := newTestEngine(t, Config{
+		GroupBy: []string{LabelAlertName},
+		Routes: []Route{
+			{Receiver: "pager", Match: map[string]string{LabelSeverity: SeverityCritical}, Continue: true},
+			{Receiver: "rec", Match: map[string]string{LabelAlertName: "*"}},
+		},
+		Receivers: []ReceiverConfig{{Name: "pager", Type: ReceiverWebhook, URL: "http://127.0.0.1:1/"}},
+	}, nil)
+	pager := &recordingNotifier{}
+	e.SetNotifier("pager", pager)
+
+	e.Raise(Alert{Name: "Tamper", Severity: SeverityCritical, Labels: map[string]string{"node": "a"}})
+	e.Raise(Alert{Name: "Tamper", Severity: SeverityCritical, Labels: map[string]string{"node": "b"}})
+	e.Raise(Alert{Name: "Slow", Severity: SeverityWarning})
+	require.NoError(t, e.Evaluate(context.Background()))
+
+	paged := pager.take()
+	require.Len(t, paged, 1)
+	require.Len(t, paged[0].Alerts, 2)
+	require.Equal(t, map[string]string{LabelAlertName: "Tamper"}, paged[0].GroupLabels)
+
+	sent := rec.take()
+	require.Len(t, sent, 2)
+	require.Equal(t, "Slow", sent[0].GroupLabels[LabelAlertName])
+	require.Equal(t, "Tamper", sent[1].GroupLabels[LabelAlertName])
+}
+
+func TestRaisedAlertsResolveAndFailedDeliveryRetries(t *testing.T) {
+	e, rec, clock := newTestEngine(t, Config{ResolveTimeout: time.Minute}, nil)
+	ctx := context.Background()
+
+	rec.err = errors.New("unreachable")
+	e.Raise(Alert{Name: "Quarantined"})
+	require.NoError(t, e.Evaluate(ctx))
+	rec.err = nil
+	require.NoError(t, e.Evaluate(ctx))
+	require.Len(t, rec.take(), 1, "failed delivery is retried on the next evaluation")
+
+	clock.advance(2 * time.Minute)
+	require.NoError(t, e.Evaluate(ctx))
+	sent := rec.take()
+	require.Len(t, sent, 1)
+	require.Equal(t, StateResolved, sent[0].Status)
+	require.Empty(t, e.Alerts())
+}
@@ -0,0 +1,284 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Receiver types accepted in ReceiverConfig.Type.
+const (
+	ReceiverWebhook = "webhook"
+	ReceiverSlack   = "slack"
+	ReceiverEmail   = "email"
+	ReceiverFile    = "file"
+)
+
+const defaultNotifyTimeout = 10 * time.Second
+
+// ReceiverConfig describes a notification backend.
+type ReceiverConfig struct {
+	Name            string            `yaml:"name"`
+	Type            string            `yaml:"type"`              // webhook | slack | email | file
+	URL             string            `yaml:"url"`               // webhook and slack endpoint
+	Headers         map[string]string `yaml:"headers"`           // extra webhook request headers
+	Channel         string            `yaml:"channel"`           // slack channel override
+	SMTPAddress     string            `yaml:"smtp_address"`      // email relay host:port
+	SMTPUsername    string            `yaml:"smtp_username"`     // enables PLAIN auth when set
+	SMTPPasswordEnv string            `yaml:"smtp_password_env"` // environment variable holding the SMTP password
+	From            string            `yaml:"from"`
+	To              []string          `yaml:"to"`
+	Path            string            `yaml:"path"`    // file receiver destination (JSON lines)
+	Timeout         time.Duration     `yaml:"timeout"` // defaults to 10s
+	SendResolved    bool              `yaml:"send_resolved"`
+}
+
+// Notification is a group of alerts delivered to one receiver.
+type Notification struct {
+	Receiver    string            `json:"receiver"`
+	Status      string            `json:"status"` // firing | resolved
+	GroupKey    string            `json:"group_key"`
+	GroupLabels map[string]string `json:"group_labels"`
+	Alerts      []Alert           `json:"alerts"`
+}
+
+// Title is a one-line description such as "[FIRING:2] HighErrorRate".
+func (n *Notification) Title() string {
+	names := make([]string, 0, len(n.GroupLabels))
+	keys := make([]string, 0, len(n.GroupLabels))
+	for k := range n.GroupLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v := n.GroupLabels[k]; v != "" {
+			names = append(names, v)
+		}
+	}
+	return fmt.Sprintf("[%s:%d] %s", strings.ToUpper(n.Status), len(n.Alerts), strings.Join(names, " "))
+}
+
+// Text lists the alerts one per line.
+func (n *Notification) Text() string {
+	var b strings.Builder
+	for _, a := range n.Alerts {
+		summary := a.Summary
+		if summary == "" {
+			summary = a.Name
+		}
+		fmt.Fprintf(&b, "- [%s] %s: %s %s\n", a.State, a.Severity, summary, labelString(a.Labels))
+	}
+	return b.String()
+}
+
+// Notifier delivers notifications to one backend.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// NewNotifier builds the notifier described by cfg.
+func NewNotifier(cfg ReceiverConfig) (Notifier, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+
+	switch cfg.Type {
+	case ReceiverWebhook:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("webhook receiver requires url")
+		}
+		return &WebhookNotifier{URL: cfg.URL, Headers: cfg.Headers, Client: client}, nil
+	case ReceiverSlack:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("slack receiver requires url")
+		}
+		return &SlackNotifier{URL: cfg.URL, Channel: cfg.Channel, Client: client}, nil
+	case ReceiverEmail:
+		if cfg.SMTPAddress == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("email receiver requires smtp_address, from and to")
+		}
+		n := &EmailNotifier{Address: cfg.SMTPAddress, From: cfg.From, To: cfg.To, Username: cfg.SMTPUsername, Timeout: timeout}
+		if cfg.SMTPPasswordEnv != "" {
+			n.Password = os.Getenv(cfg.SMTPPasswordEnv)
+		}
+		return n, nil
+	case ReceiverFile:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("file receiver requires path")
+		}
+		return &FileNotifier{Path: cfg.Path}, nil
+	default:
+		return nil, fmt.Errorf("unknown receiver type %q", cfg.Type)
+	}
+}
+
+// WebhookNotifier POSTs the notification as JSON.
+type WebhookNotifier struct {
+	URL     string
+	Headers map[string]string
+	Client  *http.Client
+}
+
+// Notify implements Notifier.
+func (w *WebhookNotifier) Notify(ctx context.Context, n *Notification) error {
+	return postJSON(ctx, w.Client, w.URL, w.Headers, n)
+}
+
+// SlackNotifier posts to a Slack-compatible incoming webhook.
+type SlackNotifier struct {
+	URL     string
+	Channel string
+	Client  *http.Client
+}
+
+type slackAttachment struct {
+	Color string `json:"color"`
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// Notify implements Notifier.
+func (s *SlackNotifier) Notify(ctx context.Context, n *Notification) error {
+	color := "good"
+	if n.Status == StateFiring {
+		color = "warning"
+		for _, a := range n.Alerts {
+			if a.Severity == SeverityCritical && a.State == StateFiring {
+				color = "danger"
+				break
+			}
+		}
+	}
+	msg := slackMessage{
+		Channel:     s.Channel,
+		Text:        n.Title(),
+		Attachments: []slackAttachment{{Color: color, Title: n.Title(), Text: n.Text()}},
+	}
+	return postJSON(ctx, s.Client, s.URL, nil, msg)
+}
+
+// EmailNotifier sends a plain-text mail through an SMTP relay.
+type EmailNotifier struct {
+	Address  string
+	From     string
+	To       []string
+	Username string
+	Password string
+	Timeout  time.Duration
+}
+
+// Notify implements Notifier.
+func (m *EmailNotifier) Notify(ctx context.Context, n *Notification) error {
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "From: %s\r\n", m.From)
+	fmt.Fprintf(&body, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&body, "Subject: %s\r\n", n.Title())
+	fmt.Fprintf(&body, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	body.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	body.WriteString(strings.ReplaceAll(n.Text(), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Address)
+		if err != nil {
+			return fmt.Errorf("failed to parse smtp address: %w", err)
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(m.Address, auth, m.From, m.To, body.Bytes()) }()
+
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = defaultNotifyTimeout
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to send alert email: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(timeout):
+		return fmt.Errorf("failed to send alert email: timed out after %s", timeout)
+	}
+}
+
+// FileNotifier appends each notification to a file as a JSON line.
+type FileNotifier struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Notify implements Notifier.
+func (f *FileNotifier) Notify(ctx context.Context, n *Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return fmt.Errorf("failed to create alert file directory: %w", err)
+	}
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open alert file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write alert file: %w", err)
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, headers map[string]string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to build notification request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if client == nil {
+		client = &http.Client{Timeout: defaultNotifyTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package alerting
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testNotification() *Notification {
+	return &Notification{
+		Receiver:    "test",
+		Status:      StateFiring,
+		GroupKey:    `{alertname="Tamper"}`,
+		GroupLabels: map[string]string{LabelAlertName: "Tamper"},
+		Alerts: []Alert{{
+			Name:     "Tamper",
+			Severity: SeverityCritical,
+			State:    StateFiring,
+			Summary:  "binary hash mismatch",
+			Labels:   map[string]string{LabelAlertName: "Tamper", LabelSeverity: SeverityCritical},
+		}},
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Notification
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(ReceiverConfig{Name: "hook", Type: ReceiverWebhook, URL: srv.URL, Headers: map[string]string{"Authorization": "Bearer t"}})
+	require.NoError(t, err)
+	require.NoError(t, n.Notify(context.Background(), testNotification()))
+	require.Equal(t, "Bearer t", auth)
+	require.Equal(t, "Tamper", got.Alerts[0].Name)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	n, err = NewNotifier(ReceiverConfig{Name: "hook", Type: ReceiverWebhook, URL: failing.URL})
+	require.NoError(t, err)
+	require.Error(t, n.Notify(context.Background(), testNotification()))
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var got slackMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	n, err := NewNotifier(ReceiverConfig{Name: "chat", Type: ReceiverSlack, URL: srv.URL, Channel: "#ops"})
+	require.NoError(t, err)
+	require.NoError(t, n.Notify(context.Background(), testNotification()))
+	require.Equal(t, "#ops", got.Channel)
+	require.Equal(t, "[FIRING:1] Tamper", got.Text)
+	require.Equal(t, "danger", got.Attachments[0].Color)
+	require.Contains(t, got.Attachments[0].Text, "binary hash mismatch")
+}
+
+func TestFileNotifier(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "alerts.jsonl")
+	n, err := NewNotifier(ReceiverConfig{Name: "file", Type: ReceiverFile, Path: path})
+	require.NoError(t, err)
+	require.NoError(t, n.Notify(context.Background(), testNotification()))
+	require.NoError(t, n.Notify(context.Background(), testNotification()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var got Notification
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got))
+	require.Equal(t, StateFiring, got.Status)
+}
+
+// serveSMTP accepts one SMTP session and returns the DATA payload.
+func serveSMTP(t *testing.T, ln net.Listener) <-chan string {
+	t.Helper()
+	out := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ready")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					reply("250 queued")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				out <- data.String()
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return out
+}
+
+func TestEmailNotifier(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	received := serveSMTP(t, ln)
+
+	n, err := NewNotifier(ReceiverConfig{Name: "mail", Type: ReceiverEmail, SMTPAddress: ln.Addr().String(), From: "agent@example.com", To: []string{"ops@example.com"}})
+	require.NoError(t, err)
+	require.NoError(t, n.Notify(context.Background(), testNotification()))
+
+	msg := <-received
+	require.Contains(t, msg, "Subject: [FIRING:1] Tamper")
+	require.Contains(t, msg, "To: ops@example.com")
+	require.Contains(t, msg, "binary hash mismatch")
+}
+
+func TestNewNotifierRejectsIncompleteConfig(t *testing.T) {
+	for _, cfg := range []ReceiverConfig{
+		{Type: ReceiverWebhook},
+		{Type: ReceiverSlack},
+		{Type: ReceiverEmail, SMTPAddress: "localhost:25"},
+		{Type: ReceiverFile},
+		{Type: "pager"},
+	} {
+		_, err := NewNotifier(cfg)
+		require.Error(t, err, cfg.Type)
+	}
+}
@@ -0,0 +1,184 @@
+package alerting
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var comparators = map[string]func(a, b float64) bool{
+	">":  func(a, b float64) bool { return a > b },
+	">=": func(a, b float64) bool { return a >= b },
+	"<":  func(a, b float64) bool { return a < b },
+	"<=": func(a, b float64) bool { return a <= b },
+	"==": func(a, b float64) bool { return a == b },
+	"!=": func(a, b float64) bool { return a != b },
+}
+
+// sample is one series value read from the registry.
+type sample struct {
+	labels map[string]string
+	value  float64
+}
+
+// instance is one active alert candidate produced by a rule.
+type instance struct {
+	labels map[string]string
+	value  float64
+}
+
+// gatherSamples flattens the registry into series keyed by metric name.
+// Histograms and summaries are exposed as <name>_count and <name>_sum.
+func gatherSamples(g prometheus.Gatherer) (map[string][]sample, error) {
+	families, err := g.Gather()
+	out := make(map[string][]sample, len(families))
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			labels := make(map[string]string, len(m.GetLabel()))
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				out[name] = append(out[name], sample{labels, m.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				out[name] = append(out[name], sample{labels, m.GetGauge().GetValue()})
+			case dto.MetricType_UNTYPED:
+				out[name] = append(out[name], sample{labels, m.GetUntyped().GetValue()})
+			case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+				h := m.GetHistogram()
+				out[name+"_count"] = append(out[name+"_count"], sample{labels, float64(h.GetSampleCount())})
+				out[name+"_sum"] = append(out[name+"_sum"], sample{labels, h.GetSampleSum()})
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				out[name+"_count"] = append(out[name+"_count"], sample{labels, float64(s.GetSampleCount())})
+				out[name+"_sum"] = append(out[name+"_sum"], sample{labels, s.GetSampleSum()})
+			}
+		}
+	}
+	// A partial gather still carries usable families.
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, err
+}
+
+// evaluateRuleLocked returns the instances for which rule's condition holds.
+func (e *Engine) evaluateRuleLocked(rule Rule, samples map[string][]sample, now time.Time) []instance {
+	cmp := comparators[rule.op()]
+
+	switch rule.Kind {
+	case KindThreshold:
+		var out []instance
+		for _, s := range samples[rule.Metric] {
+			if matchLabels(rule.Match, s.labels) && cmp(s.value, rule.Value) {
+				out = append(out, instance{labels: s.labels, value: s.value})
+			}
+		}
+		return out
+
+	case KindRate:
+		var out []instance
+		for _, s := range samples[rule.Metric] {
+			if !matchLabels(rule.Match, s.labels) {
+				continue
+			}
+			key := rule.Name + labelString(s.labels)
+			hist := append(e.history[key], point{at: now, value: s.value})
+			cutoff := now.Add(-rule.window())
+			for len(hist) > 2 && !hist[1].at.After(cutoff) {
+				hist = hist[1:]
+			}
+			e.history[key] = hist
+			if len(hist) < 2 {
+				continue
+			}
+			first, last := hist[0], hist[len(hist)-1]
+			elapsed := last.at.Sub(first.at).Seconds()
+			if elapsed <= 0 {
+				continue
+			}
+			delta := last.value - first.value
+			if delta < 0 {
+				// Counter reset: count from zero.
+				delta = last.value
+			}
+			rate := delta / elapsed
+			if cmp(rate, rule.Value) {
+				out = append(out, instance{labels: s.labels, value: rate})
+			}
+		}
+		return out
+
+	case KindAbsence:
+		if rule.Metric != "" {
+			for _, s := range samples[rule.Metric] {
+				if matchLabels(rule.Match, s.labels) {
+					return nil
+				}
+			}
+			return []instance{{labels: copyLabels(rule.Match)}}
+		}
+		if now.Sub(e.started) < rule.window() {
+			return nil
+		}
+		cutoff := now.Add(-rule.window())
+		for _, ev := range e.events {
+			if ev.at.After(cutoff) && matchEventType(rule.Event, ev.typ) {
+				return nil
+			}
+		}
+		return []instance{{labels: map[string]string{}}}
+
+	case KindEvent:
+		cutoff := now.Add(-rule.window())
+		counts := make(map[string]int)
+		for _, ev := range e.events {
+			if ev.at.After(cutoff) && matchEventType(rule.Event, ev.typ) {
+				counts[ev.subject]++
+			}
+		}
+		var out []instance
+		for subject, n := range counts {
+			if cmp(float64(n), rule.Value) {
+				labels := map[string]string{}
+				if subject != "" {
+					labels["subject"] = subject
+				}
+				out = append(out, instance{labels: labels, value: float64(n)})
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// pruneEventsLocked drops events older than the longest event window.
+func (e *Engine) pruneEventsLocked(now time.Time) {
+	cutoff := now.Add(-e.maxWindow)
+	i := 0
+	for i < len(e.events) && !e.events[i].at.After(cutoff) {
+		i++
+	}
+	e.events = e.events[i:]
+}
+
+// matchEventType matches an event type against a pattern; "prefix.*"
+// matches every type under prefix.
+func matchEventType(pattern, typ string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(typ, prefix)
+	}
+	return pattern == typ
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	out := make(map[string]string, len(labels))
+	for k, v := range labels {
+		out[k] = v
+	}
+	return out
+}
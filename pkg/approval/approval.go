@@ -0,0 +1,447 @@
+// Package approval holds disruptive actions — quarantine, network isolation,
+// module rebuilds, process restarts — until an authorized operator accepts
+// them, an auto-approve rule releases them, or they expire.
+//
+// Subsystems submit an Action together with the function that carries it
+// out; the queue runs that function at most once, after approval.
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Request states.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved" // accepted, action running
+	StatusRejected = "rejected"
+	StatusExpired  = "expired"
+	StatusExecuted = "executed" // approved and run successfully
+	StatusFailed   = "failed"   // approved but the action returned an error
+)
+
+// AutoApprover is recorded as the approver of requests released by an
+// auto-approve rule.
+const AutoApprover = "auto-approve"
+
+const (
+	defaultTTL        = 30 * time.Minute
+	defaultMaxPending = 100
+	defaultRetention  = 24 * time.Hour
+	executeTimeout    = 5 * time.Minute
+)
+
+// Config holds the approval workflow settings.
+type Config struct {
+	Enabled        bool              `yaml:"enabled"`
+	TTL            time.Duration     `yaml:"ttl"`              // pending requests expire after this, defaults to 30m
+	MaxPending     int               `yaml:"max_pending"`      // further submissions are refused, defaults to 100
+	Retention      time.Duration     `yaml:"retention"`        // decided requests are listed this long, defaults to 24h
+	RBACPolicyPath string            `yaml:"rbac_policy_path"` // roles allowed to approve, see pkg/rbac
+	AutoApprove    []AutoApproveRule `yaml:"auto_approve"`
+}
+
+// AutoApproveRule releases matching requests without an operator once they
+// have been pending for After. An After of zero runs them at once; they are
+// still recorded.
+type AutoApproveRule struct {
+	Action     string        `yaml:"action"`     // action name, path.Match patterns allowed
+	Severities []string      `yaml:"severities"` // empty matches every severity
+	After      time.Duration `yaml:"after"`
+}
+
+// WithDefaults fills unset fields.
+func (c Config) WithDefaults() Config {
+	if c.TTL <= 0 {
+		c.TTL = defaultTTL
+	}
+	if c.MaxPending <= 0 {
+		c.MaxPending = defaultMaxPending
+	}
+	if c.Retention <= 0 {
+		c.Retention = defaultRetention
+	}
+	return c
+}
+
+// Validate checks the auto-approve rules.
+func (c Config) Validate() error {
+	for i, rule := range c.AutoApprove {
+		if rule.Action == "" {
+			return fmt.Errorf("auto-approve rule %d has no action", i)
+		}
+		if _, err := path.Match(rule.Action, ""); err != nil {
+			return fmt.Errorf("auto-approve rule %d: invalid action pattern %q: %w", i, rule.Action, err)
+		}
+		if rule.After >= c.WithDefaults().TTL {
+			return fmt.Errorf("auto-approve rule %d: after %s is not shorter than the ttl", i, rule.After)
+		}
+	}
+	return nil
+}
+
+func (r AutoApproveRule) matches(a Action) bool {
+	if ok, _ := path.Match(r.Action, a.Name); !ok {
+		return false
+	}
+	if len(r.Severities) == 0 {
+		return true
+	}
+	for _, s := range r.Severities {
+		if s == a.Severity {
+			return true
+		}
+	}
+	return false
+}
+
+// Action describes a disruptive action awaiting approval.
+type Action struct {
+	Name     string                 `json:"name"`   // e.g. healing.restart-process, edr.quarantine
+	Source   string                 `json:"source"` // subsystem that submitted it
+	Subject  string                 `json:"subject"`
+	Severity string                 `json:"severity,omitempty"`
+	Reason   string                 `json:"reason"`
+	Context  map[string]interface{} `json:"context,omitempty"`
+}
+
+func (a Action) key() string {
+	return a.Name + "/" + a.Subject
+}
+
+// Request is an action and its approval state.
+type Request struct {
+	ID        string     `json:"id"`
+	Action    Action     `json:"action"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	Comment   string     `json:"comment,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Authorizer decides whether user may perform action on resource.
+// rbac.RBAC implements it.
+type Authorizer interface {
+	Authorize(ctx context.Context, user, action, resource string) (bool, string, error)
+}
+
+// PermissionApprove is the RBAC action checked for approvers; the resource
+// is the action name.
+const PermissionApprove = "approve"
+
+type entry struct {
+	req Request
+	run func(ctx context.Context) error
+}
+
+// Queue holds submitted actions until they are decided.
+type Queue struct {
+	logger *slog.Logger
+	cfg    Config
+	now    func() time.Time
+
+	mu         sync.Mutex
+	entries    map[string]*entry
+	authorizer Authorizer
+	onChange   func(Request)
+}
+
+// NewQueue creates an approval queue.
+func NewQueue(logger *slog.Logger, cfg Config) *Queue {
+	return &Queue{
+		logger:  logger,
+		cfg:     cfg.WithDefaults(),
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// SetAuthorizer sets the RBAC check approvers must pass. Without one every
+// approver the caller presents is accepted.
+func (q *Queue) SetAuthorizer(a Authorizer) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.authorizer = a
+}
+
+// OnChange registers a callback run after a request is queued or changes
+// state.
+func (q *Queue) OnChange(fn func(Request)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onChange = fn
+}
+
+// Submit queues action; run carries it out once approved. Submitting an
+// action while the same action on the same subject is pending returns the
+// pending request instead of queuing a duplicate.
+func (q *Queue) Submit(action Action, run func(ctx context.Context) error) (Request, error) {
+	q.mu.Lock()
+	pending := 0
+	for _, e := range q.entries {
+		if e.req.Status != StatusPending {
+			continue
+		}
+		if e.req.Action.key() == action.key() {
+			req := e.req
+			q.mu.Unlock()
+			return req, nil
+		}
+		pending++
+	}
+	if pending >= q.cfg.MaxPending {
+		q.mu.Unlock()
+		return Request{}, fmt.Errorf("approval queue full: %d requests pending", pending)
+	}
+	now := q.now()
+	e := &entry{
+		req: Request{
+			ID:        newID(),
+			Action:    action,
+			Status:    StatusPending,
+			CreatedAt: now,
+			ExpiresAt: now.Add(q.cfg.TTL),
+		},
+		run: run,
+	}
+	q.entries[e.req.ID] = e
+	req := e.req
+	q.mu.Unlock()
+
+	q.logger.Info("Disruptive action awaiting approval", "id", req.ID, "action", action.Name, "subject", action.Subject)
+	q.notify(req)
+
+	if rule, ok := q.autoApproveRule(action); ok && rule.After == 0 {
+		return q.decide(context.Background(), req.ID, AutoApprover, "", true)
+	}
+	return req, nil
+}
+
+// Approve runs a pending request on behalf of approver, who must be
+// authorized to approve its action.
+func (q *Queue) Approve(ctx context.Context, id, approver, comment string) (Request, error) {
+	if err := q.authorize(ctx, id, approver); err != nil {
+		return Request{}, err
+	}
+	return q.decide(ctx, id, approver, comment, true)
+}
+
+// Reject discards a pending request on behalf of approver, who must be
+// authorized to approve its action.
+func (q *Queue) Reject(ctx context.Context, id, approver, comment string) (Request, error) {
+	if err := q.authorize(ctx, id, approver); err != nil {
+		return Request{}, err
+	}
+	return q.decide(ctx, id, approver, comment, false)
+}
+
+// ErrNotFound is returned for unknown request IDs.
+var ErrNotFound = errors.New("approval request not found")
+
+// ErrForbidden is returned when the approver may not decide a request.
+var ErrForbidden = errors.New("not authorized to approve this action")
+
+func (q *Queue) authorize(ctx context.Context, id, approver string) error {
+	q.mu.Lock()
+	e, ok := q.entries[id]
+	authorizer := q.authorizer
+	q.mu.Unlock()
+	if !ok {
+		return ErrNotFound
+	}
+	if authorizer == nil {
+		return nil
+	}
+	allowed, reason, err := authorizer.Authorize(ctx, approver, PermissionApprove, e.req.Action.Name)
+	if err != nil {
+		return fmt.Errorf("failed to authorize approver: %w", err)
+	}
+	if !allowed {
+		return fmt.Errorf("%w: %s", ErrForbidden, reason)
+	}
+	return nil
+}
+
+// decide moves a pending request out of the pending state and, when
+// approved, runs it. The action runs detached from ctx so that an operator
+// disconnecting does not abandon it halfway.
+func (q *Queue) decide(ctx context.Context, id, approver, comment string, approve bool) (Request, error) {
+	q.mu.Lock()
+	e, ok := q.entries[id]
+	if !ok {
+		q.mu.Unlock()
+		return Request{}, ErrNotFound
+	}
+	if e.req.Status != StatusPending {
+		req := e.req
+		q.mu.Unlock()
+		return req, fmt.Errorf("approval request %s is already %s", id, req.Status)
+	}
+	now := q.now()
+	if !now.Before(e.req.ExpiresAt) {
+		q.expireLocked(e, now)
+		req := e.req
+		q.mu.Unlock()
+		q.notify(req)
+		return req, fmt.Errorf("approval request %s expired", id)
+	}
+	e.req.DecidedBy = approver
+	e.req.DecidedAt = &now
+	e.req.Comment = comment
+	if !approve {
+		e.req.Status = StatusRejected
+		req := e.req
+		q.mu.Unlock()
+		q.logger.Info("Disruptive action rejected", "id", id, "action", req.Action.Name, "by", approver)
+		q.notify(req)
+		return req, nil
+	}
+	run := e.run
+	e.run = nil
+	e.req.Status = StatusApproved
+	q.mu.Unlock()
+
+	q.logger.Info("Running approved disruptive action", "id", id, "action", e.req.Action.Name, "by", approver)
+	runCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), executeTimeout)
+	err := run(runCtx)
+	cancel()
+
+	q.mu.Lock()
+	e.req.Status = StatusExecuted
+	if err != nil {
+		e.req.Status = StatusFailed
+		e.req.Error = err.Error()
+	}
+	req := e.req
+	q.mu.Unlock()
+	if err != nil {
+		q.logger.Error("Approved disruptive action failed", "id", id, "action", req.Action.Name, "error", err)
+	}
+	q.notify(req)
+	return req, nil
+}
+
+func (q *Queue) expireLocked(e *entry, now time.Time) {
+	e.req.Status = StatusExpired
+	e.req.DecidedAt = &now
+	e.run = nil
+}
+
+func (q *Queue) autoApproveRule(a Action) (AutoApproveRule, bool) {
+	for _, rule := range q.cfg.AutoApprove {
+		if rule.matches(a) {
+			return rule, true
+		}
+	}
+	return AutoApproveRule{}, false
+}
+
+// Sweep expires overdue requests, runs those an auto-approve rule releases,
+// and forgets decided requests older than the retention.
+func (q *Queue) Sweep(ctx context.Context) {
+	now := q.now()
+	var expired []Request
+	var release []string
+	q.mu.Lock()
+	for id, e := range q.entries {
+		switch {
+		case e.req.Status != StatusPending:
+			if e.req.DecidedAt != nil && now.Sub(*e.req.DecidedAt) > q.cfg.Retention {
+				delete(q.entries, id)
+			}
+		case !now.Before(e.req.ExpiresAt):
+			q.expireLocked(e, now)
+			expired = append(expired, e.req)
+		default:
+			if rule, ok := q.autoApproveRule(e.req.Action); ok && now.Sub(e.req.CreatedAt) >= rule.After {
+				release = append(release, id)
+			}
+		}
+	}
+	q.mu.Unlock()
+
+	for _, req := range expired {
+		q.logger.Warn("Disruptive action expired without approval", "id", req.ID, "action", req.Action.Name, "subject", req.Action.Subject)
+		q.notify(req)
+	}
+	sort.Strings(release)
+	for _, id := range release {
+		if _, err := q.decide(ctx, id, AutoApprover, "", true); err != nil {
+			q.logger.Warn("Failed to auto-approve action", "id", id, "error", err)
+		}
+	}
+}
+
+// Run sweeps the queue every interval until ctx is done.
+func (q *Queue) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.Sweep(ctx)
+		}
+	}
+}
+
+// Get returns one request.
+func (q *Queue) Get(id string) (Request, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.entries[id]
+	if !ok {
+		return Request{}, false
+	}
+	return e.req, true
+}
+
+// List returns the requests in status, or every retained request when status
+// is empty, newest first.
+func (q *Queue) List(status string) []Request {
+	q.mu.Lock()
+	out := make([]Request, 0, len(q.entries))
+	for _, e := range q.entries {
+		if status == "" || e.req.Status == status {
+			out = append(out, e.req)
+		}
+	}
+	q.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (q *Queue) notify(req Request) {
+	q.mu.Lock()
+	fn := q.onChange
+	q.mu.Unlock()
+	if fn != nil {
+		fn(req)
+	}
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
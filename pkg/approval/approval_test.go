@@ -0,0 +1,160 @@
+package approval
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// allowList authorizes the listed users for every action.
+type allowList map[string]bool
+
+func (a allowList) Authorize(ctx context.Context, user, action, resource string) (bool, string, error) {
+	if action == PermissionApprove && a[user] {
+		return true, "authorized", nil
+	}
+	return false, "permission denied", nil
+}
+
+func newTestQueue(cfg Config) (*Queue, *time.Time) {
+	q := NewQueue(slog.Default(), cfg)
+	clock := time.Now()
+	q.now = func() time.Time { return clock }
+	return q, &clock
+}
+
+func restart(subject string) Action {
+	return Action{Name: "healing.restart-process", Source: "selfhealing", Subject: subject, Severity: "high", Reason: "controller exited"}
+}
+
+func TestApproveRunsOnce(t *testing.T) {
+	q, _ := newTestQueue(Config{})
+	q.SetAuthorizer(allowList{"alice": true})
+	var changes []string
+	q.OnChange(func(r Request) { changes = append(changes, r.Status) })
+
+	runs := 0
+	req, err := q.Submit(restart("ctl"), func(ctx context.Context) error { runs++; return nil })
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, req.Status)
+	assert.Equal(t, 0, runs, "held until approved")
+
+	dup, err := q.Submit(restart("ctl"), func(ctx context.Context) error { runs++; return nil })
+	require.NoError(t, err)
+	assert.Equal(t, req.ID, dup.ID, "same action on the same subject is not queued twice")
+	assert.Len(t, q.List(StatusPending), 1)
+
+	_, err = q.Approve(context.Background(), req.ID, "mallory", "")
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.Equal(t, 0, runs)
+
+	done, err := q.Approve(context.Background(), req.ID, "alice", "looks right")
+	require.NoError(t, err)
+	assert.Equal(t, StatusExecuted, done.Status)
+	assert.Equal(t, "alice", done.DecidedBy)
+	assert.Equal(t, "looks right", done.Comment)
+	assert.Equal(t, 1, runs)
+
+	_, err = q.Approve(context.Background(), req.ID, "alice", "")
+	assert.Error(t, err, "already decided")
+	assert.Equal(t, 1, runs)
+	assert.Equal(t, []string{StatusPending, StatusExecuted}, changes)
+
+	_, err = q.Approve(context.Background(), "unknown", "alice", "")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestApprovedActionFailure(t *testing.T) {
+	q, _ := newTestQueue(Config{})
+	req, err := q.Submit(restart("ctl"), func(ctx context.Context) error { return errors.New("exec failed") })
+	require.NoError(t, err)
+
+	done, err := q.Approve(context.Background(), req.ID, "admin-api-key", "")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, done.Status)
+	assert.Equal(t, "exec failed", done.Error)
+}
+
+func TestRejectAndExpire(t *testing.T) {
+	q, clock := newTestQueue(Config{TTL: 10 * time.Minute, Retention: time.Hour})
+	runs := 0
+	run := func(ctx context.Context) error { runs++; return nil }
+
+	rejected, err := q.Submit(restart("a"), run)
+	require.NoError(t, err)
+	got, err := q.Reject(context.Background(), rejected.ID, "alice", "not during business hours")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRejected, got.Status)
+
+	stale, err := q.Submit(restart("b"), run)
+	require.NoError(t, err)
+	*clock = clock.Add(10 * time.Minute)
+	q.Sweep(context.Background())
+	got, ok := q.Get(stale.ID)
+	require.True(t, ok)
+	assert.Equal(t, StatusExpired, got.Status)
+	_, err = q.Approve(context.Background(), stale.ID, "alice", "")
+	assert.Error(t, err)
+	assert.Equal(t, 0, runs)
+
+	// Decided requests are dropped after the retention.
+	*clock = clock.Add(2 * time.Hour)
+	q.Sweep(context.Background())
+	assert.Empty(t, q.List(""))
+}
+
+func TestAutoApprove(t *testing.T) {
+	q, clock := newTestQueue(Config{AutoApprove: []AutoApproveRule{
+		{Action: "healing.*", Severities: []string{"high"}, After: 5 * time.Minute},
+		{Action: "edr.isolate"},
+	}})
+	runs := map[string]int{}
+	run := func(name string) func(context.Context) error {
+		return func(ctx context.Context) error { runs[name]++; return nil }
+	}
+
+	isolate, err := q.Submit(Action{Name: "edr.isolate", Subject: "node"}, run("isolate"))
+	require.NoError(t, err)
+	assert.Equal(t, StatusExecuted, isolate.Status, "after 0 runs at once")
+	assert.Equal(t, AutoApprover, isolate.DecidedBy)
+
+	delayed, err := q.Submit(restart("ctl"), run("restart"))
+	require.NoError(t, err)
+	low := restart("other")
+	low.Severity = "low"
+	held, err := q.Submit(low, run("low"))
+	require.NoError(t, err)
+
+	*clock = clock.Add(4 * time.Minute)
+	q.Sweep(context.Background())
+	assert.Equal(t, 0, runs["restart"])
+
+	*clock = clock.Add(time.Minute)
+	q.Sweep(context.Background())
+	assert.Equal(t, 1, runs["restart"])
+	got, _ := q.Get(delayed.ID)
+	assert.Equal(t, StatusExecuted, got.Status)
+	got, _ = q.Get(held.ID)
+	assert.Equal(t, StatusPending, got.Status, "severity not covered by the rule")
+	assert.Equal(t, 0, runs["low"])
+}
+
+func TestMaxPending(t *testing.T) {
+	q, _ := newTestQueue(Config{MaxPending: 1})
+	_, err := q.Submit(restart("a"), func(ctx context.Context) error { return nil })
+	require.NoError(t, err)
+	_, err = q.Submit(restart("b"), func(ctx context.Context) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestConfigValidate(t *testing.T) {
+	assert.NoError(t, Config{AutoApprove: []AutoApproveRule{{Action: "healing.*", After: time.Minute}}}.Validate())
+	assert.Error(t, Config{AutoApprove: []AutoApproveRule{{After: time.Minute}}}.Validate())
+	assert.Error(t, Config{AutoApprove: []AutoApproveRule{{Action: "[", After: time.Minute}}}.Validate())
+	assert.Error(t, Config{TTL: time.Minute, AutoApprove: []AutoApproveRule{{Action: "edr.*", After: time.Hour}}}.Validate())
+}
@@ -0,0 +1,65 @@
+package backup
+
+import (
+	"bufio"
+	"io"
+)
+
+// Content-defined chunk sizes. A boundary falls where the rolling gear hash
+// has its low bits clear, so an insertion only changes the chunks around it
+// and unchanged regions of a file deduplicate against earlier backups.
+const (
+	chunkMin  = 16 << 10
+	chunkMax  = 512 << 10
+	chunkMask = 1<<16 - 1 // average chunk of about 80 KiB
+)
+
+// gearTable holds the per-byte values of the rolling gear hash, derived with
+// splitmix64 from a fixed seed so chunk boundaries are stable across runs.
+var gearTable = func() [256]uint64 {
+	var t [256]uint64
+	x := uint64(0x4150414241434b55)
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// chunker splits a stream into content-defined chunks.
+type chunker struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+func newChunker(r io.Reader) *chunker {
+	return &chunker{r: bufio.NewReaderSize(r, 64<<10), buf: make([]byte, 0, chunkMax)}
+}
+
+// next returns the next chunk, valid until the following call, or io.EOF
+// after the last one.
+func (c *chunker) next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var h uint64
+	for len(c.buf) < chunkMax {
+		b, err := c.r.ReadByte()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		h = (h << 1) + gearTable[b]
+		if len(c.buf) >= chunkMin && h&chunkMask == 0 {
+			break
+		}
+	}
+	if len(c.buf) == 0 {
+		return nil, io.EOF
+	}
+	return c.buf, nil
+}
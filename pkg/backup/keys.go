@@ -0,0 +1,402 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Key slot types. Each slot wraps the repository master key under a key
+// derived from one credential, so credentials can be added, removed and
+// rotated without re-encrypting any data.
+const (
+	SlotPassphrase = "passphrase" // Argon2id over a passphrase
+	SlotRecovery   = "recovery"   // a random key shown once to the operator
+	SlotIdentity   = "identity"   // the agent's identity private key
+)
+
+var (
+	// ErrLastKeySlot is returned when removing the only key slot, which
+	// would make the repository unreadable.
+	ErrLastKeySlot = errors.New("cannot remove the last backup key slot")
+	// ErrKeySlotInUse is returned when removing the slot the manager opened
+	// the repository with and none of its other credentials open another.
+	ErrKeySlotInUse = errors.New("backup key slot is the only one this agent can open")
+)
+
+// argon2Params are the Argon2id parameters for new passphrase slots, the
+// second recommended option of RFC 9106. Slots record their own parameters.
+var argon2Params = slotKDF{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// recoveryEncoding writes recovery keys without padding or ambiguous case.
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// KeySlot describes a key slot. The wrapped key is never exposed.
+type KeySlot struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Label   string    `json:"label,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// keySlot is a KeySlot as stored in the repository config.
+type keySlot struct {
+	KeySlot
+	Salt    []byte   `json:"salt"`
+	KDF     *slotKDF `json:"kdf,omitempty"` // passphrase slots only
+	Wrapped []byte   `json:"wrapped"`       // master key sealed with the slot key
+}
+
+// slotKDF holds Argon2id parameters.
+type slotKDF struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"` // KiB
+	Threads uint8  `json:"threads"`
+}
+
+// Bounds on the Argon2id parameters read from a repository config, which
+// anyone who can write to a target can change: too little work weakens the
+// passphrase, too much exhausts the agent's memory or CPU, and zero threads
+// panics.
+const (
+	minArgon2Time    = 1
+	maxArgon2Time    = 16
+	minArgon2Memory  = 19 * 1024 // KiB, the RFC 9106 floor used by OWASP
+	maxArgon2Memory  = 1 << 20   // KiB, 1 GiB
+	minArgon2Threads = 1
+	maxArgon2Threads = 64
+)
+
+// validate checks the parameters against the bounds.
+func (k *slotKDF) validate() error {
+	switch {
+	case k.Time < minArgon2Time || k.Time > maxArgon2Time:
+		return fmt.Errorf("argon2 time %d outside %d-%d", k.Time, minArgon2Time, maxArgon2Time)
+	case k.Memory < minArgon2Memory || k.Memory > maxArgon2Memory:
+		return fmt.Errorf("argon2 memory %d KiB outside %d-%d KiB", k.Memory, minArgon2Memory, maxArgon2Memory)
+	case k.Threads < minArgon2Threads || k.Threads > maxArgon2Threads:
+		return fmt.Errorf("argon2 threads %d outside %d-%d", k.Threads, minArgon2Threads, maxArgon2Threads)
+	}
+	return nil
+}
+
+// Credential unlocks the key slots of one type.
+type Credential struct {
+	typ    string
+	secret []byte
+}
+
+// PassphraseCredential unlocks passphrase slots.
+func PassphraseCredential(passphrase string) Credential {
+	return Credential{typ: SlotPassphrase, secret: []byte(passphrase)}
+}
+
+// IdentityCredential unlocks identity slots with the agent's private key
+// bytes.
+func IdentityCredential(key []byte) Credential {
+	return Credential{typ: SlotIdentity, secret: key}
+}
+
+// RecoveryKeyCredential unlocks recovery slots with a key returned by
+// NewRecoveryKey. Case, spaces and dashes are ignored.
+func RecoveryKeyCredential(key string) (Credential, error) {
+	clean := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(key)))
+	secret, err := recoveryEncoding.DecodeString(clean)
+	if err != nil || len(secret) != 32 {
+		return Credential{}, fmt.Errorf("invalid recovery key")
+	}
+	return Credential{typ: SlotRecovery, secret: secret}, nil
+}
+
+// NewRecoveryKey generates a recovery key, formatted for writing down, and
+// its credential.
+func NewRecoveryKey() (string, Credential, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", Credential{}, fmt.Errorf("failed to generate recovery key: %w", err)
+	}
+	encoded := recoveryEncoding.EncodeToString(secret)
+	var groups []string
+	for len(encoded) > 4 {
+		groups = append(groups, encoded[:4])
+		encoded = encoded[4:]
+	}
+	groups = append(groups, encoded)
+	return strings.Join(groups, "-"), Credential{typ: SlotRecovery, secret: secret}, nil
+}
+
+// Type returns the slot type the credential unlocks.
+func (c Credential) Type() string {
+	return c.typ
+}
+
+// slotKey derives the key wrapping the master key in a slot.
+func (c Credential) slotKey(slot *keySlot) ([]byte, error) {
+	if c.typ == SlotPassphrase {
+		if slot.KDF == nil {
+			return nil, fmt.Errorf("passphrase slot %s has no KDF parameters", slot.ID)
+		}
+		if err := slot.KDF.validate(); err != nil {
+			return nil, fmt.Errorf("passphrase slot %s: %w", slot.ID, err)
+		}
+		return argon2.IDKey(c.secret, slot.Salt, slot.KDF.Time, slot.KDF.Memory, slot.KDF.Threads, 32), nil
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, c.secret, slot.Salt, []byte("apa-backup-slot-"+c.typ)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func slotAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// slotAAD binds a wrapped key to its repository and slot, so slots cannot
+// be moved between repositories or swapped within one.
+func slotAAD(repoID string, slot *keySlot) []byte {
+	return []byte(repoID + "/" + slot.ID + "/" + slot.Type)
+}
+
+// newKeySlot wraps master under cred in a new slot.
+func newKeySlot(repoID, label string, cred Credential, master []byte) (*keySlot, error) {
+	switch cred.typ {
+	case SlotPassphrase, SlotRecovery, SlotIdentity:
+	default:
+		return nil, fmt.Errorf("unknown key slot type %q", cred.typ)
+	}
+	if len(cred.secret) == 0 {
+		return nil, fmt.Errorf("empty %s credential", cred.typ)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key slot ID: %w", err)
+	}
+	slot := &keySlot{
+		KeySlot: KeySlot{ID: hex.EncodeToString(id), Type: cred.typ, Label: label, Created: time.Now().UTC()},
+	}
+	if err := slot.wrap(repoID, cred, master); err != nil {
+		return nil, err
+	}
+	return slot, nil
+}
+
+// wrap seals master under cred with a fresh salt.
+func (s *keySlot) wrap(repoID string, cred Credential, master []byte) error {
+	s.Salt = make([]byte, 16)
+	if _, err := rand.Read(s.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+	s.KDF = nil
+	if cred.typ == SlotPassphrase {
+		params := argon2Params
+		s.KDF = &params
+	}
+	key, err := cred.slotKey(s)
+	if err != nil {
+		return err
+	}
+	aead, err := slotAEAD(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	s.Wrapped = aead.Seal(nonce, nonce, master, slotAAD(repoID, s))
+	return nil
+}
+
+// unwrap returns the master key if cred opens the slot.
+func (s *keySlot) unwrap(repoID string, cred Credential) ([]byte, bool) {
+	if cred.typ != s.Type || len(cred.secret) == 0 {
+		return nil, false
+	}
+	key, err := cred.slotKey(s)
+	if err != nil {
+		return nil, false
+	}
+	aead, err := slotAEAD(key)
+	if err != nil || len(s.Wrapped) < aead.NonceSize() {
+		return nil, false
+	}
+	n := aead.NonceSize()
+	master, err := aead.Open(nil, s.Wrapped[:n], s.Wrapped[n:], slotAAD(repoID, s))
+	if err != nil {
+		return nil, false
+	}
+	return master, true
+}
+
+// KeySlots lists the repository's key slots.
+func (bm *BackupManager) KeySlots() ([]KeySlot, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if _, err := bm.openLocked(); err != nil {
+		return nil, err
+	}
+	slots := make([]KeySlot, 0, len(bm.repo.Slots))
+	for _, slot := range bm.repo.Slots {
+		slots = append(slots, slot.KeySlot)
+	}
+	return slots, nil
+}
+
+// AddKeySlot adds a slot that cred opens. Use NewRecoveryKey for the
+// credential of a recovery slot.
+func (bm *BackupManager) AddKeySlot(label string, cred Credential) (KeySlot, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
+	if err != nil {
+		return KeySlot{}, err
+	}
+	slot, err := newKeySlot(bm.repo.ID, label, cred, keys.master)
+	if err != nil {
+		return KeySlot{}, err
+	}
+	cfg := *bm.repo
+	cfg.Slots = append(append([]*keySlot(nil), bm.repo.Slots...), slot)
+	if err := saveRepoConfig(bm.store, &cfg); err != nil {
+		return KeySlot{}, err
+	}
+	bm.repo = &cfg
+	bm.logger.Info("Added backup key slot", "slot", slot.ID, "type", slot.Type, "label", label)
+	return slot.KeySlot, nil
+}
+
+// RotateKeySlot replaces the credential of a slot with cred, which must be
+// of the same type. When the manager opened the repository with that slot,
+// it uses cred from now on.
+func (bm *BackupManager) RotateKeySlot(id string, cred Credential) (KeySlot, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
+	if err != nil {
+		return KeySlot{}, err
+	}
+	i := bm.slotIndex(id)
+	if i < 0 {
+		return KeySlot{}, fmt.Errorf("key slot %s not found", id)
+	}
+	if cred.typ != bm.repo.Slots[i].Type {
+		return KeySlot{}, fmt.Errorf("key slot %s is a %s slot, not %s", id, bm.repo.Slots[i].Type, cred.typ)
+	}
+	if len(cred.secret) == 0 {
+		return KeySlot{}, fmt.Errorf("empty %s credential", cred.typ)
+	}
+	slot := *bm.repo.Slots[i]
+	slot.Created = time.Now().UTC()
+	if err := slot.wrap(bm.repo.ID, cred, keys.master); err != nil {
+		return KeySlot{}, err
+	}
+	cfg := *bm.repo
+	cfg.Slots = append([]*keySlot(nil), bm.repo.Slots...)
+	cfg.Slots[i] = &slot
+	if err := saveRepoConfig(bm.store, &cfg); err != nil {
+		return KeySlot{}, err
+	}
+	bm.repo = &cfg
+	if id == bm.slotID {
+		switch cred.typ {
+		case SlotPassphrase:
+			bm.passphrase = string(cred.secret)
+		case SlotIdentity:
+			bm.identityKey = cred.secret
+		}
+	}
+	bm.logger.Info("Rotated backup key slot", "slot", id, "type", slot.Type)
+	return slot.KeySlot, nil
+}
+
+// PassphraseOpens reports whether the passphrase the manager was given
+// opens slot id. Rotating such a slot leaves the passphrase file stale.
+func (bm *BackupManager) PassphraseOpens(id string) bool {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if bm.passphrase == "" {
+		return false
+	}
+	if _, err := bm.openLocked(); err != nil {
+		return false
+	}
+	i := bm.slotIndex(id)
+	if i < 0 {
+		return false
+	}
+	_, ok := bm.repo.Slots[i].unwrap(bm.repo.ID, PassphraseCredential(bm.passphrase))
+	return ok
+}
+
+// RemoveKeySlot removes a slot. The last slot cannot be removed, nor the
+// slot the manager opened the repository with unless its other credentials
+// open a remaining slot.
+func (bm *BackupManager) RemoveKeySlot(id string) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if _, err := bm.openLocked(); err != nil {
+		return err
+	}
+	i := bm.slotIndex(id)
+	if i < 0 {
+		return fmt.Errorf("key slot %s not found", id)
+	}
+	if len(bm.repo.Slots) == 1 {
+		return ErrLastKeySlot
+	}
+	cfg := *bm.repo
+	cfg.Slots = append(append([]*keySlot(nil), bm.repo.Slots[:i]...), bm.repo.Slots[i+1:]...)
+
+	slotID := bm.slotID
+	if id == bm.slotID {
+		slotID = ""
+		for _, cred := range bm.credentials() {
+			for _, slot := range cfg.Slots {
+				if _, ok := slot.unwrap(cfg.ID, cred); ok {
+					slotID = slot.ID
+					break
+				}
+			}
+			if slotID != "" {
+				break
+			}
+		}
+		if slotID == "" {
+			return ErrKeySlotInUse
+		}
+	}
+	if err := saveRepoConfig(bm.store, &cfg); err != nil {
+		return err
+	}
+	bm.repo = &cfg
+	bm.slotID = slotID
+	bm.logger.Info("Removed backup key slot", "slot", id)
+	return nil
+}
+
+// slotIndex returns the index of slot id in the repository config, or -1.
+// bm.mu must be held.
+func (bm *BackupManager) slotIndex(id string) int {
+	for i, slot := range bm.repo.Slots {
+		if slot.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,233 @@
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// readObjects returns every data object in a repository directory, so tests
+// can confirm key changes leave them untouched.
+func readObjects(t *testing.T, dir string) map[string][]byte {
+	t.Helper()
+	names, err := NewDirTarget(dir).List(repoDataDir)
+	require.NoError(t, err)
+	objects := make(map[string][]byte)
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		objects[name] = data
+	}
+	return objects
+}
+
+func TestRotatePassphraseKeepsData(t *testing.T) {
+	src := t.TempDir()
+	writeTestTree(t, src)
+	dir := t.TempDir()
+	bm := NewBackupManager(slog.Default(), dir, "old-passphrase")
+	bm.SetPaths(src)
+	id, err := bm.CreateBackup(map[string]interface{}{"a": "b"}, nil, nil)
+	require.NoError(t, err)
+	before := readObjects(t, dir)
+
+	slots, err := bm.KeySlots()
+	require.NoError(t, err)
+	require.Len(t, slots, 1)
+	assert.Equal(t, SlotPassphrase, slots[0].Type)
+
+	rotated, err := bm.RotateKeySlot(slots[0].ID, PassphraseCredential("new-passphrase"))
+	require.NoError(t, err)
+	assert.Equal(t, slots[0].ID, rotated.ID)
+	assert.Equal(t, before, readObjects(t, dir), "rotation must not re-encrypt data")
+
+	// The manager keeps working with the new passphrase.
+	_, err = bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+
+	_, err = NewBackupManager(slog.Default(), dir, "old-passphrase").ListBackups()
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+	data, err := NewBackupManager(slog.Default(), dir, "new-passphrase").RestoreBackup(id)
+	require.NoError(t, err)
+	assert.Equal(t, "b", data.Config["a"])
+
+	_, err = bm.RotateKeySlot(slots[0].ID, IdentityCredential([]byte("key")))
+	assert.Error(t, err, "a slot keeps its type")
+}
+
+func TestRecoveryAndIdentitySlots(t *testing.T) {
+	dir := t.TempDir()
+	identity := []byte("agent identity private key bytes")
+	bm := NewBackupManager(slog.Default(), dir, "passphrase")
+	bm.SetIdentityKey(identity)
+	id, err := bm.CreateBackup(map[string]interface{}{"a": "b"}, nil, nil)
+	require.NoError(t, err)
+
+	slots, err := bm.KeySlots()
+	require.NoError(t, err)
+	require.Len(t, slots, 2, "a new repository gets a slot per credential")
+	assert.Equal(t, SlotIdentity, slots[1].Type)
+
+	recoveryKey, cred, err := NewRecoveryKey()
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(recoveryKey, "-"), 13)
+	recovery, err := bm.AddKeySlot("paper copy", cred)
+	require.NoError(t, err)
+	assert.Equal(t, "paper copy", recovery.Label)
+
+	// The passphrase is lost: the recovery key opens the repository, typed
+	// in lower case with spaces.
+	typed, err := RecoveryKeyCredential(strings.ToLower(strings.ReplaceAll(recoveryKey, "-", " ")))
+	require.NoError(t, err)
+	lost := NewBackupManager(slog.Default(), dir, "")
+	lost.SetCredentials(typed)
+	data, err := lost.RestoreBackup(id)
+	require.NoError(t, err)
+	assert.Equal(t, "b", data.Config["a"])
+
+	// So does the agent identity.
+	byIdentity := NewBackupManager(slog.Default(), dir, "")
+	byIdentity.SetIdentityKey(identity)
+	_, err = byIdentity.RestoreBackup(id)
+	require.NoError(t, err)
+
+	_, err = RecoveryKeyCredential("not-a-key")
+	assert.Error(t, err)
+	other, _, err := NewRecoveryKey()
+	require.NoError(t, err)
+	wrong, err := RecoveryKeyCredential(other)
+	require.NoError(t, err)
+	guess := NewBackupManager(slog.Default(), dir, "")
+	guess.SetCredentials(wrong)
+	_, err = guess.ListBackups()
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
+
+func TestRemoveKeySlot(t *testing.T) {
+	dir := t.TempDir()
+	bm := NewBackupManager(slog.Default(), dir, "passphrase")
+	slots, err := bm.KeySlots()
+	require.NoError(t, err)
+	own := slots[0].ID
+
+	assert.ErrorIs(t, bm.RemoveKeySlot(own), ErrLastKeySlot)
+
+	_, cred, err := NewRecoveryKey()
+	require.NoError(t, err)
+	recovery, err := bm.AddKeySlot("", cred)
+	require.NoError(t, err)
+	assert.ErrorIs(t, bm.RemoveKeySlot(own), ErrKeySlotInUse, "the manager could not open the repository again")
+
+	// With a second passphrase slot the manager can still open it.
+	second, err := bm.AddKeySlot("second", PassphraseCredential("passphrase"))
+	require.NoError(t, err)
+	require.NoError(t, bm.RemoveKeySlot(own))
+	require.NoError(t, bm.RemoveKeySlot(recovery.ID))
+	assert.Error(t, bm.RemoveKeySlot("missing"))
+
+	slots, err = NewBackupManager(slog.Default(), dir, "passphrase").KeySlots()
+	require.NoError(t, err)
+	require.Len(t, slots, 1)
+	assert.Equal(t, second.ID, slots[0].ID)
+}
+
+func TestKeySlotsAreBoundToTheirRepository(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+	_, err := NewBackupManager(slog.Default(), a, "passphrase").KeySlots()
+	require.NoError(t, err)
+	_, err = NewBackupManager(slog.Default(), b, "passphrase").KeySlots()
+	require.NoError(t, err)
+
+	// Copy repository a's slots into repository b's config.
+	var cfgA, cfgB repoConfig
+	data, err := os.ReadFile(filepath.Join(a, repoConfigName))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &cfgA))
+	data, err = os.ReadFile(filepath.Join(b, repoConfigName))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &cfgB))
+	cfgB.Slots = cfgA.Slots
+	require.NoError(t, saveRepoConfig(NewDirTarget(b), &cfgB))
+
+	_, err = NewBackupManager(slog.Default(), b, "passphrase").KeySlots()
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
+
+func TestSlotKDFIsBounded(t *testing.T) {
+	cred := PassphraseCredential("passphrase")
+	for _, kdf := range []slotKDF{
+		{Time: 3, Memory: 64 * 1024, Threads: 0},
+		{Time: 0, Memory: 64 * 1024, Threads: 4},
+		{Time: 3, Memory: 1 << 31, Threads: 4},
+		{Time: 3, Memory: 8, Threads: 4},
+		{Time: 1 << 20, Memory: 64 * 1024, Threads: 4},
+	} {
+		kdf := kdf
+		_, err := cred.slotKey(&keySlot{KeySlot: KeySlot{ID: "s"}, Salt: []byte("salt"), KDF: &kdf})
+		assert.Error(t, err, "%+v", kdf)
+	}
+	require.NoError(t, argon2Params.validate())
+
+	// A repository whose slot was tampered with does not open, rather than
+	// panicking or allocating what the config asks for.
+	dir := t.TempDir()
+	_, err := NewBackupManager(slog.Default(), dir, "passphrase").KeySlots()
+	require.NoError(t, err)
+	var cfg repoConfig
+	data, err := os.ReadFile(filepath.Join(dir, repoConfigName))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &cfg))
+	cfg.Slots[0].KDF.Threads = 0
+	require.NoError(t, saveRepoConfig(NewDirTarget(dir), &cfg))
+	_, err = NewBackupManager(slog.Default(), dir, "passphrase").KeySlots()
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
+
+func TestUpgradeRejectsUnboundedIterations(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &repoConfig{Version: 1, ID: "0123456789abcdef", Salt: []byte("0123456789abcdef"), Iterations: maxPBKDF2Iterations + 1}
+	require.NoError(t, saveRepoConfig(NewDirTarget(dir), cfg))
+	_, err := NewBackupManager(slog.Default(), dir, "passphrase").KeySlots()
+	assert.ErrorContains(t, err, "pbkdf2 iterations")
+}
+
+func TestUpgradeVersion1Repository(t *testing.T) {
+	dir := t.TempDir()
+	store := NewDirTarget(dir)
+	cfg := &repoConfig{Version: 1, ID: "0123456789abcdef", Salt: []byte("0123456789abcdef"), Iterations: 1000}
+	master := pbkdf2.Key([]byte("passphrase"), cfg.Salt, cfg.Iterations, 32, sha256.New)
+	keys, err := deriveKeys(master)
+	require.NoError(t, err)
+	cfg.Check, err = keys.seal([]byte(repoCheckText))
+	require.NoError(t, err)
+	require.NoError(t, saveRepoConfig(store, cfg))
+	sealed, err := keys.seal([]byte("old data"))
+	require.NoError(t, err)
+
+	_, err = NewBackupManager(slog.Default(), dir, "wrong").KeySlots()
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	bm := NewBackupManager(slog.Default(), dir, "passphrase")
+	slots, err := bm.KeySlots()
+	require.NoError(t, err)
+	require.Len(t, slots, 1)
+	assert.Equal(t, SlotPassphrase, slots[0].Type)
+	plain, err := bm.decryptData(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "old data", string(plain))
+
+	var upgraded repoConfig
+	data, err := os.ReadFile(filepath.Join(dir, repoConfigName))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &upgraded))
+	assert.Equal(t, repoVersion, upgraded.Version)
+	assert.Empty(t, upgraded.Salt, "version 1 key derivation fields are dropped")
+}
@@ -1,27 +1,78 @@
 package backup
 
 import (
+	"bytes"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
-
-	"golang.org/x/crypto/pbkdf2"
 )
 
-// BackupManager handles encrypted backups of agent data
+// Config controls scheduled backups.
+type Config struct {
+	Enabled         bool              `yaml:"enabled"`
+	Dir             string            `yaml:"dir"`               // repository directory, defaults to "backups"
+	PassphraseFile  string            `yaml:"passphrase_file"`   // file holding the repository passphrase
+	RecoveryKeyFile string            `yaml:"recovery_key_file"` // optional recovery key, tried when the passphrase fails
+	Interval        time.Duration     `yaml:"interval"`          // defaults to 1h
+	Paths           []string          `yaml:"paths"`             // extra files and directories to back up
+	Retention       RetentionPolicy   `yaml:"retention"`         // defaults to 24 hourly, 7 daily and 4 weekly
+	Targets         []TargetConfig    `yaml:"targets"`           // remote copies of the repository
+	PeerStorage     PeerStorageConfig `yaml:"peer_storage"`      // space lent to other agents' backups
+}
+
+// WithDefaults fills unset fields.
+func (c Config) WithDefaults() Config {
+	if c.Dir == "" {
+		c.Dir = "backups"
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Hour
+	}
+	if c.Retention.IsZero() {
+		c.Retention = RetentionPolicy{Hourly: 24, Daily: 7, Weekly: 4}
+	}
+	if c.PeerStorage.Dir == "" {
+		c.PeerStorage.Dir = "backups-peers"
+	}
+	if c.PeerStorage.Quota <= 0 {
+		c.PeerStorage.Quota = 1 << 30
+	}
+	if c.PeerStorage.MinReputation <= 0 {
+		c.PeerStorage.MinReputation = DefaultMinReputation
+	}
+	return c
+}
+
+// BackupManager handles encrypted, deduplicated backups of agent data and
+// files into a repository directory.
 type BackupManager struct {
-	logger     *slog.Logger
-	backupDir  string
-	passphrase string
+	logger      *slog.Logger
+	backupDir   string
+	passphrase  string
+	identityKey []byte
+	extraCreds  []Credential
+	paths       []string
+	retention   RetentionPolicy
+
+	mu     sync.Mutex
+	store  Target
+	repo   *repoConfig
+	keys   *repoKeys
+	slotID string // key slot the repository was opened with
 }
 
 // BackupData represents the structure of backed up data
@@ -34,22 +85,168 @@ type BackupData struct {
 	Checksum     string                 `json:"checksum"`
 }
 
-// NewBackupManager creates a new backup manager
+// Snapshot is the catalogue entry of one backup run.
+type Snapshot struct {
+	ID     string        `json:"id"`
+	Time   time.Time     `json:"time"`
+	Parent string        `json:"parent,omitempty"` // snapshot unchanged files were taken from
+	Paths  []string      `json:"paths"`
+	Data   []string      `json:"data"` // chunks of the JSON-encoded BackupData
+	Files  []FileEntry   `json:"files"`
+	Stats  SnapshotStats `json:"stats"`
+}
+
+// SnapshotStats summarizes what a backup run stored.
+type SnapshotStats struct {
+	Files     int   `json:"files"`
+	Bytes     int64 `json:"bytes"`      // size of the data and files
+	Chunks    int   `json:"chunks"`     // chunks referenced
+	NewChunks int   `json:"new_chunks"` // chunks not already in the repository
+	NewBytes  int64 `json:"new_bytes"`  // size of the new chunks before encryption
+	Unchanged int   `json:"unchanged"`  // files taken from the parent without reading them
+}
+
+// FileEntry describes a backed up file, directory or symlink.
+type FileEntry struct {
+	Path    string      `json:"path"` // slash-separated, without the leading slash of absolute paths
+	Type    string      `json:"type"` // "file", "dir" or "symlink"
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mod_time"`
+	Size    int64       `json:"size,omitempty"`
+	Target  string      `json:"target,omitempty"` // symlink target
+	Chunks  []string    `json:"chunks,omitempty"`
+}
+
+// NewBackupManager creates a new backup manager. The repository in
+// backupDir is created on first use.
 func NewBackupManager(logger *slog.Logger, backupDir, passphrase string) *BackupManager {
 	return &BackupManager{
 		logger:     logger,
 		backupDir:  backupDir,
 		passphrase: passphrase,
+		store:      NewDirTarget(backupDir),
+	}
+}
+
+// SetIdentityKey lets the manager open the repository with the agent's
+// identity private key when the passphrase does not, and adds an identity
+// slot to repositories it creates.
+func (bm *BackupManager) SetIdentityKey(key []byte) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.identityKey = key
+	bm.keys = nil
+}
+
+// SetCredentials adds credentials tried after the passphrase and identity
+// key, such as a recovery key when the passphrase is lost.
+func (bm *BackupManager) SetCredentials(creds ...Credential) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.extraCreds = creds
+	bm.keys = nil
+}
+
+// credentials returns the credentials the manager opens the repository
+// with, in the order they are tried.
+func (bm *BackupManager) credentials() []Credential {
+	var creds []Credential
+	if bm.passphrase != "" {
+		creds = append(creds, PassphraseCredential(bm.passphrase))
+	}
+	if len(bm.identityKey) > 0 {
+		creds = append(creds, IdentityCredential(bm.identityKey))
+	}
+	return append(creds, bm.extraCreds...)
+}
+
+// SetPaths sets the files and directories included in every backup.
+func (bm *BackupManager) SetPaths(paths ...string) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.paths = paths
+}
+
+// SetTarget sets where the repository is stored, in place of the backup
+// directory. Use a MirrorTarget to keep the repository in several places.
+func (bm *BackupManager) SetTarget(t Target) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.store = t
+	bm.keys = nil
+}
+
+// SetRetention sets the policy Maintain applies. The zero policy keeps
+// every snapshot.
+func (bm *BackupManager) SetRetention(p RetentionPolicy) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.retention = p
+}
+
+// openLocked opens or creates the repository. bm.mu must be held.
+func (bm *BackupManager) openLocked() (*repoKeys, error) {
+	if bm.keys != nil {
+		return bm.keys, nil
+	}
+	cfg, keys, slotID, err := openRepository(bm.store, bm.credentials())
+	if err != nil {
+		return nil, err
+	}
+	// A mirror that lost the config, such as a replaced local disk, gets
+	// it back so it can be opened on its own again.
+	if ok, err := bm.store.Exists(repoConfigName); err == nil && !ok {
+		if err := saveRepoConfig(bm.store, cfg); err != nil {
+			bm.logger.Warn("Failed to restore repository config on every target", "error", err)
+		}
+	}
+	bm.repo = cfg
+	bm.keys = keys
+	bm.slotID = slotID
+	if bm.passphrase != "" {
+		for _, slot := range cfg.Slots {
+			if slot.ID == slotID && slot.Type != SlotPassphrase {
+				bm.logger.Warn("Backup passphrase opens no key slot, opened the repository with another credential", "slot", slotID, "type", slot.Type)
+			}
+		}
 	}
+	return keys, nil
 }
 
-// CreateBackup creates an encrypted backup of agent data
+// CreateBackup stores the given maps and the configured paths as a new
+// snapshot and returns its ID. Chunks already in the repository are not
+// stored again, and files unchanged since the previous snapshot are not
+// read.
 func (bm *BackupManager) CreateBackup(config, state, criticalData map[string]interface{}) (string, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
 	bm.logger.Info("Creating encrypted backup")
 
+	keys, err := bm.openLocked()
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup repository: %w", err)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate snapshot ID: %w", err)
+	}
+	snap := &Snapshot{ID: hex.EncodeToString(id), Time: time.Now(), Paths: bm.paths}
+
+	parentFiles := map[string]FileEntry{}
+	if snaps, err := bm.snapshotsLocked(keys); err != nil {
+		bm.logger.Warn("Failed to read previous snapshots, backing up every file", "error", err)
+	} else if len(snaps) > 0 {
+		parent := snaps[len(snaps)-1]
+		snap.Parent = parent.ID
+		for _, f := range parent.Files {
+			parentFiles[f.Path] = f
+		}
+	}
+
 	// Create backup data structure
 	backupData := &BackupData{
-		Timestamp:    time.Now(),
+		Timestamp:    snap.Time,
 		Version:      "1.0",
 		Config:       config,
 		State:        state,
@@ -63,55 +260,279 @@ func (bm *BackupManager) CreateBackup(config, state, criticalData map[string]int
 	}
 
 	// Calculate checksum on payload without the checksum field populated
-	checksum := bm.calculateChecksum(checksumPayload)
-	backupData.Checksum = checksum
+	backupData.Checksum = bm.calculateChecksum(checksumPayload)
 
 	// Serialize final payload with checksum set
 	data, err := json.Marshal(backupData)
 	if err != nil {
 		return "", fmt.Errorf("failed to serialize backup data with checksum: %w", err)
 	}
+	if snap.Data, err = bm.storeStream(keys, bytes.NewReader(data), &snap.Stats); err != nil {
+		return "", fmt.Errorf("failed to store backup data: %w", err)
+	}
+	snap.Stats.Bytes += int64(len(data))
+
+	for _, p := range bm.paths {
+		if err := bm.addPath(keys, snap, p, parentFiles); err != nil {
+			return "", err
+		}
+	}
 
-	// Encrypt the data
-	encryptedData, err := bm.encryptData(data)
+	if err := bm.saveSnapshot(keys, snap); err != nil {
+		return "", err
+	}
+	bm.logger.Info("Backup created successfully", "snapshot", snap.ID, "files", snap.Stats.Files,
+		"bytes", snap.Stats.Bytes, "new_chunks", snap.Stats.NewChunks, "new_bytes", snap.Stats.NewBytes, "unchanged", snap.Stats.Unchanged)
+	return snap.ID, nil
+}
+
+// entryPath maps a local path to its slash-separated path in a snapshot.
+func entryPath(p string) string {
+	p = filepath.Clean(p)
+	p = strings.TrimPrefix(p, filepath.VolumeName(p))
+	return strings.TrimPrefix(filepath.ToSlash(p), "/")
+}
+
+// addPath backs up the file or directory tree at root. A missing root is
+// skipped, since files such as the audit log appear only once used.
+func (bm *BackupManager) addPath(keys *repoKeys, snap *Snapshot, root string, parentFiles map[string]FileEntry) error {
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				bm.logger.Warn("Backup path does not exist, skipping", "path", root)
+				return nil
+			}
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry := FileEntry{Path: entryPath(p), Mode: info.Mode(), ModTime: info.ModTime()}
+		switch {
+		case info.IsDir():
+			entry.Type = "dir"
+		case info.Mode()&fs.ModeSymlink != 0:
+			entry.Type = "symlink"
+			if entry.Target, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			entry.Type = "file"
+			entry.Size = info.Size()
+			if prev, ok := parentFiles[entry.Path]; ok && prev.Type == "file" && prev.Size == entry.Size &&
+				prev.Mode == entry.Mode && prev.ModTime.Equal(entry.ModTime) && bm.chunksStored(prev.Chunks) {
+				entry.Chunks = prev.Chunks
+				snap.Stats.Unchanged++
+				snap.Stats.Chunks += len(prev.Chunks)
+			} else if err := bm.storeFile(keys, p, &entry, &snap.Stats); err != nil {
+				return err
+			}
+			snap.Stats.Bytes += entry.Size
+		default:
+			return nil // sockets, devices and pipes are not backed up
+		}
+		snap.Files = append(snap.Files, entry)
+		snap.Stats.Files++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to back up %s: %w", root, err)
+	}
+	return nil
+}
+
+// chunksStored reports whether every chunk is stored, so a file is read
+// again rather than referencing chunks a target has lost.
+func (bm *BackupManager) chunksStored(ids []string) bool {
+	for _, id := range ids {
+		if ok, err := bm.store.Exists(chunkName(id)); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (bm *BackupManager) storeFile(keys *repoKeys, p string, entry *FileEntry, stats *SnapshotStats) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	counter := &countingReader{r: f}
+	if entry.Chunks, err = bm.storeStream(keys, counter, stats); err != nil {
+		return err
+	}
+	entry.Size = counter.n
+	return nil
+}
+
+// storeStream splits r into chunks, stores the ones the repository lacks
+// and returns the chunk IDs in order.
+func (bm *BackupManager) storeStream(keys *repoKeys, r io.Reader, stats *SnapshotStats) ([]string, error) {
+	var ids []string
+	c := newChunker(r)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		id := keys.chunkID(chunk)
+		name := chunkName(id)
+		exists, err := bm.store.Exists(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up chunk: %w", err)
+		}
+		if !exists {
+			sealed, err := keys.seal(chunk)
+			if err != nil {
+				return nil, err
+			}
+			if err := bm.store.Save(name, sealed); err != nil {
+				return nil, fmt.Errorf("failed to write chunk: %w", err)
+			}
+			stats.NewChunks++
+			stats.NewBytes += int64(len(chunk))
+		}
+		stats.Chunks++
+		ids = append(ids, id)
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// loadChunk reads a chunk and checks it against its ID.
+func (bm *BackupManager) loadChunk(keys *repoKeys, id string) ([]byte, error) {
+	if !validObjectID(id) {
+		return nil, fmt.Errorf("invalid chunk ID %q", id)
+	}
+	sealed, err := bm.store.Load(chunkName(id))
 	if err != nil {
-		return "", fmt.Errorf("failed to encrypt backup data: %w", err)
+		return nil, fmt.Errorf("failed to read chunk %s: %w", id, err)
 	}
+	data, err := keys.open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", id, err)
+	}
+	if keys.chunkID(data) != id {
+		return nil, fmt.Errorf("chunk %s does not match its ID", id)
+	}
+	return data, nil
+}
 
-	// Create backup filename
-	filename := fmt.Sprintf("backup_%s.enc", time.Now().Format("20060102_150405"))
-	filepath := filepath.Join(bm.backupDir, filename)
+func (bm *BackupManager) writeChunks(keys *repoKeys, w io.Writer, ids []string) error {
+	for _, id := range ids {
+		data, err := bm.loadChunk(keys, id)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	// Write encrypted data to file
-	err = os.WriteFile(filepath, encryptedData, 0600)
+func (bm *BackupManager) saveSnapshot(keys *repoKeys, snap *Snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("failed to serialize snapshot: %w", err)
+	}
+	sealed, err := keys.seal(data)
 	if err != nil {
-		return "", fmt.Errorf("failed to write backup file: %w", err)
+		return err
+	}
+	if err := bm.store.Save(snapshotName(snap.ID), sealed); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
 	}
+	return nil
+}
 
-	bm.logger.Info("Backup created successfully", "file", filepath)
-	return filepath, nil
+func (bm *BackupManager) loadSnapshot(keys *repoKeys, id string) (*Snapshot, error) {
+	if !validObjectID(id) {
+		return nil, fmt.Errorf("invalid snapshot ID %q", id)
+	}
+	sealed, err := bm.store.Load(snapshotName(id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", id, err)
+	}
+	data, err := keys.open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", id, err)
+	}
+	if snap.ID != id {
+		return nil, fmt.Errorf("snapshot %s is stored as %s", snap.ID, id)
+	}
+	return &snap, nil
 }
 
-// RestoreBackup restores agent data from an encrypted backup
-func (bm *BackupManager) RestoreBackup(backupFile string) (*BackupData, error) {
-	bm.logger.Info("Restoring from encrypted backup", "file", backupFile)
+// snapshotsLocked returns every snapshot, oldest first.
+func (bm *BackupManager) snapshotsLocked(keys *repoKeys) ([]*Snapshot, error) {
+	names, err := bm.store.List(repoSnapshotDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	snaps := make([]*Snapshot, 0, len(names))
+	for _, name := range names {
+		snap, err := bm.loadSnapshot(keys, path.Base(name))
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].Time.Before(snaps[j].Time) })
+	return snaps, nil
+}
 
-	// Read encrypted data from file
-	encryptedData, err := os.ReadFile(backupFile)
+// Snapshots returns the backup catalogue, oldest first.
+func (bm *BackupManager) Snapshots() ([]*Snapshot, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read backup file: %w", err)
+		return nil, err
 	}
+	return bm.snapshotsLocked(keys)
+}
 
-	// Decrypt the data
-	data, err := bm.decryptData(encryptedData)
+// RestoreBackup returns the data stored in a snapshot.
+func (bm *BackupManager) RestoreBackup(snapshotID string) (*BackupData, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.logger.Info("Restoring from encrypted backup", "snapshot", snapshotID)
+
+	keys, err := bm.openLocked()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup repository: %w", err)
+	}
+	snap, err := bm.loadSnapshot(keys, snapshotID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt backup data: %w", err)
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := bm.writeChunks(keys, &buf, snap.Data); err != nil {
+		return nil, fmt.Errorf("failed to read backup data: %w", err)
 	}
 
 	// Deserialize backup data
 	var backupData BackupData
-	err = json.Unmarshal(data, &backupData)
-	if err != nil {
+	if err := json.Unmarshal(buf.Bytes(), &backupData); err != nil {
 		return nil, fmt.Errorf("failed to deserialize backup data: %w", err)
 	}
 
@@ -126,123 +547,321 @@ func (bm *BackupManager) RestoreBackup(backupFile string) (*BackupData, error) {
 	if !bm.verifyChecksum(verificationPayload, storedChecksum) {
 		return nil, fmt.Errorf("backup checksum verification failed")
 	}
+	backupData.Checksum = storedChecksum
 
 	bm.logger.Info("Backup restored successfully", "timestamp", backupData.Timestamp)
 	return &backupData, nil
 }
 
-// ListBackups lists all available backups
+// RestoreFiles writes the files of a snapshot under target, at their
+// snapshot paths.
+func (bm *BackupManager) RestoreFiles(snapshotID, target string) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.logger.Info("Restoring files from backup", "snapshot", snapshotID, "target", target)
+
+	keys, err := bm.openLocked()
+	if err != nil {
+		return fmt.Errorf("failed to open backup repository: %w", err)
+	}
+	snap, err := bm.loadSnapshot(keys, snapshotID)
+	if err != nil {
+		return err
+	}
+	var dirs []FileEntry
+	for _, entry := range snap.Files {
+		rel := path.Clean(entry.Path)
+		if path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("snapshot %s has unsafe path %q", snapshotID, entry.Path)
+		}
+		dest := filepath.Join(target, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return err
+		}
+		switch entry.Type {
+		case "dir":
+			if err := os.MkdirAll(dest, 0700); err != nil {
+				return err
+			}
+			dirs = append(dirs, entry)
+			continue
+		case "symlink":
+			_ = os.Remove(dest)
+			if err := os.Symlink(entry.Target, dest); err != nil {
+				return err
+			}
+			continue
+		case "file":
+			if err := bm.restoreFile(keys, dest, entry); err != nil {
+				return fmt.Errorf("failed to restore %s: %w", entry.Path, err)
+			}
+		}
+	}
+	// Directory modes and times are set last, since writing their
+	// contents changes them.
+	for i := len(dirs) - 1; i >= 0; i-- {
+		dest := filepath.Join(target, filepath.FromSlash(path.Clean(dirs[i].Path)))
+		_ = os.Chmod(dest, dirs[i].Mode.Perm())
+		_ = os.Chtimes(dest, dirs[i].ModTime, dirs[i].ModTime)
+	}
+	return nil
+}
+
+func (bm *BackupManager) restoreFile(keys *repoKeys, dest string, entry FileEntry) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".restore-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if err := bm.writeChunks(keys, tmp, entry.Chunks); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), entry.Mode.Perm()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, entry.ModTime, entry.ModTime)
+}
+
+// ListBackups lists the snapshot IDs, oldest first.
 func (bm *BackupManager) ListBackups() ([]string, error) {
 	bm.logger.Info("Listing available backups")
 
-	// Read directory
-	entries, err := os.ReadDir(bm.backupDir)
+	snaps, err := bm.Snapshots()
 	if err != nil {
-		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+		return nil, fmt.Errorf("failed to read backup catalogue: %w", err)
 	}
-
-	// Filter for backup files
-	var backups []string
-	for _, entry := range entries {
-		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".enc" {
-			backups = append(backups, filepath.Join(bm.backupDir, entry.Name()))
-		}
+	backups := make([]string, 0, len(snaps))
+	for _, s := range snaps {
+		backups = append(backups, s.ID)
 	}
 
 	bm.logger.Info("Found backups", "count", len(backups))
 	return backups, nil
 }
 
-// DeleteBackup deletes a backup file
-func (bm *BackupManager) DeleteBackup(backupFile string) error {
-	bm.logger.Info("Deleting backup", "file", backupFile)
+// DeleteBackup removes a snapshot from the catalogue. Its chunks are
+// removed by the next Prune unless another snapshot uses them.
+func (bm *BackupManager) DeleteBackup(snapshotID string) error {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	bm.logger.Info("Deleting backup", "snapshot", snapshotID)
 
-	err := os.Remove(backupFile)
+	if !validObjectID(snapshotID) {
+		return fmt.Errorf("invalid snapshot ID %q", snapshotID)
+	}
+	exists, err := bm.store.Exists(snapshotName(snapshotID))
 	if err != nil {
-		return fmt.Errorf("failed to delete backup file: %w", err)
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("failed to delete backup: snapshot %s not found", snapshotID)
+	}
+	if err := bm.store.Remove(snapshotName(snapshotID)); err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
 	}
 
-	bm.logger.Info("Backup deleted successfully", "file", backupFile)
+	bm.logger.Info("Backup deleted successfully", "snapshot", snapshotID)
 	return nil
 }
 
-// encryptData encrypts data using AES-GCM with a passphrase-derived key
-func (bm *BackupManager) encryptData(data []byte) ([]byte, error) {
-	// Derive key from passphrase
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
-		return nil, fmt.Errorf("failed to generate salt: %w", err)
+// Forget removes the snapshots policy does not keep and returns their IDs.
+func (bm *BackupManager) Forget(policy RetentionPolicy) ([]string, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
+	if err != nil {
+		return nil, err
 	}
-
-	key := pbkdf2.Key([]byte(bm.passphrase), salt, 10000, 32, sha256.New)
-
-	// Create cipher
-	block, err := aes.NewCipher(key)
+	snaps, err := bm.snapshotsLocked(keys)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, err
 	}
+	_, remove := policy.apply(snaps)
+	var removed []string
+	for _, s := range remove {
+		if err := bm.store.Remove(snapshotName(s.ID)); err != nil {
+			return removed, fmt.Errorf("failed to remove snapshot %s: %w", s.ID, err)
+		}
+		removed = append(removed, s.ID)
+	}
+	if len(removed) > 0 {
+		bm.logger.Info("Removed snapshots outside the retention policy", "count", len(removed))
+	}
+	return removed, nil
+}
 
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
+// Prune removes chunks that no snapshot references and returns how many
+// were removed.
+func (bm *BackupManager) Prune() (int, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return 0, err
 	}
-
-	// Generate nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	snaps, err := bm.snapshotsLocked(keys)
+	if err != nil {
+		// Never prune against a partial catalogue.
+		return 0, err
 	}
+	used := referencedChunks(snaps)
+	names, err := bm.store.List(repoDataDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	removed := 0
+	for _, name := range names {
+		if used[path.Base(name)] {
+			continue
+		}
+		if err := bm.store.Remove(name); err != nil {
+			return removed, fmt.Errorf("failed to remove chunk: %w", err)
+		}
+		removed++
+	}
+	if removed > 0 {
+		bm.logger.Info("Pruned unreferenced chunks", "count", removed)
+	}
+	return removed, nil
+}
 
-	// Encrypt data
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
-
-	// Prepend salt to ciphertext
-	result := append(salt, ciphertext...)
-
-	return result, nil
+// Maintain applies the retention policy and prunes the chunks it frees.
+func (bm *BackupManager) Maintain() error {
+	bm.mu.Lock()
+	policy := bm.retention
+	bm.mu.Unlock()
+	if policy.IsZero() {
+		return nil
+	}
+	if _, err := bm.Forget(policy); err != nil {
+		return err
+	}
+	_, err := bm.Prune()
+	return err
 }
 
-// decryptData decrypts data using AES-GCM with a passphrase-derived key
-func (bm *BackupManager) decryptData(encryptedData []byte) ([]byte, error) {
-	// Extract salt (first 16 bytes)
-	if len(encryptedData) < 16 {
-		return nil, fmt.Errorf("encrypted data too short")
+func referencedChunks(snaps []*Snapshot) map[string]bool {
+	used := make(map[string]bool)
+	for _, s := range snaps {
+		for _, id := range s.Data {
+			used[id] = true
+		}
+		for _, f := range s.Files {
+			for _, id := range f.Chunks {
+				used[id] = true
+			}
+		}
 	}
+	return used
+}
 
-	salt := encryptedData[:16]
-	ciphertext := encryptedData[16:]
+// CheckResult reports the consistency of a backup repository.
+type CheckResult struct {
+	Snapshots    int      `json:"snapshots"`
+	Chunks       int      `json:"chunks"`            // chunks referenced by snapshots
+	Unreferenced int      `json:"unreferenced"`      // stored chunks no snapshot uses
+	Missing      []string `json:"missing,omitempty"` // referenced chunks not stored
+	Corrupt      []string `json:"corrupt,omitempty"` // chunks that fail decryption or do not match their ID
+	Errors       []string `json:"errors,omitempty"`  // snapshots that cannot be read
+	ReadData     bool     `json:"read_data"`         // whether every chunk was read and verified
+	Duration     string   `json:"duration,omitempty"`
+}
 
-	// Derive key from passphrase
-	key := pbkdf2.Key([]byte(bm.passphrase), salt, 10000, 32, sha256.New)
+// OK reports whether every snapshot can be restored.
+func (r *CheckResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Corrupt) == 0 && len(r.Errors) == 0
+}
 
-	// Create cipher
-	block, err := aes.NewCipher(key)
+// Check verifies that every snapshot can be read and that every chunk it
+// references is stored. With readData every stored chunk is also decrypted
+// and checked against its ID.
+func (bm *BackupManager) Check(readData bool) (*CheckResult, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	start := time.Now()
+	keys, err := bm.openLocked()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
+		return nil, err
 	}
+	result := &CheckResult{ReadData: readData}
 
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
+	names, err := bm.store.List(repoSnapshotDir)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var snaps []*Snapshot
+	for _, name := range names {
+		snap, err := bm.loadSnapshot(keys, path.Base(name))
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			continue
+		}
+		snaps = append(snaps, snap)
 	}
+	result.Snapshots = len(snaps)
 
-	// Extract nonce
-	nonceSize := gcm.NonceSize()
-	if len(ciphertext) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
+	chunkNames, err := bm.store.List(repoDataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chunks: %w", err)
+	}
+	stored := make(map[string]bool, len(chunkNames))
+	for _, name := range chunkNames {
+		stored[path.Base(name)] = true
 	}
+	used := referencedChunks(snaps)
+	result.Chunks = len(used)
+	for id := range used {
+		if !stored[id] {
+			result.Missing = append(result.Missing, id)
+		}
+	}
+	for id := range stored {
+		if !used[id] {
+			result.Unreferenced++
+		}
+		if readData {
+			if _, err := bm.loadChunk(keys, id); err != nil {
+				result.Corrupt = append(result.Corrupt, id)
+			}
+		}
+	}
+	sort.Strings(result.Missing)
+	sort.Strings(result.Corrupt)
+	result.Duration = time.Since(start).String()
 
-	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+	if !result.OK() {
+		bm.logger.Warn("Backup repository check found problems", "missing", len(result.Missing), "corrupt", len(result.Corrupt), "errors", len(result.Errors))
+	}
+	return result, nil
+}
 
-	// Decrypt data
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+// encryptData encrypts data with the repository key
+func (bm *BackupManager) encryptData(data []byte) ([]byte, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		return nil, err
 	}
+	return keys.seal(data)
+}
 
-	return plaintext, nil
+// decryptData decrypts data sealed by encryptData
+func (bm *BackupManager) decryptData(encryptedData []byte) ([]byte, error) {
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
+	if err != nil {
+		return nil, err
+	}
+	return keys.open(encryptedData)
 }
 
 // calculateChecksum calculates SHA-256 checksum of data
@@ -257,7 +876,8 @@ func (bm *BackupManager) verifyChecksum(data []byte, expectedChecksum string) bo
 	return actualChecksum == expectedChecksum
 }
 
-// ScheduleAutomaticBackups runs automatic backups at regular intervals until ctx is canceled.
+// ScheduleAutomaticBackups runs automatic backups at regular intervals until
+// ctx is canceled, applying the retention policy after each one.
 func (bm *BackupManager) ScheduleAutomaticBackups(ctx context.Context, interval time.Duration, config, state, criticalData map[string]interface{}) {
 	bm.logger.Info("Starting automatic backups", "interval", interval)
 	ticker := time.NewTicker(interval)
@@ -269,27 +889,14 @@ func (bm *BackupManager) ScheduleAutomaticBackups(ctx context.Context, interval
 			bm.logger.Info("Automatic backups stopped")
 			return
 		case <-ticker.C:
-			path, err := bm.CreateBackup(config, state, criticalData)
+			id, err := bm.CreateBackup(config, state, criticalData)
 			if err != nil {
 				bm.logger.Error("Automatic backup failed", "error", err)
 				continue
 			}
-			bm.logger.Info("Automatic backup created", "file", path)
-			bm.cleanupOldBackups(10)
-		}
-	}
-}
-
-func (bm *BackupManager) cleanupOldBackups(maxBackups int) {
-	backups, err := bm.ListBackups()
-	if err != nil {
-		bm.logger.Error("Failed to list backups for cleanup", "error", err)
-		return
-	}
-	if len(backups) > maxBackups {
-		for _, b := range backups[:len(backups)-maxBackups] {
-			if err := bm.DeleteBackup(b); err != nil {
-				bm.logger.Error("Failed to delete old backup", "file", b, "error", err)
+			bm.logger.Info("Automatic backup created", "snapshot", id)
+			if err := bm.Maintain(); err != nil && !errors.Is(err, context.Canceled) {
+				bm.logger.Error("Failed to apply backup retention", "error", err)
 			}
 		}
 	}
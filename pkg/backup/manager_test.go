@@ -2,6 +2,7 @@ package backup
 
 import (
 	"log/slog"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"testing"
@@ -51,7 +52,8 @@ func TestCreateRestoreBackup(t *testing.T) {
 	backupFile, err := backupManager.CreateBackup(config, state, criticalData)
 	require.NoError(t, err, "Failed to create backup")
 
-	assert.FileExists(t, backupFile, "Backup file was not created")
+	snapshotFile := filepath.Join(tempDir, "snapshots", backupFile)
+	assert.FileExists(t, snapshotFile, "Snapshot was not created")
 
 	backups, err := backupManager.ListBackups()
 	assert.NoError(t, err, "Failed to list backups")
@@ -66,7 +68,7 @@ func TestCreateRestoreBackup(t *testing.T) {
 	err = backupManager.DeleteBackup(backupFile)
 	assert.NoError(t, err, "Failed to delete backup")
 
-	if _, err := os.Stat(backupFile); !os.IsNotExist(err) {
+	if _, err := os.Stat(snapshotFile); !os.IsNotExist(err) {
 		assert.True(t, os.IsNotExist(err), "Backup file was not deleted")
 	}
 }
@@ -84,18 +86,14 @@ func TestListBackups(t *testing.T) {
 	assert.NoError(t, err, "Failed to list backups")
 	assert.Equal(t, 0, len(backups))
 
-	testFile := filepath.Join(tempDir, "test.txt")
-	err = os.WriteFile(testFile, []byte("test content"), 0644)
+	first, err := backupManager.CreateBackup(nil, nil, nil)
 	require.NoError(t, err)
-
-	backupFile := filepath.Join(tempDir, "backup_20230101_120000.enc")
-	err = os.WriteFile(backupFile, []byte("encrypted backup data"), 0600)
+	second, err := backupManager.CreateBackup(nil, nil, nil)
 	require.NoError(t, err)
 
 	backups, err = backupManager.ListBackups()
 	assert.NoError(t, err, "Failed to list backups")
-	assert.Equal(t, 1, len(backups))
-	assert.Equal(t, backupFile, backups[0])
+	assert.Equal(t, []string{first, second}, backups)
 }
 
 func TestEncryptionDecryption(t *testing.T) {
@@ -135,3 +133,166 @@ func TestChecksum(t *testing.T) {
 	wrongData := []byte("This is wrong data")
 	assert.False(t, backupManager.verifyChecksum(wrongData, checksum), "Checksum verification should fail for incorrect data")
 }
+
+func writeTestTree(t *testing.T, dir string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "modules"), 0755))
+	big := make([]byte, 2<<20)
+	_, err := rand.New(rand.NewSource(1)).Read(big)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "modules", "big.wasm"), big, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "modules", "manifest.yaml"), []byte("name: big\n"), 0600))
+	require.NoError(t, os.Symlink("big.wasm", filepath.Join(dir, "modules", "current.wasm")))
+}
+
+func TestBackupFilesIncrementalAndDeduplicated(t *testing.T) {
+	src := t.TempDir()
+	writeTestTree(t, src)
+	bm := NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	bm.SetPaths(filepath.Join(src, "modules"))
+
+	first, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	snaps, err := bm.Snapshots()
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	stats := snaps[0].Stats
+	assert.Equal(t, 4, stats.Files)
+	assert.Greater(t, stats.NewChunks, 4, "a 2 MiB file should span several chunks")
+	assert.Zero(t, stats.Unchanged)
+
+	// An unchanged tree is not read again and stores nothing new.
+	second, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	snaps, err = bm.Snapshots()
+	require.NoError(t, err)
+	require.Len(t, snaps, 2)
+	assert.Equal(t, first, snaps[1].Parent)
+	assert.Equal(t, 2, snaps[1].Stats.Unchanged)
+	assert.LessOrEqual(t, snaps[1].Stats.NewChunks, 1, "only the data chunk may differ")
+
+	// Inserting bytes near the start of a file only rewrites the chunks
+	// around the insertion.
+	wasm := filepath.Join(src, "modules", "big.wasm")
+	data, err := os.ReadFile(wasm)
+	require.NoError(t, err)
+	edited := append(append(append([]byte{}, data[:1000]...), []byte("inserted")...), data[1000:]...)
+	require.NoError(t, os.WriteFile(wasm, edited, 0644))
+
+	third, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	snaps, err = bm.Snapshots()
+	require.NoError(t, err)
+	assert.Equal(t, second, snaps[2].Parent)
+	assert.Less(t, snaps[2].Stats.NewChunks, snaps[2].Stats.Chunks/2)
+
+	target := t.TempDir()
+	require.NoError(t, bm.RestoreFiles(third, target))
+	restored := filepath.Join(target, entryPath(wasm))
+	got, err := os.ReadFile(restored)
+	require.NoError(t, err)
+	assert.Equal(t, edited, got)
+	link, err := os.Readlink(filepath.Join(filepath.Dir(restored), "current.wasm"))
+	require.NoError(t, err)
+	assert.Equal(t, "big.wasm", link)
+	info, err := os.Stat(filepath.Join(filepath.Dir(restored), "manifest.yaml"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	require.NoError(t, bm.RestoreFiles(first, target))
+	got, err = os.ReadFile(restored)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestBackupMissingPathIsSkipped(t *testing.T) {
+	bm := NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	bm.SetPaths(filepath.Join(t.TempDir(), "audit.jsonl"))
+	_, err := bm.CreateBackup(map[string]interface{}{"a": "b"}, nil, nil)
+	assert.NoError(t, err)
+}
+
+func TestWrongPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	_, err := NewBackupManager(slog.Default(), dir, "right").CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+
+	_, err = NewBackupManager(slog.Default(), dir, "wrong").ListBackups()
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
+
+func TestCheckAndPrune(t *testing.T) {
+	src := t.TempDir()
+	writeTestTree(t, src)
+	dir := t.TempDir()
+	bm := NewBackupManager(slog.Default(), dir, "test-passphrase")
+	bm.SetPaths(src)
+
+	first, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	result, err := bm.Check(true)
+	require.NoError(t, err)
+	assert.True(t, result.OK())
+	assert.Equal(t, 1, result.Snapshots)
+	assert.Zero(t, result.Unreferenced)
+
+	// Deleting the only snapshot leaves every chunk unreferenced until
+	// the next prune.
+	require.NoError(t, os.WriteFile(filepath.Join(src, "modules", "big.wasm"), []byte("small now"), 0644))
+	second, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, bm.DeleteBackup(first))
+	result, err = bm.Check(false)
+	require.NoError(t, err)
+	assert.True(t, result.OK())
+	assert.Greater(t, result.Unreferenced, 0)
+
+	removed, err := bm.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, result.Unreferenced, removed)
+
+	snaps, err := bm.Snapshots()
+	require.NoError(t, err)
+	require.Len(t, snaps, 1)
+	var chunks []string
+	for _, f := range snaps[0].Files {
+		chunks = append(chunks, f.Chunks...)
+	}
+	require.GreaterOrEqual(t, len(chunks), 2)
+
+	// A missing chunk is found without reading data; a corrupt one only
+	// when reading it.
+	require.NoError(t, os.Remove(filepath.Join(dir, filepath.FromSlash(chunkName(chunks[0])))))
+	corrupt := filepath.Join(dir, filepath.FromSlash(chunkName(chunks[1])))
+	sealed, err := os.ReadFile(corrupt)
+	require.NoError(t, err)
+	sealed[len(sealed)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(corrupt, sealed, 0600))
+
+	result, err = bm.Check(false)
+	require.NoError(t, err)
+	assert.False(t, result.OK())
+	assert.Equal(t, []string{chunks[0]}, result.Missing)
+	assert.Empty(t, result.Corrupt)
+
+	result, err = bm.Check(true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{chunks[1]}, result.Corrupt)
+
+	assert.Error(t, bm.RestoreFiles(second, t.TempDir()))
+}
+
+func TestRestoreFilesRejectsUnsafePaths(t *testing.T) {
+	bm := NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	bm.mu.Lock()
+	keys, err := bm.openLocked()
+	require.NoError(t, err)
+	snap := &Snapshot{ID: "abcd", Files: []FileEntry{{Path: "../escape", Type: "dir", Mode: os.ModeDir | 0755}}}
+	require.NoError(t, bm.saveSnapshot(keys, snap))
+	bm.mu.Unlock()
+
+	target := t.TempDir()
+	err = bm.RestoreFiles("abcd", filepath.Join(target, "inner"))
+	assert.ErrorContains(t, err, "unsafe path")
+	assert.NoDirExists(t, filepath.Join(target, "escape"))
+}
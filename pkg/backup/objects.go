@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// repoObjectDir holds named objects that other components keep in the
+// repository, such as recovery snapshots.
+const repoObjectDir = "objects"
+
+// namedObject is the plaintext of a stored object. The name is sealed with
+// the data, so a target cannot pass one object off as another.
+type namedObject struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+func objectName(name string) (string, error) {
+	// Targets skip temporary files such as .tmp-* when listing.
+	if !ValidObjectName(name) || strings.HasPrefix(path.Base(name), ".tmp-") {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return repoObjectDir + "/" + name, nil
+}
+
+// SaveObject stores data under name, encrypted and authenticated with the
+// repository keys, on every target of the repository. name is a
+// slash-separated path such as "recovery-snapshots/a.json".
+func (bm *BackupManager) SaveObject(name string, data []byte) error {
+	stored, err := objectName(name)
+	if err != nil {
+		return err
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(namedObject{Name: name, Data: data})
+	if err != nil {
+		return err
+	}
+	sealed, err := keys.seal(plain)
+	if err != nil {
+		return err
+	}
+	if err := bm.store.Save(stored, sealed); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", name, err)
+	}
+	return nil
+}
+
+// LoadObject returns the object stored under name. It returns an error
+// satisfying errors.Is(err, fs.ErrNotExist) when there is none, and fails
+// for an object that was not sealed under name with the repository keys.
+func (bm *BackupManager) LoadObject(name string) ([]byte, error) {
+	stored, err := objectName(name)
+	if err != nil {
+		return nil, err
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	keys, err := bm.openLocked()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := bm.store.Load(stored)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, notFound(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object %s: %w", name, err)
+	}
+	plain, err := keys.open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("object %s: %w", name, err)
+	}
+	var obj namedObject
+	if err := json.Unmarshal(plain, &obj); err != nil {
+		return nil, fmt.Errorf("failed to parse object %s: %w", name, err)
+	}
+	if obj.Name != name {
+		return nil, fmt.Errorf("object %s is stored as %s", obj.Name, name)
+	}
+	return obj.Data, nil
+}
+
+// RemoveObject removes the object stored under name; removing a missing
+// object succeeds.
+func (bm *BackupManager) RemoveObject(name string) error {
+	stored, err := objectName(name)
+	if err != nil {
+		return err
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	if err := bm.store.Remove(stored); err != nil {
+		return fmt.Errorf("failed to remove object %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListObjects returns the names of the objects stored under dir.
+func (bm *BackupManager) ListObjects(dir string) ([]string, error) {
+	stored, err := objectName(dir)
+	if err != nil {
+		return nil, err
+	}
+	bm.mu.Lock()
+	defer bm.mu.Unlock()
+	list, err := bm.store.List(stored)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
+	}
+	names := make([]string, 0, len(list))
+	for _, name := range list {
+		names = append(names, strings.TrimPrefix(name, repoObjectDir+"/"))
+	}
+	return names, nil
+}
@@ -0,0 +1,50 @@
+package backup
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestObjects(t *testing.T) {
+	remote := NewMemoryTarget()
+	bm := NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	bm.SetTarget(NewMirrorTarget(NewMemoryTarget(), remote))
+
+	require.NoError(t, bm.SaveObject("recovery-snapshots/a.json", []byte(`{"secret":"a"}`)))
+	require.NoError(t, bm.SaveObject("recovery-snapshots/b.json", []byte(`{"secret":"b"}`)))
+	data, err := bm.LoadObject("recovery-snapshots/a.json")
+	require.NoError(t, err)
+	assert.Equal(t, `{"secret":"a"}`, string(data))
+	names, err := bm.ListObjects("recovery-snapshots")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"recovery-snapshots/a.json", "recovery-snapshots/b.json"}, names)
+
+	// Remote copies are sealed and bound to their names.
+	sealed, err := remote.Load("objects/recovery-snapshots/a.json")
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "secret")
+	other, err := remote.Load("objects/recovery-snapshots/b.json")
+	require.NoError(t, err)
+	cfg, err := remote.Load("config")
+	require.NoError(t, err)
+	swappedTarget := NewMemoryTarget()
+	require.NoError(t, swappedTarget.Save("config", cfg))
+	require.NoError(t, swappedTarget.Save("objects/recovery-snapshots/a.json", other))
+	swapped := NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	swapped.SetTarget(swappedTarget)
+	_, err = swapped.LoadObject("recovery-snapshots/a.json")
+	assert.ErrorContains(t, err, "stored as")
+	require.NoError(t, swappedTarget.Save("objects/recovery-snapshots/a.json", []byte(`{"secret":"forged"}`)))
+	_, err = swapped.LoadObject("recovery-snapshots/a.json")
+	assert.Error(t, err)
+
+	require.NoError(t, bm.RemoveObject("recovery-snapshots/a.json"))
+	_, err = bm.LoadObject("recovery-snapshots/a.json")
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "removed object: %v", err)
+	assert.Error(t, bm.SaveObject("../escape", nil))
+}
@@ -0,0 +1,379 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMinReputation is the default reputation a peer must exceed to hold
+// or lend backup storage: the score of a peer with no history, so a peer
+// nothing is known about is never trusted by default.
+const DefaultMinReputation = 50.0
+
+// PeerConfig configures a peer target.
+type PeerConfig struct {
+	Replicas      int      `yaml:"replicas"`       // peers holding each object, defaults to 2
+	MinReputation float64  `yaml:"min_reputation"` // score a peer must exceed, defaults to DefaultMinReputation
+	TrustedPeers  []string `yaml:"trusted_peers"`  // peer IDs trusted regardless of reputation
+}
+
+// PeerStorageConfig controls the space an agent lends to other agents'
+// backups.
+type PeerStorageConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	Dir           string   `yaml:"dir"`            // defaults to "backups-peers"
+	Quota         int64    `yaml:"quota"`          // bytes per peer, defaults to 1 GiB
+	MinReputation float64  `yaml:"min_reputation"` // score a peer must exceed, defaults to DefaultMinReputation
+	TrustedPeers  []string `yaml:"trusted_peers"`  // peer IDs trusted regardless of reputation
+}
+
+// TrustedPeer reports whether a peer with the given reputation score may
+// hold or lend backup storage: it is listed in trusted, or its score is
+// strictly above minReputation.
+func TrustedPeer(trusted []string, minReputation float64, peerID string, score float64) bool {
+	for _, id := range trusted {
+		if id == peerID {
+			return true
+		}
+	}
+	return score > minReputation
+}
+
+// PeerStore moves repository objects to and from the storage other agents
+// lend. Names are the target's object names.
+type PeerStore interface {
+	PutObject(ctx context.Context, peerID, name string, data []byte) error
+	// GetObject returns an error satisfying errors.Is(err, fs.ErrNotExist)
+	// when the peer does not hold the object.
+	GetObject(ctx context.Context, peerID, name string) ([]byte, error)
+	DeleteObject(ctx context.Context, peerID, name string) error
+	ListObjects(ctx context.Context, peerID, dir string) ([]string, error)
+	HasObject(ctx context.Context, peerID, name string) (bool, error)
+}
+
+// PeerTarget replicates objects to trusted peers. Objects are encrypted
+// before they leave the agent, so peers hold ciphertext they cannot read,
+// and every chunk is checked against its keyed ID when it comes back.
+type PeerTarget struct {
+	// Store carries the requests.
+	Store PeerStore
+	// Peers returns the candidate peers, most trusted first.
+	Peers func() []string
+	// Replicas is how many peers hold each object. Defaults to 2.
+	Replicas int
+	// Timeout bounds each request. Defaults to 30s.
+	Timeout time.Duration
+	// OnResult, when set, is called after each request to a peer, so the
+	// caller can feed the outcome into peer reputation.
+	OnResult func(peerID string, err error)
+}
+
+func (t *PeerTarget) replicas() int {
+	if t.Replicas <= 0 {
+		return 2
+	}
+	return t.Replicas
+}
+
+func (t *PeerTarget) ctx() (context.Context, context.CancelFunc) {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+func (t *PeerTarget) report(peerID string, err error) {
+	if t.OnResult != nil {
+		t.OnResult(peerID, err)
+	}
+}
+
+func (t *PeerTarget) peers() ([]string, error) {
+	peers := t.Peers()
+	if len(peers) == 0 {
+		return nil, fmt.Errorf("no trusted peers available for backup")
+	}
+	return peers, nil
+}
+
+// Save stores the object on the first Replicas peers that accept it.
+func (t *PeerTarget) Save(name string, data []byte) error {
+	if !ValidObjectName(name) {
+		return fmt.Errorf("invalid object name %q", name)
+	}
+	peers, err := t.peers()
+	if err != nil {
+		return err
+	}
+	stored := 0
+	var errs []error
+	for _, p := range peers {
+		if stored == t.replicas() {
+			break
+		}
+		ctx, cancel := t.ctx()
+		err := t.Store.PutObject(ctx, p, name, data)
+		cancel()
+		t.report(p, err)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("peer %s: %w", p, err))
+			continue
+		}
+		stored++
+	}
+	if stored == 0 {
+		return fmt.Errorf("no peer accepted %s: %w", name, errors.Join(errs...))
+	}
+	return nil
+}
+
+// Load returns the object from the first peer that has it.
+func (t *PeerTarget) Load(name string) ([]byte, error) {
+	peers, err := t.peers()
+	if err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, p := range peers {
+		ctx, cancel := t.ctx()
+		data, err := t.Store.GetObject(ctx, p, name)
+		cancel()
+		if err == nil {
+			t.report(p, nil)
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.report(p, err)
+			errs = append(errs, fmt.Errorf("peer %s: %w", p, err))
+		}
+	}
+	if len(errs) == 0 {
+		return nil, notFound(name)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// Remove deletes the object from every candidate peer.
+func (t *PeerTarget) Remove(name string) error {
+	peers, err := t.peers()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, p := range peers {
+		ctx, cancel := t.ctx()
+		err := t.Store.DeleteObject(ctx, p, name)
+		cancel()
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, fmt.Errorf("peer %s: %w", p, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Exists reports whether enough peers hold the object: Replicas of them, or
+// every candidate when there are fewer. An object held by too few is saved
+// again, which restores replication after peers leave.
+func (t *PeerTarget) Exists(name string) (bool, error) {
+	peers, err := t.peers()
+	if err != nil {
+		return false, err
+	}
+	want := min(t.replicas(), len(peers))
+	held := 0
+	for _, p := range peers {
+		ctx, cancel := t.ctx()
+		ok, err := t.Store.HasObject(ctx, p, name)
+		cancel()
+		if err != nil {
+			t.report(p, err)
+			continue
+		}
+		if ok {
+			held++
+			if held == want {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// List returns the objects held by any candidate peer.
+func (t *PeerTarget) List(dir string) ([]string, error) {
+	peers, err := t.peers()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var names []string
+	listed := 0
+	var errs []error
+	for _, p := range peers {
+		ctx, cancel := t.ctx()
+		list, err := t.Store.ListObjects(ctx, p, dir)
+		cancel()
+		if err != nil {
+			t.report(p, err)
+			errs = append(errs, fmt.Errorf("peer %s: %w", p, err))
+			continue
+		}
+		listed++
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if listed == 0 {
+		return nil, errors.Join(errs...)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ErrQuotaExceeded is returned when a peer's objects would exceed the space
+// lent to it.
+var ErrQuotaExceeded = errors.New("backup quota exceeded")
+
+// PeerHost keeps the backup objects of other agents, each peer in its own
+// directory and within a per-peer quota.
+type PeerHost struct {
+	dir   string
+	quota int64
+
+	mu   sync.Mutex
+	used map[string]int64 // bytes stored per peer, computed on first use
+}
+
+// NewPeerHost keeps peers' objects under dir, allowing each peer quota
+// bytes.
+func NewPeerHost(dir string, quota int64) *PeerHost {
+	return &PeerHost{dir: dir, quota: quota, used: make(map[string]int64)}
+}
+
+func (h *PeerHost) target(peerID string) (*DirTarget, error) {
+	if peerID == "" || strings.ContainsAny(peerID, `/\`) || peerID == "." || peerID == ".." {
+		return nil, fmt.Errorf("invalid peer ID %q", peerID)
+	}
+	return NewDirTarget(filepath.Join(h.dir, peerID)), nil
+}
+
+// usage returns the bytes a peer stores. h.mu must be held.
+func (h *PeerHost) usage(peerID string, t *DirTarget) (int64, error) {
+	if used, ok := h.used[peerID]; ok {
+		return used, nil
+	}
+	var used int64
+	err := filepath.WalkDir(t.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == t.dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			used += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	h.used[peerID] = used
+	return used, nil
+}
+
+func (h *PeerHost) objectSize(t *DirTarget, name string) int64 {
+	p, err := t.path(name)
+	if err != nil {
+		return 0
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Put stores an object for a peer.
+func (h *PeerHost) Put(peerID, name string, data []byte) error {
+	t, err := h.target(peerID)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	used, err := h.usage(peerID, t)
+	if err != nil {
+		return err
+	}
+	used += int64(len(data)) - h.objectSize(t, name)
+	if h.quota > 0 && used > h.quota {
+		return ErrQuotaExceeded
+	}
+	if err := t.Save(name, data); err != nil {
+		return err
+	}
+	h.used[peerID] = used
+	return nil
+}
+
+// Get returns an object a peer stored.
+func (h *PeerHost) Get(peerID, name string) ([]byte, error) {
+	t, err := h.target(peerID)
+	if err != nil {
+		return nil, err
+	}
+	return t.Load(name)
+}
+
+// Has reports whether a peer stored an object.
+func (h *PeerHost) Has(peerID, name string) (bool, error) {
+	t, err := h.target(peerID)
+	if err != nil {
+		return false, err
+	}
+	return t.Exists(name)
+}
+
+// Delete removes an object a peer stored.
+func (h *PeerHost) Delete(peerID, name string) error {
+	t, err := h.target(peerID)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	size := h.objectSize(t, name)
+	if err := t.Remove(name); err != nil {
+		return err
+	}
+	if used, ok := h.used[peerID]; ok {
+		h.used[peerID] = used - size
+	}
+	return nil
+}
+
+// List lists the objects a peer stored under dir.
+func (h *PeerHost) List(peerID, dir string) ([]string, error) {
+	t, err := h.target(peerID)
+	if err != nil {
+		return nil, err
+	}
+	return t.List(dir)
+}
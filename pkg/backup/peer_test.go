@@ -0,0 +1,200 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePeerStore lends each peer a MemoryTarget. Peers listed in down fail
+// every request.
+type fakePeerStore struct {
+	mu    sync.Mutex
+	peers map[string]*MemoryTarget
+	down  map[string]bool
+}
+
+func newFakePeerStore(peers ...string) *fakePeerStore {
+	s := &fakePeerStore{peers: map[string]*MemoryTarget{}, down: map[string]bool{}}
+	for _, p := range peers {
+		s.peers[p] = NewMemoryTarget()
+	}
+	return s
+}
+
+func (s *fakePeerStore) peer(id string) (*MemoryTarget, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.down[id] {
+		return nil, errors.New("peer unreachable")
+	}
+	return s.peers[id], nil
+}
+
+func (s *fakePeerStore) PutObject(_ context.Context, id, name string, data []byte) error {
+	p, err := s.peer(id)
+	if err != nil {
+		return err
+	}
+	return p.Save(name, data)
+}
+
+func (s *fakePeerStore) GetObject(_ context.Context, id, name string) ([]byte, error) {
+	p, err := s.peer(id)
+	if err != nil {
+		return nil, err
+	}
+	return p.Load(name)
+}
+
+func (s *fakePeerStore) DeleteObject(_ context.Context, id, name string) error {
+	p, err := s.peer(id)
+	if err != nil {
+		return err
+	}
+	return p.Remove(name)
+}
+
+func (s *fakePeerStore) ListObjects(_ context.Context, id, dir string) ([]string, error) {
+	p, err := s.peer(id)
+	if err != nil {
+		return nil, err
+	}
+	return p.List(dir)
+}
+
+func (s *fakePeerStore) HasObject(_ context.Context, id, name string) (bool, error) {
+	p, err := s.peer(id)
+	if err != nil {
+		return false, err
+	}
+	return p.Exists(name)
+}
+
+func TestPeerTarget(t *testing.T) {
+	store := newFakePeerStore("a", "b", "c")
+	testTarget(t, &PeerTarget{Store: store, Peers: func() []string { return []string{"a", "b", "c"} }})
+}
+
+func TestPeerTargetReplicatesToTrustedPeers(t *testing.T) {
+	store := newFakePeerStore("a", "b", "c")
+	store.down["a"] = true
+	results := map[string]int{}
+	target := &PeerTarget{
+		Store: store,
+		Peers: func() []string { return []string{"a", "b", "c"} },
+		OnResult: func(peerID string, err error) {
+			if err != nil {
+				results[peerID]--
+			} else {
+				results[peerID]++
+			}
+		},
+	}
+
+	// The unreachable peer is skipped and the next ones take the replicas.
+	require.NoError(t, target.Save("data/ab/ab01", []byte("chunk")))
+	for _, p := range []string{"b", "c"} {
+		ok, _ := store.peers[p].Exists("data/ab/ab01")
+		assert.True(t, ok, p)
+	}
+	assert.Equal(t, -1, results["a"])
+	assert.Equal(t, 1, results["b"])
+
+	ok, err := target.Exists("data/ab/ab01")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	// Losing a replica makes the object count as missing so the next
+	// backup stores it again.
+	store.down["a"] = false
+	store.down["c"] = true
+	ok, err = target.Exists("data/ab/ab01")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	data, err := target.Load("data/ab/ab01")
+	require.NoError(t, err)
+	assert.Equal(t, "chunk", string(data))
+
+	store.down["b"] = true
+	_, err = target.Load("data/ab/ab01")
+	assert.Error(t, err)
+}
+
+func TestPeerTargetWithoutPeers(t *testing.T) {
+	target := &PeerTarget{Store: newFakePeerStore(), Peers: func() []string { return nil }}
+	assert.ErrorContains(t, target.Save("config", []byte("x")), "no trusted peers")
+}
+
+func TestBackupToPeers(t *testing.T) {
+	store := newFakePeerStore("a", "b", "c")
+	peers := func() []string { return []string{"a", "b", "c"} }
+	bm := NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	bm.SetTarget(&PeerTarget{Store: store, Peers: peers})
+	id, err := bm.CreateBackup(map[string]interface{}{"a": "b"}, nil, nil)
+	require.NoError(t, err)
+
+	// Peers hold only ciphertext.
+	for _, name := range mustList(t, store.peers["a"], "data") {
+		data, _ := store.peers["a"].Load(name)
+		assert.NotContains(t, string(data), `"a":"b"`)
+	}
+
+	store.down["a"] = true
+	restored := NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	restored.SetTarget(&PeerTarget{Store: store, Peers: peers})
+	data, err := restored.RestoreBackup(id)
+	require.NoError(t, err)
+	assert.Equal(t, "b", data.Config["a"])
+}
+
+func mustList(t *testing.T, target Target, dir string) []string {
+	t.Helper()
+	names, err := target.List(dir)
+	require.NoError(t, err)
+	require.NotEmpty(t, names)
+	return names
+}
+
+func TestTrustedPeer(t *testing.T) {
+	// A peer with no history scores exactly the default minimum, which is
+	// not enough.
+	require.False(t, TrustedPeer(nil, DefaultMinReputation, "peer-a", 50))
+	require.True(t, TrustedPeer(nil, DefaultMinReputation, "peer-a", 50.5))
+	require.True(t, TrustedPeer([]string{"peer-a"}, DefaultMinReputation, "peer-a", 10))
+	require.False(t, TrustedPeer([]string{"peer-a"}, DefaultMinReputation, "peer-b", 50))
+}
+
+func TestPeerHostKeepsPeersApartWithinQuota(t *testing.T) {
+	dir := t.TempDir()
+	host := NewPeerHost(dir, 10)
+
+	require.NoError(t, host.Put("peerA", "data/ab/ab01", []byte("123456")))
+	assert.ErrorIs(t, host.Put("peerA", "data/ab/ab02", []byte("12345")), ErrQuotaExceeded)
+	require.NoError(t, host.Put("peerA", "data/ab/ab01", []byte("1234567890")), "replacing an object counts only the difference")
+	require.NoError(t, host.Put("peerB", "data/ab/ab01", []byte("other")))
+
+	data, err := host.Get("peerA", "data/ab/ab01")
+	require.NoError(t, err)
+	assert.Equal(t, "1234567890", string(data))
+	names, err := host.List("peerB", "data")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"data/ab/ab01"}, names)
+
+	require.NoError(t, host.Delete("peerA", "data/ab/ab01"))
+	require.NoError(t, host.Put("peerA", "data/ab/ab02", []byte("12345")))
+
+	// A restarted host recomputes usage from disk.
+	host = NewPeerHost(dir, 10)
+	assert.ErrorIs(t, host.Put("peerA", "data/ab/ab03", []byte("123456")), ErrQuotaExceeded)
+
+	_, err = host.Get("..", "config")
+	assert.Error(t, err)
+	assert.Error(t, host.Put("peerA", "../peerB/config", []byte("x")))
+}
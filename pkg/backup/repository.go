@@ -0,0 +1,258 @@
+package backup
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// A backup repository is a directory of encrypted objects:
+//
+//	config               repository ID and key slots (plain JSON)
+//	data/<xx>/<chunk ID> content-defined chunks of backed up files and data
+//	snapshots/<ID>       one catalogue entry per backup run
+//
+// Objects are encrypted with keys derived from a random master key, which
+// each key slot in the config wraps under one credential. Chunk IDs are an
+// HMAC of the plaintext under a repository key, so equal chunks are stored
+// once without revealing their hashes.
+const (
+	repoVersion     = 2
+	repoConfigName  = "config"
+	repoDataDir     = "data"
+	repoSnapshotDir = "snapshots"
+	repoCheckText   = "apa backup repository"
+
+	// maxPBKDF2Iterations bounds the work a version 1 config can demand.
+	maxPBKDF2Iterations = 10_000_000
+)
+
+// ErrWrongPassphrase is returned when none of the manager's credentials
+// opens a key slot of the repository.
+var ErrWrongPassphrase = errors.New("wrong backup passphrase or key")
+
+type repoConfig struct {
+	Version int        `json:"version"`
+	ID      string     `json:"id"`
+	Slots   []*keySlot `json:"slots,omitempty"`
+	Check   []byte     `json:"check"` // repoCheckText sealed with the data key
+
+	// Version 1 repositories derived the master key from the passphrase
+	// with PBKDF2. They are upgraded to a passphrase slot when opened.
+	Salt       []byte `json:"salt,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+}
+
+// repoKeys are derived from the repository master key.
+type repoKeys struct {
+	master []byte
+	aead   cipher.AEAD
+	id     []byte
+}
+
+func deriveKeys(master []byte) (*repoKeys, error) {
+	encKey := make([]byte, 32)
+	idKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte("apa-backup-data")), encKey); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(hkdf.New(sha256.New, master, nil, []byte("apa-backup-chunk-id")), idKey); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(encKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return &repoKeys{master: master, aead: gcm, id: idKey}, nil
+}
+
+// seal encrypts data with AES-GCM under a random nonce prepended to the
+// ciphertext.
+func (k *repoKeys) seal(data []byte) ([]byte, error) {
+	nonce := make([]byte, k.aead.NonceSize(), k.aead.NonceSize()+len(data)+k.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return k.aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func (k *repoKeys) open(sealed []byte) ([]byte, error) {
+	n := k.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	plaintext, err := k.aead.Open(nil, sealed[:n], sealed[n:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return plaintext, nil
+}
+
+// chunkID returns the keyed hash naming a chunk.
+func (k *repoKeys) chunkID(data []byte) string {
+	mac := hmac.New(sha256.New, k.id)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkedKeys derives the keys from master and confirms they are the
+// repository's.
+func checkedKeys(cfg *repoConfig, master []byte) (*repoKeys, bool) {
+	keys, err := deriveKeys(master)
+	if err != nil {
+		return nil, false
+	}
+	if check, err := keys.open(cfg.Check); err != nil || string(check) != repoCheckText {
+		return nil, false
+	}
+	return keys, true
+}
+
+// openRepository reads the repository config from store, creating the
+// repository if there is none, and unlocks it with the first credential
+// that opens a key slot. It returns the ID of that slot.
+func openRepository(store Target, creds []Credential) (*repoConfig, *repoKeys, string, error) {
+	data, err := store.Load(repoConfigName)
+	if errors.Is(err, os.ErrNotExist) {
+		cfg, keys, err := initRepository(store, creds)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return cfg, keys, cfg.Slots[0].ID, nil
+	}
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to read repository config: %w", err)
+	}
+	var cfg repoConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to parse repository config: %w", err)
+	}
+	switch cfg.Version {
+	case 1:
+		return upgradeRepository(store, &cfg, creds)
+	case repoVersion:
+	default:
+		return nil, nil, "", fmt.Errorf("unsupported repository version %d", cfg.Version)
+	}
+	for _, cred := range creds {
+		for _, slot := range cfg.Slots {
+			master, ok := slot.unwrap(cfg.ID, cred)
+			if !ok {
+				continue
+			}
+			if keys, ok := checkedKeys(&cfg, master); ok {
+				return &cfg, keys, slot.ID, nil
+			}
+		}
+	}
+	return nil, nil, "", ErrWrongPassphrase
+}
+
+func initRepository(store Target, creds []Credential) (*repoConfig, *repoKeys, error) {
+	if len(creds) == 0 {
+		return nil, nil, fmt.Errorf("no passphrase or key to create the backup repository with")
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate repository ID: %w", err)
+	}
+	master := make([]byte, 32)
+	if _, err := rand.Read(master); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate master key: %w", err)
+	}
+	cfg := &repoConfig{Version: repoVersion, ID: hex.EncodeToString(id)}
+	for _, cred := range creds {
+		slot, err := newKeySlot(cfg.ID, "", cred, master)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.Slots = append(cfg.Slots, slot)
+	}
+	keys, err := deriveKeys(master)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.Check, err = keys.seal([]byte(repoCheckText)); err != nil {
+		return nil, nil, err
+	}
+	if err := saveRepoConfig(store, cfg); err != nil {
+		return nil, nil, err
+	}
+	return cfg, keys, nil
+}
+
+// upgradeRepository moves a version 1 repository's passphrase-derived master
+// key into a passphrase slot. The data keys do not change.
+func upgradeRepository(store Target, cfg *repoConfig, creds []Credential) (*repoConfig, *repoKeys, string, error) {
+	if cfg.Iterations < 1 || cfg.Iterations > maxPBKDF2Iterations {
+		return nil, nil, "", fmt.Errorf("pbkdf2 iterations %d outside 1-%d", cfg.Iterations, maxPBKDF2Iterations)
+	}
+	for _, cred := range creds {
+		if cred.typ != SlotPassphrase {
+			continue
+		}
+		master := pbkdf2.Key(cred.secret, cfg.Salt, cfg.Iterations, 32, sha256.New)
+		keys, ok := checkedKeys(cfg, master)
+		if !ok {
+			continue
+		}
+		slot, err := newKeySlot(cfg.ID, "", cred, master)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		upgraded := &repoConfig{Version: repoVersion, ID: cfg.ID, Slots: []*keySlot{slot}, Check: cfg.Check}
+		if err := saveRepoConfig(store, upgraded); err != nil {
+			return nil, nil, "", err
+		}
+		return upgraded, keys, slot.ID, nil
+	}
+	return nil, nil, "", ErrWrongPassphrase
+}
+
+func saveRepoConfig(store Target, cfg *repoConfig) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal repository config: %w", err)
+	}
+	if err := store.Save(repoConfigName, data); err != nil {
+		return fmt.Errorf("failed to write repository config: %w", err)
+	}
+	return nil
+}
+
+func chunkName(id string) string {
+	return repoDataDir + "/" + id[:2] + "/" + id
+}
+
+func snapshotName(id string) string {
+	return repoSnapshotDir + "/" + id
+}
+
+// validObjectID reports whether id is a lowercase hex object name, so
+// names from a caller or a damaged repository cannot escape it.
+func validObjectID(id string) bool {
+	if len(id) < 2 {
+		return false
+	}
+	for _, c := range id {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RetentionPolicy says which snapshots to keep, grandfather-father-son
+// style: the newest Last snapshots, and the newest snapshot of each of the
+// most recent Hourly hours, Daily days and Weekly ISO weeks that have one.
+// A snapshot kept by any rule is kept.
+type RetentionPolicy struct {
+	Last   int `yaml:"last" json:"last"`
+	Hourly int `yaml:"hourly" json:"hourly"`
+	Daily  int `yaml:"daily" json:"daily"`
+	Weekly int `yaml:"weekly" json:"weekly"`
+}
+
+// IsZero reports whether the policy has no rules, in which case every
+// snapshot is kept.
+func (p RetentionPolicy) IsZero() bool {
+	return p.Last <= 0 && p.Hourly <= 0 && p.Daily <= 0 && p.Weekly <= 0
+}
+
+type retentionBucket struct {
+	count int
+	key   func(time.Time) string
+	last  string
+}
+
+// apply splits snaps into those to keep and those to remove, each newest
+// first.
+func (p RetentionPolicy) apply(snaps []*Snapshot) (keep, remove []*Snapshot) {
+	sorted := append([]*Snapshot(nil), snaps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Time.After(sorted[j].Time) })
+	if p.IsZero() {
+		return sorted, nil
+	}
+
+	buckets := []*retentionBucket{
+		{count: p.Last, key: nil},
+		{count: p.Hourly, key: func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{count: p.Daily, key: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{count: p.Weekly, key: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+	}
+	for _, s := range sorted {
+		kept := false
+		for _, b := range buckets {
+			if b.count <= 0 {
+				continue
+			}
+			if b.key == nil {
+				b.count--
+				kept = true
+				continue
+			}
+			if k := b.key(s.Time); k != b.last {
+				b.last = k
+				b.count--
+				kept = true
+			}
+		}
+		if kept {
+			keep = append(keep, s)
+		} else {
+			remove = append(remove, s)
+		}
+	}
+	return keep, remove
+}
@@ -0,0 +1,72 @@
+package backup
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func snapshotsEvery(start time.Time, step time.Duration, n int) []*Snapshot {
+	var snaps []*Snapshot
+	for i := 0; i < n; i++ {
+		snaps = append(snaps, &Snapshot{ID: start.Add(time.Duration(i) * step).Format(time.RFC3339), Time: start.Add(time.Duration(i) * step)})
+	}
+	return snaps
+}
+
+func ids(snaps []*Snapshot) []string {
+	var out []string
+	for _, s := range snaps {
+		out = append(out, s.ID)
+	}
+	return out
+}
+
+func TestRetentionZeroKeepsEverything(t *testing.T) {
+	snaps := snapshotsEvery(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Hour, 5)
+	keep, remove := RetentionPolicy{}.apply(snaps)
+	assert.Len(t, keep, 5)
+	assert.Empty(t, remove)
+}
+
+func TestRetentionLast(t *testing.T) {
+	snaps := snapshotsEvery(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Minute, 5)
+	keep, remove := RetentionPolicy{Last: 2}.apply(snaps)
+	assert.Equal(t, []string{snaps[4].ID, snaps[3].ID}, ids(keep))
+	assert.Len(t, remove, 3)
+}
+
+func TestRetentionHourlyKeepsNewestPerHour(t *testing.T) {
+	// Four snapshots an hour for three hours.
+	snaps := snapshotsEvery(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), 15*time.Minute, 12)
+	keep, _ := RetentionPolicy{Hourly: 2}.apply(snaps)
+	assert.Equal(t, []string{"2024-01-01T12:45:00Z", "2024-01-01T11:45:00Z"}, ids(keep))
+}
+
+func TestRetentionGFS(t *testing.T) {
+	// Every six hours for five weeks.
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) // a Monday
+	snaps := snapshotsEvery(start, 6*time.Hour, 35*4)
+	keep, remove := RetentionPolicy{Hourly: 3, Daily: 7, Weekly: 4}.apply(snaps)
+
+	kept := map[string]bool{}
+	for _, id := range ids(keep) {
+		kept[id] = true
+	}
+	// Newest three hours that have a snapshot.
+	assert.True(t, kept["2024-02-04T18:00:00Z"])
+	assert.True(t, kept["2024-02-04T12:00:00Z"])
+	assert.True(t, kept["2024-02-04T06:00:00Z"])
+	// The newest snapshot of each of the last seven days.
+	for d := 0; d < 7; d++ {
+		assert.True(t, kept[time.Date(2024, 2, 4-d, 18, 0, 0, 0, time.UTC).Format(time.RFC3339)], "day %d", d)
+	}
+	// The newest snapshot of each of the last four weeks, ending Sundays.
+	for _, day := range []int{28, 21, 14} {
+		assert.True(t, kept[time.Date(2024, 1, day, 18, 0, 0, 0, time.UTC).Format(time.RFC3339)], "week ending %d", day)
+	}
+	assert.False(t, kept["2024-01-07T18:00:00Z"], "fifth week is outside the policy")
+	assert.Len(t, keep, 3+6+3)
+	assert.Len(t, remove, len(snaps)-len(keep))
+}
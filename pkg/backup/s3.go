@@ -0,0 +1,306 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config locates a bucket on S3-compatible object storage, such as AWS S3
+// or MinIO. Requests use path-style addressing and Signature Version 4.
+type S3Config struct {
+	Endpoint      string        `yaml:"endpoint"` // e.g. "https://s3.eu-west-1.amazonaws.com" or "http://minio:9000"
+	Bucket        string        `yaml:"bucket"`
+	Prefix        string        `yaml:"prefix"` // key prefix for the repository, e.g. "agents/node-1"
+	Region        string        `yaml:"region"` // defaults to "us-east-1"
+	AccessKey     string        `yaml:"access_key"`
+	SecretKeyFile string        `yaml:"secret_key_file"`
+	Timeout       time.Duration `yaml:"timeout"` // per request, defaults to 60s
+}
+
+// S3Target stores objects in an S3 bucket.
+type S3Target struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3Target returns a target for the bucket in cfg, reading the secret key
+// from cfg.SecretKeyFile.
+func NewS3Target(cfg S3Config) (*S3Target, error) {
+	secret, err := os.ReadFile(cfg.SecretKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read S3 secret key: %w", err)
+	}
+	return newS3Target(cfg, strings.TrimSpace(string(secret)))
+}
+
+func newS3Target(cfg S3Config, secretKey string) (*S3Target, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" || cfg.AccessKey == "" {
+		return nil, fmt.Errorf("s3 target requires endpoint, bucket and access_key")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	return &S3Target{
+		endpoint:  endpoint,
+		bucket:    cfg.Bucket,
+		prefix:    strings.Trim(cfg.Prefix, "/"),
+		region:    region,
+		accessKey: cfg.AccessKey,
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: timeout},
+		now:       time.Now,
+	}, nil
+}
+
+func (t *S3Target) key(name string) string {
+	if t.prefix == "" {
+		return name
+	}
+	return t.prefix + "/" + name
+}
+
+func (t *S3Target) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *t.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + t.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = ""
+	u.RawQuery = query.Encode()
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	signS3Request(req, body, t.accessKey, t.secretKey, t.region, t.now())
+	return t.client.Do(req)
+}
+
+func s3Error(op, name string, resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: %s: %s", op, name, resp.Status, strings.TrimSpace(string(msg)))
+}
+
+func (t *S3Target) Save(name string, data []byte) error {
+	if !ValidObjectName(name) {
+		return fmt.Errorf("invalid object name %q", name)
+	}
+	resp, err := t.do(http.MethodPut, t.key(name), nil, data)
+	if err != nil {
+		return fmt.Errorf("s3 put %s: %w", name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error("put", name, resp)
+	}
+	return nil
+}
+
+func (t *S3Target) Load(name string) ([]byte, error) {
+	resp, err := t.do(http.MethodGet, t.key(name), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("s3 get %s: %w", name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, notFound(name)
+	default:
+		return nil, s3Error("get", name, resp)
+	}
+}
+
+func (t *S3Target) Remove(name string) error {
+	resp, err := t.do(http.MethodDelete, t.key(name), nil, nil)
+	if err != nil {
+		return fmt.Errorf("s3 delete %s: %w", name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error("delete", name, resp)
+	}
+	return nil
+}
+
+func (t *S3Target) Exists(name string) (bool, error) {
+	resp, err := t.do(http.MethodHead, t.key(name), nil, nil)
+	if err != nil {
+		return false, fmt.Errorf("s3 head %s: %w", name, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3Error("head", name, resp)
+	}
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (t *S3Target) List(dir string) ([]string, error) {
+	prefix := t.key(dir)
+	if dir != "" || t.prefix != "" {
+		prefix = strings.TrimSuffix(prefix, "/") + "/"
+	}
+	var names []string
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := t.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s: %w", dir, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error("list", dir, resp)
+			_ = resp.Body.Close()
+			return nil, err
+		}
+		var result s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s: %w", dir, err)
+		}
+		for _, c := range result.Contents {
+			name := c.Key
+			if t.prefix != "" {
+				name = strings.TrimPrefix(name, t.prefix+"/")
+			}
+			names = append(names, name)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req for the S3
+// service, signing the host, the range header and every x-amz-* header.
+func signS3Request(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "range" || lower == "content-type" || lower == "content-md5" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3URIEncode(req.URL.Path, false),
+		s3CanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, s3URIEncode(k, true)+"="+s3URIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3URIEncode percent-encodes every byte except unreserved characters and,
+// unless encodeSlash is set, '/'.
+func s3URIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
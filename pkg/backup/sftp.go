@@ -0,0 +1,662 @@
+package backup
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SFTPConfig locates a directory on an SFTP server. The server's host key
+// must be given; there is no trust on first use.
+type SFTPConfig struct {
+	Addr         string        `yaml:"addr"` // host:port
+	User         string        `yaml:"user"`
+	KeyFile      string        `yaml:"key_file"`      // PEM private key
+	PasswordFile string        `yaml:"password_file"` // used when no key file is set
+	HostKey      string        `yaml:"host_key"`      // authorized_keys line, e.g. "ssh-ed25519 AAAA..."
+	Dir          string        `yaml:"dir"`           // repository directory on the server
+	Timeout      time.Duration `yaml:"timeout"`       // connection timeout, defaults to 30s
+}
+
+// SFTPTarget stores objects in a directory on an SFTP server. It keeps one
+// connection open and reconnects after a failure.
+type SFTPTarget struct {
+	dir  string
+	dial func() (*sftpClient, io.Closer, error)
+
+	mu     sync.Mutex
+	client *sftpClient
+	conn   io.Closer
+}
+
+// NewSFTPTarget returns a target for the directory in cfg. It connects on
+// first use.
+func NewSFTPTarget(cfg SFTPConfig) (*SFTPTarget, error) {
+	if cfg.Addr == "" || cfg.User == "" || cfg.HostKey == "" {
+		return nil, fmt.Errorf("sftp target requires addr, user and host_key")
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sftp host_key: %w", err)
+	}
+	var auth ssh.AuthMethod
+	switch {
+	case cfg.KeyFile != "":
+		pem, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sftp key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp key: %w", err)
+		}
+		auth = ssh.PublicKeys(signer)
+	case cfg.PasswordFile != "":
+		password, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sftp password: %w", err)
+		}
+		auth = ssh.Password(strings.TrimSpace(string(password)))
+	default:
+		return nil, fmt.Errorf("sftp target requires key_file or password_file")
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	sshConfig := &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         timeout,
+	}
+	dir := cfg.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return &SFTPTarget{
+		dir: strings.TrimSuffix(dir, "/"),
+		dial: func() (*sftpClient, io.Closer, error) {
+			return dialSFTP(cfg.Addr, sshConfig)
+		},
+	}, nil
+}
+
+func dialSFTP(addr string, config *ssh.ClientConfig) (*sftpClient, io.Closer, error) {
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to sftp server: %w", err)
+	}
+	session, err := conn.NewSession()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("failed to open ssh session: %w", err)
+	}
+	w, err := session.StdinPipe()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		_ = conn.Close()
+		return nil, nil, fmt.Errorf("failed to start sftp subsystem: %w", err)
+	}
+	client, err := newSFTPClient(r, w)
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+	return client, conn, nil
+}
+
+// with runs fn on the open connection, connecting first if needed. A
+// connection that fails anything but a status reply is dropped.
+func (t *SFTPTarget) with(fn func(c *sftpClient) error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client == nil {
+		client, conn, err := t.dial()
+		if err != nil {
+			return err
+		}
+		t.client, t.conn = client, conn
+	}
+	err := fn(t.client)
+	var status *sftpStatusError
+	if err != nil && !errors.As(err, &status) {
+		_ = t.conn.Close()
+		t.client, t.conn = nil, nil
+	}
+	return err
+}
+
+// Close closes the connection, if one is open.
+func (t *SFTPTarget) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn == nil {
+		return nil
+	}
+	err := t.conn.Close()
+	t.client, t.conn = nil, nil
+	return err
+}
+
+func (t *SFTPTarget) path(name string) (string, error) {
+	if !ValidObjectName(name) {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return t.dir + "/" + name, nil
+}
+
+// Save uploads to a temporary file and renames it into place.
+func (t *SFTPTarget) Save(name string, data []byte) error {
+	p, err := t.path(name)
+	if err != nil {
+		return err
+	}
+	return t.with(func(c *sftpClient) error {
+		if err := c.mkdirAll(path.Dir(p)); err != nil {
+			return fmt.Errorf("sftp mkdir %s: %w", path.Dir(name), err)
+		}
+		tmp := path.Dir(p) + "/.tmp-" + path.Base(p)
+		if err := c.writeFile(tmp, data); err != nil {
+			return fmt.Errorf("sftp write %s: %w", name, err)
+		}
+		if err := c.replace(tmp, p); err != nil {
+			_ = c.remove(tmp)
+			return fmt.Errorf("sftp rename %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+func (t *SFTPTarget) Load(name string) ([]byte, error) {
+	p, err := t.path(name)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = t.with(func(c *sftpClient) error {
+		data, err = c.readFile(p)
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, notFound(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sftp read %s: %w", name, err)
+	}
+	return data, nil
+}
+
+func (t *SFTPTarget) Remove(name string) error {
+	p, err := t.path(name)
+	if err != nil {
+		return err
+	}
+	err = t.with(func(c *sftpClient) error { return c.remove(p) })
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("sftp remove %s: %w", name, err)
+	}
+	return nil
+}
+
+func (t *SFTPTarget) Exists(name string) (bool, error) {
+	p, err := t.path(name)
+	if err != nil {
+		return false, err
+	}
+	err = t.with(func(c *sftpClient) error {
+		_, err := c.stat(p)
+		return err
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("sftp stat %s: %w", name, err)
+	}
+	return true, nil
+}
+
+func (t *SFTPTarget) List(dir string) ([]string, error) {
+	root := t.dir
+	if dir != "" {
+		p, err := t.path(dir)
+		if err != nil {
+			return nil, err
+		}
+		root = p
+	}
+	var names []string
+	err := t.with(func(c *sftpClient) error {
+		var walk func(p string) error
+		walk = func(p string) error {
+			entries, err := c.readDir(p)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if e.name == "." || e.name == ".." || strings.HasPrefix(e.name, ".tmp-") {
+					continue
+				}
+				child := p + "/" + e.name
+				if e.isDir {
+					if err := walk(child); err != nil {
+						return err
+					}
+					continue
+				}
+				names = append(names, strings.TrimPrefix(child, t.dir+"/"))
+			}
+			return nil
+		}
+		return walk(root)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("sftp list %s: %w", dir, err)
+	}
+	return names, nil
+}
+
+// The subset of SFTP version 3 (draft-ietf-secsh-filexfer-02) the target
+// needs.
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpWrite    = 6
+	sftpOpenDir  = 11
+	sftpReadDir  = 12
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpStat     = 17
+	sftpRename   = 18
+	sftpExtended = 200
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpAttrs    = 105
+	sftpOK       = 0
+	sftpEOF      = 1
+	sftpNoFile   = 2
+	sftpFxfRead  = 0x01
+	sftpFxfWrite = 0x02
+	sftpFxfCreat = 0x08
+	sftpFxfTrunc = 0x10
+
+	sftpAttrSize        = 0x1
+	sftpAttrUIDGID      = 0x2
+	sftpAttrPermissions = 0x4
+	sftpAttrACModTime   = 0x8
+	sftpAttrExtended    = 0x80000000
+
+	sftpChunk     = 32 << 10
+	sftpMaxPacket = 256 << 10
+	// sftpMaxObject and sftpMaxDirEntries bound the replies read for one
+	// file or directory, so a server cannot keep the client reading.
+	sftpMaxObject     = 1 << 30
+	sftpMaxDirEntries = 1 << 20
+
+	// sftpPosixRename is the OpenSSH extension that renames over an
+	// existing file atomically, which plain SFTP v3 rename refuses to do.
+	sftpPosixRename = "posix-rename@openssh.com"
+)
+
+// sftpStatusError is a failure reported by the server, after which the
+// connection is still usable.
+type sftpStatusError struct {
+	code uint32
+	msg  string
+}
+
+func (e *sftpStatusError) Error() string {
+	return fmt.Sprintf("sftp status %d: %s", e.code, e.msg)
+}
+
+func (e *sftpStatusError) Unwrap() error {
+	if e.code == sftpNoFile {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// sftpClient issues one request at a time over an SFTP channel.
+type sftpClient struct {
+	r          io.Reader
+	w          io.Writer
+	nextID     uint32
+	extensions map[string]bool // extensions the server announced
+}
+
+func newSFTPClient(r io.Reader, w io.Writer) (*sftpClient, error) {
+	c := &sftpClient{r: r, w: w}
+	if err := writeSFTPPacket(w, sftpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return nil, fmt.Errorf("failed to start sftp: %w", err)
+	}
+	typ, payload, err := readSFTPPacket(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start sftp: %w", err)
+	}
+	if typ != sftpVersion || len(payload) < 4 || binary.BigEndian.Uint32(payload) < 3 {
+		return nil, fmt.Errorf("sftp server does not speak version 3")
+	}
+	c.extensions = make(map[string]bool)
+	ext := &sftpReader{b: payload[4:]}
+	for len(ext.b) > 0 && ext.err == nil {
+		name := string(ext.bytes())
+		ext.bytes() // extension data
+		if ext.err == nil {
+			c.extensions[name] = true
+		}
+	}
+	return c, nil
+}
+
+func writeSFTPPacket(w io.Writer, typ byte, payload []byte) error {
+	buf := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(1+len(payload)))
+	buf[4] = typ
+	_, err := w.Write(append(buf, payload...))
+	return err
+}
+
+func readSFTPPacket(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:4])
+	if length < 1 || length > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("invalid sftp packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[4], payload, nil
+}
+
+func appendSFTPString(b []byte, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+// sftpReader decodes the fields of a reply, failing once on short input.
+type sftpReader struct {
+	b   []byte
+	err error
+}
+
+func (r *sftpReader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *sftpReader) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.b)) < n {
+		r.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+// attrs decodes file attributes and reports whether they describe a
+// directory.
+func (r *sftpReader) attrs() (isDir bool) {
+	flags := r.uint32()
+	if flags&sftpAttrSize != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&sftpAttrPermissions != 0 {
+		isDir = r.uint32()&0170000 == 0040000
+	}
+	if flags&sftpAttrACModTime != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&sftpAttrExtended != 0 {
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.bytes()
+			r.bytes()
+		}
+	}
+	return isDir
+}
+
+// call sends a request and returns the reply of the expected type. A status
+// reply is returned as an error unless it is OK and ok is sftpStatus.
+func (c *sftpClient) call(typ byte, args []byte, want byte) (*sftpReader, error) {
+	c.nextID++
+	id := c.nextID
+	if err := writeSFTPPacket(c.w, typ, append(binary.BigEndian.AppendUint32(nil, id), args...)); err != nil {
+		return nil, err
+	}
+	replyType, payload, err := readSFTPPacket(c.r)
+	if err != nil {
+		return nil, err
+	}
+	r := &sftpReader{b: payload}
+	if replyID := r.uint32(); r.err != nil || replyID != id {
+		return nil, fmt.Errorf("sftp reply for request %d, want %d", replyID, id)
+	}
+	if replyType == sftpStatus {
+		code := r.uint32()
+		msg := r.bytes()
+		if code == sftpOK && want == sftpStatus {
+			return r, nil
+		}
+		return nil, &sftpStatusError{code: code, msg: string(msg)}
+	}
+	if replyType != want {
+		return nil, fmt.Errorf("unexpected sftp reply type %d", replyType)
+	}
+	return r, nil
+}
+
+func (c *sftpClient) open(p string, flags uint32) ([]byte, error) {
+	args := appendSFTPString(nil, []byte(p))
+	args = binary.BigEndian.AppendUint32(args, flags)
+	args = binary.BigEndian.AppendUint32(args, 0) // no attributes
+	r, err := c.call(sftpOpen, args, sftpHandle)
+	if err != nil {
+		return nil, err
+	}
+	handle := r.bytes()
+	return append([]byte(nil), handle...), r.err
+}
+
+func (c *sftpClient) close(handle []byte) error {
+	_, err := c.call(sftpClose, appendSFTPString(nil, handle), sftpStatus)
+	return err
+}
+
+func (c *sftpClient) writeFile(p string, data []byte) error {
+	handle, err := c.open(p, sftpFxfWrite|sftpFxfCreat|sftpFxfTrunc)
+	if err != nil {
+		return err
+	}
+	for off := 0; off < len(data); off += sftpChunk {
+		end := min(off+sftpChunk, len(data))
+		args := appendSFTPString(nil, handle)
+		args = binary.BigEndian.AppendUint64(args, uint64(off))
+		args = appendSFTPString(args, data[off:end])
+		if _, err := c.call(sftpWrite, args, sftpStatus); err != nil {
+			_ = c.close(handle)
+			return err
+		}
+	}
+	return c.close(handle)
+}
+
+func (c *sftpClient) readFile(p string) ([]byte, error) {
+	handle, err := c.open(p, sftpFxfRead)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	for {
+		args := appendSFTPString(nil, handle)
+		args = binary.BigEndian.AppendUint64(args, uint64(len(data)))
+		args = binary.BigEndian.AppendUint32(args, sftpChunk)
+		r, err := c.call(sftpRead, args, sftpData)
+		var status *sftpStatusError
+		if errors.As(err, &status) && status.code == sftpEOF {
+			return data, c.close(handle)
+		}
+		if err != nil {
+			_ = c.close(handle)
+			return nil, err
+		}
+		chunk := r.bytes()
+		if r.err == nil && len(chunk) == 0 {
+			r.err = fmt.Errorf("sftp server sent an empty read")
+		}
+		if r.err == nil && len(data)+len(chunk) > sftpMaxObject {
+			r.err = fmt.Errorf("sftp file larger than %d bytes", sftpMaxObject)
+		}
+		if r.err != nil {
+			_ = c.close(handle)
+			return nil, r.err
+		}
+		data = append(data, chunk...)
+	}
+}
+
+func (c *sftpClient) stat(p string) (isDir bool, err error) {
+	r, err := c.call(sftpStat, appendSFTPString(nil, []byte(p)), sftpAttrs)
+	if err != nil {
+		return false, err
+	}
+	isDir = r.attrs()
+	return isDir, r.err
+}
+
+func (c *sftpClient) remove(p string) error {
+	_, err := c.call(sftpRemove, appendSFTPString(nil, []byte(p)), sftpStatus)
+	return err
+}
+
+func (c *sftpClient) rename(from, to string) error {
+	_, err := c.call(sftpRename, appendSFTPString(appendSFTPString(nil, []byte(from)), []byte(to)), sftpStatus)
+	return err
+}
+
+// replace renames from to to, replacing to atomically when the server
+// supports posix-rename. Without it, only a missing to can be written,
+// since removing it first would lose the object if the client stopped
+// before the rename.
+func (c *sftpClient) replace(from, to string) error {
+	if c.extensions[sftpPosixRename] {
+		args := appendSFTPString(nil, []byte(sftpPosixRename))
+		args = appendSFTPString(args, []byte(from))
+		args = appendSFTPString(args, []byte(to))
+		_, err := c.call(sftpExtended, args, sftpStatus)
+		return err
+	}
+	err := c.rename(from, to)
+	if err == nil {
+		return nil
+	}
+	if _, statErr := c.stat(to); statErr == nil {
+		return fmt.Errorf("server cannot replace an existing file without %s: %w", sftpPosixRename, err)
+	}
+	return err
+}
+
+func (c *sftpClient) mkdirAll(p string) error {
+	if p == "." || p == "/" || p == "" {
+		return nil
+	}
+	if isDir, err := c.stat(p); err == nil {
+		if !isDir {
+			return fmt.Errorf("%s is not a directory", p)
+		}
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := c.mkdirAll(path.Dir(p)); err != nil {
+		return err
+	}
+	args := appendSFTPString(nil, []byte(p))
+	args = binary.BigEndian.AppendUint32(args, sftpAttrPermissions)
+	args = binary.BigEndian.AppendUint32(args, 0700)
+	_, err := c.call(sftpMkdir, args, sftpStatus)
+	return err
+}
+
+type sftpDirEntry struct {
+	name  string
+	isDir bool
+}
+
+func (c *sftpClient) readDir(p string) ([]sftpDirEntry, error) {
+	r, err := c.call(sftpOpenDir, appendSFTPString(nil, []byte(p)), sftpHandle)
+	if err != nil {
+		return nil, err
+	}
+	handle := append([]byte(nil), r.bytes()...)
+	var entries []sftpDirEntry
+	for {
+		r, err := c.call(sftpReadDir, appendSFTPString(nil, handle), sftpName)
+		var status *sftpStatusError
+		if errors.As(err, &status) && status.code == sftpEOF {
+			return entries, c.close(handle)
+		}
+		if err != nil {
+			_ = c.close(handle)
+			return nil, err
+		}
+		n := r.uint32()
+		if r.err == nil && n == 0 {
+			r.err = fmt.Errorf("sftp server sent an empty directory read")
+		}
+		if r.err == nil && len(entries)+int(n) > sftpMaxDirEntries {
+			r.err = fmt.Errorf("sftp directory has more than %d entries", sftpMaxDirEntries)
+		}
+		for ; n > 0 && r.err == nil; n-- {
+			name := string(r.bytes())
+			r.bytes() // long name
+			entries = append(entries, sftpDirEntry{name: name, isDir: r.attrs()})
+		}
+		if r.err != nil {
+			_ = c.close(handle)
+			return nil, r.err
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package backup
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// serveSFTP answers the SFTP requests the target sends, on files under
+// root, until r is closed. With posixRename it announces and serves the
+// OpenSSH posix-rename extension.
+func serveSFTP(t *testing.T, r io.Reader, w io.Writer, root string, posixRename bool) {
+	handles := map[string]*os.File{}
+	dirs := map[string][]os.DirEntry{}
+	next := 0
+	local := func(p string) string { return filepath.Join(root, filepath.FromSlash(p)) }
+
+	typ, _, err := readSFTPPacket(r)
+	if err != nil || typ != sftpInit {
+		return
+	}
+	version := binary.BigEndian.AppendUint32(nil, 3)
+	if posixRename {
+		version = appendSFTPString(appendSFTPString(version, []byte(sftpPosixRename)), []byte("1"))
+	}
+	_ = writeSFTPPacket(w, sftpVersion, version)
+
+	for {
+		typ, payload, err := readSFTPPacket(r)
+		if err != nil {
+			return
+		}
+		in := &sftpReader{b: payload}
+		id := in.uint32()
+		reply := binary.BigEndian.AppendUint32(nil, id)
+		status := func(err error) {
+			code := uint32(sftpOK)
+			switch {
+			case os.IsNotExist(err):
+				code = sftpNoFile
+			case err == io.EOF:
+				code = sftpEOF
+			case err != nil:
+				code = 4 // SSH_FX_FAILURE
+			}
+			msg := ""
+			if err != nil {
+				msg = err.Error()
+			}
+			out := binary.BigEndian.AppendUint32(reply, code)
+			out = appendSFTPString(out, []byte(msg))
+			out = appendSFTPString(out, nil)
+			_ = writeSFTPPacket(w, sftpStatus, out)
+		}
+		handle := func() string {
+			next++
+			return string(rune('a' + next))
+		}
+		attrs := func(b []byte, info os.FileInfo) []byte {
+			mode := uint32(0100000)
+			if info.IsDir() {
+				mode = 0040000
+			}
+			b = binary.BigEndian.AppendUint32(b, sftpAttrSize|sftpAttrPermissions)
+			b = binary.BigEndian.AppendUint64(b, uint64(info.Size()))
+			return binary.BigEndian.AppendUint32(b, mode|uint32(info.Mode().Perm()))
+		}
+
+		switch typ {
+		case sftpOpen:
+			p := string(in.bytes())
+			flags := in.uint32()
+			osFlags := os.O_RDONLY
+			if flags&sftpFxfWrite != 0 {
+				osFlags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+			}
+			f, err := os.OpenFile(local(p), osFlags, 0600)
+			if err != nil {
+				status(err)
+				continue
+			}
+			h := handle()
+			handles[h] = f
+			_ = writeSFTPPacket(w, sftpHandle, appendSFTPString(reply, []byte(h)))
+		case sftpClose:
+			h := string(in.bytes())
+			if f, ok := handles[h]; ok {
+				_ = f.Close()
+				delete(handles, h)
+			}
+			delete(dirs, h)
+			status(nil)
+		case sftpWrite:
+			h := string(in.bytes())
+			off := uint64(in.uint32())<<32 | uint64(in.uint32())
+			_, err := handles[h].WriteAt(in.bytes(), int64(off))
+			status(err)
+		case sftpRead:
+			h := string(in.bytes())
+			off := uint64(in.uint32())<<32 | uint64(in.uint32())
+			buf := make([]byte, in.uint32())
+			n, err := handles[h].ReadAt(buf, int64(off))
+			if n == 0 {
+				status(err)
+				continue
+			}
+			_ = writeSFTPPacket(w, sftpData, appendSFTPString(reply, buf[:n]))
+		case sftpStat:
+			info, err := os.Stat(local(string(in.bytes())))
+			if err != nil {
+				status(err)
+				continue
+			}
+			_ = writeSFTPPacket(w, sftpAttrs, attrs(reply, info))
+		case sftpOpenDir:
+			entries, err := os.ReadDir(local(string(in.bytes())))
+			if err != nil {
+				status(err)
+				continue
+			}
+			h := handle()
+			dirs[h] = entries
+			_ = writeSFTPPacket(w, sftpHandle, appendSFTPString(reply, []byte(h)))
+		case sftpReadDir:
+			h := string(in.bytes())
+			entries := dirs[h]
+			if len(entries) == 0 {
+				status(io.EOF)
+				continue
+			}
+			// Two entries per reply, so the client has to read repeatedly.
+			batch := entries[:min(2, len(entries))]
+			dirs[h] = entries[len(batch):]
+			out := binary.BigEndian.AppendUint32(reply, uint32(len(batch)))
+			for _, e := range batch {
+				info, _ := e.Info()
+				out = appendSFTPString(out, []byte(e.Name()))
+				out = appendSFTPString(out, []byte(e.Name()))
+				out = attrs(out, info)
+			}
+			_ = writeSFTPPacket(w, sftpName, out)
+		case sftpRemove:
+			status(os.Remove(local(string(in.bytes()))))
+		case sftpMkdir:
+			status(os.Mkdir(local(string(in.bytes())), 0700))
+		case sftpRename:
+			from, to := local(string(in.bytes())), local(string(in.bytes()))
+			if _, err := os.Stat(to); err == nil {
+				status(os.ErrExist)
+				continue
+			}
+			status(os.Rename(from, to))
+		case sftpExtended:
+			if name := string(in.bytes()); !posixRename || name != sftpPosixRename {
+				status(os.ErrInvalid)
+				continue
+			}
+			from, to := local(string(in.bytes())), local(string(in.bytes()))
+			status(os.Rename(from, to))
+		default:
+			t.Errorf("unexpected sftp request %d", typ)
+			status(os.ErrInvalid)
+		}
+	}
+}
+
+func TestSFTPTarget(t *testing.T) {
+	root := t.TempDir()
+	target := pipeSFTPTarget(t, root, true)
+	defer target.Close() //nolint:errcheck
+	testTarget(t, target)
+
+	assert.FileExists(t, filepath.Join(root, "repo", "config"))
+	entries, err := os.ReadDir(filepath.Join(root, "repo", "snapshots"))
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.False(t, strings.HasPrefix(e.Name(), ".tmp-"), "temporary file left behind")
+	}
+}
+
+// pipeSFTPTarget returns a target served by serveSFTP over an in-memory
+// connection.
+func pipeSFTPTarget(t *testing.T, root string, posixRename bool) *SFTPTarget {
+	return &SFTPTarget{
+		dir: "repo",
+		dial: func() (*sftpClient, io.Closer, error) {
+			clientConn, serverConn := net.Pipe()
+			go serveSFTP(t, serverConn, serverConn, root, posixRename)
+			client, err := newSFTPClient(clientConn, clientConn)
+			return client, clientConn, err
+		},
+	}
+}
+
+func TestSFTPTargetWithoutPosixRename(t *testing.T) {
+	root := t.TempDir()
+	target := pipeSFTPTarget(t, root, false)
+	defer target.Close() //nolint:errcheck
+
+	require.NoError(t, target.Save("config", []byte("v1")))
+	// Replacing needs posix-rename; the old object is kept rather than
+	// removed ahead of a rename that might not happen.
+	err := target.Save("config", []byte("v2"))
+	assert.ErrorContains(t, err, sftpPosixRename)
+	data, err := target.Load("config")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", string(data))
+	entries, err := os.ReadDir(filepath.Join(root, "repo"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "the temporary file is removed")
+}
+
+// scriptedSFTP answers the init, then open with a handle, then every
+// further request with reply.
+func scriptedSFTP(r io.Reader, w io.Writer, replyType byte, reply func(id uint32) []byte) {
+	if _, _, err := readSFTPPacket(r); err != nil {
+		return
+	}
+	_ = writeSFTPPacket(w, sftpVersion, binary.BigEndian.AppendUint32(nil, 3))
+	for {
+		typ, payload, err := readSFTPPacket(r)
+		if err != nil {
+			return
+		}
+		id := binary.BigEndian.Uint32(payload)
+		switch typ {
+		case sftpOpen, sftpOpenDir:
+			_ = writeSFTPPacket(w, sftpHandle, appendSFTPString(binary.BigEndian.AppendUint32(nil, id), []byte("h")))
+		case sftpClose:
+			out := binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, id), sftpOK)
+			_ = writeSFTPPacket(w, sftpStatus, appendSFTPString(appendSFTPString(out, nil), nil))
+		default:
+			_ = writeSFTPPacket(w, replyType, reply(id))
+		}
+	}
+}
+
+func TestSFTPClientRejectsEndlessReplies(t *testing.T) {
+	client := func(replyType byte, reply func(id uint32) []byte) *sftpClient {
+		clientConn, serverConn := net.Pipe()
+		t.Cleanup(func() { _ = clientConn.Close() })
+		go scriptedSFTP(serverConn, serverConn, replyType, reply)
+		c, err := newSFTPClient(clientConn, clientConn)
+		require.NoError(t, err)
+		return c
+	}
+
+	// A server answering every read with no data and no EOF.
+	empty := client(sftpData, func(id uint32) []byte {
+		return appendSFTPString(binary.BigEndian.AppendUint32(nil, id), nil)
+	})
+	_, err := empty.readFile("repo/config")
+	assert.ErrorContains(t, err, "empty read")
+
+	// A server answering every directory read with no entries.
+	emptyDir := client(sftpName, func(id uint32) []byte {
+		return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, id), 0)
+	})
+	_, err = emptyDir.readDir("repo")
+	assert.ErrorContains(t, err, "empty directory read")
+
+	// A server answering with a malformed data reply.
+	truncated := client(sftpData, func(id uint32) []byte {
+		return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, id), 100)
+	})
+	_, err = truncated.readFile("repo/config")
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
+
+// TestSFTPTargetOverSSH runs the target against an SSH server that checks
+// the client key and serves the sftp subsystem.
+func TestSFTPTargetOverSSH(t *testing.T) {
+	root := t.TempDir()
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	require.NoError(t, err)
+
+	serverConfig := &ssh.ServerConfig{
+		PublicKeyCallback: func(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if meta.User() == "backup" && string(key.Marshal()) == string(clientSigner.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, os.ErrPermission
+		},
+	}
+	serverConfig.AddHostKey(hostSigner)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close() //nolint:errcheck
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, serverConfig)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+				for newChan := range chans {
+					ch, requests, err := newChan.Accept()
+					if err != nil {
+						continue
+					}
+					go func() {
+						for req := range requests {
+							ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+							_ = req.Reply(ok, nil)
+							if ok {
+								go func() {
+									serveSFTP(t, ch, ch, root, true)
+									_ = ch.Close()
+								}()
+							}
+						}
+					}()
+				}
+			}()
+		}
+	}()
+
+	keyPEM, err := ssh.MarshalPrivateKey(clientPriv, "")
+	require.NoError(t, err)
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(keyPEM), 0600))
+
+	cfg := SFTPConfig{
+		Addr:    ln.Addr().String(),
+		User:    "backup",
+		KeyFile: keyFile,
+		HostKey: string(ssh.MarshalAuthorizedKey(hostSigner.PublicKey())),
+		Dir:     "repo",
+	}
+	target, err := NewSFTPTarget(cfg)
+	require.NoError(t, err)
+	defer target.Close() //nolint:errcheck
+	require.NoError(t, target.Save("data/ab/ab01", []byte("chunk")))
+	data, err := os.ReadFile(filepath.Join(root, "repo", "data", "ab", "ab01"))
+	require.NoError(t, err)
+	assert.Equal(t, "chunk", string(data))
+
+	// A different host key is refused.
+	_, otherPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherSigner, err := ssh.NewSignerFromKey(otherPriv)
+	require.NoError(t, err)
+	cfg.HostKey = string(ssh.MarshalAuthorizedKey(otherSigner.PublicKey()))
+	impostor, err := NewSFTPTarget(cfg)
+	require.NoError(t, err)
+	_, err = impostor.Exists("data/ab/ab01")
+	assert.ErrorContains(t, err, "host key")
+}
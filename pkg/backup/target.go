@@ -0,0 +1,389 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Target stores repository objects by slash-separated name. Objects are
+// encrypted before they reach a target, except the repository config, which
+// holds only the repository ID and key derivation parameters.
+type Target interface {
+	Save(name string, data []byte) error
+	// Load returns an error satisfying errors.Is(err, fs.ErrNotExist) for
+	// a missing object.
+	Load(name string) ([]byte, error)
+	// Remove succeeds for a missing object.
+	Remove(name string) error
+	Exists(name string) (bool, error)
+	// List returns the names of the objects under dir, recursively.
+	List(dir string) ([]string, error)
+}
+
+// TargetConfig selects a remote copy of the repository. Exactly one of the
+// settings matching Type is used.
+type TargetConfig struct {
+	Type string     `yaml:"type"` // "s3", "sftp" or "peer"
+	S3   S3Config   `yaml:"s3"`
+	SFTP SFTPConfig `yaml:"sftp"`
+	Peer PeerConfig `yaml:"peer"`
+}
+
+// Validate checks that the settings for Type are present.
+func (c TargetConfig) Validate() error {
+	switch c.Type {
+	case "s3":
+		if c.S3.Endpoint == "" || c.S3.Bucket == "" || c.S3.AccessKey == "" || c.S3.SecretKeyFile == "" {
+			return fmt.Errorf("s3 target requires endpoint, bucket, access_key and secret_key_file")
+		}
+	case "sftp":
+		if c.SFTP.Addr == "" || c.SFTP.User == "" || c.SFTP.HostKey == "" {
+			return fmt.Errorf("sftp target requires addr, user and host_key")
+		}
+		if c.SFTP.KeyFile == "" && c.SFTP.PasswordFile == "" {
+			return fmt.Errorf("sftp target requires key_file or password_file")
+		}
+	case "peer":
+	default:
+		return fmt.Errorf("unknown backup target type %q", c.Type)
+	}
+	return nil
+}
+
+// ValidObjectName reports whether name is a relative slash-separated path
+// without "." or ".." elements, so it cannot escape a target's root.
+func ValidObjectName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+func notFound(name string) error {
+	return fmt.Errorf("object %s: %w", name, fs.ErrNotExist)
+}
+
+// DirTarget keeps objects as files under a directory.
+type DirTarget struct {
+	dir string
+}
+
+// NewDirTarget returns a target storing objects under dir.
+func NewDirTarget(dir string) *DirTarget {
+	return &DirTarget{dir: dir}
+}
+
+func (t *DirTarget) path(name string) (string, error) {
+	if !ValidObjectName(name) {
+		return "", fmt.Errorf("invalid object name %q", name)
+	}
+	return filepath.Join(t.dir, filepath.FromSlash(name)), nil
+}
+
+// Save writes the object atomically.
+func (t *DirTarget) Save(name string, data []byte) error {
+	p, err := t.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (t *DirTarget) Load(name string) ([]byte, error) {
+	p, err := t.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(p)
+}
+
+func (t *DirTarget) Remove(name string) error {
+	p, err := t.path(name)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(p)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (t *DirTarget) Exists(name string) (bool, error) {
+	p, err := t.path(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(p)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (t *DirTarget) List(dir string) ([]string, error) {
+	root := t.dir
+	if dir != "" {
+		p, err := t.path(dir)
+		if err != nil {
+			return nil, err
+		}
+		root = p
+	}
+	var names []string
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".tmp-") {
+			return nil
+		}
+		rel, err := filepath.Rel(t.dir, p)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return names, err
+}
+
+// MemoryTarget keeps objects in memory. It is meant for tests.
+type MemoryTarget struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+// NewMemoryTarget returns an empty in-memory target.
+func NewMemoryTarget() *MemoryTarget {
+	return &MemoryTarget{objects: make(map[string][]byte)}
+}
+
+func (t *MemoryTarget) Save(name string, data []byte) error {
+	if !ValidObjectName(name) {
+		return fmt.Errorf("invalid object name %q", name)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.objects[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (t *MemoryTarget) Load(name string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	data, ok := t.objects[name]
+	if !ok {
+		return nil, notFound(name)
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (t *MemoryTarget) Remove(name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.objects, name)
+	return nil
+}
+
+func (t *MemoryTarget) Exists(name string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.objects[name]
+	return ok, nil
+}
+
+func (t *MemoryTarget) List(dir string) ([]string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var names []string
+	for name := range t.objects {
+		if hasPrefixDir(name, dir) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// MirrorTarget keeps objects on a primary target, normally the local
+// directory, and copies them to remote targets so the repository survives
+// the loss of the host disk. The primary is authoritative: its errors fail
+// a call, while a remote that fails is counted for RemoteFailures and
+// otherwise ignored. An object exists only once every reachable remote has
+// it too, so the next backup fills in what a remote missed while it was
+// unreachable.
+type MirrorTarget struct {
+	primary Target
+	remotes []Target
+
+	mu       sync.Mutex
+	failures map[int]*RemoteFailure
+}
+
+// RemoteFailure counts the failed requests to one remote of a MirrorTarget.
+type RemoteFailure struct {
+	Remote int   // index among the remotes
+	Count  int   // failed requests
+	Err    error // the last error
+}
+
+// NewMirrorTarget mirrors objects from primary to remotes, reading from
+// them in the given order.
+func NewMirrorTarget(primary Target, remotes ...Target) *MirrorTarget {
+	return &MirrorTarget{primary: primary, remotes: remotes}
+}
+
+func (t *MirrorTarget) report(remote int, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.failures == nil {
+		t.failures = make(map[int]*RemoteFailure)
+	}
+	f, ok := t.failures[remote]
+	if !ok {
+		f = &RemoteFailure{Remote: remote}
+		t.failures[remote] = f
+	}
+	f.Count++
+	f.Err = err
+}
+
+// RemoteFailures returns the remotes whose requests failed since the last
+// call, in order, and resets the counts.
+func (t *MirrorTarget) RemoteFailures() []RemoteFailure {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]RemoteFailure, 0, len(t.failures))
+	for _, f := range t.failures {
+		out = append(out, *f)
+	}
+	t.failures = nil
+	sort.Slice(out, func(i, j int) bool { return out[i].Remote < out[j].Remote })
+	return out
+}
+
+func (t *MirrorTarget) Save(name string, data []byte) error {
+	if err := t.primary.Save(name, data); err != nil {
+		return err
+	}
+	for i, target := range t.remotes {
+		if err := target.Save(name, data); err != nil {
+			t.report(i, fmt.Errorf("save %s: %w", name, err))
+		}
+	}
+	return nil
+}
+
+// Load reports a missing object only when every target lacks it, so an
+// unreachable remote is never mistaken for an empty one.
+func (t *MirrorTarget) Load(name string) ([]byte, error) {
+	var errs []error
+	for _, target := range append([]Target{t.primary}, t.remotes...) {
+		data, err := target.Load(name)
+		if err == nil {
+			return data, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 {
+		return nil, notFound(name)
+	}
+	return nil, errors.Join(errs...)
+}
+
+func (t *MirrorTarget) Remove(name string) error {
+	if err := t.primary.Remove(name); err != nil {
+		return err
+	}
+	for i, target := range t.remotes {
+		if err := target.Remove(name); err != nil {
+			t.report(i, fmt.Errorf("remove %s: %w", name, err))
+		}
+	}
+	return nil
+}
+
+// Exists reports whether the primary and every reachable remote have the
+// object. A remote that cannot be asked is reported and left out.
+func (t *MirrorTarget) Exists(name string) (bool, error) {
+	ok, err := t.primary.Exists(name)
+	if err != nil || !ok {
+		return false, err
+	}
+	for i, target := range t.remotes {
+		ok, err := target.Exists(name)
+		if err != nil {
+			t.report(i, fmt.Errorf("exists %s: %w", name, err))
+			continue
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// List returns the objects found on the primary or any reachable remote.
+func (t *MirrorTarget) List(dir string) ([]string, error) {
+	names, err := t.primary.List(dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	for i, target := range t.remotes {
+		list, err := target.List(dir)
+		if err != nil {
+			t.report(i, fmt.Errorf("list %s: %w", dir, err))
+			continue
+		}
+		for _, name := range list {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hasPrefixDir reports whether name lies under dir.
+func hasPrefixDir(name, dir string) bool {
+	return dir == "" || strings.HasPrefix(name, path.Clean(dir)+"/")
+}
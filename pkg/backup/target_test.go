@@ -0,0 +1,203 @@
+package backup
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTarget checks the behaviour every Target must have.
+func testTarget(t *testing.T, target Target) {
+	t.Helper()
+	_, err := target.Load("config")
+	assert.True(t, errors.Is(err, fs.ErrNotExist), "missing object: %v", err)
+	ok, err := target.Exists("config")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, target.Save("config", []byte("cfg")))
+	require.NoError(t, target.Save("data/ab/ab01", []byte("one")))
+	require.NoError(t, target.Save("data/cd/cd02", []byte("two")))
+	require.NoError(t, target.Save("snapshots/ef03", []byte("snap")))
+	require.NoError(t, target.Save("snapshots/ef03", []byte("snap2")))
+
+	data, err := target.Load("snapshots/ef03")
+	require.NoError(t, err)
+	assert.Equal(t, "snap2", string(data))
+	ok, err = target.Exists("data/ab/ab01")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	names, err := target.List("data")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"data/ab/ab01", "data/cd/cd02"}, names)
+	names, err = target.List("snapshots")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"snapshots/ef03"}, names)
+	names, err = target.List("missing")
+	require.NoError(t, err)
+	assert.Empty(t, names)
+
+	require.NoError(t, target.Remove("data/ab/ab01"))
+	require.NoError(t, target.Remove("data/ab/ab01"), "removing a missing object succeeds")
+	ok, err = target.Exists("data/ab/ab01")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.Error(t, target.Save("../escape", []byte("x")))
+	assert.Error(t, target.Save("/abs", []byte("x")))
+}
+
+func TestDirTarget(t *testing.T) {
+	dir := t.TempDir()
+	testTarget(t, NewDirTarget(filepath.Join(dir, "repo")))
+	assert.NoFileExists(t, filepath.Join(dir, "escape"))
+}
+
+func TestMemoryTarget(t *testing.T) {
+	testTarget(t, NewMemoryTarget())
+}
+
+func TestMirrorTarget(t *testing.T) {
+	testTarget(t, NewMirrorTarget(NewMemoryTarget(), NewMemoryTarget()))
+}
+
+func TestValidObjectName(t *testing.T) {
+	assert.True(t, ValidObjectName("data/ab/abcd"))
+	for _, name := range []string{"", "/data", "data/../x", "..", "a//b", "a/./b", `a\b`} {
+		assert.False(t, ValidObjectName(name), name)
+	}
+}
+
+// failingTarget fails every operation, like an unreachable remote.
+type failingTarget struct{}
+
+func (failingTarget) Save(string, []byte) error     { return errors.New("unreachable") }
+func (failingTarget) Load(string) ([]byte, error)   { return nil, errors.New("unreachable") }
+func (failingTarget) Remove(string) error           { return errors.New("unreachable") }
+func (failingTarget) Exists(string) (bool, error)   { return false, errors.New("unreachable") }
+func (failingTarget) List(string) ([]string, error) { return nil, errors.New("unreachable") }
+
+func TestMirrorTargetDoesNotMistakeUnreachableForEmpty(t *testing.T) {
+	mirror := NewMirrorTarget(NewMemoryTarget(), failingTarget{})
+	_, err := mirror.Load("config")
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, fs.ErrNotExist))
+
+	bm := NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	bm.SetTarget(mirror)
+	_, err = bm.CreateBackup(nil, nil, nil)
+	assert.Error(t, err, "a repository is not created while a mirror is unreachable")
+}
+
+// flakyTarget fails every operation while down is set.
+type flakyTarget struct {
+	*MemoryTarget
+	down bool
+}
+
+func (t *flakyTarget) Save(name string, data []byte) error {
+	if t.down {
+		return errors.New("unreachable")
+	}
+	return t.MemoryTarget.Save(name, data)
+}
+
+func (t *flakyTarget) Exists(name string) (bool, error) {
+	if t.down {
+		return false, errors.New("unreachable")
+	}
+	return t.MemoryTarget.Exists(name)
+}
+
+func (t *flakyTarget) List(dir string) ([]string, error) {
+	if t.down {
+		return nil, errors.New("unreachable")
+	}
+	return t.MemoryTarget.List(dir)
+}
+
+func (t *flakyTarget) Remove(name string) error {
+	if t.down {
+		return errors.New("unreachable")
+	}
+	return t.MemoryTarget.Remove(name)
+}
+
+func TestMirrorTargetKeepsBackingUpWhileRemoteIsDown(t *testing.T) {
+	src := t.TempDir()
+	writeTestTree(t, src)
+	local := filepath.Join(t.TempDir(), "repo")
+	remote := &flakyTarget{MemoryTarget: NewMemoryTarget()}
+	mirror := NewMirrorTarget(NewDirTarget(local), remote)
+
+	bm := NewBackupManager(slog.Default(), local, "test-passphrase")
+	bm.SetTarget(mirror)
+	bm.SetPaths(src)
+	_, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, mirror.RemoteFailures())
+
+	// The local repository is authoritative: a remote that goes down is
+	// reported, not fatal.
+	remote.down = true
+	require.NoError(t, os.WriteFile(filepath.Join(src, "new.txt"), []byte("written during the outage"), 0644))
+	second, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	failures := mirror.RemoteFailures()
+	require.Len(t, failures, 1)
+	assert.Equal(t, 0, failures[0].Remote)
+	assert.Positive(t, failures[0].Count)
+	assert.ErrorContains(t, failures[0].Err, "unreachable")
+	assert.Empty(t, mirror.RemoteFailures(), "the counts reset once read")
+	ok, err := remote.MemoryTarget.Exists(snapshotName(second))
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Once it is back, the next backup copies what it missed.
+	remote.down = false
+	third, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, mirror.RemoteFailures())
+	require.NoError(t, os.RemoveAll(local))
+	fromRemote := NewBackupManager(slog.Default(), local, "test-passphrase")
+	fromRemote.SetTarget(NewMirrorTarget(NewDirTarget(local), remote))
+	target := t.TempDir()
+	require.NoError(t, fromRemote.RestoreFiles(third, target))
+	assert.FileExists(t, filepath.Join(target, entryPath(filepath.Join(src, "new.txt"))))
+}
+
+func TestBackupSurvivesLossOfLocalDisk(t *testing.T) {
+	src := t.TempDir()
+	writeTestTree(t, src)
+	local := filepath.Join(t.TempDir(), "repo")
+	remote := NewMemoryTarget()
+
+	bm := NewBackupManager(slog.Default(), local, "test-passphrase")
+	bm.SetTarget(NewMirrorTarget(NewDirTarget(local), remote))
+	bm.SetPaths(src)
+	id, err := bm.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, os.RemoveAll(local))
+
+	fresh := NewBackupManager(slog.Default(), local, "test-passphrase")
+	fresh.SetTarget(NewMirrorTarget(NewDirTarget(local), remote))
+	fresh.SetPaths(src)
+	target := t.TempDir()
+	require.NoError(t, fresh.RestoreFiles(id, target))
+	assert.FileExists(t, filepath.Join(target, entryPath(filepath.Join(src, "modules", "big.wasm"))))
+
+	// The next backup copies the repository config and the chunks it uses
+	// back to the local directory.
+	second, err := fresh.CreateBackup(nil, nil, nil)
+	require.NoError(t, err)
+	localOnly := NewBackupManager(slog.Default(), local, "test-passphrase")
+	require.NoError(t, localOnly.RestoreFiles(second, t.TempDir()))
+}
@@ -3,6 +3,7 @@ package controller
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	manifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
+	"github.com/naviNBRuas/APA/pkg/faults"
 	"github.com/naviNBRuas/APA/pkg/networking"
 )
 
@@ -57,6 +59,12 @@ func DefaultCommandFactory(ctx context.Context, name string, arg ...string) Comm
 	return &osExecCommand{cmd: cmd}
 }
 
+// ErrUnavailable is wrapped by HandleMessage errors that mean the message
+// did not reach the controller, such as a controller that is not running.
+// Senders retry those; any other error is the controller's answer to the
+// message itself.
+var ErrUnavailable = errors.New("controller unavailable")
+
 // Controller defines the interface for a decentralized controller module.
 type Controller interface {
 	Name() string
@@ -78,6 +86,11 @@ type GoBinaryController struct {
 	configFilePath  string         // Path to the controller's configuration file
 	messageFilePath string         // Path to the controller's message file
 	sandbox         SandboxOptions
+	exited          chan struct{} // closed once the started process has been reaped
+
+	// OnExit is called when the controller process exits without having been
+	// stopped, with the error returned by Wait (nil for a clean exit).
+	OnExit func(name string, err error)
 }
 
 // SandboxOptions define minimal process isolation knobs for controllers.
@@ -161,6 +174,8 @@ func (gbc *GoBinaryController) Start(ctx context.Context) error {
 		cancel()
 		return fmt.Errorf("failed to start controller binary '%s': %w", gbc.name, err)
 	}
+	exited := make(chan struct{})
+	gbc.exited = exited
 
 	go func() {
 		<-ctrlCtx.Done()
@@ -173,16 +188,36 @@ func (gbc *GoBinaryController) Start(ctx context.Context) error {
 	}()
 
 	go func() {
-		if err := gbc.cmd.Wait(); err != nil {
+		defer close(exited)
+		err := gbc.cmd.Wait()
+		if err != nil {
 			gbc.logger.Error("GoBinaryController process exited with error", "name", gbc.name, "error", err)
 		}
+		stopped := ctrlCtx.Err() != nil
 		cancel() // Ensure context is cancelled if process exits
 		gbc.logger.Info("GoBinaryController process exited", "name", gbc.name)
+		if !stopped && gbc.OnExit != nil {
+			gbc.OnExit(gbc.name, err)
+		}
 	}()
 
 	return nil
 }
 
+// Running reports whether the controller process has been started and has
+// not exited yet.
+func (gbc *GoBinaryController) Running() bool {
+	if gbc.exited == nil {
+		return false
+	}
+	select {
+	case <-gbc.exited:
+		return false
+	default:
+		return true
+	}
+}
+
 // Stop stops the external Go binary controller.
 func (gbc *GoBinaryController) Stop(ctx context.Context) error {
 	gbc.logger.Info("Stopping GoBinaryController", "name", gbc.name)
@@ -190,17 +225,14 @@ func (gbc *GoBinaryController) Stop(ctx context.Context) error {
 		gbc.cancel()
 	}
 
-	// Wait for the process to actually stop
-	done := make(chan struct{})
-	go func() {
-		if gbc.cmd != nil && gbc.cmd.Process() != nil {
-			_ = gbc.cmd.Wait() // Wait for the process to exit after kill
-		}
-		close(done)
-	}()
+	// Wait for the process to actually stop. The goroutine started by Start
+	// owns cmd.Wait; calling it again here would race with it.
+	if gbc.exited == nil {
+		return nil
+	}
 
 	select {
-	case <-done:
+	case <-gbc.exited:
 		return nil
 	case <-ctx.Done():
 		return fmt.Errorf("timeout stopping controller '%s': %w", gbc.name, ctx.Err())
@@ -266,17 +298,26 @@ func (gbc *GoBinaryController) HandleMessage(ctx context.Context, message networ
 
 	// Write the message to the message file
 	if err := os.WriteFile(gbc.messageFilePath, msgBytes, 0644); err != nil {
-		return fmt.Errorf("failed to write message to file for controller '%s': %w", gbc.name, err)
+		return fmt.Errorf("failed to write message to file for controller '%s': %w: %w", gbc.name, ErrUnavailable, err)
+	}
+
+	// An injected crash kills the process without stopping it, so the exit
+	// is reported through OnExit like a real crash.
+	if err := faults.Fail(faults.ControllerCrash, gbc.name); err != nil {
+		if gbc.cmd != nil && gbc.cmd.Process() != nil {
+			_ = gbc.cmd.Process().Kill()
+		}
+		return fmt.Errorf("controller '%s' crashed: %w: %w", gbc.name, ErrUnavailable, err)
 	}
 
 	// Send SIGUSR1 to the process to signal it to read the new message
 	if gbc.cmd != nil && gbc.cmd.Process() != nil {
 		gbc.logger.Info("Sending signal to GoBinaryController for message", "name", gbc.name, "pid", gbc.cmd.Process().Pid)
 		if err := gbc.cmd.Process().Signal(notifySignal()); err != nil {
-			return fmt.Errorf("failed to send signal to controller '%s': %w", gbc.name, err)
+			return fmt.Errorf("failed to send signal to controller '%s': %w: %w", gbc.name, ErrUnavailable, err)
 		}
 	} else {
-		return fmt.Errorf("controller '%s' not running, cannot handle message", gbc.name)
+		return fmt.Errorf("controller '%s' not running, cannot handle message: %w", gbc.name, ErrUnavailable)
 	}
 
 	return nil
@@ -217,3 +217,46 @@ func TestOsExecCommand_Implementation(t *testing.T) {
 }
 
 
+
+func TestGoBinaryController_OnExitReportsUnexpectedExit(t *testing.T) {
+	gbc := NewGoBinaryController(testLogger(), &manifest.Manifest{Name: "crashy", Path: "false"})
+	defer os.Remove(gbc.configFilePath)
+	defer os.Remove(gbc.messageFilePath)
+
+	exited := make(chan error, 1)
+	gbc.OnExit = func(name string, err error) {
+		assert.Equal(t, "crashy", name)
+		exited <- err
+	}
+	require.NoError(t, gbc.Start(context.Background()))
+
+	select {
+	case err := <-exited:
+		assert.Error(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("OnExit was not called")
+	}
+}
+
+func TestGoBinaryController_OnExitSkippedOnStop(t *testing.T) {
+	gbc := NewGoBinaryController(testLogger(), &manifest.Manifest{Name: "sleeper", Path: "sleep"})
+	defer os.Remove(gbc.configFilePath)
+	defer os.Remove(gbc.messageFilePath)
+	gbc.CommandFactory = func(ctx context.Context, name string, arg ...string) Command {
+		return DefaultCommandFactory(ctx, "sleep", "10")
+	}
+
+	called := make(chan struct{}, 1)
+	gbc.OnExit = func(string, error) { called <- struct{}{} }
+	require.NoError(t, gbc.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, gbc.Stop(ctx))
+
+	select {
+	case <-called:
+		t.Fatal("OnExit must not fire for a requested stop")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
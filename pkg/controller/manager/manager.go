@@ -5,21 +5,39 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/naviNBRuas/APA/pkg/consensus"
 	controllerPkg "github.com/naviNBRuas/APA/pkg/controller"
 	manifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
+	"github.com/naviNBRuas/APA/pkg/metrics"
 	"github.com/naviNBRuas/APA/pkg/networking"
 	"github.com/naviNBRuas/APA/pkg/policy"
+	"github.com/naviNBRuas/APA/pkg/robustness"
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
+// DefaultRPCPolicy guards messages sent to controllers: a controller that
+// is restarting gets a few quick retries, and one that keeps failing trips
+// its breaker so senders stop waiting on it. Only failures to reach the
+// controller count; see SendMessageToController.
+var DefaultRPCPolicy = robustness.PolicyConfig{
+	Timeout:        10 * time.Second,
+	Retry:          robustness.RetryPolicy{MaxAttempts: 3, InitialDelay: 200 * time.Millisecond, MaxDelay: 2 * time.Second, BackoffFactor: 2, Jitter: true},
+	RetryBudget:    0.2,
+	CircuitBreaker: robustness.CircuitBreakerConfig{FailureThreshold: 5, Timeout: 30 * time.Second},
+}
+
 // Manager handles the lifecycle of controllers.
 type Manager struct {
 	logger              *slog.Logger
@@ -30,6 +48,15 @@ type Manager struct {
 	p2pNetwork          *networking.P2P     // Add P2P network reference
 	consensus           consensus.Consensus // Consensus algorithm for distributed decision-making
 	allowedCapabilities map[string]struct{}
+	started             map[string]bool // controllers that have been started at least once
+	running             map[string]bool // controllers started and not stopped since
+	metrics             *metrics.Metrics
+	rpc                 *robustness.Policy
+
+	// OnControllerStart is called after every start attempt.
+	OnControllerStart func(name string, restart bool, err error)
+	// OnControllerExit is called when a controller process exits on its own.
+	OnControllerExit func(name string, err error)
 }
 
 // NewManager creates a new controller manager.
@@ -55,6 +82,9 @@ func NewManager(logger *slog.Logger, controllerDir string, policyEnforcer policy
 		policyEnforcer:      policyEnforcer,
 		consensus:           consensusAlg,
 		allowedCapabilities: allowedCaps,
+		started:             make(map[string]bool),
+		running:             make(map[string]bool),
+		rpc:                 robustness.NewPolicy(logger, "controller-rpc", DefaultRPCPolicy),
 	}
 
 	// Start the consensus algorithm
@@ -76,6 +106,21 @@ func (m *Manager) SetAllowedCapabilities(caps []string) {
 	}
 }
 
+// SetMetrics sets the registry that controller starts and restarts are recorded into.
+func (m *Manager) SetMetrics(mt *metrics.Metrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics = mt
+}
+
+// SetRPCPolicy replaces the resilience policy for messages sent to
+// controllers.
+func (m *Manager) SetRPCPolicy(p *robustness.Policy) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rpc = p
+}
+
 // SetP2PNetwork sets the P2P network instance for the manager.
 func (m *Manager) SetP2PNetwork(p2p *networking.P2P) {
 	m.mu.Lock()
@@ -173,6 +218,9 @@ func (m *Manager) loadControllerFromManifest(ctx context.Context, manifestPath s
 
 	// 5. Create a GoBinaryController for the external binary
 	controller := controllerPkg.NewGoBinaryController(m.logger, manifest)
+	if controller != nil {
+		controller.OnExit = m.controllerExited
+	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -182,23 +230,54 @@ func (m *Manager) loadControllerFromManifest(ctx context.Context, manifestPath s
 	return nil
 }
 
-// StartController starts a loaded controller by name.
-func (m *Manager) StartController(ctx context.Context, name string) error {
-	m.mu.RLock()
+// StartController starts a loaded controller by name. Starting a controller
+// that has been started before is counted as a restart.
+func (m *Manager) StartController(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "controller.StartController", attribute.String("controller.name", name))
+	defer func() { tracing.End(span, err) }()
+
+	m.mu.Lock()
 	controller, ok := m.controllers[name]
-	m.mu.RUnlock()
+	restart := m.started[name]
+	if ok {
+		m.started[name] = true
+	}
+	mt := m.metrics
+	m.mu.Unlock()
 	if !ok {
 		return fmt.Errorf("controller '%s' not found", name)
 	}
 
-	return controller.Start(ctx)
+	span.SetAttributes(attribute.Bool("controller.restart", restart))
+	err = controller.Start(ctx)
+	m.mu.Lock()
+	if err == nil {
+		m.running[name] = true
+	} else {
+		delete(m.running, name)
+	}
+	m.mu.Unlock()
+	mt.ObserveControllerStart(name, restart, err)
+	if m.OnControllerStart != nil {
+		m.OnControllerStart(name, restart, err)
+	}
+	return err
+}
+
+// controllerExited forwards unexpected controller process exits to OnControllerExit.
+func (m *Manager) controllerExited(name string, err error) {
+	m.logger.Warn("Controller exited unexpectedly", "name", name, "error", err)
+	if m.OnControllerExit != nil {
+		m.OnControllerExit(name, err)
+	}
 }
 
 // StopController stops a running controller by name.
 func (m *Manager) StopController(ctx context.Context, name string) error {
-	m.mu.RLock()
+	m.mu.Lock()
 	controller, ok := m.controllers[name]
-	m.mu.RUnlock()
+	delete(m.running, name)
+	m.mu.Unlock()
 	if !ok {
 		return fmt.Errorf("controller '%s' not found", name)
 	}
@@ -206,6 +285,30 @@ func (m *Manager) StopController(ctx context.Context, name string) error {
 	return controller.Stop(ctx)
 }
 
+// RestartController stops a controller, waiting for its process to exit if
+// it is still running, and starts it again.
+func (m *Manager) RestartController(ctx context.Context, name string) error {
+	if err := m.StopController(ctx, name); err != nil {
+		return err
+	}
+	return m.StartController(ctx, name)
+}
+
+// ExitedControllers returns the sorted names of controllers that were started,
+// have not been stopped, and whose process is no longer running.
+func (m *Manager) ExitedControllers() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var names []string
+	for name := range m.running {
+		if proc, ok := m.controllers[name].(interface{ Running() bool }); ok && !proc.Running() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ListControllers returns the manifests of all loaded controllers.
 func (m *Manager) ListControllers() []*manifest.Manifest {
 	m.mu.RLock()
@@ -221,6 +324,57 @@ func (m *Manager) ListControllers() []*manifest.Manifest {
 	return manifests
 }
 
+// ControllerData returns a loaded controller's manifest and binary, which
+// lives at <controllerDir>/<name>/<manifest path>.
+func (m *Manager) ControllerData(name string) (*manifest.Manifest, []byte, error) {
+	for _, mf := range m.ListControllers() {
+		if mf.Name != name {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(m.controllerDir, name, mf.Path))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read binary of controller %s: %w", name, err)
+		}
+		return mf, data, nil
+	}
+	return nil, nil, fmt.Errorf("controller '%s' not found", name)
+}
+
+// SaveAndLoadController writes a controller's manifest and binary to
+// <controllerDir>/<name> and loads it. The binary must match the manifest
+// hash, and its path must be a plain file name. The hash only binds the
+// binary to the manifest: callers must establish that the manifest itself
+// is trusted, as peer recovery does with a quorum of peers.
+func (m *Manager) SaveAndLoadController(mf *manifest.Manifest, data []byte) error {
+	if mf.Name == "" || filepath.Base(mf.Name) != mf.Name || mf.Name == "." || mf.Name == ".." {
+		return fmt.Errorf("invalid controller name %q", mf.Name)
+	}
+	if mf.Path == "" || filepath.Base(mf.Path) != mf.Path || mf.Path == "." || mf.Path == ".." || mf.Path == "manifest.json" {
+		return fmt.Errorf("invalid path %q for controller %s", mf.Path, mf.Name)
+	}
+	hash := sha256.Sum256(data)
+	if hex.EncodeToString(hash[:]) != mf.Hash {
+		return fmt.Errorf("controller '%s' binary does not match its manifest hash", mf.Name)
+	}
+
+	dir := filepath.Join(m.controllerDir, mf.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory for controller %s: %w", mf.Name, err)
+	}
+	manifestBytes, err := json.MarshalIndent(mf, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest for saving: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, mf.Path), data, 0755); err != nil {
+		return fmt.Errorf("failed to save controller binary: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), manifestBytes, 0644); err != nil {
+		return fmt.Errorf("failed to save manifest file: %w", err)
+	}
+	m.logger.Info("Successfully saved new controller", "name", mf.Name)
+	return m.LoadController(mf.Name)
+}
+
 // Shutdown gracefully stops all controllers.
 func (m *Manager) Shutdown(ctx context.Context) error {
 	m.logger.Info("Shutting down controller manager")
@@ -261,6 +415,7 @@ func (m *Manager) ConfigureController(ctx context.Context, name string, configDa
 func (m *Manager) SendMessageToController(ctx context.Context, name string, message interface{}) error {
 	m.mu.RLock()
 	controller, ok := m.controllers[name]
+	rpc := m.rpc
 	m.mu.RUnlock()
 	if !ok {
 		return fmt.Errorf("controller '%s' not found", name)
@@ -278,13 +433,23 @@ func (m *Manager) SendMessageToController(ctx context.Context, name string, mess
 		SenderPeerID: "local", // In a real implementation, this would be the actual sender's peer ID
 		Type:         "controller_message",
 		Data:         jsonData,
+		TraceContext: tracing.Inject(ctx),
 	}
 
 	// Log the message being sent
 	m.logger.Info("Sending message to controller", "name", name, "message_type", ctrlMessage.Type)
 
-	// Call the controller's HandleMessage method
-	return controller.HandleMessage(ctx, ctrlMessage)
+	// Call the controller's HandleMessage method, retrying while it restarts.
+	// An error the controller returns for the message itself would come back
+	// on every retry, and says nothing about the controller's health, so it
+	// is neither retried nor counted against the breaker.
+	return robustness.Run(ctx, rpc.Middleware(name), func(ctx context.Context) error {
+		err := controller.HandleMessage(ctx, ctrlMessage)
+		if err != nil && !errors.Is(err, controllerPkg.ErrUnavailable) && !errors.Is(err, context.DeadlineExceeded) {
+			return robustness.Permanent(err)
+		}
+		return err
+	})
 }
 
 // SendP2PMessageToController sends a message to a controller on another peer via the P2P network.
@@ -456,6 +621,7 @@ func (m *Manager) PublishControllerMessage(ctx context.Context, msgType string,
 		Type:         msgType,
 		Data:         payload,
 		SenderPeerID: "local", // In a real implementation, this would be the actual peer ID
+		TraceContext: tracing.Inject(ctx),
 	}
 
 	// Marshal the message
@@ -2,8 +2,13 @@ package manager
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -11,6 +16,7 @@ import (
 	manifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
 	"github.com/naviNBRuas/APA/pkg/networking"
 	"github.com/naviNBRuas/APA/pkg/policy"
+	"github.com/naviNBRuas/APA/pkg/robustness"
 )
 
 type mockPolicyEnforcer struct{}
@@ -49,6 +55,55 @@ func TestSendMessageToController(t *testing.T) {
 	_ = manager.SendMessageToController
 }
 
+// failingController answers every message with err.
+type failingController struct {
+	*controllerPkg.DummyController
+	err   error
+	calls int
+}
+
+func (f *failingController) HandleMessage(ctx context.Context, message networking.ControllerMessage) error {
+	f.calls++
+	return f.err
+}
+
+func TestSendMessageToControllerRetriesOnlyDelivery(t *testing.T) {
+	logger := slog.Default()
+	m := NewManager(logger, t.TempDir(), &mockPolicyEnforcer{})
+	cfg := DefaultRPCPolicy
+	cfg.Retry.InitialDelay, cfg.Retry.MaxDelay, cfg.Retry.Jitter = time.Millisecond, time.Millisecond, false
+	cfg.RetryBudget = 0
+	m.SetRPCPolicy(robustness.NewPolicy(logger, "controller-rpc", cfg))
+
+	invalid := &failingController{
+		DummyController: controllerPkg.NewDummyController("strict", logger, &manifest.Manifest{Name: "strict"}),
+		err:             errors.New("invalid task"),
+	}
+	down := &failingController{
+		DummyController: controllerPkg.NewDummyController("down", logger, &manifest.Manifest{Name: "down"}),
+		err:             fmt.Errorf("controller 'down' not running: %w", controllerPkg.ErrUnavailable),
+	}
+	m.mu.Lock()
+	m.controllers["strict"] = invalid
+	m.controllers["down"] = down
+	m.mu.Unlock()
+
+	// A message the controller rejects is not retried, and rejections do
+	// not open the breaker.
+	ctx := context.Background()
+	for i := 0; i < 2*cfg.CircuitBreaker.FailureThreshold; i++ {
+		err := m.SendMessageToController(ctx, "strict", map[string]string{"task": "bad"})
+		assert.ErrorContains(t, err, "invalid task")
+		assert.False(t, errors.Is(err, robustness.ErrCircuitOpen))
+	}
+	assert.Equal(t, 2*cfg.CircuitBreaker.FailureThreshold, invalid.calls)
+
+	// A controller that cannot be reached is retried.
+	err := m.SendMessageToController(ctx, "down", map[string]string{"task": "ok"})
+	assert.ErrorIs(t, err, controllerPkg.ErrUnavailable)
+	assert.Equal(t, cfg.Retry.MaxAttempts, down.calls)
+}
+
 func TestSendP2PMessageToController(t *testing.T) {
 	logger := slog.Default()
 	manager := NewManager(logger, "/tmp", &mockPolicyEnforcer{})
@@ -59,3 +114,82 @@ func TestSendP2PMessageToController(t *testing.T) {
 func TestManagerImplementsPolicyEnforcer(t *testing.T) {
 	var _ policy.PolicyEnforcer = (*mockPolicyEnforcer)(nil)
 }
+
+func TestSaveAndLoadController(t *testing.T) {
+	dir := t.TempDir()
+	m := NewManager(slog.Default(), dir, &mockPolicyEnforcer{})
+	binary := []byte("#!/bin/sh\nexit 0\n")
+	sum := sha256.Sum256(binary)
+	mf := &manifest.Manifest{Name: "ctl", Version: "1.0.0", Path: "ctl.sh", Hash: hex.EncodeToString(sum[:])}
+
+	assert.NoError(t, m.SaveAndLoadController(mf, binary))
+	got, data, err := m.ControllerData("ctl")
+	assert.NoError(t, err)
+	assert.Equal(t, "1.0.0", got.Version)
+	assert.Equal(t, binary, data)
+
+	bad := *mf
+	bad.Name = "other"
+	assert.Error(t, m.SaveAndLoadController(&bad, []byte("tampered")), "hash mismatch")
+	bad.Path = "../escape"
+	assert.Error(t, m.SaveAndLoadController(&bad, binary), "path outside the controller directory")
+	_, _, err = m.ControllerData("missing")
+	assert.Error(t, err)
+}
+
+func TestExitedControllers(t *testing.T) {
+	logger := slog.Default()
+	m := NewManager(logger, t.TempDir(), &mockPolicyEnforcer{})
+	crashy := controllerPkg.NewGoBinaryController(logger, &manifest.Manifest{Name: "crashy", Path: "false"})
+	sleeper := controllerPkg.NewGoBinaryController(logger, &manifest.Manifest{Name: "sleeper", Path: "sleep"})
+	sleeper.CommandFactory = func(ctx context.Context, name string, arg ...string) controllerPkg.Command {
+		return controllerPkg.DefaultCommandFactory(ctx, "sleep", "10")
+	}
+	m.mu.Lock()
+	m.controllers["crashy"] = crashy
+	m.controllers["sleeper"] = sleeper
+	m.mu.Unlock()
+
+	ctx := context.Background()
+	assert.Empty(t, m.ExitedControllers(), "nothing started yet")
+	assert.NoError(t, m.StartController(ctx, "crashy"))
+	assert.NoError(t, m.StartController(ctx, "sleeper"))
+	assert.Eventually(t, func() bool {
+		exited := m.ExitedControllers()
+		return len(exited) == 1 && exited[0] == "crashy"
+	}, 5*time.Second, 20*time.Millisecond)
+
+	stopCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	assert.NoError(t, m.StopController(stopCtx, "sleeper"))
+	assert.NoError(t, m.StopController(stopCtx, "crashy"))
+	assert.Empty(t, m.ExitedControllers(), "stopped controllers are not reported")
+}
+
+func TestRestartController(t *testing.T) {
+	logger := slog.Default()
+	m := NewManager(logger, t.TempDir(), &mockPolicyEnforcer{})
+	flaky := controllerPkg.NewGoBinaryController(logger, &manifest.Manifest{Name: "flaky", Path: "false"})
+	starts := 0
+	flaky.CommandFactory = func(ctx context.Context, name string, arg ...string) controllerPkg.Command {
+		starts++
+		if starts == 1 {
+			return controllerPkg.DefaultCommandFactory(ctx, "false")
+		}
+		return controllerPkg.DefaultCommandFactory(ctx, "sleep", "10")
+	}
+	m.mu.Lock()
+	m.controllers["flaky"] = flaky
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.NoError(t, m.StartController(ctx, "flaky"))
+	assert.Eventually(t, func() bool { return len(m.ExitedControllers()) == 1 }, 5*time.Second, 20*time.Millisecond)
+
+	assert.NoError(t, m.RestartController(ctx, "flaky"))
+	assert.Equal(t, 2, starts)
+	assert.Empty(t, m.ExitedControllers())
+	assert.Error(t, m.RestartController(ctx, "missing"))
+	assert.NoError(t, m.StopController(ctx, "flaky"))
+}
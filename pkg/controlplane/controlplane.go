@@ -9,6 +9,10 @@ import (
 	"sort"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
 const (
@@ -41,6 +45,23 @@ type Transport interface {
 	LocalID() string
 }
 
+// Clock supplies time to the control plane. The default is the wall clock;
+// simulations substitute a virtual one so TTLs and elections follow it.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a channel that ticks every d and a function that stops it.
+	NewTicker(d time.Duration) (<-chan time.Time, func())
+}
+
+type wallClock struct{}
+
+func (wallClock) Now() time.Time { return time.Now() }
+
+func (wallClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
 type stateEntry struct {
 	Key       string
 	Value     []byte
@@ -58,6 +79,8 @@ type controlMessage struct {
 	TTLMs   int64     `json:"ttl_ms"`
 	SentAt  time.Time `json:"sent_at"`
 	Type    string    `json:"type"` // update | request
+	// TraceContext carries the originating span across gossip hops.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
 }
 
 type electionMessage struct {
@@ -70,6 +93,7 @@ type ControlPlane struct {
 	logger    *slog.Logger
 	cfg       Config
 	transport Transport
+	clock     Clock
 
 	mu         sync.RWMutex
 	store      map[string]*stateEntry
@@ -109,6 +133,7 @@ func New(logger *slog.Logger, transport Transport, cfg Config) *ControlPlane {
 		logger:    logger,
 		cfg:       cfg,
 		transport: transport,
+		clock:     wallClock{},
 		store:     make(map[string]*stateEntry),
 		order:     make([]string, 0, cfg.PartialStateLimit),
 		localVers: make(map[string]uint64),
@@ -128,6 +153,13 @@ func (c *ControlPlane) SetLeaderRank(rank int64) {
 	c.leaderRank = rank
 }
 
+// SetClock replaces the wall clock. It must be called before Start.
+func (c *ControlPlane) SetClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+}
+
 // Start begins gossip and optional leader election.
 func (c *ControlPlane) Start(ctx context.Context) error {
 	ctx, cancel := context.WithCancel(ctx)
@@ -169,12 +201,20 @@ func (c *ControlPlane) Set(ctx context.Context, key string, value []byte, ttl ti
 		Value:  value,
 		Owner:  c.transport.LocalID(),
 		TTLMs:  ttl.Milliseconds(),
-		SentAt: time.Now().UTC(),
+		SentAt: c.clock.Now().UTC(),
 		Type:   "update",
 	}
+	ctx, span := tracing.Start(ctx, "controlplane.Set", attribute.String("controlplane.key", key))
+	defer span.End()
+	msg.TraceContext = tracing.Inject(ctx)
 
 	c.mu.Lock()
 	version := c.localVers[key] + 1
+	// Continue from the newest version seen so a value written by another
+	// node (e.g. a previous leader) is superseded rather than ignored.
+	if existing, ok := c.store[key]; ok && existing.Version >= version {
+		version = existing.Version + 1
+	}
 	c.localVers[key] = version
 	msg.Version = version
 	c.applyLocked(msg)
@@ -192,7 +232,7 @@ func (c *ControlPlane) Get(key string) ([]byte, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	entry, ok := c.store[key]
-	if !ok || time.Now().After(entry.ExpiresAt) {
+	if !ok || c.clock.Now().After(entry.ExpiresAt) {
 		return nil, false
 	}
 	return entry.Value, true
@@ -210,7 +250,7 @@ type SnapshotEntry struct {
 func (c *ControlPlane) Snapshot() []SnapshotEntry {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	now := time.Now()
+	now := c.clock.Now()
 	res := make([]SnapshotEntry, 0, len(c.store))
 	for _, e := range c.store {
 		if now.After(e.ExpiresAt) {
@@ -238,7 +278,11 @@ func (c *ControlPlane) consumeControl(ctx context.Context, ch <-chan []byte) {
 			if msg.Key == "" {
 				continue
 			}
-			c.handleControlMessage(ctx, msg)
+			msgCtx, span := tracing.Start(tracing.Extract(ctx, msg.TraceContext), "controlplane.handle",
+				attribute.String("controlplane.key", msg.Key),
+				attribute.String("controlplane.type", msg.Type))
+			c.handleControlMessage(msgCtx, msg)
+			span.End()
 		}
 	}
 }
@@ -281,7 +325,8 @@ func (c *ControlPlane) applyLocked(msg controlMessage) bool {
 	if effectiveTTL <= 0 {
 		effectiveTTL = c.cfg.EntryTTL
 	}
-	expires := time.Now().Add(effectiveTTL)
+	now := c.clock.Now()
+	expires := now.Add(effectiveTTL)
 	existing, ok := c.store[msg.Key]
 	if ok {
 		if msg.Version <= existing.Version {
@@ -295,7 +340,7 @@ func (c *ControlPlane) applyLocked(msg controlMessage) bool {
 		Version:   msg.Version,
 		Owner:     msg.Owner,
 		ExpiresAt: expires,
-		UpdatedAt: time.Now(),
+		UpdatedAt: now,
 	}
 	c.store[msg.Key] = entry
 	c.bumpOrder(msg.Key)
@@ -335,14 +380,14 @@ func (c *ControlPlane) enforceLimit() {
 }
 
 func (c *ControlPlane) pruneLoop(ctx context.Context) {
-	ticker := time.NewTicker(c.cfg.EntryTTL / 2)
-	defer ticker.Stop()
+	ticks, stop := c.clock.NewTicker(c.cfg.EntryTTL / 2)
+	defer stop()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			now := time.Now()
+		case <-ticks:
+			now := c.clock.Now()
 			c.mu.Lock()
 			for k, v := range c.store {
 				if now.After(v.ExpiresAt) {
@@ -355,8 +400,8 @@ func (c *ControlPlane) pruneLoop(ctx context.Context) {
 }
 
 func (c *ControlPlane) electionLoop(ctx context.Context) {
-	ticker := time.NewTicker(c.cfg.SyncInterval)
-	defer ticker.Stop()
+	ticks, stop := c.clock.NewTicker(c.cfg.SyncInterval)
+	defer stop()
 	self := c.transport.LocalID()
 	// announce immediately
 	_ = c.publishElection(ctx)
@@ -364,7 +409,7 @@ func (c *ControlPlane) electionLoop(ctx context.Context) {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticks:
 			_ = c.publishElection(ctx)
 			// log under lock to avoid races
 			c.mu.RLock()
@@ -380,7 +425,7 @@ func (c *ControlPlane) publishElection(ctx context.Context) error {
 	c.mu.RLock()
 	rank := c.leaderRank
 	c.mu.RUnlock()
-	msg := electionMessage{Candidate: c.transport.LocalID(), Rank: rank, SentAt: time.Now().UTC()}
+	msg := electionMessage{Candidate: c.transport.LocalID(), Rank: rank, SentAt: c.clock.Now().UTC()}
 	payload, err := json.Marshal(msg)
 	if err != nil {
 		return err
@@ -145,3 +145,30 @@ func TestElectedModeRoutesThroughLeader(t *testing.T) {
 	}
 	require.Fail(t, "leader did not apply follower update")
 }
+
+func TestSetSupersedesValueFromAnotherWriter(t *testing.T) {
+	bus := newTopicBus()
+	logger := slog.Default()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := Config{Mode: "leaderless", EntryTTL: time.Second}
+	cp1 := New(logger, &mockTransport{id: "nodeA", bus: bus}, cfg)
+	cp2 := New(logger, &mockTransport{id: "nodeB", bus: bus}, cfg)
+	require.NoError(t, cp1.Start(ctx))
+	require.NoError(t, cp2.Start(ctx))
+
+	require.NoError(t, cp1.Set(ctx, "plan", []byte("a1"), time.Second))
+	require.NoError(t, cp1.Set(ctx, "plan", []byte("a2"), time.Second))
+	require.Eventually(t, func() bool {
+		val, ok := cp2.Get("plan")
+		return ok && string(val) == "a2"
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// nodeB has never written the key itself; its value must still win.
+	require.NoError(t, cp2.Set(ctx, "plan", []byte("b1"), time.Second))
+	require.Eventually(t, func() bool {
+		val, ok := cp1.Get("plan")
+		return ok && string(val) == "b1"
+	}, 2*time.Second, 20*time.Millisecond)
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 
 	"github.com/naviNBRuas/APA/pkg/networking"
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
 // controllerTransport reuses the controller communication topic for control-plane gossip.
@@ -23,7 +24,7 @@ func NewControllerTransport(logger *slog.Logger, p2p *networking.P2P, idProvider
 }
 
 func (t *controllerTransport) Publish(ctx context.Context, topic string, payload []byte) error {
-	msg := networking.ControllerMessage{Type: topic, Data: payload}
+	msg := networking.ControllerMessage{Type: topic, Data: payload, TraceContext: tracing.Inject(ctx)}
 	b, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("marshal controller message: %w", err)
@@ -10,6 +10,7 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -17,8 +18,16 @@ import (
 	"sync"
 	"syscall"
 	"time"
+
+	"github.com/naviNBRuas/APA/pkg/robustness"
 )
 
+// DefaultFetchPolicy guards driver manifest and binary downloads.
+var DefaultFetchPolicy = robustness.PolicyConfig{
+	Timeout: 30 * time.Second,
+	Retry:   robustness.RetryPolicy{MaxAttempts: 3, InitialDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second, BackoffFactor: 2, Jitter: true},
+}
+
 // Manifest defines the metadata and security properties of a driver.
 type Manifest struct {
 	Name          string                      `json:"name"`
@@ -44,6 +53,7 @@ type Manager struct {
 	mu         sync.RWMutex
 	httpClient *http.Client
 	publicKeys map[string]ed25519.PublicKey // Trusted public keys for signature verification
+	fetches    *robustness.Policy
 }
 
 // NewManager creates a new driver manager.
@@ -54,9 +64,15 @@ func NewManager(logger *slog.Logger, driverDir string) *Manager {
 		driverDir:  driverDir,
 		httpClient: &http.Client{Timeout: 30 * time.Second},
 		publicKeys: make(map[string]ed25519.PublicKey),
+		fetches:    robustness.NewPolicy(logger, "driver", DefaultFetchPolicy),
 	}
 }
 
+// SetFetchPolicy replaces the resilience policy for driver downloads.
+func (m *Manager) SetFetchPolicy(p *robustness.Policy) {
+	m.fetches = p
+}
+
 // AddTrustedKey adds a trusted public key for signature verification
 func (m *Manager) AddTrustedKey(keyName string, publicKey ed25519.PublicKey) {
 	m.mu.Lock()
@@ -69,24 +85,10 @@ func (m *Manager) FetchAndVerify(ctx context.Context, manifestURL string) (*Mani
 	m.logger.Info("Fetching and verifying driver", "url", manifestURL)
 
 	// 1. Fetch manifest
-	req, err := http.NewRequestWithContext(ctx, "GET", manifestURL, nil)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create manifest request: %w", err)
-	}
-	resp, err := http.DefaultClient.Do(req)
+	manifestBytes, err := m.downloadFile(ctx, manifestURL)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to fetch manifest: %w", err)
 	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, nil, fmt.Errorf("bad status fetching manifest: %s", resp.Status)
-	}
-
-	manifestBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to read manifest body: %w", err)
-	}
 
 	var manifest Manifest
 	if err := json.Unmarshal(manifestBytes, &manifest); err != nil {
@@ -239,24 +241,31 @@ func (m *Manager) ExecuteDriver(ctx context.Context, name string, args []string)
 	return output, nil
 }
 
-// downloadFile is a helper to download a file from a URL.
-func (m *Manager) downloadFile(ctx context.Context, url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
+// downloadFile is a helper to download a file from a URL. Failed requests
+// are retried and each host has its own circuit breaker.
+func (m *Manager) downloadFile(ctx context.Context, rawURL string) ([]byte, error) {
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		host = u.Host
 	}
+	return robustness.Call(ctx, m.fetches.Middleware(host), func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, robustness.Permanent(err)
+		}
 
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = resp.Body.Close() }()
+		resp, err := m.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad status from driver server: %s", resp.Status)
-	}
+		if resp.StatusCode != http.StatusOK {
+			return nil, robustness.StatusError(resp.StatusCode, fmt.Errorf("bad status from driver server: %s", resp.Status))
+		}
 
-	return io.ReadAll(resp.Body)
+		return io.ReadAll(resp.Body)
+	})
 }
 
 // ListDrivers returns a list of all loaded drivers
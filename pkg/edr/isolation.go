@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os/exec"
 	"runtime"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
 )
 
 // quarantineNode quarantines the current node
@@ -29,8 +31,8 @@ func (rm *ResponseManager) quarantineNode(ctx context.Context, event *Event) err
 		return fmt.Errorf("failed to block outgoing connections: %w", err)
 	}
 
-	// Notify administrators (simulated)
-	if err := rm.notifyAdministrators(event); err != nil {
+	// Notify administrators
+	if err := rm.notifyAdministrators("quarantine", event); err != nil {
 		rm.logger.Error("Failed to notify administrators", "error", err)
 		// Don't fail the action if notification fails
 	}
@@ -107,19 +109,49 @@ func (rm *ResponseManager) blockOutgoingConnections() error {
 	return nil
 }
 
-// notifyAdministrators notifies administrators about the quarantine
-func (rm *ResponseManager) notifyAdministrators(event *Event) error {
-	// In a real implementation, this would send notifications to administrators
-	// For now, we'll just log the notification
-	rm.logger.Info("NOTIFICATION SENT TO ADMINISTRATORS",
+// notifyAdministrators raises an alert describing the response action taken
+// for event. Without an alert sink the notification is only logged.
+func (rm *ResponseManager) notifyAdministrators(action string, event *Event) error {
+	rm.logger.Info("Notifying administrators",
+		"action", action,
 		"event_id", event.ID,
 		"severity", event.Severity,
 		"source", event.Source,
 		"details", event.Details)
 
+	rm.mu.RLock()
+	sink := rm.alertSink
+	rm.mu.RUnlock()
+	if sink == nil {
+		return nil
+	}
+
+	sink.Raise(alerting.Alert{
+		Name:     "EDRResponse",
+		Severity: alertSeverity(event.Severity),
+		Summary:  fmt.Sprintf("EDR %s response for %s event from %s: %s", action, event.Type, event.Source, event.Details),
+		Labels: map[string]string{
+			"action":     action,
+			"event_type": event.Type,
+			"source":     event.Source,
+		},
+	})
 	return nil
 }
 
+// alertSeverity maps EDR severities (low, medium, high, critical) onto
+// alerting severities.
+func alertSeverity(severity string) string {
+	switch severity {
+	case "high", "critical":
+		return alerting.SeverityCritical
+	case "medium":
+		return alerting.SeverityWarning
+	default:
+		return alerting.SeverityInfo
+	}
+}
+
 // enterSafeMode enters a safe mode for the agent
 func (rm *ResponseManager) enterSafeMode() error {
 	// In a real implementation, this would put the agent in a safe mode
@@ -157,8 +189,8 @@ func (rm *ResponseManager) isolateNetwork(ctx context.Context, event *Event) err
 		return fmt.Errorf("failed to configure firewall: %w", err)
 	}
 
-	// Notify administrators (simulated)
-	if err := rm.notifyAdministrators(event); err != nil {
+	// Notify administrators
+	if err := rm.notifyAdministrators("isolate", event); err != nil {
 		rm.logger.Error("Failed to notify administrators", "error", err)
 		// Don't fail the action if notification fails
 	}
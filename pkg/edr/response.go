@@ -2,7 +2,12 @@ package edr
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"sync"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
+	"github.com/naviNBRuas/APA/pkg/approval"
 )
 
 // ResponseManager handles automated response actions
@@ -10,6 +15,16 @@ type ResponseManager struct {
 	logger        *slog.Logger
 	actions       map[string]*ResponseAction
 	responseRules map[string][]string // Map of severity to action IDs
+
+	mu        sync.RWMutex
+	alertSink alerting.Sink
+	approvals ApprovalGate
+}
+
+// ApprovalGate holds disruptive actions until they are approved.
+// approval.Queue implements it.
+type ApprovalGate interface {
+	Submit(action approval.Action, run func(ctx context.Context) error) (approval.Request, error)
 }
 
 // NewResponseManager creates a new response manager
@@ -21,6 +36,21 @@ func NewResponseManager(logger *slog.Logger) *ResponseManager {
 	}
 }
 
+// SetAlertSink routes administrator notifications to the alerting engine.
+func (rm *ResponseManager) SetAlertSink(sink alerting.Sink) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.alertSink = sink
+}
+
+// SetApprovalGate holds disruptive response actions for approval instead of
+// running them as soon as a rule matches.
+func (rm *ResponseManager) SetApprovalGate(gate ApprovalGate) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.approvals = gate
+}
+
 // AddAction adds a response action to the manager
 func (rm *ResponseManager) AddAction(action *ResponseAction) error {
 	rm.actions[action.ID] = action
@@ -111,6 +141,35 @@ func (rm *ResponseManager) executeAction(ctx context.Context, actionID string, e
 		"action_type", action.ActionType,
 		"event_id", event.ID)
 
+	rm.mu.RLock()
+	gate := rm.approvals
+	rm.mu.RUnlock()
+	if gate != nil && action.Disruptive() {
+		req, err := gate.Submit(approval.Action{
+			Name:     "edr." + action.ActionType,
+			Source:   "edr",
+			Subject:  event.Source,
+			Severity: event.Severity,
+			Reason:   event.Details,
+			Context: map[string]interface{}{
+				"event_id":        event.ID,
+				"event_type":      event.Type,
+				"response_action": action.ID,
+			},
+		}, func(ctx context.Context) error {
+			return rm.runAction(ctx, action, event)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to queue response action %s for approval: %w", actionID, err)
+		}
+		rm.logger.Info("Response action held for approval", "action_id", actionID, "approval_id", req.ID, "status", req.Status)
+		return nil
+	}
+	return rm.runAction(ctx, action, event)
+}
+
+// runAction carries out a response action.
+func (rm *ResponseManager) runAction(ctx context.Context, action *ResponseAction, event *Event) error {
 	// Execute the appropriate action based on type
 	switch action.ActionType {
 	case "quarantine":
@@ -8,6 +8,9 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
+	"github.com/naviNBRuas/APA/pkg/approval"
 )
 
 func TestResponseManager(t *testing.T) {
@@ -177,3 +180,62 @@ func TestGetAvailableActions(t *testing.T) {
 	actions := responseManager.GetAvailableActions()
 	assert.Equal(t, 2, len(actions))
 }
+
+type capturingSink struct {
+	alerts []alerting.Alert
+}
+
+func (s *capturingSink) Raise(alert alerting.Alert) {
+	s.alerts = append(s.alerts, alert)
+}
+
+func TestNotifyAdministratorsRaisesAlert(t *testing.T) {
+	responseManager := NewResponseManager(slog.Default())
+	event := &Event{ID: "evt-1", Type: "process", Source: "miner", Details: "cpu abuse", Severity: "high"}
+
+	// Without a sink the notification is only logged.
+	require.NoError(t, responseManager.notifyAdministrators("terminate", event))
+
+	sink := &capturingSink{}
+	responseManager.SetAlertSink(sink)
+	require.NoError(t, responseManager.notifyAdministrators("terminate", event))
+
+	require.Len(t, sink.alerts, 1)
+	alert := sink.alerts[0]
+	assert.Equal(t, "EDRResponse", alert.Name)
+	assert.Equal(t, alerting.SeverityCritical, alert.Severity)
+	assert.Equal(t, "terminate", alert.Labels["action"])
+	assert.Equal(t, "miner", alert.Labels["source"])
+	assert.Contains(t, alert.Summary, "cpu abuse")
+}
+
+// heldActions records what would wait for approval without running it.
+type heldActions struct {
+	actions []approval.Action
+}
+
+func (h *heldActions) Submit(action approval.Action, run func(ctx context.Context) error) (approval.Request, error) {
+	h.actions = append(h.actions, action)
+	return approval.Request{ID: "req-1", Action: action, Status: approval.StatusPending}, nil
+}
+
+func TestDisruptiveActionsWaitForApproval(t *testing.T) {
+	responseManager := NewResponseManager(slog.Default())
+	gate := &heldActions{}
+	responseManager.SetApprovalGate(gate)
+	require.NoError(t, responseManager.AddAction(&ResponseAction{ID: "iso", ActionType: "isolate", Enabled: true}))
+	require.NoError(t, responseManager.AddResponseRule("critical", []string{"iso"}))
+
+	event := &Event{ID: "evt-1", Type: "network", Source: "10.0.0.9:4444", Details: "beaconing", Severity: "critical"}
+	require.NoError(t, responseManager.ExecuteResponse(context.Background(), event))
+
+	require.Len(t, gate.actions, 1)
+	held := gate.actions[0]
+	assert.Equal(t, "edr.isolate", held.Name)
+	assert.Equal(t, "10.0.0.9:4444", held.Subject)
+	assert.Equal(t, "beaconing", held.Reason)
+	assert.Equal(t, "iso", held.Context["response_action"])
+
+	assert.True(t, (&ResponseAction{ActionType: "quarantine"}).Disruptive())
+	assert.False(t, (&ResponseAction{ActionType: "log"}).Disruptive())
+}
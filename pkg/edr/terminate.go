@@ -28,8 +28,8 @@ func (rm *ResponseManager) terminateProcess(ctx context.Context, event *Event) e
 	// Log the termination
 	rm.logger.Info("Process terminated successfully", "process", event.Source)
 
-	// Notify administrators (simulated)
-	if err := rm.notifyAdministrators(event); err != nil {
+	// Notify administrators
+	if err := rm.notifyAdministrators("terminate", event); err != nil {
 		rm.logger.Error("Failed to notify administrators", "error", err)
 		// Don't fail the action if notification fails
 	}
@@ -63,7 +63,7 @@ func (rm *ResponseManager) selfDestruct(ctx context.Context, event *Event) error
 	// 4. Notify administrators (if possible)
 
 	// Notify administrators first (before destruction)
-	if err := rm.notifyAdministrators(event); err != nil {
+	if err := rm.notifyAdministrators("self-destruct", event); err != nil {
 		rm.logger.Error("Failed to notify administrators", "error", err)
 		// Continue with self-destruction even if notification fails
 	}
@@ -12,3 +12,15 @@ type ResponseAction struct {
 	Enabled     bool      `json:"enabled"`
 	CreatedAt   time.Time `json:"created_at"`
 }
+
+// Disruptive reports whether the action interrupts the node's service or
+// connectivity. Disruptive actions wait for approval when the response
+// manager has an approval gate.
+func (a *ResponseAction) Disruptive() bool {
+	switch a.ActionType {
+	case "quarantine", "terminate", "isolate", "self-destruct":
+		return true
+	default:
+		return false
+	}
+}
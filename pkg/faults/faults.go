@@ -0,0 +1,130 @@
+// Package faults provides named fault injection points for resilience
+// testing. The hooks are compiled in only with the "faults" build tag;
+// without it every hook is a no-op and rules cannot be set.
+//
+// Each rule draws from its own random source seeded from Config.Seed and
+// the rule's point and target, so a run with the same seed and the same
+// sequence of calls injects the same faults.
+package faults
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"time"
+)
+
+// Point names a place in the agent where a fault can be injected.
+type Point string
+
+const (
+	// StoreWrite fails writes of the key/value store. Target: the store path.
+	StoreWrite Point = "store.write"
+	// PubsubPublish silently drops pubsub messages. Target: the topic.
+	PubsubPublish Point = "pubsub.publish"
+	// StreamLatency delays opening libp2p streams. Target: "<peer>/<protocol>".
+	StreamLatency Point = "stream.latency"
+	// ModuleTrap makes a module run fail as if the module trapped. Target: the module name.
+	ModuleTrap Point = "module.trap"
+	// ControllerCrash kills a controller process when it is sent a message. Target: the controller name.
+	ControllerCrash Point = "controller.crash"
+	// ClockSkew shifts the timestamps the agent publishes to peers. Target: unused.
+	ClockSkew Point = "clock.skew"
+)
+
+// Points lists every injection point.
+var Points = []Point{StoreWrite, PubsubPublish, StreamLatency, ModuleTrap, ControllerCrash, ClockSkew}
+
+var (
+	// ErrInjected is wrapped by every error returned by an injected fault.
+	ErrInjected = errors.New("injected fault")
+	// ErrNotCompiled is returned when rules are set in a build without the
+	// "faults" tag.
+	ErrNotCompiled = errors.New("fault injection not compiled in; build with -tags faults")
+)
+
+// Rule arms one injection point.
+type Rule struct {
+	Point       Point         `yaml:"point" json:"point"`
+	Target      string        `yaml:"target" json:"target,omitempty"`           // path.Match pattern; empty matches everything
+	Probability float64       `yaml:"probability" json:"probability,omitempty"` // chance each call is hit; 0 means every call
+	Count       int           `yaml:"count" json:"count,omitempty"`             // faults injected before the rule disarms; 0 is unlimited
+	Delay       time.Duration `yaml:"delay" json:"delay,omitempty"`             // stream.latency
+	Jitter      time.Duration `yaml:"jitter" json:"jitter,omitempty"`           // random extra stream.latency up to this
+	Skew        time.Duration `yaml:"skew" json:"skew,omitempty"`               // clock.skew offset, may be negative
+	Message     string        `yaml:"message" json:"message,omitempty"`         // error text for failing points
+}
+
+// RuleStatus is a rule with how often it was evaluated and fired.
+type RuleStatus struct {
+	Rule
+	Evaluated int64 `json:"evaluated"`
+	Fired     int64 `json:"fired"`
+}
+
+// Config arms injection points at startup.
+type Config struct {
+	Enabled bool   `yaml:"enabled"`
+	Seed    int64  `yaml:"seed"`
+	Rules   []Rule `yaml:"rules"`
+}
+
+// Validate checks the rules.
+func (c Config) Validate() error {
+	for i, r := range c.Rules {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the rule names a known point and carries the
+// parameters that point needs.
+func (r Rule) Validate() error {
+	known := false
+	for _, p := range Points {
+		known = known || p == r.Point
+	}
+	if !known {
+		return fmt.Errorf("unknown injection point %q", r.Point)
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("%s: probability must be between 0 and 1", r.Point)
+	}
+	if r.Count < 0 || r.Delay < 0 || r.Jitter < 0 {
+		return fmt.Errorf("%s: count, delay and jitter must not be negative", r.Point)
+	}
+	if _, err := path.Match(r.Target, ""); err != nil {
+		return fmt.Errorf("%s: invalid target pattern %q: %w", r.Point, r.Target, err)
+	}
+	switch r.Point {
+	case StreamLatency:
+		if r.Delay == 0 && r.Jitter == 0 {
+			return fmt.Errorf("%s: delay or jitter is required", r.Point)
+		}
+	case ClockSkew:
+		if r.Skew == 0 {
+			return fmt.Errorf("%s: skew is required", r.Point)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to target.
+func (r Rule) matches(target string) bool {
+	if r.Target == "" {
+		return true
+	}
+	ok, _ := path.Match(r.Target, target)
+	return ok
+}
+
+// err builds the error returned when the rule fires.
+func (r Rule) err(target string) error {
+	msg := r.Message
+	if msg == "" {
+		msg = string(r.Point)
+	}
+	return fmt.Errorf("%w: %s (%s)", ErrInjected, msg, target)
+}
@@ -0,0 +1,22 @@
+package faults
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleValidate(t *testing.T) {
+	assert.NoError(t, Rule{Point: StoreWrite}.Validate())
+	assert.NoError(t, Rule{Point: StreamLatency, Delay: time.Second, Target: "12D3*/apa/*"}.Validate())
+	assert.NoError(t, Rule{Point: ClockSkew, Skew: -time.Minute}.Validate())
+
+	assert.Error(t, Rule{Point: "disk.melt"}.Validate())
+	assert.Error(t, Rule{Point: StoreWrite, Probability: 1.5}.Validate())
+	assert.Error(t, Rule{Point: StoreWrite, Count: -1}.Validate())
+	assert.Error(t, Rule{Point: StoreWrite, Target: "["}.Validate())
+	assert.Error(t, Rule{Point: StreamLatency}.Validate(), "latency needs a delay")
+	assert.Error(t, Rule{Point: ClockSkew}.Validate(), "skew needs an offset")
+	assert.Error(t, Config{Rules: []Rule{{Point: ModuleTrap}, {Point: "nope"}}}.Validate())
+}
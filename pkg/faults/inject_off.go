@@ -0,0 +1,46 @@
+//go:build !faults
+
+package faults
+
+import (
+	"context"
+	"time"
+)
+
+// Enabled reports whether fault injection is compiled in.
+const Enabled = false
+
+// Configure rejects enabled configurations in this build.
+func Configure(cfg Config) error {
+	if cfg.Enabled {
+		return ErrNotCompiled
+	}
+	return nil
+}
+
+// Set is not available in this build.
+func Set(Rule) error { return ErrNotCompiled }
+
+// Clear does nothing in this build.
+func Clear(Point, string) {}
+
+// Reset does nothing in this build.
+func Reset() {}
+
+// Seed returns 0 in this build.
+func Seed() int64 { return 0 }
+
+// Rules returns nothing in this build.
+func Rules() []RuleStatus { return nil }
+
+// Fail never fails in this build.
+func Fail(Point, string) error { return nil }
+
+// Drop never drops in this build.
+func Drop(Point, string) bool { return false }
+
+// Delay never delays in this build.
+func Delay(context.Context, Point, string) error { return nil }
+
+// Now returns the wall clock.
+func Now() time.Time { return time.Now() }
@@ -0,0 +1,21 @@
+//go:build !faults
+
+package faults
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooksAreInertWithoutBuildTag(t *testing.T) {
+	assert.False(t, Enabled)
+	assert.ErrorIs(t, Configure(Config{Enabled: true, Rules: []Rule{{Point: StoreWrite}}}), ErrNotCompiled)
+	assert.NoError(t, Configure(Config{}))
+	assert.ErrorIs(t, Set(Rule{Point: StoreWrite}), ErrNotCompiled)
+	assert.NoError(t, Fail(StoreWrite, "x"))
+	assert.False(t, Drop(PubsubPublish, "x"))
+	assert.NoError(t, Delay(context.Background(), StreamLatency, "x"))
+	assert.Empty(t, Rules())
+}
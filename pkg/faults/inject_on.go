@@ -0,0 +1,196 @@
+//go:build faults
+
+package faults
+
+import (
+	"context"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Enabled reports whether fault injection is compiled in.
+const Enabled = true
+
+// armedRule is a rule with its own random source and counters.
+type armedRule struct {
+	Rule
+	rng       *rand.Rand
+	evaluated int64
+	fired     int64
+}
+
+var (
+	mu    sync.Mutex
+	seed  int64
+	rules []*armedRule
+	armed atomic.Bool // fast path for hooks while no rule is set
+)
+
+// Configure replaces every rule with cfg's and reseeds. A disabled config
+// clears all rules.
+func Configure(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	seed = cfg.Seed
+	rules = nil
+	if cfg.Enabled {
+		for _, r := range cfg.Rules {
+			rules = append(rules, arm(r))
+		}
+	}
+	armed.Store(len(rules) > 0)
+	return nil
+}
+
+// arm gives r a random source derived from the seed, its point and its
+// target, so adding or removing other rules does not change its draws.
+func arm(r Rule) *armedRule {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(string(r.Point) + "\x00" + r.Target))
+	return &armedRule{Rule: r, rng: rand.New(rand.NewSource(seed ^ int64(h.Sum64())))}
+}
+
+// Set adds r, replacing a rule with the same point and target.
+func Set(r Rule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for i, existing := range rules {
+		if existing.Point == r.Point && existing.Target == r.Target {
+			rules[i] = arm(r)
+			return nil
+		}
+	}
+	rules = append(rules, arm(r))
+	armed.Store(true)
+	return nil
+}
+
+// Clear removes the rules for point, or only the one with target when
+// target is not empty.
+func Clear(point Point, target string) {
+	mu.Lock()
+	defer mu.Unlock()
+	kept := rules[:0]
+	for _, r := range rules {
+		if r.Point != point || (target != "" && r.Target != target) {
+			kept = append(kept, r)
+		}
+	}
+	rules = kept
+	armed.Store(len(rules) > 0)
+}
+
+// Reset removes every rule.
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	rules = nil
+	armed.Store(false)
+}
+
+// Seed returns the configured seed.
+func Seed() int64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return seed
+}
+
+// Rules returns the armed rules and their counters.
+func Rules() []RuleStatus {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make([]RuleStatus, 0, len(rules))
+	for _, r := range rules {
+		out = append(out, RuleStatus{Rule: r.Rule, Evaluated: r.evaluated, Fired: r.fired})
+	}
+	return out
+}
+
+// hit returns the first rule for point and target that fires on this call,
+// and the jitter it drew.
+func hit(point Point, target string) (Rule, time.Duration, bool) {
+	if !armed.Load() {
+		return Rule{}, 0, false
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range rules {
+		if r.Point != point || !r.matches(target) {
+			continue
+		}
+		if r.Count > 0 && r.fired >= int64(r.Count) {
+			continue
+		}
+		r.evaluated++
+		if r.Probability > 0 && r.rng.Float64() >= r.Probability {
+			continue
+		}
+		r.fired++
+		var jitter time.Duration
+		if r.Jitter > 0 {
+			jitter = time.Duration(r.rng.Int63n(int64(r.Jitter) + 1))
+		}
+		return r.Rule, jitter, true
+	}
+	return Rule{}, 0, false
+}
+
+// Fail returns an error wrapping ErrInjected when a rule for point fires.
+func Fail(point Point, target string) error {
+	if r, _, ok := hit(point, target); ok {
+		return r.err(target)
+	}
+	return nil
+}
+
+// Drop reports whether a rule for point fires, meaning the caller should
+// silently discard what it was about to send.
+func Drop(point Point, target string) bool {
+	_, _, ok := hit(point, target)
+	return ok
+}
+
+// Delay sleeps for the delay of a rule for point that fires. It returns
+// ctx's error if ctx is done first.
+func Delay(ctx context.Context, point Point, target string) error {
+	r, jitter, ok := hit(point, target)
+	if !ok {
+		return nil
+	}
+	t := time.NewTimer(r.Delay + jitter)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Now returns the wall clock shifted by the first clock.skew rule.
+// Probability and count do not apply to clock skew.
+func Now() time.Time {
+	now := time.Now()
+	if !armed.Load() {
+		return now
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, r := range rules {
+		if r.Point == ClockSkew {
+			r.evaluated++
+			r.fired++
+			return now.Add(r.Skew)
+		}
+	}
+	return now
+}
@@ -0,0 +1,95 @@
+//go:build faults
+
+package faults
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// draws records which of n calls to a failing point are hit.
+func draws(n int) []bool {
+	out := make([]bool, n)
+	for i := range out {
+		out[i] = Fail(StoreWrite, "/var/lib/apa/state.json") != nil
+	}
+	return out
+}
+
+func TestSeededRulesAreReproducible(t *testing.T) {
+	t.Cleanup(Reset)
+	cfg := Config{Enabled: true, Seed: 42, Rules: []Rule{{Point: StoreWrite, Probability: 0.3}}}
+
+	require.NoError(t, Configure(cfg))
+	first := draws(200)
+	require.NoError(t, Configure(cfg))
+	assert.Equal(t, first, draws(200), "same seed, same faults")
+
+	hits := 0
+	for _, h := range first {
+		if h {
+			hits++
+		}
+	}
+	assert.InDelta(t, 60, hits, 25)
+
+	cfg.Seed = 7
+	require.NoError(t, Configure(cfg))
+	assert.NotEqual(t, first, draws(200), "another seed, other faults")
+
+	// Another rule does not shift this rule's draws.
+	cfg.Seed = 42
+	cfg.Rules = append(cfg.Rules, Rule{Point: ModuleTrap, Probability: 0.5})
+	require.NoError(t, Configure(cfg))
+	got := make([]bool, 200)
+	for i := range got {
+		_ = Fail(ModuleTrap, "scanner")
+		got[i] = Fail(StoreWrite, "/var/lib/apa/state.json") != nil
+	}
+	assert.Equal(t, first, got)
+}
+
+func TestRuleTargetsAndCount(t *testing.T) {
+	t.Cleanup(Reset)
+	require.NoError(t, Set(Rule{Point: ModuleTrap, Target: "scan*", Count: 2, Message: "unreachable executed"}))
+
+	assert.NoError(t, Fail(ModuleTrap, "core"))
+	err := Fail(ModuleTrap, "scanner")
+	require.ErrorIs(t, err, ErrInjected)
+	assert.Contains(t, err.Error(), "unreachable executed")
+	assert.Error(t, Fail(ModuleTrap, "scanner"))
+	assert.NoError(t, Fail(ModuleTrap, "scanner"), "count exhausted")
+
+	status := Rules()
+	require.Len(t, status, 1)
+	assert.EqualValues(t, 2, status[0].Fired)
+
+	Clear(ModuleTrap, "")
+	assert.Empty(t, Rules())
+}
+
+func TestDropDelayAndSkew(t *testing.T) {
+	t.Cleanup(Reset)
+	require.NoError(t, Set(Rule{Point: PubsubPublish, Target: "apa/heartbeat/*"}))
+	require.NoError(t, Set(Rule{Point: StreamLatency, Delay: 20 * time.Millisecond}))
+	require.NoError(t, Set(Rule{Point: ClockSkew, Skew: time.Hour}))
+
+	assert.True(t, Drop(PubsubPublish, "apa/heartbeat/1.0.0"))
+	assert.False(t, Drop(PubsubPublish, "apa/fleet-status"))
+
+	start := time.Now()
+	require.NoError(t, Delay(context.Background(), StreamLatency, "peer/proto"))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Delay(ctx, StreamLatency, "peer/proto"), context.Canceled)
+
+	assert.WithinDuration(t, time.Now().Add(time.Hour), Now(), time.Second)
+	Clear(ClockSkew, "")
+	assert.WithinDuration(t, time.Now(), Now(), time.Second)
+}
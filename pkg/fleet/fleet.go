@@ -0,0 +1,269 @@
+// Package fleet builds, signs and aggregates the compact status summaries
+// agents gossip to each other, so any single agent can describe the whole
+// fleet without scraping every node's admin API.
+package fleet
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Health values reported in Status.Health.
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+)
+
+// Role values reported in Status.Role.
+const (
+	RoleLeader   = "leader"
+	RoleFollower = "follower"
+)
+
+// maxClockSkew bounds how far in the future a status timestamp may be.
+const maxClockSkew = time.Minute
+
+// Config controls status publishing and aggregation.
+type Config struct {
+	PublishInterval time.Duration `yaml:"publish_interval"` // defaults to 30s
+	StaleAfter      time.Duration `yaml:"stale_after"`      // defaults to 3x PublishInterval
+	ExpireAfter     time.Duration `yaml:"expire_after"`     // defaults to 20x PublishInterval
+	Tier            string        `yaml:"tier"`             // edge | relay | backbone, reported as-is
+}
+
+// WithDefaults fills unset durations.
+func (c Config) WithDefaults() Config {
+	if c.PublishInterval <= 0 {
+		c.PublishInterval = 30 * time.Second
+	}
+	if c.StaleAfter <= 0 {
+		c.StaleAfter = 3 * c.PublishInterval
+	}
+	if c.ExpireAfter <= 0 {
+		c.ExpireAfter = 20 * c.PublishInterval
+	}
+	if c.Tier == "" {
+		c.Tier = "unknown"
+	}
+	return c
+}
+
+// ModuleInfo identifies a loaded module.
+type ModuleInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Status is the summary an agent publishes about itself.
+type Status struct {
+	PeerID        string       `json:"peer_id"`
+	Version       string       `json:"version"`
+	Role          string       `json:"role"`
+	Tier          string       `json:"tier"`
+	Health        string       `json:"health"`
+	FailingChecks []string     `json:"failing_checks,omitempty"`
+	Modules       []ModuleInfo `json:"modules"`
+	Controllers   []string     `json:"controllers"`
+	PeerCount     int          `json:"peer_count"`
+	UptimeSeconds int64        `json:"uptime_seconds"`
+	Timestamp     time.Time    `json:"timestamp"`
+}
+
+// SignedStatus is a Status with the publisher's signature over its JSON encoding.
+type SignedStatus struct {
+	Status    Status `json:"status"`
+	Signature []byte `json:"signature"`
+}
+
+// Sign signs status with the agent identity key.
+func Sign(status Status, key crypto.PrivKey) (*SignedStatus, error) {
+	status.Timestamp = status.Timestamp.UTC()
+	data, err := json.Marshal(status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal fleet status: %w", err)
+	}
+	sig, err := key.Sign(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign fleet status: %w", err)
+	}
+	return &SignedStatus{Status: status, Signature: sig}, nil
+}
+
+// Verify checks the signature against the public key embedded in Status.PeerID.
+func (s *SignedStatus) Verify() error {
+	id, err := peer.Decode(s.Status.PeerID)
+	if err != nil {
+		return fmt.Errorf("failed to decode peer ID: %w", err)
+	}
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("failed to extract public key from peer ID: %w", err)
+	}
+	data, err := json.Marshal(s.Status)
+	if err != nil {
+		return fmt.Errorf("failed to marshal fleet status: %w", err)
+	}
+	ok, err := pub.Verify(data, s.Signature)
+	if err != nil {
+		return fmt.Errorf("failed to verify fleet status signature: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("invalid fleet status signature for %s", s.Status.PeerID)
+	}
+	return nil
+}
+
+// NodeView is one node in the aggregated view.
+type NodeView struct {
+	Status
+	LastSeen   time.Time `json:"last_seen"`
+	AgeSeconds float64   `json:"age_seconds"`
+	Stale      bool      `json:"stale"`
+	Self       bool      `json:"self,omitempty"`
+}
+
+// Summary counts nodes by the fields operators usually group by.
+type Summary struct {
+	Total    int            `json:"total"`
+	Stale    int            `json:"stale"`
+	Versions map[string]int `json:"versions"`
+	Health   map[string]int `json:"health"`
+	Roles    map[string]int `json:"roles"`
+	Tiers    map[string]int `json:"tiers"`
+}
+
+// View is the merged fleet status returned by /admin/fleet.
+type View struct {
+	GeneratedAt time.Time  `json:"generated_at"`
+	Aggregator  string     `json:"aggregator"`
+	StaleAfter  float64    `json:"stale_after_seconds"`
+	Summary     Summary    `json:"summary"`
+	Nodes       []NodeView `json:"nodes"`
+}
+
+type entry struct {
+	status   Status
+	received time.Time
+}
+
+// Aggregator keeps the latest verified status of every node it has heard from.
+type Aggregator struct {
+	mu      sync.Mutex
+	self    string
+	cfg     Config
+	entries map[string]entry
+	now     func() time.Time
+}
+
+// NewAggregator creates an aggregator for the agent identified by self.
+func NewAggregator(self string, cfg Config) *Aggregator {
+	return &Aggregator{
+		self:    self,
+		cfg:     cfg.WithDefaults(),
+		entries: make(map[string]entry),
+		now:     time.Now,
+	}
+}
+
+// Observe verifies and records a status received from sender. An empty
+// sender skips the sender check (for locally produced statuses). Statuses
+// older than the one already held are ignored.
+func (a *Aggregator) Observe(s *SignedStatus, sender string) error {
+	if s == nil {
+		return fmt.Errorf("nil fleet status")
+	}
+	if sender != "" && sender != s.Status.PeerID {
+		return fmt.Errorf("fleet status for %s published by %s", s.Status.PeerID, sender)
+	}
+	if err := s.Verify(); err != nil {
+		return err
+	}
+	now := a.now()
+	if s.Status.Timestamp.After(now.Add(maxClockSkew)) {
+		return fmt.Errorf("fleet status from %s is timestamped in the future", s.Status.PeerID)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if prev, ok := a.entries[s.Status.PeerID]; ok && !s.Status.Timestamp.After(prev.status.Timestamp) {
+		return nil
+	}
+	a.entries[s.Status.PeerID] = entry{status: s.Status, received: now}
+	return nil
+}
+
+// View returns the merged fleet view, dropping nodes not heard from within
+// ExpireAfter and flagging those older than StaleAfter.
+func (a *Aggregator) View() View {
+	now := a.now()
+
+	a.mu.Lock()
+	for id, e := range a.entries {
+		if now.Sub(e.received) > a.cfg.ExpireAfter {
+			delete(a.entries, id)
+		}
+	}
+	nodes := make([]NodeView, 0, len(a.entries))
+	for id, e := range a.entries {
+		age := now.Sub(e.received)
+		nodes = append(nodes, NodeView{
+			Status:     e.status,
+			LastSeen:   e.received.UTC(),
+			AgeSeconds: age.Seconds(),
+			Stale:      age > a.cfg.StaleAfter,
+			Self:       id == a.self,
+		})
+	}
+	a.mu.Unlock()
+
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].PeerID < nodes[j].PeerID })
+
+	summary := Summary{
+		Versions: map[string]int{},
+		Health:   map[string]int{},
+		Roles:    map[string]int{},
+		Tiers:    map[string]int{},
+	}
+	for _, n := range nodes {
+		summary.Total++
+		if n.Stale {
+			summary.Stale++
+		}
+		summary.Versions[n.Version]++
+		summary.Health[n.Health]++
+		summary.Roles[n.Role]++
+		summary.Tiers[n.Tier]++
+	}
+
+	return View{
+		GeneratedAt: now.UTC(),
+		Aggregator:  a.self,
+		StaleAfter:  a.cfg.StaleAfter.Seconds(),
+		Summary:     summary,
+		Nodes:       nodes,
+	}
+}
+
+// ClockSkews returns, for every fresh node other than self, how far its clock
+// was behind ours when its latest status arrived; negative values mean it was
+// ahead. The values include gossip delay, and statuses more than a minute in
+// the future are never accepted.
+func (a *Aggregator) ClockSkews() map[string]time.Duration {
+	now := a.now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	skews := make(map[string]time.Duration)
+	for id, e := range a.entries {
+		if id == a.self || now.Sub(e.received) > a.cfg.StaleAfter {
+			continue
+		}
+		skews[id] = e.received.Sub(e.status.Timestamp)
+	}
+	return skews
+}
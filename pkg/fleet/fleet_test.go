@@ -0,0 +1,129 @@
+package fleet
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func newKey(t *testing.T) (crypto.PrivKey, string) {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	return priv, id.String()
+}
+
+func signedAt(t *testing.T, key crypto.PrivKey, id, version string, ts time.Time) *SignedStatus {
+	t.Helper()
+	s, err := Sign(Status{PeerID: id, Version: version, Role: RoleFollower, Tier: "edge", Health: HealthHealthy, Timestamp: ts}, key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestSignVerifyRoundTripThroughJSON(t *testing.T) {
+	key, id := newKey(t)
+	s := signedAt(t, key, id, "v1.0.0", time.Now())
+
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	var decoded SignedStatus
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.NoError(t, decoded.Verify())
+
+	decoded.Status.Version = "v9.9.9"
+	require.Error(t, decoded.Verify())
+}
+
+func TestObserveRejectsForgedAndMismatchedStatuses(t *testing.T) {
+	key, id := newKey(t)
+	otherKey, otherID := newKey(t)
+	agg := NewAggregator(id, Config{})
+
+	// Signed by a different key than the one in PeerID.
+	forged := signedAt(t, otherKey, id, "v1.0.0", time.Now())
+	require.Error(t, agg.Observe(forged, ""))
+
+	// Valid signature but relayed under another sender.
+	require.Error(t, agg.Observe(signedAt(t, key, id, "v1.0.0", time.Now()), otherID))
+
+	require.Error(t, agg.Observe(signedAt(t, key, id, "v1.0.0", time.Now().Add(time.Hour)), id))
+	require.Empty(t, agg.View().Nodes)
+}
+
+func TestObserveKeepsNewestStatus(t *testing.T) {
+	key, id := newKey(t)
+	agg := NewAggregator("self", Config{})
+	now := time.Now()
+
+	require.NoError(t, agg.Observe(signedAt(t, key, id, "v2.0.0", now), id))
+	require.NoError(t, agg.Observe(signedAt(t, key, id, "v1.0.0", now.Add(-time.Minute)), id))
+
+	view := agg.View()
+	require.Len(t, view.Nodes, 1)
+	require.Equal(t, "v2.0.0", view.Nodes[0].Version)
+}
+
+func TestViewMarksStaleAndExpiresNodes(t *testing.T) {
+	selfKey, selfID := newKey(t)
+	peerKey, peerID := newKey(t)
+	goneKey, goneID := newKey(t)
+
+	clock := time.Now()
+	agg := NewAggregator(selfID, Config{PublishInterval: 10 * time.Second})
+	agg.now = func() time.Time { return clock }
+
+	require.NoError(t, agg.Observe(signedAt(t, goneKey, goneID, "v1.0.0", clock), goneID))
+	clock = clock.Add(150 * time.Second)
+	require.NoError(t, agg.Observe(signedAt(t, peerKey, peerID, "v1.0.0", clock), peerID))
+	clock = clock.Add(45 * time.Second)
+	require.NoError(t, agg.Observe(signedAt(t, selfKey, selfID, "v1.1.0", clock), ""))
+
+	view := agg.View()
+	require.Equal(t, 3, view.Summary.Total)
+	require.Equal(t, 2, view.Summary.Stale)
+	require.Equal(t, map[string]int{"v1.0.0": 2, "v1.1.0": 1}, view.Summary.Versions)
+	byID := map[string]NodeView{}
+	for _, n := range view.Nodes {
+		byID[n.PeerID] = n
+	}
+	require.True(t, byID[selfID].Self)
+	require.False(t, byID[selfID].Stale)
+	require.True(t, byID[peerID].Stale)
+	require.InDelta(t, 45, byID[peerID].AgeSeconds, 0.001)
+
+	// ExpireAfter defaults to 20 publish intervals (200s).
+	clock = clock.Add(10 * time.Second)
+	view = agg.View()
+	require.Equal(t, 2, view.Summary.Total)
+	for _, n := range view.Nodes {
+		require.NotEqual(t, goneID, n.PeerID)
+	}
+}
+
+func TestClockSkews(t *testing.T) {
+	selfKey, selfID := newKey(t)
+	slowKey, slowID := newKey(t)
+	fastKey, fastID := newKey(t)
+	staleKey, staleID := newKey(t)
+
+	clock := time.Now()
+	agg := NewAggregator(selfID, Config{PublishInterval: 10 * time.Second})
+	agg.now = func() time.Time { return clock }
+
+	require.NoError(t, agg.Observe(signedAt(t, staleKey, staleID, "v1.0.0", clock), staleID))
+	clock = clock.Add(time.Minute)
+	require.NoError(t, agg.Observe(signedAt(t, selfKey, selfID, "v1.0.0", clock), ""))
+	require.NoError(t, agg.Observe(signedAt(t, slowKey, slowID, "v1.0.0", clock.Add(-5*time.Minute)), slowID))
+	require.NoError(t, agg.Observe(signedAt(t, fastKey, fastID, "v1.0.0", clock.Add(20*time.Second)), fastID))
+
+	require.Equal(t, map[string]time.Duration{
+		slowID: 5 * time.Minute,
+		fastID: -20 * time.Second,
+	}, agg.ClockSkews())
+}
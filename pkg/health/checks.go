@@ -0,0 +1,288 @@
+package health
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+
+	"github.com/naviNBRuas/APA/pkg/store"
+)
+
+// Names of the built-in checks.
+const (
+	CheckDiskModules     = "disk-modules"
+	CheckDiskState       = "disk-state"
+	CheckStore           = "store"
+	CheckPubsubTopics    = "pubsub-topics"
+	CheckPeers           = "peers"
+	CheckClockSkew       = "clock-skew"
+	CheckAdminTLSCert    = "admin-tls-certificate"
+	CheckControllers     = "controllers"
+	CheckModuleRuntime   = "module-runtime"
+	CheckProcessLiveness = "process-liveness"
+)
+
+// baseCheck holds the name and component shared by the built-in checks.
+type baseCheck struct {
+	name      string
+	component string
+}
+
+func (b baseCheck) Name() string { return b.name }
+
+func (b baseCheck) result(status Status, message string, metrics map[string]interface{}) CheckResult {
+	return CheckResult{Name: b.name, Component: b.component, Status: status, Message: message, Metrics: metrics}
+}
+
+// DiskCheck watches free space and free inodes on the filesystem holding a
+// directory.
+type DiskCheck struct {
+	baseCheck
+	path string
+	cfg  DiskConfig
+}
+
+// NewDiskCheck returns a check of the filesystem holding path.
+func NewDiskCheck(name, path string, cfg DiskConfig) *DiskCheck {
+	return &DiskCheck{baseCheck: baseCheck{name: name, component: "disk"}, path: path, cfg: cfg}
+}
+
+func (c *DiskCheck) Check(ctx context.Context) CheckResult {
+	usage, err := disk.UsageWithContext(ctx, c.path)
+	if err != nil {
+		return c.result(StatusFailed, fmt.Sprintf("failed to stat %s: %v", c.path, err), nil)
+	}
+	freePct := 100 - usage.UsedPercent
+	metrics := map[string]interface{}{
+		"path":         c.path,
+		"free_bytes":   usage.Free,
+		"free_percent": freePct,
+	}
+	var problems []string
+	status := StatusOK
+	if freePct < c.cfg.MinFreePercent {
+		status = StatusFailed
+		problems = append(problems, fmt.Sprintf("%.1f%% space free, below %.1f%%", freePct, c.cfg.MinFreePercent))
+	} else if freePct < c.cfg.WarnFreePercent {
+		status = StatusWarning
+		problems = append(problems, fmt.Sprintf("%.1f%% space free, below %.1f%%", freePct, c.cfg.WarnFreePercent))
+	}
+	// Some filesystems (and Windows) report no inodes at all.
+	if usage.InodesTotal > 0 {
+		inodesPct := 100 * float64(usage.InodesFree) / float64(usage.InodesTotal)
+		metrics["free_inodes"] = usage.InodesFree
+		metrics["free_inodes_percent"] = inodesPct
+		if inodesPct < c.cfg.MinFreeInodesPercent {
+			status = StatusFailed
+			problems = append(problems, fmt.Sprintf("%.1f%% inodes free, below %.1f%%", inodesPct, c.cfg.MinFreeInodesPercent))
+		} else if inodesPct < c.cfg.WarnFreeInodesPercent {
+			if status == StatusOK {
+				status = StatusWarning
+			}
+			problems = append(problems, fmt.Sprintf("%.1f%% inodes free, below %.1f%%", inodesPct, c.cfg.WarnFreeInodesPercent))
+		}
+	}
+	return c.result(status, strings.Join(problems, "; "), metrics)
+}
+
+// StoreCheck writes a random value to a store file, flushes it, and reads it
+// back through a freshly opened store.
+type StoreCheck struct {
+	baseCheck
+	path   string
+	logger *slog.Logger
+}
+
+// NewStoreCheck returns a round-trip check of a store kept at path.
+func NewStoreCheck(path string, logger *slog.Logger) *StoreCheck {
+	return &StoreCheck{baseCheck: baseCheck{name: CheckStore, component: "store"}, path: path, logger: logger}
+}
+
+func (c *StoreCheck) Check(ctx context.Context) CheckResult {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return c.result(StatusFailed, fmt.Sprintf("failed to generate probe value: %v", err), nil)
+	}
+	want := hex.EncodeToString(nonce)
+
+	s, err := store.New(c.path, c.logger)
+	if err != nil {
+		return c.result(StatusFailed, err.Error(), nil)
+	}
+	if err := s.SetAndSave("probe", want); err != nil {
+		return c.result(StatusFailed, fmt.Sprintf("write failed: %v", err), nil)
+	}
+	reopened, err := store.New(c.path, c.logger)
+	if err != nil {
+		return c.result(StatusFailed, err.Error(), nil)
+	}
+	var got string
+	if err := reopened.Get("probe", &got); err != nil {
+		return c.result(StatusFailed, fmt.Sprintf("read failed: %v", err), nil)
+	}
+	if got != want {
+		return c.result(StatusFailed, "read back a different value than was written", nil)
+	}
+	return c.result(StatusOK, "", nil)
+}
+
+// TopicCheck fails while any pubsub topic the agent depends on is not joined.
+type TopicCheck struct {
+	baseCheck
+	topics func() map[string]bool
+}
+
+// NewTopicCheck returns a check over the join status reported by topics,
+// such as P2P.GetTopicHealth.
+func NewTopicCheck(topics func() map[string]bool) *TopicCheck {
+	return &TopicCheck{baseCheck: baseCheck{name: CheckPubsubTopics, component: "p2p"}, topics: topics}
+}
+
+func (c *TopicCheck) Check(ctx context.Context) CheckResult {
+	var missing []string
+	metrics := map[string]interface{}{}
+	for topic, joined := range c.topics() {
+		metrics[topic] = joined
+		if !joined {
+			missing = append(missing, topic)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return c.result(StatusFailed, "not joined: "+strings.Join(missing, ", "), metrics)
+	}
+	return c.result(StatusOK, "", metrics)
+}
+
+// PeerCountCheck fails while fewer than the configured number of peers are
+// connected.
+type PeerCountCheck struct {
+	baseCheck
+	count func() int
+	min   int
+}
+
+// NewPeerCountCheck returns a check that count reports at least min peers.
+func NewPeerCountCheck(count func() int, min int) *PeerCountCheck {
+	return &PeerCountCheck{baseCheck: baseCheck{name: CheckPeers, component: "p2p"}, count: count, min: min}
+}
+
+func (c *PeerCountCheck) Check(ctx context.Context) CheckResult {
+	n := c.count()
+	metrics := map[string]interface{}{"peers": n, "min": c.min}
+	if n < c.min {
+		return c.result(StatusFailed, fmt.Sprintf("%d peers connected, need %d", n, c.min), metrics)
+	}
+	return c.result(StatusOK, "", metrics)
+}
+
+// ClockSkewCheck compares the local clock with the clocks of peers. The
+// median offset is used so that a single peer with a wrong clock does not
+// make this agent look skewed.
+type ClockSkewCheck struct {
+	baseCheck
+	skews func() map[string]time.Duration
+	max   time.Duration
+}
+
+// NewClockSkewCheck returns a check of the per-peer offsets reported by
+// skews, such as fleet.Aggregator.ClockSkews.
+func NewClockSkewCheck(skews func() map[string]time.Duration, max time.Duration) *ClockSkewCheck {
+	return &ClockSkewCheck{baseCheck: baseCheck{name: CheckClockSkew, component: "clock"}, skews: skews, max: max}
+}
+
+func (c *ClockSkewCheck) Check(ctx context.Context) CheckResult {
+	skews := c.skews()
+	if len(skews) == 0 {
+		return c.result(StatusOK, "no peers to compare with", map[string]interface{}{"peers": 0})
+	}
+	offsets := make([]time.Duration, 0, len(skews))
+	for _, d := range skews {
+		offsets = append(offsets, d)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	median := offsets[len(offsets)/2]
+	if len(offsets)%2 == 0 {
+		median = (offsets[len(offsets)/2-1] + median) / 2
+	}
+	metrics := map[string]interface{}{"peers": len(offsets), "median_skew_seconds": median.Seconds()}
+	if median > c.max || median < -c.max {
+		return c.result(StatusFailed, fmt.Sprintf("clock is %s off from the median peer, more than %s", median.Round(time.Millisecond), c.max), metrics)
+	}
+	return c.result(StatusOK, "", metrics)
+}
+
+// CertificateCheck warns as a PEM certificate nears expiry and fails once it
+// has expired or cannot be read.
+type CertificateCheck struct {
+	baseCheck
+	path       string
+	warnBefore time.Duration
+	now        func() time.Time
+}
+
+// NewCertificateCheck returns an expiry check of the first certificate in
+// the PEM file at path.
+func NewCertificateCheck(name, path string, warnBefore time.Duration) *CertificateCheck {
+	return &CertificateCheck{baseCheck: baseCheck{name: name, component: "tls"}, path: path, warnBefore: warnBefore, now: time.Now}
+}
+
+func (c *CertificateCheck) Check(ctx context.Context) CheckResult {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return c.result(StatusFailed, fmt.Sprintf("failed to read certificate: %v", err), nil)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return c.result(StatusFailed, "no PEM certificate in "+c.path, nil)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return c.result(StatusFailed, fmt.Sprintf("failed to parse certificate: %v", err), nil)
+	}
+	remaining := cert.NotAfter.Sub(c.now())
+	metrics := map[string]interface{}{"not_after": cert.NotAfter.UTC(), "expires_in_seconds": remaining.Seconds()}
+	switch {
+	case remaining <= 0:
+		return c.result(StatusFailed, "certificate expired at "+cert.NotAfter.UTC().Format(time.RFC3339), metrics)
+	case remaining < c.warnBefore:
+		return c.result(StatusWarning, "certificate expires at "+cert.NotAfter.UTC().Format(time.RFC3339), metrics)
+	}
+	return c.result(StatusOK, "", metrics)
+}
+
+// ControllerCheck fails while any started controller process has exited
+// without being stopped.
+type ControllerCheck struct {
+	baseCheck
+	exited func() []string
+}
+
+// NewControllerCheck returns a check over the controllers reported by
+// exited, such as controller/manager.Manager.ExitedControllers.
+func NewControllerCheck(exited func() []string) *ControllerCheck {
+	return &ControllerCheck{baseCheck: baseCheck{name: CheckControllers, component: "controller"}, exited: exited}
+}
+
+func (c *ControllerCheck) Check(ctx context.Context) CheckResult {
+	if exited := c.exited(); len(exited) > 0 {
+		return c.result(StatusFailed, "exited: "+strings.Join(exited, ", "), map[string]interface{}{"exited": len(exited)})
+	}
+	return c.result(StatusOK, "", nil)
+}
+
+// NewModuleRuntimeCheck returns a check that fails when ping, such as
+// module.Manager.CheckRuntime, reports the module runtime unavailable.
+func NewModuleRuntimeCheck(ping func(ctx context.Context) error) HealthCheck {
+	return NewCheckFunc(CheckModuleRuntime, "module", ping)
+}
@@ -0,0 +1,152 @@
+package health
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskCheck(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	result := NewDiskCheck(CheckDiskState, dir, DiskConfig{}).Check(ctx)
+	assert.Equal(t, StatusOK, result.Status, result.Message)
+	assert.Contains(t, result.Metrics, "free_percent")
+
+	// No filesystem has more than 100% free, so these thresholds always fail.
+	result = NewDiskCheck(CheckDiskState, dir, DiskConfig{MinFreePercent: 101, WarnFreePercent: 101}).Check(ctx)
+	assert.Equal(t, StatusFailed, result.Status)
+	result = NewDiskCheck(CheckDiskState, dir, DiskConfig{WarnFreePercent: 101}).Check(ctx)
+	assert.Equal(t, StatusWarning, result.Status)
+
+	result = NewDiskCheck(CheckDiskState, filepath.Join(dir, "missing"), DiskConfig{}).Check(ctx)
+	assert.Equal(t, StatusFailed, result.Status)
+}
+
+func TestStoreCheck(t *testing.T) {
+	dir := t.TempDir()
+	check := NewStoreCheck(filepath.Join(dir, "health.json"), slog.Default())
+	assert.Equal(t, StatusOK, check.Check(context.Background()).Status)
+	assert.Equal(t, StatusOK, check.Check(context.Background()).Status, "repeated runs write new values")
+
+	// A directory where the store file should be cannot be written.
+	blocked := filepath.Join(dir, "blocked")
+	require.NoError(t, os.MkdirAll(filepath.Join(blocked, "health.json.tmp"), 0o755))
+	result := NewStoreCheck(filepath.Join(blocked, "health.json"), slog.Default()).Check(context.Background())
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Contains(t, result.Message, "write failed")
+}
+
+func TestTopicCheck(t *testing.T) {
+	topics := map[string]bool{"heartbeat": true, "fleet": true}
+	check := NewTopicCheck(func() map[string]bool { return topics })
+	assert.Equal(t, StatusOK, check.Check(context.Background()).Status)
+
+	topics["leader"] = false
+	topics["controller"] = false
+	result := check.Check(context.Background())
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, "not joined: controller, leader", result.Message)
+}
+
+func TestPeerCountCheck(t *testing.T) {
+	peers := 0
+	check := NewPeerCountCheck(func() int { return peers }, 2)
+	assert.Equal(t, StatusFailed, check.Check(context.Background()).Status)
+	peers = 2
+	assert.Equal(t, StatusOK, check.Check(context.Background()).Status)
+}
+
+func TestClockSkewCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		skews map[string]time.Duration
+		want  Status
+	}{
+		{"no peers", nil, StatusOK},
+		{"one bad peer among good ones", map[string]time.Duration{"a": time.Second, "b": -time.Second, "c": time.Hour}, StatusOK},
+		{"local clock behind", map[string]time.Duration{"a": -time.Minute, "b": -50 * time.Second}, StatusFailed},
+		{"local clock ahead", map[string]time.Duration{"a": 2 * time.Minute, "b": time.Minute, "c": time.Hour}, StatusFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := NewClockSkewCheck(func() map[string]time.Duration { return tt.skews }, 30*time.Second)
+			assert.Equal(t, tt.want, check.Check(context.Background()).Status)
+		})
+	}
+}
+
+func writeCert(t *testing.T, notAfter time.Time) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "apa-admin"},
+		NotBefore:    notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "admin.crt")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644))
+	return path
+}
+
+func TestCertificateCheck(t *testing.T) {
+	ctx := context.Background()
+	month := 30 * 24 * time.Hour
+
+	result := NewCertificateCheck(CheckAdminTLSCert, writeCert(t, time.Now().Add(3*month)), month).Check(ctx)
+	assert.Equal(t, StatusOK, result.Status, result.Message)
+	result = NewCertificateCheck(CheckAdminTLSCert, writeCert(t, time.Now().Add(time.Hour)), month).Check(ctx)
+	assert.Equal(t, StatusWarning, result.Status)
+	result = NewCertificateCheck(CheckAdminTLSCert, writeCert(t, time.Now().Add(-time.Hour)), month).Check(ctx)
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Contains(t, result.Message, "expired")
+
+	result = NewCertificateCheck(CheckAdminTLSCert, filepath.Join(t.TempDir(), "missing.crt"), month).Check(ctx)
+	assert.Equal(t, StatusFailed, result.Status)
+}
+
+func TestControllerAndModuleRuntimeChecks(t *testing.T) {
+	ctx := context.Background()
+	var exited []string
+	controllers := NewControllerCheck(func() []string { return exited })
+	assert.Equal(t, StatusOK, controllers.Check(ctx).Status)
+	exited = []string{"ctl-a", "ctl-b"}
+	result := controllers.Check(ctx)
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, "exited: ctl-a, ctl-b", result.Message)
+
+	var pingErr error
+	runtime := NewModuleRuntimeCheck(func(context.Context) error { return pingErr })
+	assert.Equal(t, StatusOK, runtime.Check(ctx).Status)
+	pingErr = errors.New("wasm runtime unavailable")
+	result = runtime.Check(ctx)
+	assert.Equal(t, StatusFailed, result.Status)
+	assert.Equal(t, CheckModuleRuntime, result.Name)
+}
+
+func TestConfigEnabled(t *testing.T) {
+	cfg := Config{Disabled: []string{CheckPeers}}.WithDefaults()
+	assert.False(t, cfg.Enabled(CheckPeers))
+	assert.True(t, cfg.Enabled(CheckStore))
+	assert.Equal(t, 1, cfg.Peers.Min)
+	assert.Equal(t, 10.0, cfg.Disk.MinFreePercent)
+}
@@ -5,68 +5,343 @@ import (
 	"fmt"
 	"log/slog"
 	"runtime"
+	"sort"
+	"sync"
 	"time"
 )
 
 // HealthCheck defines an interface for any health check.
 type HealthCheck interface {
 	Name() string
-	Check(ctx context.Context) error
+	Check(ctx context.Context) CheckResult
+}
+
+// checkFunc adapts a function returning an error to a HealthCheck.
+type checkFunc struct {
+	name      string
+	component string
+	fn        func(ctx context.Context) error
+}
+
+// NewCheckFunc returns a check that passes when fn returns nil and fails
+// with its error otherwise.
+func NewCheckFunc(name, component string, fn func(ctx context.Context) error) HealthCheck {
+	return &checkFunc{name: name, component: component, fn: fn}
+}
+
+func (c *checkFunc) Name() string { return c.name }
+
+func (c *checkFunc) Check(ctx context.Context) CheckResult {
+	return ResultFromError(c.name, c.component, c.fn(ctx))
+}
+
+// ResultFromError returns an ok result for a nil error and a failed one
+// carrying its message otherwise.
+func ResultFromError(name, component string, err error) CheckResult {
+	if err != nil {
+		return CheckResult{Name: name, Component: component, Status: StatusFailed, Message: err.Error()}
+	}
+	return CheckResult{Name: name, Component: component, Status: StatusOK}
+}
+
+// registeredCheck is a check with its options and recent results, oldest
+// first.
+type registeredCheck struct {
+	check   HealthCheck
+	opts    CheckOptions
+	history []CheckResult
 }
 
 // HealthController manages and orchestrates health checks.
 type HealthController struct {
 	logger *slog.Logger
-	checks []HealthCheck
+	config Config
+	checks []*registeredCheck
+	mu     sync.RWMutex
+
+	// OnCheckFailed is called for every failed check run.
+	OnCheckFailed func(result CheckResult)
 }
 
 // NewHealthController creates a new HealthController.
 func NewHealthController(logger *slog.Logger) *HealthController {
 	return &HealthController{
 		logger: logger,
-		checks: []HealthCheck{},
+		config: Config{}.WithDefaults(),
+		checks: []*registeredCheck{},
 	}
 }
 
-// RegisterCheck adds a new health check to the controller.
+// Configure sets the default interval, timeout and history length and the
+// per-check overrides.
+func (hc *HealthController) Configure(cfg Config) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.config = cfg.WithDefaults()
+}
+
+// RegisterCheck adds a new critical health check to the controller.
 func (hc *HealthController) RegisterCheck(check HealthCheck) {
-	hc.checks = append(hc.checks, check)
+	hc.RegisterCheckWithOptions(check, CheckOptions{Critical: true})
 }
 
-// StartHealthChecks begins periodic execution of all registered health checks.
-func (hc *HealthController) StartHealthChecks(ctx context.Context, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+// RegisterCheckWithOptions adds a health check with its own schedule and
+// criticality. Checks must be registered before StartHealthChecks.
+func (hc *HealthController) RegisterCheckWithOptions(check HealthCheck, opts CheckOptions) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	hc.checks = append(hc.checks, &registeredCheck{check: check, opts: opts})
+}
+
+// options returns a check's options with the configured overrides and
+// defaults applied; interval, when set, replaces the configured default.
+func (hc *HealthController) options(rc *registeredCheck, interval time.Duration) CheckOptions {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	opts := hc.optionsLocked(rc)
+	if opts.Interval <= 0 {
+		opts.Interval = hc.config.Interval
+		if interval > 0 {
+			opts.Interval = interval
+		}
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = hc.config.Timeout
+	}
+	return opts
+}
 
+// optionsLocked applies the configured overrides to a check's options. The
+// caller holds hc.mu.
+func (hc *HealthController) optionsLocked(rc *registeredCheck) CheckOptions {
+	opts := rc.opts
+	if override, ok := hc.config.Checks[rc.check.Name()]; ok {
+		if override.Interval > 0 {
+			opts.Interval = override.Interval
+		}
+		if override.Timeout > 0 {
+			opts.Timeout = override.Timeout
+		}
+		if override.Critical != nil {
+			opts.Critical = *override.Critical
+		}
+	}
+	return opts
+}
+
+// StartHealthChecks runs every registered check right away and then on its
+// interval until ctx is done. interval is the default for checks without
+// their own; zero uses the configured default.
+func (hc *HealthController) StartHealthChecks(ctx context.Context, interval time.Duration) {
 	if hc.logger != nil {
 		hc.logger.Info("Health checks started", "interval", interval)
 	}
 
+	hc.mu.RLock()
+	checks := append([]*registeredCheck(nil), hc.checks...)
+	hc.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, rc := range checks {
+		wg.Add(1)
+		go func(rc *registeredCheck) {
+			defer wg.Done()
+			hc.schedule(ctx, rc, interval)
+		}(rc)
+	}
+	<-ctx.Done()
+	wg.Wait()
+	if hc.logger != nil {
+		hc.logger.Info("Health checks stopped.")
+	}
+}
+
+func (hc *HealthController) schedule(ctx context.Context, rc *registeredCheck, interval time.Duration) {
+	if ctx.Err() != nil {
+		return
+	}
+	hc.run(ctx, rc, interval)
+
+	ticker := time.NewTicker(hc.options(rc, interval).Interval)
+	defer ticker.Stop()
 	for {
 		select {
 		case <-ctx.Done():
-			if hc.logger != nil {
-				hc.logger.Info("Health checks stopped.")
-			}
 			return
 		case <-ticker.C:
-			hc.runChecks(ctx)
+			hc.run(ctx, rc, interval)
+		}
+	}
+}
+
+// RunChecks runs every registered check once and returns the resulting
+// report.
+func (hc *HealthController) RunChecks(ctx context.Context) Report {
+	hc.mu.RLock()
+	checks := append([]*registeredCheck(nil), hc.checks...)
+	hc.mu.RUnlock()
+	for _, rc := range checks {
+		hc.run(ctx, rc, 0)
+	}
+	return hc.Report()
+}
+
+// run runs one check within its timeout and records the result. A check
+// that does not return in time is recorded as failed; its result is
+// discarded when it does.
+func (hc *HealthController) run(ctx context.Context, rc *registeredCheck, interval time.Duration) {
+	opts := hc.options(rc, interval)
+	checkCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan CheckResult, 1)
+	go func() { done <- rc.check.Check(checkCtx) }()
+	var result CheckResult
+	select {
+	case result = <-done:
+	case <-checkCtx.Done():
+		if ctx.Err() != nil {
+			return
 		}
+		result = CheckResult{Status: StatusFailed, Message: fmt.Sprintf("check timed out after %s", opts.Timeout)}
+	}
+
+	result.Name = rc.check.Name()
+	if result.Status == "" {
+		result.Status = StatusUnknown
+	}
+	result.Critical = opts.Critical
+	result.Timestamp = start
+	result.Duration = time.Since(start)
+
+	hc.mu.Lock()
+	rc.history = append(rc.history, result)
+	if over := len(rc.history) - hc.config.History; over > 0 {
+		rc.history = append([]CheckResult(nil), rc.history[over:]...)
+	}
+	hc.mu.Unlock()
+
+	if result.Failed() {
+		if hc.logger != nil {
+			hc.logger.Error("Health check failed", "check", result.Name, "component", result.Component, "critical", result.Critical, "message", result.Message)
+		}
+		if hc.OnCheckFailed != nil {
+			hc.OnCheckFailed(result)
+		}
+	} else if hc.logger != nil {
+		hc.logger.Debug("Health check completed", "check", result.Name, "status", result.Status)
 	}
 }
 
-func (hc *HealthController) runChecks(ctx context.Context) {
-	for _, check := range hc.checks {
-		if err := check.Check(ctx); err != nil {
-			if hc.logger != nil {
-				hc.logger.Error("Health check failed", "check", check.Name(), "error", err)
+// latest returns a check's most recent result, or an unknown one before its
+// first run. The caller holds hc.mu.
+func (hc *HealthController) latest(rc *registeredCheck) CheckResult {
+	if n := len(rc.history); n > 0 {
+		return rc.history[n-1]
+	}
+	return CheckResult{Name: rc.check.Name(), Status: StatusUnknown, Critical: hc.optionsLocked(rc).Critical, Message: "not run yet"}
+}
+
+// Report aggregates the latest result of every check. The agent is
+// failed when a critical check failed, degraded when a non-critical check
+// failed or any check warns, and unknown while a critical check has not run.
+// It is ready when every critical check has run and not failed, and live
+// when no liveness check failed.
+func (hc *HealthController) Report() Report {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	report := Report{Live: true, Ready: true, Timestamp: time.Now(), Checks: []CheckResult{}}
+	var failed, degraded, unknown bool
+	for _, rc := range hc.checks {
+		result := hc.latest(rc)
+		report.Checks = append(report.Checks, result)
+		switch result.Status {
+		case StatusFailed:
+			if result.Critical {
+				failed = true
+				report.Ready = false
+			} else {
+				degraded = true
+			}
+			if rc.opts.Liveness {
+				report.Live = false
 			}
-		} else {
-			if hc.logger != nil {
-				hc.logger.Debug("Health check passed", "check", check.Name())
+		case StatusUnknown:
+			if result.Critical {
+				unknown = true
+				report.Ready = false
 			}
+		case StatusWarning, StatusDegraded:
+			degraded = true
 		}
 	}
+	switch {
+	case failed:
+		report.Status = StatusFailed
+	case degraded:
+		report.Status = StatusDegraded
+	case unknown:
+		report.Status = StatusUnknown
+	default:
+		report.Status = StatusOK
+	}
+	return report
+}
+
+// Liveness returns the latest results of the liveness checks.
+func (hc *HealthController) Liveness() []CheckResult {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	var results []CheckResult
+	for _, rc := range hc.checks {
+		if rc.opts.Liveness {
+			results = append(results, hc.latest(rc))
+		}
+	}
+	return results
+}
+
+// History returns the recent results of a check, oldest first.
+func (hc *HealthController) History(name string) []CheckResult {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	for _, rc := range hc.checks {
+		if rc.check.Name() == name {
+			return append([]CheckResult{}, rc.history...)
+		}
+	}
+	return nil
+}
+
+// CheckHealth returns the latest result of every check that has run, so the
+// controller can feed selfhealing.HealingFramework.
+func (hc *HealthController) CheckHealth(ctx context.Context) ([]*CheckResult, error) {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	var results []*CheckResult
+	for _, rc := range hc.checks {
+		if n := len(rc.history); n > 0 {
+			result := rc.history[n-1]
+			results = append(results, &result)
+		}
+	}
+	return results, nil
+}
+
+// FailingChecks returns the sorted names of checks whose most recent run failed.
+func (hc *HealthController) FailingChecks() []string {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+	var names []string
+	for _, rc := range hc.checks {
+		if n := len(rc.history); n > 0 && rc.history[n-1].Failed() {
+			names = append(names, rc.check.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // ProcessLivenessCheck is a basic health check for process liveness.
@@ -75,24 +350,25 @@ type ProcessLivenessCheck struct {
 }
 
 func NewProcessLivenessCheck() *ProcessLivenessCheck {
-	return &ProcessLivenessCheck{name: "process-liveness"}
+	return &ProcessLivenessCheck{name: CheckProcessLiveness}
 }
 
 func (plc *ProcessLivenessCheck) Name() string {
 	return plc.name
 }
 
-func (plc *ProcessLivenessCheck) Check(ctx context.Context) error {
+func (plc *ProcessLivenessCheck) Check(ctx context.Context) CheckResult {
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return ResultFromError(plc.name, "process", ctx.Err())
 	default:
 	}
 
 	procs := runtime.NumGoroutine()
+	result := ResultFromError(plc.name, "process", nil)
 	if procs > 10000 {
-		return fmt.Errorf("too many goroutines: %d", procs)
+		result = ResultFromError(plc.name, "process", fmt.Errorf("too many goroutines: %d", procs))
 	}
-
-	return nil
+	result.Metrics = map[string]interface{}{"goroutines": procs}
+	return result
 }
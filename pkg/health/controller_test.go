@@ -18,11 +18,11 @@ type mockCheck struct {
 }
 
 func (m *mockCheck) Name() string { return m.name }
-func (m *mockCheck) Check(ctx context.Context) error {
+func (m *mockCheck) Check(ctx context.Context) CheckResult {
 	if m.checkFn != nil {
-		return m.checkFn(ctx)
+		return ResultFromError(m.name, "test", m.checkFn(ctx))
 	}
-	return nil
+	return ResultFromError(m.name, "test", nil)
 }
 
 func TestNewHealthController(t *testing.T) {
@@ -46,7 +46,7 @@ func TestRegisterCheck(t *testing.T) {
 		hc := NewHealthController(nil)
 		hc.RegisterCheck(&mockCheck{name: "check-1"})
 		assert.Len(t, hc.checks, 1)
-		assert.Equal(t, "check-1", hc.checks[0].Name())
+		assert.Equal(t, "check-1", hc.checks[0].check.Name())
 	})
 
 	t.Run("multiple checks", func(t *testing.T) {
@@ -144,16 +144,18 @@ func TestProcessLivenessCheck(t *testing.T) {
 
 	t.Run("check passes under normal conditions", func(t *testing.T) {
 		plc := NewProcessLivenessCheck()
-		err := plc.Check(context.Background())
-		assert.NoError(t, err)
+		result := plc.Check(context.Background())
+		assert.Equal(t, StatusOK, result.Status)
+		assert.Contains(t, result.Metrics, "goroutines")
 	})
 
-	t.Run("check returns error on cancelled context", func(t *testing.T) {
+	t.Run("check fails on cancelled context", func(t *testing.T) {
 		plc := NewProcessLivenessCheck()
 		ctx, cancel := context.WithCancel(context.Background())
 		cancel()
-		err := plc.Check(ctx)
-		assert.ErrorIs(t, err, context.Canceled)
+		result := plc.Check(ctx)
+		assert.Equal(t, StatusFailed, result.Status)
+		assert.Equal(t, context.Canceled.Error(), result.Message)
 	})
 
 	t.Run("check fails with too many goroutines", func(t *testing.T) {
@@ -0,0 +1,49 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// WriteProbe writes a Kubernetes-style probe response for the checks that
+// make up the probe: 200 when it passes and 503 otherwise. With verbose,
+// each check is listed as "[+]name ok" or "[-]name failed: message" before
+// the summary line.
+func WriteProbe(w http.ResponseWriter, probe string, passed bool, checks []CheckResult, verbose bool) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	status := http.StatusOK
+	if !passed {
+		status = http.StatusServiceUnavailable
+	}
+	if !verbose {
+		w.WriteHeader(status)
+		if passed {
+			_, _ = fmt.Fprintln(w, "ok")
+		} else {
+			_, _ = fmt.Fprintf(w, "%s check failed\n", probe)
+		}
+		return
+	}
+
+	var b strings.Builder
+	for _, c := range checks {
+		mark := "+"
+		if c.Failed() || (c.Status == StatusUnknown && c.Critical) {
+			mark = "-"
+		}
+		fmt.Fprintf(&b, "[%s]%s %s", mark, c.Name, c.Status)
+		if c.Message != "" && c.Status != StatusOK {
+			fmt.Fprintf(&b, ": %s", c.Message)
+		}
+		b.WriteString("\n")
+	}
+	if passed {
+		fmt.Fprintf(&b, "%s check passed\n", probe)
+	} else {
+		fmt.Fprintf(&b, "%s check failed\n", probe)
+	}
+	w.WriteHeader(status)
+	_, _ = fmt.Fprint(w, b.String())
+}
@@ -0,0 +1,146 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func failing(name string) HealthCheck {
+	return NewCheckFunc(name, "test", func(ctx context.Context) error { return errors.New(name + " broken") })
+}
+
+func passing(name string) HealthCheck {
+	return NewCheckFunc(name, "test", func(ctx context.Context) error { return nil })
+}
+
+func TestReportAggregation(t *testing.T) {
+	tests := []struct {
+		name      string
+		register  func(hc *HealthController)
+		status    Status
+		ready     bool
+		live      bool
+		skipFirst bool
+	}{
+		{
+			name:     "all passing",
+			register: func(hc *HealthController) { hc.RegisterCheck(passing("a")) },
+			status:   StatusOK, ready: true, live: true,
+		},
+		{
+			name: "non-critical failure degrades",
+			register: func(hc *HealthController) {
+				hc.RegisterCheck(passing("a"))
+				hc.RegisterCheckWithOptions(failing("b"), CheckOptions{})
+			},
+			status: StatusDegraded, ready: true, live: true,
+		},
+		{
+			name:     "critical failure fails",
+			register: func(hc *HealthController) { hc.RegisterCheck(failing("a")) },
+			status:   StatusFailed, ready: false, live: true,
+		},
+		{
+			name:     "failed liveness check",
+			register: func(hc *HealthController) { hc.RegisterCheckWithOptions(failing("a"), CheckOptions{Liveness: true}) },
+			status:   StatusDegraded, ready: true, live: false,
+		},
+		{
+			name:     "critical check not run yet",
+			register: func(hc *HealthController) { hc.RegisterCheck(passing("a")) },
+			status:   StatusUnknown, ready: false, live: true,
+			skipFirst: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := NewHealthController(nil)
+			tt.register(hc)
+			var report Report
+			if tt.skipFirst {
+				report = hc.Report()
+			} else {
+				report = hc.RunChecks(context.Background())
+			}
+			assert.Equal(t, tt.status, report.Status)
+			assert.Equal(t, tt.ready, report.Ready)
+			assert.Equal(t, tt.live, report.Live)
+		})
+	}
+}
+
+func TestRunChecks_TimeoutAndHistory(t *testing.T) {
+	hc := NewHealthController(nil)
+	hc.Configure(Config{Timeout: 20 * time.Millisecond, History: 2})
+	hc.RegisterCheck(NewCheckFunc("slow", "test", func(ctx context.Context) error {
+		<-time.After(time.Second)
+		return nil
+	}))
+	var failures []CheckResult
+	hc.OnCheckFailed = func(r CheckResult) { failures = append(failures, r) }
+
+	for range 3 {
+		hc.RunChecks(context.Background())
+	}
+	history := hc.History("slow")
+	require.Len(t, history, 2)
+	assert.Equal(t, StatusFailed, history[1].Status)
+	assert.Contains(t, history[1].Message, "timed out")
+	assert.True(t, history[1].Critical)
+	assert.Len(t, failures, 3)
+	assert.Equal(t, []string{"slow"}, hc.FailingChecks())
+	assert.Nil(t, hc.History("missing"))
+}
+
+func TestConfigureOverrides(t *testing.T) {
+	notCritical := false
+	hc := NewHealthController(nil)
+	hc.Configure(Config{Checks: map[string]CheckConfig{"a": {Critical: &notCritical, Interval: time.Minute}}})
+	hc.RegisterCheck(failing("a"))
+
+	report := hc.RunChecks(context.Background())
+	assert.Equal(t, StatusDegraded, report.Status)
+	assert.True(t, report.Ready)
+	assert.Equal(t, time.Minute, hc.options(hc.checks[0], 0).Interval)
+	assert.Equal(t, 5*time.Second, hc.options(hc.checks[0], 0).Timeout, "default timeout")
+}
+
+func TestCheckHealth(t *testing.T) {
+	hc := NewHealthController(nil)
+	hc.RegisterCheck(failing("a"))
+	hc.RegisterCheck(passing("b"))
+
+	results, err := hc.CheckHealth(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, results, "no results before the first run")
+
+	hc.RunChecks(context.Background())
+	results, err = hc.CheckHealth(context.Background())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, StatusFailed, results[0].Status)
+}
+
+func TestWriteProbe(t *testing.T) {
+	checks := []CheckResult{
+		{Name: "a", Status: StatusOK},
+		{Name: "b", Status: StatusFailed, Message: "disk full", Critical: true},
+	}
+
+	rec := httptest.NewRecorder()
+	WriteProbe(rec, "readyz", false, checks, true)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "[+]a ok\n[-]b failed: disk full\nreadyz check failed\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	WriteProbe(rec, "livez", true, nil, false)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok\n", rec.Body.String())
+}
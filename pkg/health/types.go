@@ -1,5 +1,7 @@
 package health
 
+import "time"
+
 // Status represents the outcome of a health check.
 type Status string
 
@@ -8,6 +10,8 @@ const (
 	StatusWarning  Status = "warning"
 	StatusFailed   Status = "failed"
 	StatusDegraded Status = "degraded"
+	// StatusUnknown is reported for checks that have not run yet.
+	StatusUnknown Status = "unknown"
 )
 
 // CheckResult captures the outcome of a health check.
@@ -17,4 +21,126 @@ type CheckResult struct {
 	Status    Status                 `json:"status"`
 	Message   string                 `json:"message"`
 	Metrics   map[string]interface{} `json:"metrics,omitempty"`
+	// Set by the controller for every run.
+	Critical  bool          `json:"critical"`
+	Timestamp time.Time     `json:"timestamp"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// Failed reports whether the result counts as a failure.
+func (r CheckResult) Failed() bool {
+	return r.Status == StatusFailed
+}
+
+// Report is the aggregated health of every registered check.
+type Report struct {
+	Status    Status        `json:"status"`
+	Live      bool          `json:"live"`
+	Ready     bool          `json:"ready"`
+	Checks    []CheckResult `json:"checks"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// CheckOptions controls how one check is scheduled and aggregated.
+type CheckOptions struct {
+	Interval time.Duration // defaults to the controller interval
+	Timeout  time.Duration // defaults to the controller timeout
+	// Critical checks must pass for the agent to be ready, and fail the
+	// overall status. Non-critical failures only degrade it.
+	Critical bool
+	// Liveness checks must not fail for the agent to be live.
+	Liveness bool
+}
+
+// Config holds the health check settings from the agent configuration.
+type Config struct {
+	Interval time.Duration          `yaml:"interval"` // defaults to 10s
+	Timeout  time.Duration          `yaml:"timeout"`  // defaults to 5s
+	History  int                    `yaml:"history"`  // results kept per check, defaults to 20
+	Checks   map[string]CheckConfig `yaml:"checks"`   // per-check overrides by name
+
+	// Thresholds of the built-in checks, and the names of those to leave out.
+	Disk        DiskConfig        `yaml:"disk"`
+	Peers       PeersConfig       `yaml:"peers"`
+	ClockSkew   ClockSkewConfig   `yaml:"clock_skew"`
+	Certificate CertificateConfig `yaml:"certificate"`
+	Disabled    []string          `yaml:"disabled"`
+}
+
+// DiskConfig sets the free space and free inode thresholds, in percent, of
+// the disk checks. Below the warn thresholds the check warns; below the min
+// thresholds it fails.
+type DiskConfig struct {
+	WarnFreePercent       float64 `yaml:"warn_free_percent"`        // defaults to 20
+	MinFreePercent        float64 `yaml:"min_free_percent"`         // defaults to 10
+	WarnFreeInodesPercent float64 `yaml:"warn_free_inodes_percent"` // defaults to 10
+	MinFreeInodesPercent  float64 `yaml:"min_free_inodes_percent"`  // defaults to 5
+}
+
+// PeersConfig sets the minimum number of connected peers.
+type PeersConfig struct {
+	Min int `yaml:"min"` // defaults to 1
+}
+
+// ClockSkewConfig sets the largest tolerated median clock offset to peers.
+type ClockSkewConfig struct {
+	Max time.Duration `yaml:"max"` // defaults to 30s
+}
+
+// CertificateConfig sets how long before expiry the certificate check warns.
+type CertificateConfig struct {
+	WarnBefore time.Duration `yaml:"warn_before"` // defaults to 720h
+}
+
+// CheckConfig overrides the options of one check. Unset fields keep the
+// options the check was registered with.
+type CheckConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Timeout  time.Duration `yaml:"timeout"`
+	Critical *bool         `yaml:"critical"`
+}
+
+// WithDefaults fills unset fields.
+func (c Config) WithDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = 10 * time.Second
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+	if c.History <= 0 {
+		c.History = 20
+	}
+	if c.Disk.WarnFreePercent <= 0 {
+		c.Disk.WarnFreePercent = 20
+	}
+	if c.Disk.MinFreePercent <= 0 {
+		c.Disk.MinFreePercent = 10
+	}
+	if c.Disk.WarnFreeInodesPercent <= 0 {
+		c.Disk.WarnFreeInodesPercent = 10
+	}
+	if c.Disk.MinFreeInodesPercent <= 0 {
+		c.Disk.MinFreeInodesPercent = 5
+	}
+	if c.Peers.Min <= 0 {
+		c.Peers.Min = 1
+	}
+	if c.ClockSkew.Max <= 0 {
+		c.ClockSkew.Max = 30 * time.Second
+	}
+	if c.Certificate.WarnBefore <= 0 {
+		c.Certificate.WarnBefore = 30 * 24 * time.Hour
+	}
+	return c
+}
+
+// Enabled reports whether the built-in check name has not been disabled.
+func (c Config) Enabled(name string) bool {
+	for _, d := range c.Disabled {
+		if d == name {
+			return false
+		}
+	}
+	return true
 }
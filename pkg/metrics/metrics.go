@@ -0,0 +1,292 @@
+// Package metrics holds the agent's shared Prometheus registry and the
+// collectors that subsystems record into.
+//
+// All recording methods are safe to call on a nil *Metrics so subsystems can
+// be used without instrumentation (for example in unit tests).
+package metrics
+
+import (
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric exported by the agent.
+const Namespace = "apa"
+
+// Circuit breaker state values reported by apa_circuit_breaker_state.
+const (
+	CircuitClosed   = 0
+	CircuitHalfOpen = 1
+	CircuitOpen     = 2
+)
+
+// Metrics owns the agent registry and every collector registered in it.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	peers               prometheus.Gauge
+	pubsubMessages      *prometheus.CounterVec
+	moduleRuns          *prometheus.CounterVec
+	moduleFailures      *prometheus.CounterVec
+	moduleRunDuration   *prometheus.HistogramVec
+	controllerStarts    *prometheus.CounterVec
+	controllerRestarts  *prometheus.CounterVec
+	updateChecks        *prometheus.CounterVec
+	updateDownloadBytes *prometheus.CounterVec
+	transferBytes       *prometheus.CounterVec
+	transferChunks      *prometheus.CounterVec
+	policyDecisions     *prometheus.CounterVec
+	storeLatency        *prometheus.HistogramVec
+	circuitBreakerState *prometheus.GaugeVec
+	auditEntries        prometheus.Counter
+}
+
+// New creates a registry with the agent collectors plus the standard Go and
+// process collectors. startTime anchors apa_uptime_seconds.
+func New(startTime time.Time) *Metrics {
+	reg := prometheus.NewRegistry()
+	m := &Metrics{
+		registry: reg,
+		peers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: Namespace, Name: "peers",
+			Help: "Number of connected libp2p peers.",
+		}),
+		pubsubMessages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "pubsub_messages_total",
+			Help: "Pubsub messages by topic and direction (sent, received, dropped, publish_error).",
+		}, []string{"topic", "direction"}),
+		moduleRuns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "module_runs_total",
+			Help: "WASM module run attempts by module.",
+		}, []string{"module"}),
+		moduleFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "module_failures_total",
+			Help: "WASM module runs that returned an error, by module.",
+		}, []string{"module"}),
+		moduleRunDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Name: "module_run_duration_seconds",
+			Help:    "Time spent starting a WASM module, by module.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"module"}),
+		controllerStarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "controller_starts_total",
+			Help: "Controller start attempts by controller and result.",
+		}, []string{"controller", "result"}),
+		controllerRestarts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "controller_restarts_total",
+			Help: "Controller starts after the first one, by controller.",
+		}, []string{"controller"}),
+		updateChecks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "update_checks_total",
+			Help: "Update checks by result (up_to_date, updated, deferred, skipped, confirmed, rolled_back, error).",
+		}, []string{"result"}),
+		updateDownloadBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "update_download_bytes_total",
+			Help: "Bytes transferred for updates, by kind (full, delta, chunked).",
+		}, []string{"kind"}),
+		transferBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "transfer_bytes_total",
+			Help: "Chunked transfer bytes by direction (received, served).",
+		}, []string{"direction"}),
+		transferChunks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "transfer_chunks_total",
+			Help: "Chunk fetch attempts by result (ok, corrupt, error).",
+		}, []string{"result"}),
+		policyDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "policy_decisions_total",
+			Help: "Policy decisions by engine, action and decision (allow, deny, error).",
+		}, []string{"engine", "action", "decision"}),
+		storeLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: Namespace, Name: "store_operation_duration_seconds",
+			Help:    "Latency of local store operations, by operation.",
+			Buckets: []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"operation"}),
+		circuitBreakerState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: Namespace, Name: "circuit_breaker_state",
+			Help: "Circuit breaker state by breaker (0=closed, 1=half_open, 2=open).",
+		}, []string{"breaker"}),
+		auditEntries: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace, Name: "audit_entries_total",
+			Help: "Admin audit log entries written.",
+		}),
+	}
+
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace, Name: "uptime_seconds",
+			Help: "Agent uptime in seconds.",
+		}, func() float64 { return time.Since(startTime).Seconds() }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: Namespace, Name: "goroutines",
+			Help: "Number of goroutines.",
+		}, func() float64 { return float64(runtime.NumGoroutine()) }),
+		m.peers,
+		m.pubsubMessages,
+		m.moduleRuns,
+		m.moduleFailures,
+		m.moduleRunDuration,
+		m.controllerStarts,
+		m.controllerRestarts,
+		m.updateChecks,
+		m.updateDownloadBytes,
+		m.transferBytes,
+		m.transferChunks,
+		m.policyDecisions,
+		m.storeLatency,
+		m.circuitBreakerState,
+		m.auditEntries,
+	)
+	return m
+}
+
+// Registry exposes the underlying registry so callers can register
+// additional collectors.
+func (m *Metrics) Registry() *prometheus.Registry {
+	if m == nil {
+		return nil
+	}
+	return m.registry
+}
+
+// Handler returns an HTTP handler serving the registry in the Prometheus
+// exposition format.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return promhttp.HandlerFor(prometheus.NewRegistry(), promhttp.HandlerOpts{})
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// SetPeers records the current number of connected peers.
+func (m *Metrics) SetPeers(n int) {
+	if m == nil {
+		return
+	}
+	m.peers.Set(float64(n))
+}
+
+// PubsubMessage counts a pubsub message for topic in the given direction.
+func (m *Metrics) PubsubMessage(topic, direction string) {
+	if m == nil {
+		return
+	}
+	m.pubsubMessages.WithLabelValues(topic, direction).Inc()
+}
+
+// ObserveModuleRun records a module run attempt, its duration and whether it failed.
+func (m *Metrics) ObserveModuleRun(module string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.moduleRuns.WithLabelValues(module).Inc()
+	m.moduleRunDuration.WithLabelValues(module).Observe(d.Seconds())
+	if err != nil {
+		m.moduleFailures.WithLabelValues(module).Inc()
+	}
+}
+
+// ObserveControllerStart records a controller start attempt. restart marks
+// starts of a controller that had already been started before.
+func (m *Metrics) ObserveControllerStart(controller string, restart bool, err error) {
+	if m == nil {
+		return
+	}
+	m.controllerStarts.WithLabelValues(controller, resultLabel(err)).Inc()
+	if restart {
+		m.controllerRestarts.WithLabelValues(controller).Inc()
+	}
+}
+
+// UpdateCheck counts an update check with the given result.
+func (m *Metrics) UpdateCheck(result string) {
+	if m == nil {
+		return
+	}
+	m.updateChecks.WithLabelValues(result).Inc()
+}
+
+// UpdateDownload counts n bytes transferred for an update of the given kind.
+func (m *Metrics) UpdateDownload(kind string, n int) {
+	if m == nil {
+		return
+	}
+	m.updateDownloadBytes.WithLabelValues(kind).Add(float64(n))
+}
+
+// TransferBytes counts n chunked transfer bytes in the given direction.
+func (m *Metrics) TransferBytes(direction string, n int) {
+	if m == nil {
+		return
+	}
+	m.transferBytes.WithLabelValues(direction).Add(float64(n))
+}
+
+// TransferChunk counts a chunk fetch attempt by result.
+func (m *Metrics) TransferChunk(result string) {
+	if m == nil {
+		return
+	}
+	m.transferChunks.WithLabelValues(result).Inc()
+}
+
+// PolicyDecision counts a policy evaluation made by engine for action.
+func (m *Metrics) PolicyDecision(engine, action string, allowed bool, err error) {
+	if m == nil {
+		return
+	}
+	decision := "deny"
+	switch {
+	case err != nil:
+		decision = "error"
+	case allowed:
+		decision = "allow"
+	}
+	m.policyDecisions.WithLabelValues(engine, action, decision).Inc()
+}
+
+// ObserveStoreOp records the latency of a store operation.
+func (m *Metrics) ObserveStoreOp(op string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.storeLatency.WithLabelValues(op).Observe(d.Seconds())
+}
+
+// SetCircuitBreakerState records the state of the named breaker. state is
+// matched case-insensitively against "closed", "half_open" and "open".
+func (m *Metrics) SetCircuitBreakerState(breaker, state string) {
+	if m == nil {
+		return
+	}
+	v := float64(CircuitClosed)
+	switch strings.ToLower(state) {
+	case "half_open":
+		v = CircuitHalfOpen
+	case "open":
+		v = CircuitOpen
+	}
+	m.circuitBreakerState.WithLabelValues(breaker).Set(v)
+}
+
+// AuditEntry counts a written admin audit entry.
+func (m *Metrics) AuditEntry() {
+	if m == nil {
+		return
+	}
+	m.auditEntries.Inc()
+}
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilMetricsIsNoop(t *testing.T) {
+	var m *Metrics
+	require.NotPanics(t, func() {
+		m.SetPeers(3)
+		m.PubsubMessage("topic", "sent")
+		m.ObserveModuleRun("mod", time.Millisecond, errors.New("boom"))
+		m.ObserveControllerStart("ctrl", true, nil)
+		m.UpdateCheck("error")
+		m.PolicyDecision("policy", "run_module", true, nil)
+		m.ObserveStoreOp("get", time.Millisecond)
+		m.SetCircuitBreakerState("default", "open")
+		m.AuditEntry()
+	})
+	require.Nil(t, m.Registry())
+}
+
+func TestRecordersUpdateCollectors(t *testing.T) {
+	m := New(time.Now())
+
+	m.SetPeers(4)
+	require.Equal(t, 4.0, testutil.ToFloat64(m.peers))
+
+	m.PubsubMessage("apa/heartbeat/1.0.0", "sent")
+	m.PubsubMessage("apa/heartbeat/1.0.0", "sent")
+	require.Equal(t, 2.0, testutil.ToFloat64(m.pubsubMessages.WithLabelValues("apa/heartbeat/1.0.0", "sent")))
+
+	m.ObserveModuleRun("echo", time.Millisecond, nil)
+	m.ObserveModuleRun("echo", time.Millisecond, errors.New("trap"))
+	require.Equal(t, 2.0, testutil.ToFloat64(m.moduleRuns.WithLabelValues("echo")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.moduleFailures.WithLabelValues("echo")))
+
+	m.ObserveControllerStart("router", false, nil)
+	m.ObserveControllerStart("router", true, errors.New("exit 1"))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.controllerStarts.WithLabelValues("router", "ok")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.controllerStarts.WithLabelValues("router", "error")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.controllerRestarts.WithLabelValues("router")))
+
+	m.PolicyDecision("policy", "run_module", false, nil)
+	m.PolicyDecision("policy", "run_module", false, errors.New("eval"))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.policyDecisions.WithLabelValues("policy", "run_module", "deny")))
+	require.Equal(t, 1.0, testutil.ToFloat64(m.policyDecisions.WithLabelValues("policy", "run_module", "error")))
+
+	m.SetCircuitBreakerState("default", "half_open")
+	require.Equal(t, float64(CircuitHalfOpen), testutil.ToFloat64(m.circuitBreakerState.WithLabelValues("default")))
+	m.SetCircuitBreakerState("default", "open")
+	require.Equal(t, float64(CircuitOpen), testutil.ToFloat64(m.circuitBreakerState.WithLabelValues("default")))
+}
+
+func TestHandlerExposesLiveValues(t *testing.T) {
+	m := New(time.Now().Add(-time.Minute))
+	m.AuditEntry()
+	m.UpdateCheck("up_to_date")
+
+	ts := httptest.NewServer(m.Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	out := string(body)
+	require.Contains(t, out, "apa_audit_entries_total 1")
+	require.Contains(t, out, `apa_update_checks_total{result="up_to_date"} 1`)
+	require.Contains(t, out, "apa_goroutines")
+	require.NotContains(t, out, "apa_uptime_seconds 0\n")
+	require.True(t, strings.Contains(out, "go_goroutines"), "standard Go collector should be registered")
+}
@@ -15,7 +15,12 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/naviNBRuas/APA/pkg/faults"
+	"github.com/naviNBRuas/APA/pkg/metrics"
 	"github.com/naviNBRuas/APA/pkg/policy"
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
 // Manager handles the lifecycle of WASM modules.
@@ -24,9 +29,11 @@ type Manager struct {
 	logger         *slog.Logger
 	wasmRuntime    *WasmRuntime
 	modules        map[string]Module // Maps module name to Module instance
+	running        map[string]Module // modules whose entry point is executing
 	moduleDir      string
 	signingPrivKey ed25519.PrivateKey
 	policyEnforcer policy.PolicyEnforcer
+	metrics        *metrics.Metrics
 	OnModuleLoad   func(manifest Manifest)
 }
 
@@ -41,12 +48,20 @@ func NewManager(ctx context.Context, logger *slog.Logger, moduleDir string, sign
 		logger:         logger,
 		wasmRuntime:    wasmRuntime,
 		modules:        make(map[string]Module),
+		running:        make(map[string]Module),
 		moduleDir:      moduleDir,
 		signingPrivKey: signingPrivKey,
 		policyEnforcer: policyEnforcer,
 	}, nil
 }
 
+// SetMetrics sets the registry that module runs are recorded into.
+func (m *Manager) SetMetrics(mt *metrics.Metrics) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics = mt
+}
+
 // LoadModulesFromDir scans the module directory for manifest.json files and loads them.
 func (m *Manager) LoadModulesFromDir() error {
 	m.logger.Info("Scanning for modules in directory", "path", m.moduleDir)
@@ -67,6 +82,7 @@ func (m *Manager) LoadModulesFromDir() error {
 
 // LoadModule loads a single module by name from the manager's module directory.
 // It expects the module to be located at <moduleDir>/<name>/manifest.json.
+// A loaded module of the same name is replaced.
 func (m *Manager) LoadModule(name string) error {
 	if name == "" {
 		return fmt.Errorf("module name cannot be empty")
@@ -108,7 +124,17 @@ func (m *Manager) loadModuleFromManifest(manifestPath string) error {
 		return fmt.Errorf("failed to compile module '%s': %w", manifest.Name, err)
 	}
 
-	// 5. Instantiate module
+	// 5. Instantiate module, closing the instance it replaces first since
+	// the runtime refuses two instances with the same name.
+	m.mu.Lock()
+	previous, loaded := m.modules[manifest.Name]
+	delete(m.modules, manifest.Name)
+	m.mu.Unlock()
+	if loaded {
+		if err := previous.Stop(); err != nil {
+			m.logger.Warn("Failed to close replaced module", "name", manifest.Name, "error", err)
+		}
+	}
 	instance, err := m.wasmRuntime.InstantiateModule(context.Background(), compiledModule, manifest.Name)
 	if err != nil {
 		return fmt.Errorf("failed to instantiate module '%s': %w", manifest.Name, err)
@@ -116,6 +142,7 @@ func (m *Manager) loadModuleFromManifest(manifestPath string) error {
 
 	// 6. Create and store module
 	module := NewWasmModule(manifest, instance, m.logger)
+	module.compiled = compiledModule
 	m.mu.Lock()
 	m.modules[module.Name()] = module
 	m.mu.Unlock()
@@ -129,6 +156,39 @@ func (m *Manager) loadModuleFromManifest(manifestPath string) error {
 	return nil
 }
 
+// UnloadedModules returns the sorted names of modules in the module
+// directory that are not loaded, such as those that failed verification.
+func (m *Manager) UnloadedModules() []string {
+	entries, err := os.ReadDir(m.moduleDir)
+	if err != nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, loaded := m.modules[entry.Name()]; loaded {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(m.moduleDir, entry.Name(), "manifest.json")); err == nil {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+// InstalledManifest returns the manifest of a module in the module
+// directory, whether or not it loaded.
+func (m *Manager) InstalledManifest(name string) (*Manifest, error) {
+	if name == "" {
+		return nil, fmt.Errorf("module name cannot be empty")
+	}
+	return m.parseManifest(filepath.Join(m.moduleDir, name, "manifest.json"))
+}
+
 // InstallModule fetches a module from a URL, verifies it, and installs it.
 func (m *Manager) InstallModule(manifestURL string) error {
 	m.logger.Info("Installing module from URL", "url", manifestURL)
@@ -199,16 +259,23 @@ func (m *Manager) InstallModule(manifestURL string) error {
 }
 
 // RunModule starts a loaded module by name.
-func (m *Manager) RunModule(name string) error {
+func (m *Manager) RunModule(ctx context.Context, name string) (err error) {
+	ctx, span := tracing.Start(ctx, "module.RunModule", attribute.String("module.name", name))
+	defer func() { tracing.End(span, err) }()
+
 	m.mu.RLock()
 	module, ok := m.modules[name]
+	mt := m.metrics
 	m.mu.RUnlock()
 	if !ok {
 		return fmt.Errorf("module '%s' not found", name)
 	}
 
+	start := time.Now()
+	defer func() { mt.ObserveModuleRun(name, time.Since(start), err) }()
+
 	// Authorize module execution
-	allowed, reason, err := m.policyEnforcer.Authorize(context.Background(), module.Name(), "run_module", module.Name())
+	allowed, reason, err := m.policyEnforcer.Authorize(ctx, module.Name(), "run_module", module.Name())
 	if err != nil {
 		return fmt.Errorf("failed to authorize module execution: %w", err)
 	}
@@ -216,9 +283,63 @@ func (m *Manager) RunModule(name string) error {
 		return fmt.Errorf("module execution not authorized: %s", reason)
 	}
 
+	if err := faults.Fail(faults.ModuleTrap, name); err != nil {
+		return fmt.Errorf("module '%s' trapped: %w", name, err)
+	}
+	m.mu.Lock()
+	m.running[name] = module
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.running[name] == module {
+			delete(m.running, name)
+		}
+	}()
 	return module.Start()
 }
 
+// RestartModule runs a module stopped with StopModule again. A stopped
+// instance cannot run, so it is replaced with a new one instantiated from
+// the module's compiled code. Like RunModule it returns once the module's
+// entry point does.
+func (m *Manager) RestartModule(ctx context.Context, name string) error {
+	m.mu.Lock()
+	module, ok := m.modules[name]
+	_, running := m.running[name]
+	m.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("module '%s' not found", name)
+	}
+	if running {
+		return fmt.Errorf("module '%s' is already running", name)
+	}
+	wasmMod, ok := module.(*WasmModule)
+	if !ok || wasmMod.compiled == nil {
+		return fmt.Errorf("module '%s' cannot be restarted", name)
+	}
+	if err := wasmMod.Stop(); err != nil {
+		m.logger.Warn("Failed to close stopped module", "name", name, "error", err)
+	}
+	instance, err := m.wasmRuntime.InstantiateModule(ctx, wasmMod.compiled, name)
+	if err != nil {
+		return fmt.Errorf("failed to instantiate module '%s': %w", name, err)
+	}
+	restarted := NewWasmModule(wasmMod.manifest, instance, m.logger)
+	restarted.compiled = wasmMod.compiled
+
+	m.mu.Lock()
+	if m.modules[name] != module {
+		// Reloaded meanwhile; the new instance is not needed.
+		m.mu.Unlock()
+		_ = instance.Close(ctx)
+		return fmt.Errorf("module '%s' was replaced while restarting", name)
+	}
+	m.modules[name] = restarted
+	m.mu.Unlock()
+	return m.RunModule(ctx, name)
+}
+
 // StopModule stops a running module by name.
 func (m *Manager) StopModule(name string) error {
 	m.mu.RLock()
@@ -243,6 +364,20 @@ func (m *Manager) ListModules() []*Manifest {
 	return manifests
 }
 
+// RunningModules returns the manifests of the modules whose entry point is
+// executing.
+func (m *Manager) RunningModules() []*Manifest {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	manifests := make([]*Manifest, 0, len(m.running))
+	for _, mod := range m.running {
+		if wasmMod, ok := mod.(*WasmModule); ok {
+			manifests = append(manifests, wasmMod.manifest)
+		}
+	}
+	return manifests
+}
+
 // HasModule checks if a module with the given name and version is already loaded.
 func (m *Manager) HasModule(name, version string) bool {
 	m.mu.RLock()
@@ -326,6 +461,11 @@ func (m *Manager) SaveAndLoadModule(manifest *Manifest, wasmBytes []byte) error
 	return m.loadModuleFromManifest(manifestPath)
 }
 
+// CheckRuntime reports whether the WASM runtime can still instantiate modules.
+func (m *Manager) CheckRuntime(ctx context.Context) error {
+	return m.wasmRuntime.Ping(ctx)
+}
+
 // Shutdown gracefully stops all modules and closes the wasm runtime.
 func (m *Manager) Shutdown() error {
 	m.logger.Info("Shutting down module manager")
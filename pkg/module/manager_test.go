@@ -99,3 +99,57 @@ trusted_authors:
 		}
 	}
 }
+
+func TestManager_CheckRuntime(t *testing.T) {
+	ctx := context.Background()
+	manager, err := NewManager(ctx, slog.Default(), t.TempDir(), nil, nil)
+	require.NoError(t, err)
+
+	assert.NoError(t, manager.CheckRuntime(ctx))
+	assert.NoError(t, manager.CheckRuntime(ctx), "the probe module must not linger")
+
+	require.NoError(t, manager.Shutdown())
+	assert.Error(t, manager.CheckRuntime(ctx), "a closed runtime is unavailable")
+}
+
+func TestManager_ReloadReplacesLoadedModule(t *testing.T) {
+	dir := t.TempDir()
+	_, signingPrivKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	createTestModule(t, dir, "reloaded", signingPrivKey)
+
+	manager, err := NewManager(context.Background(), slog.Default(), dir, signingPrivKey, nil)
+	require.NoError(t, err)
+	defer manager.Shutdown()
+
+	assert.Equal(t, []string{"reloaded"}, manager.UnloadedModules())
+	require.NoError(t, manager.LoadModule("reloaded"))
+	require.NoError(t, manager.LoadModule("reloaded"), "the runtime must not see two instances")
+	assert.Empty(t, manager.UnloadedModules())
+	assert.Len(t, manager.ListModules(), 1)
+
+	mf, err := manager.InstalledManifest("reloaded")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.0.0", mf.Version)
+	_, err = manager.InstalledManifest("missing")
+	assert.Error(t, err)
+}
+
+func TestManifest_VerifySignature(t *testing.T) {
+	trusted, signingPrivKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	other, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	createTestModule(t, dir, "signed", signingPrivKey)
+	manager, err := NewManager(context.Background(), slog.Default(), dir, signingPrivKey, nil)
+	require.NoError(t, err)
+	defer manager.Shutdown()
+	mf, err := manager.InstalledManifest("signed")
+	require.NoError(t, err)
+
+	assert.NoError(t, mf.VerifySignature([]ed25519.PublicKey{other, trusted}))
+	assert.Error(t, mf.VerifySignature([]ed25519.PublicKey{other}))
+	assert.Error(t, mf.VerifySignature(nil))
+}
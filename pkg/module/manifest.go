@@ -1,5 +1,11 @@
 package module
 
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+)
+
 // Manifest defines the metadata and security properties of a WASM module.
 type Manifest struct {
 	Name         string   `json:"name"`
@@ -14,3 +20,28 @@ type Manifest struct {
 	Capabilities []string `json:"capabilities"`
 	Policy       string   `json:"policy"` // Path to a Rego policy file
 }
+
+// VerifySignature checks that the manifest carries a signature over its hash
+// by one of keys, as Manager.SignModule writes them. It does not check the
+// hash against the wasm bytes.
+func (m *Manifest) VerifySignature(keys []ed25519.PublicKey) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no trusted module keys configured")
+	}
+	digest, err := hex.DecodeString(m.Hash)
+	if err != nil {
+		return fmt.Errorf("invalid module hash: %w", err)
+	}
+	for _, sigHex := range m.Signatures {
+		sig, err := hex.DecodeString(sigHex)
+		if err != nil {
+			continue
+		}
+		for _, key := range keys {
+			if ed25519.Verify(key, digest, sig) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("module %s is not signed by a trusted key", m.Name)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"sync/atomic"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
@@ -18,7 +19,9 @@ type WasmRuntime struct {
 
 // NewWasmRuntime creates a new WASM runtime environment.
 func NewWasmRuntime(ctx context.Context, logger *slog.Logger) (*WasmRuntime, error) {
-	runtime := wazero.NewRuntime(ctx)
+	// Closing a module interrupts its running entry point, so a module can
+	// be stopped while it runs.
+	runtime := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().WithCloseOnContextDone(true))
 
 	// Instantiate WASI, which is required for many modules.
 	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
@@ -69,6 +72,24 @@ func (r *WasmRuntime) InstantiateModule(ctx context.Context, compiledModule waze
 	return moduleInstance, nil
 }
 
+// emptyModule is the smallest valid WASM binary: the magic number and version.
+var emptyModule = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+// Ping compiles and instantiates an empty module to confirm the runtime can
+// still run modules.
+func (r *WasmRuntime) Ping(ctx context.Context) error {
+	compiled, err := r.runtime.CompileModule(ctx, emptyModule)
+	if err != nil {
+		return fmt.Errorf("wasm runtime unavailable: %w", err)
+	}
+	defer compiled.Close(ctx)
+	instance, err := r.runtime.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().WithName(""))
+	if err != nil {
+		return fmt.Errorf("wasm runtime unavailable: %w", err)
+	}
+	return instance.Close(ctx)
+}
+
 // Close shuts down the wazero runtime.
 func (r *WasmRuntime) Close(ctx context.Context) error {
 	return r.runtime.Close(ctx)
@@ -78,7 +99,9 @@ func (r *WasmRuntime) Close(ctx context.Context) error {
 type WasmModule struct {
 	manifest *Manifest
 	instance api.Module
+	compiled wazero.CompiledModule // to instantiate the module again after Stop
 	logger   *slog.Logger
+	stopped  atomic.Bool
 }
 
 // NewWasmModule creates a new WasmModule instance.
@@ -104,15 +127,18 @@ func (m *WasmModule) Start() error {
 
 	// The _start function in WASI has a specific signature (no params, no results).
 	_, err := entryFunc.Call(context.Background())
-	if err != nil {
+	if err != nil && !m.stopped.Load() {
 		return fmt.Errorf("module '%s' execution failed: %w", m.Name(), err)
 	}
 
 	return nil
 }
 
+// Stop closes the instance, which interrupts a running entry point. A
+// stopped module cannot be started again; Manager.RestartModule replaces
+// it with a new instance.
 func (m *WasmModule) Stop() error {
 	m.logger.Info("Stopping module", "name", m.Name())
-	// Closing the instance effectively stops it.
+	m.stopped.Store(true)
 	return m.instance.Close(context.Background())
 }
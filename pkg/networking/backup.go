@@ -0,0 +1,126 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// maxBackupMessage bounds the requests and replies exchanged over
+// BackupProtocol. Objects are chunks of at most 512 KiB or snapshot
+// catalogue entries.
+const maxBackupMessage = 64 << 20
+
+// BackupRequest is an operation on the backup objects a peer keeps for the
+// sender.
+type BackupRequest struct {
+	Op   string `json:"op"` // "put", "get", "delete", "has" or "list"
+	Name string `json:"name"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// BackupResponse answers a BackupRequest.
+type BackupResponse struct {
+	Data     []byte   `json:"data,omitempty"`
+	Names    []string `json:"names,omitempty"`
+	Exists   bool     `json:"exists,omitempty"`
+	NotFound bool     `json:"not_found,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// SetBackupHandler starts keeping backup objects for peers over
+// BackupProtocol. handler decides whether to serve the sender and performs
+// the operation.
+func (p *P2P) SetBackupHandler(handler func(ctx context.Context, from peer.ID, req *BackupRequest) *BackupResponse) {
+	p.host.SetStreamHandler(BackupProtocol, func(stream network.Stream) {
+		defer func() { _ = stream.Close() }()
+
+		var req BackupRequest
+		if err := json.NewDecoder(io.LimitReader(stream, maxBackupMessage)).Decode(&req); err != nil {
+			p.logger.Debug("Failed to decode backup request", "error", err)
+			return
+		}
+		resp := handler(context.Background(), stream.Conn().RemotePeer(), &req)
+		if err := json.NewEncoder(stream).Encode(resp); err != nil {
+			p.logger.Debug("Failed to encode backup response", "error", err)
+		}
+	})
+}
+
+func (p *P2P) backupRequest(ctx context.Context, peerID string, req *BackupRequest) (*BackupResponse, error) {
+	id, err := peer.Decode(peerID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid peer ID %q: %w", peerID, err)
+	}
+	stream, err := p.openStream(ctx, id, BackupProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup stream: %w", err)
+	}
+	defer func() { _ = stream.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send backup request: %w", err)
+	}
+	if err := stream.CloseWrite(); err != nil {
+		return nil, fmt.Errorf("failed to send backup request: %w", err)
+	}
+	var resp BackupResponse
+	if err := json.NewDecoder(io.LimitReader(stream, maxBackupMessage)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read backup response: %w", err)
+	}
+	if resp.NotFound {
+		return nil, fmt.Errorf("backup object %s on %s: %w", req.Name, peerID, fs.ErrNotExist)
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return &resp, nil
+}
+
+// PutObject stores a backup object on a peer.
+func (p *P2P) PutObject(ctx context.Context, peerID, name string, data []byte) error {
+	_, err := p.backupRequest(ctx, peerID, &BackupRequest{Op: "put", Name: name, Data: data})
+	return err
+}
+
+// GetObject fetches a backup object from a peer.
+func (p *P2P) GetObject(ctx context.Context, peerID, name string) ([]byte, error) {
+	resp, err := p.backupRequest(ctx, peerID, &BackupRequest{Op: "get", Name: name})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Data, nil
+}
+
+// DeleteObject removes a backup object from a peer.
+func (p *P2P) DeleteObject(ctx context.Context, peerID, name string) error {
+	_, err := p.backupRequest(ctx, peerID, &BackupRequest{Op: "delete", Name: name})
+	return err
+}
+
+// HasObject reports whether a peer holds a backup object.
+func (p *P2P) HasObject(ctx context.Context, peerID, name string) (bool, error) {
+	resp, err := p.backupRequest(ctx, peerID, &BackupRequest{Op: "has", Name: name})
+	if err != nil {
+		return false, err
+	}
+	return resp.Exists, nil
+}
+
+// ListObjects lists the backup objects a peer holds under dir.
+func (p *P2P) ListObjects(ctx context.Context, peerID, dir string) ([]string, error) {
+	resp, err := p.backupRequest(ctx, peerID, &BackupRequest{Op: "list", Name: dir})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Names, nil
+}
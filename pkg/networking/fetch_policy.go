@@ -0,0 +1,37 @@
+package networking
+
+import (
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+
+	"github.com/naviNBRuas/APA/pkg/robustness"
+)
+
+// DefaultPeerFetchPolicy guards module, update and chunk fetches from
+// peers. Callers already move on to the next peer when one fails, so a
+// fetch is not retried; instead each peer has a breaker that makes fetches
+// from an unresponsive peer fail fast, and a bulkhead caps the fetch
+// streams open at once.
+var DefaultPeerFetchPolicy = robustness.PolicyConfig{
+	Timeout:        time.Minute,
+	Retry:          robustness.RetryPolicy{MaxAttempts: 1},
+	CircuitBreaker: robustness.CircuitBreakerConfig{FailureThreshold: 3, Timeout: time.Minute},
+	MaxConcurrent:  16,
+	MaxWaiting:     64,
+}
+
+// SetFetchPolicy replaces the resilience policy for fetches from peers.
+func (p *P2P) SetFetchPolicy(policy *robustness.Policy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fetches = policy
+}
+
+// fetchMiddleware returns the middleware for a fetch from peerID. A P2P
+// built without NewP2P fetches without one.
+func (p *P2P) fetchMiddleware(peerID peer.ID) robustness.Middleware {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.fetches.Middleware(peerID.String())
+}
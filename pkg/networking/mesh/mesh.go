@@ -34,6 +34,7 @@ const (
 	TransportLAN      TransportType = "lan"
 	TransportRelay    TransportType = "relay"
 	TransportP2P      TransportType = "p2p"
+	TransportSimulated TransportType = "simulated"
 )
 
 // MeshConfig configures the mesh network node.
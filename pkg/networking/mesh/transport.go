@@ -111,6 +111,15 @@ func (tc *TransportChain) buildChain() {
 	tc.methods = methods
 }
 
+// UseMethods replaces the built-in transports, for example with simulated
+// ones, and must be called before Start. Methods with their own Receive
+// channel are forwarded into the chain's channel once the chain is started.
+func (tc *TransportChain) UseMethods(methods ...TransportMethod) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	tc.methods = append([]TransportMethod(nil), methods...)
+}
+
 func (tc *TransportChain) SetNodeID(nodeID string) {
 	tc.mu.Lock()
 	defer tc.mu.Unlock()
@@ -134,10 +143,31 @@ func (tc *TransportChain) Start(ctx context.Context) error {
 			continue
 		}
 		tc.logger.Info("Transport listening", "transport", m.Name())
+		if ch := m.Receive(); ch != tc.msgCh {
+			go tc.forward(ctx, ch)
+		}
 	}
 	return nil
 }
 
+func (tc *TransportChain) forward(ctx context.Context, ch <-chan IncomingMessage) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			select {
+			case tc.msgCh <- msg:
+			default:
+				tc.logger.Debug("Dropping message, receive queue full", "from", truncateID(msg.From))
+			}
+		}
+	}
+}
+
 func (tc *TransportChain) Stop() {
 	for _, m := range tc.methods {
 		_ = m.Close()
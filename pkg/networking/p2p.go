@@ -22,9 +22,13 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
 	ma "github.com/multiformats/go-multiaddr"
+	"github.com/naviNBRuas/APA/pkg/faults"
+	"github.com/naviNBRuas/APA/pkg/metrics"
 	"github.com/naviNBRuas/APA/pkg/module"
 	"github.com/naviNBRuas/APA/pkg/policy"
+	"github.com/naviNBRuas/APA/pkg/robustness"
 	"github.com/naviNBRuas/APA/pkg/update"
 )
 
@@ -33,10 +37,15 @@ const (
 	ModuleTopic         = "apa/modules/1.0.0"
 	ControllerCommTopic = "apa/controller-comm/1.0.0"
 	LeaderElectionTopic = "apa/leader-election/1.0.0"
+	FleetStatusTopic    = "apa/fleet-status/1.0.0"
 	ModuleFetchProtocol = "/apa/fetch-module/1.0.0"
 	UpdateFetchProtocol = "/apa/fetch-update/1.0.0"
 	PropagationProtocol = "/apa/propagate/1.0.0"
 	MeshProtocol        = "/apa/mesh/1.0.0"
+	ChunkProtocol       = "/apa/chunk/1.0.0"
+	PatchProtocol       = "/apa/patch/1.0.0"
+	BackupProtocol      = "/apa/backup/1.0.0"
+	RecoveryProtocol    = "/apa/recovery/1.0.0"
 )
 
 // PropagationPayload is exchanged over the propagation protocol to deliver
@@ -61,6 +70,7 @@ type P2P struct {
 	moduleTopic          *pubsub.Topic
 	controllerCommTopic  *pubsub.Topic
 	leaderElectionTopic  *pubsub.Topic
+	fleetStatusTopic     *pubsub.Topic
 	advancedDiscovery    *AdvancedDiscovery
 	forwardDecider       ForwardDecider
 	FetchModuleHandler   func(name, version string) (*module.Manifest, []byte, error)
@@ -70,6 +80,12 @@ type P2P struct {
 	config               Config
 	propagationHandler   func(context.Context, peer.ID, PropagationPayload) error
 	privKey              crypto.PrivKey
+	metrics              *metrics.Metrics
+	fetches              *robustness.Policy
+	heartbeatScale       float64
+
+	// FetchUpdateDeltaHandler answers update fetches that name a base binary.
+	FetchUpdateDeltaHandler func(version, baseSHA256 string) (*update.ReleaseInfo, []byte, error)
 }
 
 // Config holds the configuration for the P2P networking.
@@ -89,13 +105,17 @@ type Config struct {
 type ModuleAnnouncementMessage struct {
 	Manifest        module.Manifest `json:"manifest"`
 	AnnouncerPeerID string          `json:"announcer_peer_id"`
+	Content         string          `json:"content,omitempty"` // chunked-transfer manifest root of the wasm bytes
 }
 
-// ControllerMessage represents a message between controllers.
+// ControllerMessage represents a message between controllers. TraceContext
+// carries the W3C trace context of the sender so receivers can continue the
+// trace (see tracing.Inject / tracing.Extract).
 type ControllerMessage struct {
-	Type         string          `json:"type"`
-	Data         json.RawMessage `json:"data"`
-	SenderPeerID string          `json:"sender_peer_id"`
+	Type         string            `json:"type"`
+	Data         json.RawMessage   `json:"data"`
+	SenderPeerID string            `json:"sender_peer_id"`
+	TraceContext map[string]string `json:"trace_context,omitempty"`
 }
 
 // LeaderElectionMessage represents a leader election message.
@@ -107,6 +127,13 @@ type LeaderElectionMessage struct {
 	Timestamp    time.Time `json:"timestamp"`
 }
 
+// FleetStatusMessage is a raw fleet status summary received from a peer.
+// The payload is opaque to the networking layer; see package fleet.
+type FleetStatusMessage struct {
+	Data         []byte
+	SenderPeerID string
+}
+
 // HostID returns the local host peer ID as a string.
 func (p *P2P) HostID() string {
 	if p == nil || p.host == nil {
@@ -136,6 +163,37 @@ func (p *P2P) getForwardDecider() ForwardDecider {
 	return p.forwardDecider
 }
 
+// SetMetrics sets the registry that peer counts and pubsub traffic are
+// recorded into.
+func (p *P2P) SetMetrics(mt *metrics.Metrics) {
+	p.mu.Lock()
+	p.metrics = mt
+	p.mu.Unlock()
+	if mt == nil || p.host == nil {
+		return
+	}
+	mt.SetPeers(p.PeerCount())
+	p.host.Network().Notify(&peerCountNotifee{p2p: p, metrics: mt})
+}
+
+// SetPeerEventHandler registers fn to be called when a peer gains its first
+// connection (connected=true) or loses its last one (connected=false).
+func (p *P2P) SetPeerEventHandler(fn func(id peer.ID, connected bool)) {
+	if fn == nil || p.host == nil {
+		return
+	}
+	p.host.Network().Notify(&peerEventNotifee{handler: fn})
+}
+
+func (p *P2P) getMetrics() *metrics.Metrics {
+	if p == nil {
+		return nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.metrics
+}
+
 // GetConnectedPeers returns the list of currently connected peers.
 func (p *P2P) GetConnectedPeers() []peer.ID {
 	if p.advancedDiscovery != nil {
@@ -189,6 +247,7 @@ func (p *P2P) GetTopicHealth() map[string]bool {
 		"controller": p.IsControllerJoined(),
 		"leader":     p.IsLeaderElectionJoined(),
 		"module":     p.moduleTopic != nil,
+		"fleet":      p.IsFleetStatusJoined(),
 	}
 }
 
@@ -271,6 +330,7 @@ func NewP2P(ctx context.Context, logger *slog.Logger, config Config, peerID peer
 		pubsub:  ps,
 		config:  config,
 		privKey: privKey,
+		fetches: robustness.NewPolicy(logger, "peer-fetch", DefaultPeerFetchPolicy),
 	}
 	p2p.admittedPeers = make(map[peer.ID]bool)
 
@@ -359,7 +419,7 @@ func (p *P2P) SendPropagationPayload(ctx context.Context, peerID peer.ID, payloa
 	if fd != nil && !fd.AllowForward(peerID, len(payload.Payload)) {
 		return fmt.Errorf("forward vetoed by policy for peer %s", peerID)
 	}
-	stream, err := p.host.NewStream(ctx, peerID, PropagationProtocol)
+	stream, err := p.openStream(ctx, peerID, PropagationProtocol)
 	if err != nil {
 		return fmt.Errorf("failed to create propagation stream: %w", err)
 	}
@@ -386,36 +446,52 @@ func (p *P2P) SendPropagationPayload(ctx context.Context, peerID peer.ID, payloa
 
 // FetchModule requests a module (manifest + wasm bytes) from a peer.
 func (p *P2P) FetchModule(ctx context.Context, peerID peer.ID, name, version string) (*module.Manifest, []byte, error) {
-	stream, err := p.host.NewStream(ctx, peerID, ModuleFetchProtocol)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create module fetch stream: %w", err)
-	}
-	defer func() { _ = stream.Close() }()
-
-	request := struct {
-		Name    string `json:"name"`
-		Version string `json:"version"`
-	}{Name: name, Version: version}
-
-	if err := json.NewEncoder(stream).Encode(request); err != nil {
-		return nil, nil, fmt.Errorf("failed to encode module fetch request: %w", err)
-	}
-
-	var response struct {
+	type moduleFetchResponse struct {
 		Manifest *module.Manifest `json:"manifest"`
 		Wasm     []byte           `json:"wasm"`
 	}
+	response, err := robustness.Call(ctx, p.fetchMiddleware(peerID), func(ctx context.Context) (*moduleFetchResponse, error) {
+		stream, err := p.openStream(ctx, peerID, ModuleFetchProtocol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create module fetch stream: %w", err)
+		}
+		defer func() { _ = stream.Close() }()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = stream.SetDeadline(deadline)
+		}
 
-	if err := json.NewDecoder(stream).Decode(&response); err != nil {
-		return nil, nil, fmt.Errorf("failed to decode module fetch response: %w", err)
-	}
+		request := struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		}{Name: name, Version: version}
 
+		if err := json.NewEncoder(stream).Encode(request); err != nil {
+			return nil, fmt.Errorf("failed to encode module fetch request: %w", err)
+		}
+
+		var response moduleFetchResponse
+		if err := json.NewDecoder(stream).Decode(&response); err != nil {
+			return nil, fmt.Errorf("failed to decode module fetch response: %w", err)
+		}
+		return &response, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
 	return response.Manifest, response.Wasm, nil
 }
 
 // NewStream opens a new libp2p stream to the given peer for the mesh protocol.
 func (p *P2P) NewStream(ctx context.Context, peerID peer.ID) (network.Stream, error) {
-	return p.host.NewStream(ctx, peerID, MeshProtocol)
+	return p.openStream(ctx, peerID, MeshProtocol)
+}
+
+// openStream opens a stream to peerID, after any injected stream latency.
+func (p *P2P) openStream(ctx context.Context, peerID peer.ID, proto protocol.ID) (network.Stream, error) {
+	if err := faults.Delay(ctx, faults.StreamLatency, peerID.String()+string(proto)); err != nil {
+		return nil, err
+	}
+	return p.host.NewStream(ctx, peerID, proto)
 }
 
 // SetStreamHandler registers a handler for incoming mesh protocol streams.
@@ -485,6 +561,25 @@ func (p *P2P) ensureTopics(ctx context.Context) {
 	if p.leaderElectionTopic == nil {
 		_ = p.JoinLeaderElectionTopic(ctx)
 	}
+	if p.fleetTopic() == nil {
+		_ = p.JoinFleetStatusTopic(ctx)
+	}
+}
+
+// publish sends msg on topic with retries and records the outcome.
+func (p *P2P) publish(ctx context.Context, topic *pubsub.Topic, msg []byte, label string) error {
+	if faults.Drop(faults.PubsubPublish, topic.String()) {
+		p.logger.Debug("Dropping pubsub message by injected fault", "label", label)
+		p.getMetrics().PubsubMessage(topic.String(), "dropped")
+		return nil
+	}
+	err := publishWithRetry(ctx, p.logger, topic, msg, label)
+	if err != nil {
+		p.getMetrics().PubsubMessage(topic.String(), "publish_error")
+		return err
+	}
+	p.getMetrics().PubsubMessage(topic.String(), "sent")
+	return nil
 }
 
 // publishWithRetry provides limited backoff and retry for pubsub publishes.
@@ -560,6 +655,39 @@ func (n *reconnectNotifee) ClosedStream(net network.Network, s network.Stream) {
 func (n *reconnectNotifee) Listen(net network.Network, addr ma.Multiaddr)      {}
 func (n *reconnectNotifee) ListenClose(net network.Network, addr ma.Multiaddr) {}
 
+// peerCountNotifee keeps the connected peer gauge current.
+type peerCountNotifee struct {
+	p2p     *P2P
+	metrics *metrics.Metrics
+}
+
+func (n *peerCountNotifee) Connected(network.Network, network.Conn) {
+	n.metrics.SetPeers(n.p2p.PeerCount())
+}
+func (n *peerCountNotifee) Disconnected(network.Network, network.Conn) {
+	n.metrics.SetPeers(n.p2p.PeerCount())
+}
+func (n *peerCountNotifee) Listen(network.Network, ma.Multiaddr)      {}
+func (n *peerCountNotifee) ListenClose(network.Network, ma.Multiaddr) {}
+
+// peerEventNotifee reports peer-level (rather than connection-level) changes.
+type peerEventNotifee struct {
+	handler func(id peer.ID, connected bool)
+}
+
+func (n *peerEventNotifee) Connected(net network.Network, c network.Conn) {
+	if len(net.ConnsToPeer(c.RemotePeer())) == 1 {
+		n.handler(c.RemotePeer(), true)
+	}
+}
+func (n *peerEventNotifee) Disconnected(net network.Network, c network.Conn) {
+	if net.Connectedness(c.RemotePeer()) != network.Connected {
+		n.handler(c.RemotePeer(), false)
+	}
+}
+func (n *peerEventNotifee) Listen(network.Network, ma.Multiaddr)      {}
+func (n *peerEventNotifee) ListenClose(network.Network, ma.Multiaddr) {}
+
 // GetReputationScore returns the reputation score for a peer if the advanced
 // discovery system is available. Falls back to a neutral score otherwise.
 func (p *P2P) GetReputationScore(id peer.ID) float64 {
@@ -602,6 +730,9 @@ func (p *P2P) Shutdown() error {
 	if p.leaderElectionTopic != nil {
 		_ = p.leaderElectionTopic.Close()
 	}
+	if topic := p.fleetTopic(); topic != nil {
+		_ = topic.Close()
+	}
 
 	if err := p.dht.Close(); err != nil {
 		p.logger.Error("Failed to close DHT", "error", err)
@@ -1,16 +1,27 @@
 package networking
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/naviNBRuas/APA/pkg/backup"
+	"github.com/naviNBRuas/APA/pkg/patch"
+	"github.com/naviNBRuas/APA/pkg/recovery"
+	"github.com/naviNBRuas/APA/pkg/transfer"
 	"github.com/stretchr/testify/require"
 )
 
@@ -109,6 +120,25 @@ func TestP2PLocalHeartbeatPropagation(t *testing.T) {
 	}
 }
 
+func TestP2PFleetStatusJoinIsRaceFree(t *testing.T) {
+	requireP2PIntegration(t)
+
+	p, cancel := newTestP2P(t)
+	defer cancel()
+	defer p.host.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = p.IsFleetStatusJoined()
+		}
+	}()
+	require.NoError(t, p.JoinFleetStatusTopic(context.Background()))
+	<-done
+	require.True(t, p.IsFleetStatusJoined())
+}
+
 func TestP2PControllerMessageRoundTrip(t *testing.T) {
 	requireP2PIntegration(t)
 
@@ -150,3 +180,196 @@ func TestP2PControllerMessageRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestP2PChunkTransferRoundTrip(t *testing.T) {
+	requireP2PIntegration(t)
+
+	p1, cancel1 := newTestP2P(t)
+	defer cancel1()
+	defer p1.host.Close()
+	p2, cancel2 := newTestP2P(t)
+	defer cancel2()
+	defer p2.host.Close()
+
+	connectPeers(t, p1, p2)
+
+	seedStore, err := transfer.NewStore(t.TempDir())
+	require.NoError(t, err)
+	p1.SetContentSource(seedStore)
+	data := bytes.Repeat([]byte("chunked artifact "), transfer.ChunkSize/4)
+	m, err := seedStore.Put("artifact", data)
+	require.NoError(t, err)
+
+	store, err := transfer.NewStore(t.TempDir())
+	require.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := transfer.New(testLogger(t), transfer.Config{}, store, p2).Fetch(ctx, m.Root, p1.host.ID())
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+
+	_, err = p2.FetchChunk(ctx, p1.host.ID(), strings.Repeat("0", 64))
+	require.ErrorContains(t, err, "content not found")
+}
+
+func TestP2PPatchDeliveryRoundTrip(t *testing.T) {
+	requireP2PIntegration(t)
+
+	p1, cancel1 := newTestP2P(t)
+	defer cancel1()
+	defer p1.host.Close()
+	p2, cancel2 := newTestP2P(t)
+	defer cancel2()
+	defer p2.host.Close()
+
+	connectPeers(t, p1, p2)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	receiver := patch.NewPatchManager(testLogger(t))
+	receiver.SetTrustedKeys(pub)
+	receiver.RegisterHandler("driver", patch.FileHandler{Dir: dir})
+	p2.SetPatchHandler(func(ctx context.Context, from peer.ID, pt *patch.Patch) patch.DeliveryResult {
+		return receiver.HandleIncoming(ctx, from.String(), pt)
+	})
+
+	sender := patch.NewPatchManager(testLogger(t))
+	sender.SetTrustedKeys(pub)
+	sender.SetTransport(p1)
+	pt := &patch.Patch{ID: "p1", Name: "netdrv.so", Version: "1.0.1", Target: "driver", Content: []byte("driver v1.0.1"), CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	patch.SignPatch(pt, priv)
+	require.NoError(t, sender.AddPatch(pt))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	results, err := sender.DistributePatch(ctx, "p1", []string{p2.host.ID().String()})
+	require.NoError(t, err)
+	require.Equal(t, patch.DeliveryApplied, results[0].Status, results[0].Error)
+	got, err := os.ReadFile(filepath.Join(dir, "netdrv.so"))
+	require.NoError(t, err)
+	require.Equal(t, pt.Content, got)
+}
+
+func TestP2PBackupObjectRoundTrip(t *testing.T) {
+	requireP2PIntegration(t)
+
+	p1, cancel1 := newTestP2P(t)
+	defer cancel1()
+	defer p1.host.Close()
+	p2, cancel2 := newTestP2P(t)
+	defer cancel2()
+	defer p2.host.Close()
+
+	connectPeers(t, p1, p2)
+
+	host := backup.NewPeerHost(t.TempDir(), 1<<20)
+	p2.SetBackupHandler(func(ctx context.Context, from peer.ID, req *BackupRequest) *BackupResponse {
+		var (
+			resp BackupResponse
+			err  error
+		)
+		switch req.Op {
+		case "put":
+			err = host.Put(from.String(), req.Name, req.Data)
+		case "get":
+			resp.Data, err = host.Get(from.String(), req.Name)
+		case "delete":
+			err = host.Delete(from.String(), req.Name)
+		case "has":
+			resp.Exists, err = host.Has(from.String(), req.Name)
+		case "list":
+			resp.Names, err = host.List(from.String(), req.Name)
+		}
+		if errors.Is(err, fs.ErrNotExist) {
+			return &BackupResponse{NotFound: true}
+		}
+		if err != nil {
+			return &BackupResponse{Error: err.Error()}
+		}
+		return &resp
+	})
+
+	target := &backup.PeerTarget{
+		Store:    p1,
+		Peers:    func() []string { return []string{p2.host.ID().String()} },
+		Replicas: 1,
+		Timeout:  10 * time.Second,
+	}
+	require.NoError(t, target.Save("data/ab/ab01", []byte("sealed chunk")))
+	data, err := target.Load("data/ab/ab01")
+	require.NoError(t, err)
+	require.Equal(t, "sealed chunk", string(data))
+	ok, err := target.Exists("data/ab/ab01")
+	require.NoError(t, err)
+	require.True(t, ok)
+	names, err := target.List("data")
+	require.NoError(t, err)
+	require.Equal(t, []string{"data/ab/ab01"}, names)
+
+	require.NoError(t, target.Remove("data/ab/ab01"))
+	_, err = target.Load("data/ab/ab01")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+type trustAllReputation struct{}
+
+func (trustAllReputation) GetPeerScore(string) float64        { return 100 }
+func (trustAllReputation) IsTrustedPeer(string, float64) bool { return true }
+
+func TestP2PRecoveryRoundTrip(t *testing.T) {
+	requireP2PIntegration(t)
+
+	p1, cancel1 := newTestP2P(t)
+	defer cancel1()
+	defer p1.host.Close()
+	p2, cancel2 := newTestP2P(t)
+	defer cancel2()
+	defer p2.host.Close()
+
+	connectPeers(t, p1, p2)
+
+	newManager := func(p *P2P) *recovery.P2PRecoveryManager {
+		m := recovery.NewP2PRecoveryManager(testLogger(t), nil, nil, nil, nil, trustAllReputation{})
+		m.SetIdentity(p.host.ID(), p.host.Peerstore().PrivKey(p.host.ID()))
+		m.SetTransport(p)
+		m.SetPolicyEnforcer(mockPolicyEnforcerLocal{})
+		return m
+	}
+	requester := newManager(p1)
+	responder := newManager(p2)
+	responder.SetLocalState(recovery.LocalState{Config: func() ([]byte, error) { return []byte("log_level: info\n"), nil }})
+	p2.SetRecoveryHandler(responder.HandleRequest)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := requester.RequestRecoveryFromPeer(ctx, &recovery.RecoveryRequest{TargetID: p2.host.ID(), ResourceType: recovery.ResourceConfig})
+	require.NoError(t, err)
+	require.Equal(t, "log_level: info\n", string(resp.Data))
+}
+
+func TestP2PReconnectPeer(t *testing.T) {
+	requireP2PIntegration(t)
+
+	p1, cancel1 := newTestP2P(t)
+	defer cancel1()
+	defer p1.host.Close()
+	p2, cancel2 := newTestP2P(t)
+	defer cancel2()
+	defer p2.host.Close()
+
+	connectPeers(t, p1, p2)
+	require.Empty(t, p1.DisconnectedPeers(0))
+
+	require.NoError(t, p1.ClosePeer(p2.host.ID()))
+	require.Eventually(t, func() bool {
+		return p1.host.Network().Connectedness(p2.host.ID()) != network.Connected
+	}, 3*time.Second, 20*time.Millisecond)
+	require.Equal(t, []peer.ID{p2.host.ID()}, p1.DisconnectedPeers(0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, p1.ReconnectPeer(ctx, p2.host.ID()))
+	require.Equal(t, network.Connected, p1.host.Network().Connectedness(p2.host.ID()))
+	require.Error(t, p1.ReconnectPeer(ctx, p1.host.ID()))
+}
@@ -0,0 +1,71 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/naviNBRuas/APA/pkg/patch"
+)
+
+const (
+	// maxPatchSize bounds the patches accepted over PatchProtocol.
+	maxPatchSize = 128 << 20
+	// patchReadTimeout bounds how long a sender may take to write a patch,
+	// and how long the acknowledgement may take to write back.
+	patchReadTimeout = 2 * time.Minute
+	// patchApplyTimeout bounds verifying and applying a received patch.
+	patchApplyTimeout = 5 * time.Minute
+)
+
+// SetPatchHandler starts accepting patches over PatchProtocol. handler
+// verifies and applies each patch; its result is sent back to the sender as
+// the acknowledgement.
+func (p *P2P) SetPatchHandler(handler func(ctx context.Context, from peer.ID, pt *patch.Patch) patch.DeliveryResult) {
+	p.host.SetStreamHandler(PatchProtocol, func(stream network.Stream) {
+		defer func() { _ = stream.Close() }()
+		_ = stream.SetReadDeadline(time.Now().Add(patchReadTimeout))
+
+		var pt patch.Patch
+		if err := json.NewDecoder(io.LimitReader(stream, maxPatchSize)).Decode(&pt); err != nil {
+			p.logger.Debug("Failed to decode patch", "error", err)
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), patchApplyTimeout)
+		result := handler(ctx, stream.Conn().RemotePeer(), &pt)
+		cancel()
+		_ = stream.SetWriteDeadline(time.Now().Add(patchReadTimeout))
+		if err := json.NewEncoder(stream).Encode(result); err != nil {
+			p.logger.Debug("Failed to encode patch acknowledgement", "error", err)
+		}
+	})
+}
+
+// SendPatch delivers a patch to a peer and waits for its acknowledgement,
+// which is sent once the peer has applied or refused the patch.
+func (p *P2P) SendPatch(ctx context.Context, peerID peer.ID, pt *patch.Patch) (*patch.DeliveryResult, error) {
+	stream, err := p.openStream(ctx, peerID, PatchProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create patch stream: %w", err)
+	}
+	defer func() { _ = stream.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(stream).Encode(pt); err != nil {
+		return nil, fmt.Errorf("failed to send patch: %w", err)
+	}
+	if err := stream.CloseWrite(); err != nil {
+		return nil, fmt.Errorf("failed to send patch: %w", err)
+	}
+	var result patch.DeliveryResult
+	if err := json.NewDecoder(stream).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to read patch acknowledgement: %w", err)
+	}
+	return &result, nil
+}
@@ -3,6 +3,7 @@ package networking
 import (
 	"context"
 	"log/slog"
+	"strings"
 	"testing"
 	"time"
 
@@ -158,6 +159,24 @@ func TestSetFetchUpdateHandler(t *testing.T) {
 	assert.NotNil(t, p2p.FetchUpdateHandler)
 }
 
+func TestContentCID(t *testing.T) {
+	root := strings.Repeat("ab", 32)
+	c, err := contentCID(root)
+	require.NoError(t, err)
+	again, err := contentCID(root)
+	require.NoError(t, err)
+	assert.True(t, c.Equals(again))
+	_, err = contentCID("not hex")
+	assert.Error(t, err)
+}
+
+func TestSetFetchUpdateDeltaHandler(t *testing.T) {
+	p2p := &P2P{}
+	handler := func(version, baseSHA256 string) (*update.ReleaseInfo, []byte, error) { return nil, nil, nil }
+	p2p.SetFetchUpdateDeltaHandler(handler)
+	assert.NotNil(t, p2p.FetchUpdateDeltaHandler)
+}
+
 type protocolInfo struct {
 	name     string
 	factory  func() (interface{}, error)
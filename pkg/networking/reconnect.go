@@ -0,0 +1,65 @@
+package networking
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/p2p/net/swarm"
+)
+
+// ReconnectPeer closes any connections to id and dials it again at the
+// addresses the peerstore holds for it.
+func (p *P2P) ReconnectPeer(ctx context.Context, id peer.ID) error {
+	if p == nil || p.host == nil {
+		return fmt.Errorf("host not initialized")
+	}
+	if id == p.host.ID() {
+		return fmt.Errorf("cannot reconnect to self")
+	}
+	info := p.host.Peerstore().PeerInfo(id)
+	if len(info.Addrs) == 0 {
+		return fmt.Errorf("no known addresses for peer %s", id)
+	}
+	if err := p.host.Network().ClosePeer(id); err != nil {
+		p.logger.Debug("Failed to close peer before reconnecting", "peer", id, "error", err)
+	}
+	// Earlier failed dials leave a backoff that would refuse this one.
+	if sw, ok := p.host.Network().(*swarm.Swarm); ok {
+		sw.Backoff().Clear(id)
+	}
+	if err := p.host.Connect(ctx, info); err != nil {
+		return fmt.Errorf("failed to reconnect to %s: %w", id, err)
+	}
+	return nil
+}
+
+// DisconnectedPeers returns up to limit peers the peerstore holds addresses
+// for that are not connected, most reputable first.
+func (p *P2P) DisconnectedPeers(limit int) []peer.ID {
+	if p == nil || p.host == nil {
+		return nil
+	}
+	connected := make(map[peer.ID]bool)
+	for _, id := range p.host.Network().Peers() {
+		connected[id] = true
+	}
+	var ids []peer.ID
+	for _, id := range p.host.Peerstore().PeersWithAddrs() {
+		if id != p.host.ID() && !connected[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		ri, rj := p.GetReputationScore(ids[i]), p.GetReputationScore(ids[j])
+		if ri != rj {
+			return ri > rj
+		}
+		return ids[i] < ids[j]
+	})
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+	return ids
+}
@@ -0,0 +1,60 @@
+package networking
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/naviNBRuas/APA/pkg/recovery"
+)
+
+// maxRecoveryMessage bounds the requests and responses exchanged over
+// RecoveryProtocol. Responses carry whole modules and controller binaries.
+const maxRecoveryMessage = 128 << 20
+
+// SetRecoveryHandler starts serving recovery requests over
+// RecoveryProtocol. handler authenticates and authorizes the sender and
+// returns the signed response.
+func (p *P2P) SetRecoveryHandler(handler func(ctx context.Context, from peer.ID, req *recovery.RecoveryRequest) *recovery.RecoveryResponse) {
+	p.host.SetStreamHandler(RecoveryProtocol, func(stream network.Stream) {
+		defer func() { _ = stream.Close() }()
+
+		var req recovery.RecoveryRequest
+		if err := json.NewDecoder(io.LimitReader(stream, maxRecoveryMessage)).Decode(&req); err != nil {
+			p.logger.Debug("Failed to decode recovery request", "error", err)
+			return
+		}
+		resp := handler(context.Background(), stream.Conn().RemotePeer(), &req)
+		if err := json.NewEncoder(stream).Encode(resp); err != nil {
+			p.logger.Debug("Failed to encode recovery response", "error", err)
+		}
+	})
+}
+
+// RequestRecovery sends a recovery request to a peer and returns its
+// response, which the caller verifies.
+func (p *P2P) RequestRecovery(ctx context.Context, peerID peer.ID, req *recovery.RecoveryRequest) (*recovery.RecoveryResponse, error) {
+	stream, err := p.openStream(ctx, peerID, RecoveryProtocol)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recovery stream: %w", err)
+	}
+	defer func() { _ = stream.Close() }()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = stream.SetDeadline(deadline)
+	}
+
+	if err := json.NewEncoder(stream).Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send recovery request: %w", err)
+	}
+	if err := stream.CloseWrite(); err != nil {
+		return nil, fmt.Errorf("failed to send recovery request: %w", err)
+	}
+	var resp recovery.RecoveryResponse
+	if err := json.NewDecoder(io.LimitReader(stream, maxRecoveryMessage)).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read recovery response: %w", err)
+	}
+	return &resp, nil
+}
@@ -1,6 +1,7 @@
 package networking
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
@@ -9,15 +10,42 @@ import (
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
 // TaskEnvelope represents a hop-by-hop store-and-forward instruction.
 type TaskEnvelope struct {
-	ID        string
-	Payload   []byte
-	ExpiresAt time.Time
-	Hops      int
-	MaxHops   int
+	ID           string
+	Payload      []byte
+	ExpiresAt    time.Time
+	Hops         int
+	MaxHops      int
+	TraceContext map[string]string // trace context of the originating request
+}
+
+// Context returns ctx carrying the envelope's trace context. Process a
+// task under it so the work joins the trace of the request that created
+// the task.
+func (e TaskEnvelope) Context(ctx context.Context) context.Context {
+	return tracing.Extract(ctx, e.TraceContext)
+}
+
+// traceHop records a store-and-forward hop of env as a span under the
+// envelope's trace and returns the trace context to pass on, so the next
+// hop's span is a child of this one.
+func traceHop(env TaskEnvelope, name string, attrs ...attribute.KeyValue) map[string]string {
+	if len(env.TraceContext) == 0 {
+		return nil
+	}
+	attrs = append(attrs, attribute.String("task.id", env.ID), attribute.Int("task.hops", env.Hops))
+	ctx, span := tracing.Start(env.Context(context.Background()), name, attrs...)
+	defer span.End()
+	if carrier := tracing.Inject(ctx); carrier != nil {
+		return carrier
+	}
+	return env.TraceContext
 }
 
 // StoreAndForward manages delay-tolerant, hop-by-hop task distribution.
@@ -63,17 +91,19 @@ func (s *StoreAndForward) SetDecider(decider ForwardDecider) {
 }
 
 // Enqueue creates a new local task envelope and stores it for forwarding.
-func (s *StoreAndForward) Enqueue(payload []byte, maxHops int) TaskEnvelope {
+// The trace context in ctx travels with the envelope across hops.
+func (s *StoreAndForward) Enqueue(ctx context.Context, payload []byte, maxHops int) TaskEnvelope {
 	if maxHops <= 0 {
 		maxHops = 8
 	}
 	id := s.newID()
 	env := TaskEnvelope{
-		ID:        id,
-		Payload:   append([]byte(nil), payload...),
-		ExpiresAt: time.Now().Add(s.ttl),
-		Hops:      0,
-		MaxHops:   maxHops,
+		ID:           id,
+		Payload:      append([]byte(nil), payload...),
+		ExpiresAt:    time.Now().Add(s.ttl),
+		Hops:         0,
+		MaxHops:      maxHops,
+		TraceContext: tracing.Inject(ctx),
 	}
 	s.mu.Lock()
 	s.evictIfNeeded()
@@ -83,6 +113,7 @@ func (s *StoreAndForward) Enqueue(payload []byte, maxHops int) TaskEnvelope {
 }
 
 // Receive stores a task received from another peer if valid and not expired.
+// The receipt is recorded as a span in the task's trace.
 func (s *StoreAndForward) Receive(env TaskEnvelope, from peer.ID) {
 	if time.Now().After(env.ExpiresAt) {
 		return
@@ -103,6 +134,7 @@ func (s *StoreAndForward) Receive(env TaskEnvelope, from peer.ID) {
 		s.evictIfNeeded()
 		copyEnv := env
 		copyEnv.Payload = append([]byte(nil), env.Payload...)
+		copyEnv.TraceContext = traceHop(env, "storeforward.receive", attribute.String("peer.from", from.String()))
 		s.tasks[env.ID] = &copyEnv
 	}
 
@@ -113,6 +145,7 @@ func (s *StoreAndForward) Receive(env TaskEnvelope, from peer.ID) {
 
 // NextForPeer returns up to limit envelopes not yet seen by the target peer and within hop limits.
 // It increments hop counts in the returned copies and marks the peer as having seen them.
+// Each forward is recorded as a span in the task's trace, which the returned copy carries on.
 func (s *StoreAndForward) NextForPeer(target peer.ID, limit int) []TaskEnvelope {
 	if limit <= 0 {
 		limit = 10
@@ -143,6 +176,7 @@ func (s *StoreAndForward) NextForPeer(target peer.ID, limit int) []TaskEnvelope
 
 		copyEnv := *env
 		copyEnv.Hops++
+		copyEnv.TraceContext = traceHop(copyEnv, "storeforward.forward", attribute.String("peer.to", target.String()))
 		results = append(results, copyEnv)
 		s.markSeen(env.ID, target)
 	}
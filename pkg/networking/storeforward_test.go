@@ -1,6 +1,7 @@
 package networking
 
 import (
+	"context"
 	"io"
 	"log/slog"
 	"testing"
@@ -8,6 +9,12 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
 func sfLogger() *slog.Logger {
@@ -16,7 +23,7 @@ func sfLogger() *slog.Logger {
 
 func TestEnqueueAndNextForPeerMarksSeen(t *testing.T) {
 	sf := NewStoreAndForward(sfLogger(), 10, time.Minute)
-	env := sf.Enqueue([]byte("hello"), 3)
+	env := sf.Enqueue(context.Background(), []byte("hello"), 3)
 
 	out := sf.NextForPeer(peer.ID("peer-1"), 5)
 	require.Len(t, out, 1, "expected one envelope, got %d", len(out))
@@ -29,9 +36,9 @@ func TestEnqueueAndNextForPeerMarksSeen(t *testing.T) {
 
 func TestExpireAndEvict(t *testing.T) {
 	sf := NewStoreAndForward(sfLogger(), 2, 10*time.Millisecond)
-	sf.Enqueue([]byte("a"), 2)
-	sf.Enqueue([]byte("b"), 2)
-	sf.Enqueue([]byte("c"), 2) // should evict oldest to stay within cache after prune attempt
+	sf.Enqueue(context.Background(), []byte("a"), 2)
+	sf.Enqueue(context.Background(), []byte("b"), 2)
+	sf.Enqueue(context.Background(), []byte("c"), 2) // should evict oldest to stay within cache after prune attempt
 
 	time.Sleep(15 * time.Millisecond)
 	_ = sf.NextForPeer(peer.ID("p"), 10)
@@ -40,7 +47,7 @@ func TestExpireAndEvict(t *testing.T) {
 
 func TestMaxHopsRespected(t *testing.T) {
 	sf := NewStoreAndForward(sfLogger(), 10, time.Minute)
-	env := sf.Enqueue([]byte("x"), 1)
+	env := sf.Enqueue(context.Background(), []byte("x"), 1)
 
 	out := sf.NextForPeer(peer.ID("peer-1"), 10)
 	require.Len(t, out, 1, "expected envelope available")
@@ -66,8 +73,8 @@ func TestDeciderBlocksForwarding(t *testing.T) {
 	g := &gate{allow: 1}
 	sf.SetDecider(g)
 
-	sf.Enqueue([]byte("a"), 2)
-	sf.Enqueue([]byte("b"), 2)
+	sf.Enqueue(context.Background(), []byte("a"), 2)
+	sf.Enqueue(context.Background(), []byte("b"), 2)
 
 	out1 := sf.NextForPeer(peer.ID("p"), 10)
 	require.Len(t, out1, 1, "expected decider to allow only one, got %d", len(out1))
@@ -75,3 +82,43 @@ func TestDeciderBlocksForwarding(t *testing.T) {
 	out2 := sf.NextForPeer(peer.ID("p2"), 10)
 	require.Empty(t, out2, "expected decider to block remaining after budget, got %d", len(out2))
 }
+
+func TestTraceContextSurvivesHops(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		_ = tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+
+	ctx, origin := tracing.Start(context.Background(), "origin")
+	a := NewStoreAndForward(sfLogger(), 10, time.Minute)
+	b := NewStoreAndForward(sfLogger(), 10, time.Minute)
+	a.Enqueue(ctx, []byte("task"), 3)
+	origin.End()
+
+	// a forwards to b, which forwards to c, which processes the task.
+	out := a.NextForPeer(peer.ID("peer-b"), 1)
+	require.Len(t, out, 1)
+	b.Receive(out[0], peer.ID("peer-a"))
+	out = b.NextForPeer(peer.ID("peer-c"), 1)
+	require.Len(t, out, 1)
+	_, process := tracing.Start(out[0].Context(context.Background()), "process")
+	process.End()
+
+	// Every hop's span is a child of the previous one.
+	spans := rec.Ended()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name())
+	}
+	require.Equal(t, []string{"origin", "storeforward.forward", "storeforward.receive", "storeforward.forward", "process"}, names)
+	for i := 1; i < len(spans); i++ {
+		require.Equal(t, origin.SpanContext().TraceID(), spans[i].SpanContext().TraceID(), names[i])
+		require.Equal(t, spans[i-1].SpanContext().SpanID(), spans[i].Parent().SpanID(), "span %d (%s) should be a child of %s", i, names[i], names[i-1])
+	}
+}
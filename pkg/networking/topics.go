@@ -9,6 +9,7 @@ import (
 
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/naviNBRuas/APA/pkg/faults"
 	"github.com/naviNBRuas/APA/pkg/module"
 )
 
@@ -28,6 +29,28 @@ func (p *P2P) IsHeartbeatJoined() bool {
 	return p != nil && p.heartbeatTopic != nil
 }
 
+// SetHeartbeatScale stretches the heartbeat interval by factor, for
+// example to shed load under resource pressure. A factor of 1 or less
+// restores the configured interval. The change applies from the next beat.
+func (p *P2P) SetHeartbeatScale(factor float64) {
+	if factor < 1 {
+		factor = 1
+	}
+	p.mu.Lock()
+	p.heartbeatScale = factor
+	p.mu.Unlock()
+}
+
+// heartbeatInterval returns interval stretched by the heartbeat scale.
+func (p *P2P) heartbeatInterval(interval time.Duration) time.Duration {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.heartbeatScale > 1 {
+		return time.Duration(float64(interval) * p.heartbeatScale)
+	}
+	return interval
+}
+
 // StartHeartbeat starts broadcasting heartbeats.
 func (p *P2P) StartHeartbeat(ctx context.Context, interval time.Duration) {
 	if p.heartbeatTopic == nil {
@@ -35,18 +58,19 @@ func (p *P2P) StartHeartbeat(ctx context.Context, interval time.Duration) {
 		return
 	}
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(p.heartbeatInterval(interval))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			p.logger.Info("Stopping heartbeat")
 			return
-		case <-ticker.C:
+		case <-timer.C:
+			timer.Reset(p.heartbeatInterval(interval))
 			msg := map[string]interface{}{
 				"peer_id": p.host.ID().String(),
-				"time":    time.Now().Unix(),
+				"time":    faults.Now().Unix(),
 			}
 
 			msgBytes, err := json.Marshal(msg)
@@ -55,8 +79,15 @@ func (p *P2P) StartHeartbeat(ctx context.Context, interval time.Duration) {
 				continue
 			}
 
+			if faults.Drop(faults.PubsubPublish, HeartbeatTopic) {
+				p.getMetrics().PubsubMessage(HeartbeatTopic, "dropped")
+				continue
+			}
 			if err := p.heartbeatTopic.Publish(ctx, msgBytes); err != nil {
 				p.logger.Error("Failed to publish heartbeat", "error", err)
+				p.getMetrics().PubsubMessage(HeartbeatTopic, "publish_error")
+			} else {
+				p.getMetrics().PubsubMessage(HeartbeatTopic, "sent")
 			}
 		}
 	}
@@ -75,6 +106,12 @@ func (p *P2P) JoinModuleTopic(ctx context.Context) error {
 
 // AnnounceModule announces a module to the network.
 func (p *P2P) AnnounceModule(ctx context.Context, manifest module.Manifest) error {
+	return p.AnnounceModuleContent(ctx, manifest, "")
+}
+
+// AnnounceModuleContent announces a module whose wasm bytes can be fetched
+// in chunks under the content root.
+func (p *P2P) AnnounceModuleContent(ctx context.Context, manifest module.Manifest, content string) error {
 	if p.moduleTopic == nil {
 		return fmt.Errorf("module topic not joined")
 	}
@@ -82,6 +119,7 @@ func (p *P2P) AnnounceModule(ctx context.Context, manifest module.Manifest) erro
 	msg := ModuleAnnouncementMessage{
 		Manifest:        manifest,
 		AnnouncerPeerID: p.host.ID().String(),
+		Content:         content,
 	}
 
 	msgBytes, err := json.Marshal(msg)
@@ -89,7 +127,7 @@ func (p *P2P) AnnounceModule(ctx context.Context, manifest module.Manifest) erro
 		return fmt.Errorf("failed to marshal module announcement: %w", err)
 	}
 
-	if err := publishWithRetry(ctx, p.logger, p.moduleTopic, msgBytes, "module announcement"); err != nil {
+	if err := p.publish(ctx, p.moduleTopic, msgBytes, "module announcement"); err != nil {
 		return err
 	}
 
@@ -119,7 +157,7 @@ func (p *P2P) PublishControllerMessage(ctx context.Context, msgBytes []byte) err
 		return fmt.Errorf("controller communication topic not joined")
 	}
 
-	return publishWithRetry(ctx, p.logger, p.controllerCommTopic, msgBytes, "controller message")
+	return p.publish(ctx, p.controllerCommTopic, msgBytes, "controller message")
 }
 
 // SubscribeControllerMessages subscribes to controller messages.
@@ -157,6 +195,7 @@ func (p *P2P) SubscribeControllerMessages(ctx context.Context) (<-chan *Controll
 			if msg == nil {
 				continue
 			}
+			p.getMetrics().PubsubMessage(ControllerCommTopic, "received")
 
 			var ctrlMsg ControllerMessage
 			if err := json.Unmarshal(msg.Data, &ctrlMsg); err != nil {
@@ -175,6 +214,7 @@ func (p *P2P) SubscribeControllerMessages(ctx context.Context) (<-chan *Controll
 			case msgCh <- &ctrlMsg:
 			default:
 				p.logger.Warn("Controller message channel full, dropping message")
+				p.getMetrics().PubsubMessage(ControllerCommTopic, "dropped")
 			}
 		}
 	}()
@@ -233,6 +273,7 @@ func (p *P2P) SubscribeLeaderElectionMessages(ctx context.Context) (<-chan *Lead
 			if msg == nil {
 				continue
 			}
+			p.getMetrics().PubsubMessage(LeaderElectionTopic, "received")
 
 			var leMsg LeaderElectionMessage
 			if err := json.Unmarshal(msg.Data, &leMsg); err != nil {
@@ -252,6 +293,7 @@ func (p *P2P) SubscribeLeaderElectionMessages(ctx context.Context) (<-chan *Lead
 			case msgCh <- &leMsg:
 			default:
 				p.logger.Warn("Leader election message channel full, dropping message")
+				p.getMetrics().PubsubMessage(LeaderElectionTopic, "dropped")
 			}
 		}
 	}()
@@ -270,5 +312,97 @@ func (p *P2P) PublishLeaderElectionMessage(ctx context.Context, msg LeaderElecti
 		return fmt.Errorf("failed to marshal leader election message: %w", err)
 	}
 
-	return publishWithRetry(ctx, p.logger, p.leaderElectionTopic, msgBytes, "leader election message")
+	return p.publish(ctx, p.leaderElectionTopic, msgBytes, "leader election message")
+}
+
+// JoinFleetStatusTopic joins the fleet status topic.
+func (p *P2P) JoinFleetStatusTopic(ctx context.Context) error {
+	topic, err := p.pubsub.Join(FleetStatusTopic)
+	if err != nil {
+		return fmt.Errorf("failed to join fleet status topic: %w", err)
+	}
+
+	p.mu.Lock()
+	p.fleetStatusTopic = topic
+	p.mu.Unlock()
+	return nil
+}
+
+// fleetTopic returns the fleet status topic, or nil when it is not joined.
+func (p *P2P) fleetTopic() *pubsub.Topic {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.fleetStatusTopic
+}
+
+// IsFleetStatusJoined reports whether the fleet status topic is active.
+func (p *P2P) IsFleetStatusJoined() bool {
+	return p != nil && p.fleetTopic() != nil
+}
+
+// PublishFleetStatus publishes an encoded fleet status summary.
+func (p *P2P) PublishFleetStatus(ctx context.Context, msgBytes []byte) error {
+	topic := p.fleetTopic()
+	if topic == nil {
+		return fmt.Errorf("fleet status topic not joined")
+	}
+
+	return p.publish(ctx, topic, msgBytes, "fleet status")
+}
+
+// SubscribeFleetStatus subscribes to fleet status summaries published by
+// other agents. Messages from the local host are skipped.
+func (p *P2P) SubscribeFleetStatus(ctx context.Context) (<-chan *FleetStatusMessage, error) {
+	topic := p.fleetTopic()
+	if topic == nil {
+		return nil, fmt.Errorf("fleet status topic not joined")
+	}
+
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to fleet status: %w", err)
+	}
+
+	msgCh := make(chan *FleetStatusMessage, 32)
+
+	go func() {
+		defer close(msgCh)
+		defer sub.Cancel()
+
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				if errors.Is(err, context.Canceled) || errors.Is(err, pubsub.ErrSubscriptionCancelled) {
+					return
+				}
+				p.logger.Error("Failed to read fleet status message", "error", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(200 * time.Millisecond):
+				}
+				continue
+			}
+
+			if msg == nil || msg.ReceivedFrom == p.host.ID() {
+				continue
+			}
+			p.getMetrics().PubsubMessage(FleetStatusTopic, "received")
+
+			peerID, err := peer.IDFromBytes(msg.From)
+			if err != nil {
+				p.logger.Error("Failed to decode peer ID from message", "error", err)
+				continue
+			}
+
+			select {
+			case msgCh <- &FleetStatusMessage{Data: msg.Data, SenderPeerID: peerID.String()}:
+			default:
+				p.logger.Warn("Fleet status channel full, dropping message")
+				p.getMetrics().PubsubMessage(FleetStatusTopic, "dropped")
+			}
+		}
+	}()
+
+	return msgCh, nil
 }
@@ -0,0 +1,162 @@
+package networking
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/network"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/multiformats/go-multihash"
+	"github.com/naviNBRuas/APA/pkg/robustness"
+	"github.com/naviNBRuas/APA/pkg/transfer"
+)
+
+// ContentSource serves manifests and chunks to peers over ChunkProtocol.
+// *transfer.Store implements it.
+type ContentSource interface {
+	Manifest(root string) (*transfer.Manifest, error)
+	Chunk(hash string) ([]byte, error)
+}
+
+type chunkRequest struct {
+	Kind string `json:"kind"` // "manifest" or "chunk"
+	ID   string `json:"id"`   // manifest root or chunk hash
+}
+
+type chunkResponse struct {
+	Manifest *transfer.Manifest `json:"manifest,omitempty"`
+	Data     []byte             `json:"data,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// SetContentSource starts serving content from src over ChunkProtocol.
+func (p *P2P) SetContentSource(src ContentSource) {
+	p.host.SetStreamHandler(ChunkProtocol, func(stream network.Stream) {
+		p.handleChunkRequest(stream, src)
+	})
+}
+
+func (p *P2P) handleChunkRequest(stream network.Stream, src ContentSource) {
+	defer func() { _ = stream.Close() }()
+
+	var request chunkRequest
+	if err := json.NewDecoder(stream).Decode(&request); err != nil {
+		p.logger.Debug("Failed to decode chunk request", "error", err)
+		return
+	}
+
+	var response chunkResponse
+	var err error
+	switch request.Kind {
+	case "manifest":
+		response.Manifest, err = src.Manifest(request.ID)
+	case "chunk":
+		response.Data, err = src.Chunk(request.ID)
+	default:
+		err = fmt.Errorf("unknown request kind %q", request.Kind)
+	}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	if err := json.NewEncoder(stream).Encode(response); err != nil {
+		p.logger.Debug("Failed to encode chunk response", "error", err)
+		return
+	}
+	p.getMetrics().TransferBytes("served", len(response.Data))
+}
+
+func (p *P2P) requestContent(ctx context.Context, peerID peer.ID, request chunkRequest) (*chunkResponse, error) {
+	return robustness.Call(ctx, p.fetchMiddleware(peerID), func(ctx context.Context) (*chunkResponse, error) {
+		stream, err := p.openStream(ctx, peerID, ChunkProtocol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create chunk stream: %w", err)
+		}
+		defer func() { _ = stream.Close() }()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = stream.SetDeadline(deadline)
+		}
+
+		if err := json.NewEncoder(stream).Encode(request); err != nil {
+			return nil, fmt.Errorf("failed to encode chunk request: %w", err)
+		}
+		var response chunkResponse
+		if err := json.NewDecoder(stream).Decode(&response); err != nil {
+			return nil, fmt.Errorf("failed to decode chunk response: %w", err)
+		}
+		if response.Error != "" {
+			// The peer answered; it just does not have the content.
+			return nil, robustness.Permanent(fmt.Errorf("peer returned error: %s", response.Error))
+		}
+		return &response, nil
+	})
+}
+
+// FetchManifest requests the manifest with the given root from a peer.
+func (p *P2P) FetchManifest(ctx context.Context, peerID peer.ID, root string) (*transfer.Manifest, error) {
+	response, err := p.requestContent(ctx, peerID, chunkRequest{Kind: "manifest", ID: root})
+	if err != nil {
+		return nil, err
+	}
+	if response.Manifest == nil {
+		return nil, fmt.Errorf("peer returned no manifest")
+	}
+	return response.Manifest, nil
+}
+
+// FetchChunk requests a chunk by hash from a peer.
+func (p *P2P) FetchChunk(ctx context.Context, peerID peer.ID, hash string) ([]byte, error) {
+	response, err := p.requestContent(ctx, peerID, chunkRequest{Kind: "chunk", ID: hash})
+	if err != nil {
+		return nil, err
+	}
+	return response.Data, nil
+}
+
+// contentCID maps a manifest root to the CID its provider records use.
+func contentCID(root string) (cid.Cid, error) {
+	digest, err := hex.DecodeString(root)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid content root: %w", err)
+	}
+	mh, err := multihash.Encode(digest, multihash.SHA2_256)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("invalid content root: %w", err)
+	}
+	return cid.NewCidV1(cid.Raw, mh), nil
+}
+
+// Provide announces in the DHT that this agent serves the content root.
+func (p *P2P) Provide(ctx context.Context, root string) error {
+	if p == nil || p.dht == nil {
+		return fmt.Errorf("dht not initialized")
+	}
+	c, err := contentCID(root)
+	if err != nil {
+		return err
+	}
+	return p.dht.Provide(ctx, c, true)
+}
+
+// FindProviders looks up at most limit peers that provide the content root.
+func (p *P2P) FindProviders(ctx context.Context, root string, limit int) ([]peer.ID, error) {
+	if p == nil || p.dht == nil {
+		return nil, fmt.Errorf("dht not initialized")
+	}
+	c, err := contentCID(root)
+	if err != nil {
+		return nil, err
+	}
+	var providers []peer.ID
+	for info := range p.dht.FindProvidersAsync(ctx, c, limit) {
+		if info.ID == p.host.ID() {
+			continue
+		}
+		p.host.Peerstore().AddAddrs(info.ID, info.Addrs, peerstore.TempAddrTTL)
+		providers = append(providers, info.ID)
+	}
+	return providers, ctx.Err()
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/libp2p/go-libp2p/core/network"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/naviNBRuas/APA/pkg/robustness"
 	"github.com/naviNBRuas/APA/pkg/update"
 )
 
@@ -20,9 +21,7 @@ func (p *P2P) handleUpdateFetchRequest(stream network.Stream) {
 	defer func() { _ = stream.Close() }()
 
 	decoder := json.NewDecoder(stream)
-	var request struct {
-		Version string `json:"version"`
-	}
+	var request updateFetchRequest
 
 	if err := decoder.Decode(&request); err != nil {
 		p.logger.Error("Failed to decode update fetch request", "error", err)
@@ -31,20 +30,25 @@ func (p *P2P) handleUpdateFetchRequest(stream network.Stream) {
 
 	p.mu.RLock()
 	fuh := p.FetchUpdateHandler
+	fdh := p.FetchUpdateDeltaHandler
 	p.mu.RUnlock()
 	if fuh != nil {
-		release, data, err := fuh(request.Version)
-		if err != nil {
-			p.logger.Error("Failed to fetch update", "error", err)
-			return
+		var response updateFetchResponse
+		if request.BaseSHA256 != "" && fdh != nil {
+			release, delta, err := fdh(request.Version, request.BaseSHA256)
+			if err == nil {
+				response.Release, response.Delta = release, delta
+			} else {
+				p.logger.Debug("No update delta for requester, sending full binary", "error", err)
+			}
 		}
-
-		response := struct {
-			Release *update.ReleaseInfo `json:"release"`
-			Data    []byte              `json:"data"`
-		}{
-			Release: release,
-			Data:    data,
+		if response.Delta == nil {
+			release, data, err := fuh(request.Version)
+			if err != nil {
+				p.logger.Error("Failed to fetch update", "error", err)
+				return
+			}
+			response.Release, response.Data = release, data
 		}
 
 		encoder := json.NewEncoder(stream)
@@ -57,36 +61,63 @@ func (p *P2P) handleUpdateFetchRequest(stream network.Stream) {
 	}
 }
 
+// updateFetchRequest asks a peer for its release. With BaseSHA256 set the
+// peer may answer with a delta against that binary instead of the full one.
+type updateFetchRequest struct {
+	Version    string `json:"version"`
+	BaseSHA256 string `json:"base_sha256,omitempty"`
+}
+
+type updateFetchResponse struct {
+	Release *update.ReleaseInfo `json:"release"`
+	Data    []byte              `json:"data"`
+	Delta   []byte              `json:"delta,omitempty"`
+}
+
 // FetchUpdateFromPeer fetches an update from a specific peer
 func (p *P2P) FetchUpdateFromPeer(ctx context.Context, peerID peer.ID, version string) (*update.ReleaseInfo, []byte, error) {
-	stream, err := p.host.NewStream(ctx, peerID, UpdateFetchProtocol)
+	response, err := p.fetchUpdate(ctx, peerID, updateFetchRequest{Version: version})
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create stream: %w", err)
+		return nil, nil, err
 	}
-	defer func() { _ = stream.Close() }()
+	return response.Release, response.Data, nil
+}
 
-	request := struct {
-		Version string `json:"version"`
-	}{
-		Version: version,
+// FetchUpdateDeltaFromPeer fetches an update from a specific peer, asking
+// for a delta against the binary with SHA-256 baseSHA256. Peers that cannot
+// produce one send the full binary in data.
+func (p *P2P) FetchUpdateDeltaFromPeer(ctx context.Context, peerID peer.ID, version, baseSHA256 string) (*update.ReleaseInfo, []byte, []byte, error) {
+	response, err := p.fetchUpdate(ctx, peerID, updateFetchRequest{Version: version, BaseSHA256: baseSHA256})
+	if err != nil {
+		return nil, nil, nil, err
 	}
+	return response.Release, response.Data, response.Delta, nil
+}
 
-	encoder := json.NewEncoder(stream)
-	if err := encoder.Encode(request); err != nil {
-		return nil, nil, fmt.Errorf("failed to encode request: %w", err)
-	}
+func (p *P2P) fetchUpdate(ctx context.Context, peerID peer.ID, request updateFetchRequest) (*updateFetchResponse, error) {
+	return robustness.Call(ctx, p.fetchMiddleware(peerID), func(ctx context.Context) (*updateFetchResponse, error) {
+		stream, err := p.openStream(ctx, peerID, UpdateFetchProtocol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stream: %w", err)
+		}
+		defer func() { _ = stream.Close() }()
+		if deadline, ok := ctx.Deadline(); ok {
+			_ = stream.SetDeadline(deadline)
+		}
 
-	decoder := json.NewDecoder(stream)
-	var response struct {
-		Release *update.ReleaseInfo `json:"release"`
-		Data    []byte              `json:"data"`
-	}
+		encoder := json.NewEncoder(stream)
+		if err := encoder.Encode(request); err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
 
-	if err := decoder.Decode(&response); err != nil {
-		return nil, nil, fmt.Errorf("failed to decode response: %w", err)
-	}
+		decoder := json.NewDecoder(stream)
+		var response updateFetchResponse
+		if err := decoder.Decode(&response); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
 
-	return response.Release, response.Data, nil
+		return &response, nil
+	})
 }
 
 // RegisterPropagationHandler registers a callback for incoming propagation payloads.
@@ -108,3 +139,11 @@ func (p *P2P) SetFetchUpdateHandler(handler func(version string) (*update.Releas
 	defer p.mu.Unlock()
 	p.FetchUpdateHandler = handler
 }
+
+// SetFetchUpdateDeltaHandler sets the handler that answers update fetch
+// requests carrying a base binary hash with a delta.
+func (p *P2P) SetFetchUpdateDeltaHandler(handler func(version, baseSHA256 string) (*update.ReleaseInfo, []byte, error)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.FetchUpdateDeltaHandler = handler
+}
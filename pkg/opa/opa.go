@@ -6,6 +6,9 @@ import (
 	"os"
 
 	"github.com/open-policy-agent/opa/rego"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
 // OPAPolicyEngine manages OPA policy loading and evaluation.
@@ -49,7 +52,13 @@ func (o *OPAPolicyEngine) LoadPolicy(ctx context.Context, policyPath string) err
 // Authorize evaluates an authorization request against the loaded policy.
 // If no policy is loaded, it defaults to allowing access.
 // input should be a map[string]interface{} representing the authorization context.
-func (o *OPAPolicyEngine) Authorize(ctx context.Context, input map[string]interface{}) (bool, error) {
+func (o *OPAPolicyEngine) Authorize(ctx context.Context, input map[string]interface{}) (allow bool, err error) {
+	ctx, span := tracing.Start(ctx, "opa.Authorize", attribute.Bool("opa.policy_loaded", o.loaded))
+	defer func() {
+		span.SetAttributes(attribute.Bool("opa.allowed", allow))
+		tracing.End(span, err)
+	}()
+
 	// If no policy is loaded, allow by default
 	if !o.loaded {
 		return true, nil
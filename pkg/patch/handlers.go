@@ -0,0 +1,255 @@
+package patch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/mod/semver"
+
+	"github.com/naviNBRuas/APA/pkg/module"
+)
+
+// FileHandler patches files in Dir, such as drivers. The patch Name is the
+// file name and Content its new contents. The version of the last patch
+// applied to a file is kept next to it in .<name>.version.
+type FileHandler struct {
+	Dir string
+}
+
+const versionSuffix = ".version"
+
+func (h FileHandler) versionPath(name string) string {
+	return filepath.Join(h.Dir, "."+name+versionSuffix)
+}
+
+// Versions returns the version last applied to each patched file in Dir.
+func (h FileHandler) Versions() (map[string]string, error) {
+	entries, err := os.ReadDir(h.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", h.Dir, err)
+	}
+	versions := make(map[string]string)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, ".") || !strings.HasSuffix(name, versionSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(h.Dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		versions[strings.TrimSuffix(strings.TrimPrefix(name, "."), versionSuffix)] = strings.TrimSpace(string(data))
+	}
+	return versions, nil
+}
+
+func (h FileHandler) path(patch *Patch) (string, error) {
+	if patch.Name == "" || patch.Name != filepath.Base(patch.Name) || strings.HasPrefix(patch.Name, ".") {
+		return "", fmt.Errorf("invalid file name %q", patch.Name)
+	}
+	return filepath.Join(h.Dir, patch.Name), nil
+}
+
+// Backup returns the current file contents, or nil if the file does not exist.
+func (h FileHandler) Backup(ctx context.Context, patch *Patch) ([]byte, error) {
+	path, err := h.path(patch)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if data == nil {
+		data = []byte{}
+	}
+	return data, nil
+}
+
+// Apply replaces the file with the patch content and records its version.
+func (h FileHandler) Apply(ctx context.Context, patch *Patch) error {
+	path, err := h.path(patch)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, patch.Content); err != nil {
+		return err
+	}
+	return writeFileAtomic(h.versionPath(patch.Name), []byte(patch.Version+"\n"))
+}
+
+// Restore writes the backup back, or removes the file if there was none.
+func (h FileHandler) Restore(ctx context.Context, patch *Patch, backup []byte) error {
+	path, err := h.path(patch)
+	if err != nil {
+		return err
+	}
+	if backup == nil {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		return nil
+	}
+	return writeFileAtomic(path, backup)
+}
+
+// Verify checks that the file still holds the patch content.
+func (h FileHandler) Verify(ctx context.Context, patch *Patch) error {
+	path, err := h.path(patch)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != patch.Hash {
+		return fmt.Errorf("%s was modified after patching", path)
+	}
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".patch-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set mode of %s: %w", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// BinaryStager stages a new agent binary to be installed on restart.
+// *update.Manager implements it.
+type BinaryStager interface {
+	StageBinary(version string, data []byte) error
+	DiscardStaged() error
+}
+
+// AgentHandler patches the agent core. The patch Content is a complete agent
+// binary, staged like a verified update so it is installed on the next
+// restart and put on probation.
+type AgentHandler struct {
+	Stager BinaryStager
+}
+
+// Backup returns nothing: the update manager keeps the running binary.
+func (h AgentHandler) Backup(ctx context.Context, patch *Patch) ([]byte, error) {
+	return nil, nil
+}
+
+// Apply stages the patched binary.
+func (h AgentHandler) Apply(ctx context.Context, patch *Patch) error {
+	return h.Stager.StageBinary(patch.Version, patch.Content)
+}
+
+// Restore discards the staged binary.
+func (h AgentHandler) Restore(ctx context.Context, patch *Patch, backup []byte) error {
+	return h.Stager.DiscardStaged()
+}
+
+// ModuleStore loads and replaces wasm modules. *module.Manager implements it.
+type ModuleStore interface {
+	ListModules() []*module.Manifest
+	HasModule(name, version string) bool
+	GetModuleData(name, version string) (*module.Manifest, []byte, error)
+	StopModule(name string) error
+	SaveAndLoadModule(manifest *module.Manifest, wasm []byte) error
+}
+
+// ModuleHandler patches a loaded wasm module. The patch Name is the module
+// name, Version its new version and Content its new wasm bytes; everything
+// else in the manifest is kept.
+type ModuleHandler struct {
+	Modules ModuleStore
+}
+
+type moduleBackup struct {
+	Manifest *module.Manifest `json:"manifest"`
+	Wasm     []byte           `json:"wasm"`
+}
+
+func (h ModuleHandler) current(name string) (*module.Manifest, error) {
+	for _, m := range h.Modules.ListModules() {
+		if m.Name == name {
+			return m, nil
+		}
+	}
+	return nil, fmt.Errorf("module %s not loaded", name)
+}
+
+// Backup returns the loaded module's manifest and wasm bytes.
+func (h ModuleHandler) Backup(ctx context.Context, patch *Patch) ([]byte, error) {
+	current, err := h.current(patch.Name)
+	if err != nil {
+		return nil, err
+	}
+	manifest, wasm, err := h.Modules.GetModuleData(current.Name, current.Version)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(moduleBackup{Manifest: manifest, Wasm: wasm})
+}
+
+// Apply stops the module and loads the patched version in its place. It
+// refuses a patch that is not newer than the loaded version.
+func (h ModuleHandler) Apply(ctx context.Context, patch *Patch) error {
+	current, err := h.current(patch.Name)
+	if err != nil {
+		return err
+	}
+	if semver.Compare(canonicalVersion(patch.Version), canonicalVersion(current.Version)) <= 0 {
+		return fmt.Errorf("%w: module %s %s is at %s", ErrStaleVersion, patch.Name, patch.Version, current.Version)
+	}
+	manifest := *current
+	manifest.Version = patch.Version
+	manifest.Hash = patch.Hash
+	manifest.WasmURL = ""
+	manifest.Signatures = nil
+	_ = h.Modules.StopModule(patch.Name)
+	return h.Modules.SaveAndLoadModule(&manifest, patch.Content)
+}
+
+// Restore loads the backed up module again.
+func (h ModuleHandler) Restore(ctx context.Context, patch *Patch, backup []byte) error {
+	var b moduleBackup
+	if err := json.Unmarshal(backup, &b); err != nil || b.Manifest == nil {
+		return fmt.Errorf("invalid module backup for %s", patch.Name)
+	}
+	b.Manifest.Signatures = nil
+	_ = h.Modules.StopModule(patch.Name)
+	return h.Modules.SaveAndLoadModule(b.Manifest, b.Wasm)
+}
+
+// Verify checks that the patched version is loaded.
+func (h ModuleHandler) Verify(ctx context.Context, patch *Patch) error {
+	if !h.Modules.HasModule(patch.Name, patch.Version) {
+		return fmt.Errorf("module %s %s not loaded", patch.Name, patch.Version)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package patch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileHandlerApplyAndRollback(t *testing.T) {
+	dir := t.TempDir()
+	pm, _ := newTestManager()
+	pm.RegisterHandler("driver", FileHandler{Dir: dir})
+	path := filepath.Join(dir, "netdrv.so")
+	require.NoError(t, os.WriteFile(path, []byte("v1"), 0644))
+
+	p := newValidPatch("p1", "netdrv.so", "high", "driver")
+	require.NoError(t, pm.AddPatch(p))
+	require.NoError(t, pm.ApplyPatch(context.Background(), "p1"))
+	got, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, p.Content, got)
+	require.NoError(t, pm.VerifyPatch("p1"))
+	versions, err := FileHandler{Dir: dir}.Versions()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"netdrv.so": "1.0.0"}, versions)
+
+	require.NoError(t, os.WriteFile(path, []byte("tampered"), 0644))
+	require.ErrorContains(t, pm.VerifyPatch("p1"), "modified")
+
+	require.NoError(t, pm.RollbackPatch(context.Background(), "p1"))
+	got, err = os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), got)
+
+	// A file that did not exist before the patch is removed on rollback.
+	fresh := newValidPatch("p2", "new.so", "low", "driver")
+	require.NoError(t, pm.AddPatch(fresh))
+	require.NoError(t, pm.ApplyPatch(context.Background(), "p2"))
+	require.NoError(t, pm.RollbackPatch(context.Background(), "p2"))
+	require.NoFileExists(t, filepath.Join(dir, "new.so"))
+}
+
+func TestFileHandlerRejectsPaths(t *testing.T) {
+	h := FileHandler{Dir: t.TempDir()}
+	for _, name := range []string{"", "../escape", "sub/file", ".hidden", ".."} {
+		require.Error(t, h.Apply(context.Background(), &Patch{Name: name}), name)
+	}
+}
+
+type fakeStager struct {
+	staged  []byte
+	version string
+}
+
+func (s *fakeStager) StageBinary(version string, data []byte) error {
+	s.version, s.staged = version, data
+	return nil
+}
+
+func (s *fakeStager) DiscardStaged() error {
+	s.version, s.staged = "", nil
+	return nil
+}
+
+func TestAgentHandlerStagesBinary(t *testing.T) {
+	stager := &fakeStager{}
+	pm, _ := newTestManager()
+	pm.RegisterHandler("agent", AgentHandler{Stager: stager})
+
+	p := newValidPatch("p1", "agentd", "critical", "agent")
+	require.NoError(t, pm.AddPatch(p))
+	require.NoError(t, pm.ApplyPatch(context.Background(), "p1"))
+	require.Equal(t, p.Content, stager.staged)
+	require.Equal(t, "1.0.0", stager.version)
+
+	require.NoError(t, pm.RollbackPatch(context.Background(), "p1"))
+	require.Nil(t, stager.staged)
+}
+
+// fakeModules holds one wasm module per name.
+type fakeModules struct {
+	loaded  map[string]*module.Manifest
+	wasm    map[string][]byte
+	failFor string
+}
+
+func (f *fakeModules) ListModules() []*module.Manifest {
+	var out []*module.Manifest
+	for _, m := range f.loaded {
+		out = append(out, m)
+	}
+	return out
+}
+
+func (f *fakeModules) HasModule(name, version string) bool {
+	m, ok := f.loaded[name]
+	return ok && m.Version == version
+}
+
+func (f *fakeModules) GetModuleData(name, version string) (*module.Manifest, []byte, error) {
+	if !f.HasModule(name, version) {
+		return nil, nil, errors.New("not found")
+	}
+	return f.loaded[name], f.wasm[name], nil
+}
+
+func (f *fakeModules) StopModule(name string) error {
+	delete(f.loaded, name)
+	return nil
+}
+
+func (f *fakeModules) SaveAndLoadModule(manifest *module.Manifest, wasm []byte) error {
+	if manifest.Version == f.failFor {
+		return errors.New("failed to compile")
+	}
+	f.loaded[manifest.Name], f.wasm[manifest.Name] = manifest, wasm
+	return nil
+}
+
+func TestModuleHandlerReplacesModule(t *testing.T) {
+	modules := &fakeModules{
+		loaded: map[string]*module.Manifest{"scanner": {Name: "scanner", Version: "0.9.0", WasmFile: "scanner.wasm", Entry: "run"}},
+		wasm:   map[string][]byte{"scanner": []byte("old wasm")},
+	}
+	pm, _ := newTestManager()
+	pm.RegisterHandler("module", ModuleHandler{Modules: modules})
+
+	p := newValidPatch("p1", "scanner", "high", "module")
+	require.NoError(t, pm.AddPatch(p))
+	require.NoError(t, pm.ApplyPatch(context.Background(), "p1"))
+	require.Equal(t, "1.0.0", modules.loaded["scanner"].Version)
+	require.Equal(t, p.Hash, modules.loaded["scanner"].Hash)
+	require.Equal(t, "run", modules.loaded["scanner"].Entry)
+	require.NoError(t, pm.VerifyPatch("p1"))
+
+	require.NoError(t, pm.RollbackPatch(context.Background(), "p1"))
+	require.Equal(t, "0.9.0", modules.loaded["scanner"].Version)
+	require.Equal(t, []byte("old wasm"), modules.wasm["scanner"])
+
+	// A module that fails to load is replaced by the previous version.
+	modules.failFor = "1.0.0"
+	require.Error(t, pm.ApplyPatch(context.Background(), "p1"))
+	require.Equal(t, "0.9.0", modules.loaded["scanner"].Version)
+
+	// The loaded version is checked even when the manager has no record,
+	// e.g. for a module loaded after the patch manager was seeded.
+	modules.failFor = ""
+	stale := newValidPatch("p3", "scanner", "high", "module")
+	stale.Version = "0.9.0"
+	SignPatch(stale, testKey)
+	fresh, _ := newTestManager()
+	fresh.RegisterHandler("module", ModuleHandler{Modules: modules})
+	require.NoError(t, fresh.AddPatch(stale))
+	require.ErrorIs(t, fresh.ApplyPatch(context.Background(), "p3"), ErrStaleVersion)
+	require.Equal(t, "0.9.0", modules.loaded["scanner"].Version)
+	require.Equal(t, []byte("old wasm"), modules.wasm["scanner"])
+
+	missing := newValidPatch("p2", "absent", "low", "module")
+	require.NoError(t, pm.AddPatch(missing))
+	require.ErrorContains(t, pm.ApplyPatch(context.Background(), "p2"), "not loaded")
+}
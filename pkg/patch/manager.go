@@ -2,34 +2,182 @@ package patch
 
 import (
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sort"
+	"sync"
 	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/mod/semver"
+)
+
+var (
+	// ErrAlreadyApplied is returned by ApplyPatch for a patch that is applied.
+	ErrAlreadyApplied = errors.New("patch already applied")
+	// ErrExpired is returned for a patch past its signed expiry.
+	ErrExpired = errors.New("patch expired")
+	// ErrStaleVersion is returned for a patch whose version is not newer
+	// than the one applied to the same target.
+	ErrStaleVersion = errors.New("patch version not newer than applied version")
 )
 
 // Patch represents a software patch
 type Patch struct {
 	ID          string    `json:"id"`
 	Name        string    `json:"name"`
-	Version     string    `json:"version"`
+	Version     string    `json:"version"` // semantic version after patching
 	Description string    `json:"description"`
 	Severity    string    `json:"severity"` // critical, high, medium, low
 	Target      string    `json:"target"`   // module, agent, driver
 	Content     []byte    `json:"content"`
 	Hash        string    `json:"hash"`
-	Signature   string    `json:"signature"`
+	Signature   string    `json:"signature"` // hex ed25519 signature over SigningDigest
 	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at"` // the patch is refused after this
+}
+
+// SigningDigest returns the SHA-256 of every field except Content, which is
+// covered by Hash, and Signature itself.
+func (p *Patch) SigningDigest() []byte {
+	signed, _ := json.Marshal(struct {
+		ID          string    `json:"id"`
+		Name        string    `json:"name"`
+		Version     string    `json:"version"`
+		Description string    `json:"description"`
+		Severity    string    `json:"severity"`
+		Target      string    `json:"target"`
+		Hash        string    `json:"hash"`
+		CreatedAt   time.Time `json:"created_at"`
+		ExpiresAt   time.Time `json:"expires_at"`
+	}{p.ID, p.Name, p.Version, p.Description, p.Severity, p.Target, p.Hash, p.CreatedAt, p.ExpiresAt})
+	digest := sha256.Sum256(signed)
+	return digest[:]
+}
+
+// versionKey names what a patch replaces. Agent patches all replace the one
+// agent binary, so their Name is not part of the key.
+func (p *Patch) versionKey() string {
+	if p.Target == "agent" {
+		return p.Target
+	}
+	return p.Target + "/" + p.Name
+}
+
+// canonicalVersion returns v as a semver string with the "v" prefix.
+func canonicalVersion(v string) string {
+	if v != "" && v[0] != 'v' {
+		v = "v" + v
+	}
+	return v
+}
+
+// SignPatch sets the patch's Hash from its Content and signs it with a
+// publisher key.
+func SignPatch(patch *Patch, key ed25519.PrivateKey) {
+	hash := sha256.Sum256(patch.Content)
+	patch.Hash = hex.EncodeToString(hash[:])
+	patch.Signature = hex.EncodeToString(ed25519.Sign(key, patch.SigningDigest()))
+}
+
+// Config controls patch distribution.
+type Config struct {
+	Enabled     bool     `yaml:"enabled"`
+	TrustedKeys []string `yaml:"trusted_keys"` // hex ed25519 publisher keys
+	DriverDir   string   `yaml:"driver_dir"`   // defaults to "drivers"
 }
 
+// WithDefaults fills unset fields.
+func (c Config) WithDefaults() Config {
+	if c.DriverDir == "" {
+		c.DriverDir = "drivers"
+	}
+	return c
+}
+
+// ParseKeys decodes hex ed25519 public keys.
+func ParseKeys(hexKeys []string) ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(hexKeys))
+	for _, k := range hexKeys {
+		raw, err := hex.DecodeString(k)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode trusted key: %w", err)
+		}
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid trusted key size")
+		}
+		keys = append(keys, raw)
+	}
+	return keys, nil
+}
+
+// Handler applies patches to one kind of target. Backup captures whatever
+// Restore needs to undo Apply.
+type Handler interface {
+	Backup(ctx context.Context, patch *Patch) ([]byte, error)
+	Apply(ctx context.Context, patch *Patch) error
+	Restore(ctx context.Context, patch *Patch, backup []byte) error
+}
+
+// Verifier is implemented by handlers that can check that an applied patch
+// is still in place.
+type Verifier interface {
+	Verify(ctx context.Context, patch *Patch) error
+}
+
+// Delivery statuses reported by DistributePatch.
+const (
+	DeliveryApplied     = "applied"     // the peer verified and applied the patch
+	DeliveryRejected    = "rejected"    // the peer refused the patch, e.g. a bad signature
+	DeliveryFailed      = "failed"      // applying failed and the peer restored its backup
+	DeliveryUnreachable = "unreachable" // the patch could not be delivered
+)
+
+// DeliveryResult is a peer's acknowledgement of a patch.
+type DeliveryResult struct {
+	Peer    string `json:"peer,omitempty"`
+	PatchID string `json:"patch_id"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Transport delivers a patch to a peer and returns its acknowledgement.
+// networking.P2P implements it over a libp2p stream protocol.
+type Transport interface {
+	SendPatch(ctx context.Context, peerID peer.ID, patch *Patch) (*DeliveryResult, error)
+}
+
+// VersionState keeps the versions applied by patches across restarts. The
+// agent state store implements it.
+type VersionState interface {
+	Get(key string, value interface{}) error
+	SetAndSave(key string, value interface{}) error
+}
+
+// versionsStateKey is where applied versions are kept in the VersionState.
+const versionsStateKey = "patch/versions"
+
+// distributeParallelism bounds concurrent deliveries in DistributePatch.
+const distributeParallelism = 8
+
 // PatchManager handles patch management
 type PatchManager struct {
 	logger         *slog.Logger
 	patches        map[string]*Patch
 	appliedPatches map[string]*Patch
 	patchBackups   map[string][]byte // Store backups of patched components
+	trustedKeys    []ed25519.PublicKey
+	versions       map[string]string // highest applied version per versionKey
+	state          VersionState
+	handlers       map[string]Handler
+	transport      Transport
+	mu             sync.Mutex
+	applyMu        sync.Mutex // serializes ApplyPatch and RollbackPatch
 }
 
 // NewPatchManager creates a new patch manager
@@ -39,7 +187,87 @@ func NewPatchManager(logger *slog.Logger) *PatchManager {
 		patches:        make(map[string]*Patch),
 		appliedPatches: make(map[string]*Patch),
 		patchBackups:   make(map[string][]byte),
+		versions:       make(map[string]string),
+		handlers:       make(map[string]Handler),
+	}
+}
+
+// SetTrustedKeys sets the publisher keys patches must be signed with. No
+// patch is accepted until at least one key is set.
+func (pm *PatchManager) SetTrustedKeys(keys ...ed25519.PublicKey) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.trustedKeys = keys
+}
+
+// SetCurrentVersion records the version target and name already run, so
+// patches at or below it are refused. Agent patches use the agent's own
+// version; name is ignored for them.
+func (pm *PatchManager) SetCurrentVersion(target, name, version string) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.raiseVersionLocked((&Patch{Target: target, Name: name}).versionKey(), version)
+}
+
+// SetState sets where applied versions are kept, and raises the recorded
+// versions to those kept by a previous run, so that a restarted agent still
+// refuses the patches it refused before.
+func (pm *PatchManager) SetState(state VersionState) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.state = state
+	var stored map[string]string
+	if err := state.Get(versionsStateKey, &stored); err != nil {
+		return
+	}
+	for key, version := range stored {
+		pm.raiseVersionLocked(key, version)
+	}
+}
+
+// saveVersionsLocked writes the recorded versions to the state, if one is
+// set.
+func (pm *PatchManager) saveVersionsLocked() {
+	if pm.state == nil {
+		return
+	}
+	if err := pm.state.SetAndSave(versionsStateKey, pm.versions); err != nil {
+		pm.logger.Error("Failed to persist applied patch versions", "error", err)
+	}
+}
+
+// raiseVersionLocked records version for key unless a newer one is recorded.
+func (pm *PatchManager) raiseVersionLocked(key, version string) {
+	v := canonicalVersion(version)
+	if !semver.IsValid(v) {
+		return
 	}
+	if cur, ok := pm.versions[key]; !ok || semver.Compare(v, cur) > 0 {
+		pm.versions[key] = v
+	}
+}
+
+// checkVersionLocked refuses a patch that does not move its target to a
+// newer version, so an old signed patch cannot be replayed to downgrade it.
+func (pm *PatchManager) checkVersionLocked(patch *Patch) error {
+	if cur, ok := pm.versions[patch.versionKey()]; ok && semver.Compare(canonicalVersion(patch.Version), cur) <= 0 {
+		return fmt.Errorf("%w: %s %s is at %s", ErrStaleVersion, patch.Target, patch.Version, cur)
+	}
+	return nil
+}
+
+// RegisterHandler sets the handler that applies patches for target.
+func (pm *PatchManager) RegisterHandler(target string, h Handler) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.handlers[target] = h
+}
+
+// SetTransport sets how DistributePatch delivers patches.
+func (pm *PatchManager) SetTransport(t Transport) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.transport = t
 }
 
 // AddPatch adds a patch to the manager
@@ -49,12 +277,27 @@ func (pm *PatchManager) AddPatch(patch *Patch) error {
 		return fmt.Errorf("patch integrity verification failed: %w", err)
 	}
 
+	pm.mu.Lock()
+	applied, ok := pm.appliedPatches[patch.ID]
+	if ok && applied.Hash != patch.Hash {
+		pm.mu.Unlock()
+		return fmt.Errorf("patch %s is applied with different content", patch.ID)
+	}
+	if !ok {
+		if err := pm.checkVersionLocked(patch); err != nil {
+			pm.mu.Unlock()
+			return err
+		}
+	}
 	pm.patches[patch.ID] = patch
+	pm.mu.Unlock()
+
 	pm.logger.Info("Added patch", "id", patch.ID, "name", patch.Name, "version", patch.Version)
 	return nil
 }
 
-// verifyPatchIntegrity verifies the integrity of a patch
+// verifyPatchIntegrity verifies the integrity of a patch, its signature by a
+// trusted publisher, its version and its expiry.
 func (pm *PatchManager) verifyPatchIntegrity(patch *Patch) error {
 	hasher := sha256.New()
 	hasher.Write(patch.Content)
@@ -64,65 +307,131 @@ func (pm *PatchManager) verifyPatchIntegrity(patch *Patch) error {
 		return fmt.Errorf("hash mismatch: expected %s, got %s", patch.Hash, calculatedHash)
 	}
 
+	pm.mu.Lock()
+	keys := pm.trustedKeys
+	pm.mu.Unlock()
+	if len(keys) == 0 {
+		return fmt.Errorf("no trusted patch keys configured")
+	}
+	sig, err := hex.DecodeString(patch.Signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid signature encoding")
+	}
+	digest := patch.SigningDigest()
+	trusted := false
+	for _, key := range keys {
+		if ed25519.Verify(key, digest, sig) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("signature not made by a trusted key")
+	}
+	if !semver.IsValid(canonicalVersion(patch.Version)) {
+		return fmt.Errorf("invalid patch version %q", patch.Version)
+	}
+	if patch.ExpiresAt.IsZero() {
+		return fmt.Errorf("patch has no expiry")
+	}
+	if time.Now().After(patch.ExpiresAt) {
+		return fmt.Errorf("%w at %s", ErrExpired, patch.ExpiresAt.Format(time.RFC3339))
+	}
 	return nil
 }
 
-// ApplyPatch applies a patch to the target
+// ApplyPatch applies a patch to the target. If the handler fails, the
+// backup it took is restored.
 func (pm *PatchManager) ApplyPatch(ctx context.Context, patchID string) error {
+	pm.applyMu.Lock()
+	defer pm.applyMu.Unlock()
+
+	pm.mu.Lock()
 	patch, exists := pm.patches[patchID]
+	_, applied := pm.appliedPatches[patchID]
+	pm.mu.Unlock()
 	if !exists {
 		return fmt.Errorf("patch %s not found", patchID)
 	}
+	if applied {
+		return fmt.Errorf("%w: %s", ErrAlreadyApplied, patchID)
+	}
+	pm.mu.Lock()
+	err := pm.checkVersionLocked(patch)
+	pm.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	handler, err := pm.handler(patch.Target)
+	if err != nil {
+		return err
+	}
 
 	pm.logger.Info("Applying patch", "id", patch.ID, "name", patch.Name, "target", patch.Target)
 
-	backup, err := pm.createBackup(patch.Target, patch.Name)
+	backup, err := handler.Backup(ctx, patch)
 	if err != nil {
 		return fmt.Errorf("failed to create backup: %w", err)
 	}
 
-	pm.patchBackups[patch.ID] = backup
-
-	switch patch.Target {
-	case "module":
-		pm.logger.Info("Applied patch to module", "module", patch.Name)
-	case "agent":
-		pm.logger.Info("Applied patch to agent core")
-	case "driver":
-		pm.logger.Info("Applied patch to driver", "driver", patch.Name)
-	default:
-		return fmt.Errorf("unknown patch target: %s", patch.Target)
+	if err := handler.Apply(ctx, patch); err != nil {
+		if restoreErr := handler.Restore(ctx, patch, backup); restoreErr != nil {
+			pm.logger.Error("Failed to restore backup after failed patch", "id", patch.ID, "error", restoreErr)
+		}
+		return fmt.Errorf("failed to apply patch to %s %s: %w", patch.Target, patch.Name, err)
 	}
 
+	pm.mu.Lock()
+	pm.patchBackups[patch.ID] = backup
 	pm.appliedPatches[patch.ID] = patch
+	pm.raiseVersionLocked(patch.versionKey(), patch.Version)
+	pm.saveVersionsLocked()
+	pm.mu.Unlock()
 	pm.logger.Info("Patch applied successfully", "id", patch.ID)
 
 	return nil
 }
 
-// createBackup creates a backup of the component to be patched
-func (pm *PatchManager) createBackup(target, name string) ([]byte, error) {
-	pm.logger.Info("Creating backup", "target", target, "name", name)
-	return []byte(fmt.Sprintf("backup-%s-%s-%d", target, name, time.Now().Unix())), nil
+func (pm *PatchManager) handler(target string) (Handler, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	h, ok := pm.handlers[target]
+	if !ok {
+		return nil, fmt.Errorf("unknown patch target: %s", target)
+	}
+	return h, nil
 }
 
-// RollbackPatch rolls back a previously applied patch
+// RollbackPatch rolls back a previously applied patch. The patch's version
+// stays recorded, so reapplying the target needs a newer patch.
 func (pm *PatchManager) RollbackPatch(ctx context.Context, patchID string) error {
+	pm.applyMu.Lock()
+	defer pm.applyMu.Unlock()
+
+	pm.mu.Lock()
 	patch, exists := pm.appliedPatches[patchID]
+	backup, hasBackup := pm.patchBackups[patchID]
+	pm.mu.Unlock()
 	if !exists {
 		return fmt.Errorf("patch %s not applied or not found", patchID)
 	}
-
-	backup, exists := pm.patchBackups[patchID]
-	if !exists {
+	if !hasBackup {
 		return fmt.Errorf("backup not found for patch %s", patchID)
 	}
+	handler, err := pm.handler(patch.Target)
+	if err != nil {
+		return err
+	}
 
 	pm.logger.Info("Rolling back patch", "id", patch.ID, "name", patch.Name)
-	pm.logger.Info("Restoring backup", "id", patch.ID, "backup_size", len(backup))
+	if err := handler.Restore(ctx, patch, backup); err != nil {
+		return fmt.Errorf("failed to restore backup: %w", err)
+	}
 
+	pm.mu.Lock()
 	delete(pm.appliedPatches, patch.ID)
 	delete(pm.patchBackups, patchID)
+	pm.mu.Unlock()
 
 	pm.logger.Info("Patch rolled back successfully", "id", patch.ID)
 	return nil
@@ -149,9 +458,11 @@ func (pm *PatchManager) GetPatchesByPriority() []*Patch {
 	var patches []*Patch
 
 	// Collect all patches
+	pm.mu.Lock()
 	for _, patch := range pm.patches {
 		patches = append(patches, patch)
 	}
+	pm.mu.Unlock()
 
 	// Sort by priority (lowest number = highest priority)
 	sort.Slice(patches, func(i, j int) bool {
@@ -166,52 +477,121 @@ func (pm *PatchManager) GetPatchesBySeverity(severity string) []*Patch {
 	var patches []*Patch
 
 	// Collect patches with matching severity
+	pm.mu.Lock()
 	for _, patch := range pm.patches {
 		if patch.Severity == severity {
 			patches = append(patches, patch)
 		}
 	}
+	pm.mu.Unlock()
+
+	return patches
+}
 
+// AppliedPatches returns the applied patches ordered by ID.
+func (pm *PatchManager) AppliedPatches() []*Patch {
+	pm.mu.Lock()
+	patches := make([]*Patch, 0, len(pm.appliedPatches))
+	for _, patch := range pm.appliedPatches {
+		patches = append(patches, patch)
+	}
+	pm.mu.Unlock()
+	sort.Slice(patches, func(i, j int) bool { return patches[i].ID < patches[j].ID })
 	return patches
 }
 
-// DistributePatch distributes a patch to peers in the network
-func (pm *PatchManager) DistributePatch(ctx context.Context, patchID string, peerAddresses []string) error {
+// DistributePatch delivers a patch to peers in the network and returns each
+// peer's acknowledgement, in the order of peerIDs. Peers that could not be
+// reached are reported with DeliveryUnreachable.
+func (pm *PatchManager) DistributePatch(ctx context.Context, patchID string, peerIDs []string) ([]DeliveryResult, error) {
+	pm.mu.Lock()
 	patch, exists := pm.patches[patchID]
+	transport := pm.transport
+	pm.mu.Unlock()
 	if !exists {
-		return fmt.Errorf("patch %s not found", patchID)
+		return nil, fmt.Errorf("patch %s not found", patchID)
+	}
+	if transport == nil && len(peerIDs) > 0 {
+		return nil, fmt.Errorf("no patch transport configured")
 	}
 
-	pm.logger.Info("Distributing patch to peers", "id", patch.ID, "peer_count", len(peerAddresses))
-
-	for _, addr := range peerAddresses {
-		if err := pm.transferPatchToPeer(ctx, patch, addr); err != nil {
-			pm.logger.Error("Failed to transfer patch to peer", "address", addr, "patch_id", patch.ID, "error", err)
-		} else {
-			pm.logger.Info("Successfully transferred patch to peer", "address", addr, "patch_id", patch.ID)
-		}
+	pm.logger.Info("Distributing patch to peers", "id", patch.ID, "peer_count", len(peerIDs))
+
+	results := make([]DeliveryResult, len(peerIDs))
+	sem := make(chan struct{}, distributeParallelism)
+	var wg sync.WaitGroup
+	for i, id := range peerIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = pm.transferPatchToPeer(ctx, transport, patch, id)
+		}(i, id)
 	}
+	wg.Wait()
 
-	return nil
+	return results, nil
 }
 
-// transferPatchToPeer transfers a patch to a specific peer
-func (pm *PatchManager) transferPatchToPeer(ctx context.Context, patch *Patch, peerAddr string) error {
-	pm.logger.Debug("Transferring patch to peer", "address", peerAddr, "patch_id", patch.ID)
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-time.After(50 * time.Millisecond):
+// transferPatchToPeer delivers a patch to a specific peer
+func (pm *PatchManager) transferPatchToPeer(ctx context.Context, transport Transport, patch *Patch, peerID string) DeliveryResult {
+	result := DeliveryResult{Peer: peerID, PatchID: patch.ID, Status: DeliveryUnreachable}
+	id, err := peer.Decode(peerID)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid peer ID: %v", err)
+		return result
 	}
-	return nil
+	ack, err := transport.SendPatch(ctx, id, patch)
+	if err != nil {
+		result.Error = err.Error()
+		pm.logger.Error("Failed to transfer patch to peer", "peer", peerID, "patch_id", patch.ID, "error", err)
+		return result
+	}
+	result.Status, result.Error = ack.Status, ack.Error
+	if result.Status == DeliveryApplied {
+		pm.logger.Info("Peer applied patch", "peer", peerID, "patch_id", patch.ID)
+	} else {
+		pm.logger.Warn("Peer did not apply patch", "peer", peerID, "patch_id", patch.ID, "status", result.Status, "error", result.Error)
+	}
+	return result
+}
+
+// HandleIncoming verifies and applies a patch received from a peer and
+// returns the acknowledgement to send back.
+func (pm *PatchManager) HandleIncoming(ctx context.Context, from string, patch *Patch) DeliveryResult {
+	result := DeliveryResult{PatchID: patch.ID}
+	pm.logger.Info("Received patch", "from", from, "id", patch.ID, "target", patch.Target)
+	if err := pm.AddPatch(patch); err != nil {
+		pm.logger.Warn("Rejected patch", "from", from, "id", patch.ID, "error", err)
+		result.Status, result.Error = DeliveryRejected, err.Error()
+		return result
+	}
+	if err := pm.ApplyPatch(ctx, patch.ID); err != nil && !errors.Is(err, ErrAlreadyApplied) {
+		result.Status, result.Error = DeliveryFailed, err.Error()
+		return result
+	}
+	result.Status = DeliveryApplied
+	return result
 }
 
 // VerifyPatch verifies that a patch has been applied correctly
 func (pm *PatchManager) VerifyPatch(patchID string) error {
-	_, exists := pm.appliedPatches[patchID]
+	pm.mu.Lock()
+	patch, exists := pm.appliedPatches[patchID]
+	var handler Handler
+	if exists {
+		handler = pm.handlers[patch.Target]
+	}
+	pm.mu.Unlock()
 	if !exists {
 		return fmt.Errorf("patch %s not applied", patchID)
 	}
+	if v, ok := handler.(Verifier); ok {
+		if err := v.Verify(context.Background(), patch); err != nil {
+			return fmt.Errorf("patch %s verification failed: %w", patchID, err)
+		}
+	}
 	pm.logger.Info("Patch verification successful", "id", patchID)
 	return nil
 }
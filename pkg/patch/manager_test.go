@@ -1,32 +1,94 @@
 package patch
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"log/slog"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/store"
 )
 
+var testKey = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+
 func newValidPatch(id, name, severity, target string) *Patch {
-	content := []byte(name + " content")
-	hasher := sha256.New()
-	hasher.Write(content)
-	hash := hex.EncodeToString(hasher.Sum(nil))
-	return &Patch{
+	patch := &Patch{
 		ID:        id,
 		Name:      name,
 		Version:   "1.0.0",
 		Severity:  severity,
 		Target:    target,
-		Content:   content,
-		Hash:      hash,
+		Content:   []byte(name + " content"),
 		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(time.Hour),
 	}
+	SignPatch(patch, testKey)
+	return patch
+}
+
+// recordingHandler keeps the applied content in memory.
+type recordingHandler struct {
+	mu       sync.Mutex
+	content  map[string][]byte
+	applyErr error
+}
+
+func newRecordingHandler() *recordingHandler {
+	return &recordingHandler{content: map[string][]byte{}}
+}
+
+func (h *recordingHandler) Backup(ctx context.Context, patch *Patch) ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]byte("backup:"), h.content[patch.Name]...), nil
+}
+
+func (h *recordingHandler) Apply(ctx context.Context, patch *Patch) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.content[patch.Name] = []byte("partial")
+	if h.applyErr != nil {
+		return h.applyErr
+	}
+	h.content[patch.Name] = patch.Content
+	return nil
+}
+
+func (h *recordingHandler) Restore(ctx context.Context, patch *Patch, backup []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.content[patch.Name] = bytes.TrimPrefix(backup, []byte("backup:"))
+	return nil
+}
+
+func (h *recordingHandler) get(name string) []byte {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.content[name]
+}
+
+// newTestManager trusts testKey and records patches for every target.
+func newTestManager() (*PatchManager, *recordingHandler) {
+	pm := NewPatchManager(slog.Default())
+	pm.SetTrustedKeys(testKey.Public().(ed25519.PublicKey))
+	h := newRecordingHandler()
+	for _, target := range []string{"module", "agent", "driver"} {
+		pm.RegisterHandler(target, h)
+	}
+	return pm, h
 }
 
 func TestNewPatchManager(t *testing.T) {
@@ -38,7 +100,7 @@ func TestNewPatchManager(t *testing.T) {
 }
 
 func TestAddPatch_Success(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Test Patch", "medium", "module")
 
 	err := pm.AddPatch(patch)
@@ -47,7 +109,7 @@ func TestAddPatch_Success(t *testing.T) {
 }
 
 func TestAddPatch_HashMismatch(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	patch.Hash = "bad-hash"
 
@@ -58,22 +120,22 @@ func TestAddPatch_HashMismatch(t *testing.T) {
 }
 
 func TestAddPatch_EmptyContent(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
-	hasher := sha256.New()
-	hash := hex.EncodeToString(hasher.Sum(nil))
+	pm, _ := newTestManager()
 	patch := &Patch{
-		ID:      "p-empty",
-		Name:    "Empty",
-		Content: []byte{},
-		Hash:    hash,
+		ID:        "p-empty",
+		Name:      "Empty",
+		Version:   "1.0.0",
+		Content:   []byte{},
+		ExpiresAt: time.Now().Add(time.Hour),
 	}
+	SignPatch(patch, testKey)
 
 	err := pm.AddPatch(patch)
 	assert.NoError(t, err)
 }
 
 func TestApplyPatch_Success(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	require.NoError(t, pm.AddPatch(patch))
 
@@ -84,7 +146,7 @@ func TestApplyPatch_Success(t *testing.T) {
 }
 
 func TestApplyPatch_NotFound(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 
 	err := pm.ApplyPatch(context.Background(), "nonexistent")
 	assert.Error(t, err)
@@ -92,7 +154,7 @@ func TestApplyPatch_NotFound(t *testing.T) {
 }
 
 func TestApplyPatch_AgentTarget(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Agent Fix", "critical", "agent")
 	require.NoError(t, pm.AddPatch(patch))
 
@@ -101,7 +163,7 @@ func TestApplyPatch_AgentTarget(t *testing.T) {
 }
 
 func TestApplyPatch_DriverTarget(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Driver Fix", "high", "driver")
 	require.NoError(t, pm.AddPatch(patch))
 
@@ -110,7 +172,7 @@ func TestApplyPatch_DriverTarget(t *testing.T) {
 }
 
 func TestApplyPatch_UnknownTarget(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Unknown", "medium", "firmware")
 	require.NoError(t, pm.AddPatch(patch))
 
@@ -121,7 +183,7 @@ func TestApplyPatch_UnknownTarget(t *testing.T) {
 }
 
 func TestRollbackPatch_Success(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	require.NoError(t, pm.AddPatch(patch))
 	require.NoError(t, pm.ApplyPatch(context.Background(), "p1"))
@@ -133,7 +195,7 @@ func TestRollbackPatch_Success(t *testing.T) {
 }
 
 func TestRollbackPatch_NotApplied(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 
 	err := pm.RollbackPatch(context.Background(), "p1")
 	assert.Error(t, err)
@@ -141,7 +203,7 @@ func TestRollbackPatch_NotApplied(t *testing.T) {
 }
 
 func TestRollbackPatch_MissingBackup(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	pm.appliedPatches["p1"] = patch
 
@@ -151,7 +213,7 @@ func TestRollbackPatch_MissingBackup(t *testing.T) {
 }
 
 func TestGetPatchPriority(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	tests := []struct {
 		severity string
 		expected int
@@ -171,7 +233,7 @@ func TestGetPatchPriority(t *testing.T) {
 }
 
 func TestGetPatchesByPriority_Sorted(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	require.NoError(t, pm.AddPatch(newValidPatch("p-low", "Low", "low", "module")))
 	require.NoError(t, pm.AddPatch(newValidPatch("p-critical", "Critical", "critical", "module")))
 	require.NoError(t, pm.AddPatch(newValidPatch("p-medium", "Medium", "medium", "module")))
@@ -184,13 +246,13 @@ func TestGetPatchesByPriority_Sorted(t *testing.T) {
 }
 
 func TestGetPatchesByPriority_Empty(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patches := pm.GetPatchesByPriority()
 	assert.Empty(t, patches)
 }
 
 func TestGetPatchesBySeverity(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	require.NoError(t, pm.AddPatch(newValidPatch("p1", "Critical 1", "critical", "module")))
 	require.NoError(t, pm.AddPatch(newValidPatch("p2", "Critical 2", "critical", "agent")))
 	require.NoError(t, pm.AddPatch(newValidPatch("p3", "Medium", "medium", "module")))
@@ -205,46 +267,265 @@ func TestGetPatchesBySeverity(t *testing.T) {
 	assert.Empty(t, none)
 }
 
+// loopbackTransport delivers patches to in-process managers through a JSON
+// round trip, as over the wire.
+type loopbackTransport struct {
+	peers map[peer.ID]*PatchManager
+}
+
+func (l *loopbackTransport) SendPatch(ctx context.Context, id peer.ID, patch *Patch) (*DeliveryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	receiver, ok := l.peers[id]
+	if !ok {
+		return nil, errors.New("connection refused")
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	var received Patch
+	if err := json.Unmarshal(data, &received); err != nil {
+		return nil, err
+	}
+	result := receiver.HandleIncoming(ctx, "sender", &received)
+	return &result, nil
+}
+
+func newTestPeerID(t *testing.T) peer.ID {
+	t.Helper()
+	_, pub, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPublicKey(pub)
+	require.NoError(t, err)
+	return id
+}
+
 func TestDistributePatch_Success(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
+	a, b := newTestPeerID(t), newTestPeerID(t)
+	pa, ha := newTestManager()
+	pb, hb := newTestManager()
+	pm.SetTransport(&loopbackTransport{peers: map[peer.ID]*PatchManager{a: pa, b: pb}})
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	require.NoError(t, pm.AddPatch(patch))
 
-	err := pm.DistributePatch(context.Background(), "p1", []string{"peer1", "peer2"})
-	assert.NoError(t, err)
+	results, err := pm.DistributePatch(context.Background(), "p1", []string{a.String(), b.String()})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	for i, id := range []peer.ID{a, b} {
+		assert.Equal(t, id.String(), results[i].Peer)
+		assert.Equal(t, DeliveryApplied, results[i].Status)
+		assert.Equal(t, "p1", results[i].PatchID)
+	}
+	assert.Equal(t, patch.Content, ha.get("Test"))
+	assert.Equal(t, patch.Content, hb.get("Test"))
+
+	// Delivering again is acknowledged without applying twice.
+	results, err = pm.DistributePatch(context.Background(), "p1", []string{a.String()})
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryApplied, results[0].Status)
+}
+
+func TestDistributePatch_PerPeerResults(t *testing.T) {
+	pm, _ := newTestManager()
+	good, untrusting, broken, down := newTestPeerID(t), newTestPeerID(t), newTestPeerID(t), newTestPeerID(t)
+	pGood, _ := newTestManager()
+	pUntrusting, _ := newTestManager()
+	pUntrusting.SetTrustedKeys(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{9}, ed25519.SeedSize)).Public().(ed25519.PublicKey))
+	pBroken, hBroken := newTestManager()
+	hBroken.content["Test"] = []byte("old")
+	hBroken.applyErr = errors.New("disk full")
+	pm.SetTransport(&loopbackTransport{peers: map[peer.ID]*PatchManager{good: pGood, untrusting: pUntrusting, broken: pBroken}})
+	require.NoError(t, pm.AddPatch(newValidPatch("p1", "Test", "high", "driver")))
+
+	results, err := pm.DistributePatch(context.Background(), "p1", []string{good.String(), untrusting.String(), broken.String(), down.String(), "not-a-peer"})
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+	assert.Equal(t, DeliveryApplied, results[0].Status)
+	assert.Equal(t, DeliveryRejected, results[1].Status)
+	assert.Contains(t, results[1].Error, "trusted key")
+	assert.Equal(t, DeliveryFailed, results[2].Status)
+	assert.Contains(t, results[2].Error, "disk full")
+	assert.Equal(t, []byte("old"), hBroken.get("Test"), "the backup is restored after a failed apply")
+	assert.Equal(t, DeliveryUnreachable, results[3].Status)
+	assert.Equal(t, DeliveryUnreachable, results[4].Status)
+	assert.Contains(t, results[4].Error, "invalid peer ID")
 }
 
 func TestDistributePatch_NotFound(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 
-	err := pm.DistributePatch(context.Background(), "p1", []string{"peer1"})
+	_, err := pm.DistributePatch(context.Background(), "p1", []string{"peer1"})
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "not found")
 }
 
+func TestDistributePatch_NoTransport(t *testing.T) {
+	pm, _ := newTestManager()
+	require.NoError(t, pm.AddPatch(newValidPatch("p1", "Test", "medium", "module")))
+
+	_, err := pm.DistributePatch(context.Background(), "p1", []string{newTestPeerID(t).String()})
+	assert.ErrorContains(t, err, "no patch transport")
+}
+
 func TestDistributePatch_EmptyPeers(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	require.NoError(t, pm.AddPatch(patch))
 
-	err := pm.DistributePatch(context.Background(), "p1", nil)
+	results, err := pm.DistributePatch(context.Background(), "p1", nil)
 	assert.NoError(t, err)
+	assert.Empty(t, results)
 }
 
 func TestDistributePatch_CancelledContext(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
+	id := newTestPeerID(t)
+	receiver, _ := newTestManager()
+	pm.SetTransport(&loopbackTransport{peers: map[peer.ID]*PatchManager{id: receiver}})
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	require.NoError(t, pm.AddPatch(patch))
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	err := pm.DistributePatch(ctx, "p1", []string{"peer1"})
+	results, err := pm.DistributePatch(ctx, "p1", []string{id.String()})
 	assert.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, DeliveryUnreachable, results[0].Status)
+}
+
+func TestAddPatch_Signature(t *testing.T) {
+	untrusted := NewPatchManager(slog.Default())
+	err := untrusted.AddPatch(newValidPatch("p1", "Test", "medium", "module"))
+	assert.ErrorContains(t, err, "no trusted patch keys")
+
+	pm, _ := newTestManager()
+	unsigned := newValidPatch("p1", "Test", "medium", "module")
+	unsigned.Signature = ""
+	assert.ErrorContains(t, pm.AddPatch(unsigned), "invalid signature")
+
+	// Changing any signed field invalidates the signature.
+	retargeted := newValidPatch("p2", "Test", "medium", "module")
+	retargeted.Target = "agent"
+	assert.ErrorContains(t, pm.AddPatch(retargeted), "trusted key")
+
+	// Content swapped together with its hash is caught by the signature.
+	swapped := newValidPatch("p3", "Test", "medium", "module")
+	swapped.Content = []byte("evil")
+	sum := sha256.Sum256(swapped.Content)
+	swapped.Hash = hex.EncodeToString(sum[:])
+	assert.ErrorContains(t, pm.AddPatch(swapped), "trusted key")
+	assert.Empty(t, pm.patches)
+}
+
+func TestAddPatch_Expiry(t *testing.T) {
+	pm, _ := newTestManager()
+
+	expired := newValidPatch("p1", "Test", "medium", "module")
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	SignPatch(expired, testKey)
+	assert.ErrorIs(t, pm.AddPatch(expired), ErrExpired)
+
+	noExpiry := newValidPatch("p2", "Test", "medium", "module")
+	noExpiry.ExpiresAt = time.Time{}
+	SignPatch(noExpiry, testKey)
+	assert.ErrorContains(t, pm.AddPatch(noExpiry), "no expiry")
+
+	// The expiry is signed, so it cannot be extended in transit.
+	extended := newValidPatch("p3", "Test", "medium", "module")
+	extended.ExpiresAt = extended.ExpiresAt.Add(24 * time.Hour)
+	assert.ErrorContains(t, pm.AddPatch(extended), "trusted key")
+	assert.Empty(t, pm.patches)
+}
+
+func TestApplyPatch_RefusesReplayedVersion(t *testing.T) {
+	pm, h := newTestManager()
+	older := newValidPatch("p-old", "Test", "medium", "driver")
+	newer := newValidPatch("p-new", "Test", "medium", "driver")
+	newer.Version = "1.1.0"
+	newer.Content = []byte("Test content 1.1.0")
+	SignPatch(newer, testKey)
+
+	require.NoError(t, pm.AddPatch(older))
+	require.NoError(t, pm.AddPatch(newer))
+	require.NoError(t, pm.ApplyPatch(context.Background(), "p-new"))
+
+	// The older patch was accepted before the newer one was applied, but
+	// applying it now would downgrade the target.
+	assert.ErrorIs(t, pm.ApplyPatch(context.Background(), "p-old"), ErrStaleVersion)
+	assert.Equal(t, newer.Content, h.get("Test"))
+
+	// A replay under a new ID at the same version is refused on receipt.
+	replay := newValidPatch("p-replay", "Test", "medium", "driver")
+	replay.Version = "1.1.0"
+	SignPatch(replay, testKey)
+	result := pm.HandleIncoming(context.Background(), "peer", replay)
+	assert.Equal(t, DeliveryRejected, result.Status)
+	assert.Contains(t, result.Error, ErrStaleVersion.Error())
+
+	// Redelivering the applied patch is still acknowledged.
+	assert.Equal(t, DeliveryApplied, pm.HandleIncoming(context.Background(), "peer", newer).Status)
+
+	// Other names on the same target are tracked separately.
+	require.NoError(t, pm.AddPatch(newValidPatch("p-other", "Other", "medium", "driver")))
+}
+
+func TestApplyPatch_RefusesReplayAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "agent-state.json")
+	state, err := store.New(path, slog.Default())
+	require.NoError(t, err)
+	pm, _ := newTestManager()
+	pm.SetState(state)
+
+	var older []*Patch
+	for _, target := range []string{"module", "driver"} {
+		old := newValidPatch("old-"+target, "Test", "medium", target)
+		older = append(older, old)
+		newer := newValidPatch("new-"+target, "Test", "medium", target)
+		newer.Version = "1.1.0"
+		SignPatch(newer, testKey)
+		require.Equal(t, DeliveryApplied, pm.HandleIncoming(context.Background(), "peer", newer).Status)
+	}
+
+	// After a restart the older, still unexpired patches are refused.
+	state, err = store.New(path, slog.Default())
+	require.NoError(t, err)
+	restarted, h := newTestManager()
+	restarted.SetState(state)
+	for _, old := range older {
+		result := restarted.HandleIncoming(context.Background(), "peer", old)
+		assert.Equal(t, DeliveryRejected, result.Status, old.Target)
+		assert.Contains(t, result.Error, ErrStaleVersion.Error())
+	}
+	assert.Nil(t, h.get("Test"))
+}
+
+func TestApplyPatch_RefusesAgentDowngrade(t *testing.T) {
+	pm, _ := newTestManager()
+	pm.SetCurrentVersion("agent", "", "v1.0.0")
+
+	err := pm.AddPatch(newValidPatch("p1", "agentd", "critical", "agent"))
+	assert.ErrorIs(t, err, ErrStaleVersion)
+
+	upgrade := newValidPatch("p2", "agentd-renamed", "critical", "agent")
+	upgrade.Version = "1.0.1"
+	SignPatch(upgrade, testKey)
+	require.NoError(t, pm.AddPatch(upgrade))
+}
+
+func TestAddPatch_InvalidVersion(t *testing.T) {
+	pm, _ := newTestManager()
+	patch := newValidPatch("p1", "Test", "medium", "module")
+	patch.Version = "latest"
+	SignPatch(patch, testKey)
+	assert.ErrorContains(t, pm.AddPatch(patch), "invalid patch version")
 }
 
 func TestVerifyPatch_Applied(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	require.NoError(t, pm.AddPatch(patch))
 	require.NoError(t, pm.ApplyPatch(context.Background(), "p1"))
@@ -254,7 +535,7 @@ func TestVerifyPatch_Applied(t *testing.T) {
 }
 
 func TestVerifyPatch_NotApplied(t *testing.T) {
-	pm := NewPatchManager(slog.Default())
+	pm, _ := newTestManager()
 	patch := newValidPatch("p1", "Test", "medium", "module")
 	require.NoError(t, pm.AddPatch(patch))
 
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"os"
 
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
+
+	"github.com/naviNBRuas/APA/pkg/metrics"
+	"github.com/naviNBRuas/APA/pkg/tracing"
 )
 
 // PolicyEnforcer defines the interface for enforcing policies.
@@ -16,6 +20,9 @@ type PolicyEnforcer interface {
 // Config holds the policy configuration.
 type Config struct {
 	TrustedAuthors []string `yaml:"trusted_authors"`
+	// RecoveryPeers lists the peer IDs this agent serves recovery requests
+	// to; "*" serves every peer.
+	RecoveryPeers []string `yaml:"recovery_peers"`
 }
 
 // PolicyEnforcerImpl implements the PolicyEnforcer interface.
@@ -50,6 +57,40 @@ func (p *PolicyEnforcerImpl) Authorize(ctx context.Context, subject string, acti
 		// In a real implementation, we would check the module's author against trusted authors
 		return true, "authorized", nil
 	}
+	if action == "serve_recovery" {
+		for _, p := range p.config.RecoveryPeers {
+			if p == "*" || p == subject {
+				return true, "authorized", nil
+			}
+		}
+		return false, "unauthorized: peer not in recovery_peers", nil
+	}
 
 	return false, "unauthorized: action not supported by policy", nil
 }
+
+// InstrumentedEnforcer wraps a PolicyEnforcer, records every decision in the
+// agent metrics registry and traces each evaluation.
+type InstrumentedEnforcer struct {
+	next    PolicyEnforcer
+	metrics *metrics.Metrics
+}
+
+// NewInstrumentedEnforcer returns an enforcer that delegates to next and
+// counts its decisions in m.
+func NewInstrumentedEnforcer(next PolicyEnforcer, m *metrics.Metrics) *InstrumentedEnforcer {
+	return &InstrumentedEnforcer{next: next, metrics: m}
+}
+
+// Authorize delegates to the wrapped enforcer and records the outcome.
+func (e *InstrumentedEnforcer) Authorize(ctx context.Context, subject string, action string, resource string) (bool, string, error) {
+	ctx, span := tracing.Start(ctx, "policy.Authorize",
+		attribute.String("policy.subject", subject),
+		attribute.String("policy.action", action),
+		attribute.String("policy.resource", resource))
+	allowed, reason, err := e.next.Authorize(ctx, subject, action, resource)
+	span.SetAttributes(attribute.Bool("policy.allowed", allowed), attribute.String("policy.reason", reason))
+	tracing.End(span, err)
+	e.metrics.PolicyDecision("policy", action, allowed, err)
+	return allowed, reason, err
+}
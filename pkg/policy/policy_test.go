@@ -117,6 +117,22 @@ func TestAuthorize(t *testing.T) {
 		assert.Equal(t, "authorized", reason)
 	})
 
+	t.Run("serve_recovery limited to recovery peers", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "policy.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("recovery_peers:\n  - \"peer-a\"\n"), 0644))
+		p, err := NewPolicyEnforcer(path)
+		require.NoError(t, err)
+
+		allowed, _, err := p.Authorize(ctx, "peer-a", "serve_recovery", "config")
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+		allowed, reason, err := p.Authorize(ctx, "peer-b", "serve_recovery", "config")
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+		assert.Contains(t, reason, "recovery_peers")
+	})
+
 	t.Run("non-module action with empty policy", func(t *testing.T) {
 		p := createEnforcer(t)
 		allowed, _, err := p.Authorize(ctx, "any", "unknown", "resource")
@@ -47,6 +47,9 @@ type RecoveryController struct {
 	snapshotPath      string
 	quarantineList    map[string]time.Time
 	mu                sync.RWMutex
+
+	// OnQuarantine is called after a node has been added to the quarantine list.
+	OnQuarantine func(nodeID string)
 }
 
 // NewRecoveryController creates a new RecoveryController.
@@ -203,6 +206,9 @@ func (rc *RecoveryController) QuarantineNode(ctx context.Context, nodeID string)
 	rc.logger.Info("Initiating recovery actions for quarantined node", "node", nodeID)
 
 	rc.logger.Info("Node quarantined successfully", "node", nodeID)
+	if rc.OnQuarantine != nil {
+		rc.OnQuarantine(nodeID)
+	}
 	return nil
 }
 
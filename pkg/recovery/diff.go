@@ -0,0 +1,265 @@
+package recovery
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	controllerManifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
+	"github.com/naviNBRuas/APA/pkg/module"
+	"golang.org/x/mod/semver"
+)
+
+// Change kinds reported by a SnapshotDiff.
+const (
+	ChangeAdded      = "added"
+	ChangeRemoved    = "removed"
+	ChangeUpgraded   = "upgraded"
+	ChangeDowngraded = "downgraded"
+	ChangeModified   = "modified" // same version, different hash or settings
+)
+
+// volatileStateKeys are operational state keys that differ in every
+// snapshot and are left out of diffs.
+var volatileStateKeys = map[string]bool{"snapshot_timestamp": true}
+
+// ComponentChange describes a module or controller that differs between two
+// snapshots.
+type ComponentChange struct {
+	Name        string `json:"name"`
+	Change      string `json:"change"`
+	FromVersion string `json:"from_version,omitempty"`
+	ToVersion   string `json:"to_version,omitempty"`
+	FromHash    string `json:"from_hash,omitempty"`
+	ToHash      string `json:"to_hash,omitempty"`
+}
+
+// FieldChange describes a config field or state key that differs between two
+// snapshots. Config fields are named by their dotted path, such as
+// "p2p.listen_addresses".
+type FieldChange struct {
+	Path   string      `json:"path"`
+	Change string      `json:"change"`
+	From   interface{} `json:"from,omitempty"`
+	To     interface{} `json:"to,omitempty"`
+}
+
+// SnapshotDiff lists what changed from one snapshot to another.
+type SnapshotDiff struct {
+	From        time.Time         `json:"from"`
+	To          time.Time         `json:"to"`
+	Modules     []ComponentChange `json:"modules,omitempty"`
+	Controllers []ComponentChange `json:"controllers,omitempty"`
+	Config      []FieldChange     `json:"config,omitempty"`
+	State       []FieldChange     `json:"state,omitempty"`
+}
+
+// Empty reports whether the snapshots are equivalent.
+func (d *SnapshotDiff) Empty() bool {
+	return len(d.Modules) == 0 && len(d.Controllers) == 0 && len(d.Config) == 0 && len(d.State) == 0
+}
+
+// DiffSnapshots compares two snapshots. Config and state are compared as
+// they serialize to JSON, so a snapshot read from disk and one built from
+// the running agent compare equal when nothing changed.
+func DiffSnapshots(from, to *SnapshotData) *SnapshotDiff {
+	diff := &SnapshotDiff{From: from.Timestamp, To: to.Timestamp}
+
+	fromModules := make(map[string]component)
+	for _, m := range from.Modules {
+		if m != nil {
+			fromModules[m.Name] = moduleComponent(m)
+		}
+	}
+	toModules := make(map[string]component)
+	for _, m := range to.Modules {
+		if m != nil {
+			toModules[m.Name] = moduleComponent(m)
+		}
+	}
+	diff.Modules = diffComponents(fromModules, toModules)
+
+	fromControllers := make(map[string]component)
+	for _, c := range from.Controllers {
+		if c != nil {
+			fromControllers[c.Name] = controllerComponent(c)
+		}
+	}
+	toControllers := make(map[string]component)
+	for _, c := range to.Controllers {
+		if c != nil {
+			toControllers[c.Name] = controllerComponent(c)
+		}
+	}
+	diff.Controllers = diffComponents(fromControllers, toControllers)
+
+	diff.Config = diffFields("", normalizeJSON(from.Configuration), normalizeJSON(to.Configuration))
+
+	fromState, _ := normalizeJSON(from.OperationalState).(map[string]interface{})
+	toState, _ := normalizeJSON(to.OperationalState).(map[string]interface{})
+	for key := range volatileStateKeys {
+		delete(fromState, key)
+		delete(toState, key)
+	}
+	// State keys are compared whole rather than field by field.
+	for _, key := range unionKeys(fromState, toState) {
+		if change := diffValue(key, fromState, toState); change != nil {
+			diff.State = append(diff.State, *change)
+		}
+	}
+	return diff
+}
+
+// component is the part of a module or controller manifest a diff compares.
+type component struct {
+	version string
+	hash    string
+	rest    interface{} // every other manifest field
+}
+
+func moduleComponent(m *module.Manifest) component {
+	rest := *m
+	rest.Version, rest.Hash = "", ""
+	return component{version: m.Version, hash: m.Hash, rest: normalizeJSON(rest)}
+}
+
+func controllerComponent(c *controllerManifest.Manifest) component {
+	rest := *c
+	rest.Version, rest.Hash = "", ""
+	return component{version: c.Version, hash: c.Hash, rest: normalizeJSON(rest)}
+}
+
+func diffComponents(from, to map[string]component) []ComponentChange {
+	var changes []ComponentChange
+	for name, old := range from {
+		if _, ok := to[name]; !ok {
+			changes = append(changes, ComponentChange{Name: name, Change: ChangeRemoved, FromVersion: old.version, FromHash: old.hash})
+		}
+	}
+	for name, cur := range to {
+		old, ok := from[name]
+		change := ComponentChange{Name: name, ToVersion: cur.version, ToHash: cur.hash}
+		switch {
+		case !ok:
+			change.Change = ChangeAdded
+		case old.version != cur.version:
+			change.Change = ChangeUpgraded
+			if compareVersions(cur.version, old.version) < 0 {
+				change.Change = ChangeDowngraded
+			}
+		case old.hash != cur.hash || !reflect.DeepEqual(old.rest, cur.rest):
+			change.Change = ChangeModified
+		default:
+			continue
+		}
+		if ok {
+			change.FromVersion, change.FromHash = old.version, old.hash
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// compareVersions compares two versions as semver when both parse, and as
+// strings otherwise.
+func compareVersions(a, b string) int {
+	va, vb := a, b
+	if !strings.HasPrefix(va, "v") {
+		va = "v" + va
+	}
+	if !strings.HasPrefix(vb, "v") {
+		vb = "v" + vb
+	}
+	if semver.IsValid(va) && semver.IsValid(vb) {
+		return semver.Compare(va, vb)
+	}
+	return strings.Compare(a, b)
+}
+
+// diffFields walks two JSON values and reports each leaf that differs.
+// Objects are descended into; anything else, including arrays, is compared
+// whole.
+func diffFields(prefix string, from, to interface{}) []FieldChange {
+	fromMap, fromIsMap := from.(map[string]interface{})
+	toMap, toIsMap := to.(map[string]interface{})
+	if !fromIsMap || !toIsMap {
+		if reflect.DeepEqual(from, to) {
+			return nil
+		}
+		return []FieldChange{fieldChange(prefix, from, to)}
+	}
+	var changes []FieldChange
+	for _, key := range unionKeys(fromMap, toMap) {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		old, inFrom := fromMap[key]
+		cur, inTo := toMap[key]
+		switch {
+		case !inFrom:
+			changes = append(changes, FieldChange{Path: path, Change: ChangeAdded, To: cur})
+		case !inTo:
+			changes = append(changes, FieldChange{Path: path, Change: ChangeRemoved, From: old})
+		default:
+			changes = append(changes, diffFields(path, old, cur)...)
+		}
+	}
+	return changes
+}
+
+func fieldChange(path string, from, to interface{}) FieldChange {
+	switch {
+	case from == nil:
+		return FieldChange{Path: path, Change: ChangeAdded, To: to}
+	case to == nil:
+		return FieldChange{Path: path, Change: ChangeRemoved, From: from}
+	}
+	return FieldChange{Path: path, Change: ChangeModified, From: from, To: to}
+}
+
+// diffValue compares one key of two maps as a whole.
+func diffValue(key string, from, to map[string]interface{}) *FieldChange {
+	old, inFrom := from[key]
+	cur, inTo := to[key]
+	switch {
+	case !inFrom:
+		return &FieldChange{Path: key, Change: ChangeAdded, To: cur}
+	case !inTo:
+		return &FieldChange{Path: key, Change: ChangeRemoved, From: old}
+	case !reflect.DeepEqual(old, cur):
+		return &FieldChange{Path: key, Change: ChangeModified, From: old, To: cur}
+	}
+	return nil
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// normalizeJSON round-trips v through JSON so values of different Go types
+// that serialize the same compare equal.
+func normalizeJSON(v interface{}) interface{} {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package recovery
+
+import (
+	"testing"
+	"time"
+
+	controllerManifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	from := &SnapshotData{
+		Timestamp: time.Unix(100, 0),
+		Configuration: map[string]interface{}{
+			"log_level": "info",
+			"p2p":       map[string]interface{}{"listen": []string{"/ip4/0.0.0.0/tcp/4001"}, "relay": true},
+			"legacy":    "x",
+		},
+		Modules: []*module.Manifest{
+			{Name: "scanner", Version: "1.2.0", Hash: "aa"},
+			{Name: "old", Version: "1.0.0", Hash: "bb"},
+			{Name: "same", Version: "2.0.0", Hash: "cc"},
+			{Name: "rebuilt", Version: "1.0.0", Hash: "dd"},
+			{Name: "rollback", Version: "1.10.0", Hash: "ee"},
+		},
+		Controllers: []*controllerManifest.Manifest{
+			{Name: "ctl", Version: "1.0", Hash: "11", Capabilities: []string{"net"}},
+		},
+		OperationalState: map[string]interface{}{
+			"quarantine_list":    map[string]time.Time{"peer-a": time.Unix(50, 0).UTC()},
+			"snapshot_timestamp": time.Unix(100, 0),
+		},
+	}
+	to := &SnapshotData{
+		Timestamp: time.Unix(200, 0),
+		Configuration: map[string]interface{}{
+			"log_level": "debug",
+			"p2p":       map[string]interface{}{"listen": []string{"/ip4/0.0.0.0/tcp/4002"}, "relay": true},
+			"new":       1,
+		},
+		Modules: []*module.Manifest{
+			{Name: "scanner", Version: "1.10.0", Hash: "ab"},
+			{Name: "same", Version: "2.0.0", Hash: "cc"},
+			{Name: "rebuilt", Version: "1.0.0", Hash: "de"},
+			{Name: "rollback", Version: "1.9.0", Hash: "ef"},
+			{Name: "fresh", Version: "0.1.0", Hash: "ff"},
+		},
+		Controllers: []*controllerManifest.Manifest{
+			{Name: "ctl", Version: "1.0", Hash: "11", Capabilities: []string{"net", "fs"}},
+		},
+		OperationalState: map[string]interface{}{
+			"quarantine_list":    map[string]interface{}{},
+			"snapshot_timestamp": time.Unix(200, 0),
+		},
+	}
+
+	diff := DiffSnapshots(from, to)
+	assert.Equal(t, []ComponentChange{
+		{Name: "fresh", Change: ChangeAdded, ToVersion: "0.1.0", ToHash: "ff"},
+		{Name: "old", Change: ChangeRemoved, FromVersion: "1.0.0", FromHash: "bb"},
+		{Name: "rebuilt", Change: ChangeModified, FromVersion: "1.0.0", ToVersion: "1.0.0", FromHash: "dd", ToHash: "de"},
+		{Name: "rollback", Change: ChangeDowngraded, FromVersion: "1.10.0", ToVersion: "1.9.0", FromHash: "ee", ToHash: "ef"},
+		{Name: "scanner", Change: ChangeUpgraded, FromVersion: "1.2.0", ToVersion: "1.10.0", FromHash: "aa", ToHash: "ab"},
+	}, diff.Modules)
+	assert.Equal(t, []ComponentChange{
+		{Name: "ctl", Change: ChangeModified, FromVersion: "1.0", ToVersion: "1.0", FromHash: "11", ToHash: "11"},
+	}, diff.Controllers)
+	assert.Equal(t, []FieldChange{
+		{Path: "legacy", Change: ChangeRemoved, From: "x"},
+		{Path: "log_level", Change: ChangeModified, From: "info", To: "debug"},
+		{Path: "new", Change: ChangeAdded, To: float64(1)},
+		{Path: "p2p.listen", Change: ChangeModified, From: []interface{}{"/ip4/0.0.0.0/tcp/4001"}, To: []interface{}{"/ip4/0.0.0.0/tcp/4002"}},
+	}, diff.Config)
+	assert.Equal(t, []FieldChange{
+		{Path: "quarantine_list", Change: ChangeModified, From: map[string]interface{}{"peer-a": "1970-01-01T00:00:50Z"}, To: map[string]interface{}{}},
+	}, diff.State, "the snapshot timestamp is not a change")
+	assert.False(t, diff.Empty())
+
+	assert.True(t, DiffSnapshots(from, from).Empty())
+}
+
+func TestCompareVersions(t *testing.T) {
+	assert.Equal(t, 1, compareVersions("1.10.0", "1.9.0"))
+	assert.Equal(t, -1, compareVersions("v1.0.0", "1.0.1"))
+	assert.Equal(t, 0, compareVersions("2.0.0", "v2.0.0"))
+	assert.Equal(t, 1, compareVersions("beta", "alpha"), "non-semver versions compare as strings")
+}
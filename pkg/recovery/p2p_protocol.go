@@ -0,0 +1,134 @@
+package recovery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	controllerManifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
+	"github.com/naviNBRuas/APA/pkg/module"
+)
+
+// Resource types exchanged over the recovery protocol.
+const (
+	ResourceConfig     = "config"
+	ResourceModule     = "module"
+	ResourceController = "controller"
+	ResourceState      = "state"
+	// ResourceInventory asks for the resources a peer can serve. A request
+	// carrying the sender's own inventory in Data offers it in return.
+	ResourceInventory = "inventory"
+)
+
+// recoveryRequestMaxAge bounds the clock skew and age of requests a
+// responder accepts; nonces are remembered for as long.
+const recoveryRequestMaxAge = 5 * time.Minute
+
+// ErrNoQuorum is returned when too few trusted peers agree on the
+// configuration or controller to recover.
+var ErrNoQuorum = errors.New("no quorum of trusted peers agrees")
+
+// RecoveryRequest represents a request for peer-to-peer recovery
+type RecoveryRequest struct {
+	RequesterID  peer.ID   `json:"requester_id"`
+	TargetID     peer.ID   `json:"target_id"`
+	ResourceType string    `json:"resource_type"` // config, module, controller, state, inventory
+	ResourceName string    `json:"resource_name"`
+	Version      string    `json:"version"`
+	Timestamp    time.Time `json:"timestamp"`
+	Priority     string    `json:"priority"` // low, medium, high, critical
+	Nonce        string    `json:"nonce"`
+	Data         []byte    `json:"data,omitempty"`      // the sender's inventory, for inventory requests
+	Signature    []byte    `json:"signature,omitempty"` // by the requester's identity key over SigningDigest
+}
+
+// SigningDigest returns the SHA-256 of the request without its signature.
+func (r *RecoveryRequest) SigningDigest() []byte {
+	signed := *r
+	signed.Signature = nil
+	data, _ := json.Marshal(signed)
+	digest := sha256.Sum256(data)
+	return digest[:]
+}
+
+// Verify checks the signature against the requester's peer ID.
+func (r *RecoveryRequest) Verify() error {
+	return verifyPeerSignature(r.RequesterID, r.SigningDigest(), r.Signature)
+}
+
+// RecoveryResponse represents a response to a recovery request
+type RecoveryResponse struct {
+	RequestID    string                       `json:"request_id"` // the request's nonce
+	ResponderID  peer.ID                      `json:"responder_id"`
+	Success      bool                         `json:"success"`
+	ResourceType string                       `json:"resource_type"`
+	ResourceName string                       `json:"resource_name,omitempty"`
+	Data         []byte                       `json:"data,omitempty"`
+	Hash         string                       `json:"hash,omitempty"` // hex SHA-256 of Data
+	Module       *module.Manifest             `json:"module,omitempty"`
+	Controller   *controllerManifest.Manifest `json:"controller,omitempty"`
+	Error        string                       `json:"error,omitempty"`
+	Timestamp    time.Time                    `json:"timestamp"`
+	Signature    []byte                       `json:"signature,omitempty"` // by the responder's identity key over SigningDigest
+}
+
+// SigningDigest returns the SHA-256 of the response without its signature.
+func (r *RecoveryResponse) SigningDigest() []byte {
+	signed := *r
+	signed.Signature = nil
+	data, _ := json.Marshal(signed)
+	digest := sha256.Sum256(data)
+	return digest[:]
+}
+
+// RecoveryInventory lists the resources a peer can serve.
+type RecoveryInventory struct {
+	ConfigHash  string                         `json:"config_hash,omitempty"`
+	Modules     []*module.Manifest             `json:"modules,omitempty"`
+	Controllers []*controllerManifest.Manifest `json:"controllers,omitempty"`
+	Updated     time.Time                      `json:"updated"`
+}
+
+// RecoveryTransport carries recovery requests to peers and returns their
+// responses. networking.P2P implements it over a libp2p stream protocol.
+type RecoveryTransport interface {
+	RequestRecovery(ctx context.Context, peerID peer.ID, req *RecoveryRequest) (*RecoveryResponse, error)
+}
+
+func signDigest(key crypto.PrivKey, digest []byte) ([]byte, error) {
+	if key == nil {
+		return nil, fmt.Errorf("recovery identity key not configured")
+	}
+	sig, err := key.Sign(digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign recovery message: %w", err)
+	}
+	return sig, nil
+}
+
+// verifyPeerSignature checks sig against the public key embedded in id.
+func verifyPeerSignature(id peer.ID, digest, sig []byte) error {
+	if len(sig) == 0 {
+		return fmt.Errorf("recovery message from %s is not signed", id)
+	}
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("failed to extract public key of %s: %w", id, err)
+	}
+	ok, err := pub.Verify(digest, sig)
+	if err != nil || !ok {
+		return fmt.Errorf("invalid signature from %s", id)
+	}
+	return nil
+}
+
+func hashHex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,420 @@
+package recovery
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	controllerManifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// memTransport delivers requests from one node to the recovery managers of
+// an in-memory network, through JSON as on the wire.
+type memTransport struct {
+	from    peer.ID
+	network map[peer.ID]*P2PRecoveryManager
+}
+
+func (t *memTransport) RequestRecovery(ctx context.Context, peerID peer.ID, req *RecoveryRequest) (*RecoveryResponse, error) {
+	target, ok := t.network[peerID]
+	if !ok {
+		return nil, fmt.Errorf("peer %s unreachable", peerID)
+	}
+	var wireReq RecoveryRequest
+	if err := roundTrip(req, &wireReq); err != nil {
+		return nil, err
+	}
+	var resp RecoveryResponse
+	if err := roundTrip(target.HandleRequest(ctx, t.from, &wireReq), &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func roundTrip(in, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// policyFunc adapts a function to policy.PolicyEnforcer.
+type policyFunc func(subject, action, resource string) bool
+
+func (f policyFunc) Authorize(ctx context.Context, subject, action, resource string) (bool, string, error) {
+	if f(subject, action, resource) {
+		return true, "authorized", nil
+	}
+	return false, "denied by test policy", nil
+}
+
+func allowAll(string, string, string) bool { return true }
+
+func newTestIdentity(t *testing.T) (peer.ID, crypto.PrivKey) {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	return id, priv
+}
+
+// newRecoveryNode adds a recovery manager with its own identity to network.
+func newRecoveryNode(t *testing.T, network map[peer.ID]*P2PRecoveryManager, reputation ReputationService) *P2PRecoveryManager {
+	t.Helper()
+	id, key := newTestIdentity(t)
+	m := NewP2PRecoveryManager(slog.Default(), nil, nil, nil, nil, reputation)
+	m.retryDelay = time.Millisecond
+	m.SetIdentity(id, key)
+	m.SetTransport(&memTransport{from: id, network: network})
+	m.SetPolicyEnforcer(policyFunc(allowAll))
+	network[id] = m
+	return m
+}
+
+// signedRequest builds a request from one node to another the way
+// performRecoveryRequest does.
+func signedRequest(t *testing.T, from, to *P2PRecoveryManager, resourceType string) *RecoveryRequest {
+	t.Helper()
+	req := &RecoveryRequest{
+		RequesterID:  from.selfID,
+		TargetID:     to.selfID,
+		ResourceType: resourceType,
+		Timestamp:    time.Now().UTC(),
+		Nonce:        fmt.Sprintf("nonce-%d", time.Now().UnixNano()),
+	}
+	sig, err := signDigest(from.key, req.SigningDigest())
+	require.NoError(t, err)
+	req.Signature = sig
+	return req
+}
+
+// fakeModuleManager serves and installs modules from memory.
+type fakeModuleManager struct {
+	modules map[string]*module.Manifest
+	data    map[string][]byte
+}
+
+func newFakeModuleManager() *fakeModuleManager {
+	return &fakeModuleManager{modules: make(map[string]*module.Manifest), data: make(map[string][]byte)}
+}
+
+func (f *fakeModuleManager) SaveAndLoadModule(manifest *module.Manifest, wasm []byte) error {
+	f.modules[manifest.Name] = manifest
+	f.data[manifest.Name] = wasm
+	return nil
+}
+
+func (f *fakeModuleManager) ListModules() []*module.Manifest {
+	var out []*module.Manifest
+	for _, m := range f.modules {
+		out = append(out, m)
+	}
+	return out
+}
+
+func (f *fakeModuleManager) StopModule(name string) error {
+	delete(f.modules, name)
+	return nil
+}
+
+func (f *fakeModuleManager) GetModuleData(name, version string) (*module.Manifest, []byte, error) {
+	m, ok := f.modules[name]
+	if !ok || m.Version != version {
+		return nil, nil, fmt.Errorf("module %s version %s not found", name, version)
+	}
+	return m, f.data[name], nil
+}
+
+// fakeControllerManager lists, serves and installs controllers from
+// memory. A controller in served is handed out in place of the listed one.
+type fakeControllerManager struct {
+	controllers map[string]*controllerManifest.Manifest
+	data        map[string][]byte
+	served      map[string]*controllerManifest.Manifest
+}
+
+func newFakeControllerManager() *fakeControllerManager {
+	return &fakeControllerManager{
+		controllers: make(map[string]*controllerManifest.Manifest),
+		data:        make(map[string][]byte),
+		served:      make(map[string]*controllerManifest.Manifest),
+	}
+}
+
+func (f *fakeControllerManager) ListControllers() []*controllerManifest.Manifest {
+	var out []*controllerManifest.Manifest
+	for _, c := range f.controllers {
+		out = append(out, c)
+	}
+	return out
+}
+
+func (f *fakeControllerManager) StopController(ctx context.Context, name string) error {
+	delete(f.controllers, name)
+	return nil
+}
+
+func (f *fakeControllerManager) ControllerData(name string) (*controllerManifest.Manifest, []byte, error) {
+	if c, ok := f.served[name]; ok {
+		return c, f.data[c.Hash], nil
+	}
+	c, ok := f.controllers[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("controller '%s' not found", name)
+	}
+	return c, f.data[c.Hash], nil
+}
+
+func (f *fakeControllerManager) SaveAndLoadController(manifest *controllerManifest.Manifest, data []byte) error {
+	f.controllers[manifest.Name] = manifest
+	f.data[manifest.Hash] = data
+	return nil
+}
+
+func testController(name string, binary []byte) *controllerManifest.Manifest {
+	return &controllerManifest.Manifest{Name: name, Version: "1.0.0", Path: name, Hash: hashHex(binary)}
+}
+
+func signedModule(t *testing.T, key ed25519.PrivateKey, name, version string, wasm []byte) *module.Manifest {
+	t.Helper()
+	digest, err := hex.DecodeString(hashHex(wasm))
+	require.NoError(t, err)
+	return &module.Manifest{
+		Name:       name,
+		Version:    version,
+		Hash:       hashHex(wasm),
+		Signatures: []string{hex.EncodeToString(ed25519.Sign(key, digest))},
+	}
+}
+
+func trustAll() *MockReputationService {
+	r := new(MockReputationService)
+	r.On("IsTrustedPeer", mock.Anything, mock.Anything).Return(true)
+	r.On("GetPeerScore", mock.Anything).Return(90.0)
+	return r
+}
+
+func TestHandleRequest_VerifiesRequests(t *testing.T) {
+	network := make(map[peer.ID]*P2PRecoveryManager)
+	requester := newRecoveryNode(t, network, trustAll())
+	responder := newRecoveryNode(t, network, trustAll())
+	responder.SetLocalState(LocalState{Config: func() ([]byte, error) { return []byte("config"), nil }})
+	ctx := context.Background()
+
+	req := signedRequest(t, requester, responder, ResourceConfig)
+	resp := responder.HandleRequest(ctx, requester.selfID, req)
+	require.True(t, resp.Success, resp.Error)
+	assert.NoError(t, verifyPeerSignature(responder.selfID, resp.SigningDigest(), resp.Signature))
+
+	resp = responder.HandleRequest(ctx, requester.selfID, req)
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "replayed")
+
+	tampered := signedRequest(t, requester, responder, ResourceConfig)
+	tampered.ResourceType = ResourceState
+	resp = responder.HandleRequest(ctx, requester.selfID, tampered)
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "invalid signature")
+
+	other, _ := newTestIdentity(t)
+	resp = responder.HandleRequest(ctx, other, signedRequest(t, requester, responder, ResourceConfig))
+	assert.False(t, resp.Success, "request relayed by another peer")
+
+	stale := &RecoveryRequest{
+		RequesterID:  requester.selfID,
+		TargetID:     responder.selfID,
+		ResourceType: ResourceConfig,
+		Timestamp:    time.Now().Add(-time.Hour),
+		Nonce:        "stale",
+	}
+	stale.Signature, _ = signDigest(requester.key, stale.SigningDigest())
+	resp = responder.HandleRequest(ctx, requester.selfID, stale)
+	assert.False(t, resp.Success)
+	assert.Contains(t, resp.Error, "timestamp")
+}
+
+func TestHandleRequest_PolicyRefusal(t *testing.T) {
+	network := make(map[peer.ID]*P2PRecoveryManager)
+	requester := newRecoveryNode(t, network, trustAll())
+	responder := newRecoveryNode(t, network, trustAll())
+	responder.SetLocalState(LocalState{Config: func() ([]byte, error) { return []byte("config"), nil }})
+	responder.SetPolicyEnforcer(policyFunc(func(subject, action, resource string) bool {
+		return action == ServeRecoveryAction && resource != ResourceConfig
+	}))
+
+	_, err := requester.RequestRecoveryFromPeer(context.Background(), &RecoveryRequest{TargetID: responder.selfID, ResourceType: ResourceConfig})
+	assert.ErrorIs(t, err, errRefused)
+	assert.ErrorContains(t, err, "not authorized")
+
+	responder.SetPolicyEnforcer(nil)
+	_, err = requester.RequestRecoveryFromPeer(context.Background(), &RecoveryRequest{TargetID: responder.selfID, ResourceType: ResourceInventory})
+	assert.ErrorContains(t, err, "no recovery policy")
+}
+
+func TestRequestRecoveryFromPeer_RejectsForgedResponse(t *testing.T) {
+	network := make(map[peer.ID]*P2PRecoveryManager)
+	requester := newRecoveryNode(t, network, trustAll())
+	responder := newRecoveryNode(t, network, trustAll())
+	responder.SetLocalState(LocalState{Config: func() ([]byte, error) { return []byte("config"), nil }})
+	// An impostor answering with its own key for the responder's ID.
+	_, impostorKey := newTestIdentity(t)
+	responder.key = impostorKey
+
+	_, err := requester.RequestRecoveryFromPeer(context.Background(), &RecoveryRequest{TargetID: responder.selfID, ResourceType: ResourceConfig})
+	assert.ErrorContains(t, err, "invalid signature")
+}
+
+func TestRecoverConfiguration_Quorum(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []string
+		want    string
+		wantErr error
+	}{
+		{name: "majority agrees", configs: []string{"a", "a", "b"}, want: "a"},
+		{name: "no agreement", configs: []string{"a", "b", "c"}, wantErr: ErrNoQuorum},
+		{name: "tie", configs: []string{"a", "a", "b", "b"}, wantErr: ErrNoQuorum},
+		{name: "below quorum", configs: []string{"a"}, wantErr: ErrNoQuorum},
+		{name: "matches local", configs: []string{"local", "local"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := make(map[peer.ID]*P2PRecoveryManager)
+			local := newRecoveryNode(t, network, trustAll())
+			var applied []byte
+			local.SetLocalState(LocalState{
+				Config:      func() ([]byte, error) { return []byte("local"), nil },
+				ApplyConfig: func(data []byte) error { applied = data; return nil },
+			})
+			var peers []peer.ID
+			for _, c := range tt.configs {
+				c := c
+				p := newRecoveryNode(t, network, trustAll())
+				p.SetLocalState(LocalState{Config: func() ([]byte, error) { return []byte(c), nil }})
+				peers = append(peers, p.selfID)
+			}
+
+			err := local.RecoverAgentState(context.Background(), peers)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Nil(t, applied, "configuration applied without quorum")
+				return
+			}
+			require.NoError(t, err)
+			if tt.want == "" {
+				assert.Nil(t, applied)
+			} else {
+				assert.Equal(t, tt.want, string(applied))
+			}
+		})
+	}
+}
+
+func TestRecoverModules_VerifiesSignatures(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	wasm := []byte("\x00asm module v2")
+
+	setup := func(t *testing.T, trusted ed25519.PublicKey) (*P2PRecoveryManager, *fakeModuleManager, []peer.ID) {
+		network := make(map[peer.ID]*P2PRecoveryManager)
+		local := newRecoveryNode(t, network, trustAll())
+		localModules := newFakeModuleManager()
+		require.NoError(t, localModules.SaveAndLoadModule(&module.Manifest{Name: "scanner", Version: "1.0.0", Hash: "old"}, []byte("old")))
+		local.moduleManager = localModules
+		local.AddModuleKeys(trusted)
+
+		p := newRecoveryNode(t, network, trustAll())
+		peerModules := newFakeModuleManager()
+		require.NoError(t, peerModules.SaveAndLoadModule(signedModule(t, priv, "scanner", "2.0.0", wasm), wasm))
+		p.moduleManager = peerModules
+		return local, localModules, []peer.ID{p.selfID}
+	}
+
+	t.Run("trusted signer", func(t *testing.T) {
+		local, modules, peers := setup(t, pub)
+		require.NoError(t, local.RecoverAgentState(context.Background(), peers))
+		assert.Equal(t, "2.0.0", modules.modules["scanner"].Version)
+		assert.Equal(t, wasm, modules.data["scanner"])
+	})
+
+	t.Run("untrusted signer", func(t *testing.T) {
+		local, modules, peers := setup(t, otherPub)
+		err := local.RecoverAgentState(context.Background(), peers)
+		assert.ErrorContains(t, err, "not signed by a trusted key")
+		assert.Equal(t, "1.0.0", modules.modules["scanner"].Version)
+	})
+}
+
+func TestRecoverControllers_Quorum(t *testing.T) {
+	good, evil := []byte("controller"), []byte("evil controller")
+	tests := []struct {
+		name    string
+		offered [][]byte // the binary each peer lists
+		served  [][]byte // the binary each peer hands out, if not the listed one
+		wantErr error
+	}{
+		{name: "peers agree", offered: [][]byte{good, good}},
+		{name: "single peer", offered: [][]byte{good}, wantErr: ErrNoQuorum},
+		{name: "peers disagree", offered: [][]byte{good, evil}, wantErr: ErrNoQuorum},
+		{name: "majority agrees", offered: [][]byte{good, good, evil}},
+		{name: "peer serves another binary", offered: [][]byte{good, good}, served: [][]byte{evil, nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			network := make(map[peer.ID]*P2PRecoveryManager)
+			local := newRecoveryNode(t, network, trustAll())
+			installed := newFakeControllerManager()
+			local.controllerManager = installed
+
+			var peers []peer.ID
+			for i, binary := range tt.offered {
+				p := newRecoveryNode(t, network, trustAll())
+				controllers := newFakeControllerManager()
+				require.NoError(t, controllers.SaveAndLoadController(testController("ctl", binary), binary))
+				if i < len(tt.served) && tt.served[i] != nil {
+					controllers.served["ctl"] = testController("ctl", tt.served[i])
+					controllers.data[hashHex(tt.served[i])] = tt.served[i]
+				}
+				p.controllerManager = controllers
+				peers = append(peers, p.selfID)
+			}
+
+			err := local.RecoverAgentState(context.Background(), peers)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, installed.controllers, "controller installed without quorum")
+				return
+			}
+			require.NoError(t, err)
+			require.Contains(t, installed.controllers, "ctl")
+			assert.Equal(t, good, installed.data[installed.controllers["ctl"].Hash])
+		})
+	}
+}
+
+func TestDistributeRecoveryResources_ExchangesInventories(t *testing.T) {
+	network := make(map[peer.ID]*P2PRecoveryManager)
+	a := newRecoveryNode(t, network, trustAll())
+	b := newRecoveryNode(t, network, trustAll())
+	a.SetLocalState(LocalState{Config: func() ([]byte, error) { return []byte("a"), nil }})
+	b.SetLocalState(LocalState{Config: func() ([]byte, error) { return []byte("b"), nil }})
+
+	require.NoError(t, a.DistributeRecoveryResources(context.Background(), []peer.ID{b.selfID}))
+	assert.Equal(t, hashHex([]byte("b")), a.Offers()[b.selfID].ConfigHash)
+	assert.Equal(t, hashHex([]byte("a")), b.Offers()[a.selfID].ConfigHash)
+}
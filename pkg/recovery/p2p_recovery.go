@@ -2,13 +2,61 @@ package recovery
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
+	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/peer"
+	controllerManifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/naviNBRuas/APA/pkg/policy"
 )
 
+// ServeRecoveryAction is the policy action a responder authorizes before
+// serving a recovery request. The subject is the requesting peer ID and the
+// resource is the requested resource type.
+const ServeRecoveryAction = "serve_recovery"
+
+// Config controls peer-to-peer recovery.
+type Config struct {
+	Enabled        bool     `yaml:"enabled"`
+	Quorum         int      `yaml:"quorum"`          // peers that must agree on a recovered config or controller, defaults to 2
+	TrustThreshold float64  `yaml:"trust_threshold"` // minimum reputation of peers to recover from, defaults to 80
+	ModuleKeys     []string `yaml:"module_keys"`     // hex ed25519 keys recovered module manifests must be signed by
+}
+
+// WithDefaults fills unset fields.
+func (c Config) WithDefaults() Config {
+	if c.Quorum <= 0 {
+		c.Quorum = 2
+	}
+	if c.TrustThreshold <= 0 {
+		c.TrustThreshold = 80
+	}
+	return c
+}
+
+// TrustedModuleKeys decodes ModuleKeys.
+func (c Config) TrustedModuleKeys() ([]ed25519.PublicKey, error) {
+	keys := make([]ed25519.PublicKey, 0, len(c.ModuleKeys))
+	for _, k := range c.ModuleKeys {
+		raw, err := hex.DecodeString(k)
+		if err != nil || len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid module key %q", k)
+		}
+		keys = append(keys, raw)
+	}
+	return keys, nil
+}
+
 // P2PRecoveryManager handles advanced peer-to-peer recovery protocols
 type P2PRecoveryManager struct {
 	logger            *slog.Logger
@@ -20,6 +68,18 @@ type P2PRecoveryManager struct {
 	maxRetries        int
 	retryDelay        time.Duration
 	trustThreshold    float64
+	quorum            int
+
+	selfID     peer.ID
+	key        crypto.PrivKey
+	transport  RecoveryTransport
+	policy     policy.PolicyEnforcer
+	moduleKeys []ed25519.PublicKey
+	local      LocalState
+
+	mu     sync.Mutex
+	nonces map[string]time.Time          // request nonces seen, for replay protection
+	offers map[peer.ID]RecoveryInventory // inventories peers offered us
 }
 
 // BackupManagerService defines the interface for backup operations
@@ -35,24 +95,30 @@ type ReputationService interface {
 	IsTrustedPeer(peerID string, threshold float64) bool
 }
 
-// RecoveryRequest represents a request for peer-to-peer recovery
-type RecoveryRequest struct {
-	RequesterID  peer.ID   `json:"requester_id"`
-	TargetID     peer.ID   `json:"target_id"`
-	ResourceType string    `json:"resource_type"` // module, controller, config, state, backup
-	ResourceName string    `json:"resource_name"`
-	Version      string    `json:"version"`
-	Timestamp    time.Time `json:"timestamp"`
-	Priority     string    `json:"priority"` // low, medium, high, critical
+// LocalState reads and replaces the agent's configuration and operational
+// state. Unset functions leave that resource out of recovery and serving.
+type LocalState struct {
+	Config      func() ([]byte, error)
+	ApplyConfig func(data []byte) error
+	State       func() (map[string]interface{}, error)
+	ApplyState  func(state map[string]interface{}) error
+}
+
+// moduleExporter is implemented by module managers that can hand a
+// module's bytes to peers, such as module.Manager.
+type moduleExporter interface {
+	GetModuleData(name, version string) (*module.Manifest, []byte, error)
 }
 
-// RecoveryResponse represents a response to a recovery request
-type RecoveryResponse struct {
-	RequestID string    `json:"request_id"`
-	Success   bool      `json:"success"`
-	Data      []byte    `json:"data,omitempty"`
-	Error     string    `json:"error,omitempty"`
-	Timestamp time.Time `json:"timestamp"`
+// controllerExporter and controllerInstaller are implemented by controller
+// managers that can hand a controller's binary to peers and install one
+// recovered from them, such as manager.Manager.
+type controllerExporter interface {
+	ControllerData(name string) (*controllerManifest.Manifest, []byte, error)
+}
+
+type controllerInstaller interface {
+	SaveAndLoadController(manifest *controllerManifest.Manifest, data []byte) error
 }
 
 // NewP2PRecoveryManager creates a new P2P recovery manager
@@ -74,9 +140,71 @@ func NewP2PRecoveryManager(
 		maxRetries:        3,
 		retryDelay:        5 * time.Second,
 		trustThreshold:    80.0, // Require 80% trust score for recovery operations
+		quorum:            2,
+		nonces:            make(map[string]time.Time),
+		offers:            make(map[peer.ID]RecoveryInventory),
+	}
+}
+
+// Configure applies the quorum, trust threshold and trusted module keys of
+// cfg.
+func (prm *P2PRecoveryManager) Configure(cfg Config) error {
+	cfg = cfg.WithDefaults()
+	keys, err := cfg.TrustedModuleKeys()
+	if err != nil {
+		return err
 	}
+	prm.quorum = cfg.Quorum
+	prm.trustThreshold = cfg.TrustThreshold
+	prm.moduleKeys = append(prm.moduleKeys, keys...)
+	return nil
+}
+
+// SetIdentity sets the peer ID and key the manager signs requests and
+// responses with.
+func (prm *P2PRecoveryManager) SetIdentity(id peer.ID, key crypto.PrivKey) {
+	prm.selfID = id
+	prm.key = key
 }
 
+// SetTransport sets how requests reach peers.
+func (prm *P2PRecoveryManager) SetTransport(transport RecoveryTransport) {
+	prm.transport = transport
+}
+
+// SetPolicyEnforcer sets the policy that authorizes serving requests.
+// Without one, every request is refused.
+func (prm *P2PRecoveryManager) SetPolicyEnforcer(enforcer policy.PolicyEnforcer) {
+	prm.policy = enforcer
+}
+
+// AddModuleKeys trusts module manifests signed by keys.
+func (prm *P2PRecoveryManager) AddModuleKeys(keys ...ed25519.PublicKey) {
+	prm.moduleKeys = append(prm.moduleKeys, keys...)
+}
+
+// SetLocalState sets how the agent's configuration and operational state
+// are read and replaced.
+func (prm *P2PRecoveryManager) SetLocalState(local LocalState) {
+	prm.local = local
+}
+
+// Offers returns the inventories peers have offered with
+// DistributeRecoveryResources.
+func (prm *P2PRecoveryManager) Offers() map[peer.ID]RecoveryInventory {
+	prm.mu.Lock()
+	defer prm.mu.Unlock()
+	offers := make(map[peer.ID]RecoveryInventory, len(prm.offers))
+	for id, inv := range prm.offers {
+		offers[id] = inv
+	}
+	return offers
+}
+
+// errRefused marks responses a peer sent but refused or failed to serve;
+// they are not retried.
+var errRefused = errors.New("recovery request refused")
+
 // RequestRecoveryFromPeer requests recovery of a specific resource from a trusted peer
 func (prm *P2PRecoveryManager) RequestRecoveryFromPeer(ctx context.Context, req *RecoveryRequest) (*RecoveryResponse, error) {
 	prm.logger.Info("Requesting recovery from peer",
@@ -89,13 +217,20 @@ func (prm *P2PRecoveryManager) RequestRecoveryFromPeer(ctx context.Context, req
 	if !prm.reputationSystem.IsTrustedPeer(req.TargetID.String(), prm.trustThreshold) {
 		return nil, fmt.Errorf("peer %s is not trusted for recovery operations (trust threshold: %.2f)", req.TargetID, prm.trustThreshold)
 	}
+	if prm.transport == nil {
+		return nil, fmt.Errorf("recovery transport not configured")
+	}
 
 	// Retry mechanism for recovery requests
 	var lastErr error
 	for attempt := 0; attempt <= prm.maxRetries; attempt++ {
 		if attempt > 0 {
 			prm.logger.Info("Retrying recovery request", "attempt", attempt, "delay", prm.retryDelay)
-			time.Sleep(prm.retryDelay)
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(prm.retryDelay):
+			}
 		}
 
 		response, err := prm.performRecoveryRequest(ctx, req)
@@ -103,6 +238,9 @@ func (prm *P2PRecoveryManager) RequestRecoveryFromPeer(ctx context.Context, req
 			prm.logger.Info("Recovery request successful", "attempt", attempt)
 			return response, nil
 		}
+		if errors.Is(err, errRefused) {
+			return nil, err
+		}
 
 		lastErr = err
 		prm.logger.Warn("Recovery request failed", "attempt", attempt, "error", err)
@@ -111,31 +249,230 @@ func (prm *P2PRecoveryManager) RequestRecoveryFromPeer(ctx context.Context, req
 	return nil, fmt.Errorf("recovery request failed after %d attempts: %w", prm.maxRetries+1, lastErr)
 }
 
-// performRecoveryRequest performs the actual recovery request to a peer
+// performRecoveryRequest signs a request with a fresh nonce, sends it to the
+// target peer and verifies the response.
 func (prm *P2PRecoveryManager) performRecoveryRequest(ctx context.Context, req *RecoveryRequest) (*RecoveryResponse, error) {
-	// In a real implementation, this would:
-	// 1. Send a recovery request message to the target peer via P2P
-	// 2. Wait for a response with the requested resource
-	// 3. Verify the authenticity and integrity of the received data
-	// 4. Apply the recovered resource to the local agent
-
-	// For now, we'll simulate the process
-	prm.logger.Info("Performing recovery request simulation",
-		"resource_type", req.ResourceType,
-		"resource_name", req.ResourceName)
+	signed := *req
+	signed.RequesterID = prm.selfID
+	signed.Timestamp = time.Now().UTC()
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	signed.Nonce = hex.EncodeToString(nonce)
+	sig, err := signDigest(prm.key, signed.SigningDigest())
+	if err != nil {
+		return nil, err
+	}
+	signed.Signature = sig
 
-	// Simulate network delay
-	time.Sleep(100 * time.Millisecond)
+	resp, err := prm.transport.RequestRecovery(ctx, signed.TargetID, &signed)
+	if err != nil {
+		return nil, err
+	}
+	if err := prm.verifyResponse(&signed, resp); err != nil {
+		return nil, fmt.Errorf("%w: %v", errRefused, err)
+	}
+	return resp, nil
+}
 
-	// Simulate successful recovery
-	response := &RecoveryResponse{
-		RequestID: fmt.Sprintf("req-%d", time.Now().UnixNano()),
-		Success:   true,
-		Data:      []byte("simulated recovery data"),
-		Timestamp: time.Now(),
+// verifyResponse checks that resp answers req, is signed by the target
+// peer, and that its data matches its hash and manifests.
+func (prm *P2PRecoveryManager) verifyResponse(req *RecoveryRequest, resp *RecoveryResponse) error {
+	if resp.ResponderID != req.TargetID {
+		return fmt.Errorf("response from %s, not %s", resp.ResponderID, req.TargetID)
+	}
+	if err := verifyPeerSignature(req.TargetID, resp.SigningDigest(), resp.Signature); err != nil {
+		return err
+	}
+	if resp.RequestID != req.Nonce || resp.ResourceType != req.ResourceType || resp.ResourceName != req.ResourceName {
+		return fmt.Errorf("response does not answer the request")
+	}
+	if !resp.Success {
+		return fmt.Errorf("peer %s: %s", req.TargetID, resp.Error)
+	}
+	if hashHex(resp.Data) != resp.Hash {
+		return fmt.Errorf("response data does not match its hash")
+	}
+	switch resp.ResourceType {
+	case ResourceModule:
+		if resp.Module == nil || resp.Module.Name != req.ResourceName || resp.Module.Hash != resp.Hash {
+			return fmt.Errorf("module data does not match its manifest")
+		}
+		if req.Version != "" && resp.Module.Version != req.Version {
+			return fmt.Errorf("peer sent module version %s, not %s", resp.Module.Version, req.Version)
+		}
+		if err := resp.Module.VerifySignature(prm.moduleKeys); err != nil {
+			return err
+		}
+	case ResourceController:
+		if resp.Controller == nil || resp.Controller.Name != req.ResourceName || resp.Controller.Hash != resp.Hash {
+			return fmt.Errorf("controller data does not match its manifest")
+		}
+	}
+	return nil
+}
+
+// HandleRequest serves a recovery request from a peer. The request must be
+// signed by its sender, fresh, not replayed, and authorized by the policy
+// for the resource type. The response is always signed, including refusals.
+func (prm *P2PRecoveryManager) HandleRequest(ctx context.Context, from peer.ID, req *RecoveryRequest) *RecoveryResponse {
+	resp, err := prm.serve(ctx, from, req)
+	if err != nil {
+		prm.logger.Warn("Refused recovery request", "peer", from, "resource_type", req.ResourceType, "resource_name", req.ResourceName, "error", err)
+		resp = &RecoveryResponse{Error: err.Error()}
+	} else {
+		resp.Success = true
+		resp.Hash = hashHex(resp.Data)
+	}
+	resp.RequestID = req.Nonce
+	resp.ResponderID = prm.selfID
+	resp.ResourceType = req.ResourceType
+	resp.ResourceName = req.ResourceName
+	resp.Timestamp = time.Now().UTC()
+	if resp.Signature, err = signDigest(prm.key, resp.SigningDigest()); err != nil {
+		prm.logger.Error("Failed to sign recovery response", "error", err)
+	}
+	return resp
+}
+
+func (prm *P2PRecoveryManager) serve(ctx context.Context, from peer.ID, req *RecoveryRequest) (*RecoveryResponse, error) {
+	if req.RequesterID != from {
+		return nil, fmt.Errorf("request signed for %s sent by %s", req.RequesterID, from)
+	}
+	if req.TargetID != prm.selfID {
+		return nil, fmt.Errorf("request is for %s", req.TargetID)
+	}
+	if err := req.Verify(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if age := now.Sub(req.Timestamp); age > recoveryRequestMaxAge || age < -recoveryRequestMaxAge {
+		return nil, fmt.Errorf("request timestamp outside the accepted window")
+	}
+	if err := prm.useNonce(req.Nonce, now); err != nil {
+		return nil, err
+	}
+	if prm.policy == nil {
+		return nil, fmt.Errorf("no recovery policy configured")
+	}
+	allowed, reason, err := prm.policy.Authorize(ctx, from.String(), ServeRecoveryAction, req.ResourceType)
+	if err != nil {
+		return nil, fmt.Errorf("authorization error: %w", err)
+	}
+	if !allowed {
+		return nil, fmt.Errorf("not authorized: %s", reason)
 	}
 
-	return response, nil
+	resp := &RecoveryResponse{}
+	switch req.ResourceType {
+	case ResourceConfig:
+		if prm.local.Config == nil {
+			return nil, fmt.Errorf("configuration not available")
+		}
+		resp.Data, err = prm.local.Config()
+	case ResourceState:
+		if prm.local.State == nil {
+			return nil, fmt.Errorf("operational state not available")
+		}
+		var state map[string]interface{}
+		if state, err = prm.local.State(); err == nil {
+			resp.Data, err = json.Marshal(state)
+		}
+	case ResourceModule:
+		resp.Module, resp.Data, err = prm.exportModule(req.ResourceName, req.Version)
+	case ResourceController:
+		exporter, ok := prm.controllerManager.(controllerExporter)
+		if !ok {
+			return nil, fmt.Errorf("controllers not available")
+		}
+		resp.Controller, resp.Data, err = exporter.ControllerData(req.ResourceName)
+	case ResourceInventory:
+		if len(req.Data) > 0 {
+			var offer RecoveryInventory
+			if err := json.Unmarshal(req.Data, &offer); err != nil {
+				return nil, fmt.Errorf("invalid inventory: %w", err)
+			}
+			offer.Updated = now.UTC()
+			prm.mu.Lock()
+			prm.offers[from] = offer
+			prm.mu.Unlock()
+		}
+		resp.Data, err = json.Marshal(prm.localInventory())
+	default:
+		return nil, fmt.Errorf("unknown resource type %q", req.ResourceType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// useNonce records a request nonce, refusing one seen within the accepted
+// window, and forgets nonces older than the window.
+func (prm *P2PRecoveryManager) useNonce(nonce string, now time.Time) error {
+	if nonce == "" {
+		return fmt.Errorf("request has no nonce")
+	}
+	prm.mu.Lock()
+	defer prm.mu.Unlock()
+	for n, seen := range prm.nonces {
+		if now.Sub(seen) > 2*recoveryRequestMaxAge {
+			delete(prm.nonces, n)
+		}
+	}
+	if _, seen := prm.nonces[nonce]; seen {
+		return fmt.Errorf("replayed request")
+	}
+	prm.nonces[nonce] = now
+	return nil
+}
+
+// exportModule returns a loaded module; an empty version means the loaded
+// one.
+func (prm *P2PRecoveryManager) exportModule(name, version string) (*module.Manifest, []byte, error) {
+	exporter, ok := prm.moduleManager.(moduleExporter)
+	if !ok {
+		return nil, nil, fmt.Errorf("modules not available")
+	}
+	if version == "" {
+		for _, m := range prm.moduleManager.ListModules() {
+			if m != nil && m.Name == name {
+				version = m.Version
+				break
+			}
+		}
+	}
+	return exporter.GetModuleData(name, version)
+}
+
+// localInventory lists what this agent can serve.
+func (prm *P2PRecoveryManager) localInventory() RecoveryInventory {
+	inv := RecoveryInventory{Updated: time.Now().UTC()}
+	if prm.local.Config != nil {
+		if data, err := prm.local.Config(); err == nil {
+			inv.ConfigHash = hashHex(data)
+		}
+	}
+	if _, ok := prm.moduleManager.(moduleExporter); ok {
+		inv.Modules = prm.moduleManager.ListModules()
+	}
+	if _, ok := prm.controllerManager.(controllerExporter); ok {
+		inv.Controllers = prm.controllerManager.ListControllers()
+	}
+	return inv
+}
+
+// request sends one request to a peer.
+func (prm *P2PRecoveryManager) request(ctx context.Context, target peer.ID, resourceType, name, version string, data []byte) (*RecoveryResponse, error) {
+	return prm.RequestRecoveryFromPeer(ctx, &RecoveryRequest{
+		TargetID:     target,
+		ResourceType: resourceType,
+		ResourceName: name,
+		Version:      version,
+		Priority:     "high",
+		Data:         data,
+	})
 }
 
 // RecoverAgentState recovers the complete agent state from trusted peers
@@ -154,122 +491,348 @@ func (prm *P2PRecoveryManager) RecoverAgentState(ctx context.Context, peerIDs []
 		return fmt.Errorf("no trusted peers available for agent state recovery")
 	}
 
+	// Most reputable first, so single-source resources come from the peer
+	// trusted most.
+	sort.SliceStable(trustedPeers, func(i, j int) bool {
+		return prm.reputationSystem.GetPeerScore(trustedPeers[i].String()) > prm.reputationSystem.GetPeerScore(trustedPeers[j].String())
+	})
 	prm.logger.Info("Found trusted peers for recovery", "trusted_count", len(trustedPeers))
 
-	// Recovery steps:
-	// 1. Recover configuration from peers
-	if err := prm.recoverConfiguration(ctx, trustedPeers); err != nil {
+	inventories := prm.fetchInventories(ctx, trustedPeers)
+
+	// Recovery steps. Configuration is agreed on first but applied last,
+	// since applying it may restart the agent's components.
+	config, err := prm.recoverConfiguration(ctx, trustedPeers)
+	if err != nil {
 		return fmt.Errorf("failed to recover configuration: %w", err)
 	}
 
-	// 2. Recover modules from peers
-	if err := prm.recoverModules(ctx, trustedPeers); err != nil {
+	recovered, err := prm.recoverModules(ctx, inventories)
+	if err != nil {
 		return fmt.Errorf("failed to recover modules: %w", err)
 	}
 
-	// 3. Recover controllers from peers
-	if err := prm.recoverControllers(ctx, trustedPeers); err != nil {
+	if err := prm.recoverControllers(ctx, inventories); err != nil {
 		return fmt.Errorf("failed to recover controllers: %w", err)
 	}
 
-	// 4. Recover operational state from peers
 	if err := prm.recoverOperationalState(ctx, trustedPeers); err != nil {
 		return fmt.Errorf("failed to recover operational state: %w", err)
 	}
 
-	// 5. Validate recovered state
-	if err := prm.validateRecoveredState(ctx); err != nil {
+	if err := prm.validateRecoveredState(ctx, recovered); err != nil {
 		return fmt.Errorf("failed to validate recovered state: %w", err)
 	}
 
+	if config != nil {
+		if err := prm.local.ApplyConfig(config); err != nil {
+			return fmt.Errorf("failed to apply recovered configuration: %w", err)
+		}
+		prm.logger.Info("Applied recovered configuration")
+	}
+
 	prm.logger.Info("Agent state recovery completed successfully")
 	return nil
 }
 
-// recoverConfiguration recovers agent configuration from trusted peers
-func (prm *P2PRecoveryManager) recoverConfiguration(ctx context.Context, trustedPeers []peer.ID) error {
+// peerInventory is a peer's inventory as fetched during recovery.
+type peerInventory struct {
+	peer peer.ID
+	inv  RecoveryInventory
+}
+
+// fetchInventories asks each peer what it can serve, in peer order.
+func (prm *P2PRecoveryManager) fetchInventories(ctx context.Context, peers []peer.ID) []peerInventory {
+	var inventories []peerInventory
+	for _, p := range peers {
+		resp, err := prm.request(ctx, p, ResourceInventory, "", "", nil)
+		if err != nil {
+			prm.logger.Warn("Failed to fetch recovery inventory", "peer", p, "error", err)
+			continue
+		}
+		var inv RecoveryInventory
+		if err := json.Unmarshal(resp.Data, &inv); err != nil {
+			prm.logger.Warn("Invalid recovery inventory", "peer", p, "error", err)
+			continue
+		}
+		inventories = append(inventories, peerInventory{peer: p, inv: inv})
+	}
+	return inventories
+}
+
+// recoverConfiguration fetches the configuration from every trusted peer
+// and returns the one a quorum agrees on, or nil when it matches the local
+// configuration or there is nothing to apply it with. Agreement needs at
+// least the configured quorum and a majority of the peers that answered.
+func (prm *P2PRecoveryManager) recoverConfiguration(ctx context.Context, trustedPeers []peer.ID) ([]byte, error) {
 	prm.logger.Info("Recovering agent configuration from peers")
+	if prm.local.ApplyConfig == nil {
+		prm.logger.Info("No configuration handler set; skipping configuration recovery")
+		return nil, nil
+	}
 
-	// In a real implementation, this would:
-	// 1. Request configuration data from multiple trusted peers
-	// 2. Compare configurations and select the most recent or consensus version
-	// 3. Apply the recovered configuration
+	votes := make(map[string]int)
+	configs := make(map[string][]byte)
+	answered := 0
+	for _, p := range trustedPeers {
+		resp, err := prm.request(ctx, p, ResourceConfig, "", "", nil)
+		if err != nil {
+			prm.logger.Warn("Failed to fetch configuration from peer", "peer", p, "error", err)
+			continue
+		}
+		answered++
+		votes[resp.Hash]++
+		configs[resp.Hash] = resp.Data
+	}
 
-	// For now, we'll simulate the process
-	prm.logger.Info("Configuration recovery completed")
-	return nil
+	best, bestVotes := "", 0
+	for hash, n := range votes {
+		if n > bestVotes || (n == bestVotes && hash < best) {
+			best, bestVotes = hash, n
+		}
+	}
+	if bestVotes < prm.quorum || bestVotes*2 <= answered {
+		return nil, fmt.Errorf("%w: %d of %d answering peers agree, %d needed", ErrNoQuorum, bestVotes, answered, prm.quorum)
+	}
+	if prm.local.Config != nil {
+		if current, err := prm.local.Config(); err == nil && hashHex(current) == best {
+			prm.logger.Info("Local configuration already matches the peers' configuration")
+			return nil, nil
+		}
+	}
+	prm.logger.Info("Configuration recovery agreed", "hash", best, "votes", bestVotes, "answered", answered)
+	return configs[best], nil
 }
 
-// recoverModules recovers modules from trusted peers
-func (prm *P2PRecoveryManager) recoverModules(ctx context.Context, trustedPeers []peer.ID) error {
+// recoverModules installs modules the peers run that are missing locally or
+// older locally, at the newest version offered, and returns their names.
+func (prm *P2PRecoveryManager) recoverModules(ctx context.Context, inventories []peerInventory) ([]string, error) {
 	prm.logger.Info("Recovering modules from peers")
+	if prm.moduleManager == nil {
+		return nil, nil
+	}
 
-	// In a real implementation, this would:
-	// 1. Request a list of modules from trusted peers
-	// 2. Identify missing or corrupted modules locally
-	// 3. Request missing modules from peers
-	// 4. Verify module integrity and signatures
-	// 5. Load recovered modules
+	local := make(map[string]*module.Manifest)
+	for _, m := range prm.moduleManager.ListModules() {
+		if m != nil {
+			local[m.Name] = m
+		}
+	}
+	wanted := make(map[string]*module.Manifest)
+	for _, pi := range inventories {
+		for _, m := range pi.inv.Modules {
+			if m == nil {
+				continue
+			}
+			if have, ok := local[m.Name]; ok && compareVersions(m.Version, have.Version) <= 0 {
+				continue
+			}
+			if w, ok := wanted[m.Name]; !ok || compareVersions(m.Version, w.Version) > 0 {
+				wanted[m.Name] = m
+			}
+		}
+	}
 
-	// For now, we'll simulate the process
-	prm.logger.Info("Module recovery completed")
-	return nil
+	var recovered []string
+	var errs []error
+	for _, name := range sortedKeys(wanted) {
+		want := wanted[name]
+		var lastErr error
+		for _, pi := range inventories {
+			if !offersModule(pi.inv, want) {
+				continue
+			}
+			resp, err := prm.request(ctx, pi.peer, ResourceModule, want.Name, want.Version, nil)
+			if err == nil {
+				err = prm.moduleManager.SaveAndLoadModule(resp.Module, resp.Data)
+			}
+			if err != nil {
+				lastErr = err
+				prm.logger.Warn("Failed to recover module from peer", "module", name, "peer", pi.peer, "error", err)
+				continue
+			}
+			lastErr = nil
+			recovered = append(recovered, name)
+			prm.logger.Info("Recovered module from peer", "module", name, "version", want.Version, "peer", pi.peer)
+			break
+		}
+		if lastErr != nil {
+			errs = append(errs, fmt.Errorf("module %s: %w", name, lastErr))
+		}
+	}
+	prm.logger.Info("Module recovery completed", "recovered", len(recovered))
+	return recovered, errors.Join(errs...)
+}
+
+func offersModule(inv RecoveryInventory, want *module.Manifest) bool {
+	for _, m := range inv.Modules {
+		if m != nil && m.Name == want.Name && m.Version == want.Version && m.Hash == want.Hash {
+			return true
+		}
+	}
+	return false
 }
 
-// recoverControllers recovers controllers from trusted peers
-func (prm *P2PRecoveryManager) recoverControllers(ctx context.Context, trustedPeers []peer.ID) error {
+// recoverControllers installs controllers the peers run that are missing
+// locally. Controllers are native binaries with no publisher signature, so
+// a controller is only installed when a quorum of the peers offering it,
+// and a majority of them, advertise the same manifest, and the binary must
+// then match that manifest.
+func (prm *P2PRecoveryManager) recoverControllers(ctx context.Context, inventories []peerInventory) error {
 	prm.logger.Info("Recovering controllers from peers")
+	installer, ok := prm.controllerManager.(controllerInstaller)
+	if !ok {
+		prm.logger.Info("Controller manager cannot install controllers; skipping controller recovery")
+		return nil
+	}
 
-	// In a real implementation, this would:
-	// 1. Request a list of controllers from trusted peers
-	// 2. Identify missing or corrupted controllers locally
-	// 3. Request missing controllers from peers
-	// 4. Verify controller integrity and signatures
-	// 5. Load recovered controllers
+	local := make(map[string]bool)
+	for _, c := range prm.controllerManager.ListControllers() {
+		if c != nil {
+			local[c.Name] = true
+		}
+	}
+	// offers maps a controller name to the manifest each peer offers.
+	offers := make(map[string]map[peer.ID]*controllerManifest.Manifest)
+	for _, pi := range inventories {
+		for _, c := range pi.inv.Controllers {
+			if c == nil || local[c.Name] {
+				continue
+			}
+			if offers[c.Name] == nil {
+				offers[c.Name] = make(map[peer.ID]*controllerManifest.Manifest)
+			}
+			offers[c.Name][pi.peer] = c
+		}
+	}
 
-	// For now, we'll simulate the process
-	prm.logger.Info("Controller recovery completed")
-	return nil
+	recovered := 0
+	var errs []error
+	for _, name := range sortedKeys(offers) {
+		agreed, peers, err := prm.agreedController(offers[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("controller %s: %w", name, err))
+			continue
+		}
+		var lastErr error
+		for _, p := range peers {
+			resp, err := prm.request(ctx, p, ResourceController, name, "", nil)
+			if err == nil && manifestDigest(resp.Controller) != agreed {
+				err = fmt.Errorf("peer sent a controller manifest the quorum did not agree on")
+			}
+			if err == nil {
+				err = installer.SaveAndLoadController(resp.Controller, resp.Data)
+			}
+			if err != nil {
+				lastErr = err
+				prm.logger.Warn("Failed to recover controller from peer", "controller", name, "peer", p, "error", err)
+				continue
+			}
+			lastErr = nil
+			recovered++
+			prm.logger.Info("Recovered controller from peer", "controller", name, "peer", p)
+			break
+		}
+		if lastErr != nil {
+			errs = append(errs, fmt.Errorf("controller %s: %w", name, lastErr))
+		}
+	}
+	prm.logger.Info("Controller recovery completed", "recovered", recovered)
+	return errors.Join(errs...)
 }
 
-// recoverOperationalState recovers operational state from trusted peers
-func (prm *P2PRecoveryManager) recoverOperationalState(ctx context.Context, trustedPeers []peer.ID) error {
-	prm.logger.Info("Recovering operational state from peers")
+// agreedController returns the digest of the controller manifest most
+// peers offer, and those peers in order, when the quorum agrees on it.
+func (prm *P2PRecoveryManager) agreedController(offers map[peer.ID]*controllerManifest.Manifest) (string, []peer.ID, error) {
+	votes := make(map[string][]peer.ID)
+	for p, m := range offers {
+		digest := manifestDigest(m)
+		votes[digest] = append(votes[digest], p)
+	}
+	best := ""
+	for digest, peers := range votes {
+		if best == "" || len(peers) > len(votes[best]) || (len(peers) == len(votes[best]) && digest < best) {
+			best = digest
+		}
+	}
+	peers := votes[best]
+	if len(peers) < prm.quorum || len(peers)*2 <= len(offers) {
+		return "", nil, fmt.Errorf("%w: %d of %d offering peers agree, %d needed", ErrNoQuorum, len(peers), len(offers), prm.quorum)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+	return best, peers, nil
+}
 
-	// In a real implementation, this would:
-	// 1. Request operational state data from trusted peers
-	// 2. Identify discrepancies in local state
-	// 3. Apply recovered state data
+// manifestDigest hashes every field of a controller manifest, so peers
+// only agree when they would install the same binary the same way.
+func manifestDigest(m *controllerManifest.Manifest) string {
+	if m == nil {
+		return ""
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return ""
+	}
+	return hashHex(data)
+}
 
-	// For now, we'll simulate the process
-	prm.logger.Info("Operational state recovery completed")
-	return nil
+// recoverOperationalState replaces the local operational state with the
+// most reputable peer's that serves it.
+func (prm *P2PRecoveryManager) recoverOperationalState(ctx context.Context, trustedPeers []peer.ID) error {
+	prm.logger.Info("Recovering operational state from peers")
+	if prm.local.ApplyState == nil {
+		prm.logger.Info("No state handler set; skipping operational state recovery")
+		return nil
+	}
+	var lastErr error
+	for _, p := range trustedPeers {
+		resp, err := prm.request(ctx, p, ResourceState, "", "", nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var state map[string]interface{}
+		if err := json.Unmarshal(resp.Data, &state); err != nil {
+			lastErr = fmt.Errorf("invalid state from %s: %w", p, err)
+			continue
+		}
+		if err := prm.local.ApplyState(state); err != nil {
+			return err
+		}
+		prm.logger.Info("Operational state recovery completed", "peer", p)
+		return nil
+	}
+	return lastErr
 }
 
-// validateRecoveredState validates the recovered agent state
-func (prm *P2PRecoveryManager) validateRecoveredState(ctx context.Context) error {
+// validateRecoveredState checks that every recovered module is loaded.
+func (prm *P2PRecoveryManager) validateRecoveredState(ctx context.Context, recovered []string) error {
 	prm.logger.Info("Validating recovered agent state")
-
-	// In a real implementation, this would:
-	// 1. Verify the integrity of all recovered components
-	// 2. Check for consistency between configuration, modules, and state
-	// 3. Run health checks on recovered components
-	// 4. Ensure the agent can function properly with the recovered state
-
-	// For now, we'll simulate the process
+	if len(recovered) == 0 {
+		return nil
+	}
+	loaded := make(map[string]bool)
+	for _, m := range prm.moduleManager.ListModules() {
+		if m != nil {
+			loaded[m.Name] = true
+		}
+	}
+	for _, name := range recovered {
+		if !loaded[name] {
+			return fmt.Errorf("recovered module %s is not loaded", name)
+		}
+	}
 	prm.logger.Info("State validation completed")
 	return nil
 }
 
-// DistributeRecoveryResources distributes recovery resources to peer agents
+// DistributeRecoveryResources offers this agent's inventory to peers, so
+// they know what they can recover from it, and records theirs in return.
 func (prm *P2PRecoveryManager) DistributeRecoveryResources(ctx context.Context, peerIDs []peer.ID) error {
 	prm.logger.Info("Distributing recovery resources to peers", "peer_count", len(peerIDs))
-
-	// In a real implementation, this would:
-	// 1. Prepare recovery resources (snapshots, backups, modules, etc.)
-	// 2. Send resources to requesting peers
-	// 3. Track distribution status
-	// 4. Handle acknowledgments and errors
+	if len(peerIDs) == 0 {
+		return nil
+	}
 
 	// Prepare recovery resources
 	resources, err := prm.prepareRecoveryResources(ctx)
@@ -291,36 +854,43 @@ func (prm *P2PRecoveryManager) DistributeRecoveryResources(ctx context.Context,
 	return nil
 }
 
-// prepareRecoveryResources prepares recovery resources for distribution
-func (prm *P2PRecoveryManager) prepareRecoveryResources(ctx context.Context) (map[string][]byte, error) {
-	// In a real implementation, this would:
-	// 1. Collect necessary recovery resources (snapshots, backups, modules, etc.)
-	// 2. Package them for transfer
-	// 3. Sign or encrypt them for security
-
-	resources := make(map[string][]byte)
-
-	// For now, we'll simulate preparing resources
-	prm.logger.Debug("Preparing recovery resources")
-	time.Sleep(100 * time.Millisecond)
-
-	// Add a dummy resource for demonstration
-	resources["snapshot"] = []byte("dummy snapshot data")
-
-	return resources, nil
+// prepareRecoveryResources serializes this agent's inventory.
+func (prm *P2PRecoveryManager) prepareRecoveryResources(ctx context.Context) ([]byte, error) {
+	return json.Marshal(prm.localInventory())
 }
 
-// sendRecoveryResourcesToPeer sends recovery resources to a specific peer
-func (prm *P2PRecoveryManager) sendRecoveryResourcesToPeer(ctx context.Context, peerID peer.ID, resources map[string][]byte) error {
-	// In a real implementation, this would:
-	// 1. Establish a secure connection to the peer
-	// 2. Authenticate with the peer
-	// 3. Transfer the resources
-	// 4. Wait for acknowledgment
-
-	// For now, we'll simulate sending resources
-	prm.logger.Debug("Sending recovery resources to peer", "peer_id", peerID)
-	time.Sleep(100 * time.Millisecond)
-
+// sendRecoveryResourcesToPeer offers the inventory to a peer and records the
+// peer's inventory from its response. Offers are not limited to trusted
+// peers; RecoverAgentState asks trusted peers for their inventories again.
+func (prm *P2PRecoveryManager) sendRecoveryResourcesToPeer(ctx context.Context, peerID peer.ID, inventory []byte) error {
+	if prm.transport == nil {
+		return fmt.Errorf("recovery transport not configured")
+	}
+	resp, err := prm.performRecoveryRequest(ctx, &RecoveryRequest{
+		TargetID:     peerID,
+		ResourceType: ResourceInventory,
+		Priority:     "low",
+		Data:         inventory,
+	})
+	if err != nil {
+		return err
+	}
+	var offer RecoveryInventory
+	if err := json.Unmarshal(resp.Data, &offer); err != nil {
+		return fmt.Errorf("invalid inventory: %w", err)
+	}
+	offer.Updated = time.Now().UTC()
+	prm.mu.Lock()
+	prm.offers[peerID] = offer
+	prm.mu.Unlock()
 	return nil
 }
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -122,45 +122,30 @@ func TestNewP2PRecoveryManager(t *testing.T) {
 }
 
 func TestRequestRecoveryFromPeer_TrustedPeer(t *testing.T) {
-	logger := slog.Default()
-	mockP2P := new(MockP2PService)
-	mockModuleManager := new(MockModuleManagerService)
-	mockControllerManager := new(MockControllerManagerService)
-	mockBackupManager := new(MockBackupManagerService)
 	mockReputation := new(MockReputationService)
-
-	manager := NewP2PRecoveryManager(
-		logger,
-		mockP2P,
-		mockModuleManager,
-		mockControllerManager,
-		mockBackupManager,
-		mockReputation,
-	)
-
-	// Mock a trusted peer
-	requesterID, _ := peer.Decode("QmPeer1")
-	targetID, _ := peer.Decode("QmPeer2")
+	network := make(map[peer.ID]*P2PRecoveryManager)
+	requester := newRecoveryNode(t, network, mockReputation)
+	target := newRecoveryNode(t, network, mockReputation)
+	target.SetLocalState(LocalState{Config: func() ([]byte, error) { return []byte("log_level: info\n"), nil }})
 
 	req := &RecoveryRequest{
-		RequesterID:  requesterID,
-		TargetID:     targetID,
-		ResourceType: "module",
-		ResourceName: "test-module",
-		Version:      "1.0",
+		TargetID:     target.selfID,
+		ResourceType: ResourceConfig,
 		Timestamp:    time.Now(),
 		Priority:     "medium",
 	}
 
-	mockReputation.On("IsTrustedPeer", targetID.String(), 80.0).Return(true)
+	mockReputation.On("IsTrustedPeer", target.selfID.String(), 80.0).Return(true)
 
 	// Test successful recovery
 	ctx := context.Background()
-	response, err := manager.RequestRecoveryFromPeer(ctx, req)
+	response, err := requester.RequestRecoveryFromPeer(ctx, req)
 
 	assert.NoError(t, err)
 	assert.NotNil(t, response)
 	assert.True(t, response.Success)
+	assert.Equal(t, "log_level: info\n", string(response.Data))
+	assert.Equal(t, target.selfID, response.ResponderID)
 	mockReputation.AssertExpectations(t)
 }
 
@@ -208,36 +193,43 @@ func TestRequestRecoveryFromPeer_UntrustedPeer(t *testing.T) {
 }
 
 func TestRecoverAgentState(t *testing.T) {
-	logger := slog.Default()
-	mockP2P := new(MockP2PService)
 	mockModuleManager := new(MockModuleManagerService)
-	mockControllerManager := new(MockControllerManagerService)
-	mockBackupManager := new(MockBackupManagerService)
 	mockReputation := new(MockReputationService)
-
-	manager := NewP2PRecoveryManager(
-		logger,
-		mockP2P,
-		mockModuleManager,
-		mockControllerManager,
-		mockBackupManager,
-		mockReputation,
-	)
-
-	// Create peer IDs
-	peer1ID, _ := peer.Decode("QmPeer1")
-	peer2ID, _ := peer.Decode("QmPeer2")
-	peerIDs := []peer.ID{peer1ID, peer2ID}
+	network := make(map[peer.ID]*P2PRecoveryManager)
+	manager := newRecoveryNode(t, network, mockReputation)
+	manager.moduleManager = mockModuleManager
+
+	var applied []byte
+	var appliedState map[string]interface{}
+	manager.SetLocalState(LocalState{
+		Config:      func() ([]byte, error) { return []byte("log_level: debug\n"), nil },
+		ApplyConfig: func(data []byte) error { applied = data; return nil },
+		ApplyState:  func(state map[string]interface{}) error { appliedState = state; return nil },
+	})
+	var peerIDs []peer.ID
+	for i := 0; i < 2; i++ {
+		p := newRecoveryNode(t, network, mockReputation)
+		p.SetLocalState(LocalState{
+			Config: func() ([]byte, error) { return []byte("log_level: info\n"), nil },
+			State: func() (map[string]interface{}, error) {
+				return map[string]interface{}{"quarantine_list": map[string]interface{}{}}, nil
+			},
+		})
+		peerIDs = append(peerIDs, p.selfID)
+	}
 
 	// Mock trusted peers
-	mockReputation.On("IsTrustedPeer", peer1ID.String(), 80.0).Return(true)
-	mockReputation.On("IsTrustedPeer", peer2ID.String(), 80.0).Return(true)
+	mockReputation.On("IsTrustedPeer", mock.Anything, 80.0).Return(true)
+	mockReputation.On("GetPeerScore", mock.Anything).Return(90.0)
+	mockModuleManager.On("ListModules").Return([]*module.Manifest{})
 
 	// Test agent state recovery
 	ctx := context.Background()
 	err := manager.RecoverAgentState(ctx, peerIDs)
 
 	assert.NoError(t, err)
+	assert.Equal(t, "log_level: info\n", string(applied))
+	assert.Contains(t, appliedState, "quarantine_list")
 	mockReputation.AssertExpectations(t)
 }
 
@@ -0,0 +1,301 @@
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/naviNBRuas/APA/pkg/module"
+	"gopkg.in/yaml.v3"
+)
+
+// RestoreComponent names a part of a snapshot that can be restored on its
+// own.
+type RestoreComponent string
+
+const (
+	RestoreConfig      RestoreComponent = "config"
+	RestoreModules     RestoreComponent = "modules"
+	RestoreControllers RestoreComponent = "controllers"
+	RestoreState       RestoreComponent = "state"
+)
+
+// Restore actions.
+const (
+	ActionApply   = "apply"   // apply the snapshot's configuration
+	ActionInstall = "install" // load the snapshot's version of a module
+	ActionStop    = "stop"    // stop a component the snapshot does not have
+	ActionRestore = "restore" // replace operational state
+	ActionSkip    = "skip"    // nothing to do, or a change the restore cannot make; see Detail
+)
+
+// RestoreOptions selects what RestoreComponents restores.
+type RestoreOptions struct {
+	// Components to restore; empty restores all of them.
+	Components []RestoreComponent
+	// Modules and Controllers limit the restore to the named components;
+	// empty means every one that differs.
+	Modules     []string
+	Controllers []string
+	// DryRun reports what the restore would do without changing anything.
+	DryRun bool
+}
+
+func (o RestoreOptions) includes(c RestoreComponent) bool {
+	if len(o.Components) == 0 {
+		return true
+	}
+	for _, selected := range o.Components {
+		if selected == c {
+			return true
+		}
+	}
+	return false
+}
+
+// RestoreAction is one step of a restore.
+type RestoreAction struct {
+	Component RestoreComponent `json:"component"`
+	Name      string           `json:"name,omitempty"`
+	Action    string           `json:"action"`
+	Detail    string           `json:"detail,omitempty"`
+	Done      bool             `json:"done"`
+	Error     string           `json:"error,omitempty"`
+}
+
+// RestoreReport describes a restore, or with DryRun what it would do. Diff
+// compares the running agent with the snapshot for the selected components.
+type RestoreReport struct {
+	Snapshot string          `json:"snapshot"`
+	DryRun   bool            `json:"dry_run"`
+	Diff     *SnapshotDiff   `json:"diff"`
+	Actions  []RestoreAction `json:"actions"`
+}
+
+// Err returns the errors of failed actions, or nil.
+func (r *RestoreReport) Err() error {
+	var errs []error
+	for _, a := range r.Actions {
+		if a.Error != "" {
+			errs = append(errs, fmt.Errorf("%s %s %s: %s", a.Action, a.Component, a.Name, a.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ModuleSource returns the WASM bytes of a module version recorded in a
+// snapshot. Snapshots hold manifests only, so restoring a module needs one.
+type ModuleSource func(ctx context.Context, manifest *module.Manifest) ([]byte, error)
+
+// SetModuleSource sets where RestoreComponents fetches modules from.
+// Without one, module installs are reported as skipped.
+func (erc *ExtendedRecoveryController) SetModuleSource(source ModuleSource) {
+	erc.moduleSource = source
+}
+
+// PeerModuleSource fetches modules from peers in order, accepting the first
+// copy whose hash matches the manifest.
+func PeerModuleSource(p2p P2PService, peers ...peer.ID) ModuleSource {
+	return func(ctx context.Context, manifest *module.Manifest) ([]byte, error) {
+		var errs []error
+		for _, p := range peers {
+			fetched, wasm, err := p2p.FetchModule(ctx, p, manifest.Name, manifest.Version)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", p, err))
+				continue
+			}
+			if fetched == nil || fetched.Hash != manifest.Hash {
+				errs = append(errs, fmt.Errorf("%s: module hash does not match the snapshot", p))
+				continue
+			}
+			return wasm, nil
+		}
+		if len(errs) == 0 {
+			return nil, fmt.Errorf("no peers to fetch module %s from", manifest.Name)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
+
+// RestoreComponents restores the selected components of a snapshot and
+// reports each step. With opts.DryRun nothing is changed and no action is
+// marked done. The returned error covers reading the snapshot; failed steps
+// are recorded in the report, see RestoreReport.Err.
+func (erc *ExtendedRecoveryController) RestoreComponents(ctx context.Context, snapshotFile string, opts RestoreOptions) (*RestoreReport, error) {
+	erc.logger.Info("Restoring agent from comprehensive snapshot", "file", snapshotFile, "components", opts.Components, "dry_run", opts.DryRun)
+
+	snapshot, err := erc.LoadSnapshot(snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+	if opts.includes(RestoreConfig) && erc.applyConfigFunc == nil {
+		return nil, fmt.Errorf("applyConfigFunc is not set in RecoveryController")
+	}
+
+	// Only capture the parts of the running agent being restored, and
+	// leave the rest out of both sides of the diff.
+	current := &SnapshotData{Timestamp: time.Now()}
+	target := &SnapshotData{Timestamp: snapshot.Timestamp}
+	if opts.includes(RestoreConfig) {
+		current.Configuration, target.Configuration = erc.config, snapshot.Configuration
+	}
+	if opts.includes(RestoreModules) && erc.moduleManager != nil {
+		current.Modules, target.Modules = erc.moduleManager.ListModules(), snapshot.Modules
+	}
+	if opts.includes(RestoreControllers) && erc.controllerManager != nil {
+		current.Controllers, target.Controllers = erc.controllerManager.ListControllers(), snapshot.Controllers
+	}
+	if opts.includes(RestoreState) {
+		erc.mu.RLock()
+		quarantine := make(map[string]time.Time, len(erc.quarantineList))
+		for id, at := range erc.quarantineList {
+			quarantine[id] = at
+		}
+		erc.mu.RUnlock()
+		current.OperationalState = map[string]interface{}{"quarantine_list": quarantine}
+		target.OperationalState = snapshot.OperationalState
+	}
+	diff := DiffSnapshots(current, target)
+	diff.Modules = selectChanges(diff.Modules, opts.Modules)
+	diff.Controllers = selectChanges(diff.Controllers, opts.Controllers)
+
+	report := &RestoreReport{Snapshot: snapshotFile, DryRun: opts.DryRun, Diff: diff}
+	run := func(action RestoreAction, apply func() error) {
+		if !opts.DryRun && action.Action != ActionSkip {
+			if err := apply(); err != nil {
+				action.Error = err.Error()
+			} else {
+				action.Done = true
+			}
+		}
+		report.Actions = append(report.Actions, action)
+	}
+
+	if opts.includes(RestoreConfig) && len(diff.Config) == 0 {
+		run(RestoreAction{Component: RestoreConfig, Action: ActionSkip, Detail: "configuration unchanged"}, nil)
+	} else if opts.includes(RestoreConfig) {
+		run(RestoreAction{
+			Component: RestoreConfig,
+			Action:    ActionApply,
+			Detail:    fmt.Sprintf("%d fields change", len(diff.Config)),
+		}, func() error {
+			configData, err := yaml.Marshal(snapshot.Configuration)
+			if err != nil {
+				return fmt.Errorf("failed to marshal configuration data: %w", err)
+			}
+			if err := erc.applyConfigFunc(configData); err != nil {
+				return fmt.Errorf("failed to apply configuration during restore: %w", err)
+			}
+			return nil
+		})
+	}
+
+	manifests := make(map[string]*module.Manifest, len(snapshot.Modules))
+	for _, m := range snapshot.Modules {
+		if m != nil {
+			manifests[m.Name] = m
+		}
+	}
+	for _, change := range diff.Modules {
+		change := change
+		action := RestoreAction{Component: RestoreModules, Name: change.Name}
+		switch {
+		case change.Change == ChangeRemoved:
+			action.Action = ActionStop
+			run(action, func() error { return erc.moduleManager.StopModule(change.Name) })
+		case erc.moduleSource == nil:
+			action.Action = ActionSkip
+			action.Detail = fmt.Sprintf("no module source to fetch version %s from", change.ToVersion)
+			run(action, nil)
+		default:
+			action.Action = ActionInstall
+			action.Detail = fmt.Sprintf("%s %s", change.Change, change.ToVersion)
+			manifest := manifests[change.Name]
+			run(action, func() error {
+				wasm, err := erc.moduleSource(ctx, manifest)
+				if err != nil {
+					return fmt.Errorf("failed to fetch module: %w", err)
+				}
+				if err := erc.verifyModule(manifest, wasm); err != nil {
+					return fmt.Errorf("module verification failed: %w", err)
+				}
+				return erc.moduleManager.SaveAndLoadModule(manifest, wasm)
+			})
+		}
+	}
+
+	for _, change := range diff.Controllers {
+		change := change
+		action := RestoreAction{Component: RestoreControllers, Name: change.Name}
+		if change.Change == ChangeRemoved {
+			action.Action = ActionStop
+			run(action, func() error { return erc.controllerManager.StopController(ctx, change.Name) })
+			continue
+		}
+		// Snapshots hold controller manifests, not the native binaries, and
+		// controllers only start from binaries in the controller directory.
+		action.Action = ActionSkip
+		action.Detail = fmt.Sprintf("%s %s; controller binaries are not restored, install the controller to start it", change.Change, change.ToVersion)
+		run(action, nil)
+	}
+
+	if opts.includes(RestoreState) && len(diff.State) == 0 {
+		run(RestoreAction{Component: RestoreState, Action: ActionSkip, Detail: "operational state unchanged"}, nil)
+	} else if opts.includes(RestoreState) {
+		run(RestoreAction{
+			Component: RestoreState,
+			Action:    ActionRestore,
+			Detail:    fmt.Sprintf("%d keys change", len(diff.State)),
+		}, func() error {
+			erc.restoreOperationalState(snapshot.OperationalState)
+			return nil
+		})
+	}
+
+	if opts.DryRun {
+		erc.logger.Info("Restore dry run complete", "file", snapshotFile, "actions", len(report.Actions))
+	} else if err := report.Err(); err != nil {
+		erc.logger.Error("Restore from comprehensive snapshot incomplete", "file", snapshotFile, "error", err)
+	} else {
+		erc.logger.Info("Agent state successfully restored from comprehensive snapshot")
+	}
+	return report, nil
+}
+
+// restoreOperationalState replaces the quarantine list with the snapshot's.
+func (erc *ExtendedRecoveryController) restoreOperationalState(state map[string]interface{}) {
+	quarantine := make(map[string]time.Time)
+	if ql, ok := state["quarantine_list"].(map[string]interface{}); ok {
+		for k, v := range ql {
+			if t, ok := v.(string); ok {
+				if parsedTime, err := time.Parse(time.RFC3339, t); err == nil {
+					quarantine[k] = parsedTime
+				}
+			}
+		}
+	}
+	erc.mu.Lock()
+	erc.quarantineList = quarantine
+	erc.mu.Unlock()
+}
+
+// selectChanges keeps the changes to the named components, or all of them
+// when names is empty.
+func selectChanges(changes []ComponentChange, names []string) []ComponentChange {
+	if len(names) == 0 {
+		return changes
+	}
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+	var kept []ComponentChange
+	for _, c := range changes {
+		if selected[c.Name] {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
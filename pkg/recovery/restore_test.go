@@ -0,0 +1,147 @@
+package recovery
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	controllerManifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
+	"github.com/naviNBRuas/APA/pkg/module"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func testWasmManifest(name, version string, wasm []byte) *module.Manifest {
+	hash := sha256.Sum256(wasm)
+	return &module.Manifest{Name: name, Version: version, Hash: hex.EncodeToString(hash[:])}
+}
+
+// restoreFixture snapshots an agent running scanner 1.0 and ctl, then moves
+// the running agent on to scanner 2.0, an extra module and an extra
+// controller.
+func restoreFixture(t *testing.T) (*ExtendedRecoveryController, *MockModuleManagerService, *MockControllerManagerService, string, *[]byte) {
+	t.Helper()
+	modules := new(MockModuleManagerService)
+	controllers := new(MockControllerManagerService)
+	var applied []byte
+	config := map[string]interface{}{"log_level": "info"}
+	erc := NewExtendedRecoveryController(slog.Default(), config,
+		func(data []byte) error { applied = data; return nil },
+		new(MockP2PService), modules, controllers, t.TempDir())
+
+	modules.On("ListModules").Return([]*module.Manifest{testWasmManifest("scanner", "1.0.0", []byte("v1"))}).Once()
+	controllers.On("ListControllers").Return([]*controllerManifest.Manifest{{Name: "ctl", Version: "1.0"}}).Once()
+	erc.quarantineList["peer-a"] = time.Now().UTC().Truncate(time.Second)
+	file, err := erc.CreateComprehensiveSnapshot(context.Background(), "agent")
+	require.NoError(t, err)
+
+	erc.config = map[string]interface{}{"log_level": "debug"}
+	erc.quarantineList = map[string]time.Time{}
+	modules.On("ListModules").Return([]*module.Manifest{
+		testWasmManifest("scanner", "2.0.0", []byte("v2")),
+		testWasmManifest("extra", "1.0.0", []byte("extra")),
+	})
+	controllers.On("ListControllers").Return([]*controllerManifest.Manifest{{Name: "ctl", Version: "1.0"}, {Name: "ctl-extra", Version: "1.0"}})
+	return erc, modules, controllers, file, &applied
+}
+
+func TestRestoreComponentsDryRun(t *testing.T) {
+	erc, modules, controllers, file, applied := restoreFixture(t)
+
+	report, err := erc.RestoreComponents(context.Background(), file, RestoreOptions{DryRun: true})
+	require.NoError(t, err)
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []FieldChange{{Path: "log_level", Change: ChangeModified, From: "debug", To: "info"}}, report.Diff.Config)
+	assert.Len(t, report.Diff.Modules, 2)
+	assert.Len(t, report.Diff.Controllers, 1)
+	assert.Len(t, report.Diff.State, 1)
+
+	var actions []string
+	for _, a := range report.Actions {
+		assert.False(t, a.Done)
+		actions = append(actions, string(a.Component)+":"+a.Name+":"+a.Action)
+	}
+	assert.Equal(t, []string{
+		"config::apply",
+		"modules:extra:stop",
+		"modules:scanner:skip", // no module source
+		"controllers:ctl-extra:stop",
+		"state::restore",
+	}, actions)
+
+	// Nothing was touched.
+	assert.Nil(t, *applied)
+	assert.Empty(t, erc.ListQuarantined())
+	modules.AssertNotCalled(t, "StopModule", mock.Anything)
+	controllers.AssertNotCalled(t, "StopController", mock.Anything, mock.Anything)
+}
+
+func TestRestoreComponentsSelective(t *testing.T) {
+	erc, modules, _, file, applied := restoreFixture(t)
+	p2p := new(MockP2PService)
+	good, bad := peer.ID("good"), peer.ID("bad")
+	v1 := testWasmManifest("scanner", "1.0.0", []byte("v1"))
+	p2p.On("FetchModule", mock.Anything, bad, "scanner", "1.0.0").Return(testWasmManifest("scanner", "1.0.0", []byte("evil")), []byte("evil"), nil)
+	p2p.On("FetchModule", mock.Anything, good, "scanner", "1.0.0").Return(v1, []byte("v1"), nil)
+	erc.SetModuleSource(PeerModuleSource(p2p, bad, good))
+	modules.On("SaveAndLoadModule", v1, []byte("v1")).Return(nil)
+
+	// Only roll the scanner module back.
+	report, err := erc.RestoreComponents(context.Background(), file, RestoreOptions{
+		Components: []RestoreComponent{RestoreModules},
+		Modules:    []string{"scanner"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+	require.Len(t, report.Actions, 1)
+	assert.Equal(t, RestoreAction{Component: RestoreModules, Name: "scanner", Action: ActionInstall, Detail: "downgraded 1.0.0", Done: true}, report.Actions[0])
+	assert.Empty(t, report.Diff.Config)
+	assert.Nil(t, *applied, "config was not selected")
+	modules.AssertNotCalled(t, "StopModule", "extra")
+	modules.AssertCalled(t, "SaveAndLoadModule", v1, []byte("v1"))
+
+	// Failed steps are reported, and the rest still run.
+	modules.On("StopModule", "extra").Return(errors.New("busy"))
+	report, err = erc.RestoreComponents(context.Background(), file, RestoreOptions{
+		Components: []RestoreComponent{RestoreModules, RestoreState},
+		Modules:    []string{"extra"},
+	})
+	require.NoError(t, err)
+	require.Len(t, report.Actions, 2)
+	assert.Equal(t, "busy", report.Actions[0].Error)
+	assert.True(t, report.Actions[1].Done)
+	assert.ErrorContains(t, report.Err(), "busy")
+	assert.Equal(t, []string{"peer-a"}, erc.ListQuarantined())
+}
+
+func TestPeerModuleSourceNoPeers(t *testing.T) {
+	_, err := PeerModuleSource(new(MockP2PService))(context.Background(), &module.Manifest{Name: "m"})
+	assert.Error(t, err)
+}
+
+func TestRestoreComponentsSkipsUnchanged(t *testing.T) {
+	erc, _, _, file, applied := restoreFixture(t)
+	opts := RestoreOptions{Components: []RestoreComponent{RestoreConfig, RestoreState}}
+	report, err := erc.RestoreComponents(context.Background(), file, opts)
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+	require.NotNil(t, *applied)
+	erc.config = map[string]interface{}{"log_level": "info"} // as applied
+
+	// Restoring the same snapshot again changes nothing.
+	*applied = nil
+	report, err = erc.RestoreComponents(context.Background(), file, opts)
+	require.NoError(t, err)
+	require.NoError(t, report.Err())
+	assert.Equal(t, []RestoreAction{
+		{Component: RestoreConfig, Action: ActionSkip, Detail: "configuration unchanged"},
+		{Component: RestoreState, Action: ActionSkip, Detail: "operational state unchanged"},
+	}, report.Actions)
+	assert.Nil(t, *applied, "an unchanged config is not applied")
+}
@@ -8,12 +8,13 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"time"
 
+	"github.com/naviNBRuas/APA/pkg/backup"
 	controllerManifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
 	"github.com/naviNBRuas/APA/pkg/module"
-	"gopkg.in/yaml.v3"
 )
 
 // SnapshotData represents the complete state of the agent at a point in time
@@ -28,10 +29,27 @@ type SnapshotData struct {
 	Checksum         string                         `json:"checksum"`
 }
 
+// snapshotObjectDir is where snapshots are kept in the snapshot store.
+const snapshotObjectDir = "recovery-snapshots"
+
+// SnapshotStore keeps copies of snapshots off the host. backup.BackupManager
+// implements it, keeping them encrypted and authenticated in the backup
+// repository and so on every backup target.
+type SnapshotStore interface {
+	SaveObject(name string, data []byte) error
+	LoadObject(name string) ([]byte, error)
+	RemoveObject(name string) error
+	ListObjects(dir string) ([]string, error)
+}
+
+var _ SnapshotStore = (*backup.BackupManager)(nil)
+
 // ExtendedRecoveryController extends the RecoveryController with enhanced snapshot capabilities
 type ExtendedRecoveryController struct {
 	*RecoveryController
 	snapshotStoragePath string
+	store               SnapshotStore
+	moduleSource        ModuleSource
 }
 
 // NewExtendedRecoveryController creates a new ExtendedRecoveryController
@@ -51,38 +69,19 @@ func NewExtendedRecoveryController(
 	}
 }
 
+// SetSnapshotStore copies every snapshot to store as well as the local
+// directory, so snapshots survive the loss of the host disk. Snapshots hold
+// the agent's configuration, so store must encrypt and authenticate them,
+// as the backup repository does.
+func (erc *ExtendedRecoveryController) SetSnapshotStore(store SnapshotStore) {
+	erc.store = store
+}
+
 // CreateComprehensiveSnapshot creates a complete snapshot of the agent's state
 func (erc *ExtendedRecoveryController) CreateComprehensiveSnapshot(ctx context.Context, agentID string) (string, error) {
 	erc.logger.Info("Creating comprehensive agent snapshot", "agent_id", agentID)
 
-	// Gather all components for the snapshot
-	snapshot := &SnapshotData{
-		Timestamp:        time.Now(),
-		Version:          "1.0",
-		AgentID:          agentID,
-		Configuration:    erc.config,
-		Modules:          make([]*module.Manifest, 0),
-		Controllers:      make([]*controllerManifest.Manifest, 0),
-		OperationalState: make(map[string]interface{}),
-	}
-
-	// Collect module information
-	if erc.moduleManager != nil {
-		modules := erc.moduleManager.ListModules()
-		snapshot.Modules = modules
-		erc.logger.Debug("Collected module information", "module_count", len(modules))
-	}
-
-	// Collect controller information
-	if erc.controllerManager != nil {
-		controllers := erc.controllerManager.ListControllers()
-		snapshot.Controllers = controllers
-		erc.logger.Debug("Collected controller information", "controller_count", len(controllers))
-	}
-
-	// Collect operational state (this would be extended in a real implementation)
-	snapshot.OperationalState["quarantine_list"] = erc.quarantineList
-	snapshot.OperationalState["snapshot_timestamp"] = time.Now()
+	snapshot := erc.currentSnapshot(agentID)
 
 	// Calculate checksum for integrity verification
 	checksum, err := erc.calculateSnapshotChecksum(snapshot)
@@ -112,74 +111,106 @@ func (erc *ExtendedRecoveryController) CreateComprehensiveSnapshot(ctx context.C
 		return "", fmt.Errorf("failed to write snapshot file: %w", err)
 	}
 
+	if erc.store != nil {
+		if err := erc.store.SaveObject(path.Join(snapshotObjectDir, filename), data); err != nil {
+			return "", fmt.Errorf("failed to copy snapshot to store: %w", err)
+		}
+	}
+
 	erc.logger.Info("Comprehensive snapshot created successfully", "file", filepath)
 	return filepath, nil
 }
 
-// RestoreFromComprehensiveSnapshot restores the agent's state from a comprehensive snapshot
-func (erc *ExtendedRecoveryController) RestoreFromComprehensiveSnapshot(ctx context.Context, snapshotFile string) error {
-	erc.logger.Info("Restoring agent from comprehensive snapshot", "file", snapshotFile)
+// currentSnapshot captures the running agent's state, without a checksum.
+func (erc *ExtendedRecoveryController) currentSnapshot(agentID string) *SnapshotData {
+	snapshot := &SnapshotData{
+		Timestamp:        time.Now(),
+		Version:          "1.0",
+		AgentID:          agentID,
+		Configuration:    erc.config,
+		Modules:          make([]*module.Manifest, 0),
+		Controllers:      make([]*controllerManifest.Manifest, 0),
+		OperationalState: make(map[string]interface{}),
+	}
 
-	// Read snapshot data from file
+	// Collect module information
+	if erc.moduleManager != nil {
+		modules := erc.moduleManager.ListModules()
+		snapshot.Modules = modules
+		erc.logger.Debug("Collected module information", "module_count", len(modules))
+	}
+
+	// Collect controller information
+	if erc.controllerManager != nil {
+		controllers := erc.controllerManager.ListControllers()
+		snapshot.Controllers = controllers
+		erc.logger.Debug("Collected controller information", "controller_count", len(controllers))
+	}
+
+	// Collect operational state (this would be extended in a real implementation)
+	erc.mu.RLock()
+	quarantine := make(map[string]time.Time, len(erc.quarantineList))
+	for id, at := range erc.quarantineList {
+		quarantine[id] = at
+	}
+	erc.mu.RUnlock()
+	snapshot.OperationalState["quarantine_list"] = quarantine
+	snapshot.OperationalState["snapshot_timestamp"] = time.Now()
+	return snapshot
+}
+
+// LoadSnapshot reads a snapshot, falling back to the copy in the snapshot
+// store, and verifies its checksum.
+func (erc *ExtendedRecoveryController) LoadSnapshot(snapshotFile string) (*SnapshotData, error) {
 	data, err := os.ReadFile(snapshotFile)
+	if os.IsNotExist(err) && erc.store != nil {
+		erc.logger.Info("Snapshot missing locally, reading stored copy", "file", snapshotFile)
+		data, err = erc.store.LoadObject(path.Join(snapshotObjectDir, filepath.Base(snapshotFile)))
+	}
 	if err != nil {
-		return fmt.Errorf("failed to read snapshot file: %w", err)
+		return nil, fmt.Errorf("failed to read snapshot file: %w", err)
 	}
 
-	// Deserialize snapshot data
 	var snapshot SnapshotData
-	err = json.Unmarshal(data, &snapshot)
-	if err != nil {
-		return fmt.Errorf("failed to deserialize snapshot data: %w", err)
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to deserialize snapshot data: %w", err)
 	}
 
-	// Verify checksum
 	calculatedChecksum, err := erc.calculateSnapshotChecksum(&snapshot)
 	if err != nil {
-		return fmt.Errorf("failed to calculate snapshot checksum for verification: %w", err)
+		return nil, fmt.Errorf("failed to calculate snapshot checksum for verification: %w", err)
 	}
-
 	if calculatedChecksum != snapshot.Checksum {
-		return fmt.Errorf("snapshot checksum verification failed: expected %s, got %s", snapshot.Checksum, calculatedChecksum)
+		return nil, fmt.Errorf("snapshot checksum verification failed: expected %s, got %s", snapshot.Checksum, calculatedChecksum)
 	}
-
 	erc.logger.Info("Snapshot checksum verified successfully")
+	return &snapshot, nil
+}
 
-	// Restore configuration
-	configData, err := yaml.Marshal(snapshot.Configuration)
+// DiffSnapshotFiles reports what changed from one snapshot to another.
+func (erc *ExtendedRecoveryController) DiffSnapshotFiles(fromFile, toFile string) (*SnapshotDiff, error) {
+	from, err := erc.LoadSnapshot(fromFile)
 	if err != nil {
-		return fmt.Errorf("failed to marshal configuration data: %w", err)
-	}
-
-	if erc.applyConfigFunc == nil {
-		return fmt.Errorf("applyConfigFunc is not set in RecoveryController")
+		return nil, err
 	}
-
-	// Apply the configuration to reconfigure all components
-	if err := erc.applyConfigFunc(configData); err != nil {
-		return fmt.Errorf("failed to apply configuration during restore: %w", err)
+	to, err := erc.LoadSnapshot(toFile)
+	if err != nil {
+		return nil, err
 	}
+	return DiffSnapshots(from, to), nil
+}
 
-	// Restore modules (in a real implementation, this would involve fetching and loading module binaries)
-	erc.logger.Info("Would restore modules in a real implementation", "module_count", len(snapshot.Modules))
-
-	// Restore controllers (in a real implementation, this would involve fetching and loading controller binaries)
-	erc.logger.Info("Would restore controllers in a real implementation", "controller_count", len(snapshot.Controllers))
-
-	// Restore operational state
-	erc.quarantineList = make(map[string]time.Time)
-	if ql, ok := snapshot.OperationalState["quarantine_list"].(map[string]interface{}); ok {
-		for k, v := range ql {
-			if t, ok := v.(string); ok {
-				if parsedTime, err := time.Parse(time.RFC3339, t); err == nil {
-					erc.quarantineList[k] = parsedTime
-				}
-			}
-		}
+// RestoreFromComprehensiveSnapshot restores the agent's configuration and
+// operational state from a comprehensive snapshot. Use RestoreComponents to
+// restore modules and controllers, pick components, or preview a restore.
+func (erc *ExtendedRecoveryController) RestoreFromComprehensiveSnapshot(ctx context.Context, snapshotFile string) error {
+	report, err := erc.RestoreComponents(ctx, snapshotFile, RestoreOptions{
+		Components: []RestoreComponent{RestoreConfig, RestoreState},
+	})
+	if err != nil {
+		return err
 	}
-
-	erc.logger.Info("Agent state successfully restored from comprehensive snapshot")
-	return nil
+	return report.Err()
 }
 
 // ListSnapshots lists all available snapshots
@@ -207,6 +238,21 @@ func (erc *ExtendedRecoveryController) ListSnapshots() ([]string, error) {
 		}
 	}
 
+	// Add snapshots only the store still holds; restoring them reads the
+	// stored copy
+	if erc.store != nil {
+		names, err := erc.store.ListObjects(snapshotObjectDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list stored snapshots: %w", err)
+		}
+		for _, name := range names {
+			local := filepath.Join(erc.snapshotStoragePath, path.Base(name))
+			if _, err := os.Stat(local); os.IsNotExist(err) {
+				snapshots = append(snapshots, local)
+			}
+		}
+	}
+
 	erc.logger.Info("Found snapshots", "count", len(snapshots))
 	return snapshots, nil
 }
@@ -232,9 +278,14 @@ func (erc *ExtendedRecoveryController) DeleteSnapshot(snapshotFile string) error
 	}
 
 	err = os.Remove(snapshotFile)
-	if err != nil {
+	if err != nil && !(os.IsNotExist(err) && erc.store != nil) {
 		return fmt.Errorf("failed to delete snapshot file: %w", err)
 	}
+	if erc.store != nil {
+		if err := erc.store.RemoveObject(path.Join(snapshotObjectDir, filepath.Base(snapshotFile))); err != nil {
+			return fmt.Errorf("failed to delete stored snapshot: %w", err)
+		}
+	}
 
 	erc.logger.Info("Snapshot deleted successfully", "file", snapshotFile)
 	return nil
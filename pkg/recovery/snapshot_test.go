@@ -2,12 +2,14 @@ package recovery
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/naviNBRuas/APA/pkg/backup"
 	controllerManifest "github.com/naviNBRuas/APA/pkg/controller/manifest"
 	"github.com/naviNBRuas/APA/pkg/module"
 	"github.com/stretchr/testify/assert"
@@ -140,6 +142,62 @@ func TestRestoreFromComprehensiveSnapshot(t *testing.T) {
 	mockControllerManager.AssertExpectations(t)
 }
 
+func TestSnapshotSurvivesLossOfLocalDisk(t *testing.T) {
+	tempDir := t.TempDir()
+	var applied []byte
+	mockModuleManager := new(MockModuleManagerService)
+	mockControllerManager := new(MockControllerManagerService)
+	mockModuleManager.On("ListModules").Return([]*module.Manifest{})
+	mockControllerManager.On("ListControllers").Return([]*controllerManifest.Manifest{})
+
+	controller := NewExtendedRecoveryController(
+		slog.Default(),
+		map[string]interface{}{"test": "config"},
+		func(configData []byte) error { applied = configData; return nil },
+		new(MockP2PService),
+		mockModuleManager,
+		mockControllerManager,
+		tempDir,
+	)
+	target := backup.NewMemoryTarget()
+	repo := backup.NewBackupManager(slog.Default(), t.TempDir(), "test-passphrase")
+	repo.SetTarget(target)
+	controller.SetSnapshotStore(repo)
+
+	ctx := context.Background()
+	snapshotPath, err := controller.CreateComprehensiveSnapshot(ctx, "test-agent")
+	assert.NoError(t, err)
+	names, err := repo.ListObjects("recovery-snapshots")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"recovery-snapshots/" + filepath.Base(snapshotPath)}, names)
+
+	// The target holds the snapshot only encrypted.
+	stored := "objects/recovery-snapshots/" + filepath.Base(snapshotPath)
+	sealed, err := target.Load(stored)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(sealed), "config")
+
+	// Lose the local copy: the snapshot is still listed and restorable.
+	controller.config = map[string]interface{}{"test": "changed"}
+	assert.NoError(t, os.Remove(snapshotPath))
+	snapshots, err := controller.ListSnapshots()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{snapshotPath}, snapshots)
+	assert.NoError(t, controller.RestoreFromComprehensiveSnapshot(ctx, snapshotPath))
+	assert.Contains(t, string(applied), "test: config")
+
+	// A snapshot forged on the target is refused.
+	forged, err := json.Marshal(map[string]interface{}{"configuration": map[string]string{"evil": "config"}})
+	assert.NoError(t, err)
+	assert.NoError(t, target.Save(stored, forged))
+	assert.Error(t, controller.RestoreFromComprehensiveSnapshot(ctx, snapshotPath))
+
+	assert.NoError(t, controller.DeleteSnapshot(snapshotPath))
+	names, err = repo.ListObjects("recovery-snapshots")
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
 func TestListSnapshots(t *testing.T) {
 	// Create temporary directory for snapshots
 	tempDir, err := os.MkdirTemp("", "snapshots")
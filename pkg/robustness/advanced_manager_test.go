@@ -11,6 +11,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
 )
 
 func TestNewRobustnessManager_NilLogger(t *testing.T) {
@@ -1892,3 +1894,52 @@ func TestRobustnessConfig_DeepCopy(t *testing.T) {
 	cfg1.EnableErrorHandling = false
 	assert.NotEqual(t, cfg1.EnableErrorHandling, cfg2.EnableErrorHandling)
 }
+
+type recordingSink struct {
+	mu     sync.Mutex
+	alerts []alerting.Alert
+}
+
+func (s *recordingSink) Raise(alert alerting.Alert) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = append(s.alerts, alert)
+}
+
+func TestAlertManager_SendRoutesBySeverityAndComponent(t *testing.T) {
+	t.Parallel()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	am := NewAlertManager(logger)
+
+	all := &recordingSink{}
+	pager := &recordingSink{}
+	am.AddChannel(AlertChannel{Name: "all", MinSeverity: AlertLow, Sink: all})
+	am.AddChannel(AlertChannel{Name: "pager", MinSeverity: AlertHigh, Sink: pager})
+
+	assert.Equal(t, 1, am.Send(&HealthAlert{Component: "network", Severity: AlertMedium, Status: HealthDegraded}))
+	assert.Equal(t, 2, am.Send(&HealthAlert{Component: "storage", Severity: AlertCritical, Status: HealthCritical, Message: "disk failed"}))
+
+	am.RouteComponent("storage", "pager")
+	assert.Equal(t, 0, am.Send(&HealthAlert{Component: "storage", Severity: AlertLow}))
+	assert.Equal(t, 0, am.Send(nil))
+
+	require.Len(t, all.alerts, 2)
+	require.Len(t, pager.alerts, 1)
+	assert.Equal(t, alerting.SeverityCritical, pager.alerts[0].Severity)
+	assert.Equal(t, "storage", pager.alerts[0].Labels["component"])
+	assert.Equal(t, "disk failed", pager.alerts[0].Summary)
+}
+
+func TestRobustnessManager_HandleAlertForwardsToChannels(t *testing.T) {
+	t.Parallel()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+	rm, err := NewRobustnessManager(logger, RobustnessConfig{EnableHealthMonitoring: true})
+	require.NoError(t, err)
+
+	sink := &recordingSink{}
+	rm.AddAlertChannel(AlertChannel{Name: "ops", MinSeverity: AlertMedium, Sink: sink})
+	rm.handleAlert(&HealthAlert{Component: "cpu", Severity: AlertHigh, Status: HealthDegraded})
+
+	require.Len(t, sink.alerts, 1)
+	assert.Equal(t, "HealthAlert", sink.alerts[0].Name)
+}
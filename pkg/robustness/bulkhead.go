@@ -0,0 +1,81 @@
+package robustness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrBulkheadFull is returned when a bulkhead has no free slot and its
+// waiting queue is full.
+var ErrBulkheadFull = errors.New("bulkhead is full")
+
+// Bulkhead limits how many calls run at once, so that one slow dependency
+// cannot tie up every goroutine that calls it. Up to maxWaiting further
+// calls wait for a slot; the rest fail at once with ErrBulkheadFull.
+type Bulkhead struct {
+	name       string
+	slots      chan struct{}
+	maxWaiting int
+
+	mu      sync.Mutex
+	waiting int
+}
+
+// NewBulkhead returns a bulkhead with maxConcurrent slots (at least one).
+func NewBulkhead(name string, maxConcurrent, maxWaiting int) *Bulkhead {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	if maxWaiting < 0 {
+		maxWaiting = 0
+	}
+	return &Bulkhead{name: name, slots: make(chan struct{}, maxConcurrent), maxWaiting: maxWaiting}
+}
+
+// Middleware runs calls within the bulkhead's limits.
+func (b *Bulkhead) Middleware() Middleware {
+	return func(next Operation) Operation {
+		return func(ctx context.Context) error {
+			if err := b.acquire(ctx); err != nil {
+				return err
+			}
+			defer func() { <-b.slots }()
+			return next(ctx)
+		}
+	}
+}
+
+// InFlight returns the number of calls holding a slot.
+func (b *Bulkhead) InFlight() int {
+	return len(b.slots)
+}
+
+func (b *Bulkhead) acquire(ctx context.Context) error {
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	b.mu.Lock()
+	if b.waiting >= b.maxWaiting {
+		b.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrBulkheadFull, b.name)
+	}
+	b.waiting++
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.waiting--
+		b.mu.Unlock()
+	}()
+
+	select {
+	case b.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,31 +1,82 @@
 package robustness
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
 	"time"
+
+	apametrics "github.com/naviNBRuas/APA/pkg/metrics"
 )
 
+// CircuitBreaker keeps one breaker per name. A breaker opens after
+// FailureThreshold consecutive failures, or when the failure rate over the
+// last MetricsWindow reaches FailureRateThreshold. While open, calls fail
+// fast with ErrCircuitOpen. After the open timeout up to HalfOpenMaxCalls
+// probes are let through; SuccessThreshold successful probes close the
+// breaker and a failed probe opens it again for twice as long, up to
+// ResetTimeout.
 type CircuitBreaker struct {
 	logger   *slog.Logger
 	config   CircuitBreakerConfig
 	breakers map[string]*CircuitState
 	metrics  *CircuitMetrics
+	recorder *apametrics.Metrics
+	now      func() time.Time
 
 	mu sync.RWMutex
 }
 
 type CircuitBreakerConfig struct {
-	FailureThreshold int           `yaml:"failure_threshold"`
-	SuccessThreshold int           `yaml:"success_threshold"`
-	Timeout          time.Duration `yaml:"timeout"`
-	HalfOpenMaxCalls int           `yaml:"half_open_max_calls"`
-	ResetTimeout     time.Duration `yaml:"reset_timeout"`
-	MetricsWindow    time.Duration `yaml:"metrics_window"`
+	FailureThreshold     int           `yaml:"failure_threshold"`
+	FailureRateThreshold float64       `yaml:"failure_rate_threshold"`
+	MinimumCalls         int           `yaml:"minimum_calls"`
+	SuccessThreshold     int           `yaml:"success_threshold"`
+	Timeout              time.Duration `yaml:"timeout"`
+	HalfOpenMaxCalls     int           `yaml:"half_open_max_calls"`
+	ResetTimeout         time.Duration `yaml:"reset_timeout"`
+	MetricsWindow        time.Duration `yaml:"metrics_window"`
 }
 
+// WithDefaults fills unset fields: 5 consecutive failures, a 50% failure
+// rate over at least 10 calls in a 1m window, 30s open, one probe at a time
+// and one success to close, and at most 5m open.
+func (c CircuitBreakerConfig) WithDefaults() CircuitBreakerConfig {
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 5
+	}
+	if c.FailureRateThreshold <= 0 {
+		c.FailureRateThreshold = 0.5
+	}
+	if c.MinimumCalls <= 0 {
+		c.MinimumCalls = 10
+	}
+	if c.SuccessThreshold <= 0 {
+		c.SuccessThreshold = 1
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.HalfOpenMaxCalls <= 0 {
+		c.HalfOpenMaxCalls = 1
+	}
+	if c.ResetTimeout < c.Timeout {
+		c.ResetTimeout = 5 * time.Minute
+		if c.ResetTimeout < c.Timeout {
+			c.ResetTimeout = c.Timeout
+		}
+	}
+	if c.MetricsWindow <= 0 {
+		c.MetricsWindow = time.Minute
+	}
+	return c
+}
+
+// CircuitState is one named breaker. FailureCount counts consecutive
+// failures while closed; SuccessCount counts successful probes while half
+// open. Timeout is how long the breaker stays open the next time it opens.
 type CircuitState struct {
 	Name         string           `json:"name"`
 	State        CircuitStateEnum `json:"state"`
@@ -35,6 +86,9 @@ type CircuitState struct {
 	NextRetry    time.Time        `json:"next_retry"`
 	Timeout      time.Duration    `json:"timeout"`
 	Metrics      *CircuitMetrics  `json:"metrics"`
+
+	window *slidingWindow
+	probes int // half-open calls in flight
 }
 
 type CircuitMetrics struct {
@@ -52,11 +106,34 @@ type CircuitBreakerState struct{}
 var ErrCircuitOpen = errors.New("circuit breaker is open")
 
 func NewCircuitBreaker(logger *slog.Logger, config CircuitBreakerConfig) *CircuitBreaker {
-	return &CircuitBreaker{logger: logger, config: config, breakers: make(map[string]*CircuitState), metrics: &CircuitMetrics{}}
+	return &CircuitBreaker{logger: logger, config: config, breakers: make(map[string]*CircuitState), metrics: &CircuitMetrics{}, now: time.Now}
 }
 
 func (cb *CircuitBreaker) Execute(fn func() error) error {
-	return cb.executeForBreaker("default", fn)
+	return cb.ExecuteContext(context.Background(), "default", func(context.Context) error { return fn() })
+}
+
+// ExecuteContext runs op through the breaker with the given name.
+func (cb *CircuitBreaker) ExecuteContext(ctx context.Context, name string, op Operation) error {
+	return Run(ctx, cb.Middleware(name), op)
+}
+
+// Middleware guards an operation with the breaker with the given name.
+// Calls cancelled by the caller count neither as failures nor as successes;
+// errors marked Permanent count as successes.
+func (cb *CircuitBreaker) Middleware(name string) Middleware {
+	return func(next Operation) Operation {
+		return func(ctx context.Context) error {
+			state, probe, err := cb.acquire(name)
+			if err != nil {
+				return err
+			}
+			start := cb.now()
+			err = next(ctx)
+			cb.release(state, probe, start, err, ctx.Err() != nil)
+			return err
+		}
+	}
 }
 
 func (cb *CircuitBreaker) ExecuteWithFallback(fn func() error, fallback func() error) error {
@@ -76,6 +153,13 @@ func (cb *CircuitBreaker) ExecuteWithFallback(fn func() error, fallback func() e
 	return err
 }
 
+// SetMetrics sets the registry that breaker state transitions are exported to.
+func (cb *CircuitBreaker) SetMetrics(m *apametrics.Metrics) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.recorder = m
+}
+
 func (cb *CircuitBreaker) Reset() {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
@@ -85,12 +169,21 @@ func (cb *CircuitBreaker) Reset() {
 }
 
 func (cb *CircuitBreaker) GetState() CircuitStateEnum {
+	return cb.State("default")
+}
+
+// State returns the state of the named breaker. Breakers that have not seen
+// a call yet are closed.
+func (cb *CircuitBreaker) State(name string) CircuitStateEnum {
 	cb.mu.RLock()
 	defer cb.mu.RUnlock()
-	state, exists := cb.breakers["default"]
+	state, exists := cb.breakers[name]
 	if !exists {
 		return CircuitClosed
 	}
+	if state.State == CircuitOpen && !cb.now().Before(state.NextRetry) {
+		return CircuitHalfOpen
+	}
 	return state.State
 }
 
@@ -108,105 +201,176 @@ func (cb *CircuitBreaker) Shutdown() {
 	cb.logger.Debug("circuit breaker shut down")
 }
 
-func (cb *CircuitBreaker) executeForBreaker(name string, fn func() error) error {
+// acquire admits a call to the named breaker or rejects it. probe reports
+// whether the call was admitted as a half-open probe.
+func (cb *CircuitBreaker) acquire(name string) (state *CircuitState, probe bool, err error) {
 	cb.mu.Lock()
-	state := cb.getOrCreateState(name)
-
-	if !state.allow() {
+	defer cb.mu.Unlock()
+	if cb.breakers == nil {
+		return nil, false, fmt.Errorf("%w: %s (shut down)", ErrCircuitOpen, name)
+	}
+	state = cb.getOrCreateState(name)
+	before := state.State
+	allowed := state.allow(cb.config.WithDefaults(), cb.now())
+	cb.transitioned(state, before)
+	if !allowed {
 		cb.metrics.RejectCalls++
-		cb.mu.Unlock()
-		return ErrCircuitOpen
+		return nil, false, fmt.Errorf("%w: %s", ErrCircuitOpen, name)
 	}
+	return state, state.State == CircuitHalfOpen, nil
+}
 
-	start := time.Now()
-	cb.mu.Unlock()
-
-	err := fn()
-
-	elapsed := time.Since(start)
-
+// release records the outcome of a call admitted by acquire.
+func (cb *CircuitBreaker) release(state *CircuitState, probe bool, start time.Time, err error, cancelled bool) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
-
+	now := cb.now()
+	if cb.metrics == nil {
+		return
+	}
 	cb.metrics.TotalCalls++
-	avg := (cb.metrics.AverageLatency.Nanoseconds()*cb.metrics.TotalCalls + elapsed.Nanoseconds()) / (cb.metrics.TotalCalls + 1)
-	cb.metrics.AverageLatency = time.Duration(avg)
-	cb.metrics.TotalCalls++ // increment after avg calculation
+	elapsed := now.Sub(start)
+	cb.metrics.AverageLatency += (elapsed - cb.metrics.AverageLatency) / time.Duration(cb.metrics.TotalCalls)
 
-	if err != nil {
+	cfg := cb.config.WithDefaults()
+	before := state.State
+	switch {
+	case err == nil || IsPermanent(err):
+		// A permanent error, such as a 404, means the dependency answered.
+		cb.metrics.SuccessCalls++
+		state.onSuccess(cfg, now, probe)
+	case cancelled:
+		// The caller gave up; that says nothing about the dependency.
+		state.release(probe)
+	default:
 		cb.metrics.FailureCalls++
-		cb.metrics.LastErrorTime = time.Now()
-		state.onFailure(cb.config)
-		return err
+		if errors.Is(err, context.DeadlineExceeded) {
+			cb.metrics.TimeoutCalls++
+		}
+		cb.metrics.LastErrorTime = now
+		state.onFailure(cfg, now, probe)
 	}
+	cb.transitioned(state, before)
+}
 
-	cb.metrics.SuccessCalls++
-	state.onSuccess(cb.config)
-	return nil
+// transitioned logs and exports a state change.
+func (cb *CircuitBreaker) transitioned(state *CircuitState, before CircuitStateEnum) {
+	if state.State == before {
+		return
+	}
+	cb.recorder.SetCircuitBreakerState(state.Name, string(state.State))
+	switch state.State {
+	case CircuitOpen:
+		cb.logger.Warn("Circuit breaker opened", "breaker", state.Name, "retry_at", state.NextRetry)
+	case CircuitClosed:
+		cb.logger.Info("Circuit breaker closed", "breaker", state.Name)
+	default:
+		cb.logger.Debug("Circuit breaker probing", "breaker", state.Name)
+	}
 }
 
 func (cb *CircuitBreaker) getOrCreateState(name string) *CircuitState {
 	state, exists := cb.breakers[name]
 	if !exists {
+		cfg := cb.config.WithDefaults()
 		state = &CircuitState{
 			Name:    name,
 			State:   CircuitClosed,
-			Timeout: cb.config.Timeout,
+			Timeout: cfg.Timeout,
 			Metrics: cb.metrics,
+			window:  newSlidingWindow(cfg.MetricsWindow),
 		}
 		cb.breakers[name] = state
 	}
 	return state
 }
 
-func (cs *CircuitState) allow() bool {
+func (cs *CircuitState) allow(config CircuitBreakerConfig, now time.Time) bool {
 	switch cs.State {
 	case CircuitClosed:
 		return true
 	case CircuitOpen:
-		if time.Now().After(cs.NextRetry) {
-			cs.State = CircuitHalfOpen
-			return true
+		if now.Before(cs.NextRetry) {
+			return false
 		}
-		return false
+		cs.State = CircuitHalfOpen
+		cs.SuccessCount = 0
+		cs.probes = 0
+		fallthrough
 	case CircuitHalfOpen:
-		return cs.SuccessCount < 1
+		if cs.probes >= config.HalfOpenMaxCalls {
+			return false
+		}
+		cs.probes++
+		return true
 	default:
 		return false
 	}
 }
 
-func (cs *CircuitState) onFailure(config CircuitBreakerConfig) {
-	cs.FailureCount++
-	cs.LastError = time.Now()
+// release gives back a half-open probe slot without recording an outcome.
+func (cs *CircuitState) release(probe bool) {
+	if probe && cs.State == CircuitHalfOpen && cs.probes > 0 {
+		cs.probes--
+	}
+}
+
+func (cs *CircuitState) onFailure(config CircuitBreakerConfig, now time.Time, probe bool) {
+	cs.LastError = now
+	if cs.window == nil {
+		cs.window = newSlidingWindow(config.MetricsWindow)
+	}
+	cs.window.add(now, true)
 
 	switch cs.State {
 	case CircuitClosed:
-		if config.FailureThreshold > 0 && cs.FailureCount >= config.FailureThreshold {
-			cs.State = CircuitOpen
-			timeout := config.Timeout
-			if timeout <= 0 {
-				timeout = 30 * time.Second
-			}
-			cs.NextRetry = time.Now().Add(timeout)
+		cs.FailureCount++
+		calls, failures := cs.window.counts(now)
+		tripped := cs.FailureCount >= config.FailureThreshold ||
+			(calls >= int64(config.MinimumCalls) && float64(failures)/float64(calls) >= config.FailureRateThreshold)
+		if tripped {
+			cs.open(config.Timeout, now)
 		}
 	case CircuitHalfOpen:
-		cs.State = CircuitOpen
-		cs.NextRetry = time.Now().Add(config.Timeout)
+		if !probe {
+			return
+		}
+		timeout := cs.Timeout * 2
+		if timeout > config.ResetTimeout {
+			timeout = config.ResetTimeout
+		}
+		cs.open(timeout, now)
 	}
 }
 
-func (cs *CircuitState) onSuccess(config CircuitBreakerConfig) {
-	cs.SuccessCount++
+func (cs *CircuitState) onSuccess(config CircuitBreakerConfig, now time.Time, probe bool) {
+	if cs.window == nil {
+		cs.window = newSlidingWindow(config.MetricsWindow)
+	}
+	cs.window.add(now, false)
 
 	switch cs.State {
 	case CircuitHalfOpen:
-		if config.SuccessThreshold > 0 && cs.SuccessCount >= config.SuccessThreshold {
+		if !probe {
+			return
+		}
+		cs.release(probe)
+		cs.SuccessCount++
+		if cs.SuccessCount >= config.SuccessThreshold {
 			cs.State = CircuitClosed
 			cs.FailureCount = 0
 			cs.SuccessCount = 0
+			cs.Timeout = config.Timeout
+			cs.window.reset()
 		}
 	case CircuitClosed:
 		cs.FailureCount = 0
 	}
 }
+
+func (cs *CircuitState) open(timeout time.Duration, now time.Time) {
+	cs.State = CircuitOpen
+	cs.Timeout = timeout
+	cs.NextRetry = now.Add(timeout)
+	cs.probes = 0
+}
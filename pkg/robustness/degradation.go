@@ -1,11 +1,16 @@
 package robustness
 
 import (
+	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 	"time"
 )
 
+// maxDegradationHistory bounds the level changes kept in memory.
+const maxDegradationHistory = 100
+
 type DegradationManager struct {
 	logger            *slog.Logger
 	config            DegradationConfig
@@ -17,10 +22,91 @@ type DegradationManager struct {
 	mu                 sync.RWMutex
 	currentLevel       DegradationLevel
 	degradationHistory []*DegradationEvent
+	calmSince          time.Time
+	handlers           []DegradationHandler
+	now                func() time.Time
 	shutdown           bool
 }
 
-type DegradationConfig struct{}
+// DegradationHandler is called after the level changes. profile is nil
+// when the level returns to none.
+type DegradationHandler func(from, to DegradationLevel, profile *DegradationProfile)
+
+// DegradationConfig describes when each degradation level is entered and
+// what it sheds. Without profiles the level is never raised by assessment.
+type DegradationConfig struct {
+	Enabled       bool                 `yaml:"enabled"`
+	Interval      time.Duration        `yaml:"interval"`       // how often pressure is sampled
+	Hysteresis    float64              `yaml:"hysteresis"`     // percentage points usage must fall below a threshold to leave its level
+	RecoveryDelay time.Duration        `yaml:"recovery_delay"` // how long pressure must stay low before stepping down
+	Profiles      []DegradationProfile `yaml:"profiles"`
+}
+
+// Degradation features that a profile can disable.
+const (
+	FeatureNonCriticalModules  = "non_critical_modules"
+	FeatureOptionalControllers = "optional_controllers"
+)
+
+// DefaultDegradationProfiles sheds progressively more as CPU, memory or
+// disk usage rises.
+var DefaultDegradationProfiles = []DegradationProfile{
+	{Level: DegradationMinimal, Enter: PressureThresholds{CPU: 70, Memory: 75, Disk: 85}, IntervalFactor: 2},
+	{Level: DegradationModerate, Enter: PressureThresholds{CPU: 80, Memory: 85, Disk: 90}, IntervalFactor: 4,
+		DisabledFeatures: []string{FeatureOptionalControllers}},
+	{Level: DegradationSevere, Enter: PressureThresholds{CPU: 90, Memory: 92, Disk: 95}, IntervalFactor: 8,
+		DisabledFeatures: []string{FeatureOptionalControllers, FeatureNonCriticalModules}},
+	{Level: DegradationCritical, Enter: PressureThresholds{CPU: 97, Memory: 97, Disk: 98}, IntervalFactor: 16,
+		DisabledFeatures: []string{FeatureOptionalControllers, FeatureNonCriticalModules}},
+}
+
+// WithDefaults fills unset fields: sampling every 15s, 10 points of
+// hysteresis, a one minute recovery delay and DefaultDegradationProfiles.
+func (c DegradationConfig) WithDefaults() DegradationConfig {
+	if c.Interval <= 0 {
+		c.Interval = 15 * time.Second
+	}
+	if c.Hysteresis <= 0 {
+		c.Hysteresis = 10
+	}
+	if c.RecoveryDelay <= 0 {
+		c.RecoveryDelay = time.Minute
+	}
+	if len(c.Profiles) == 0 {
+		c.Profiles = DefaultDegradationProfiles
+	}
+	return c
+}
+
+// Validate checks that every profile names a distinct level above none and
+// that thresholds and interval factors are in range.
+func (c DegradationConfig) Validate() error {
+	if c.Hysteresis < 0 || c.Hysteresis >= 100 {
+		return fmt.Errorf("degradation hysteresis must be between 0 and 100, got %v", c.Hysteresis)
+	}
+	seen := make(map[DegradationLevel]bool)
+	for _, p := range c.Profiles {
+		if p.Level.Rank() <= 0 {
+			return fmt.Errorf("degradation profile has invalid level %q", p.Level)
+		}
+		if seen[p.Level] {
+			return fmt.Errorf("duplicate degradation profile for level %q", p.Level)
+		}
+		seen[p.Level] = true
+		for name, v := range map[string]float64{"cpu": p.Enter.CPU, "memory": p.Enter.Memory, "disk": p.Enter.Disk} {
+			if v < 0 || v > 100 {
+				return fmt.Errorf("degradation profile %q: %s threshold must be between 0 and 100", p.Level, name)
+			}
+		}
+		if p.IntervalFactor != 0 && p.IntervalFactor < 1 {
+			return fmt.Errorf("degradation profile %q: interval_factor must be at least 1", p.Level)
+		}
+		if p.Enter == (PressureThresholds{}) && p.QualityTargets.ErrorRate <= 0 && p.QualityTargets.ResponseTime <= 0 {
+			return fmt.Errorf("degradation profile %q has no entry threshold", p.Level)
+		}
+	}
+	return nil
+}
 
 type ModeSelector struct {
 	logger      *slog.Logger
@@ -46,8 +132,12 @@ type QualityManager struct {
 	mu             sync.RWMutex
 }
 
+// DegradationProfile is entered when any of its Enter thresholds is reached
+// or a quality target is missed, and names what is shed while it is active.
 type DegradationProfile struct {
 	Level             DegradationLevel    `yaml:"level"`
+	Enter             PressureThresholds  `yaml:"enter"`
+	IntervalFactor    float64             `yaml:"interval_factor"` // stretches gossip, heartbeat and flush intervals
 	ResourceLimits    ResourceLimits      `yaml:"resource_limits"`
 	ServicePriorities map[ServiceType]int `yaml:"service_priorities"`
 	QualityTargets    QualityTargets      `yaml:"quality_targets"`
@@ -56,6 +146,16 @@ type DegradationProfile struct {
 	Timeouts          TimeoutConfig       `yaml:"timeouts"`
 }
 
+// PressureThresholds are resource usage percentages. Zero disables a
+// threshold.
+type PressureThresholds struct {
+	CPU    float64 `yaml:"cpu_percent"`
+	Memory float64 `yaml:"memory_percent"`
+	Disk   float64 `yaml:"disk_percent"`
+}
+
+// QualityTargets that are set also trigger their profile: an error rate
+// above ErrorRate or a response time above ResponseTime.
 type QualityTargets struct {
 	ResponseTime time.Duration `yaml:"response_time"`
 	ErrorRate    float64       `yaml:"error_rate"`
@@ -92,7 +192,7 @@ type QualityController struct{}
 type ServicePrioritizer struct{}
 
 func NewDegradationManager(logger *slog.Logger, config DegradationConfig) *DegradationManager {
-	return &DegradationManager{
+	dm := &DegradationManager{
 		logger:             logger,
 		config:             config,
 		degradationLevels:  make(map[DegradationLevel]*DegradationProfile),
@@ -101,7 +201,13 @@ func NewDegradationManager(logger *slog.Logger, config DegradationConfig) *Degra
 		qualityManager:     NewQualityManager(logger),
 		currentLevel:       DegradationNone,
 		degradationHistory: make([]*DegradationEvent, 0),
+		now:                time.Now,
+	}
+	for i := range config.Profiles {
+		p := config.Profiles[i]
+		dm.degradationLevels[p.Level] = &p
 	}
+	return dm
 }
 
 func NewModeSelector(logger *slog.Logger) *ModeSelector {
@@ -131,26 +237,164 @@ func NewQualityManager(logger *slog.Logger) *QualityManager {
 	}
 }
 
+// Rank orders degradation levels from none (0) to critical (4). Unknown
+// levels rank below none.
+func (l DegradationLevel) Rank() int {
+	switch l {
+	case DegradationNone:
+		return 0
+	case DegradationMinimal:
+		return 1
+	case DegradationModerate:
+		return 2
+	case DegradationSevere:
+		return 3
+	case DegradationCritical:
+		return 4
+	}
+	return -1
+}
+
+// OnChange registers a handler called after every level change.
+func (dm *DegradationManager) OnChange(h DegradationHandler) {
+	dm.mu.Lock()
+	dm.handlers = append(dm.handlers, h)
+	dm.mu.Unlock()
+}
+
+// Profile returns the profile configured for level, or nil.
+func (dm *DegradationManager) Profile(level DegradationLevel) *DegradationProfile {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	return dm.degradationLevels[level]
+}
+
+// AssessDegradationLevel returns the level metrics call for. Rising
+// pressure raises the level at once. While a level is active its thresholds
+// are lowered by the hysteresis, and the level only steps down once
+// pressure has stayed below them for the recovery delay.
 func (dm *DegradationManager) AssessDegradationLevel(metrics *HealthMetrics) DegradationLevel {
-	return DegradationNone
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+	if metrics == nil {
+		return dm.currentLevel
+	}
+
+	profiles := make([]*DegradationProfile, 0, len(dm.degradationLevels))
+	for _, p := range dm.degradationLevels {
+		profiles = append(profiles, p)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Level.Rank() < profiles[j].Level.Rank() })
+
+	current := dm.currentLevel
+	target := DegradationNone
+	for _, p := range profiles {
+		margin := 0.0
+		if p.Level.Rank() <= current.Rank() {
+			margin = dm.config.Hysteresis
+		}
+		if p.pressured(metrics, margin) {
+			target = p.Level
+		}
+	}
+
+	if target.Rank() >= current.Rank() {
+		dm.calmSince = time.Time{}
+		return target
+	}
+	now := dm.now()
+	if dm.calmSince.IsZero() {
+		dm.calmSince = now
+	}
+	if now.Sub(dm.calmSince) < dm.config.RecoveryDelay {
+		return current
+	}
+	dm.calmSince = time.Time{}
+	return target
 }
 
-func (dm *DegradationManager) ApplyDegradation(level DegradationLevel) {
-	if level == dm.currentLevel {
-		return
+// pressured reports whether metrics reach any of the profile's thresholds,
+// each lowered by margin percentage points.
+func (p *DegradationProfile) pressured(metrics *HealthMetrics, margin float64) bool {
+	if u := metrics.ResourceUsage; u != nil {
+		for _, c := range []struct{ usage, threshold float64 }{
+			{u.CPU, p.Enter.CPU},
+			{u.Memory, p.Enter.Memory},
+			{u.Disk, p.Enter.Disk},
+		} {
+			if c.threshold > 0 && c.usage >= c.threshold-margin {
+				return true
+			}
+		}
 	}
+	q := p.QualityTargets
+	if q.ErrorRate > 0 && metrics.ErrorRate > q.ErrorRate {
+		return true
+	}
+	return q.ResponseTime > 0 && metrics.ResponseTime > q.ResponseTime
+}
+
+// ApplyDegradation switches to level and calls the registered handlers.
+// Returning to none marks the episode's history entries as recovered.
+func (dm *DegradationManager) ApplyDegradation(level DegradationLevel) {
+	dm.applyDegradation(level, "metric-based assessment", nil)
+}
+
+// ApplyAssessment switches to level, recording the metrics that triggered
+// the change.
+func (dm *DegradationManager) ApplyAssessment(level DegradationLevel, metrics *HealthMetrics) {
+	dm.applyDegradation(level, "metric-based assessment", metrics)
+}
+
+func (dm *DegradationManager) applyDegradation(level DegradationLevel, trigger string, metrics *HealthMetrics) {
 	dm.mu.Lock()
 	fromLevel := dm.currentLevel
+	if level == fromLevel || dm.shutdown {
+		dm.mu.Unlock()
+		return
+	}
+	now := dm.now()
 	dm.currentLevel = level
+	dm.calmSince = time.Time{}
+	if level == DegradationNone {
+		for i := len(dm.degradationHistory) - 1; i >= 0 && !dm.degradationHistory[i].Recovered; i-- {
+			e := dm.degradationHistory[i]
+			e.Recovered = true
+			e.RecoveryTime = now
+			e.Duration = now.Sub(e.Timestamp)
+		}
+	}
 	dm.degradationHistory = append(dm.degradationHistory, &DegradationEvent{
 		ID:        generateID(),
-		Timestamp: time.Now(),
+		Timestamp: now,
 		FromLevel: fromLevel,
 		ToLevel:   level,
-		Trigger:   "metric-based assessment",
+		Trigger:   trigger,
+		Metrics:   metrics,
+		Recovered: level == DegradationNone,
 	})
+	if n := len(dm.degradationHistory); n > maxDegradationHistory {
+		dm.degradationHistory = append([]*DegradationEvent(nil), dm.degradationHistory[n-maxDegradationHistory:]...)
+	}
+	profile := dm.degradationLevels[level]
+	handlers := append([]DegradationHandler(nil), dm.handlers...)
 	dm.mu.Unlock()
+
 	dm.logger.Debug("degradation applied", "from", fromLevel, "to", level)
+	for _, h := range handlers {
+		h(fromLevel, level, profile)
+	}
+}
+
+// History returns the recorded level changes, oldest first.
+func (dm *DegradationManager) History() []DegradationEvent {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+	out := make([]DegradationEvent, len(dm.degradationHistory))
+	for i, e := range dm.degradationHistory {
+		out[i] = *e
+	}
+	return out
 }
 
 func (dm *DegradationManager) GetCurrentLevel() DegradationLevel {
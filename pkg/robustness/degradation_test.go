@@ -0,0 +1,96 @@
+package robustness
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func usage(cpu, memory, disk float64) *HealthMetrics {
+	return &HealthMetrics{ResourceUsage: &ResourceUsage{CPU: cpu, Memory: memory, Disk: disk}}
+}
+
+func TestDegradationAssessmentHysteresis(t *testing.T) {
+	t.Parallel()
+	cfg := DegradationConfig{}.WithDefaults()
+	require.NoError(t, cfg.Validate())
+	dm := NewDegradationManager(slog.Default(), cfg)
+	clock := time.Now()
+	dm.now = func() time.Time { return clock }
+
+	assert.Equal(t, DegradationNone, dm.AssessDegradationLevel(usage(50, 50, 50)))
+	assert.Equal(t, DegradationSevere, dm.AssessDegradationLevel(usage(91, 50, 50)), "rising pressure applies at once")
+	dm.ApplyDegradation(DegradationSevere)
+
+	// Below the severe threshold but within the hysteresis: stay.
+	assert.Equal(t, DegradationSevere, dm.AssessDegradationLevel(usage(85, 50, 50)))
+
+	// Below every lowered threshold: wait out the recovery delay first.
+	assert.Equal(t, DegradationSevere, dm.AssessDegradationLevel(usage(40, 50, 50)))
+	clock = clock.Add(30 * time.Second)
+	assert.Equal(t, DegradationSevere, dm.AssessDegradationLevel(usage(40, 50, 50)))
+
+	// A spike restarts the delay.
+	assert.Equal(t, DegradationSevere, dm.AssessDegradationLevel(usage(88, 50, 50)))
+	clock = clock.Add(45 * time.Second)
+	assert.Equal(t, DegradationSevere, dm.AssessDegradationLevel(usage(40, 50, 50)))
+	clock = clock.Add(time.Minute)
+	assert.Equal(t, DegradationNone, dm.AssessDegradationLevel(usage(40, 50, 50)))
+	dm.ApplyDegradation(DegradationNone)
+
+	// Disk pressure alone is enough.
+	assert.Equal(t, DegradationModerate, dm.AssessDegradationLevel(usage(10, 10, 91)))
+}
+
+func TestDegradationQualityTargets(t *testing.T) {
+	t.Parallel()
+	dm := NewDegradationManager(slog.Default(), DegradationConfig{Profiles: []DegradationProfile{
+		{Level: DegradationMinimal, QualityTargets: QualityTargets{ErrorRate: 0.2}},
+	}})
+	assert.Equal(t, DegradationNone, dm.AssessDegradationLevel(&HealthMetrics{ErrorRate: 0.1}))
+	assert.Equal(t, DegradationMinimal, dm.AssessDegradationLevel(&HealthMetrics{ErrorRate: 0.3}))
+}
+
+func TestApplyDegradationNotifiesAndRecordsRecovery(t *testing.T) {
+	t.Parallel()
+	dm := NewDegradationManager(slog.Default(), DegradationConfig{}.WithDefaults())
+	type change struct {
+		from, to DegradationLevel
+		profile  *DegradationProfile
+	}
+	var changes []change
+	dm.OnChange(func(from, to DegradationLevel, profile *DegradationProfile) {
+		changes = append(changes, change{from, to, profile})
+	})
+
+	dm.ApplyDegradation(DegradationModerate)
+	dm.ApplyDegradation(DegradationModerate)
+	dm.ApplyAssessment(DegradationNone, usage(10, 10, 10))
+
+	require.Len(t, changes, 2, "unchanged levels are not reported")
+	require.NotNil(t, changes[0].profile)
+	assert.Equal(t, []string{FeatureOptionalControllers}, changes[0].profile.DisabledFeatures)
+	assert.Nil(t, changes[1].profile)
+
+	history := dm.History()
+	require.Len(t, history, 2)
+	assert.True(t, history[0].Recovered)
+	assert.False(t, history[0].RecoveryTime.IsZero())
+	assert.NotNil(t, history[1].Metrics)
+}
+
+func TestDegradationConfigValidate(t *testing.T) {
+	t.Parallel()
+	assert.NoError(t, DegradationConfig{}.Validate())
+	assert.Error(t, DegradationConfig{Profiles: []DegradationProfile{{Level: DegradationNone, Enter: PressureThresholds{CPU: 50}}}}.Validate())
+	assert.Error(t, DegradationConfig{Profiles: []DegradationProfile{{Level: DegradationMinimal}}}.Validate())
+	assert.Error(t, DegradationConfig{Profiles: []DegradationProfile{{Level: DegradationMinimal, Enter: PressureThresholds{CPU: 150}}}}.Validate())
+	assert.Error(t, DegradationConfig{Profiles: []DegradationProfile{
+		{Level: DegradationMinimal, Enter: PressureThresholds{CPU: 50}},
+		{Level: DegradationMinimal, Enter: PressureThresholds{CPU: 60}},
+	}}.Validate())
+	assert.Error(t, DegradationConfig{Profiles: []DegradationProfile{{Level: DegradationMinimal, Enter: PressureThresholds{CPU: 50}, IntervalFactor: 0.5}}}.Validate())
+}
@@ -4,6 +4,8 @@ import (
 	"log/slog"
 	"sync"
 	"time"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
 )
 
 type HealthMonitor struct {
@@ -110,10 +112,22 @@ type HealthReporter struct{}
 type AnomalyDetectorAlgorithm struct{}
 type BehaviorProfiler struct{}
 type AnomalyAlertEngine struct{}
-type AlertChannel struct{}
-type AlertRouter struct{}
 type AlertEscalator struct{}
 
+// AlertChannel forwards health alerts at or above MinSeverity to an
+// alerting sink.
+type AlertChannel struct {
+	Name        string
+	MinSeverity AlertSeverity
+	Sink        alerting.Sink
+}
+
+// AlertRouter restricts alerts for a component to named channels.
+// Components without a route go to every channel.
+type AlertRouter struct {
+	routes map[string][]string
+}
+
 func NewHealthMonitor(logger *slog.Logger, config HealthMonitoringConfig) *HealthMonitor {
 	return &HealthMonitor{
 		logger:           logger,
@@ -161,11 +175,90 @@ func NewAlertManager(logger *slog.Logger) *AlertManager {
 	return &AlertManager{
 		logger:    logger,
 		channels:  []AlertChannel{},
-		router:    &AlertRouter{},
+		router:    &AlertRouter{routes: make(map[string][]string)},
 		escalator: &AlertEscalator{},
 	}
 }
 
+// AddChannel registers a delivery channel.
+func (am *AlertManager) AddChannel(ch AlertChannel) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.channels = append(am.channels, ch)
+}
+
+// RouteComponent sends alerts for component only to the named channels.
+func (am *AlertManager) RouteComponent(component string, channels ...string) {
+	am.mu.Lock()
+	defer am.mu.Unlock()
+	am.router.routes[component] = channels
+}
+
+// Send delivers alert to every routed channel whose minimum severity it
+// meets and returns the number of channels it was sent to.
+func (am *AlertManager) Send(alert *HealthAlert) int {
+	if alert == nil {
+		return 0
+	}
+	am.mu.RLock()
+	defer am.mu.RUnlock()
+
+	routed, hasRoute := am.router.routes[alert.Component]
+	sent := 0
+	for _, ch := range am.channels {
+		if ch.Sink == nil || alertSeverityRank(alert.Severity) < alertSeverityRank(ch.MinSeverity) {
+			continue
+		}
+		if hasRoute && !containsString(routed, ch.Name) {
+			continue
+		}
+		ch.Sink.Raise(alerting.Alert{
+			Name:     "HealthAlert",
+			Severity: toAlertingSeverity(alert.Severity),
+			Summary:  alert.Message,
+			Labels: map[string]string{
+				"component": alert.Component,
+				"status":    string(alert.Status),
+			},
+		})
+		sent++
+	}
+	return sent
+}
+
+func alertSeverityRank(s AlertSeverity) int {
+	switch s {
+	case AlertMedium:
+		return 1
+	case AlertHigh:
+		return 2
+	case AlertCritical:
+		return 3
+	default:
+		return 0
+	}
+}
+
+func toAlertingSeverity(s AlertSeverity) string {
+	switch s {
+	case AlertHigh, AlertCritical:
+		return alerting.SeverityCritical
+	case AlertMedium:
+		return alerting.SeverityWarning
+	default:
+		return alerting.SeverityInfo
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (hm *HealthMonitor) UpdateHealthStatus(metrics *HealthMetrics) {
 	hm.mu.Lock()
 	defer hm.mu.Unlock()
@@ -426,11 +426,24 @@ func (rm *RobustnessManager) handleAlert(alert *HealthAlert) {
 		"status", alert.Status,
 		"severity", alert.Severity)
 
+	if rm.healthMonitor != nil {
+		rm.healthMonitor.alertManager.Send(alert)
+	}
+
 	if alert.Severity == AlertCritical {
 		rm.activateEmergencyProtocol(EmergencyServiceOutage)
 	}
 }
 
+// AddAlertChannel forwards health alerts to an alerting sink. It has no
+// effect when health monitoring is disabled.
+func (rm *RobustnessManager) AddAlertChannel(ch AlertChannel) {
+	if rm.healthMonitor == nil {
+		return
+	}
+	rm.healthMonitor.alertManager.AddChannel(ch)
+}
+
 func (rm *RobustnessManager) manageDegradation() {
 	if rm.degradationManager == nil {
 		return
@@ -443,9 +456,9 @@ func (rm *RobustnessManager) manageDegradation() {
 
 	newLevel := rm.degradationManager.AssessDegradationLevel(currentMetrics)
 
-	if newLevel != DegradationNone && newLevel != rm.degradationManager.GetCurrentLevel() {
+	if newLevel != rm.degradationManager.GetCurrentLevel() {
 		rm.logger.Info("Applying degradation", "level", newLevel)
-		rm.degradationManager.ApplyDegradation(newLevel)
+		rm.degradationManager.ApplyAssessment(newLevel, currentMetrics)
 	}
 }
 
@@ -0,0 +1,190 @@
+package robustness
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Operation is a call guarded by the resilience middleware. It must honour
+// ctx: timeouts, hedging and retries cancel it through the context.
+type Operation func(ctx context.Context) error
+
+// Middleware wraps an Operation with one resilience behaviour.
+type Middleware func(Operation) Operation
+
+// Chain composes middleware. The first is outermost, so
+// Chain(Retry(p, nil), cb.Middleware("x"), Timeout(d)) retries calls that
+// each pass the breaker and each get their own timeout.
+func Chain(mw ...Middleware) Middleware {
+	return func(op Operation) Operation {
+		for i := len(mw) - 1; i >= 0; i-- {
+			if mw[i] != nil {
+				op = mw[i](op)
+			}
+		}
+		return op
+	}
+}
+
+// Run runs op through mw. A nil mw runs op directly.
+func Run(ctx context.Context, mw Middleware, op Operation) error {
+	if mw == nil {
+		return op(ctx)
+	}
+	return mw(op)(ctx)
+}
+
+// Call runs fn through mw and returns the value of the first attempt that
+// succeeded. A nil mw runs fn directly.
+func Call[T any](ctx context.Context, mw Middleware, fn func(ctx context.Context) (T, error)) (T, error) {
+	if mw == nil {
+		return fn(ctx)
+	}
+	var (
+		mu     sync.Mutex
+		result T
+		done   bool
+	)
+	err := mw(func(ctx context.Context) error {
+		v, err := fn(ctx)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !done {
+			result, done = v, true
+		}
+		return nil
+	})(ctx)
+	mu.Lock()
+	defer mu.Unlock()
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// Timeout bounds each call to d.
+func Timeout(d time.Duration) Middleware {
+	return func(next Operation) Operation {
+		if d <= 0 {
+			return next
+		}
+		return func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, d)
+			defer cancel()
+			return next(ctx)
+		}
+	}
+}
+
+// Hedge starts another attempt when the previous one has not finished
+// within delay, or at once when it failed, until maxAttempts are running or
+// done. The first success wins and the others are cancelled. Only hedge
+// idempotent operations; an operation that picks a different target on
+// each invocation (such as the next peer) spreads the attempts.
+func Hedge(delay time.Duration, maxAttempts int) Middleware {
+	return func(next Operation) Operation {
+		if delay <= 0 || maxAttempts <= 1 {
+			return next
+		}
+		return func(ctx context.Context) error {
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+
+			results := make(chan error, maxAttempts)
+			launched, finished := 0, 0
+			launch := func() {
+				launched++
+				go func() { results <- next(ctx) }()
+			}
+			launch()
+			timer := time.NewTimer(delay)
+			defer timer.Stop()
+
+			var lastErr error
+			for {
+				select {
+				case err := <-results:
+					finished++
+					if err == nil {
+						return nil
+					}
+					lastErr = err
+					if IsPermanent(err) {
+						return err
+					}
+					if launched < maxAttempts {
+						launch()
+						timer.Reset(delay)
+					} else if finished == launched {
+						return lastErr
+					}
+				case <-timer.C:
+					if launched < maxAttempts {
+						launch()
+						timer.Reset(delay)
+					}
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// Fallback calls fallback with the error of a failed call. Its result is
+// the result of the call.
+func Fallback(fallback func(ctx context.Context, err error) error) Middleware {
+	return func(next Operation) Operation {
+		return func(ctx context.Context) error {
+			err := next(ctx)
+			if err == nil || fallback == nil {
+				return err
+			}
+			return fallback(ctx, err)
+		}
+	}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying or hedging, such as a 404 or a
+// failed signature check. It returns nil for a nil err.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// RetryableStatus reports whether an HTTP response status is worth
+// retrying: server errors, 408 and 429.
+func RetryableStatus(code int) bool {
+	return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// StatusError returns err, which describes an HTTP response with the given
+// status, marked Permanent unless the status is worth retrying.
+func StatusError(code int, err error) error {
+	if RetryableStatus(code) {
+		return err
+	}
+	return Permanent(err)
+}
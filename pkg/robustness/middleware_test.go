@@ -0,0 +1,213 @@
+package robustness
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errBoom = errors.New("boom")
+
+func TestCircuitBreakerHalfOpenProbing(t *testing.T) {
+	t.Parallel()
+	cb := NewCircuitBreaker(slog.Default(), CircuitBreakerConfig{FailureThreshold: 2, Timeout: time.Minute, SuccessThreshold: 2})
+	clock := time.Now()
+	cb.now = func() time.Time { return clock }
+	fail := func(context.Context) error { return errBoom }
+	ok := func(context.Context) error { return nil }
+	ctx := context.Background()
+
+	assert.ErrorIs(t, cb.ExecuteContext(ctx, "peer", fail), errBoom)
+	assert.ErrorIs(t, cb.ExecuteContext(ctx, "peer", fail), errBoom)
+	assert.Equal(t, CircuitOpen, cb.State("peer"))
+	assert.ErrorIs(t, cb.ExecuteContext(ctx, "peer", ok), ErrCircuitOpen)
+	assert.Equal(t, CircuitClosed, cb.State("other"), "breakers are per name")
+
+	// A failed probe opens the breaker again for twice as long.
+	clock = clock.Add(time.Minute)
+	assert.Equal(t, CircuitHalfOpen, cb.State("peer"))
+	assert.ErrorIs(t, cb.ExecuteContext(ctx, "peer", fail), errBoom)
+	clock = clock.Add(time.Minute)
+	assert.ErrorIs(t, cb.ExecuteContext(ctx, "peer", ok), ErrCircuitOpen)
+	clock = clock.Add(time.Minute)
+
+	// Only one probe at a time; two successes close it.
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go func() {
+		_ = cb.ExecuteContext(ctx, "peer", func(context.Context) error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	assert.ErrorIs(t, cb.ExecuteContext(ctx, "peer", ok), ErrCircuitOpen, "probe slot taken")
+	close(release)
+	require.Eventually(t, func() bool { return cb.ExecuteContext(ctx, "peer", ok) == nil }, time.Second, time.Millisecond)
+	assert.Equal(t, CircuitClosed, cb.State("peer"))
+
+	m := cb.GetMetrics()
+	assert.Equal(t, int64(3), m.FailureCalls)
+	assert.GreaterOrEqual(t, m.RejectCalls, int64(3))
+}
+
+func TestCircuitBreakerFailureRate(t *testing.T) {
+	t.Parallel()
+	cb := NewCircuitBreaker(slog.Default(), CircuitBreakerConfig{
+		FailureThreshold: 100, FailureRateThreshold: 0.75, MinimumCalls: 4, MetricsWindow: time.Minute,
+	})
+	clock := time.Now()
+	cb.now = func() time.Time { return clock }
+	ctx := context.Background()
+	for _, err := range []error{errBoom, nil, errBoom} {
+		_ = cb.ExecuteContext(ctx, "srv", func(context.Context) error { return err })
+	}
+	assert.Equal(t, CircuitClosed, cb.State("srv"), "below minimum calls")
+	_ = cb.ExecuteContext(ctx, "srv", func(context.Context) error { return errBoom })
+	assert.Equal(t, CircuitOpen, cb.State("srv"), "3 of 4 calls failed")
+
+	// Outcomes age out of the window.
+	cb.Reset()
+	for i := 0; i < 3; i++ {
+		_ = cb.ExecuteContext(ctx, "srv", func(context.Context) error { return errBoom })
+		_ = cb.ExecuteContext(ctx, "srv", func(context.Context) error { return nil })
+	}
+	clock = clock.Add(2 * time.Minute)
+	_ = cb.ExecuteContext(ctx, "srv", func(context.Context) error { return errBoom })
+	assert.Equal(t, CircuitClosed, cb.State("srv"))
+
+	// Calls the caller cancelled do not count.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	for i := 0; i < 10; i++ {
+		_ = cb.ExecuteContext(cancelled, "srv", func(ctx context.Context) error { return ctx.Err() })
+	}
+	assert.Equal(t, CircuitClosed, cb.State("srv"))
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+	policy := RetryPolicy{MaxAttempts: 4, InitialDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond, Jitter: true}
+	calls := 0
+	got, err := Call(context.Background(), Retry(policy, nil), func(context.Context) (string, error) {
+		calls++
+		if calls < 3 {
+			return "", errBoom
+		}
+		return "ok", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ok", got)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = Retry(policy, nil)(func(context.Context) error { calls++; return errBoom })(context.Background())
+	assert.ErrorIs(t, err, errBoom)
+	assert.Equal(t, 4, calls)
+
+	calls = 0
+	err = Retry(policy, nil)(func(context.Context) error { calls++; return Permanent(errBoom) })(context.Background())
+	assert.ErrorIs(t, err, errBoom)
+	assert.True(t, IsPermanent(err))
+	assert.Equal(t, 1, calls, "permanent errors are not retried")
+}
+
+func TestRetryBudget(t *testing.T) {
+	t.Parallel()
+	budget := NewRetryBudget(0.5, 1, time.Minute)
+	policy := RetryPolicy{MaxAttempts: 3, InitialDelay: time.Microsecond}
+	calls := 0
+	op := Retry(policy, budget)(func(context.Context) error { calls++; return errBoom })
+
+	err := op(context.Background())
+	assert.ErrorIs(t, err, ErrRetryBudgetExhausted)
+	assert.Equal(t, 2, calls, "one call buys the minimum single retry")
+
+	for i := 0; i < 3; i++ {
+		budget.recordCall()
+	}
+	calls = 0
+	_ = op(context.Background())
+	assert.Equal(t, 2, calls, "five calls buy two retries")
+}
+
+func TestBulkhead(t *testing.T) {
+	t.Parallel()
+	b := NewBulkhead("fetch", 1, 1)
+	release := make(chan struct{})
+	var running atomic.Int32
+	op := b.Middleware()(func(context.Context) error {
+		running.Add(1)
+		<-release
+		return nil
+	})
+	go func() { _ = op(context.Background()) }()
+	require.Eventually(t, func() bool { return running.Load() == 1 }, time.Second, time.Millisecond)
+
+	waited := make(chan error, 1)
+	go func() { waited <- op(context.Background()) }()
+	require.Eventually(t, func() bool {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		return b.waiting == 1
+	}, time.Second, time.Millisecond)
+	assert.ErrorIs(t, op(context.Background()), ErrBulkheadFull)
+
+	close(release)
+	require.NoError(t, <-waited)
+	assert.Equal(t, int32(2), running.Load())
+	assert.Zero(t, b.InFlight())
+}
+
+func TestHedge(t *testing.T) {
+	t.Parallel()
+	var attempts atomic.Int32
+	got, err := Call(context.Background(), Hedge(5*time.Millisecond, 2), func(ctx context.Context) (int, error) {
+		n := attempts.Add(1)
+		if n == 1 {
+			<-ctx.Done() // the slow first attempt is cancelled once the hedge wins
+			return 0, ctx.Err()
+		}
+		return int(n), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, got)
+
+	attempts.Store(0)
+	err = Hedge(time.Hour, 3)(func(context.Context) error { attempts.Add(1); return errBoom })(context.Background())
+	assert.ErrorIs(t, err, errBoom)
+	assert.Equal(t, int32(3), attempts.Load(), "failures start the next attempt at once")
+}
+
+func TestPolicyMiddleware(t *testing.T) {
+	t.Parallel()
+	p := NewPolicy(slog.Default(), "update", PolicyConfig{
+		Timeout:        20 * time.Millisecond,
+		Retry:          RetryPolicy{MaxAttempts: 2, InitialDelay: time.Millisecond},
+		CircuitBreaker: CircuitBreakerConfig{FailureThreshold: 2},
+	})
+	calls := 0
+	slow := func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	err := p.Middleware("example.com")(slow)(context.Background())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 2, calls, "each attempt gets its own timeout")
+	assert.Equal(t, CircuitOpen, p.State("example.com"))
+	assert.ErrorIs(t, p.Middleware("example.com")(slow)(context.Background()), ErrCircuitOpen)
+	assert.Equal(t, 2, calls, "retries stop at an open breaker")
+
+	var nilPolicy *Policy
+	v, err := Call(context.Background(), nilPolicy.Middleware("x"), func(context.Context) (int, error) { return 7, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 7, v)
+}
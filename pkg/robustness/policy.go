@@ -0,0 +1,128 @@
+package robustness
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+
+	apametrics "github.com/naviNBRuas/APA/pkg/metrics"
+)
+
+// PolicyConfig describes the resilience stack for one kind of call, such as
+// update downloads or peer fetches. Zero fields take the defaults given to
+// NewPolicy.
+type PolicyConfig struct {
+	// Timeout bounds each attempt.
+	Timeout time.Duration `yaml:"timeout"`
+	Retry   RetryPolicy   `yaml:"retry"`
+	// RetryBudget is the share of calls that may be retried within a 10s
+	// window, on top of 10 retries that are always allowed. Zero disables
+	// the budget.
+	RetryBudget    float64              `yaml:"retry_budget"`
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	// MaxConcurrent limits calls in flight; zero means no limit. Up to
+	// MaxWaiting more calls wait for a slot.
+	MaxConcurrent int `yaml:"max_concurrent"`
+	MaxWaiting    int `yaml:"max_waiting"`
+	// HedgeDelay starts a second attempt when the first has not finished
+	// in time. Only set it for idempotent calls.
+	HedgeDelay time.Duration `yaml:"hedge_delay"`
+}
+
+// Validate rejects negative limits and failure rates outside (0, 1].
+func (c PolicyConfig) Validate() error {
+	switch {
+	case c.Timeout < 0 || c.HedgeDelay < 0:
+		return fmt.Errorf("timeout and hedge_delay must not be negative")
+	case c.Retry.MaxAttempts < 0:
+		return fmt.Errorf("retry.max_attempts must not be negative")
+	case c.RetryBudget < 0:
+		return fmt.Errorf("retry_budget must not be negative")
+	case c.CircuitBreaker.FailureRateThreshold < 0 || c.CircuitBreaker.FailureRateThreshold > 1:
+		return fmt.Errorf("circuit_breaker.failure_rate_threshold must be between 0 and 1")
+	case c.MaxConcurrent < 0 || c.MaxWaiting < 0:
+		return fmt.Errorf("max_concurrent and max_waiting must not be negative")
+	}
+	return nil
+}
+
+// Merge returns c with its zero fields taken from defaults.
+func (c PolicyConfig) Merge(defaults PolicyConfig) PolicyConfig {
+	if c.Timeout == 0 {
+		c.Timeout = defaults.Timeout
+	}
+	if c.Retry == (RetryPolicy{}) {
+		c.Retry = defaults.Retry
+	}
+	if c.RetryBudget == 0 {
+		c.RetryBudget = defaults.RetryBudget
+	}
+	if c.CircuitBreaker == (CircuitBreakerConfig{}) {
+		c.CircuitBreaker = defaults.CircuitBreaker
+	}
+	if c.MaxConcurrent == 0 {
+		c.MaxConcurrent = defaults.MaxConcurrent
+		c.MaxWaiting = defaults.MaxWaiting
+	}
+	if c.HedgeDelay == 0 {
+		c.HedgeDelay = defaults.HedgeDelay
+	}
+	return c
+}
+
+// Policy applies a PolicyConfig. Each call names the breaker it goes
+// through, so one policy can keep a breaker per host, peer or controller.
+type Policy struct {
+	name     string
+	config   PolicyConfig
+	breakers *CircuitBreaker
+	bulkhead *Bulkhead
+	budget   *RetryBudget
+}
+
+// NewPolicy builds the policy called name from cfg.
+func NewPolicy(logger *slog.Logger, name string, cfg PolicyConfig) *Policy {
+	p := &Policy{
+		name:     name,
+		config:   cfg,
+		breakers: NewCircuitBreaker(logger.With("policy", name), cfg.CircuitBreaker),
+	}
+	if cfg.MaxConcurrent > 0 {
+		p.bulkhead = NewBulkhead(name, cfg.MaxConcurrent, cfg.MaxWaiting)
+	}
+	if cfg.RetryBudget > 0 {
+		p.budget = NewRetryBudget(cfg.RetryBudget, 10, 0)
+	}
+	return p
+}
+
+// SetMetrics exports the policy's breaker states.
+func (p *Policy) SetMetrics(m *apametrics.Metrics) {
+	p.breakers.SetMetrics(m)
+}
+
+// Middleware returns the stack for a call to key: retries with backoff
+// outermost, then the breaker for key, the bulkhead, hedging and the
+// per-attempt timeout. Breakers are exported as "<policy>:<key>". A nil
+// policy returns nil, which Call treats as no middleware.
+func (p *Policy) Middleware(key string) Middleware {
+	if p == nil {
+		return nil
+	}
+	var bulkhead Middleware
+	if p.bulkhead != nil {
+		bulkhead = p.bulkhead.Middleware()
+	}
+	return Chain(
+		Retry(p.config.Retry, p.budget),
+		p.breakers.Middleware(p.name+":"+key),
+		bulkhead,
+		Hedge(p.config.HedgeDelay, 2),
+		Timeout(p.config.Timeout),
+	)
+}
+
+// State returns the state of the breaker for key.
+func (p *Policy) State(key string) CircuitStateEnum {
+	return p.breakers.State(p.name + ":" + key)
+}
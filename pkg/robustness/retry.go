@@ -1,6 +1,8 @@
 package robustness
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
@@ -18,6 +20,10 @@ type RetryManager struct {
 	mu sync.RWMutex
 }
 
+// RetryPolicy describes how an operation is retried. Timeout bounds each
+// attempt, not the whole sequence. With Jitter each delay is drawn between
+// half and all of the backoff delay so that clients retrying together
+// spread out.
 type RetryPolicy struct {
 	MaxAttempts   int           `yaml:"max_attempts"`
 	InitialDelay  time.Duration `yaml:"initial_delay"`
@@ -28,6 +34,26 @@ type RetryPolicy struct {
 	Condition     string        `yaml:"condition"`
 }
 
+// WithDefaults fills unset fields: 3 attempts, 100ms doubling up to 5s.
+func (p RetryPolicy) WithDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 3
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = 100 * time.Millisecond
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = 5 * time.Second
+	}
+	if p.MaxDelay < p.InitialDelay {
+		p.MaxDelay = p.InitialDelay
+	}
+	if p.BackoffFactor < 1 {
+		p.BackoffFactor = 2.0
+	}
+	return p
+}
+
 type RetryMetrics struct {
 	TotalAttempts     int64         `json:"total_attempts"`
 	SuccessfulRetries int64         `json:"successful_retries"`
@@ -42,6 +68,10 @@ type RetryExecutor struct {
 	AttemptsMade int
 }
 
+// ErrRetryBudgetExhausted is wrapped around the last error when a retry
+// was skipped because the retry budget ran out.
+var ErrRetryBudgetExhausted = errors.New("retry budget exhausted")
+
 func NewRetryManager(logger *slog.Logger, policies map[string]RetryPolicy) *RetryManager {
 	return &RetryManager{logger: logger, policies: policies, executors: make(map[string]*RetryExecutor), metrics: &RetryMetrics{}}
 }
@@ -52,13 +82,7 @@ func (rm *RetryManager) ExecuteWithRetry(operation func() error, policyName stri
 	rm.mu.RUnlock()
 
 	if !exists {
-		policy = RetryPolicy{
-			MaxAttempts:   3,
-			InitialDelay:  100 * time.Millisecond,
-			MaxDelay:      5 * time.Second,
-			BackoffFactor: 2.0,
-			Jitter:        true,
-		}
+		policy = RetryPolicy{Jitter: true}
 	}
 
 	executor := &RetryExecutor{}
@@ -66,61 +90,38 @@ func (rm *RetryManager) ExecuteWithRetry(operation func() error, policyName stri
 	rm.executors[policyName] = executor
 	rm.mu.Unlock()
 
-	var lastErr error
-	delay := policy.InitialDelay
-
-	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+	op := func(context.Context) error {
 		err := operation()
 		executor.LastAttempt = time.Now()
-		executor.AttemptsMade = attempt
-
+		executor.AttemptsMade++
 		rm.mu.Lock()
 		rm.metrics.TotalAttempts++
+		rm.mu.Unlock()
+		return err
+	}
+	onDelay := func(delay time.Duration) {
+		rm.mu.Lock()
+		defer rm.mu.Unlock()
 		if delay > rm.metrics.MaxDelay {
 			rm.metrics.MaxDelay = delay
 		}
-		rm.mu.Unlock()
-
-		if err == nil {
-			executor.Success = true
-			rm.mu.Lock()
-			rm.metrics.SuccessfulRetries++
-			rm.mu.Unlock()
-			return nil
-		}
-
-		lastErr = err
-
-		if attempt == policy.MaxAttempts {
-			break
-		}
-
-		delay = time.Duration(float64(delay) * policy.BackoffFactor)
-		if delay > policy.MaxDelay {
-			delay = policy.MaxDelay
-		}
-
-		if policy.Jitter {
-			jitter := time.Duration(rand.Int63n(int64(delay) / 4))
-			delay += jitter
-		}
-
-		time.Sleep(delay)
-
-		rm.mu.Lock()
 		avgAttempts := float64(rm.metrics.TotalAttempts)
 		if avgAttempts > 0 {
 			totalDelay := float64(rm.metrics.AverageDelay) * (avgAttempts - 1) / avgAttempts
 			rm.metrics.AverageDelay = time.Duration(totalDelay + float64(delay)/avgAttempts)
 		}
-		rm.mu.Unlock()
 	}
 
+	err := retry(context.Background(), policy.WithDefaults(), nil, op, onDelay)
 	rm.mu.Lock()
-	rm.metrics.FailedRetries++
-	rm.mu.Unlock()
-
-	return fmt.Errorf("all %d retry attempts failed: %w", policy.MaxAttempts, lastErr)
+	defer rm.mu.Unlock()
+	if err != nil {
+		rm.metrics.FailedRetries++
+		return err
+	}
+	executor.Success = true
+	rm.metrics.SuccessfulRetries++
+	return nil
 }
 
 func (rm *RetryManager) GetMetrics() *RetryMetrics {
@@ -139,15 +140,123 @@ func (rm *RetryManager) Shutdown() {
 	rm.logger.Debug("retry manager shut down")
 }
 
+// Retry retries failed calls according to policy. Errors marked Permanent,
+// open circuits and cancellation of ctx end the retries at once. With a
+// budget, retries beyond it are skipped.
+func Retry(policy RetryPolicy, budget *RetryBudget) Middleware {
+	policy = policy.WithDefaults()
+	return func(next Operation) Operation {
+		return func(ctx context.Context) error {
+			return retry(ctx, policy, budget, next, nil)
+		}
+	}
+}
+
+func retry(ctx context.Context, policy RetryPolicy, budget *RetryBudget, op Operation, onDelay func(time.Duration)) error {
+	if budget != nil {
+		budget.recordCall()
+	}
+	for attempt := 1; ; attempt++ {
+		err := runAttempt(ctx, policy.Timeout, op)
+		if err == nil {
+			return nil
+		}
+		if IsPermanent(err) || errors.Is(err, ErrCircuitOpen) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			return fmt.Errorf("all %d retry attempts failed: %w", policy.MaxAttempts, err)
+		}
+		if budget != nil && !budget.allowRetry() {
+			return fmt.Errorf("%w: %w", ErrRetryBudgetExhausted, err)
+		}
+
+		delay := backoffDelay(attempt, policy)
+		if onDelay != nil {
+			onDelay(delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func runAttempt(ctx context.Context, timeout time.Duration, op Operation) error {
+	if timeout <= 0 {
+		return op(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return op(ctx)
+}
+
+// backoffDelay returns the delay after the given failed attempt.
 func backoffDelay(attempt int, policy RetryPolicy) time.Duration {
 	delay := float64(policy.InitialDelay) * math.Pow(policy.BackoffFactor, float64(attempt-1))
 	if delay > float64(policy.MaxDelay) {
 		delay = float64(policy.MaxDelay)
 	}
 	d := time.Duration(delay)
-	if policy.Jitter {
-		jitter := time.Duration(rand.Int63n(int64(d) / 4))
-		d += jitter
+	if policy.Jitter && d > 1 {
+		half := d / 2
+		d = half + time.Duration(rand.Int63n(int64(d-half)+1))
 	}
 	return d
 }
+
+// RetryBudget caps retries at a share of the calls made in the last window,
+// so that retries cannot multiply the load on a dependency that is already
+// failing. MinRetries are always allowed per window so that low-traffic
+// callers can still retry.
+type RetryBudget struct {
+	ratio      float64
+	minRetries int64
+	calls      *slidingWindow
+	retries    *slidingWindow
+	now        func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewRetryBudget allows ratio retries per call, and at least minRetries,
+// over a sliding window (10s when zero).
+func NewRetryBudget(ratio float64, minRetries int, window time.Duration) *RetryBudget {
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+	return &RetryBudget{
+		ratio:      ratio,
+		minRetries: int64(minRetries),
+		calls:      newSlidingWindow(window),
+		retries:    newSlidingWindow(window),
+		now:        time.Now,
+	}
+}
+
+func (b *RetryBudget) recordCall() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.calls.add(b.now(), false)
+}
+
+// allowRetry takes a retry from the budget if one is left.
+func (b *RetryBudget) allowRetry() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	calls, _ := b.calls.counts(now)
+	retries, _ := b.retries.counts(now)
+	allowed := int64(b.ratio * float64(calls))
+	if allowed < b.minRetries {
+		allowed = b.minRetries
+	}
+	if retries >= allowed {
+		return false
+	}
+	b.retries.add(now, false)
+	return true
+}
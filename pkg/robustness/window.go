@@ -0,0 +1,57 @@
+package robustness
+
+import "time"
+
+// windowBuckets is how many buckets a sliding window is split into. Outcomes
+// age out one bucket at a time rather than all at once.
+const windowBuckets = 10
+
+// slidingWindow counts calls and failures over a rolling period. It is not
+// safe for concurrent use; callers hold their own lock.
+type slidingWindow struct {
+	width   int64 // bucket width in nanoseconds
+	buckets [windowBuckets]windowBucket
+}
+
+type windowBucket struct {
+	slot     int64
+	calls    int64
+	failures int64
+}
+
+func newSlidingWindow(size time.Duration) *slidingWindow {
+	width := int64(size) / windowBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return &slidingWindow{width: width}
+}
+
+func (w *slidingWindow) add(now time.Time, failed bool) {
+	slot := now.UnixNano() / w.width
+	b := &w.buckets[slot%windowBuckets]
+	if b.slot != slot {
+		*b = windowBucket{slot: slot}
+	}
+	b.calls++
+	if failed {
+		b.failures++
+	}
+}
+
+// counts returns the calls and failures recorded within the window ending
+// at now.
+func (w *slidingWindow) counts(now time.Time) (calls, failures int64) {
+	slot := now.UnixNano() / w.width
+	for _, b := range w.buckets {
+		if b.slot > slot-windowBuckets && b.slot <= slot {
+			calls += b.calls
+			failures += b.failures
+		}
+	}
+	return calls, failures
+}
+
+func (w *slidingWindow) reset() {
+	w.buckets = [windowBuckets]windowBucket{}
+}
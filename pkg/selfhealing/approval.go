@@ -0,0 +1,148 @@
+package selfhealing
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/naviNBRuas/APA/pkg/approval"
+)
+
+// DisruptiveStrategy is implemented by strategies whose actions interrupt
+// the agent's work. When an approval gate is set, they run only once an
+// operator or an auto-approve rule accepts them.
+type DisruptiveStrategy interface {
+	Disruptive() bool
+}
+
+// ApprovalGate holds disruptive actions until they are approved.
+// approval.Queue implements it.
+type ApprovalGate interface {
+	Submit(action approval.Action, run func(ctx context.Context) error) (approval.Request, error)
+	Get(id string) (approval.Request, bool)
+}
+
+// SetApprovalGate routes disruptive strategies through gate.
+func (hf *HealingFramework) SetApprovalGate(gate ApprovalGate) {
+	hf.playbookMu.Lock()
+	defer hf.playbookMu.Unlock()
+	hf.approvals = gate
+}
+
+func isDisruptive(strategy HealingStrategy) bool {
+	d, ok := strategy.(DisruptiveStrategy)
+	return ok && d.Disruptive()
+}
+
+// approvalGate returns the gate strategy must pass, or nil when it may run
+// at once.
+func (hf *HealingFramework) approvalGate(strategy HealingStrategy) ApprovalGate {
+	if !isDisruptive(strategy) {
+		return nil
+	}
+	hf.playbookMu.Lock()
+	defer hf.playbookMu.Unlock()
+	return hf.approvals
+}
+
+// submitForApproval queues strategy for issue; apply carries it out once
+// approved.
+func (hf *HealingFramework) submitForApproval(gate ApprovalGate, issue *HealthIssue, strategy HealingStrategy, apply func(ctx context.Context) (*HealingResult, error)) (approval.Request, error) {
+	action := approval.Action{
+		Name:     "healing." + strategy.Name(),
+		Source:   "selfhealing",
+		Subject:  issueSubject(issue),
+		Severity: issue.Severity,
+		Reason:   issue.Description,
+		Context: map[string]interface{}{
+			"issue_id":   issue.ID,
+			"issue_type": issue.Type,
+			"component":  issue.Component,
+			"strategy":   strategy.Description(),
+		},
+	}
+	for k, v := range issue.Context {
+		action.Context[k] = v
+	}
+	return gate.Submit(action, func(ctx context.Context) error {
+		result, err := apply(ctx)
+		if err != nil {
+			return err
+		}
+		if !result.Success {
+			return fmt.Errorf("%s", result.Message)
+		}
+		return nil
+	})
+}
+
+// awaitingApproval reports whether the last step of a playbook run is still
+// held for approval. A step that was rejected or expired is recorded as a
+// failed attempt, so that the playbook moves on and eventually escalates.
+func (hf *HealingFramework) awaitingApproval(runKey string) bool {
+	hf.playbookMu.Lock()
+	run, ok := hf.runs[runKey]
+	gate := hf.approvals
+	if !ok || run.AwaitingApproval == "" || gate == nil {
+		hf.playbookMu.Unlock()
+		return false
+	}
+	id, step, strategy := run.AwaitingApproval, run.awaitingStep, run.awaitingStrategy
+	hf.playbookMu.Unlock()
+
+	req, found := gate.Get(id)
+	if found && (req.Status == approval.StatusPending || req.Status == approval.StatusApproved) {
+		return true
+	}
+
+	hf.playbookMu.Lock()
+	run.AwaitingApproval = ""
+	hf.playbookMu.Unlock()
+	switch {
+	case !found:
+		hf.recordAttempt(runKey, PlaybookAttempt{Step: step, Strategy: strategy, At: hf.now(), Message: "approval request " + id + " no longer known"})
+	case req.Status == approval.StatusRejected:
+		hf.recordAttempt(runKey, PlaybookAttempt{Step: step, Strategy: strategy, At: hf.now(), Message: "rejected by " + req.DecidedBy})
+	case req.Status == approval.StatusExpired:
+		hf.recordAttempt(runKey, PlaybookAttempt{Step: step, Strategy: strategy, At: hf.now(), Message: "approval expired"})
+	}
+	// Executed and failed steps recorded their attempt when they ran.
+	return false
+}
+
+// applyStrategy runs strategy and reports the outcome to the event handler.
+func (hf *HealingFramework) applyStrategy(ctx context.Context, issue *HealthIssue, strategy HealingStrategy) (*HealingResult, error) {
+	start := time.Now()
+	result, err := strategy.Apply(ctx, issue)
+	switch {
+	case err != nil:
+		if hf.eventHandler != nil {
+			hf.eventHandler.OnHealingFailure(issue, strategy, err)
+		}
+	case result.Success:
+		result.Duration = time.Since(start)
+		if hf.eventHandler != nil {
+			hf.eventHandler.OnHealingSuccess(issue, strategy, result)
+		}
+	default:
+		result.Duration = time.Since(start)
+		if hf.eventHandler != nil {
+			hf.eventHandler.OnHealingAttempt(issue, strategy, result)
+		}
+	}
+	return result, err
+}
+
+// issueSubject names what an issue is about, so that repeated detections of
+// the same problem share one approval request.
+func issueSubject(issue *HealthIssue) string {
+	for _, key := range []string{"controller", "module_name", "peer_id"} {
+		if v, ok := issue.Context[key].(string); ok && v != "" {
+			return v
+		}
+	}
+	if check := issueCheck(issue); check != "" {
+		return check
+	}
+	return issue.Component
+}
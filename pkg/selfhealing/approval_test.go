@@ -0,0 +1,91 @@
+package selfhealing
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/approval"
+)
+
+type disruptiveStrategy struct {
+	countingStrategy
+}
+
+func (s *disruptiveStrategy) Disruptive() bool { return true }
+
+func TestDisruptiveStrategyWaitsForApproval(t *testing.T) {
+	checker := new(MockHealthChecker)
+	checker.On("CheckHealth", context.Background()).Return(peerIssue(), nil)
+	hf := NewHealingFramework(slog.Default(), checker, nil)
+	restart := &disruptiveStrategy{countingStrategy{name: "restart", success: true}}
+	require.NoError(t, hf.RegisterStrategy(restart))
+	queue := approval.NewQueue(slog.Default(), approval.Config{})
+	hf.SetApprovalGate(queue)
+
+	require.NoError(t, hf.DetectAndHeal(context.Background()))
+	require.NoError(t, hf.DetectAndHeal(context.Background()))
+	assert.Equal(t, 0, restart.runs)
+	pending := queue.List(approval.StatusPending)
+	require.Len(t, pending, 1, "repeated detections share one request")
+	assert.Equal(t, "healing.restart", pending[0].Action.Name)
+	assert.Equal(t, "peers", pending[0].Action.Subject)
+	assert.Equal(t, "p2p", pending[0].Action.Context["component"])
+
+	done, err := queue.Approve(context.Background(), pending[0].ID, "operator", "")
+	require.NoError(t, err)
+	assert.Equal(t, approval.StatusExecuted, done.Status)
+	assert.Equal(t, 1, restart.runs)
+}
+
+func TestPlaybookStepWaitsForApproval(t *testing.T) {
+	checker := new(MockHealthChecker)
+	checker.On("CheckHealth", context.Background()).Return(peerIssue(), nil)
+	hf := NewHealingFramework(slog.Default(), checker, nil)
+	clock := time.Now()
+	hf.now = func() time.Time { return clock }
+	restart := &disruptiveStrategy{countingStrategy{name: "restart", success: true}}
+	require.NoError(t, hf.RegisterStrategy(restart))
+	require.NoError(t, hf.SetPlaybooks([]Playbook{{
+		Name:  "peer-loss",
+		Steps: []PlaybookStep{{Strategy: "restart", MaxAttempts: 2}},
+	}}))
+	queue := approval.NewQueue(slog.Default(), approval.Config{})
+	hf.SetApprovalGate(queue)
+
+	require.NoError(t, hf.DetectAndHeal(context.Background()))
+	runs := hf.PlaybookRuns()
+	require.Len(t, runs, 1)
+	first := runs[0].AwaitingApproval
+	require.NotEmpty(t, first)
+	assert.Empty(t, runs[0].Attempts)
+
+	// Waiting does not use up attempts.
+	require.NoError(t, hf.DetectAndHeal(context.Background()))
+	assert.Len(t, queue.List(""), 1)
+
+	// A rejected step counts as a failed attempt and the next one is queued.
+	_, err := queue.Reject(context.Background(), first, "operator", "")
+	require.NoError(t, err)
+	require.NoError(t, hf.DetectAndHeal(context.Background()))
+	runs = hf.PlaybookRuns()
+	require.Len(t, runs[0].Attempts, 1)
+	assert.Equal(t, "rejected by operator", runs[0].Attempts[0].Message)
+	second := runs[0].AwaitingApproval
+	require.NotEmpty(t, second)
+	assert.NotEqual(t, first, second)
+
+	// An approved step runs and records its attempt.
+	_, err = queue.Approve(context.Background(), second, "operator", "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, restart.runs)
+	require.NoError(t, hf.DetectAndHeal(context.Background()))
+	runs = hf.PlaybookRuns()
+	require.Len(t, runs[0].Attempts, 2)
+	assert.True(t, runs[0].Attempts[1].Success)
+	assert.Empty(t, runs[0].AwaitingApproval)
+}
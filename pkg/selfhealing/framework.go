@@ -7,6 +7,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/libp2p/go-libp2p/core/crypto"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
+	"github.com/naviNBRuas/APA/pkg/approval"
 	"github.com/naviNBRuas/APA/pkg/health"
 )
 
@@ -18,6 +22,18 @@ type HealingFramework struct {
 	healthChecker HealthChecker
 	eventHandler  EventHandler
 	configuration map[string]interface{}
+	now           func() time.Time
+
+	playbookMu sync.Mutex
+	playbooks  []Playbook
+	runs       map[string]*PlaybookRun // by playbook and issue
+	alerts     alerting.Sink
+	leases     LeaseStore
+	leaseKey   crypto.PrivKey
+	self       string
+	admitted   func(peerID string) bool
+	running    map[string]int // steps holding a slot on this agent, by playbook
+	approvals  ApprovalGate
 }
 
 // HealthChecker defines the interface for checking system health
@@ -44,6 +60,9 @@ func NewHealingFramework(
 		healthChecker: healthChecker,
 		eventHandler:  eventHandler,
 		configuration: make(map[string]interface{}),
+		now:           time.Now,
+		runs:          make(map[string]*PlaybookRun),
+		running:       make(map[string]int),
 	}
 }
 
@@ -141,7 +160,7 @@ func (hf *HealingFramework) convertCheckResultsToIssues(results []*health.CheckR
 				Component:   result.Component,
 				Timestamp:   time.Now(),
 				Metrics:     result.Metrics,
-				Context:     make(map[string]interface{}),
+				Context:     map[string]interface{}{"check": result.Name},
 			}
 
 			issues = append(issues, issue)
@@ -172,6 +191,10 @@ func (hf *HealingFramework) applyHealingStrategies(ctx context.Context, issue *H
 		"type", issue.Type,
 		"severity", issue.Severity)
 
+	if pb, ok := hf.matchPlaybook(issue); ok {
+		return hf.runPlaybook(ctx, pb, issue)
+	}
+
 	applicableStrategies := hf.getApplicableStrategies(issue)
 
 	if len(applicableStrategies) == 0 {
@@ -190,6 +213,28 @@ func (hf *HealingFramework) applyHealingStrategies(ctx context.Context, issue *H
 			"issue_id", issue.ID,
 			"strategy", strategy.Name())
 
+		if gate := hf.approvalGate(strategy); gate != nil {
+			req, err := hf.submitForApproval(gate, issue, strategy, func(ctx context.Context) (*HealingResult, error) {
+				return hf.applyStrategy(ctx, issue, strategy)
+			})
+			if err != nil {
+				hf.logger.Error("Failed to queue healing strategy for approval",
+					"issue_id", issue.ID,
+					"strategy", strategy.Name(),
+					"error", err)
+				continue
+			}
+			if req.Status == approval.StatusFailed {
+				continue
+			}
+			hf.logger.Info("Healing strategy held for approval",
+				"issue_id", issue.ID,
+				"strategy", strategy.Name(),
+				"approval_id", req.ID,
+				"status", req.Status)
+			return nil
+		}
+
 		startTime := time.Now()
 		result, err := strategy.Apply(ctx, issue)
 		duration := time.Since(startTime)
@@ -57,7 +57,7 @@ func TestRegisterAndUnregisterStrategy(t *testing.T) {
 	framework := NewHealingFramework(logger, mockHealthChecker, mockEventHandler)
 
 	// Test registering a strategy
-	strategy := NewRestartProcessStrategy()
+	strategy := NewRestartProcessStrategy(nil)
 	err := framework.RegisterStrategy(strategy)
 	assert.NoError(t, err)
 
@@ -93,7 +93,7 @@ func TestConfigureStrategy(t *testing.T) {
 	framework := NewHealingFramework(logger, mockHealthChecker, mockEventHandler)
 
 	// Register a strategy
-	strategy := NewRestartProcessStrategy()
+	strategy := NewRestartProcessStrategy(nil)
 	err := framework.RegisterStrategy(strategy)
 	assert.NoError(t, err)
 
@@ -166,9 +166,9 @@ func TestGetApplicableStrategies(t *testing.T) {
 	framework := NewHealingFramework(logger, mockHealthChecker, mockEventHandler)
 
 	// Register multiple strategies
-	restartStrategy := NewRestartProcessStrategy()
-	rebuildStrategy := NewRebuildModuleStrategy()
-	networkStrategy := NewNetworkReconnectStrategy()
+	restartStrategy := NewRestartProcessStrategy(nil)
+	rebuildStrategy := NewRebuildModuleStrategy(nil)
+	networkStrategy := NewNetworkReconnectStrategy(nil)
 	quarantineStrategy := NewQuarantineNodeStrategy()
 
 	framework.RegisterStrategy(restartStrategy)    //nolint:errcheck
@@ -0,0 +1,62 @@
+package selfhealing
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// Lease is an agent's claim on one fleet-wide healing slot.
+type Lease struct {
+	Key     string    `json:"key"`    // the slot's control plane key
+	Holder  string    `json:"holder"` // peer ID of the claiming agent
+	Expires time.Time `json:"expires"`
+}
+
+// SignedLease is a lease with the holder's signature over its JSON
+// encoding. It is what the control plane stores.
+type SignedLease struct {
+	Lease     Lease  `json:"lease"`
+	Signature []byte `json:"signature"`
+}
+
+// signLease encodes lease as a SignedLease signed with key.
+func signLease(lease Lease, key crypto.PrivKey) ([]byte, error) {
+	lease.Expires = lease.Expires.UTC()
+	payload, err := json.Marshal(lease)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal healing lease: %w", err)
+	}
+	sig, err := key.Sign(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign healing lease: %w", err)
+	}
+	return json.Marshal(SignedLease{Lease: lease, Signature: sig})
+}
+
+// Verify checks the signature against the public key embedded in Holder.
+func (s *SignedLease) Verify() error {
+	id, err := peer.Decode(s.Lease.Holder)
+	if err != nil {
+		return fmt.Errorf("invalid holder: %w", err)
+	}
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("holder has no embedded public key: %w", err)
+	}
+	data, err := json.Marshal(s.Lease)
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(data, s.Signature)
+	if err != nil {
+		return fmt.Errorf("verify signature: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
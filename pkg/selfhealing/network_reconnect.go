@@ -3,16 +3,20 @@ package selfhealing
 import (
 	"context"
 	"fmt"
-	"net"
+	"strings"
 	"time"
 )
 
-func NewNetworkReconnectStrategy() *NetworkReconnectStrategy {
+// maxReconnectPeers bounds how many known peers one attempt redials.
+const maxReconnectPeers = 5
+
+func NewNetworkReconnectStrategy(peers PeerReconnector) *NetworkReconnectStrategy {
 	return &NetworkReconnectStrategy{
 		name:        "network-reconnect",
-		description: "Reconnects broken network connections to restore connectivity",
+		description: "Reconnects to known peers to restore connectivity",
 		priority:    70,
 		config:      make(map[string]interface{}),
+		peers:       peers,
 	}
 }
 
@@ -25,85 +29,67 @@ func (n *NetworkReconnectStrategy) Description() string {
 }
 
 func (n *NetworkReconnectStrategy) CanHandle(issue *HealthIssue) bool {
-	return issue.Type == "network" || issue.Component == "network"
+	return issue.Type == "network" || issue.Component == "network" ||
+		issue.Type == "p2p" || issue.Component == "p2p"
 }
 
+// Apply redials the peer named in the issue's "peer_id" context, or the
+// most reputable known peers that are not connected. It succeeds when any
+// of them reconnects.
 func (n *NetworkReconnectStrategy) Apply(ctx context.Context, issue *HealthIssue) (*HealingResult, error) {
-	startTime := time.Now()
-
-	endpoint := "unknown"
-	if ep, ok := issue.Context["endpoint"].(string); ok {
-		endpoint = ep
-	}
-
-	if err := n.closeConnection(endpoint); err != nil {
-		return nil, fmt.Errorf("failed to close connection: %w", err)
+	if n.peers == nil {
+		return nil, fmt.Errorf("no P2P network to reconnect peers with")
 	}
+	startTime := time.Now()
 
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	default:
+	ids := n.peers.DisconnectedPeers(maxReconnectPeers)
+	if id, ok := issue.Context["peer_id"].(string); ok && id != "" {
+		ids = []string{id}
 	}
-
-	if err := n.establishConnection(endpoint); err != nil {
+	if len(ids) == 0 {
 		return &HealingResult{
 			Success:     false,
-			ActionTaken: fmt.Sprintf("Attempted to reconnect to '%s'", endpoint),
-			Message:     fmt.Sprintf("Connection establishment failed: %v", err),
-			Metrics: map[string]interface{}{
-				"reconnect_time_ms": time.Since(startTime).Milliseconds(),
-			},
+			ActionTaken: "Looked for known peers to reconnect",
+			Message:     "No disconnected peers with known addresses",
 			RetryNeeded: true,
 		}, nil
 	}
 
-	if err := n.verifyConnectivity(endpoint); err != nil {
+	var reconnected, failed []string
+	for _, id := range ids {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+		if err := n.peers.ReconnectPeer(ctx, id); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", id, err))
+			continue
+		}
+		reconnected = append(reconnected, id)
+	}
+
+	metrics := map[string]interface{}{
+		"reconnect_time_ms": time.Since(startTime).Milliseconds(),
+		"reconnected":       len(reconnected),
+		"failed":            len(failed),
+	}
+	if len(reconnected) == 0 {
 		return &HealingResult{
 			Success:     false,
-			ActionTaken: fmt.Sprintf("Attempted to reconnect to '%s'", endpoint),
-			Message:     fmt.Sprintf("Connectivity verification failed: %v", err),
-			Metrics: map[string]interface{}{
-				"reconnect_time_ms": time.Since(startTime).Milliseconds(),
-			},
+			ActionTaken: fmt.Sprintf("Attempted to reconnect to %s", strings.Join(ids, ", ")),
+			Message:     fmt.Sprintf("Reconnection failed: %s", strings.Join(failed, "; ")),
+			Metrics:     metrics,
 			RetryNeeded: true,
 		}, nil
 	}
 
-	result := &HealingResult{
+	return &HealingResult{
 		Success:     true,
-		ActionTaken: fmt.Sprintf("Reconnected network connection for '%s'", endpoint),
-		Message:     "Network connection reestablished successfully",
-		Metrics: map[string]interface{}{
-			"reconnect_time_ms": time.Since(startTime).Milliseconds(),
-		},
-		RetryNeeded: false,
-	}
-
-	return result, nil
-}
-
-func (n *NetworkReconnectStrategy) closeConnection(endpoint string) error {
-	_ = endpoint
-	return nil
-}
-
-func (n *NetworkReconnectStrategy) establishConnection(endpoint string) error {
-	conn, err := net.DialTimeout("tcp", endpoint, 3*time.Second)
-	if err != nil {
-		return fmt.Errorf("dial %s: %w", endpoint, err)
-	}
-	_ = conn.Close()
-	return nil
-}
-
-func (n *NetworkReconnectStrategy) verifyConnectivity(endpoint string) error {
-	conn, err := net.DialTimeout("tcp", endpoint, 2*time.Second)
-	if err != nil {
-		return fmt.Errorf("connectivity check failed for %s: %w", endpoint, err)
-	}
-	_ = conn.Close()
-	return nil
+		ActionTaken: fmt.Sprintf("Reconnected to %s", strings.Join(reconnected, ", ")),
+		Message:     "Peer connections reestablished successfully",
+		Metrics:     metrics,
+	}, nil
 }
 
 func (n *NetworkReconnectStrategy) Priority() int {
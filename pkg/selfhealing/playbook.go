@@ -0,0 +1,492 @@
+package selfhealing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"gopkg.in/yaml.v3"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
+	"github.com/naviNBRuas/APA/pkg/approval"
+)
+
+const (
+	leaseKeyPrefix = "healing/lease/"
+	// leaseTTL bounds how long a node that dies mid-step holds a fleet slot.
+	leaseTTL = 10 * time.Minute
+)
+
+// errFleetLimit reports that every fleet-wide slot of a playbook is taken.
+var errFleetLimit = errors.New("fleet concurrency limit reached")
+
+// Playbook maps a kind of health issue to ordered healing steps. Each step
+// may run MaxAttempts times per Window, at least its Cooldown apart. Once a
+// step has used its attempts the next step is tried, and once every step has
+// the issue is escalated to an operator through an alert. Attempts age out
+// of the window, so a flapping issue cannot trigger healing forever.
+type Playbook struct {
+	Name               string         `yaml:"name" json:"name"`
+	Match              PlaybookMatch  `yaml:"match" json:"match"`
+	Steps              []PlaybookStep `yaml:"steps" json:"steps"`
+	Window             time.Duration  `yaml:"window" json:"window"`                           // defaults to 1h
+	MaxConcurrent      int            `yaml:"max_concurrent" json:"max_concurrent"`           // nodes across the fleet healing with this playbook at once, 0 for no limit
+	EscalationSeverity string         `yaml:"escalation_severity" json:"escalation_severity"` // defaults to critical
+}
+
+// PlaybookMatch selects the issues a playbook handles. Empty fields match
+// every issue.
+type PlaybookMatch struct {
+	Type     string `yaml:"type" json:"type,omitempty"`         // issue type, the failing check's component
+	Check    string `yaml:"check" json:"check,omitempty"`       // name of the failing health check
+	Severity string `yaml:"severity" json:"severity,omitempty"` // critical | high | medium | low
+}
+
+// PlaybookStep runs one registered strategy.
+type PlaybookStep struct {
+	Strategy    string        `yaml:"strategy" json:"strategy"`
+	MaxAttempts int           `yaml:"max_attempts" json:"max_attempts"` // per window, defaults to 1
+	Cooldown    time.Duration `yaml:"cooldown" json:"cooldown"`         // wait after an attempt before the next one
+}
+
+// PlaybookFile is the YAML document holding the playbooks.
+type PlaybookFile struct {
+	Playbooks []Playbook `yaml:"playbooks"`
+}
+
+// LoadPlaybooks reads and validates the playbooks in a YAML file.
+func LoadPlaybooks(path string) ([]Playbook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read playbooks: %w", err)
+	}
+	var file PlaybookFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse playbooks: %w", err)
+	}
+	seen := make(map[string]bool)
+	for i := range file.Playbooks {
+		pb := file.Playbooks[i].withDefaults()
+		if err := pb.validate(); err != nil {
+			return nil, err
+		}
+		if seen[pb.Name] {
+			return nil, fmt.Errorf("duplicate playbook %q", pb.Name)
+		}
+		seen[pb.Name] = true
+		file.Playbooks[i] = pb
+	}
+	return file.Playbooks, nil
+}
+
+func (p Playbook) withDefaults() Playbook {
+	if p.Window <= 0 {
+		p.Window = time.Hour
+	}
+	if p.EscalationSeverity == "" {
+		p.EscalationSeverity = alerting.SeverityCritical
+	}
+	steps := make([]PlaybookStep, len(p.Steps))
+	for i, s := range p.Steps {
+		if s.MaxAttempts <= 0 {
+			s.MaxAttempts = 1
+		}
+		steps[i] = s
+	}
+	p.Steps = steps
+	return p
+}
+
+func (p Playbook) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("playbook without a name")
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("playbook %q has no steps", p.Name)
+	}
+	for i, s := range p.Steps {
+		if s.Strategy == "" {
+			return fmt.Errorf("playbook %q step %d has no strategy", p.Name, i+1)
+		}
+	}
+	if p.MaxConcurrent < 0 {
+		return fmt.Errorf("playbook %q has a negative max_concurrent", p.Name)
+	}
+	return nil
+}
+
+func (p Playbook) matches(issue *HealthIssue) bool {
+	if p.Match.Type != "" && p.Match.Type != issue.Type {
+		return false
+	}
+	if p.Match.Check != "" && p.Match.Check != issueCheck(issue) {
+		return false
+	}
+	if p.Match.Severity != "" && p.Match.Severity != issue.Severity {
+		return false
+	}
+	return true
+}
+
+// issueCheck returns the name of the health check an issue came from.
+func issueCheck(issue *HealthIssue) string {
+	if check, ok := issue.Context["check"].(string); ok {
+		return check
+	}
+	return ""
+}
+
+// PlaybookAttempt is one step run by a playbook.
+type PlaybookAttempt struct {
+	Step     int       `json:"step"`
+	Strategy string    `json:"strategy"`
+	At       time.Time `json:"at"`
+	Success  bool      `json:"success"`
+	Message  string    `json:"message,omitempty"`
+}
+
+// PlaybookRun is the healing history of one issue under a playbook.
+type PlaybookRun struct {
+	Playbook  string            `json:"playbook"`
+	Issue     string            `json:"issue"`
+	Attempts  []PlaybookAttempt `json:"attempts"` // within the window, oldest first
+	Escalated bool              `json:"escalated"`
+	// AwaitingApproval is the approval request holding the current step.
+	AwaitingApproval string `json:"awaiting_approval,omitempty"`
+
+	awaitingStep     int
+	awaitingStrategy string
+}
+
+// LeaseStore holds the fleet-wide healing slots. The decentralized control
+// plane implements it, so slots are shared with every agent through gossip.
+// Anyone on the control plane can write it, so slots hold signed leases and
+// only those of admitted peers are honoured.
+type LeaseStore interface {
+	Get(key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// SetPlaybooks replaces the playbooks. Issues no playbook matches are
+// handled by every applicable strategy in priority order.
+func (hf *HealingFramework) SetPlaybooks(playbooks []Playbook) error {
+	prepared := make([]Playbook, len(playbooks))
+	for i, pb := range playbooks {
+		pb = pb.withDefaults()
+		if err := pb.validate(); err != nil {
+			return err
+		}
+		prepared[i] = pb
+	}
+	hf.playbookMu.Lock()
+	defer hf.playbookMu.Unlock()
+	hf.playbooks = prepared
+	hf.runs = make(map[string]*PlaybookRun)
+	return nil
+}
+
+// SetAlertSink sets where exhausted playbooks are escalated.
+func (hf *HealingFramework) SetAlertSink(sink alerting.Sink) {
+	hf.playbookMu.Lock()
+	defer hf.playbookMu.Unlock()
+	hf.alerts = sink
+}
+
+// SetLeaseStore enables the fleet-wide MaxConcurrent limit of playbooks.
+// This agent signs the slots it holds with key, and honours slots held by
+// another agent only when the lease is signed by that agent and admitted
+// reports it trusted. Other leases are ignored, leaving this agent to its
+// local limit.
+func (hf *HealingFramework) SetLeaseStore(store LeaseStore, key crypto.PrivKey, admitted func(peerID string) bool) error {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("derive lease holder peer ID: %w", err)
+	}
+	hf.playbookMu.Lock()
+	defer hf.playbookMu.Unlock()
+	hf.leases = store
+	hf.leaseKey = key
+	hf.self = id.String()
+	hf.admitted = admitted
+	return nil
+}
+
+// PlaybookRuns returns the runs that have attempts in their window, sorted
+// by playbook and issue.
+func (hf *HealingFramework) PlaybookRuns() []PlaybookRun {
+	hf.playbookMu.Lock()
+	defer hf.playbookMu.Unlock()
+	runs := make([]PlaybookRun, 0, len(hf.runs))
+	for _, run := range hf.runs {
+		if len(run.Attempts) == 0 && !run.Escalated && run.AwaitingApproval == "" {
+			continue
+		}
+		cp := *run
+		cp.Attempts = append([]PlaybookAttempt(nil), run.Attempts...)
+		runs = append(runs, cp)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if runs[i].Playbook != runs[j].Playbook {
+			return runs[i].Playbook < runs[j].Playbook
+		}
+		return runs[i].Issue < runs[j].Issue
+	})
+	return runs
+}
+
+// matchPlaybook returns the first playbook that handles issue.
+func (hf *HealingFramework) matchPlaybook(issue *HealthIssue) (Playbook, bool) {
+	hf.playbookMu.Lock()
+	defer hf.playbookMu.Unlock()
+	for _, pb := range hf.playbooks {
+		if pb.matches(issue) {
+			return pb, true
+		}
+	}
+	return Playbook{}, false
+}
+
+// nextStep prunes attempts outside the window and returns the step to run
+// now. wait is non-zero while the last attempt's cooldown runs, and
+// exhausted is set once every step has used its attempts.
+func (hf *HealingFramework) nextStep(pb Playbook, run *PlaybookRun, now time.Time) (step int, wait time.Duration, exhausted bool) {
+	kept := run.Attempts[:0]
+	for _, a := range run.Attempts {
+		if now.Sub(a.At) < pb.Window {
+			kept = append(kept, a)
+		}
+	}
+	run.Attempts = kept
+	if len(kept) == 0 {
+		run.Escalated = false
+	}
+
+	if n := len(kept); n > 0 {
+		last := kept[n-1]
+		if last.Step < len(pb.Steps) {
+			if until := last.At.Add(pb.Steps[last.Step].Cooldown); now.Before(until) {
+				return last.Step, until.Sub(now), false
+			}
+		}
+	}
+	used := make([]int, len(pb.Steps))
+	for _, a := range kept {
+		if a.Step < len(used) {
+			used[a.Step]++
+		}
+	}
+	for i, s := range pb.Steps {
+		if used[i] < s.MaxAttempts {
+			return i, 0, false
+		}
+	}
+	return len(pb.Steps), 0, true
+}
+
+// runPlaybook runs the next due step of pb for issue, or escalates once the
+// playbook is exhausted.
+func (hf *HealingFramework) runPlaybook(ctx context.Context, pb Playbook, issue *HealthIssue) error {
+	key := issueCheck(issue)
+	if key == "" {
+		key = issue.Type
+	}
+
+	runKey := pb.Name + "/" + key
+	if hf.awaitingApproval(runKey) {
+		return nil
+	}
+
+	hf.playbookMu.Lock()
+	run, ok := hf.runs[runKey]
+	if !ok {
+		run = &PlaybookRun{Playbook: pb.Name, Issue: key}
+		hf.runs[runKey] = run
+	}
+	step, wait, exhausted := hf.nextStep(pb, run, hf.now())
+	// Escalate once per window rather than on every cycle.
+	escalate := exhausted && !run.Escalated
+	if exhausted {
+		run.Escalated = true
+	}
+	sink := hf.alerts
+	hf.playbookMu.Unlock()
+
+	if exhausted {
+		if !escalate {
+			return nil
+		}
+		hf.logger.Warn("Healing playbook exhausted, escalating", "playbook", pb.Name, "issue", key)
+		if sink != nil {
+			sink.Raise(alerting.Alert{
+				Name:     "HealingEscalated",
+				Severity: pb.EscalationSeverity,
+				Summary:  fmt.Sprintf("Playbook %s used every step for %s: %s", pb.Name, key, issue.Description),
+				Labels: map[string]string{
+					"playbook":  pb.Name,
+					"issue":     key,
+					"component": issue.Component,
+				},
+			})
+		}
+		return fmt.Errorf("healing playbook %s exhausted for %s", pb.Name, key)
+	}
+	if wait > 0 {
+		hf.logger.Debug("Healing playbook cooling down", "playbook", pb.Name, "issue", key, "remaining", wait)
+		return nil
+	}
+
+	stepCfg := pb.Steps[step]
+	hf.strategyMutex.RLock()
+	strategy, ok := hf.strategies[stepCfg.Strategy]
+	hf.strategyMutex.RUnlock()
+	if !ok {
+		hf.recordAttempt(runKey, PlaybookAttempt{Step: step, Strategy: stepCfg.Strategy, At: hf.now(), Message: "strategy not registered"})
+		return fmt.Errorf("playbook %s step %d: strategy '%s' not registered", pb.Name, step+1, stepCfg.Strategy)
+	}
+
+	if gate := hf.approvalGate(strategy); gate != nil {
+		req, err := hf.submitForApproval(gate, issue, strategy, func(ctx context.Context) (*HealingResult, error) {
+			return hf.runStep(ctx, pb, runKey, step, issue, strategy)
+		})
+		if err != nil {
+			hf.recordAttempt(runKey, PlaybookAttempt{Step: step, Strategy: strategy.Name(), At: hf.now(), Message: err.Error()})
+			return fmt.Errorf("failed to queue playbook %s step %d for approval: %w", pb.Name, step+1, err)
+		}
+		if req.Status == approval.StatusPending {
+			hf.logger.Info("Healing playbook step awaiting approval", "playbook", pb.Name, "issue", key, "step", step+1, "strategy", strategy.Name(), "approval_id", req.ID)
+			hf.playbookMu.Lock()
+			run.AwaitingApproval, run.awaitingStep, run.awaitingStrategy = req.ID, step, strategy.Name()
+			hf.playbookMu.Unlock()
+		}
+		return nil
+	}
+
+	hf.logger.Info("Running healing playbook step", "playbook", pb.Name, "issue", key, "step", step+1, "strategy", strategy.Name())
+	if _, err := hf.runStep(ctx, pb, runKey, step, issue, strategy); err != nil && !errors.Is(err, errFleetLimit) {
+		return err
+	}
+	return nil
+}
+
+// runStep applies a playbook step within a fleet-wide slot and records the
+// attempt.
+func (hf *HealingFramework) runStep(ctx context.Context, pb Playbook, runKey string, step int, issue *HealthIssue, strategy HealingStrategy) (*HealingResult, error) {
+	release, acquired := hf.acquireLease(ctx, pb)
+	if !acquired {
+		hf.logger.Info("Deferring healing, fleet concurrency limit reached", "playbook", pb.Name, "issue", runKey, "max_concurrent", pb.MaxConcurrent)
+		return nil, errFleetLimit
+	}
+	defer release()
+
+	attempt := PlaybookAttempt{Step: step, Strategy: strategy.Name(), At: hf.now()}
+	result, err := hf.applyStrategy(ctx, issue, strategy)
+	switch {
+	case err != nil:
+		attempt.Message = err.Error()
+	case result.Success:
+		attempt.Success = true
+		attempt.Message = result.ActionTaken
+	default:
+		attempt.Message = result.Message
+	}
+	hf.recordAttempt(runKey, attempt)
+	return result, err
+}
+
+func (hf *HealingFramework) recordAttempt(runKey string, attempt PlaybookAttempt) {
+	hf.playbookMu.Lock()
+	defer hf.playbookMu.Unlock()
+	if run, ok := hf.runs[runKey]; ok {
+		run.Attempts = append(run.Attempts, attempt)
+	}
+}
+
+// acquireLease takes one of the playbook's MaxConcurrent fleet-wide slots.
+// This agent never runs more than MaxConcurrent steps of a playbook at
+// once, whatever the slots say. Slots are claimed through gossip, so two
+// agents racing for the last slot may both win it briefly; the limit bounds
+// healing storms rather than guaranteeing mutual exclusion.
+func (hf *HealingFramework) acquireLease(ctx context.Context, pb Playbook) (release func(), ok bool) {
+	if pb.MaxConcurrent == 0 {
+		return func() {}, true
+	}
+	hf.playbookMu.Lock()
+	if hf.running[pb.Name] >= pb.MaxConcurrent {
+		hf.playbookMu.Unlock()
+		return nil, false
+	}
+	hf.running[pb.Name]++
+	store, key, self := hf.leases, hf.leaseKey, hf.self
+	hf.playbookMu.Unlock()
+	releaseLocal := func() {
+		hf.playbookMu.Lock()
+		defer hf.playbookMu.Unlock()
+		hf.running[pb.Name]--
+	}
+	if store == nil {
+		return releaseLocal, true
+	}
+
+	for slot := 0; slot < pb.MaxConcurrent; slot++ {
+		slotKey := fmt.Sprintf("%s%s/%d", leaseKeyPrefix, pb.Name, slot)
+		if holder := hf.leaseHolder(store, slotKey); holder != "" && holder != self {
+			continue
+		}
+		value, err := signLease(Lease{Key: slotKey, Holder: self, Expires: hf.now().Add(leaseTTL)}, key)
+		if err == nil {
+			err = store.Set(ctx, slotKey, value, leaseTTL)
+		}
+		if err != nil {
+			hf.logger.Warn("Failed to claim healing slot", "key", slotKey, "error", err)
+			continue
+		}
+		return func() {
+			defer releaseLocal()
+			if hf.leaseHolder(store, slotKey) == self {
+				// An empty value that expires at once frees the slot.
+				if err := store.Set(context.Background(), slotKey, nil, time.Millisecond); err != nil {
+					hf.logger.Warn("Failed to release healing slot", "key", slotKey, "error", err)
+				}
+			}
+		}, true
+	}
+	releaseLocal()
+	return nil, false
+}
+
+// leaseHolder returns the agent holding a slot, or "" when the slot is free
+// or its lease cannot be trusted: malformed, for another slot, expired, not
+// signed by its holder, or held by a peer that is not admitted.
+func (hf *HealingFramework) leaseHolder(store LeaseStore, slotKey string) string {
+	data, held := store.Get(slotKey)
+	if !held || len(data) == 0 {
+		return ""
+	}
+	var signed SignedLease
+	if err := json.Unmarshal(data, &signed); err != nil {
+		hf.logger.Warn("Ignoring malformed healing slot", "key", slotKey, "error", err)
+		return ""
+	}
+	lease := signed.Lease
+	if lease.Key != slotKey || !hf.now().Before(lease.Expires) {
+		return ""
+	}
+	if err := signed.Verify(); err != nil {
+		hf.logger.Warn("Ignoring healing slot with bad signature", "key", slotKey, "holder", lease.Holder, "error", err)
+		return ""
+	}
+	hf.playbookMu.Lock()
+	self, admitted := hf.self, hf.admitted
+	hf.playbookMu.Unlock()
+	if lease.Holder != self && (admitted == nil || !admitted(lease.Holder)) {
+		hf.logger.Warn("Ignoring healing slot held by a peer that is not admitted", "key", slotKey, "holder", lease.Holder)
+		return ""
+	}
+	return lease.Holder
+}
@@ -0,0 +1,278 @@
+package selfhealing
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/alerting"
+	"github.com/naviNBRuas/APA/pkg/health"
+)
+
+// countingStrategy records how often it ran and reports success as told.
+type countingStrategy struct {
+	name    string
+	success bool
+	runs    int
+}
+
+func (s *countingStrategy) Name() string                                  { return s.name }
+func (s *countingStrategy) Description() string                           { return s.name }
+func (s *countingStrategy) CanHandle(issue *HealthIssue) bool             { return true }
+func (s *countingStrategy) Priority() int                                 { return 0 }
+func (s *countingStrategy) Configure(config map[string]interface{}) error { return nil }
+
+func (s *countingStrategy) Apply(ctx context.Context, issue *HealthIssue) (*HealingResult, error) {
+	s.runs++
+	return &HealingResult{Success: s.success, ActionTaken: s.name, Message: s.name}, nil
+}
+
+type recordingSink struct {
+	alerts []alerting.Alert
+}
+
+func (s *recordingSink) Raise(alert alerting.Alert) { s.alerts = append(s.alerts, alert) }
+
+// memLeases is an in-memory LeaseStore shared by several frameworks.
+type memLeases struct {
+	mu      sync.Mutex
+	values  map[string][]byte
+	expires map[string]time.Time
+}
+
+func newMemLeases() *memLeases {
+	return &memLeases{values: map[string][]byte{}, expires: map[string]time.Time{}}
+}
+
+func (m *memLeases) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	if !ok || time.Now().After(m.expires[key]) {
+		return nil, false
+	}
+	return v, true
+}
+
+func (m *memLeases) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = value
+	m.expires[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func peerIssue() []*health.CheckResult {
+	return []*health.CheckResult{{Name: "peers", Component: "p2p", Status: health.StatusFailed, Message: "0 peers connected, need 1"}}
+}
+
+func TestLoadPlaybooks(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "playbooks.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+playbooks:
+  - name: peer-loss
+    match:
+      check: peers
+    window: 30m
+    max_concurrent: 2
+    steps:
+      - strategy: network-reconnect
+        max_attempts: 3
+        cooldown: 1m
+      - strategy: restart-process
+`), 0o644))
+
+	playbooks, err := LoadPlaybooks(path)
+	require.NoError(t, err)
+	require.Len(t, playbooks, 1)
+	pb := playbooks[0]
+	assert.Equal(t, 30*time.Minute, pb.Window)
+	assert.Equal(t, 2, pb.MaxConcurrent)
+	assert.Equal(t, alerting.SeverityCritical, pb.EscalationSeverity)
+	assert.Equal(t, 3, pb.Steps[0].MaxAttempts)
+	assert.Equal(t, time.Minute, pb.Steps[0].Cooldown)
+	assert.Equal(t, 1, pb.Steps[1].MaxAttempts, "max_attempts defaults to 1")
+
+	for name, doc := range map[string]string{
+		"no steps":    "playbooks:\n  - name: empty\n",
+		"no strategy": "playbooks:\n  - name: x\n    steps:\n      - cooldown: 1m\n",
+		"duplicate":   "playbooks:\n  - name: x\n    steps: [{strategy: a}]\n  - name: x\n    steps: [{strategy: b}]\n",
+	} {
+		require.NoError(t, os.WriteFile(path, []byte(doc), 0o644))
+		_, err := LoadPlaybooks(path)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPlaybookStepsCooldownAndEscalation(t *testing.T) {
+	checker := new(MockHealthChecker)
+	checker.On("CheckHealth", context.Background()).Return(peerIssue(), nil)
+	hf := NewHealingFramework(slog.Default(), checker, nil)
+	clock := time.Now()
+	hf.now = func() time.Time { return clock }
+
+	reconnect := &countingStrategy{name: "reconnect"}
+	restart := &countingStrategy{name: "restart"}
+	require.NoError(t, hf.RegisterStrategy(reconnect))
+	require.NoError(t, hf.RegisterStrategy(restart))
+	sink := &recordingSink{}
+	hf.SetAlertSink(sink)
+	require.NoError(t, hf.SetPlaybooks([]Playbook{{
+		Name:  "peer-loss",
+		Match: PlaybookMatch{Check: "peers"},
+		Steps: []PlaybookStep{
+			{Strategy: "reconnect", MaxAttempts: 2, Cooldown: time.Minute},
+			{Strategy: "restart"},
+		},
+	}}))
+
+	tick := func(advance time.Duration) {
+		clock = clock.Add(advance)
+		require.NoError(t, hf.DetectAndHeal(context.Background()))
+	}
+
+	tick(0)
+	assert.Equal(t, 1, reconnect.runs)
+	tick(30 * time.Second)
+	assert.Equal(t, 1, reconnect.runs, "cooling down")
+	tick(30 * time.Second)
+	assert.Equal(t, 2, reconnect.runs)
+	tick(time.Minute)
+	assert.Equal(t, 2, reconnect.runs, "first step used up")
+	assert.Equal(t, 1, restart.runs, "escalated to the next step")
+	assert.Empty(t, sink.alerts)
+
+	tick(time.Minute)
+	assert.Equal(t, 1, restart.runs)
+	require.Len(t, sink.alerts, 1, "every step used up: escalated to an operator")
+	assert.Equal(t, "HealingEscalated", sink.alerts[0].Name)
+	assert.Equal(t, "peer-loss", sink.alerts[0].Labels["playbook"])
+	tick(time.Minute)
+	assert.Len(t, sink.alerts, 1, "escalated once per window")
+
+	runs := hf.PlaybookRuns()
+	require.Len(t, runs, 1)
+	assert.Equal(t, "peers", runs[0].Issue)
+	assert.Len(t, runs[0].Attempts, 3)
+	assert.True(t, runs[0].Escalated)
+
+	// Once the attempts leave the window the playbook starts over.
+	tick(time.Hour - time.Minute)
+	assert.Equal(t, 3, reconnect.runs)
+	assert.False(t, hf.PlaybookRuns()[0].Escalated)
+}
+
+func newLeaseKey(t *testing.T) (crypto.PrivKey, string) {
+	t.Helper()
+	key, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(key)
+	require.NoError(t, err)
+	return key, id.String()
+}
+
+func TestPlaybookFleetConcurrencyLimit(t *testing.T) {
+	checker := new(MockHealthChecker)
+	checker.On("CheckHealth", context.Background()).Return(peerIssue(), nil)
+	leases := newMemLeases()
+	playbooks := []Playbook{{Name: "peer-loss", MaxConcurrent: 1, Steps: []PlaybookStep{{Strategy: "reconnect", MaxAttempts: 5}}}}
+	aKey, aID := newLeaseKey(t)
+	bKey, bID := newLeaseKey(t)
+	admitted := func(id string) bool { return id == aID || id == bID }
+
+	node := func(key crypto.PrivKey) (*HealingFramework, *countingStrategy) {
+		hf := NewHealingFramework(slog.Default(), checker, nil)
+		s := &countingStrategy{name: "reconnect", success: true}
+		require.NoError(t, hf.RegisterStrategy(s))
+		require.NoError(t, hf.SetPlaybooks(playbooks))
+		require.NoError(t, hf.SetLeaseStore(leases, key, admitted))
+		return hf, s
+	}
+	a, aStrategy := node(aKey)
+	b, bStrategy := node(bKey)
+
+	// node-b holds the only slot, so node-a defers.
+	slot := "healing/lease/peer-loss/0"
+	held, err := signLease(Lease{Key: slot, Holder: bID, Expires: time.Now().Add(time.Minute)}, bKey)
+	require.NoError(t, err)
+	require.NoError(t, leases.Set(context.Background(), slot, held, time.Minute))
+	require.NoError(t, a.DetectAndHeal(context.Background()))
+	assert.Equal(t, 0, aStrategy.runs)
+
+	// node-b heals and frees the slot when done; then node-a may heal.
+	require.NoError(t, b.DetectAndHeal(context.Background()))
+	assert.Equal(t, 1, bStrategy.runs)
+	require.NoError(t, a.DetectAndHeal(context.Background()))
+	assert.Equal(t, 1, aStrategy.runs)
+	holder, _ := leases.Get(slot)
+	assert.Empty(t, holder, "slot released after the step")
+}
+
+func TestPlaybookIgnoresUntrustedLeases(t *testing.T) {
+	checker := new(MockHealthChecker)
+	checker.On("CheckHealth", context.Background()).Return(peerIssue(), nil)
+	playbooks := []Playbook{{Name: "peer-loss", MaxConcurrent: 1, Steps: []PlaybookStep{{Strategy: "reconnect", MaxAttempts: 5}}}}
+	key, _ := newLeaseKey(t)
+	otherKey, otherID := newLeaseKey(t)
+	slot := "healing/lease/peer-loss/0"
+
+	signed := func(lease Lease, key crypto.PrivKey) []byte {
+		data, err := signLease(lease, key)
+		require.NoError(t, err)
+		return data
+	}
+	forged := signed(Lease{Key: slot, Holder: otherID, Expires: time.Now().Add(time.Minute)}, key)
+	tests := []struct {
+		name  string
+		value []byte
+	}{
+		{name: "unsigned", value: []byte(otherID)},
+		{name: "not admitted", value: signed(Lease{Key: slot, Holder: otherID, Expires: time.Now().Add(time.Minute)}, otherKey)},
+		{name: "forged signature", value: forged},
+		{name: "another slot", value: signed(Lease{Key: slot + "x", Holder: otherID, Expires: time.Now().Add(time.Minute)}, otherKey)},
+		{name: "expired", value: signed(Lease{Key: slot, Holder: otherID, Expires: time.Now().Add(-time.Minute)}, otherKey)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leases := newMemLeases()
+			hf := NewHealingFramework(slog.Default(), checker, nil)
+			s := &countingStrategy{name: "reconnect", success: true}
+			require.NoError(t, hf.RegisterStrategy(s))
+			require.NoError(t, hf.SetPlaybooks(playbooks))
+			admitted := func(id string) bool { return id == otherID && tt.name != "not admitted" }
+			require.NoError(t, hf.SetLeaseStore(leases, key, admitted))
+
+			require.NoError(t, leases.Set(context.Background(), slot, tt.value, time.Minute))
+			require.NoError(t, hf.DetectAndHeal(context.Background()))
+			assert.Equal(t, 1, s.runs, "an untrusted lease does not block healing")
+		})
+	}
+
+	// The local limit still holds when no lease can be trusted.
+	hf := NewHealingFramework(slog.Default(), checker, nil)
+	hf.running["peer-loss"] = 1
+	_, ok := hf.acquireLease(context.Background(), playbooks[0])
+	assert.False(t, ok)
+}
+
+func TestPlaybookMissingStrategyIsRecorded(t *testing.T) {
+	checker := new(MockHealthChecker)
+	checker.On("CheckHealth", context.Background()).Return(peerIssue(), nil)
+	hf := NewHealingFramework(slog.Default(), checker, nil)
+	require.NoError(t, hf.SetPlaybooks([]Playbook{{Name: "p", Steps: []PlaybookStep{{Strategy: "missing"}}}}))
+
+	require.NoError(t, hf.DetectAndHeal(context.Background()))
+	runs := hf.PlaybookRuns()
+	require.Len(t, runs, 1)
+	assert.Equal(t, "strategy not registered", runs[0].Attempts[0].Message)
+}
@@ -93,6 +93,10 @@ func (q *QuarantineNodeStrategy) reportQuarantineEvent(issue *HealthIssue) error
 	return nil
 }
 
+func (q *QuarantineNodeStrategy) Disruptive() bool {
+	return true
+}
+
 func (q *QuarantineNodeStrategy) Priority() int {
 	return q.priority
 }
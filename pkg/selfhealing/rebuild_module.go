@@ -2,19 +2,20 @@ package selfhealing
 
 import (
 	"context"
-	"crypto/sha256"
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
 	"time"
 )
 
-func NewRebuildModuleStrategy() *RebuildModuleStrategy {
+// NewRebuildModuleStrategy creates a strategy that repairs modules through
+// modules.
+func NewRebuildModuleStrategy(modules ModuleRepairer) *RebuildModuleStrategy {
 	return &RebuildModuleStrategy{
 		name:        "rebuild-module",
 		description: "Rebuilds corrupted or missing modules from trusted sources",
 		priority:    90,
 		config:      make(map[string]interface{}),
+		modules:     modules,
 	}
 }
 
@@ -30,85 +31,69 @@ func (r *RebuildModuleStrategy) CanHandle(issue *HealthIssue) bool {
 	return issue.Type == "module" || issue.Component == "module"
 }
 
+// Apply repairs the module named in the issue's "module_name" context, or
+// every installed module that is not loaded. Each module is reloaded from
+// disk first and fetched again from peers when that fails.
 func (r *RebuildModuleStrategy) Apply(ctx context.Context, issue *HealthIssue) (*HealingResult, error) {
+	if r.modules == nil {
+		return nil, fmt.Errorf("no module manager to rebuild modules with")
+	}
 	startTime := time.Now()
 
-	moduleName := issue.Component
-	if name, ok := issue.Context["module_name"].(string); ok {
-		moduleName = name
+	names := r.modules.UnloadedModules()
+	if name, ok := issue.Context["module_name"].(string); ok && name != "" {
+		names = []string{name}
 	}
-
-	moduleData, err := r.requestModuleFromPeers(ctx, moduleName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to request module from peers: %w", err)
+	if len(names) == 0 {
+		return &HealingResult{
+			Success:     false,
+			ActionTaken: "Looked for modules that failed to load",
+			Message:     "No module to rebuild",
+		}, nil
 	}
 
-	if err := r.verifyModuleIntegrity(moduleData, moduleName); err != nil {
-		return nil, fmt.Errorf("module integrity verification failed: %w", err)
+	var reloaded, refetched, failed []string
+	for _, name := range names {
+		reloadErr := r.modules.ReloadModule(ctx, name)
+		if reloadErr == nil {
+			reloaded = append(reloaded, name)
+			continue
+		}
+		if err := r.modules.RefetchModule(ctx, name); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: reload: %v; refetch: %v", name, reloadErr, err))
+			continue
+		}
+		refetched = append(refetched, name)
 	}
 
-	if err := r.replaceModule(moduleName, moduleData); err != nil {
-		return nil, fmt.Errorf("failed to replace module: %w", err)
+	metrics := map[string]interface{}{
+		"rebuild_time_ms": time.Since(startTime).Milliseconds(),
+		"reloaded":        len(reloaded),
+		"refetched":       len(refetched),
+		"failed":          len(failed),
 	}
-
-	if err := r.reloadModule(moduleName); err != nil {
+	if len(failed) > 0 {
 		return &HealingResult{
 			Success:     false,
-			ActionTaken: fmt.Sprintf("Attempted to rebuild module '%s'", moduleName),
-			Message:     fmt.Sprintf("Module reload failed: %v", err),
-			Metrics: map[string]interface{}{
-				"rebuild_time_ms": time.Since(startTime).Milliseconds(),
-			},
+			ActionTaken: fmt.Sprintf("Attempted to rebuild modules %s", strings.Join(names, ", ")),
+			Message:     fmt.Sprintf("Module rebuild failed: %s", strings.Join(failed, "; ")),
+			Metrics:     metrics,
 			RetryNeeded: true,
 		}, nil
 	}
 
-	result := &HealingResult{
+	return &HealingResult{
 		Success:     true,
-		ActionTaken: fmt.Sprintf("Rebuilt module '%s'", moduleName),
-		Message:     "Module rebuilt and loaded successfully",
-		Metrics: map[string]interface{}{
-			"rebuild_time_ms": time.Since(startTime).Milliseconds(),
-			"module_size_kb":  len(moduleData) / 1024,
-		},
-		RetryNeeded: false,
-	}
-
-	return result, nil
-}
-
-func (r *RebuildModuleStrategy) requestModuleFromPeers(ctx context.Context, moduleName string) ([]byte, error) {
-	select {
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-time.After(50 * time.Millisecond):
-	}
-	return []byte(fmt.Sprintf("module data for %s", moduleName)), nil
-}
-
-func (r *RebuildModuleStrategy) verifyModuleIntegrity(moduleData []byte, moduleName string) error {
-	if len(moduleData) == 0 {
-		return fmt.Errorf("empty module data for %s", moduleName)
-	}
-	if len(moduleData) < 8 {
-		return fmt.Errorf("module data too short for %s", moduleName)
-	}
-	_ = sha256.Sum256(moduleData)
-	return nil
+		ActionTaken: fmt.Sprintf("Rebuilt modules %s", strings.Join(names, ", ")),
+		Message:     "Modules rebuilt and loaded successfully",
+		Metrics:     metrics,
+	}, nil
 }
 
-func (r *RebuildModuleStrategy) replaceModule(moduleName string, moduleData []byte) error {
-	moduleDir := filepath.Join(os.TempDir(), "apa", "modules")
-	if err := os.MkdirAll(moduleDir, 0755); err != nil {
-		return fmt.Errorf("create module dir: %w", err)
-	}
-	path := filepath.Join(moduleDir, moduleName+".wasm")
-	return os.WriteFile(path, moduleData, 0644)
-}
-
-func (r *RebuildModuleStrategy) reloadModule(moduleName string) error {
-	_ = moduleName
-	return nil
+// Disruptive marks rebuilds for approval, since reloading a module drops its
+// running instance.
+func (r *RebuildModuleStrategy) Disruptive() bool {
+	return true
 }
 
 func (r *RebuildModuleStrategy) Priority() int {
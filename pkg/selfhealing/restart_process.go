@@ -3,18 +3,19 @@ package selfhealing
 import (
 	"context"
 	"fmt"
-	"os/exec"
-	"runtime"
+	"strings"
 	"time"
 )
 
-// NewRestartProcessStrategy creates a new restart process strategy
-func NewRestartProcessStrategy() *RestartProcessStrategy {
+// NewRestartProcessStrategy creates a new restart process strategy that
+// restarts controllers through controllers.
+func NewRestartProcessStrategy(controllers ControllerRestarter) *RestartProcessStrategy {
 	return &RestartProcessStrategy{
 		name:        "restart-process",
-		description: "Restarts failed processes to restore functionality",
+		description: "Restarts exited controller processes through the controller manager",
 		priority:    80,
 		config:      make(map[string]interface{}),
+		controllers: controllers,
 	}
 }
 
@@ -30,93 +31,66 @@ func (r *RestartProcessStrategy) Description() string {
 
 // CanHandle determines if this strategy can handle the given health issue
 func (r *RestartProcessStrategy) CanHandle(issue *HealthIssue) bool {
-	return issue.Type == "process" || issue.Component == "process"
+	return issue.Type == "process" || issue.Component == "process" ||
+		issue.Type == "controller" || issue.Component == "controller"
 }
 
-// Apply applies the restart process strategy
+// Apply restarts the controller named in the issue's "controller" context,
+// or every controller that has exited.
 func (r *RestartProcessStrategy) Apply(ctx context.Context, issue *HealthIssue) (*HealingResult, error) {
+	if r.controllers == nil {
+		return nil, fmt.Errorf("no controller manager to restart controllers with")
+	}
 	startTime := time.Now()
 
-	processName := issue.Component
-	if name, ok := issue.Context["process_name"].(string); ok {
-		processName = name
+	names := r.controllers.ExitedControllers()
+	if name, ok := issue.Context["controller"].(string); ok && name != "" {
+		names = []string{name}
 	}
-
-	if err := r.terminateProcess(processName); err != nil {
-		return nil, fmt.Errorf("failed to terminate process: %w", err)
+	if len(names) == 0 {
+		return &HealingResult{
+			Success:     false,
+			ActionTaken: "Looked for exited controllers",
+			Message:     "No exited controllers to restart",
+		}, nil
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	if err := r.startProcess(processName); err != nil {
-		return nil, fmt.Errorf("failed to start process: %w", err)
+	var restarted, failed []string
+	for _, name := range names {
+		if err := r.controllers.RestartController(ctx, name); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		restarted = append(restarted, name)
 	}
 
-	if err := r.verifyProcess(processName); err != nil {
+	metrics := map[string]interface{}{
+		"restart_time_ms": time.Since(startTime).Milliseconds(),
+		"restarted":       len(restarted),
+		"failed":          len(failed),
+	}
+	if len(failed) > 0 {
 		return &HealingResult{
 			Success:     false,
-			ActionTaken: fmt.Sprintf("Attempted to restart process '%s'", processName),
-			Message:     fmt.Sprintf("Process restart failed: %v", err),
-			Metrics: map[string]interface{}{
-				"restart_time_ms": time.Since(startTime).Milliseconds(),
-			},
+			ActionTaken: fmt.Sprintf("Attempted to restart controllers %s", strings.Join(names, ", ")),
+			Message:     fmt.Sprintf("Controller restart failed: %s", strings.Join(failed, "; ")),
+			Metrics:     metrics,
 			RetryNeeded: true,
 		}, nil
 	}
 
-	result := &HealingResult{
+	return &HealingResult{
 		Success:     true,
-		ActionTaken: fmt.Sprintf("Restarted process '%s'", processName),
-		Message:     "Process restarted successfully",
-		Metrics: map[string]interface{}{
-			"restart_time_ms": time.Since(startTime).Milliseconds(),
-		},
-		RetryNeeded: false,
-	}
-
-	return result, nil
-}
-
-// terminateProcess terminates a process by name
-func (r *RestartProcessStrategy) terminateProcess(processName string) error {
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "windows":
-		cmd = exec.Command("taskkill", "/F", "/IM", processName)
-	default:
-		cmd = exec.Command("pkill", "-f", processName)
-	}
-
-	return cmd.Run()
+		ActionTaken: fmt.Sprintf("Restarted controllers %s", strings.Join(restarted, ", ")),
+		Message:     "Controllers restarted successfully",
+		Metrics:     metrics,
+	}, nil
 }
 
-// startProcess starts a process by name
-func (r *RestartProcessStrategy) startProcess(processName string) error {
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "windows":
-		cmd = exec.Command("cmd", "/c", "start", processName)
-	default:
-		cmd = exec.Command(processName)
-	}
-
-	return cmd.Start()
-}
-
-// verifyProcess verifies that a process is running
-func (r *RestartProcessStrategy) verifyProcess(processName string) error {
-	var cmd *exec.Cmd
-
-	switch runtime.GOOS {
-	case "windows":
-		cmd = exec.Command("tasklist", "/FI", fmt.Sprintf("IMAGENAME eq %s", processName))
-	default:
-		cmd = exec.Command("pgrep", "-f", processName)
-	}
-
-	return cmd.Run()
+// Disruptive marks restarts for approval: a restarted controller loses its
+// in-flight work.
+func (r *RestartProcessStrategy) Disruptive() bool {
+	return true
 }
 
 // Priority returns the priority of this strategy
@@ -1,11 +1,35 @@
 package selfhealing
 
-// RestartProcessStrategy is a healing strategy that restarts failed processes
+import "context"
+
+// ControllerRestarter restarts the controllers the agent manages.
+// controller/manager.Manager implements it.
+type ControllerRestarter interface {
+	ExitedControllers() []string
+	RestartController(ctx context.Context, name string) error
+}
+
+// ModuleRepairer reloads modules from the module directory or fetches them
+// again from peers.
+type ModuleRepairer interface {
+	UnloadedModules() []string
+	ReloadModule(ctx context.Context, name string) error
+	RefetchModule(ctx context.Context, name string) error
+}
+
+// PeerReconnector redials P2P peers.
+type PeerReconnector interface {
+	DisconnectedPeers(limit int) []string
+	ReconnectPeer(ctx context.Context, id string) error
+}
+
+// RestartProcessStrategy is a healing strategy that restarts exited controllers
 type RestartProcessStrategy struct {
 	name        string
 	description string
 	priority    int
 	config      map[string]interface{}
+	controllers ControllerRestarter
 }
 
 // RebuildModuleStrategy is a healing strategy that rebuilds corrupted modules
@@ -14,14 +38,16 @@ type RebuildModuleStrategy struct {
 	description string
 	priority    int
 	config      map[string]interface{}
+	modules     ModuleRepairer
 }
 
-// NetworkReconnectStrategy is a healing strategy that reconnects network connections
+// NetworkReconnectStrategy is a healing strategy that reconnects peers
 type NetworkReconnectStrategy struct {
 	name        string
 	description string
 	priority    int
 	config      map[string]interface{}
+	peers       PeerReconnector
 }
 
 // MemoryOptimizationStrategy is a healing strategy that optimizes memory usage
@@ -2,6 +2,7 @@ package selfhealing
 
 import (
 	"context"
+	"errors"
 	"log/slog"
 	"testing"
 
@@ -10,17 +11,73 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+type fakeControllers struct {
+	exited    []string
+	failing   map[string]bool
+	restarted []string
+}
+
+func (f *fakeControllers) ExitedControllers() []string { return f.exited }
+
+func (f *fakeControllers) RestartController(ctx context.Context, name string) error {
+	if f.failing[name] {
+		return errors.New("start failed")
+	}
+	f.restarted = append(f.restarted, name)
+	return nil
+}
+
+type fakeModules struct {
+	unloaded   []string
+	brokenDisk map[string]bool // reload fails
+	noPeers    map[string]bool // refetch fails
+	refetched  []string
+}
+
+func (f *fakeModules) UnloadedModules() []string { return f.unloaded }
+
+func (f *fakeModules) ReloadModule(ctx context.Context, name string) error {
+	if f.brokenDisk[name] {
+		return errors.New("hash mismatch")
+	}
+	return nil
+}
+
+func (f *fakeModules) RefetchModule(ctx context.Context, name string) error {
+	if f.noPeers[name] {
+		return errors.New("no peer serves the module")
+	}
+	f.refetched = append(f.refetched, name)
+	return nil
+}
+
+type fakePeers struct {
+	known       []string
+	reachable   map[string]bool
+	reconnected []string
+}
+
+func (f *fakePeers) DisconnectedPeers(limit int) []string { return f.known }
+
+func (f *fakePeers) ReconnectPeer(ctx context.Context, id string) error {
+	if !f.reachable[id] {
+		return errors.New("dial failed")
+	}
+	f.reconnected = append(f.reconnected, id)
+	return nil
+}
+
 func TestRestartProcessStrategy_Basics(t *testing.T) {
-	s := NewRestartProcessStrategy()
+	s := NewRestartProcessStrategy(nil)
 	require.NotNil(t, s)
 
 	assert.Equal(t, "restart-process", s.Name())
-	assert.Equal(t, "Restarts failed processes to restore functionality", s.Description())
+	assert.Equal(t, "Restarts exited controller processes through the controller manager", s.Description())
 	assert.Equal(t, 80, s.Priority())
 }
 
 func TestRestartProcessStrategy_CanHandle(t *testing.T) {
-	s := NewRestartProcessStrategy()
+	s := NewRestartProcessStrategy(nil)
 
 	tests := []struct {
 		name  string
@@ -29,6 +86,7 @@ func TestRestartProcessStrategy_CanHandle(t *testing.T) {
 	}{
 		{"process type", &HealthIssue{Type: "process"}, true},
 		{"process component", &HealthIssue{Component: "process"}, true},
+		{"controller type", &HealthIssue{Type: "controller"}, true},
 		{"other type", &HealthIssue{Type: "memory"}, false},
 		{"other component", &HealthIssue{Component: "network"}, false},
 	}
@@ -39,38 +97,46 @@ func TestRestartProcessStrategy_CanHandle(t *testing.T) {
 	}
 }
 
-func TestRestartProcessStrategy_Apply_NonExistentProcess(t *testing.T) {
-	s := NewRestartProcessStrategy()
-	issue := &HealthIssue{
-		Type:      "process",
-		Component: "test-does-not-exist-12345",
-	}
-	_, err := s.Apply(context.Background(), issue)
-	assert.Error(t, err)
+func TestRestartProcessStrategy_RestartsExitedControllers(t *testing.T) {
+	controllers := &fakeControllers{exited: []string{"ctl-a", "ctl-b"}}
+	s := NewRestartProcessStrategy(controllers)
+
+	result, err := s.Apply(context.Background(), &HealthIssue{Type: "controller"})
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, []string{"ctl-a", "ctl-b"}, controllers.restarted)
+
+	controllers.restarted = nil
+	result, err = s.Apply(context.Background(), &HealthIssue{Type: "controller", Context: map[string]interface{}{"controller": "ctl-c"}})
+	require.NoError(t, err)
+	assert.True(t, result.Success)
+	assert.Equal(t, []string{"ctl-c"}, controllers.restarted, "the named controller only")
+
+	controllers.failing = map[string]bool{"ctl-b": true}
+	result, err = s.Apply(context.Background(), &HealthIssue{Type: "controller"})
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.Contains(t, result.Message, "ctl-b: start failed")
 }
 
-func TestRestartProcessStrategy_ApplyWithContextName(t *testing.T) {
-	s := NewRestartProcessStrategy()
-	issue := &HealthIssue{
-		Type:      "process",
-		Component: "fallback-process",
-		Context: map[string]interface{}{
-			"process_name": "also-not-real-99999",
-		},
-	}
-	_, err := s.Apply(context.Background(), issue)
+func TestRestartProcessStrategy_NothingToRestart(t *testing.T) {
+	result, err := NewRestartProcessStrategy(&fakeControllers{}).Apply(context.Background(), &HealthIssue{Type: "controller"})
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+
+	_, err = NewRestartProcessStrategy(nil).Apply(context.Background(), &HealthIssue{Type: "controller"})
 	assert.Error(t, err)
 }
 
 func TestRestartProcessStrategy_Configure(t *testing.T) {
-	s := NewRestartProcessStrategy()
+	s := NewRestartProcessStrategy(nil)
 	config := map[string]interface{}{"timeout": 30, "retries": 3}
 	err := s.Configure(config)
 	assert.NoError(t, err)
 }
 
 func TestRebuildModuleStrategy_Basics(t *testing.T) {
-	s := NewRebuildModuleStrategy()
+	s := NewRebuildModuleStrategy(nil)
 	require.NotNil(t, s)
 
 	assert.Equal(t, "rebuild-module", s.Name())
@@ -79,7 +145,7 @@ func TestRebuildModuleStrategy_Basics(t *testing.T) {
 }
 
 func TestRebuildModuleStrategy_CanHandle(t *testing.T) {
-	s := NewRebuildModuleStrategy()
+	s := NewRebuildModuleStrategy(nil)
 
 	tests := []struct {
 		name  string
@@ -97,76 +163,56 @@ func TestRebuildModuleStrategy_CanHandle(t *testing.T) {
 	}
 }
 
-func TestRebuildModuleStrategy_Apply_Success(t *testing.T) {
-	s := NewRebuildModuleStrategy()
-	issue := &HealthIssue{
-		Type:      "module",
-		Component: "test-module",
-		Context: map[string]interface{}{
-			"module_name": "test-module",
-		},
+func TestRebuildModuleStrategy_ReloadThenRefetch(t *testing.T) {
+	modules := &fakeModules{
+		unloaded:   []string{"on-disk", "corrupt"},
+		brokenDisk: map[string]bool{"corrupt": true},
 	}
-	ctx := context.Background()
-	result, err := s.Apply(ctx, issue)
-	assert.NoError(t, err)
-	require.NotNil(t, result)
-	assert.True(t, result.Success)
-	assert.Contains(t, result.ActionTaken, "test-module")
-	assert.Contains(t, result.Message, "rebuilt")
-}
+	s := NewRebuildModuleStrategy(modules)
 
-func TestRebuildModuleStrategy_Apply_DefaultComponent(t *testing.T) {
-	s := NewRebuildModuleStrategy()
-	issue := &HealthIssue{
-		Type:      "module",
-		Component: "default-module",
-	}
-	ctx := context.Background()
-	result, err := s.Apply(ctx, issue)
-	assert.NoError(t, err)
+	result, err := s.Apply(context.Background(), &HealthIssue{Type: "module"})
+	require.NoError(t, err)
 	require.NotNil(t, result)
 	assert.True(t, result.Success)
-}
+	assert.Equal(t, []string{"corrupt"}, modules.refetched, "only modules that fail to reload are fetched from peers")
+	assert.Equal(t, 1, result.Metrics["reloaded"])
+	assert.Equal(t, 1, result.Metrics["refetched"])
 
-func TestRebuildModuleStrategy_VerifyIntegrity(t *testing.T) {
-	s := NewRebuildModuleStrategy()
-
-	err := s.verifyModuleIntegrity([]byte{}, "empty")
-	assert.Error(t, err)
-
-	err = s.verifyModuleIntegrity([]byte("short"), "short")
-	assert.Error(t, err)
-
-	err = s.verifyModuleIntegrity([]byte("long enough data"), "valid")
-	assert.NoError(t, err)
+	modules.noPeers = map[string]bool{"corrupt": true}
+	result, err = s.Apply(context.Background(), &HealthIssue{Type: "module", Context: map[string]interface{}{"module_name": "corrupt"}})
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+	assert.True(t, result.RetryNeeded)
+	assert.Contains(t, result.Message, "no peer serves the module")
 }
 
-func TestRebuildModuleStrategy_RequestFromPeers_CancelledCtx(t *testing.T) {
-	s := NewRebuildModuleStrategy()
-	ctx, cancel := context.WithCancel(context.Background())
-	cancel()
-	_, err := s.requestModuleFromPeers(ctx, "test")
+func TestRebuildModuleStrategy_NothingToRebuild(t *testing.T) {
+	result, err := NewRebuildModuleStrategy(&fakeModules{}).Apply(context.Background(), &HealthIssue{Type: "module"})
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+
+	_, err = NewRebuildModuleStrategy(nil).Apply(context.Background(), &HealthIssue{Type: "module"})
 	assert.Error(t, err)
 }
 
 func TestRebuildModuleStrategy_Configure(t *testing.T) {
-	s := NewRebuildModuleStrategy()
+	s := NewRebuildModuleStrategy(nil)
 	config := map[string]interface{}{"source": "peer", "timeout": 10}
 	err := s.Configure(config)
 	assert.NoError(t, err)
 }
 
 func TestNetworkReconnectStrategy_Basics(t *testing.T) {
-	s := NewNetworkReconnectStrategy()
+	s := NewNetworkReconnectStrategy(nil)
 	require.NotNil(t, s)
 
 	assert.Equal(t, "network-reconnect", s.Name())
-	assert.Equal(t, "Reconnects broken network connections to restore connectivity", s.Description())
+	assert.Equal(t, "Reconnects to known peers to restore connectivity", s.Description())
 	assert.Equal(t, 70, s.Priority())
 }
 
 func TestNetworkReconnectStrategy_CanHandle(t *testing.T) {
-	s := NewNetworkReconnectStrategy()
+	s := NewNetworkReconnectStrategy(nil)
 
 	tests := []struct {
 		name  string
@@ -175,6 +221,7 @@ func TestNetworkReconnectStrategy_CanHandle(t *testing.T) {
 	}{
 		{"network type", &HealthIssue{Type: "network"}, true},
 		{"network component", &HealthIssue{Component: "network"}, true},
+		{"p2p type", &HealthIssue{Type: "p2p"}, true},
 		{"other type", &HealthIssue{Type: "process"}, false},
 	}
 	for _, tt := range tests {
@@ -184,38 +231,41 @@ func TestNetworkReconnectStrategy_CanHandle(t *testing.T) {
 	}
 }
 
-func TestNetworkReconnectStrategy_Apply_UnknownEndpoint(t *testing.T) {
-	s := NewNetworkReconnectStrategy()
-	issue := &HealthIssue{
-		Type:      "network",
-		Component: "network",
-	}
-	ctx := context.Background()
-	result, err := s.Apply(ctx, issue)
-	assert.NoError(t, err)
-	require.NotNil(t, result)
+func TestNetworkReconnectStrategy_ReconnectsKnownPeers(t *testing.T) {
+	peers := &fakePeers{known: []string{"peer-a", "peer-b"}, reachable: map[string]bool{"peer-b": true}}
+	s := NewNetworkReconnectStrategy(peers)
+
+	result, err := s.Apply(context.Background(), &HealthIssue{Type: "p2p"})
+	require.NoError(t, err)
+	assert.True(t, result.Success, "one reachable peer is enough")
+	assert.Equal(t, []string{"peer-b"}, peers.reconnected)
+
+	result, err = s.Apply(context.Background(), &HealthIssue{Type: "p2p", Context: map[string]interface{}{"peer_id": "peer-a"}})
+	require.NoError(t, err)
 	assert.False(t, result.Success)
-	assert.Contains(t, result.ActionTaken, "unknown")
+	assert.Contains(t, result.ActionTaken, "peer-a")
+}
+
+func TestNetworkReconnectStrategy_NoKnownPeers(t *testing.T) {
+	result, err := NewNetworkReconnectStrategy(&fakePeers{}).Apply(context.Background(), &HealthIssue{Type: "p2p"})
+	require.NoError(t, err)
+	assert.False(t, result.Success)
+
+	_, err = NewNetworkReconnectStrategy(nil).Apply(context.Background(), &HealthIssue{Type: "p2p"})
+	assert.Error(t, err)
 }
 
 func TestNetworkReconnectStrategy_Apply_CancelledCtx(t *testing.T) {
-	s := NewNetworkReconnectStrategy()
-	issue := &HealthIssue{
-		Type:      "network",
-		Component: "network",
-		Context: map[string]interface{}{
-			"endpoint": "127.0.0.1:1",
-		},
-	}
+	s := NewNetworkReconnectStrategy(&fakePeers{known: []string{"peer-a"}, reachable: map[string]bool{"peer-a": true}})
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
-	result, err := s.Apply(ctx, issue)
+	result, err := s.Apply(ctx, &HealthIssue{Type: "network"})
 	assert.Error(t, err)
 	assert.Nil(t, result)
 }
 
 func TestNetworkReconnectStrategy_Configure(t *testing.T) {
-	s := NewNetworkReconnectStrategy()
+	s := NewNetworkReconnectStrategy(nil)
 	config := map[string]interface{}{"timeout": 5}
 	err := s.Configure(config)
 	assert.NoError(t, err)
@@ -329,11 +379,11 @@ func TestMultipleStrategiesIntegration(t *testing.T) {
 
 	framework := NewHealingFramework(logger, mockHealthChecker, mockEventHandler)
 
-	framework.RegisterStrategy(NewRestartProcessStrategy())    //nolint:errcheck
-	framework.RegisterStrategy(NewRebuildModuleStrategy())    //nolint:errcheck
-	framework.RegisterStrategy(NewNetworkReconnectStrategy()) //nolint:errcheck
-	framework.RegisterStrategy(NewMemoryOptimizationStrategy()) //nolint:errcheck
-	framework.RegisterStrategy(NewQuarantineNodeStrategy())   //nolint:errcheck
+	framework.RegisterStrategy(NewRestartProcessStrategy(nil))   //nolint:errcheck
+	framework.RegisterStrategy(NewRebuildModuleStrategy(nil))    //nolint:errcheck
+	framework.RegisterStrategy(NewNetworkReconnectStrategy(nil)) //nolint:errcheck
+	framework.RegisterStrategy(NewMemoryOptimizationStrategy())  //nolint:errcheck
+	framework.RegisterStrategy(NewQuarantineNodeStrategy())      //nolint:errcheck
 
 	strategies := framework.ListStrategies()
 	assert.Len(t, strategies, 5)
@@ -349,8 +399,8 @@ func TestApplyHealingStrategies_AllStrategiesFail(t *testing.T) {
 	framework := NewHealingFramework(logger, mockHealthChecker, mockEventHandler)
 
 	failStrategy := &MockStrategy{
-		name:     "always-fail",
-		priority: 50,
+		name:      "always-fail",
+		priority:  50,
 		failApply: true,
 	}
 	framework.RegisterStrategy(failStrategy) //nolint:errcheck
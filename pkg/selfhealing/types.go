@@ -5,6 +5,22 @@ import (
 	"time"
 )
 
+// Config holds the self-healing settings from the agent configuration.
+type Config struct {
+	Enabled       bool          `yaml:"enabled"`
+	Interval      time.Duration `yaml:"interval"`       // time between healing cycles, defaults to 1m
+	PlaybooksPath string        `yaml:"playbooks_path"` // YAML file of healing playbooks
+	LeasePeers    []string      `yaml:"lease_peers"`    // peers whose fleet healing slots are honoured, besides admitted peers
+}
+
+// WithDefaults fills unset fields.
+func (c Config) WithDefaults() Config {
+	if c.Interval <= 0 {
+		c.Interval = time.Minute
+	}
+	return c
+}
+
 // HealingStrategy defines the interface for self-healing strategies
 type HealingStrategy interface {
 	Name() string
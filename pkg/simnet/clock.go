@@ -0,0 +1,127 @@
+package simnet
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock is a virtual clock. Time stands still until Advance moves it, and
+// timers fire in due order from the goroutine that calls Advance. It
+// satisfies controlplane.Clock.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*timer
+}
+
+type timer struct {
+	at     time.Time
+	seq    uint64
+	period time.Duration
+	fn     func(time.Time)
+}
+
+// NewClock returns a clock set to start.
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the virtual time.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// AfterFunc runs fn once the clock has advanced by d. A d of zero or less
+// runs fn before AfterFunc returns. The returned function cancels the timer.
+func (c *Clock) AfterFunc(d time.Duration, fn func(time.Time)) func() {
+	if d <= 0 {
+		fn(c.Now())
+		return func() {}
+	}
+	return c.schedule(d, 0, fn)
+}
+
+// NewTicker returns a channel that receives the virtual time every d and a
+// function that stops it. Like time.Ticker, ticks are dropped while the
+// receiver lags.
+func (c *Clock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	if d <= 0 {
+		panic("simnet: non-positive ticker interval")
+	}
+	ch := make(chan time.Time, 1)
+	stop := c.schedule(d, d, func(now time.Time) {
+		select {
+		case ch <- now:
+		default:
+		}
+	})
+	return ch, stop
+}
+
+func (c *Clock) schedule(d, period time.Duration, fn func(time.Time)) func() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &timer{at: c.now.Add(d), seq: c.seq, period: period, fn: fn}
+	c.insertLocked(t)
+	return func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for i, existing := range c.timers {
+			if existing == t {
+				c.timers = append(c.timers[:i], c.timers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// insertLocked keeps timers ordered by due time, then by creation.
+func (c *Clock) insertLocked(t *timer) {
+	i := sort.Search(len(c.timers), func(i int) bool {
+		o := c.timers[i]
+		return o.at.After(t.at) || (o.at.Equal(t.at) && o.seq > t.seq)
+	})
+	c.timers = append(c.timers, nil)
+	copy(c.timers[i+1:], c.timers[i:])
+	c.timers[i] = t
+}
+
+// Advance moves the clock forward by d, firing every timer that falls due on
+// the way at its own due time.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+	for {
+		c.mu.Lock()
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.at
+		if t.period > 0 {
+			c.seq++
+			t.at = t.at.Add(t.period)
+			t.seq = c.seq
+			c.insertLocked(t)
+		}
+		now := c.now
+		c.mu.Unlock()
+		t.fn(now)
+	}
+}
+
+// Pending returns the number of armed timers.
+func (c *Clock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
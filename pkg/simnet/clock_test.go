@@ -0,0 +1,47 @@
+package simnet
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClock_TimersFireInOrderDuringAdvance(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+
+	var fired []time.Duration
+	c.AfterFunc(30*time.Millisecond, func(now time.Time) { fired = append(fired, now.Sub(start)) })
+	c.AfterFunc(10*time.Millisecond, func(now time.Time) { fired = append(fired, now.Sub(start)) })
+	cancel := c.AfterFunc(20*time.Millisecond, func(now time.Time) { fired = append(fired, now.Sub(start)) })
+	cancel()
+
+	c.Advance(25 * time.Millisecond)
+	require.Equal(t, []time.Duration{10 * time.Millisecond}, fired)
+	require.Equal(t, start.Add(25*time.Millisecond), c.Now())
+
+	c.Advance(5 * time.Millisecond)
+	require.Equal(t, []time.Duration{10 * time.Millisecond, 30 * time.Millisecond}, fired)
+	require.Zero(t, c.Pending())
+}
+
+func TestClock_TickerDropsTicksWhileReceiverLags(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+	ticks, stop := c.NewTicker(time.Second)
+
+	c.Advance(3500 * time.Millisecond)
+	require.Equal(t, start.Add(time.Second), <-ticks, "only the first tick is buffered")
+	select {
+	case tick := <-ticks:
+		t.Fatalf("unexpected tick %v", tick)
+	default:
+	}
+
+	c.Advance(500 * time.Millisecond)
+	require.Equal(t, start.Add(4*time.Second), <-ticks)
+
+	stop()
+	require.Zero(t, c.Pending())
+}
@@ -0,0 +1,124 @@
+package simnet
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/naviNBRuas/APA/pkg/networking/mesh"
+)
+
+// meshTransport is a mesh.TransportMethod over the simulated network. Every
+// node with a mesh transport shares one segment, like a LAN, so Broadcast
+// reaches all of them that a partition does not cut off.
+type meshTransport struct {
+	net   *Network
+	id    string
+	msgCh chan mesh.IncomingMessage
+
+	mu        sync.Mutex
+	listening bool
+	peers     map[string]bool
+}
+
+// MeshTransport returns the mesh transport method of node id, for use with
+// mesh.TransportChain.UseMethods. Connect takes the peer's node ID as the
+// address.
+func (n *Network) MeshTransport(id string) mesh.TransportMethod {
+	n.Attach(id)
+	m := &meshTransport{
+		net:   n,
+		id:    id,
+		msgCh: make(chan mesh.IncomingMessage, subscriptionBuffer),
+		peers: make(map[string]bool),
+	}
+	n.mu.Lock()
+	n.meshes[id] = m
+	n.mu.Unlock()
+	return m
+}
+
+func (m *meshTransport) Name() mesh.TransportType { return mesh.TransportSimulated }
+func (m *meshTransport) Priority() int            { return 0 }
+
+func (m *meshTransport) IsAvailable() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.listening
+}
+
+func (m *meshTransport) Receive() <-chan mesh.IncomingMessage { return m.msgCh }
+
+func (m *meshTransport) Listen(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listening = true
+	return nil
+}
+
+// Connect succeeds when the peer has a listening mesh transport and no
+// partition separates it.
+func (m *meshTransport) Connect(ctx context.Context, addr string) error {
+	peer := m.net.mesh(addr)
+	if peer == nil || !peer.IsAvailable() {
+		return fmt.Errorf("connect %s: %w", addr, ErrUnknownNode)
+	}
+	if !m.net.Reachable(m.id, addr) {
+		return fmt.Errorf("connect %s: %w", addr, ErrUnreachable)
+	}
+	m.mu.Lock()
+	m.peers[addr] = true
+	m.mu.Unlock()
+	return nil
+}
+
+func (m *meshTransport) Send(peerID string, data []byte) error {
+	peer := m.net.mesh(peerID)
+	if peer == nil {
+		return fmt.Errorf("send %s: %w", peerID, ErrUnknownNode)
+	}
+	return m.net.send(m.id, peerID, len(data), func() bool {
+		return peer.receive(m.id, data)
+	})
+}
+
+func (m *meshTransport) Broadcast(data []byte) error {
+	for _, id := range m.net.Nodes() {
+		peer := m.net.mesh(id)
+		if id == m.id || peer == nil || !peer.IsAvailable() {
+			continue
+		}
+		_ = m.net.send(m.id, id, len(data), func() bool {
+			return peer.receive(m.id, data)
+		})
+	}
+	return nil
+}
+
+func (m *meshTransport) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listening = false
+	return nil
+}
+
+// receive queues a message from another node. Messages to a closed
+// transport are discarded.
+func (m *meshTransport) receive(from string, data []byte) bool {
+	if !m.IsAvailable() {
+		return true
+	}
+	msg := mesh.IncomingMessage{From: from, Data: append([]byte(nil), data...), Transport: mesh.TransportSimulated}
+	select {
+	case m.msgCh <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+func (n *Network) mesh(id string) *meshTransport {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.meshes[id]
+}
@@ -0,0 +1,240 @@
+package simnet
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownNode is returned when a message is addressed to a node that
+	// is not attached to the network.
+	ErrUnknownNode = errors.New("unknown node")
+	// ErrUnreachable is returned when a partition separates two nodes.
+	ErrUnreachable = errors.New("node unreachable")
+)
+
+// LinkConfig shapes the traffic on a directed link between two nodes.
+type LinkConfig struct {
+	Latency   time.Duration // one-way delay
+	Jitter    time.Duration // random extra delay up to this
+	Loss      float64       // chance each message is lost, between 0 and 1
+	Bandwidth int64         // bytes per second; 0 is unlimited
+}
+
+// Validate checks the link parameters.
+func (l LinkConfig) Validate() error {
+	if l.Latency < 0 || l.Jitter < 0 || l.Bandwidth < 0 {
+		return fmt.Errorf("latency, jitter and bandwidth must not be negative")
+	}
+	if l.Loss < 0 || l.Loss > 1 {
+		return fmt.Errorf("loss must be between 0 and 1")
+	}
+	return nil
+}
+
+// Stats counts what happened to messages sent over the network.
+type Stats struct {
+	Sent        int64 `json:"sent"`
+	Delivered   int64 `json:"delivered"`
+	Lost        int64 `json:"lost"`        // dropped by link loss
+	Partitioned int64 `json:"partitioned"` // dropped by a partition, at send or on arrival
+	Overflow    int64 `json:"overflow"`    // dropped because the receiver's queue was full
+}
+
+type linkKey struct{ from, to string }
+
+// Network connects simulated nodes. Delivery is scheduled on the virtual
+// clock, so nothing arrives until the clock is advanced past the link's
+// latency and transmission time. Loss and jitter draw from a seeded source.
+type Network struct {
+	clock *Clock
+
+	mu        sync.Mutex
+	rng       *rand.Rand
+	nodes     map[string]bool
+	defLink   LinkConfig
+	links     map[linkKey]LinkConfig
+	busyUntil map[linkKey]time.Time
+	group     map[string]int // partition group per node; nil when healed
+	stats     Stats
+
+	topics map[string]map[string][]chan []byte // topic -> node -> subscriptions
+	meshes map[string]*meshTransport
+}
+
+// NewNetwork returns an empty network on clock. Every link uses link until
+// SetLink overrides it.
+func NewNetwork(clock *Clock, seed int64, link LinkConfig) *Network {
+	return &Network{
+		clock:     clock,
+		rng:       rand.New(rand.NewSource(seed)),
+		nodes:     make(map[string]bool),
+		defLink:   link,
+		links:     make(map[linkKey]LinkConfig),
+		busyUntil: make(map[linkKey]time.Time),
+		topics:    make(map[string]map[string][]chan []byte),
+		meshes:    make(map[string]*meshTransport),
+	}
+}
+
+// Attach adds a node to the network.
+func (n *Network) Attach(id string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nodes[id] = true
+}
+
+// Nodes returns the attached node IDs in order.
+func (n *Network) Nodes() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	ids := make([]string, 0, len(n.nodes))
+	for id := range n.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SetDefaultLink changes the link used between nodes without an override.
+func (n *Network) SetDefaultLink(link LinkConfig) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.defLink = link
+}
+
+// SetLink overrides the link from one node to another. Links are directed;
+// set both directions for a symmetric change.
+func (n *Network) SetLink(from, to string, link LinkConfig) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.links[linkKey{from, to}] = link
+}
+
+// Partition splits the network into groups that cannot reach each other.
+// Nodes not named in any group form one more group. Messages in flight
+// across the cut are dropped when they arrive.
+func (n *Network) Partition(groups ...[]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.group = make(map[string]int)
+	for i, g := range groups {
+		for _, id := range g {
+			n.group[id] = i + 1
+		}
+	}
+}
+
+// Heal removes every partition.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.group = nil
+}
+
+// Reachable reports whether a message from one node can reach another.
+func (n *Network) Reachable(from, to string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.reachableLocked(from, to)
+}
+
+func (n *Network) reachableLocked(from, to string) bool {
+	return n.group == nil || n.group[from] == n.group[to]
+}
+
+// Stats returns the message counters.
+func (n *Network) Stats() Stats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stats
+}
+
+// Queued returns the number of delivered messages that receivers have not
+// read yet.
+func (n *Network) Queued() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	queued := 0
+	for _, subs := range n.topics {
+		for _, chans := range subs {
+			for _, ch := range chans {
+				queued += len(ch)
+			}
+		}
+	}
+	for _, m := range n.meshes {
+		queued += len(m.msgCh)
+	}
+	return queued
+}
+
+// send schedules deliver for a message of size bytes from one node to
+// another. Messages to self are delivered at once.
+func (n *Network) send(from, to string, size int, deliver func() bool) error {
+	n.mu.Lock()
+	if !n.nodes[to] {
+		n.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownNode, to)
+	}
+	n.stats.Sent++
+	if from == to {
+		n.mu.Unlock()
+		n.arrive(from, to, deliver)
+		return nil
+	}
+	if !n.reachableLocked(from, to) {
+		n.stats.Partitioned++
+		n.mu.Unlock()
+		return fmt.Errorf("%w: %s -> %s", ErrUnreachable, from, to)
+	}
+	key := linkKey{from, to}
+	link, ok := n.links[key]
+	if !ok {
+		link = n.defLink
+	}
+	if link.Loss > 0 && n.rng.Float64() < link.Loss {
+		n.stats.Lost++
+		n.mu.Unlock()
+		return nil
+	}
+	now := n.clock.Now()
+	start := now
+	if busy := n.busyUntil[key]; busy.After(start) {
+		start = busy
+	}
+	if link.Bandwidth > 0 {
+		start = start.Add(time.Duration(int64(size) * int64(time.Second) / link.Bandwidth))
+		n.busyUntil[key] = start
+	}
+	delay := start.Sub(now) + link.Latency
+	if link.Jitter > 0 {
+		delay += time.Duration(n.rng.Int63n(int64(link.Jitter) + 1))
+	}
+	n.mu.Unlock()
+
+	n.clock.AfterFunc(delay, func(time.Time) { n.arrive(from, to, deliver) })
+	return nil
+}
+
+func (n *Network) arrive(from, to string, deliver func() bool) {
+	n.mu.Lock()
+	if !n.reachableLocked(from, to) {
+		n.stats.Partitioned++
+		n.mu.Unlock()
+		return
+	}
+	n.mu.Unlock()
+	ok := deliver()
+	n.mu.Lock()
+	if ok {
+		n.stats.Delivered++
+	} else {
+		n.stats.Overflow++
+	}
+	n.mu.Unlock()
+}
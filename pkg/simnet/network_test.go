@@ -0,0 +1,134 @@
+package simnet
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/networking/mesh"
+)
+
+func newTestNetwork(link LinkConfig) (*Clock, *Network) {
+	clock := NewClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	return clock, NewNetwork(clock, 1, link)
+}
+
+func TestNetwork_LatencyAndBandwidth(t *testing.T) {
+	clock, net := newTestNetwork(LinkConfig{Latency: 100 * time.Millisecond, Bandwidth: 1000})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := net.Transport("a")
+	ch, err := net.Transport("b").Subscribe(ctx, "topic")
+	require.NoError(t, err)
+
+	// Two 500-byte messages need 0.5s each on a 1000 B/s link, plus latency.
+	require.NoError(t, a.Publish(ctx, "topic", make([]byte, 500)))
+	require.NoError(t, a.Publish(ctx, "topic", make([]byte, 500)))
+
+	clock.Advance(599 * time.Millisecond)
+	require.Len(t, ch, 0)
+	clock.Advance(time.Millisecond)
+	require.Len(t, ch, 1)
+	clock.Advance(499 * time.Millisecond)
+	require.Len(t, ch, 1)
+	clock.Advance(time.Millisecond)
+	require.Len(t, ch, 2)
+	require.EqualValues(t, 2, net.Stats().Delivered)
+}
+
+func TestNetwork_LossIsSeeded(t *testing.T) {
+	lost := func() int64 {
+		clock, net := newTestNetwork(LinkConfig{Loss: 0.5})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		a := net.Transport("a")
+		_, err := net.Transport("b").Subscribe(ctx, "topic")
+		require.NoError(t, err)
+		for i := 0; i < 100; i++ {
+			require.NoError(t, a.Publish(ctx, "topic", []byte("x")))
+		}
+		clock.Advance(time.Second)
+		stats := net.Stats()
+		require.Equal(t, stats.Sent, stats.Delivered+stats.Lost)
+		return stats.Lost
+	}
+	first := lost()
+	require.Greater(t, first, int64(20))
+	require.Less(t, first, int64(80))
+	require.Equal(t, first, lost(), "same seed, same losses")
+}
+
+func TestNetwork_PartitionDropsInFlightMessages(t *testing.T) {
+	clock, net := newTestNetwork(LinkConfig{Latency: 50 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a := net.Transport("a")
+	chA, err := a.Subscribe(ctx, "topic")
+	require.NoError(t, err)
+	chB, err := net.Transport("b").Subscribe(ctx, "topic")
+	require.NoError(t, err)
+
+	require.NoError(t, a.Publish(ctx, "topic", []byte("in flight")))
+	require.Len(t, chA, 1, "a node receives its own messages at once")
+	net.Partition([]string{"a"}, []string{"b"})
+	clock.Advance(time.Second)
+	require.Len(t, chB, 0)
+
+	require.NoError(t, a.Publish(ctx, "topic", []byte("cut off")))
+	clock.Advance(time.Second)
+	require.Len(t, chB, 0)
+	require.EqualValues(t, 2, net.Stats().Partitioned)
+
+	net.Heal()
+	require.NoError(t, a.Publish(ctx, "topic", []byte("healed")))
+	clock.Advance(time.Second)
+	require.Equal(t, "healed", string(<-chB))
+}
+
+func TestNetwork_MeshTransportChain(t *testing.T) {
+	clock, net := newTestNetwork(LinkConfig{Latency: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chains := map[string]*mesh.TransportChain{}
+	for _, id := range []string{"a", "b", "c"} {
+		chain := mesh.NewTransportChain(slog.Default(), mesh.MeshConfig{})
+		chain.UseMethods(net.MeshTransport(id))
+		require.NoError(t, chain.Start(ctx))
+		require.Equal(t, []string{string(mesh.TransportSimulated)}, chain.Available())
+		chains[id] = chain
+	}
+
+	require.NoError(t, chains["a"].Connect(ctx, "b", "b"))
+	require.NoError(t, chains["a"].SendToPeer("b", "ping", []byte("hi")))
+	require.NoError(t, chains["a"].Broadcast("hello", nil))
+	clock.Advance(10 * time.Millisecond)
+
+	receive := func(id string) mesh.IncomingMessage {
+		select {
+		case msg := <-chains[id].Receive():
+			return msg
+		case <-time.After(time.Second):
+			t.Fatalf("%s received nothing", id)
+			return mesh.IncomingMessage{}
+		}
+	}
+	require.Equal(t, "a", receive("b").From)
+	require.Equal(t, "a", receive("b").From)
+	require.Equal(t, mesh.TransportSimulated, receive("c").Transport)
+
+	net.Partition([]string{"a"}, []string{"b", "c"})
+	require.Error(t, chains["a"].Connect(ctx, "c", "c"))
+	require.NoError(t, chains["a"].Broadcast("hello", nil))
+	clock.Advance(10 * time.Millisecond)
+	select {
+	case msg := <-chains["c"].Receive():
+		t.Fatalf("message crossed the partition: %+v", msg)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,106 @@
+package simnet
+
+import (
+	"context"
+	"sort"
+
+	"github.com/naviNBRuas/APA/pkg/controlplane"
+)
+
+// subscriptionBuffer bounds each subscription like a pubsub peer queue;
+// messages beyond it are dropped and counted as overflow.
+const subscriptionBuffer = 256
+
+// pubsubTransport is a topic bus over the simulated network, standing in
+// for libp2p pubsub behind controlplane.Transport.
+type pubsubTransport struct {
+	net *Network
+	id  string
+}
+
+// Transport returns the pubsub transport of node id. Published messages
+// reach every subscriber of the topic on every reachable node, including
+// the sender's own subscriptions, as libp2p pubsub does.
+func (n *Network) Transport(id string) controlplane.Transport {
+	n.Attach(id)
+	return &pubsubTransport{net: n, id: id}
+}
+
+func (t *pubsubTransport) LocalID() string { return t.id }
+
+func (t *pubsubTransport) Publish(ctx context.Context, topic string, payload []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	data := append([]byte(nil), payload...)
+	for _, to := range t.net.subscribers(topic) {
+		to := to
+		// Unreachable and unknown peers are a normal pubsub condition, not
+		// a publish error.
+		_ = t.net.send(t.id, to, len(data), func() bool {
+			return t.net.deliverTopic(topic, to, data)
+		})
+	}
+	return nil
+}
+
+func (t *pubsubTransport) Subscribe(ctx context.Context, topic string) (<-chan []byte, error) {
+	ch := make(chan []byte, subscriptionBuffer)
+	t.net.mu.Lock()
+	subs, ok := t.net.topics[topic]
+	if !ok {
+		subs = make(map[string][]chan []byte)
+		t.net.topics[topic] = subs
+	}
+	subs[t.id] = append(subs[t.id], ch)
+	t.net.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.net.unsubscribe(topic, t.id, ch)
+	}()
+	return ch, nil
+}
+
+// subscribers returns the nodes subscribed to topic.
+func (n *Network) subscribers(topic string) []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var ids []string
+	for id, chans := range n.topics[topic] {
+		if len(chans) > 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// deliverTopic hands data to every subscription of node to on topic. It
+// reports false if any of them was full.
+func (n *Network) deliverTopic(topic, to string, data []byte) bool {
+	n.mu.Lock()
+	chans := append([]chan []byte(nil), n.topics[topic][to]...)
+	n.mu.Unlock()
+	ok := true
+	for _, ch := range chans {
+		select {
+		case ch <- data:
+		default:
+			ok = false
+		}
+	}
+	return ok
+}
+
+func (n *Network) unsubscribe(topic, id string, ch chan []byte) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	chans := n.topics[topic][id]
+	for i, c := range chans {
+		if c == ch {
+			n.topics[topic][id] = append(chans[:i], chans[i+1:]...)
+			return
+		}
+	}
+}
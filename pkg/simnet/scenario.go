@@ -0,0 +1,109 @@
+package simnet
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Step is one action of a scenario, taken once At of virtual time has
+// passed since the simulation began.
+type Step struct {
+	At   time.Duration
+	Name string
+	Do   func(*Sim) error
+}
+
+// Scenario is a script of steps run against a simulation. Steps run in
+// order of At; steps with the same At run in the order given.
+type Scenario struct {
+	Name  string
+	Steps []Step
+	// Until is how long the scenario runs; it defaults to the last step.
+	Until time.Duration
+}
+
+// RunScenario runs sc and returns the first step error, naming the step.
+func (s *Sim) RunScenario(sc Scenario) error {
+	steps := append([]Step(nil), sc.Steps...)
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].At < steps[j].At })
+	for _, step := range steps {
+		if wait := step.At - s.Elapsed(); wait > 0 {
+			s.Run(wait)
+		}
+		if err := step.Do(s); err != nil {
+			return fmt.Errorf("scenario %q: step %q at %s: %w", sc.Name, step.Name, step.At, err)
+		}
+		s.settle()
+	}
+	if wait := sc.Until - s.Elapsed(); wait > 0 {
+		s.Run(wait)
+	}
+	return nil
+}
+
+// Partition splits the network into groups of node IDs at the given time.
+func Partition(at time.Duration, groups ...[]string) Step {
+	return Step{At: at, Name: "partition", Do: func(s *Sim) error {
+		s.Network.Partition(groups...)
+		return nil
+	}}
+}
+
+// Heal removes every partition at the given time.
+func Heal(at time.Duration) Step {
+	return Step{At: at, Name: "heal", Do: func(s *Sim) error {
+		s.Network.Heal()
+		return nil
+	}}
+}
+
+// Link changes the default link at the given time.
+func Link(at time.Duration, link LinkConfig) Step {
+	return Step{At: at, Name: "link", Do: func(s *Sim) error {
+		if err := link.Validate(); err != nil {
+			return err
+		}
+		s.Network.SetDefaultLink(link)
+		return nil
+	}}
+}
+
+// Set writes key on node through its control plane at the given time.
+func Set(at time.Duration, node, key, value string) Step {
+	return Step{At: at, Name: "set " + key + " on " + node, Do: func(s *Sim) error {
+		n := s.Node(node)
+		if n == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownNode, node)
+		}
+		return n.ControlPlane.Set(context.Background(), key, []byte(value), 0)
+	}}
+}
+
+// Expect checks a condition at the given time.
+func Expect(at time.Duration, name string, check func(*Sim) error) Step {
+	return Step{At: at, Name: name, Do: check}
+}
+
+// ExpectConverged checks that every node holds value for key at the given
+// time.
+func ExpectConverged(at time.Duration, key, value string) Step {
+	return Expect(at, "converged "+key, func(s *Sim) error {
+		if !s.Converged(key, value) {
+			return fmt.Errorf("want %q on every node, have %v", value, s.Values(key))
+		}
+		return nil
+	})
+}
+
+// ExpectLeaders checks the number of nodes that consider themselves leader
+// at the given time.
+func ExpectLeaders(at time.Duration, count int) Step {
+	return Expect(at, fmt.Sprintf("%d leaders", count), func(s *Sim) error {
+		if leaders := s.Leaders(); len(leaders) != count {
+			return fmt.Errorf("want %d leaders, have %v", count, leaders)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,242 @@
+// Package simnet runs several agents' control planes and mesh transports in
+// one process over a simulated network, so multi-node behaviour such as
+// state convergence, leader election and partition healing can be tested
+// with plain go test instead of Docker or real libp2p hosts.
+//
+// Time is virtual: nothing happens until the simulation is advanced, and
+// link latency, jitter, loss, bandwidth and partitions all act on the
+// virtual clock. Randomness is drawn from a seed, but the nodes still run
+// on goroutines, so the order of concurrent messages can vary between runs.
+package simnet
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/naviNBRuas/APA/pkg/controlplane"
+	"github.com/naviNBRuas/APA/pkg/networking/mesh"
+)
+
+// Config describes a simulation.
+type Config struct {
+	Nodes        int                 // number of agents
+	Seed         int64               // seeds link randomness and election ranks
+	Link         LinkConfig          // default link between every pair of nodes
+	ControlPlane controlplane.Config // control plane settings for every node
+	Step         time.Duration       // virtual time advanced per step; default 10ms
+	Start        time.Time           // initial virtual time; default 2025-01-01 UTC
+}
+
+// WithDefaults fills in zero values.
+func (c Config) WithDefaults() Config {
+	if c.Step <= 0 {
+		c.Step = 10 * time.Millisecond
+	}
+	if c.Start.IsZero() {
+		c.Start = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return c
+}
+
+// Validate checks the configuration.
+func (c Config) Validate() error {
+	if c.Nodes <= 0 {
+		return fmt.Errorf("nodes must be positive")
+	}
+	if err := c.Link.Validate(); err != nil {
+		return fmt.Errorf("link: %w", err)
+	}
+	return nil
+}
+
+// Node is one simulated agent.
+type Node struct {
+	ID           string
+	Rank         int64 // election rank
+	ControlPlane *controlplane.ControlPlane
+	Mesh         *mesh.TransportChain
+}
+
+// Sim is a running simulation.
+type Sim struct {
+	Clock   *Clock
+	Network *Network
+	Nodes   []*Node
+
+	logger *slog.Logger
+	cfg    Config
+	start  time.Time
+	cancel context.CancelFunc
+}
+
+// New builds a simulation of cfg.Nodes agents named node-0, node-1 and so
+// on. Each gets a control plane on the simulated pubsub and a mesh transport
+// chain on the simulated segment.
+func New(logger *slog.Logger, cfg Config) (*Sim, error) {
+	cfg = cfg.WithDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	clock := NewClock(cfg.Start)
+	s := &Sim{
+		Clock:   clock,
+		Network: NewNetwork(clock, cfg.Seed, cfg.Link),
+		logger:  logger,
+		cfg:     cfg,
+		start:   cfg.Start,
+	}
+	ranks := rand.New(rand.NewSource(cfg.Seed))
+	for i := 0; i < cfg.Nodes; i++ {
+		id := fmt.Sprintf("node-%d", i)
+		nodeLogger := logger.With("node", id)
+
+		cp := controlplane.New(nodeLogger, s.Network.Transport(id), cfg.ControlPlane)
+		cp.SetClock(clock)
+		rank := ranks.Int63()
+		cp.SetLeaderRank(rank)
+
+		chain := mesh.NewTransportChain(nodeLogger, mesh.MeshConfig{})
+		chain.UseMethods(s.Network.MeshTransport(id))
+
+		s.Nodes = append(s.Nodes, &Node{ID: id, Rank: rank, ControlPlane: cp, Mesh: chain})
+	}
+	return s, nil
+}
+
+// Start starts every node.
+func (s *Sim) Start(ctx context.Context) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, n := range s.Nodes {
+		if err := n.Mesh.Start(ctx); err != nil {
+			return fmt.Errorf("%s: start mesh: %w", n.ID, err)
+		}
+		if err := n.ControlPlane.Start(ctx); err != nil {
+			return fmt.Errorf("%s: start control plane: %w", n.ID, err)
+		}
+	}
+	s.settle()
+	return nil
+}
+
+// Stop stops every node.
+func (s *Sim) Stop() {
+	for _, n := range s.Nodes {
+		n.ControlPlane.Stop()
+		n.Mesh.Stop()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// Node returns the node with id, or nil.
+func (s *Sim) Node(id string) *Node {
+	for _, n := range s.Nodes {
+		if n.ID == id {
+			return n
+		}
+	}
+	return nil
+}
+
+// Elapsed returns the virtual time since the simulation began.
+func (s *Sim) Elapsed() time.Duration {
+	return s.Clock.Now().Sub(s.start)
+}
+
+// Run advances virtual time by d, one step at a time, letting the nodes
+// handle what was delivered after each step.
+func (s *Sim) Run(d time.Duration) {
+	for d > 0 {
+		step := s.cfg.Step
+		if step > d {
+			step = d
+		}
+		s.Clock.Advance(step)
+		s.settle()
+		d -= step
+	}
+}
+
+// RunUntil advances virtual time step by step until cond holds or limit has
+// passed, and reports whether cond held.
+func (s *Sim) RunUntil(limit time.Duration, cond func() bool) bool {
+	deadline := s.Clock.Now().Add(limit)
+	for {
+		if cond() {
+			return true
+		}
+		if !s.Clock.Now().Before(deadline) {
+			return false
+		}
+		s.Run(s.cfg.Step)
+	}
+}
+
+// settle gives the node goroutines real time to drain their queues, so a
+// step's deliveries are handled before the clock moves on. Handling can
+// publish more messages; those wait on the clock for their own delay.
+func (s *Sim) settle() {
+	idle := 0
+	for i := 0; i < 1000 && idle < 3; i++ {
+		runtime.Gosched()
+		time.Sleep(50 * time.Microsecond)
+		if s.Network.Queued() == 0 {
+			idle++
+		} else {
+			idle = 0
+		}
+	}
+}
+
+// Leaders returns the IDs of the nodes that consider themselves leader.
+func (s *Sim) Leaders() []string {
+	var ids []string
+	for _, n := range s.Nodes {
+		if n.ControlPlane.IsLeader() {
+			ids = append(ids, n.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Values returns each node's value for key; nodes without it are omitted.
+func (s *Sim) Values(key string) map[string]string {
+	out := make(map[string]string)
+	for _, n := range s.Nodes {
+		if v, ok := n.ControlPlane.Get(key); ok {
+			out[n.ID] = string(v)
+		}
+	}
+	return out
+}
+
+// Converged reports whether every node holds value for key.
+func (s *Sim) Converged(key, value string) bool {
+	values := s.Values(key)
+	if len(values) != len(s.Nodes) {
+		return false
+	}
+	for _, v := range values {
+		if v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// IDs returns the IDs of the nodes with the given indexes, which is handy
+// for describing partitions.
+func (s *Sim) IDs(indexes ...int) []string {
+	ids := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		ids = append(ids, s.Nodes[i].ID)
+	}
+	return ids
+}
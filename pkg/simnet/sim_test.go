@@ -0,0 +1,142 @@
+package simnet
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/controlplane"
+)
+
+func newTestSim(t *testing.T, cfg Config) *Sim {
+	t.Helper()
+	s, err := New(slog.Default(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// highestRank returns the node that should win the election among ids.
+func highestRank(s *Sim, ids []string) string {
+	best := s.Node(ids[0])
+	for _, id := range ids[1:] {
+		if n := s.Node(id); n.Rank > best.Rank {
+			best = n
+		}
+	}
+	return best.ID
+}
+
+func TestSim_LeaderlessConvergence(t *testing.T) {
+	s := newTestSim(t, Config{
+		Nodes:        8,
+		Seed:         7,
+		Link:         LinkConfig{Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond, Bandwidth: 64 << 10},
+		ControlPlane: controlplane.Config{Mode: "leaderless"},
+	})
+	require.NoError(t, s.Start(context.Background()))
+
+	require.NoError(t, s.Nodes[3].ControlPlane.Set(context.Background(), "config/rev", []byte("42"), 0))
+	require.False(t, s.Converged("config/rev", "42"), "nothing arrives before the clock moves")
+	require.True(t, s.RunUntil(2*time.Second, func() bool { return s.Converged("config/rev", "42") }), s.Values("config/rev"))
+	require.GreaterOrEqual(t, s.Elapsed(), 20*time.Millisecond)
+}
+
+func TestSim_TotalLossPreventsConvergence(t *testing.T) {
+	s := newTestSim(t, Config{
+		Nodes:        4,
+		Seed:         1,
+		Link:         LinkConfig{Latency: 5 * time.Millisecond, Loss: 1},
+		ControlPlane: controlplane.Config{Mode: "leaderless"},
+	})
+	require.NoError(t, s.Start(context.Background()))
+
+	require.NoError(t, s.Nodes[0].ControlPlane.Set(context.Background(), "k", []byte("v"), 0))
+	s.Run(time.Second)
+	require.Equal(t, map[string]string{"node-0": "v"}, s.Values("k"))
+	require.EqualValues(t, 3, s.Network.Stats().Lost)
+}
+
+func TestSim_ElectionPicksHighestRank(t *testing.T) {
+	s := newTestSim(t, Config{
+		Nodes:        5,
+		Seed:         3,
+		Link:         LinkConfig{Latency: 15 * time.Millisecond},
+		ControlPlane: controlplane.Config{Mode: "elected", SyncInterval: time.Second},
+	})
+	require.NoError(t, s.Start(context.Background()))
+
+	want := highestRank(s, s.IDs(0, 1, 2, 3, 4))
+	require.True(t, s.RunUntil(3*time.Second, func() bool {
+		leaders := s.Leaders()
+		return len(leaders) == 1 && leaders[0] == want
+	}), "leaders %v, want %s", s.Leaders(), want)
+}
+
+func TestSim_PartitionHealing(t *testing.T) {
+	s := newTestSim(t, Config{
+		Nodes:        5,
+		Seed:         11,
+		Link:         LinkConfig{Latency: 25 * time.Millisecond, Jitter: 5 * time.Millisecond},
+		ControlPlane: controlplane.Config{Mode: "elected", SyncInterval: time.Second},
+		Step:         50 * time.Millisecond,
+	})
+	left, right := s.IDs(0, 1), s.IDs(2, 3, 4)
+	// Partitioned before start, each side elects its own leader.
+	s.Network.Partition(left, right)
+	require.NoError(t, s.Start(context.Background()))
+
+	winner := highestRank(s, append(append([]string(nil), left...), right...))
+	err := s.RunScenario(Scenario{
+		Name: "split brain heals",
+		Steps: []Step{
+			ExpectLeaders(2*time.Second, 2),
+			Expect(2*time.Second, "one leader per side", func(s *Sim) error {
+				want := []string{highestRank(s, left), highestRank(s, right)}
+				sort.Strings(want)
+				if leaders := s.Leaders(); fmt.Sprint(leaders) != fmt.Sprint(want) {
+					return fmt.Errorf("leaders %v, want %v", leaders, want)
+				}
+				return nil
+			}),
+			Heal(3 * time.Second),
+			ExpectLeaders(5*time.Second, 1),
+			Expect(5*time.Second, "highest rank wins", func(s *Sim) error {
+				if leaders := s.Leaders(); leaders[0] != winner {
+					return fmt.Errorf("leader %s, want %s", leaders[0], winner)
+				}
+				return nil
+			}),
+			Set(5*time.Second, "node-1", "fleet/mode", "maintenance"),
+			ExpectConverged(7*time.Second, "fleet/mode", "maintenance"),
+		},
+	})
+	require.NoError(t, err)
+}
+
+func TestSim_ScenarioReportsFailingStep(t *testing.T) {
+	s := newTestSim(t, Config{Nodes: 2, ControlPlane: controlplane.Config{Mode: "leaderless"}})
+	require.NoError(t, s.Start(context.Background()))
+
+	err := s.RunScenario(Scenario{
+		Name: "cut off",
+		Steps: []Step{
+			Partition(0, s.IDs(0), s.IDs(1)),
+			Set(100*time.Millisecond, "node-0", "k", "v"),
+			ExpectConverged(time.Second, "k", "v"),
+		},
+	})
+	require.ErrorContains(t, err, `step "converged k"`)
+	require.Equal(t, time.Second, s.Elapsed())
+}
+
+func TestConfig_Validate(t *testing.T) {
+	require.Error(t, Config{}.Validate())
+	require.Error(t, Config{Nodes: 1, Link: LinkConfig{Loss: 2}}.Validate())
+	require.NoError(t, Config{Nodes: 1, Link: LinkConfig{Latency: time.Millisecond}}.Validate())
+}
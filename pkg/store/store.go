@@ -1,20 +1,30 @@
 package store
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/naviNBRuas/APA/pkg/faults"
+	"github.com/naviNBRuas/APA/pkg/metrics"
 )
 
+// DefaultFlushInterval is how often Run writes pending changes to disk.
+const DefaultFlushInterval = 5 * time.Second
+
 type Store struct {
-	path     string
-	logger   *slog.Logger
-	mu       sync.RWMutex
-	data     map[string]json.RawMessage
-	modified bool
+	path          string
+	logger        *slog.Logger
+	mu            sync.RWMutex
+	data          map[string]json.RawMessage
+	modified      bool
+	metrics       *metrics.Metrics
+	flushInterval time.Duration
 }
 
 func New(path string, logger *slog.Logger) (*Store, error) {
@@ -22,9 +32,10 @@ func New(path string, logger *slog.Logger) (*Store, error) {
 		return nil, fmt.Errorf("store mkdir: %w", err)
 	}
 	s := &Store{
-		path:   path,
-		logger: logger,
-		data:   make(map[string]json.RawMessage),
+		path:          path,
+		logger:        logger,
+		data:          make(map[string]json.RawMessage),
+		flushInterval: DefaultFlushInterval,
 	}
 	if err := s.load(); err != nil {
 		logger.Warn("Store: no existing data, starting fresh", "path", path, "error", err)
@@ -32,6 +43,59 @@ func New(path string, logger *slog.Logger) (*Store, error) {
 	return s, nil
 }
 
+// SetMetrics sets the registry that operation latencies are recorded into.
+func (s *Store) SetMetrics(mt *metrics.Metrics) {
+	s.mu.Lock()
+	s.metrics = mt
+	s.mu.Unlock()
+}
+
+// SetFlushInterval changes how often Run writes pending changes to disk.
+// The new interval applies from the next flush.
+func (s *Store) SetFlushInterval(d time.Duration) {
+	if d <= 0 {
+		d = DefaultFlushInterval
+	}
+	s.mu.Lock()
+	s.flushInterval = d
+	s.mu.Unlock()
+}
+
+// FlushInterval returns the current write-behind interval.
+func (s *Store) FlushInterval() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.flushInterval
+}
+
+// Run writes pending changes to disk every flush interval until ctx is
+// done, then flushes once more.
+func (s *Store) Run(ctx context.Context) {
+	timer := time.NewTimer(s.FlushInterval())
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := s.Flush(); err != nil {
+				s.logger.Error("Store: final flush failed", "path", s.path, "error", err)
+			}
+			return
+		case <-timer.C:
+			if err := s.Flush(); err != nil {
+				s.logger.Error("Store: flush failed", "path", s.path, "error", err)
+			}
+			timer.Reset(s.FlushInterval())
+		}
+	}
+}
+
+func (s *Store) observe(op string, start time.Time) {
+	s.mu.RLock()
+	mt := s.metrics
+	s.mu.RUnlock()
+	mt.ObserveStoreOp(op, time.Since(start))
+}
+
 func (s *Store) load() error {
 	data, err := os.ReadFile(s.path)
 	if err != nil {
@@ -41,6 +105,9 @@ func (s *Store) load() error {
 }
 
 func (s *Store) save() error {
+	if err := faults.Fail(faults.StoreWrite, s.path); err != nil {
+		return fmt.Errorf("store write: %w", err)
+	}
 	data, err := json.MarshalIndent(s.data, "", "  ")
 	if err != nil {
 		return fmt.Errorf("store marshal: %w", err)
@@ -56,6 +123,7 @@ func (s *Store) save() error {
 }
 
 func (s *Store) Get(key string, value interface{}) error {
+	defer s.observe("get", time.Now())
 	s.mu.RLock()
 	raw, ok := s.data[key]
 	s.mu.RUnlock()
@@ -66,6 +134,7 @@ func (s *Store) Get(key string, value interface{}) error {
 }
 
 func (s *Store) Set(key string, value interface{}) error {
+	defer s.observe("set", time.Now())
 	raw, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("store marshal value: %w", err)
@@ -85,6 +154,7 @@ func (s *Store) SetAndSave(key string, value interface{}) error {
 }
 
 func (s *Store) Delete(key string) {
+	defer s.observe("delete", time.Now())
 	s.mu.Lock()
 	delete(s.data, key)
 	s.modified = true
@@ -109,6 +179,7 @@ func (s *Store) Keys() []string {
 }
 
 func (s *Store) Flush() error {
+	defer s.observe("flush", time.Now())
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if !s.modified {
@@ -0,0 +1,33 @@
+//go:build faults
+
+package store
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/naviNBRuas/APA/pkg/faults"
+)
+
+func TestInjectedWriteFailureKeepsChangesPending(t *testing.T) {
+	t.Cleanup(faults.Reset)
+	path := filepath.Join(t.TempDir(), "test.json")
+	s, err := New(path, slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, faults.Set(faults.Rule{Point: faults.StoreWrite, Target: path, Count: 1}))
+
+	require.NoError(t, s.Set("k", "v"))
+	assert.ErrorIs(t, s.Flush(), faults.ErrInjected)
+
+	// The change stays pending and the next flush writes it.
+	require.NoError(t, s.Flush())
+	reopened, err := New(path, slog.Default())
+	require.NoError(t, err)
+	var got string
+	require.NoError(t, reopened.Get("k", &got))
+	assert.Equal(t, "v", got)
+}
@@ -1,10 +1,12 @@
 package store
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -173,3 +175,34 @@ func TestLoadExistingFile(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "1.0.0", version)
 }
+
+func TestRunFlushesPendingChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.json")
+	s, err := New(path, slog.Default())
+	require.NoError(t, err)
+	s.SetFlushInterval(10 * time.Millisecond)
+	assert.Equal(t, 10*time.Millisecond, s.FlushInterval())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	require.NoError(t, s.Set("greeting", "hello"))
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}, time.Second, 5*time.Millisecond)
+
+	// Changes made just before shutdown are flushed on the way out.
+	require.NoError(t, s.Set("farewell", "bye"))
+	cancel()
+	<-done
+	reopened, err := New(path, slog.Default())
+	require.NoError(t, err)
+	var got string
+	require.NoError(t, reopened.Get("farewell", &got))
+	assert.Equal(t, "bye", got)
+}
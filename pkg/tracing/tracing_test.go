@@ -0,0 +1,107 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// useRecorder installs an in-memory tracer provider for the duration of the test.
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	prevTP, prevProp := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		_ = tp.Shutdown(context.Background())
+		otel.SetTracerProvider(prevTP)
+		otel.SetTextMapPropagator(prevProp)
+	})
+	return rec
+}
+
+func TestSetupDisabledIsNoop(t *testing.T) {
+	shutdown, err := Setup(context.Background(), testLogger(), Config{}, "v0.0.0")
+	require.NoError(t, err)
+	require.NoError(t, shutdown(context.Background()))
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), testLogger(), Config{Enabled: true, Exporter: "carrier-pigeon"}, "v0.0.0")
+	require.Error(t, err)
+}
+
+func TestInjectExtractRoundTrip(t *testing.T) {
+	useRecorder(t)
+
+	require.Nil(t, Inject(context.Background()))
+
+	ctx, span := Start(context.Background(), "parent")
+	carrier := Inject(ctx)
+	span.End()
+	require.Contains(t, carrier, "traceparent")
+
+	remote := trace.SpanContextFromContext(Extract(context.Background(), carrier))
+	require.True(t, remote.IsRemote())
+	require.Equal(t, span.SpanContext().TraceID(), remote.TraceID())
+}
+
+func TestMiddlewareContinuesTraceFromHeaders(t *testing.T) {
+	rec := useRecorder(t)
+
+	parentCtx, parent := Start(context.Background(), "client")
+	parent.End()
+
+	var handlerSpan trace.SpanContext
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/status", nil)
+	otel.GetTextMapPropagator().Inject(parentCtx, propagation.HeaderCarrier(req.Header))
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Equal(t, parent.SpanContext().TraceID(), handlerSpan.TraceID())
+	ended := rec.Ended()
+	require.Len(t, ended, 2)
+	server := ended[1]
+	require.Equal(t, "admin GET /admin/status", server.Name())
+	require.Equal(t, parent.SpanContext().SpanID(), server.Parent().SpanID())
+}
+
+func TestFileExporterWritesSpans(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces", "spans.jsonl")
+	prevTP := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(prevTP) })
+
+	shutdown, err := Setup(context.Background(), testLogger(), Config{Enabled: true, Exporter: ExporterFile, FilePath: path}, "v1.2.3")
+	require.NoError(t, err)
+
+	_, span := Start(context.Background(), "module.RunModule")
+	End(span, nil)
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "module.RunModule")
+	require.Contains(t, string(data), "v1.2.3")
+}
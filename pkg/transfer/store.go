@@ -0,0 +1,324 @@
+// Package transfer distributes artifacts between agents as content-addressed
+// chunks. An artifact is split into fixed-size chunks described by a
+// Manifest whose Merkle root names the artifact; agents fetch the chunks in
+// parallel from every peer that provides the root, verify each chunk on
+// arrival and keep them on disk so an interrupted transfer resumes where it
+// stopped. Modules and update binaries use it.
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ChunkSize is the size of every chunk but the last. It is part of the
+// Merkle root, so publishers and fetchers must agree on it.
+const ChunkSize = 256 << 10
+
+// Limits on manifests received from peers.
+const (
+	maxChunkSize    = 16 << 20
+	maxArtifactSize = 4 << 30
+)
+
+// ErrNotFound is returned for manifests and chunks the store does not hold.
+var ErrNotFound = errors.New("content not found")
+
+// Manifest describes an artifact as an ordered list of chunks.
+type Manifest struct {
+	Name      string   `json:"name"` // informational; not covered by Root
+	Size      int64    `json:"size"`
+	ChunkSize int      `json:"chunk_size"`
+	Chunks    []string `json:"chunks"` // hex SHA-256 of each chunk
+	Root      string   `json:"root"`   // hex Merkle root over Size, ChunkSize and Chunks
+}
+
+// BuildManifest splits data into chunks and computes its manifest.
+func BuildManifest(name string, data []byte) *Manifest {
+	m := &Manifest{Name: name, Size: int64(len(data)), ChunkSize: ChunkSize, Chunks: []string{}}
+	for off := 0; off < len(data); off += ChunkSize {
+		end := min(off+ChunkSize, len(data))
+		sum := sha256.Sum256(data[off:end])
+		m.Chunks = append(m.Chunks, hex.EncodeToString(sum[:]))
+	}
+	m.Root, _ = m.computeRoot()
+	return m
+}
+
+// Verify checks that the chunk list is consistent with Size and that Root
+// is its Merkle root.
+func (m *Manifest) Verify() error {
+	if m.ChunkSize <= 0 || m.ChunkSize > maxChunkSize || m.Size < 0 || m.Size > maxArtifactSize {
+		return fmt.Errorf("invalid manifest geometry")
+	}
+	if want := (m.Size + int64(m.ChunkSize) - 1) / int64(m.ChunkSize); int64(len(m.Chunks)) != want {
+		return fmt.Errorf("manifest lists %d chunks, expected %d", len(m.Chunks), want)
+	}
+	root, err := m.computeRoot()
+	if err != nil {
+		return err
+	}
+	if root != m.Root {
+		return fmt.Errorf("manifest root mismatch")
+	}
+	return nil
+}
+
+// chunkLen returns the length of chunk i.
+func (m *Manifest) chunkLen(i int) int {
+	if i == len(m.Chunks)-1 {
+		return int(m.Size - int64(i)*int64(m.ChunkSize))
+	}
+	return m.ChunkSize
+}
+
+// computeRoot hashes the chunk list pairwise, with domain-separated leaf and
+// node hashes, and binds the result to the artifact geometry.
+func (m *Manifest) computeRoot() (string, error) {
+	level := make([][]byte, len(m.Chunks))
+	for i, c := range m.Chunks {
+		b, err := decodeHash(c)
+		if err != nil {
+			return "", err
+		}
+		leaf := sha256.Sum256(append([]byte{0x00}, b...))
+		level[i] = leaf[:]
+	}
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+			node := sha256.Sum256(append(append([]byte{0x01}, level[i]...), level[i+1]...))
+			next = append(next, node[:])
+		}
+		level = next
+	}
+
+	root := []byte{0x02}
+	root = binary.AppendUvarint(root, uint64(m.Size))
+	root = binary.AppendUvarint(root, uint64(m.ChunkSize))
+	if len(level) == 1 {
+		root = append(root, level[0]...)
+	}
+	sum := sha256.Sum256(root)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func decodeHash(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("invalid content hash %q", s)
+	}
+	return b, nil
+}
+
+// Store keeps manifests and chunks on disk, addressed by their hashes.
+// Chunks are shared between manifests.
+type Store struct {
+	dir string
+}
+
+// NewStore opens or creates a store in dir.
+func NewStore(dir string) (*Store, error) {
+	for _, sub := range []string{"chunks", "manifests"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to create transfer store: %w", err)
+		}
+	}
+	return &Store{dir: dir}, nil
+}
+
+func (s *Store) chunkPath(hash string) (string, error) {
+	if _, err := decodeHash(hash); err != nil {
+		return "", err
+	}
+	hash = strings.ToLower(hash)
+	return filepath.Join(s.dir, "chunks", hash[:2], hash), nil
+}
+
+func (s *Store) manifestPath(root string) (string, error) {
+	if _, err := decodeHash(root); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, "manifests", strings.ToLower(root)+".json"), nil
+}
+
+// writeFile writes through a temporary file so a crash never leaves a
+// partial chunk or manifest behind.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Put splits data into chunks, stores them and their manifest, and returns
+// the manifest.
+func (s *Store) Put(name string, data []byte) (*Manifest, error) {
+	m := BuildManifest(name, data)
+	for i, hash := range m.Chunks {
+		off := i * m.ChunkSize
+		if s.HasChunk(hash) {
+			continue
+		}
+		if err := s.PutChunk(hash, data[off:off+m.chunkLen(i)]); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.PutManifest(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PutManifest verifies and stores a manifest.
+func (s *Store) PutManifest(m *Manifest) error {
+	if err := m.Verify(); err != nil {
+		return err
+	}
+	path, err := s.manifestPath(m.Root)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	if err := writeFile(path, data); err != nil {
+		return fmt.Errorf("failed to store manifest: %w", err)
+	}
+	return nil
+}
+
+// Manifest returns the stored manifest with the given root.
+func (s *Store) Manifest(root string) (*Manifest, error) {
+	path, err := s.manifestPath(root)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	if err := m.Verify(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Roots lists the roots of all stored manifests.
+func (s *Store) Roots() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, "manifests"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list manifests: %w", err)
+	}
+	var roots []string
+	for _, e := range entries {
+		if root, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			roots = append(roots, root)
+		}
+	}
+	return roots, nil
+}
+
+// HasChunk reports whether the chunk is stored.
+func (s *Store) HasChunk(hash string) bool {
+	path, err := s.chunkPath(hash)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Chunk returns a stored chunk after checking it against its hash.
+func (s *Store) Chunk(hash string) ([]byte, error) {
+	path, err := s.chunkPath(hash)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chunk: %w", err)
+	}
+	if sum := sha256.Sum256(data); !strings.EqualFold(hex.EncodeToString(sum[:]), hash) {
+		_ = os.Remove(path)
+		return nil, fmt.Errorf("stored chunk %s is corrupt", hash)
+	}
+	return data, nil
+}
+
+// PutChunk stores data under hash after checking that it matches.
+func (s *Store) PutChunk(hash string, data []byte) error {
+	path, err := s.chunkPath(hash)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); !strings.EqualFold(hex.EncodeToString(sum[:]), hash) {
+		return fmt.Errorf("chunk does not match hash %s", hash)
+	}
+	if err := writeFile(path, data); err != nil {
+		return fmt.Errorf("failed to store chunk: %w", err)
+	}
+	return nil
+}
+
+// Missing returns the indexes of the manifest's chunks that are not stored.
+func (s *Store) Missing(m *Manifest) []int {
+	var missing []int
+	for i, hash := range m.Chunks {
+		if !s.HasChunk(hash) {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Assemble concatenates the manifest's chunks.
+func (s *Store) Assemble(m *Manifest) ([]byte, error) {
+	out := make([]byte, 0, m.Size)
+	for i, hash := range m.Chunks {
+		data, err := s.Chunk(hash)
+		if err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		if len(data) != m.chunkLen(i) {
+			return nil, fmt.Errorf("chunk %d has %d bytes, expected %d", i, len(data), m.chunkLen(i))
+		}
+		out = append(out, data...)
+	}
+	return out, nil
+}
@@ -0,0 +1,324 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/naviNBRuas/APA/pkg/metrics"
+	"golang.org/x/time/rate"
+)
+
+// ErrNoProviders is returned when no peer could supply an artifact.
+var ErrNoProviders = errors.New("no providers for content")
+
+// Config controls chunked transfers.
+type Config struct {
+	Enabled           bool          `yaml:"enabled"`
+	Dir               string        `yaml:"dir"`                // defaults to "transfer"
+	Parallelism       int           `yaml:"parallelism"`        // concurrent chunk requests, defaults to 4
+	PeerBandwidth     int           `yaml:"peer_bandwidth"`     // bytes per second received from each peer, 0 for unlimited
+	ChunkTimeout      time.Duration `yaml:"chunk_timeout"`      // defaults to 30s
+	MaxProviders      int           `yaml:"max_providers"`      // providers looked up per artifact, defaults to 8
+	ReprovideInterval time.Duration `yaml:"reprovide_interval"` // defaults to 12h
+}
+
+// WithDefaults fills unset fields.
+func (c Config) WithDefaults() Config {
+	if c.Dir == "" {
+		c.Dir = "transfer"
+	}
+	if c.Parallelism <= 0 {
+		c.Parallelism = 4
+	}
+	if c.ChunkTimeout <= 0 {
+		c.ChunkTimeout = 30 * time.Second
+	}
+	if c.MaxProviders <= 0 {
+		c.MaxProviders = 8
+	}
+	if c.ReprovideInterval <= 0 {
+		c.ReprovideInterval = 12 * time.Hour
+	}
+	return c
+}
+
+// Network finds providers of an artifact and fetches its manifest and chunks
+// from them. networking.P2P implements it over the DHT and a libp2p stream
+// protocol.
+type Network interface {
+	Provide(ctx context.Context, root string) error
+	FindProviders(ctx context.Context, root string, limit int) ([]peer.ID, error)
+	FetchManifest(ctx context.Context, p peer.ID, root string) (*Manifest, error)
+	FetchChunk(ctx context.Context, p peer.ID, hash string) ([]byte, error)
+}
+
+// Transfer publishes artifacts into the local store and fetches artifacts
+// from peers into it.
+type Transfer struct {
+	logger  *slog.Logger
+	cfg     Config
+	store   *Store
+	net     Network
+	metrics *metrics.Metrics
+
+	mu       sync.Mutex
+	limiters map[peer.ID]*rate.Limiter
+}
+
+// New creates a Transfer over store and net.
+func New(logger *slog.Logger, cfg Config, store *Store, net Network) *Transfer {
+	return &Transfer{
+		logger:   logger,
+		cfg:      cfg.WithDefaults(),
+		store:    store,
+		net:      net,
+		limiters: make(map[peer.ID]*rate.Limiter),
+	}
+}
+
+// SetMetrics sets the registry transferred bytes and chunk results are
+// recorded into.
+func (t *Transfer) SetMetrics(mt *metrics.Metrics) {
+	t.metrics = mt
+}
+
+// Store returns the local chunk store.
+func (t *Transfer) Store() *Store {
+	return t.store
+}
+
+// Publish stores data and announces it to the network. The returned
+// manifest's Root names the artifact for Fetch.
+func (t *Transfer) Publish(ctx context.Context, name string, data []byte) (*Manifest, error) {
+	m, err := t.store.Put(name, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store %s: %w", name, err)
+	}
+	if err := t.net.Provide(ctx, m.Root); err != nil {
+		t.logger.Warn("Failed to announce content", "name", name, "root", m.Root, "error", err)
+	}
+	return m, nil
+}
+
+// Reprovide announces every stored artifact again every ReprovideInterval,
+// since provider records expire, until ctx is done.
+func (t *Transfer) Reprovide(ctx context.Context) {
+	ticker := time.NewTicker(t.cfg.ReprovideInterval)
+	defer ticker.Stop()
+	for {
+		roots, err := t.store.Roots()
+		if err != nil {
+			t.logger.Warn("Failed to list stored content", "error", err)
+		}
+		for _, root := range roots {
+			if err := t.net.Provide(ctx, root); err != nil && ctx.Err() == nil {
+				t.logger.Debug("Failed to announce content", "root", root, "error", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Fetch returns the artifact named by root, fetching missing chunks in
+// parallel from hints and the providers found on the network. Chunks already
+// in the store are not fetched again, so a failed Fetch resumes on the next
+// call. Every chunk is checked against the manifest and the manifest against
+// root, so providers need not be trusted.
+func (t *Transfer) Fetch(ctx context.Context, root string, hints ...peer.ID) ([]byte, error) {
+	root = strings.ToLower(root)
+	m, err := t.store.Manifest(root)
+	if err == nil && len(t.store.Missing(m)) == 0 {
+		return t.store.Assemble(m)
+	}
+
+	providers := t.providers(ctx, root, hints)
+	if len(providers) == 0 {
+		return nil, ErrNoProviders
+	}
+	if m == nil {
+		if m, err = t.fetchManifest(ctx, root, providers); err != nil {
+			return nil, err
+		}
+	}
+
+	missing := t.store.Missing(m)
+	t.logger.Info("Fetching content", "name", m.Name, "root", root, "chunks", len(m.Chunks), "missing", len(missing), "providers", len(providers))
+	if err := t.fetchChunks(ctx, m, missing, providers); err != nil {
+		return nil, err
+	}
+	return t.store.Assemble(m)
+}
+
+func (t *Transfer) providers(ctx context.Context, root string, hints []peer.ID) []peer.ID {
+	seen := make(map[peer.ID]bool)
+	var providers []peer.ID
+	for _, p := range hints {
+		if p != "" && !seen[p] {
+			seen[p] = true
+			providers = append(providers, p)
+		}
+	}
+	lookupCtx, cancel := context.WithTimeout(ctx, t.cfg.ChunkTimeout)
+	defer cancel()
+	found, err := t.net.FindProviders(lookupCtx, root, t.cfg.MaxProviders)
+	if err != nil {
+		t.logger.Debug("Provider lookup failed", "root", root, "error", err)
+	}
+	for _, p := range found {
+		if !seen[p] {
+			seen[p] = true
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
+
+func (t *Transfer) fetchManifest(ctx context.Context, root string, providers []peer.ID) (*Manifest, error) {
+	for _, p := range providers {
+		reqCtx, cancel := context.WithTimeout(ctx, t.cfg.ChunkTimeout)
+		m, err := t.net.FetchManifest(reqCtx, p, root)
+		cancel()
+		if err != nil {
+			t.logger.Debug("Failed to fetch manifest", "peer", p, "root", root, "error", err)
+			continue
+		}
+		if m.Root != root {
+			t.logger.Warn("Peer sent manifest for different content", "peer", p, "root", root)
+			continue
+		}
+		if err := t.store.PutManifest(m); err != nil {
+			t.logger.Warn("Peer sent invalid manifest", "peer", p, "root", root, "error", err)
+			continue
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("%w: no provider returned a valid manifest for %s", ErrNoProviders, root)
+}
+
+// fetchChunks fetches the chunks at the given indexes with Parallelism
+// workers. Chunk i is first requested from provider i mod n and then from
+// the others in turn; a provider that sends a corrupt chunk is not asked
+// again during this fetch.
+func (t *Transfer) fetchChunks(ctx context.Context, m *Manifest, indexes []int, providers []peer.ID) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		bad      = make(map[peer.ID]bool)
+		firstErr error
+	)
+	isBad := func(p peer.ID) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return bad[p]
+	}
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(t.cfg.Parallelism, len(indexes)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hash := m.Chunks[i]
+				done := false
+				for k := 0; k < len(providers) && !done && ctx.Err() == nil; k++ {
+					p := providers[(i+k)%len(providers)]
+					if isBad(p) {
+						continue
+					}
+					data, err := t.fetchChunk(ctx, p, hash)
+					switch {
+					case err != nil:
+						t.metrics.TransferChunk("error")
+						t.logger.Debug("Failed to fetch chunk", "peer", p, "chunk", i, "error", err)
+					case len(data) != m.chunkLen(i) || t.store.PutChunk(hash, data) != nil:
+						t.metrics.TransferChunk("corrupt")
+						t.logger.Warn("Peer sent corrupt chunk", "peer", p, "chunk", i)
+						mu.Lock()
+						bad[p] = true
+						mu.Unlock()
+					default:
+						t.metrics.TransferChunk("ok")
+						done = true
+					}
+				}
+				if !done && ctx.Err() == nil {
+					fail(fmt.Errorf("%w: chunk %d of %s unavailable from %d providers", ErrNoProviders, i, m.Root, len(providers)))
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, i := range indexes {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// fetchChunk requests one chunk, which the caller verifies, and waits on
+// the provider's bandwidth limiter for the bytes received, so later
+// requests to that provider are spaced to stay within PeerBandwidth.
+func (t *Transfer) fetchChunk(ctx context.Context, p peer.ID, hash string) ([]byte, error) {
+	reqCtx, cancel := context.WithTimeout(ctx, t.cfg.ChunkTimeout)
+	defer cancel()
+	data, err := t.net.FetchChunk(reqCtx, p, hash)
+	if err != nil {
+		return nil, err
+	}
+	t.metrics.TransferBytes("received", len(data))
+	if lim := t.limiter(p); lim != nil {
+		if err := lim.WaitN(ctx, min(len(data), lim.Burst())); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (t *Transfer) limiter(p peer.ID) *rate.Limiter {
+	if t.cfg.PeerBandwidth <= 0 {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lim, ok := t.limiters[p]
+	if !ok {
+		lim = rate.NewLimiter(rate.Limit(t.cfg.PeerBandwidth), max(t.cfg.PeerBandwidth, ChunkSize))
+		lim.AllowN(time.Now(), lim.Burst())
+		t.limiters[p] = lim
+	}
+	return lim
+}
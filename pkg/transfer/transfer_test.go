@@ -0,0 +1,244 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryNetwork serves each peer's store directly. Peers listed in corrupt
+// flip a byte in every chunk they send; peers in down fail every request.
+type memoryNetwork struct {
+	mu       sync.Mutex
+	stores   map[peer.ID]*Store
+	corrupt  map[peer.ID]bool
+	down     map[peer.ID]bool
+	requests map[peer.ID]int
+	provided []string
+}
+
+func newMemoryNetwork() *memoryNetwork {
+	return &memoryNetwork{
+		stores:   map[peer.ID]*Store{},
+		corrupt:  map[peer.ID]bool{},
+		down:     map[peer.ID]bool{},
+		requests: map[peer.ID]int{},
+	}
+}
+
+func (n *memoryNetwork) Provide(ctx context.Context, root string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.provided = append(n.provided, root)
+	return nil
+}
+
+func (n *memoryNetwork) FindProviders(ctx context.Context, root string, limit int) ([]peer.ID, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	var providers []peer.ID
+	for id, s := range n.stores {
+		if _, err := s.Manifest(root); err == nil && len(providers) < limit {
+			providers = append(providers, id)
+		}
+	}
+	return providers, nil
+}
+
+func (n *memoryNetwork) peer(id peer.ID) (*Store, bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.requests[id]++
+	if n.down[id] {
+		return nil, false, errors.New("connection refused")
+	}
+	return n.stores[id], n.corrupt[id], nil
+}
+
+func (n *memoryNetwork) FetchManifest(ctx context.Context, id peer.ID, root string) (*Manifest, error) {
+	s, _, err := n.peer(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.Manifest(root)
+}
+
+func (n *memoryNetwork) FetchChunk(ctx context.Context, id peer.ID, hash string) ([]byte, error) {
+	s, corrupt, err := n.peer(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.Chunk(hash)
+	if err == nil && corrupt {
+		data[0] ^= 0xFF
+	}
+	return data, err
+}
+
+func (n *memoryNetwork) addPeer(t *testing.T, id peer.ID, name string, data []byte) *Manifest {
+	t.Helper()
+	s, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	m, err := s.Put(name, data)
+	require.NoError(t, err)
+	n.mu.Lock()
+	n.stores[id] = s
+	n.mu.Unlock()
+	return m
+}
+
+func randomArtifact(n int) []byte {
+	data := make([]byte, n)
+	_, _ = rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+func newTestTransfer(t *testing.T, cfg Config, net Network) *Transfer {
+	t.Helper()
+	s, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	return New(slog.Default(), cfg, s, net)
+}
+
+func TestManifestVerify(t *testing.T) {
+	data := randomArtifact(3*ChunkSize + 17)
+	m := BuildManifest("artifact", data)
+	require.Len(t, m.Chunks, 4)
+	require.NoError(t, m.Verify())
+	require.Equal(t, m.Root, BuildManifest("renamed", data).Root, "the name is not part of the root")
+
+	empty := BuildManifest("empty", nil)
+	require.NoError(t, empty.Verify())
+	require.NotEqual(t, m.Root, empty.Root)
+
+	swapped := *m
+	swapped.Chunks = []string{m.Chunks[1], m.Chunks[0], m.Chunks[2], m.Chunks[3]}
+	require.ErrorContains(t, swapped.Verify(), "root mismatch")
+
+	resized := *m
+	resized.Size++
+	require.Error(t, resized.Verify())
+
+	truncated := *m
+	truncated.Chunks = m.Chunks[:3]
+	require.Error(t, truncated.Verify())
+}
+
+func TestStoreRejectsBadContent(t *testing.T) {
+	s, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	m, err := s.Put("artifact", randomArtifact(ChunkSize+1))
+	require.NoError(t, err)
+
+	require.Error(t, s.PutChunk(m.Chunks[0], []byte("not the chunk")))
+	_, err = s.Chunk("../../etc/passwd")
+	require.Error(t, err)
+	_, err = s.Manifest(BuildManifest("other", []byte("x")).Root)
+	require.ErrorIs(t, err, ErrNotFound)
+
+	roots, err := s.Roots()
+	require.NoError(t, err)
+	require.Equal(t, []string{m.Root}, roots)
+}
+
+func TestFetchFromMultiplePeers(t *testing.T) {
+	net := newMemoryNetwork()
+	data := randomArtifact(10*ChunkSize + 100)
+	m := net.addPeer(t, "a", "artifact", data)
+	net.addPeer(t, "b", "artifact", data)
+	net.addPeer(t, "c", "artifact", data)
+
+	tr := newTestTransfer(t, Config{Parallelism: 3}, net)
+	got, err := tr.Fetch(context.Background(), m.Root)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, got))
+	for _, id := range []peer.ID{"a", "b", "c"} {
+		require.Greater(t, net.requests[id], 1, "chunks are spread over providers")
+	}
+
+	// A second fetch is served from the local store.
+	before := net.requests["a"] + net.requests["b"] + net.requests["c"]
+	_, err = tr.Fetch(context.Background(), m.Root)
+	require.NoError(t, err)
+	require.Equal(t, before, net.requests["a"]+net.requests["b"]+net.requests["c"])
+}
+
+func TestFetchSkipsCorruptAndFailingPeers(t *testing.T) {
+	net := newMemoryNetwork()
+	data := randomArtifact(6 * ChunkSize)
+	m := net.addPeer(t, "good", "artifact", data)
+	net.addPeer(t, "liar", "artifact", data)
+	net.addPeer(t, "flaky", "artifact", data)
+	net.corrupt["liar"] = true
+	net.down["flaky"] = true
+
+	tr := newTestTransfer(t, Config{Parallelism: 2}, net)
+	got, err := tr.Fetch(context.Background(), m.Root, "liar")
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, got))
+	require.LessOrEqual(t, net.requests["liar"], 3, "a peer that sent a corrupt chunk is dropped")
+}
+
+func TestFetchResumesAfterInterruption(t *testing.T) {
+	net := newMemoryNetwork()
+	data := randomArtifact(8 * ChunkSize)
+	m := net.addPeer(t, "seed", "artifact", data)
+
+	// The only provider loses half the chunks mid-transfer.
+	seed := net.stores["seed"]
+	partial := newMemoryNetwork()
+	s, err := NewStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.PutManifest(m))
+	for i := 0; i < 4; i++ {
+		chunk, err := seed.Chunk(m.Chunks[i])
+		require.NoError(t, err)
+		require.NoError(t, s.PutChunk(m.Chunks[i], chunk))
+	}
+	partial.stores["seed"] = s
+
+	tr := newTestTransfer(t, Config{Parallelism: 1}, partial)
+	_, err = tr.Fetch(context.Background(), m.Root)
+	require.ErrorIs(t, err, ErrNoProviders)
+	require.Len(t, tr.Store().Missing(m), 4)
+
+	tr.net = net
+	got, err := tr.Fetch(context.Background(), m.Root)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, got))
+	require.Equal(t, 4, net.requests["seed"], "only the missing chunks are fetched, not the manifest")
+}
+
+func TestFetchHonoursPeerBandwidth(t *testing.T) {
+	net := newMemoryNetwork()
+	data := randomArtifact(3 * ChunkSize)
+	m := net.addPeer(t, "slow", "artifact", data)
+
+	tr := newTestTransfer(t, Config{Parallelism: 3, PeerBandwidth: 4 * ChunkSize}, net)
+	start := time.Now()
+	_, err := tr.Fetch(context.Background(), m.Root)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, time.Since(start), 600*time.Millisecond, "3 chunks at 4 chunks/s")
+}
+
+func TestFetchRejectsManifestForOtherRoot(t *testing.T) {
+	net := newMemoryNetwork()
+	net.addPeer(t, "a", "artifact", randomArtifact(100))
+	other := BuildManifest("other", []byte("other")).Root
+
+	tr := newTestTransfer(t, Config{}, net)
+	_, err := tr.Fetch(context.Background(), other, "a")
+	require.ErrorIs(t, err, ErrNoProviders)
+
+	got, err := tr.Publish(context.Background(), "mine", []byte("mine"))
+	require.NoError(t, err)
+	require.Contains(t, net.provided, got.Root)
+}
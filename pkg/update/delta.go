@@ -0,0 +1,232 @@
+package update
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A delta rebuilds a release binary from the previous one. Both binaries are
+// split with content-defined chunking, so an insertion early in the file
+// only changes the chunks around it; chunks of the new binary that also
+// occur in the old one are copied, the rest are inserted. The encoded delta
+// is gzip-compressed:
+//
+//	magic "APADLT01" | base SHA-256 | target SHA-256 | uvarint target length
+//	ops: 0x01 uvarint offset, uvarint length   copy from base
+//	     0x02 uvarint length, bytes            insert literal bytes
+const deltaMagic = "APADLT01"
+
+const (
+	deltaOpCopy   = 0x01
+	deltaOpInsert = 0x02
+
+	chunkMin  = 2 << 10
+	chunkMax  = 64 << 10
+	chunkMask = 1<<13 - 1 // average chunk of about 8 KiB
+
+	maxDeltaTarget = 256 << 20
+)
+
+var (
+	// ErrDeltaBaseMismatch is returned when a delta was made against a
+	// different binary than the one it is applied to.
+	ErrDeltaBaseMismatch = errors.New("delta base does not match binary")
+
+	errNoDelta = errors.New("no delta for current version")
+)
+
+// gearTable holds the per-byte values of the rolling gear hash, derived with
+// splitmix64 from a fixed seed so every agent cuts at the same places.
+var gearTable = func() [256]uint64 {
+	var t [256]uint64
+	x := uint64(0x41504144454c5441)
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return t
+}()
+
+// chunkBoundaries returns the end offsets of the content-defined chunks of data.
+func chunkBoundaries(data []byte) []int {
+	var ends []int
+	start := 0
+	for start < len(data) {
+		end := start + chunkMax
+		if end > len(data) {
+			end = len(data)
+		}
+		var h uint64
+		for i := start; i < end; i++ {
+			h = (h << 1) + gearTable[data[i]]
+			if i-start+1 >= chunkMin && h&chunkMask == 0 {
+				end = i + 1
+				break
+			}
+		}
+		ends = append(ends, end)
+		start = end
+	}
+	return ends
+}
+
+type deltaOp struct {
+	copy   bool
+	offset int // copy source offset, or insert start in the target
+	length int
+}
+
+// CreateDelta encodes target as a delta against base.
+func CreateDelta(base, target []byte) ([]byte, error) {
+	if len(target) > maxDeltaTarget {
+		return nil, fmt.Errorf("target of %d bytes exceeds delta limit", len(target))
+	}
+
+	index := make(map[[sha256.Size]byte]int)
+	start := 0
+	for _, end := range chunkBoundaries(base) {
+		sum := sha256.Sum256(base[start:end])
+		if _, ok := index[sum]; !ok {
+			index[sum] = start
+		}
+		start = end
+	}
+
+	var ops []deltaOp
+	start = 0
+	for _, end := range chunkBoundaries(target) {
+		length := end - start
+		sum := sha256.Sum256(target[start:end])
+		if off, ok := index[sum]; ok {
+			if n := len(ops); n > 0 && ops[n-1].copy && ops[n-1].offset+ops[n-1].length == off {
+				ops[n-1].length += length
+			} else {
+				ops = append(ops, deltaOp{copy: true, offset: off, length: length})
+			}
+		} else if n := len(ops); n > 0 && !ops[n-1].copy {
+			ops[n-1].length += length
+		} else {
+			ops = append(ops, deltaOp{offset: start, length: length})
+		}
+		start = end
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	baseSum, targetSum := sha256.Sum256(base), sha256.Sum256(target)
+	header := make([]byte, 0, len(deltaMagic)+2*sha256.Size+binary.MaxVarintLen64)
+	header = append(header, deltaMagic...)
+	header = append(header, baseSum[:]...)
+	header = append(header, targetSum[:]...)
+	header = binary.AppendUvarint(header, uint64(len(target)))
+	if _, err := zw.Write(header); err != nil {
+		return nil, fmt.Errorf("failed to write delta header: %w", err)
+	}
+	var opBuf []byte
+	for _, op := range ops {
+		opBuf = opBuf[:0]
+		if op.copy {
+			opBuf = append(opBuf, deltaOpCopy)
+			opBuf = binary.AppendUvarint(opBuf, uint64(op.offset))
+			opBuf = binary.AppendUvarint(opBuf, uint64(op.length))
+		} else {
+			opBuf = append(opBuf, deltaOpInsert)
+			opBuf = binary.AppendUvarint(opBuf, uint64(op.length))
+			opBuf = append(opBuf, target[op.offset:op.offset+op.length]...)
+		}
+		if _, err := zw.Write(opBuf); err != nil {
+			return nil, fmt.Errorf("failed to write delta: %w", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress delta: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ApplyDelta rebuilds the target binary from base and delta and checks it
+// against the target hash recorded in the delta.
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(delta))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open delta: %w", err)
+	}
+	defer func() { _ = zr.Close() }()
+	r := bufio.NewReader(zr)
+
+	header := make([]byte, len(deltaMagic)+2*sha256.Size)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("failed to read delta header: %w", err)
+	}
+	if string(header[:len(deltaMagic)]) != deltaMagic {
+		return nil, fmt.Errorf("not a binary delta")
+	}
+	baseSum := sha256.Sum256(base)
+	if !bytes.Equal(header[len(deltaMagic):len(deltaMagic)+sha256.Size], baseSum[:]) {
+		return nil, ErrDeltaBaseMismatch
+	}
+	wantSum := header[len(deltaMagic)+sha256.Size:]
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delta target length: %w", err)
+	}
+	if size > maxDeltaTarget {
+		return nil, fmt.Errorf("delta target of %d bytes exceeds limit", size)
+	}
+
+	out := make([]byte, 0, size)
+	for {
+		op, err := r.ReadByte()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read delta: %w", err)
+		}
+		switch op {
+		case deltaOpCopy:
+			off, err1 := binary.ReadUvarint(r)
+			n, err2 := binary.ReadUvarint(r)
+			if err := errors.Join(err1, err2); err != nil {
+				return nil, fmt.Errorf("failed to read delta copy: %w", err)
+			}
+			if off > uint64(len(base)) || n > uint64(len(base))-off || uint64(len(out))+n > size {
+				return nil, fmt.Errorf("delta copy out of range")
+			}
+			out = append(out, base[off:off+n]...)
+		case deltaOpInsert:
+			n, err := binary.ReadUvarint(r)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read delta insert: %w", err)
+			}
+			if uint64(len(out))+n > size {
+				return nil, fmt.Errorf("delta insert out of range")
+			}
+			start := len(out)
+			out = append(out, make([]byte, n)...)
+			if _, err := io.ReadFull(r, out[start:]); err != nil {
+				return nil, fmt.Errorf("failed to read delta insert: %w", err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown delta op 0x%02x", op)
+		}
+	}
+
+	if uint64(len(out)) != size {
+		return nil, fmt.Errorf("delta produced %d bytes, expected %d", len(out), size)
+	}
+	if sum := sha256.Sum256(out); !bytes.Equal(sum[:], wantSum) {
+		return nil, fmt.Errorf("delta result hash mismatch: got %s", hex.EncodeToString(sum[:]))
+	}
+	return out, nil
+}
@@ -0,0 +1,267 @@
+package update
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/naviNBRuas/APA/pkg/transfer"
+	"github.com/stretchr/testify/require"
+)
+
+// modified returns a copy of base with an insertion near the start and a
+// rewritten region further on, which shifts every later byte.
+func modified(base []byte) []byte {
+	out := append([]byte{}, base[:1000]...)
+	out = append(out, []byte("inserted by the new release")...)
+	out = append(out, base[1000:]...)
+	copy(out[len(out)/2:], bytes.Repeat([]byte{0xAB}, 4096))
+	return out
+}
+
+func randomBinary(n int) []byte {
+	data := make([]byte, n)
+	_, _ = rand.New(rand.NewSource(1)).Read(data)
+	return data
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	base := randomBinary(2 << 20)
+	target := modified(base)
+
+	delta, err := CreateDelta(base, target)
+	require.NoError(t, err)
+	require.Less(t, len(delta), len(target)/10, "shifted content is copied, not inserted")
+
+	rebuilt, err := ApplyDelta(base, delta)
+	require.NoError(t, err)
+	require.Equal(t, target, rebuilt)
+
+	for _, tc := range []struct{ base, target []byte }{
+		{nil, []byte("new")},
+		{[]byte("old"), nil},
+		{randomBinary(100), randomBinary(100 << 10)},
+	} {
+		delta, err := CreateDelta(tc.base, tc.target)
+		require.NoError(t, err)
+		rebuilt, err := ApplyDelta(tc.base, delta)
+		require.NoError(t, err)
+		require.Equal(t, len(tc.target), len(rebuilt))
+	}
+}
+
+func TestApplyDeltaRejectsWrongBaseAndCorruption(t *testing.T) {
+	base := randomBinary(256 << 10)
+	delta, err := CreateDelta(base, modified(base))
+	require.NoError(t, err)
+
+	_, err = ApplyDelta(modified(base), delta)
+	require.ErrorIs(t, err, ErrDeltaBaseMismatch)
+
+	_, err = ApplyDelta(base, delta[:len(delta)/2])
+	require.Error(t, err)
+
+	_, err = ApplyDelta(base, []byte("not a delta"))
+	require.Error(t, err)
+
+	// A delta for the right base that copies past its end is rejected.
+	baseSum := sha256.Sum256(base)
+	var raw bytes.Buffer
+	zw := gzip.NewWriter(&raw)
+	header := append([]byte(deltaMagic), baseSum[:]...)
+	header = append(header, make([]byte, sha256.Size)...)
+	header = binary.AppendUvarint(header, 1<<20)
+	header = append(header, deltaOpCopy)
+	header = binary.AppendUvarint(header, uint64(len(base)-10))
+	header = binary.AppendUvarint(header, 100)
+	_, _ = zw.Write(header)
+	require.NoError(t, zw.Close())
+	_, err = ApplyDelta(base, raw.Bytes())
+	require.ErrorContains(t, err, "out of range")
+}
+
+func TestManagerUpdatesFromDeltaWithFallback(t *testing.T) {
+	inTempDir(t)
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	current, err := os.ReadFile(exe)
+	require.NoError(t, err)
+
+	target := modified(current)
+	delta, err := CreateDelta(current, target)
+	require.NoError(t, err)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sign := func(data []byte) string {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(ed25519.Sign(priv, sum[:]))
+	}
+	deltaSum := sha256.Sum256(delta)
+	deltaInfo := DeltaInfo{From: "v1.1.0", SHA256: hex.EncodeToString(deltaSum[:]), Signature: sign(delta)}
+
+	var fullDownloads atomic.Int32
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/bin":
+			fullDownloads.Add(1)
+			_, _ = w.Write(target)
+		case "/delta":
+			_, _ = w.Write(delta)
+		default:
+			info := deltaInfo
+			info.URL = srvURL + "/delta"
+			_ = json.NewEncoder(w).Encode(ReleaseInfo{
+				Version: "v1.2.0",
+				Artifacts: map[string]ArtifactInfo{runtime.GOOS + "/" + runtime.GOARCH: {
+					URL: srvURL + "/bin", Signature: sign(target), Deltas: []DeltaInfo{info},
+				}},
+			})
+		}
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	m, err := NewManager(slog.Default(), Config{ServerURL: srv.URL, PublicKey: hex.EncodeToString(pub)}, "v1.1.0")
+	require.NoError(t, err)
+	var results []string
+	m.OnCheckComplete = func(result, version string, err error) { results = append(results, result) }
+
+	m.CheckForUpdate(context.Background())
+	require.Equal(t, []string{"updated"}, results)
+	require.Zero(t, fullDownloads.Load())
+	installed, err := os.ReadFile(newBinaryName)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(target, installed))
+
+	// A delta that does not match its advertised hash falls back to the
+	// full binary.
+	require.NoError(t, os.Remove(newBinaryName))
+	deltaInfo.SHA256 = hex.EncodeToString(make([]byte, sha256.Size))
+	m.CheckForUpdate(context.Background())
+	require.Equal(t, []string{"updated", "updated"}, results)
+	require.EqualValues(t, 1, fullDownloads.Load())
+	installed, err = os.ReadFile(newBinaryName)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(target, installed))
+}
+
+func TestManagerServesReleaseDeltaToPeers(t *testing.T) {
+	inTempDir(t)
+	exe, err := os.Executable()
+	require.NoError(t, err)
+	current, err := os.ReadFile(exe)
+	require.NoError(t, err)
+
+	m, err := NewManager(slog.Default(), Config{PublicKey: "0000000000000000000000000000000000000000000000000000000000000000"}, "v1.2.0")
+	require.NoError(t, err)
+
+	// Without a kept release description there is nothing to serve.
+	_, data, err := m.GetCurrentRelease()
+	require.NoError(t, err)
+	require.Empty(t, data)
+	_, _, err = m.GetReleaseDelta("anything")
+	require.Error(t, err)
+
+	artifacts := map[string]ArtifactInfo{runtime.GOOS + "/" + runtime.GOARCH: {URL: "https://example.com/agentd"}}
+	require.NoError(t, saveInstalledRelease(&ReleaseInfo{Version: "1.2.0", Channel: ChannelBeta, Artifacts: artifacts}))
+	release, data, err := m.GetCurrentRelease()
+	require.NoError(t, err)
+	require.Equal(t, ChannelBeta, release.Channel)
+	require.Equal(t, artifacts, release.Artifacts)
+	require.True(t, bytes.Equal(current, data))
+
+	previous := modified(current)
+	require.NoError(t, os.WriteFile(rollbackBinaryName, previous, 0o755))
+	_, _, err = m.GetReleaseDelta(hex.EncodeToString(make([]byte, sha256.Size)))
+	require.ErrorIs(t, err, ErrDeltaBaseMismatch)
+
+	sum := sha256.Sum256(previous)
+	_, delta, err := m.GetReleaseDelta(hex.EncodeToString(sum[:]))
+	require.NoError(t, err)
+	require.Less(t, len(delta), len(current)/10)
+	rebuilt, err := ApplyDelta(previous, delta)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(current, rebuilt))
+}
+
+// fakeContentStore serves a fixed artifact by content root.
+type fakeContentStore struct {
+	data      []byte
+	published []string
+}
+
+func (f *fakeContentStore) Fetch(ctx context.Context, root string, hints ...peer.ID) ([]byte, error) {
+	if f.data == nil {
+		return nil, transfer.ErrNoProviders
+	}
+	return f.data, nil
+}
+
+func (f *fakeContentStore) Publish(ctx context.Context, name string, data []byte) (*transfer.Manifest, error) {
+	f.published = append(f.published, name)
+	return transfer.BuildManifest(name, data), nil
+}
+
+func TestManagerFetchesChunkedContentWithFallback(t *testing.T) {
+	inTempDir(t)
+	target := []byte("agent v1.2.0")
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	sum := sha256.Sum256(target)
+
+	var fullDownloads atomic.Int32
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bin" {
+			fullDownloads.Add(1)
+			_, _ = w.Write(target)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(ReleaseInfo{
+			Version: "v1.2.0",
+			Artifacts: map[string]ArtifactInfo{runtime.GOOS + "/" + runtime.GOARCH: {
+				URL: srvURL + "/bin", Signature: hex.EncodeToString(ed25519.Sign(priv, sum[:])),
+				Content: transfer.BuildManifest("agentd", target).Root,
+			}},
+		})
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	m, err := NewManager(slog.Default(), Config{ServerURL: srv.URL, PublicKey: hex.EncodeToString(pub)}, "v1.1.0")
+	require.NoError(t, err)
+	store := &fakeContentStore{data: target}
+	m.SetContentStore(store)
+
+	m.CheckForUpdate(context.Background())
+	require.Zero(t, fullDownloads.Load())
+	installed, err := os.ReadFile(newBinaryName)
+	require.NoError(t, err)
+	require.Equal(t, target, installed)
+	require.Len(t, store.published, 1, "the installed binary is offered to peers")
+
+	// Content from peers that fails verification is replaced by the full download.
+	store.data = []byte("tampered")
+	require.NoError(t, os.Remove(newBinaryName))
+	m.CheckForUpdate(context.Background())
+	require.EqualValues(t, 1, fullDownloads.Load())
+	installed, err = os.ReadFile(newBinaryName)
+	require.NoError(t, err)
+	require.Equal(t, target, installed)
+}
@@ -6,30 +6,79 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/libp2p/go-libp2p/core/peer"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/mod/semver"
+
+	"github.com/naviNBRuas/APA/pkg/metrics"
+	"github.com/naviNBRuas/APA/pkg/robustness"
+	"github.com/naviNBRuas/APA/pkg/tracing"
+	"github.com/naviNBRuas/APA/pkg/transfer"
 )
 
 // ReleaseInfo describes a new agent release.
 type ReleaseInfo struct {
 	Version   string                  `json:"version"`
-	Artifacts map[string]ArtifactInfo `json:"artifacts"` // Keyed by "os/arch"
+	Channel   string                  `json:"channel,omitempty"`  // canary | beta | stable, empty means stable
+	Artifacts map[string]ArtifactInfo `json:"artifacts"`          // Keyed by "os/arch"
+	Metadata  *MetadataBundle         `json:"metadata,omitempty"` // Signed metadata when TUF verification is enabled
 }
 
 // ArtifactInfo contains the URL and signature for a specific binary.
 type ArtifactInfo struct {
+	URL       string      `json:"url"`
+	Signature string      `json:"signature"`
+	Deltas    []DeltaInfo `json:"deltas,omitempty"`  // Deltas from earlier releases to this binary
+	Content   string      `json:"content,omitempty"` // Chunked-transfer manifest root of the binary
+}
+
+// DeltaInfo advertises a binary delta that rebuilds an artifact from the
+// binary of an earlier release.
+type DeltaInfo struct {
+	From      string `json:"from"` // Release version the delta applies to
 	URL       string `json:"url"`
-	Signature string `json:"signature"`
+	SHA256    string `json:"sha256"`
+	Signature string `json:"signature,omitempty"` // Signature over the delta's SHA-256, like artifact signatures
+}
+
+// DeltaFetcher is implemented by P2P networks that can send a binary delta
+// against the requester's running binary instead of the full binary. The
+// peer returns either delta or data.
+type DeltaFetcher interface {
+	FetchUpdateDeltaFromPeer(ctx context.Context, peerID peer.ID, version, baseSHA256 string) (release *ReleaseInfo, data, delta []byte, err error)
+}
+
+// ContentStore fetches artifacts from peers by chunked-transfer manifest
+// root and publishes them for other peers. *transfer.Transfer implements it.
+type ContentStore interface {
+	Fetch(ctx context.Context, root string, hints ...peer.ID) ([]byte, error)
+	Publish(ctx context.Context, name string, data []byte) (*transfer.Manifest, error)
 }
 
+// DefaultDownloadPolicy guards requests to the update server: each attempt
+// gets a minute, failed ones are retried twice with jittered backoff, and
+// the breaker per host stops hammering a server that keeps failing.
+var DefaultDownloadPolicy = robustness.PolicyConfig{
+	Timeout: time.Minute,
+	Retry:   robustness.RetryPolicy{MaxAttempts: 3, InitialDelay: time.Second, MaxDelay: 30 * time.Second, BackoffFactor: 2, Jitter: true},
+}
+
+// installedReleaseName holds the verified release description of the
+// installed binary.
+const installedReleaseName = "agentd.release.json"
+
 // Manager handles the agent's self-update process.
 type Manager struct {
 	logger         *slog.Logger
@@ -39,6 +88,26 @@ type Manager struct {
 	currentVersion string
 	OnUpdateReady  func()              // Callback to trigger graceful shutdown
 	p2pNetwork     P2PNetworkInterface // Interface for P2P network operations
+	metrics        *metrics.Metrics
+	metadata       *MetadataClient // nil unless TUF verification is enabled
+	tuf            TUFConfig
+	rollout        *Rollout // nil unless staged rollouts are enabled
+	probation      ProbationConfig
+	downloads      *robustness.Policy
+
+	mu         sync.Mutex
+	latest     *ReleaseInfo // newest release seen by the last successful check
+	rolledBack bool
+	deltaBase  string // SHA-256 of the base binary of the cached delta
+	content    ContentStore
+	delta      []byte // delta served to peers updating from deltaBase
+
+	// OnCheckComplete is called with the outcome of every update check:
+	// "up_to_date", "updated", "deferred" (held back by a staged rollout),
+	// "skipped" (the release failed probation before), "confirmed" (passed
+	// probation), "rolled_back" or "error", the release version seen (if any)
+	// and the error.
+	OnCheckComplete func(result, version string, err error)
 }
 
 // P2PNetworkInterface defines the interface for P2P network operations
@@ -49,29 +118,60 @@ type P2PNetworkInterface interface {
 
 // Config holds the configuration for the update manager.
 type Config struct {
-	ServerURL     string        `yaml:"server_url"`
-	CheckInterval time.Duration `yaml:"check_interval"`
-	PublicKey     string        `yaml:"public_key"`
-	EnableP2P     bool          `yaml:"enable_p2p"` // Enable P2P update functionality
+	ServerURL     string          `yaml:"server_url"`
+	CheckInterval time.Duration   `yaml:"check_interval"`
+	PublicKey     string          `yaml:"public_key"`
+	EnableP2P     bool            `yaml:"enable_p2p"` // Enable P2P update functionality
+	TUF           TUFConfig       `yaml:"tuf"`
+	Rollout       RolloutConfig   `yaml:"rollout"`
+	Probation     ProbationConfig `yaml:"probation"`
 }
 
 // NewManager creates a new update manager.
 func NewManager(logger *slog.Logger, cfg Config, currentVersion string) (*Manager, error) {
-	pubKeyBytes, err := hex.DecodeString(cfg.PublicKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode public key: %w", err)
-	}
-	if len(pubKeyBytes) != ed25519.PublicKeySize {
-		return nil, fmt.Errorf("invalid public key size")
-	}
-
-	return &Manager{
+	m := &Manager{
 		logger:         logger,
 		httpClient:     &http.Client{Timeout: 1 * time.Minute},
 		updateURL:      cfg.ServerURL,
-		publicKey:      pubKeyBytes,
 		currentVersion: currentVersion,
-	}, nil
+		tuf:            cfg.TUF,
+		probation:      cfg.Probation.WithDefaults(),
+		downloads:      robustness.NewPolicy(logger, "update", DefaultDownloadPolicy),
+	}
+
+	// With TUF enabled the per-artifact signing key is optional: artifacts
+	// are checked against the hashes in signed targets metadata instead.
+	if cfg.PublicKey != "" || !cfg.TUF.Enabled {
+		pubKeyBytes, err := hex.DecodeString(cfg.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode public key: %w", err)
+		}
+		if len(pubKeyBytes) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key size")
+		}
+		m.publicKey = pubKeyBytes
+	}
+
+	if cfg.TUF.Enabled {
+		if cfg.TUF.MetadataURL == "" {
+			return nil, fmt.Errorf("tuf.metadata_url is required when TUF verification is enabled")
+		}
+		var initialRoot []byte
+		if cfg.TUF.TrustedRootPath != "" {
+			data, err := os.ReadFile(cfg.TUF.TrustedRootPath)
+			if err != nil && !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read trusted root: %w", err)
+			}
+			initialRoot = data
+		}
+		client, err := NewMetadataClient(cfg.TUF.MetadataDir, initialRoot)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize update metadata: %w", err)
+		}
+		m.metadata = client
+	}
+
+	return m, nil
 }
 
 // SetP2PNetwork sets the P2P network interface for the update manager
@@ -79,19 +179,137 @@ func (m *Manager) SetP2PNetwork(p2p P2PNetworkInterface) {
 	m.p2pNetwork = p2p
 }
 
+// SetMetrics sets the registry that update checks are recorded into.
+func (m *Manager) SetMetrics(mt *metrics.Metrics) {
+	m.metrics = mt
+}
+
+// SetDownloadPolicy replaces the resilience policy for release and
+// artifact downloads.
+func (m *Manager) SetDownloadPolicy(p *robustness.Policy) {
+	m.downloads = p
+}
+
+// SetContentStore makes the manager fetch artifacts that advertise a content
+// root from peers before falling back to their URL, and publish installed
+// binaries for other peers.
+func (m *Manager) SetContentStore(cs ContentStore) {
+	m.content = cs
+}
+
+// SetRollout makes upgrades wait for the agent's staged rollout wave.
+func (m *Manager) SetRollout(r *Rollout) {
+	m.rollout = r
+}
+
+// LatestRelease returns the newest release seen by an update check, or nil.
+func (m *Manager) LatestRelease() *ReleaseInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latest
+}
+
+// EnforceRollout restores the previous binary and triggers a restart when
+// the rollout of the running version was halted with rollback requested.
+// It reports whether a rollback was started.
+func (m *Manager) EnforceRollout() bool {
+	if m.rollout == nil {
+		return false
+	}
+	rollback, reason := m.rollout.ShouldRollBack(m.currentVersion)
+	if !rollback {
+		return false
+	}
+	m.mu.Lock()
+	if m.rolledBack {
+		m.mu.Unlock()
+		return false
+	}
+	m.rolledBack = true
+	m.mu.Unlock()
+
+	m.logger.Warn("Rollout of running version halted, rolling back", "version", m.currentVersion, "reason", reason)
+	if err := recordFailedVersion(m.currentVersion, "rollout halted: "+reason); err != nil {
+		m.logger.Error("Failed to record failed version", "version", m.currentVersion, "error", err)
+	}
+	if err := m.Rollback(); err != nil {
+		m.logger.Error("Failed to roll back halted release", "error", err)
+		m.reportCheck("error", m.currentVersion, err)
+		return false
+	}
+	m.reportCheck("rolled_back", m.currentVersion, nil)
+	if m.OnUpdateReady != nil {
+		m.OnUpdateReady()
+	}
+	return true
+}
+
 // CurrentVersion returns the agent's current version string.
 func (m *Manager) CurrentVersion() string {
 	return m.currentVersion
 }
 
-// GetCurrentRelease returns the current release information.
+// GetCurrentRelease returns the current release information. When the
+// release description was kept at install time, the running binary is
+// returned too so that peers can update from this agent.
 func (m *Manager) GetCurrentRelease() (*ReleaseInfo, []byte, error) {
 	release := &ReleaseInfo{
 		Version:   m.currentVersion,
 		Artifacts: make(map[string]ArtifactInfo),
 	}
+	data := []byte{}
+	if installed, ok := m.installedRelease(); ok {
+		if bin, err := currentBinary(); err == nil {
+			release.Channel = installed.Channel
+			release.Artifacts = installed.Artifacts
+			data = bin
+		} else {
+			m.logger.Warn("Failed to read running binary for peers", "error", err)
+		}
+	}
+	if m.metadata != nil {
+		release.Metadata = m.metadata.Bundle()
+	}
+
+	return release, data, nil
+}
+
+// GetReleaseDelta returns the current release with a delta that rebuilds
+// the running binary from the binary whose SHA-256 is baseSHA256. Only the
+// binary this agent replaced (agentd.rollback) can serve as the base.
+func (m *Manager) GetReleaseDelta(baseSHA256 string) (*ReleaseInfo, []byte, error) {
+	release, data, err := m.GetCurrentRelease()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("no installed release to serve")
+	}
+
+	m.mu.Lock()
+	if m.deltaBase == baseSHA256 && m.delta != nil {
+		delta := m.delta
+		m.mu.Unlock()
+		return release, delta, nil
+	}
+	m.mu.Unlock()
+
+	base, err := os.ReadFile(rollbackBinaryName)
+	if err != nil {
+		return nil, nil, fmt.Errorf("no base binary for delta: %w", err)
+	}
+	if sum := sha256.Sum256(base); hex.EncodeToString(sum[:]) != baseSHA256 {
+		return nil, nil, ErrDeltaBaseMismatch
+	}
+	delta, err := CreateDelta(base, data)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	return release, []byte{}, nil
+	m.mu.Lock()
+	m.deltaBase, m.delta = baseSHA256, delta
+	m.mu.Unlock()
+	return release, delta, nil
 }
 
 // StartPeriodicCheck begins a loop to check for updates.
@@ -105,24 +323,29 @@ func (m *Manager) StartPeriodicCheck(ctx context.Context, interval time.Duration
 		return
 	case <-time.After(5 * time.Second):
 	}
-	m.CheckForUpdate()
+	m.CheckForUpdate(ctx)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			m.CheckForUpdate()
+			m.CheckForUpdate(ctx)
 		}
 	}
 }
 
 // CheckForUpdate fetches the latest release information and, if a newer version
 // is available, downloads and verifies the update.
-func (m *Manager) CheckForUpdate() {
+func (m *Manager) CheckForUpdate(ctx context.Context) {
 	m.logger.Info("Checking for agent updates", "url", m.updateURL)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	ctx, span := tracing.Start(ctx, "update.CheckForUpdate",
+		attribute.String("update.current_version", m.currentVersion),
+		attribute.Bool("update.p2p", m.p2pNetwork != nil))
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
 	// 1. Try to fetch release info from P2P network if enabled
@@ -142,10 +365,15 @@ func (m *Manager) CheckForUpdate() {
 		release, err = m.fetchReleaseInfo(ctx)
 		if err != nil {
 			m.logger.Error("Failed to fetch release info", "error", err)
+			m.reportCheck("error", "", err)
 			return
 		}
 	}
 
+	m.mu.Lock()
+	m.latest = release
+	m.mu.Unlock()
+
 	// 3. Compare versions using semver
 	cur := ensureSemverPrefix(m.currentVersion)
 	rel := ensureSemverPrefix(release.Version)
@@ -153,21 +381,38 @@ func (m *Manager) CheckForUpdate() {
 		m.logger.Warn("Invalid semver, falling back to string comparison", "current", m.currentVersion, "release", release.Version)
 		if release.Version <= m.currentVersion {
 			m.logger.Info("Agent is up to date", "current_version", m.currentVersion)
+			m.reportCheck("up_to_date", release.Version, nil)
 			return
 		}
 	} else if semver.Compare(rel, cur) <= 0 {
 		m.logger.Info("Agent is up to date", "current_version", m.currentVersion)
+		m.reportCheck("up_to_date", release.Version, nil)
+		return
+	}
+	if isFailedVersion(release.Version) {
+		m.logger.Warn("Skipping release that failed post-update probation", "version", release.Version)
+		m.reportCheck("skipped", release.Version, nil)
 		return
 	}
 	m.logger.Info("New agent version available", "new_version", release.Version)
 
+	if m.rollout != nil {
+		if ok, reason := m.rollout.Admit(release); !ok {
+			m.logger.Info("Update deferred by staged rollout", "new_version", release.Version, "reason", reason)
+			m.reportCheck("deferred", release.Version, nil)
+			return
+		}
+	}
+
 	// 4. Perform the update
 	if releaseData != nil {
 		// P2P update
 		if err := m.performP2PUpdate(ctx, release, releaseData); err != nil {
 			m.logger.Error("Failed to perform P2P update", "error", err)
+			m.reportCheck("error", release.Version, err)
 		} else {
 			m.logger.Info("P2P update downloaded and verified. Triggering shutdown to apply.")
+			m.reportCheck("updated", release.Version, nil)
 			if m.OnUpdateReady != nil {
 				m.OnUpdateReady()
 			}
@@ -176,8 +421,10 @@ func (m *Manager) CheckForUpdate() {
 		// Server update
 		if err := m.performUpdate(ctx, release); err != nil {
 			m.logger.Error("Failed to perform update", "error", err)
+			m.reportCheck("error", release.Version, err)
 		} else {
 			m.logger.Info("Update downloaded and verified. Triggering shutdown to apply.")
+			m.reportCheck("updated", release.Version, nil)
 			if m.OnUpdateReady != nil {
 				m.OnUpdateReady()
 			}
@@ -185,6 +432,14 @@ func (m *Manager) CheckForUpdate() {
 	}
 }
 
+// reportCheck records the outcome of an update check and notifies OnCheckComplete.
+func (m *Manager) reportCheck(result, version string, err error) {
+	m.metrics.UpdateCheck(result)
+	if m.OnCheckComplete != nil {
+		m.OnCheckComplete(result, version, err)
+	}
+}
+
 // checkForP2PUpdate checks for updates from connected peers
 func (m *Manager) checkForP2PUpdate(ctx context.Context) (*ReleaseInfo, []byte, error) {
 	if m.p2pNetwork == nil {
@@ -199,12 +454,31 @@ func (m *Manager) checkForP2PUpdate(ctx context.Context) (*ReleaseInfo, []byte,
 
 	// Try to fetch update from each peer
 	for _, peerID := range peers {
-		release, data, err := m.p2pNetwork.FetchUpdateFromPeer(ctx, peerID, "latest")
+		release, data, err := m.fetchFromPeer(ctx, peerID)
 		if err != nil {
 			m.logger.Warn("Failed to fetch update from peer", "peer", peerID, "error", err)
 			continue
 		}
 
+		// With TUF the peer's release description is not trusted: the
+		// release is rebuilt from its metadata after verifying it against
+		// our own root and rollback state.
+		if m.metadata != nil {
+			if release == nil || release.Metadata == nil {
+				m.logger.Warn("Peer sent update without metadata", "peer", peerID)
+				continue
+			}
+			if err := m.metadata.Update(ctx, release.Metadata); err != nil {
+				m.logger.Warn("Failed to verify update metadata from peer", "peer", peerID, "error", err)
+				continue
+			}
+			release, err = m.metadata.Release(fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH), m.tuf.TargetsURL)
+			if err != nil {
+				m.logger.Warn("Peer metadata has no usable release", "peer", peerID, "error", err)
+				continue
+			}
+		}
+
 		// Verify the release
 		if err := m.verifyRelease(release, data); err != nil {
 			m.logger.Warn("Failed to verify release from peer", "peer", peerID, "error", err)
@@ -226,6 +500,39 @@ func (m *Manager) checkForP2PUpdate(ctx context.Context) (*ReleaseInfo, []byte,
 	return nil, nil, fmt.Errorf("no newer version found from peers")
 }
 
+// fetchFromPeer asks peerID for its release, preferring a delta against the
+// running binary when the network supports it. The binary returned is
+// verified by the caller whether it was rebuilt or sent in full.
+func (m *Manager) fetchFromPeer(ctx context.Context, peerID peer.ID) (*ReleaseInfo, []byte, error) {
+	if df, ok := m.p2pNetwork.(DeltaFetcher); ok {
+		if base, err := currentBinary(); err == nil {
+			sum := sha256.Sum256(base)
+			release, data, delta, err := df.FetchUpdateDeltaFromPeer(ctx, peerID, "latest", hex.EncodeToString(sum[:]))
+			switch {
+			case err != nil:
+				m.logger.Warn("Failed to fetch update delta from peer, requesting full binary", "peer", peerID, "error", err)
+			case delta != nil:
+				m.metrics.UpdateDownload("delta", len(delta))
+				rebuilt, err := ApplyDelta(base, delta)
+				if err == nil {
+					m.logger.Info("Rebuilt update from peer delta", "peer", peerID, "delta_bytes", len(delta), "binary_bytes", len(rebuilt))
+					return release, rebuilt, nil
+				}
+				m.logger.Warn("Failed to apply update delta from peer, requesting full binary", "peer", peerID, "error", err)
+			default:
+				m.metrics.UpdateDownload("full", len(data))
+				return release, data, nil
+			}
+		}
+	}
+
+	release, data, err := m.p2pNetwork.FetchUpdateFromPeer(ctx, peerID, "latest")
+	if err == nil {
+		m.metrics.UpdateDownload("full", len(data))
+	}
+	return release, data, err
+}
+
 func (m *Manager) performUpdate(ctx context.Context, release *ReleaseInfo) error {
 	key := fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
 	artifact, ok := release.Artifacts[key]
@@ -233,15 +540,10 @@ func (m *Manager) performUpdate(ctx context.Context, release *ReleaseInfo) error
 		return fmt.Errorf("no artifact found for current platform: %s", key)
 	}
 
-	newBinary, err := m.downloadFile(ctx, artifact.URL)
+	newBinary, err := m.fetchBinary(ctx, key, artifact)
 	if err != nil {
-		return fmt.Errorf("failed to download new binary: %w", err)
-	}
-
-	if err := m.verifyArtifact(artifact, newBinary); err != nil {
-		return fmt.Errorf("artifact verification failed: %w", err)
+		return err
 	}
-	m.logger.Info("New binary signature verified successfully")
 
 	if err := m.backupCurrentBinary(); err != nil {
 		m.logger.Warn("Failed to back up current binary, continuing", "error", err)
@@ -250,6 +552,13 @@ func (m *Manager) performUpdate(ctx context.Context, release *ReleaseInfo) error
 	if err := os.WriteFile("agentd.new", newBinary, 0755); err != nil {
 		return fmt.Errorf("failed to write new binary: %w", err)
 	}
+	if err := m.markPending(release.Version); err != nil {
+		m.logger.Warn("Failed to record pending update for probation", "error", err)
+	}
+	if err := saveInstalledRelease(release); err != nil {
+		m.logger.Warn("Failed to record installed release", "error", err)
+	}
+	m.publishBinary(ctx, release.Version, key, newBinary)
 
 	return nil
 }
@@ -261,7 +570,7 @@ func (m *Manager) performP2PUpdate(ctx context.Context, release *ReleaseInfo, da
 		return fmt.Errorf("no artifact found for current platform: %s", key)
 	}
 
-	if err := m.verifyArtifact(artifact, data); err != nil {
+	if err := m.verifyDownload(key, artifact, data); err != nil {
 		return fmt.Errorf("artifact verification failed: %w", err)
 	}
 	m.logger.Info("New binary signature verified successfully")
@@ -273,29 +582,99 @@ func (m *Manager) performP2PUpdate(ctx context.Context, release *ReleaseInfo, da
 	if err := os.WriteFile("agentd.new", data, 0755); err != nil {
 		return fmt.Errorf("failed to write new binary: %w", err)
 	}
+	if err := m.markPending(release.Version); err != nil {
+		m.logger.Warn("Failed to record pending update for probation", "error", err)
+	}
+	if err := saveInstalledRelease(release); err != nil {
+		m.logger.Warn("Failed to record installed release", "error", err)
+	}
+	m.publishBinary(ctx, release.Version, key, data)
 
 	return nil
 }
 
-// backupCurrentBinary copies the running executable to agentd.rollback for recovery.
-func (m *Manager) backupCurrentBinary() error {
+// StageBinary installs an already verified binary, such as an agent patch,
+// as agentd.new for the given version. Like a downloaded update it replaces
+// the executable on the next restart and goes on probation.
+func (m *Manager) StageBinary(version string, data []byte) error {
+	if err := m.backupCurrentBinary(); err != nil {
+		m.logger.Warn("Failed to back up current binary, continuing", "error", err)
+	}
+	if err := os.WriteFile(newBinaryName, data, 0755); err != nil {
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	if err := m.markPending(version); err != nil {
+		m.logger.Warn("Failed to record pending update for probation", "error", err)
+	}
+	return nil
+}
+
+// DiscardStaged removes a binary staged by StageBinary or an update that
+// has not been applied yet.
+func (m *Manager) DiscardStaged() error {
+	_ = os.Remove(pendingStateName)
+	if err := os.Remove(newBinaryName); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove staged binary: %w", err)
+	}
+	return nil
+}
+
+// currentBinary reads the running executable.
+func currentBinary() ([]byte, error) {
 	execPath, err := os.Executable()
 	if err != nil {
-		return fmt.Errorf("cannot determine executable path: %w", err)
+		return nil, fmt.Errorf("cannot determine executable path: %w", err)
 	}
 	data, err := os.ReadFile(execPath)
 	if err != nil {
-		return fmt.Errorf("cannot read current binary: %w", err)
+		return nil, fmt.Errorf("cannot read current binary: %w", err)
+	}
+	return data, nil
+}
+
+// backupCurrentBinary copies the running executable to agentd.rollback for recovery.
+func (m *Manager) backupCurrentBinary() error {
+	data, err := currentBinary()
+	if err != nil {
+		return err
 	}
-	return os.WriteFile("agentd.rollback", data, 0755)
+	return os.WriteFile(rollbackBinaryName, data, 0755)
+}
+
+// saveInstalledRelease keeps the verified description of the release in
+// agentd.new so the agent can serve it to peers once it runs.
+func saveInstalledRelease(release *ReleaseInfo) error {
+	installed := *release
+	installed.Metadata = nil
+	data, err := json.Marshal(installed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal release: %w", err)
+	}
+	return os.WriteFile(installedReleaseName, data, 0600)
+}
+
+// installedRelease returns the kept release description if it describes
+// the running version.
+func (m *Manager) installedRelease() (*ReleaseInfo, bool) {
+	data, err := os.ReadFile(installedReleaseName)
+	if err != nil {
+		return nil, false
+	}
+	var release ReleaseInfo
+	if err := json.Unmarshal(data, &release); err != nil || !sameVersion(release.Version, m.currentVersion) {
+		return nil, false
+	}
+	return &release, true
 }
 
 // Rollback restores the backup binary (agentd.rollback) to its original location.
+// The restored binary is not put on probation.
 func (m *Manager) Rollback() error {
-	backup, err := os.ReadFile("agentd.rollback")
+	backup, err := os.ReadFile(rollbackBinaryName)
 	if err != nil {
 		return fmt.Errorf("rollback binary not found: %w", err)
 	}
+	_ = os.Remove(pendingStateName)
 	return os.WriteFile("agentd.new", backup, 0755)
 }
 
@@ -312,6 +691,122 @@ func (m *Manager) verifyArtifact(artifact ArtifactInfo, data []byte) error {
 	return nil
 }
 
+// verifyDownload checks downloaded artifact data against the trusted targets
+// metadata when TUF is enabled, or against the artifact signature otherwise.
+func (m *Manager) verifyDownload(platform string, artifact ArtifactInfo, data []byte) error {
+	if m.metadata != nil {
+		return m.metadata.VerifyTarget(platform, data)
+	}
+	return m.verifyArtifact(artifact, data)
+}
+
+// fetchBinary obtains and verifies the artifact for platform. It tries a
+// delta against the running binary, then a chunked fetch from peers, and
+// falls back to downloading the full binary from the artifact URL.
+func (m *Manager) fetchBinary(ctx context.Context, platform string, artifact ArtifactInfo) ([]byte, error) {
+	data, err := m.fetchDelta(ctx, platform, artifact)
+	if err == nil {
+		m.logger.Info("New binary rebuilt from delta and verified successfully")
+		return data, nil
+	}
+	if !errors.Is(err, errNoDelta) {
+		m.logger.Warn("Delta update failed, fetching full binary", "error", err)
+	}
+
+	if m.content != nil && artifact.Content != "" {
+		data, err := m.fetchContent(ctx, platform, artifact)
+		if err == nil {
+			m.logger.Info("New binary fetched from peers and verified successfully", "root", artifact.Content)
+			return data, nil
+		}
+		m.logger.Warn("Chunked fetch from peers failed, downloading full binary", "root", artifact.Content, "error", err)
+	}
+
+	data, err = m.downloadFile(ctx, artifact.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download new binary: %w", err)
+	}
+	m.metrics.UpdateDownload("full", len(data))
+
+	if err := m.verifyDownload(platform, artifact, data); err != nil {
+		return nil, fmt.Errorf("artifact verification failed: %w", err)
+	}
+	m.logger.Info("New binary signature verified successfully")
+	return data, nil
+}
+
+// fetchContent fetches the artifact in chunks from the peers that provide
+// its content root and verifies it like a full download.
+func (m *Manager) fetchContent(ctx context.Context, platform string, artifact ArtifactInfo) ([]byte, error) {
+	data, err := m.content.Fetch(ctx, artifact.Content)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.verifyDownload(platform, artifact, data); err != nil {
+		return nil, fmt.Errorf("fetched binary verification failed: %w", err)
+	}
+	m.metrics.UpdateDownload("chunked", len(data))
+	return data, nil
+}
+
+// publishBinary offers a verified binary to peers through the content store.
+func (m *Manager) publishBinary(ctx context.Context, version, platform string, data []byte) {
+	if m.content == nil {
+		return
+	}
+	manifest, err := m.content.Publish(ctx, fmt.Sprintf("agentd %s %s", version, platform), data)
+	if err != nil {
+		m.logger.Warn("Failed to publish binary for peers", "version", version, "error", err)
+		return
+	}
+	m.logger.Info("Published binary for peers", "version", version, "root", manifest.Root)
+}
+
+// fetchDelta rebuilds the artifact from a delta against the running binary
+// when the release advertises one from the current version. The delta must
+// match its advertised hash and, without TUF, carry a valid signature; the
+// rebuilt binary is verified like a full download.
+func (m *Manager) fetchDelta(ctx context.Context, platform string, artifact ArtifactInfo) ([]byte, error) {
+	var delta *DeltaInfo
+	for i := range artifact.Deltas {
+		if sameVersion(artifact.Deltas[i].From, m.currentVersion) {
+			delta = &artifact.Deltas[i]
+			break
+		}
+	}
+	if delta == nil {
+		return nil, errNoDelta
+	}
+
+	data, err := m.downloadFile(ctx, delta.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download delta: %w", err)
+	}
+	m.metrics.UpdateDownload("delta", len(data))
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), delta.SHA256) {
+		return nil, fmt.Errorf("delta hash mismatch")
+	}
+	if m.metadata == nil {
+		if err := m.verifyArtifact(ArtifactInfo{Signature: delta.Signature}, data); err != nil {
+			return nil, fmt.Errorf("delta verification failed: %w", err)
+		}
+	}
+
+	base, err := currentBinary()
+	if err != nil {
+		return nil, err
+	}
+	newBinary, err := ApplyDelta(base, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply delta: %w", err)
+	}
+	if err := m.verifyDownload(platform, artifact, newBinary); err != nil {
+		return nil, fmt.Errorf("rebuilt binary verification failed: %w", err)
+	}
+	return newBinary, nil
+}
+
 // verifyRelease verifies a release and its artifacts
 func (m *Manager) verifyRelease(release *ReleaseInfo, data []byte) error {
 	// Find artifact for our platform
@@ -322,7 +817,7 @@ func (m *Manager) verifyRelease(release *ReleaseInfo, data []byte) error {
 	}
 
 	// Verify the artifact
-	if err := m.verifyArtifact(artifact, data); err != nil {
+	if err := m.verifyDownload(key, artifact, data); err != nil {
 		return fmt.Errorf("artifact verification failed: %w", err)
 	}
 
@@ -330,45 +825,65 @@ func (m *Manager) verifyRelease(release *ReleaseInfo, data []byte) error {
 }
 
 func (m *Manager) fetchReleaseInfo(ctx context.Context) (*ReleaseInfo, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.updateURL, nil)
-	if err != nil {
-		return nil, err
+	if m.metadata != nil {
+		src := &HTTPMetadataSource{BaseURL: m.tuf.MetadataURL, Client: m.httpClient}
+		if err := m.metadata.Update(ctx, src); err != nil {
+			return nil, fmt.Errorf("failed to update release metadata: %w", err)
+		}
+		return m.metadata.Release(fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH), m.tuf.TargetsURL)
 	}
 
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = resp.Body.Close() }()
+	return robustness.Call(ctx, m.downloads.Middleware(urlHost(m.updateURL)), func(ctx context.Context) (*ReleaseInfo, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.updateURL, nil)
+		if err != nil {
+			return nil, robustness.Permanent(err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad status from update server: %s", resp.Status)
-	}
+		resp, err := m.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
 
-	var release ReleaseInfo
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return nil, err
-	}
-	return &release, nil
+		if resp.StatusCode != http.StatusOK {
+			return nil, robustness.StatusError(resp.StatusCode, fmt.Errorf("bad status from update server: %s", resp.Status))
+		}
+
+		var release ReleaseInfo
+		if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+			return nil, err
+		}
+		return &release, nil
+	})
 }
 
 func (m *Manager) downloadFile(ctx context.Context, url string) ([]byte, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
-	if err != nil {
-		return nil, err
-	}
+	return robustness.Call(ctx, m.downloads.Middleware(urlHost(url)), func(ctx context.Context) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, robustness.Permanent(err)
+		}
 
-	resp, err := m.httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer func() { _ = resp.Body.Close() }()
+		resp, err := m.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("bad status from artifact server: %s", resp.Status)
-	}
+		if resp.StatusCode != http.StatusOK {
+			return nil, robustness.StatusError(resp.StatusCode, fmt.Errorf("bad status from artifact server: %s", resp.Status))
+		}
 
-	return io.ReadAll(resp.Body)
+		return io.ReadAll(resp.Body)
+	})
+}
+
+// urlHost names the breaker a request to rawURL goes through.
+func urlHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
 }
 
 // ensureSemverPrefix adds "v" prefix if missing for semver.Parse conformance.
@@ -0,0 +1,727 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Update metadata follows the roles of The Update Framework (TUF):
+//
+//   - root lists the trusted keys and the threshold for every role, and can
+//     rotate them by publishing N+1.root.json signed by both the old and new
+//     root keys;
+//   - targets lists the release artifacts with their length, hashes and version;
+//   - snapshot pins the version and hash of targets.json;
+//   - timestamp pins snapshot.json and is re-signed often with a short expiry.
+//
+// The client refuses metadata whose version is lower than what it already
+// trusts (rollback) and metadata past its expiry (freeze), and persists the
+// trusted versions so the protection survives restarts.
+
+// Role names.
+const (
+	RoleRoot      = "root"
+	RoleTargets   = "targets"
+	RoleSnapshot  = "snapshot"
+	RoleTimestamp = "timestamp"
+)
+
+const (
+	keyTypeEd25519      = "ed25519"
+	maxMetadataSize     = 1 << 20
+	maxRootRotations    = 32
+	defaultMetadataDir  = "state/update-metadata"
+	timestampFile       = "timestamp.json"
+	snapshotFile        = "snapshot.json"
+	targetsFile         = "targets.json"
+	rootFileSuffix      = ".root.json"
+	currentRootFileName = "root.json"
+)
+
+var (
+	// ErrMetadataNotFound is returned by a MetadataSource for missing files.
+	ErrMetadataNotFound = errors.New("metadata not found")
+	// ErrMetadataExpired indicates a freeze attack or a stale mirror.
+	ErrMetadataExpired = errors.New("metadata expired")
+	// ErrMetadataRollback indicates metadata older than the trusted copy.
+	ErrMetadataRollback = errors.New("metadata rollback detected")
+)
+
+// TUFConfig enables TUF-style metadata verification for updates.
+type TUFConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	MetadataURL     string `yaml:"metadata_url"`      // base URL serving N.root.json, timestamp.json, snapshot.json and targets.json
+	TargetsURL      string `yaml:"targets_url"`       // base URL for targets that carry no url of their own
+	TrustedRootPath string `yaml:"trusted_root_path"` // initial root.json shipped with the agent
+	MetadataDir     string `yaml:"metadata_dir"`      // persisted trusted metadata, defaults to state/update-metadata
+}
+
+// Signature is one role key's signature over the signed payload.
+type Signature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"` // hex ed25519 signature over the raw "signed" bytes
+}
+
+// SignedMetadata is the envelope every metadata file is stored in.
+type SignedMetadata struct {
+	Signed     json.RawMessage `json:"signed"`
+	Signatures []Signature     `json:"signatures"`
+}
+
+// MetadataKey is a public key listed in root metadata.
+type MetadataKey struct {
+	Type   string `json:"keytype"`
+	Public string `json:"public"` // hex
+}
+
+// RoleKeys lists the keys allowed to sign a role and how many must sign.
+type RoleKeys struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+// RootMetadata is the content of root.json.
+type RootMetadata struct {
+	Type    string                 `json:"_type"`
+	Version int64                  `json:"version"`
+	Expires time.Time              `json:"expires"`
+	Keys    map[string]MetadataKey `json:"keys"`
+	Roles   map[string]RoleKeys    `json:"roles"`
+}
+
+// MetaFile pins the version (and optionally length and hashes) of another
+// metadata file.
+type MetaFile struct {
+	Version int64             `json:"version"`
+	Length  int64             `json:"length,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// TimestampMetadata is the content of timestamp.json.
+type TimestampMetadata struct {
+	Type    string              `json:"_type"`
+	Version int64               `json:"version"`
+	Expires time.Time           `json:"expires"`
+	Meta    map[string]MetaFile `json:"meta"` // "snapshot.json"
+}
+
+// SnapshotMetadata is the content of snapshot.json.
+type SnapshotMetadata struct {
+	Type    string              `json:"_type"`
+	Version int64               `json:"version"`
+	Expires time.Time           `json:"expires"`
+	Meta    map[string]MetaFile `json:"meta"` // "targets.json"
+}
+
+// TargetFile describes one release artifact.
+type TargetFile struct {
+	Length int64             `json:"length"`
+	Hashes map[string]string `json:"hashes"` // "sha256" is required
+	Custom TargetCustom      `json:"custom"`
+}
+
+// TargetCustom carries the agent-specific target fields.
+type TargetCustom struct {
+	Version string      `json:"version"`
+	URL     string      `json:"url,omitempty"`
+	Channel string      `json:"channel,omitempty"`
+	Deltas  []DeltaInfo `json:"deltas,omitempty"`  // sha256 is pinned by the targets signature
+	Content string      `json:"content,omitempty"` // chunked-transfer manifest root
+}
+
+// TargetsMetadata is the content of targets.json. Targets are keyed by "os/arch".
+type TargetsMetadata struct {
+	Type    string                `json:"_type"`
+	Version int64                 `json:"version"`
+	Expires time.Time             `json:"expires"`
+	Targets map[string]TargetFile `json:"targets"`
+}
+
+// MetadataBundle carries signed metadata between peers so a release fetched
+// over P2P is verified against the receiver's own trusted root. Files are
+// kept as raw bytes because hashes and signatures cover the exact encoding.
+type MetadataBundle struct {
+	Roots     [][]byte `json:"roots,omitempty"` // every known root version, oldest first
+	Timestamp []byte   `json:"timestamp"`
+	Snapshot  []byte   `json:"snapshot"`
+	Targets   []byte   `json:"targets"`
+}
+
+// MetadataSource fetches metadata files by name (e.g. "2.root.json").
+type MetadataSource interface {
+	Fetch(ctx context.Context, name string) ([]byte, error)
+}
+
+// KeyID returns the identifier of an ed25519 public key: the hex SHA-256 of the key.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:])
+}
+
+// SignMetadata marshals payload and signs it with every key, producing the
+// bytes of a metadata file.
+func SignMetadata(payload interface{}, keys ...ed25519.PrivateKey) ([]byte, error) {
+	signed, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	env := SignedMetadata{Signed: signed}
+	for _, k := range keys {
+		env.Signatures = append(env.Signatures, Signature{
+			KeyID: KeyID(k.Public().(ed25519.PublicKey)),
+			Sig:   hex.EncodeToString(ed25519.Sign(k, signed)),
+		})
+	}
+	return json.Marshal(env)
+}
+
+// verifyRole checks that env carries at least threshold valid signatures
+// from distinct keys authorised for role in root.
+func verifyRole(env *SignedMetadata, root *RootMetadata, role string) error {
+	rk, ok := root.Roles[role]
+	if !ok || rk.Threshold < 1 {
+		return fmt.Errorf("root metadata does not define role %s", role)
+	}
+	allowed := make(map[string]bool, len(rk.KeyIDs))
+	for _, id := range rk.KeyIDs {
+		allowed[id] = true
+	}
+
+	valid := make(map[string]bool)
+	for _, sig := range env.Signatures {
+		if !allowed[sig.KeyID] || valid[sig.KeyID] {
+			continue
+		}
+		key, ok := root.Keys[sig.KeyID]
+		if !ok || key.Type != keyTypeEd25519 {
+			continue
+		}
+		pub, err := hex.DecodeString(key.Public)
+		if err != nil || len(pub) != ed25519.PublicKeySize {
+			continue
+		}
+		raw, err := hex.DecodeString(sig.Sig)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(pub, env.Signed, raw) {
+			valid[sig.KeyID] = true
+		}
+	}
+	if len(valid) < rk.Threshold {
+		return fmt.Errorf("%s metadata has %d valid signatures, threshold is %d", role, len(valid), rk.Threshold)
+	}
+	return nil
+}
+
+// decodeSigned parses an envelope and its payload, checking the _type field.
+func decodeSigned(data []byte, role string, out interface{}) (*SignedMetadata, error) {
+	var env SignedMetadata
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to decode %s metadata: %w", role, err)
+	}
+	if err := json.Unmarshal(env.Signed, out); err != nil {
+		return nil, fmt.Errorf("failed to decode %s payload: %w", role, err)
+	}
+	var header struct {
+		Type string `json:"_type"`
+	}
+	_ = json.Unmarshal(env.Signed, &header)
+	if header.Type != role {
+		return nil, fmt.Errorf("expected %s metadata, got %q", role, header.Type)
+	}
+	return &env, nil
+}
+
+func checkMetaFile(name string, data []byte, want MetaFile) error {
+	if want.Length > 0 && int64(len(data)) != want.Length {
+		return fmt.Errorf("%s length %d does not match pinned length %d", name, len(data), want.Length)
+	}
+	if h, ok := want.Hashes["sha256"]; ok {
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != h {
+			return fmt.Errorf("%s hash does not match pinned hash", name)
+		}
+	}
+	return nil
+}
+
+// MetadataClient verifies update metadata and persists the trusted copies.
+type MetadataClient struct {
+	dir string
+	now func() time.Time
+
+	mu        sync.Mutex
+	root      *RootMetadata
+	roots     [][]byte
+	timestamp *TimestampMetadata
+	snapshot  *SnapshotMetadata
+	targets   *TargetsMetadata
+	raw       map[string][]byte
+}
+
+// NewMetadataClient loads the trusted metadata persisted in dir. When dir
+// holds no root yet, initialRoot (which must be self-signed to its own
+// threshold) becomes the trust anchor.
+func NewMetadataClient(dir string, initialRoot []byte) (*MetadataClient, error) {
+	if dir == "" {
+		dir = defaultMetadataDir
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+	c := &MetadataClient{dir: dir, now: time.Now, raw: make(map[string][]byte)}
+
+	if err := c.loadRoots(); err != nil {
+		return nil, err
+	}
+	if c.root == nil {
+		if len(initialRoot) == 0 {
+			return nil, fmt.Errorf("no trusted root metadata in %s and no initial root provided", dir)
+		}
+		var root RootMetadata
+		env, err := decodeSigned(initialRoot, RoleRoot, &root)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyRole(env, &root, RoleRoot); err != nil {
+			return nil, fmt.Errorf("initial root is not self-signed: %w", err)
+		}
+		if err := c.acceptRoot(&root, initialRoot); err != nil {
+			return nil, err
+		}
+	}
+
+	// Previously trusted metadata only needs valid signatures: expiry is
+	// enforced on every update, and the stored versions are the rollback floor.
+	if data, err := os.ReadFile(filepath.Join(dir, timestampFile)); err == nil {
+		var ts TimestampMetadata
+		if env, err := decodeSigned(data, RoleTimestamp, &ts); err == nil && verifyRole(env, c.root, RoleTimestamp) == nil {
+			c.timestamp, c.raw[timestampFile] = &ts, data
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, snapshotFile)); err == nil {
+		var snap SnapshotMetadata
+		if env, err := decodeSigned(data, RoleSnapshot, &snap); err == nil && verifyRole(env, c.root, RoleSnapshot) == nil {
+			c.snapshot, c.raw[snapshotFile] = &snap, data
+		}
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, targetsFile)); err == nil {
+		var targets TargetsMetadata
+		if env, err := decodeSigned(data, RoleTargets, &targets); err == nil && verifyRole(env, c.root, RoleTargets) == nil {
+			c.targets, c.raw[targetsFile] = &targets, data
+		}
+	}
+	return c, nil
+}
+
+// loadRoots reads every persisted N.root.json and keeps the highest as trusted.
+func (c *MetadataClient) loadRoots() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read metadata directory: %w", err)
+	}
+	type versioned struct {
+		version int64
+		name    string
+	}
+	var files []versioned
+	for _, e := range entries {
+		prefix, ok := strings.CutSuffix(e.Name(), rootFileSuffix)
+		if !ok {
+			continue
+		}
+		v, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		files = append(files, versioned{v, e.Name()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].version < files[j].version })
+
+	for _, f := range files {
+		data, err := os.ReadFile(filepath.Join(c.dir, f.name))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", f.name, err)
+		}
+		var root RootMetadata
+		if _, err := decodeSigned(data, RoleRoot, &root); err != nil {
+			return err
+		}
+		c.roots = append(c.roots, data)
+		c.root = &root
+	}
+	return nil
+}
+
+func (c *MetadataClient) acceptRoot(root *RootMetadata, data []byte) error {
+	name := strconv.FormatInt(root.Version, 10) + rootFileSuffix
+	if err := c.persist(name, data); err != nil {
+		return err
+	}
+	if err := c.persist(currentRootFileName, data); err != nil {
+		return err
+	}
+	c.root = root
+	c.roots = append(c.roots, data)
+	return nil
+}
+
+func (c *MetadataClient) persist(name string, data []byte) error {
+	tmp := filepath.Join(c.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := os.Rename(tmp, filepath.Join(c.dir, name)); err != nil {
+		return fmt.Errorf("failed to persist %s: %w", name, err)
+	}
+	return nil
+}
+
+func (c *MetadataClient) checkExpiry(role string, expires time.Time) error {
+	if !c.now().Before(expires) {
+		return fmt.Errorf("%s metadata expired at %s: %w", role, expires.Format(time.RFC3339), ErrMetadataExpired)
+	}
+	return nil
+}
+
+// Update refreshes the trusted metadata from src: root rotation first, then
+// timestamp, snapshot and targets, each checked for signatures, pinned
+// versions and hashes, rollback and expiry. Nothing is persisted unless the
+// whole chain verifies (root rotations are persisted as they are accepted).
+func (c *MetadataClient) Update(ctx context.Context, src MetadataSource) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.updateRoot(ctx, src); err != nil {
+		return err
+	}
+	if err := c.checkExpiry(RoleRoot, c.root.Expires); err != nil {
+		return err
+	}
+
+	// Timestamp.
+	tsData, err := src.Fetch(ctx, timestampFile)
+	if err != nil {
+		return fmt.Errorf("failed to fetch timestamp metadata: %w", err)
+	}
+	var ts TimestampMetadata
+	env, err := decodeSigned(tsData, RoleTimestamp, &ts)
+	if err != nil {
+		return err
+	}
+	if err := verifyRole(env, c.root, RoleTimestamp); err != nil {
+		return err
+	}
+	snapMeta, ok := ts.Meta[snapshotFile]
+	if !ok {
+		return fmt.Errorf("timestamp metadata does not pin %s", snapshotFile)
+	}
+	if c.timestamp != nil {
+		if ts.Version < c.timestamp.Version {
+			return fmt.Errorf("timestamp version %d is older than trusted %d: %w", ts.Version, c.timestamp.Version, ErrMetadataRollback)
+		}
+		if snapMeta.Version < c.timestamp.Meta[snapshotFile].Version {
+			return fmt.Errorf("timestamp pins snapshot version %d, trusted is %d: %w", snapMeta.Version, c.timestamp.Meta[snapshotFile].Version, ErrMetadataRollback)
+		}
+	}
+	if err := c.checkExpiry(RoleTimestamp, ts.Expires); err != nil {
+		return err
+	}
+
+	// Snapshot.
+	snapData, err := src.Fetch(ctx, snapshotFile)
+	if err != nil {
+		return fmt.Errorf("failed to fetch snapshot metadata: %w", err)
+	}
+	if err := checkMetaFile(snapshotFile, snapData, snapMeta); err != nil {
+		return err
+	}
+	var snap SnapshotMetadata
+	env, err = decodeSigned(snapData, RoleSnapshot, &snap)
+	if err != nil {
+		return err
+	}
+	if err := verifyRole(env, c.root, RoleSnapshot); err != nil {
+		return err
+	}
+	if snap.Version != snapMeta.Version {
+		return fmt.Errorf("snapshot version %d does not match pinned version %d", snap.Version, snapMeta.Version)
+	}
+	targetsMeta, ok := snap.Meta[targetsFile]
+	if !ok {
+		return fmt.Errorf("snapshot metadata does not pin %s", targetsFile)
+	}
+	if c.snapshot != nil {
+		for name, old := range c.snapshot.Meta {
+			if cur, ok := snap.Meta[name]; !ok || cur.Version < old.Version {
+				return fmt.Errorf("snapshot lowers %s below trusted version %d: %w", name, old.Version, ErrMetadataRollback)
+			}
+		}
+	}
+	if err := c.checkExpiry(RoleSnapshot, snap.Expires); err != nil {
+		return err
+	}
+
+	// Targets.
+	targetsData, err := src.Fetch(ctx, targetsFile)
+	if err != nil {
+		return fmt.Errorf("failed to fetch targets metadata: %w", err)
+	}
+	if err := checkMetaFile(targetsFile, targetsData, targetsMeta); err != nil {
+		return err
+	}
+	var targets TargetsMetadata
+	env, err = decodeSigned(targetsData, RoleTargets, &targets)
+	if err != nil {
+		return err
+	}
+	if err := verifyRole(env, c.root, RoleTargets); err != nil {
+		return err
+	}
+	if targets.Version != targetsMeta.Version {
+		return fmt.Errorf("targets version %d does not match pinned version %d", targets.Version, targetsMeta.Version)
+	}
+	if c.targets != nil && targets.Version < c.targets.Version {
+		return fmt.Errorf("targets version %d is older than trusted %d: %w", targets.Version, c.targets.Version, ErrMetadataRollback)
+	}
+	if err := c.checkExpiry(RoleTargets, targets.Expires); err != nil {
+		return err
+	}
+
+	for name, data := range map[string][]byte{timestampFile: tsData, snapshotFile: snapData, targetsFile: targetsData} {
+		if err := c.persist(name, data); err != nil {
+			return err
+		}
+		c.raw[name] = data
+	}
+	c.timestamp, c.snapshot, c.targets = &ts, &snap, &targets
+	return nil
+}
+
+// updateRoot follows root rotations: each N+1.root.json must be signed by
+// the threshold of both the current and the new root keys.
+func (c *MetadataClient) updateRoot(ctx context.Context, src MetadataSource) error {
+	for i := 0; i < maxRootRotations; i++ {
+		next := c.root.Version + 1
+		name := strconv.FormatInt(next, 10) + rootFileSuffix
+		data, err := src.Fetch(ctx, name)
+		if errors.Is(err, ErrMetadataNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to fetch %s: %w", name, err)
+		}
+
+		var root RootMetadata
+		env, err := decodeSigned(data, RoleRoot, &root)
+		if err != nil {
+			return err
+		}
+		if err := verifyRole(env, c.root, RoleRoot); err != nil {
+			return fmt.Errorf("root %d not signed by trusted root keys: %w", next, err)
+		}
+		if err := verifyRole(env, &root, RoleRoot); err != nil {
+			return fmt.Errorf("root %d not signed by its own keys: %w", next, err)
+		}
+		if root.Version != next {
+			return fmt.Errorf("root file %s carries version %d", name, root.Version)
+		}
+
+		// Rotated timestamp or snapshot keys invalidate the trusted copies,
+		// otherwise a compromised old key could pin versions forever.
+		prev := c.root
+		if err := c.acceptRoot(&root, data); err != nil {
+			return err
+		}
+		if !sameRoleKeys(prev.Roles[RoleTimestamp], root.Roles[RoleTimestamp]) {
+			c.timestamp = nil
+		}
+		if !sameRoleKeys(prev.Roles[RoleSnapshot], root.Roles[RoleSnapshot]) {
+			c.timestamp, c.snapshot = nil, nil
+		}
+	}
+	return fmt.Errorf("more than %d root rotations in one update", maxRootRotations)
+}
+
+func sameRoleKeys(a, b RoleKeys) bool {
+	if a.Threshold != b.Threshold || len(a.KeyIDs) != len(b.KeyIDs) {
+		return false
+	}
+	ids := make(map[string]bool, len(a.KeyIDs))
+	for _, id := range a.KeyIDs {
+		ids[id] = true
+	}
+	for _, id := range b.KeyIDs {
+		if !ids[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// Versions returns the trusted metadata versions by role (0 when unknown).
+func (c *MetadataClient) Versions() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := map[string]int64{RoleRoot: c.root.Version}
+	if c.timestamp != nil {
+		out[RoleTimestamp] = c.timestamp.Version
+	}
+	if c.snapshot != nil {
+		out[RoleSnapshot] = c.snapshot.Version
+	}
+	if c.targets != nil {
+		out[RoleTargets] = c.targets.Version
+	}
+	return out
+}
+
+// Release describes the trusted targets as a ReleaseInfo for platform
+// ("os/arch"). Targets without a URL are resolved against targetsURL.
+func (c *MetadataClient) Release(platform, targetsURL string) (*ReleaseInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.targets == nil {
+		return nil, fmt.Errorf("no trusted targets metadata")
+	}
+	target, ok := c.targets.Targets[platform]
+	if !ok {
+		return nil, fmt.Errorf("no target for current platform: %s", platform)
+	}
+	release := &ReleaseInfo{Version: target.Custom.Version, Channel: target.Custom.Channel, Artifacts: make(map[string]ArtifactInfo, len(c.targets.Targets))}
+	for name, t := range c.targets.Targets {
+		url := t.Custom.URL
+		if url == "" && targetsURL != "" {
+			url = strings.TrimSuffix(targetsURL, "/") + "/" + name
+		}
+		release.Artifacts[name] = ArtifactInfo{URL: url, Deltas: t.Custom.Deltas, Content: t.Custom.Content}
+	}
+	return release, nil
+}
+
+// VerifyTarget checks data against the trusted length and SHA-256 of target name.
+func (c *MetadataClient) VerifyTarget(name string, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.targets == nil {
+		return fmt.Errorf("no trusted targets metadata")
+	}
+	target, ok := c.targets.Targets[name]
+	if !ok {
+		return fmt.Errorf("target %s not listed in trusted metadata", name)
+	}
+	want, ok := target.Hashes["sha256"]
+	if !ok {
+		return fmt.Errorf("target %s has no sha256 hash", name)
+	}
+	if int64(len(data)) != target.Length {
+		return fmt.Errorf("target %s length %d does not match trusted length %d", name, len(data), target.Length)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != want {
+		return fmt.Errorf("target %s hash does not match trusted metadata", name)
+	}
+	return nil
+}
+
+// Bundle returns the trusted metadata for serving to peers, or nil when no
+// targets have been verified yet.
+func (c *MetadataClient) Bundle() *MetadataBundle {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.targets == nil {
+		return nil
+	}
+	b := &MetadataBundle{
+		Timestamp: c.raw[timestampFile],
+		Snapshot:  c.raw[snapshotFile],
+		Targets:   c.raw[targetsFile],
+	}
+	b.Roots = append(b.Roots, c.roots...)
+	return b
+}
+
+// Fetch implements MetadataSource over the bundle contents.
+func (b *MetadataBundle) Fetch(ctx context.Context, name string) ([]byte, error) {
+	switch name {
+	case timestampFile:
+		return nonEmpty(name, b.Timestamp)
+	case snapshotFile:
+		return nonEmpty(name, b.Snapshot)
+	case targetsFile:
+		return nonEmpty(name, b.Targets)
+	}
+	if prefix, ok := strings.CutSuffix(name, rootFileSuffix); ok {
+		want, err := strconv.ParseInt(prefix, 10, 64)
+		if err == nil {
+			for _, data := range b.Roots {
+				var root RootMetadata
+				if _, err := decodeSigned(data, RoleRoot, &root); err == nil && root.Version == want {
+					return data, nil
+				}
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", name, ErrMetadataNotFound)
+}
+
+func nonEmpty(name string, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s: %w", name, ErrMetadataNotFound)
+	}
+	return data, nil
+}
+
+// HTTPMetadataSource fetches metadata files from a base URL.
+type HTTPMetadataSource struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+// Fetch implements MetadataSource.
+func (s *HTTPMetadataSource) Fetch(ctx context.Context, name string) ([]byte, error) {
+	url := strings.TrimSuffix(s.BaseURL, "/") + "/" + name
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", name, ErrMetadataNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("bad status from metadata server for %s: %s", name, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxMetadataSize {
+		return nil, fmt.Errorf("%s exceeds %d bytes", name, maxMetadataSize)
+	}
+	return data, nil
+}
@@ -0,0 +1,354 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// testRepo is an in-memory TUF-style repository.
+type testRepo struct {
+	t     *testing.T
+	mu    sync.Mutex
+	files map[string][]byte
+
+	rootKeys  []ed25519.PrivateKey
+	roleKeys  map[string]ed25519.PrivateKey
+	root      RootMetadata
+	versions  map[string]int64
+	expiresIn time.Duration
+}
+
+func genKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return priv
+}
+
+func keyEntry(k ed25519.PrivateKey) (string, MetadataKey) {
+	pub := k.Public().(ed25519.PublicKey)
+	return KeyID(pub), MetadataKey{Type: keyTypeEd25519, Public: hex.EncodeToString(pub)}
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	r := &testRepo{
+		t:         t,
+		files:     make(map[string][]byte),
+		rootKeys:  []ed25519.PrivateKey{genKey(t)},
+		roleKeys:  map[string]ed25519.PrivateKey{RoleTargets: genKey(t), RoleSnapshot: genKey(t), RoleTimestamp: genKey(t)},
+		versions:  make(map[string]int64),
+		expiresIn: 24 * time.Hour,
+	}
+	r.root = r.buildRoot(1, 1)
+	r.files["1.root.json"] = r.sign(r.root, r.rootKeys...)
+	return r
+}
+
+func (r *testRepo) buildRoot(version int64, targetsThreshold int) RootMetadata {
+	root := RootMetadata{
+		Type:    RoleRoot,
+		Version: version,
+		Expires: time.Now().Add(365 * 24 * time.Hour).UTC(),
+		Keys:    map[string]MetadataKey{},
+		Roles:   map[string]RoleKeys{},
+	}
+	var rootIDs []string
+	for _, k := range r.rootKeys {
+		id, key := keyEntry(k)
+		root.Keys[id] = key
+		rootIDs = append(rootIDs, id)
+	}
+	root.Roles[RoleRoot] = RoleKeys{KeyIDs: rootIDs, Threshold: len(rootIDs)}
+	for role, k := range r.roleKeys {
+		id, key := keyEntry(k)
+		root.Keys[id] = key
+		threshold := 1
+		if role == RoleTargets {
+			threshold = targetsThreshold
+		}
+		root.Roles[role] = RoleKeys{KeyIDs: []string{id}, Threshold: threshold}
+	}
+	return root
+}
+
+func (r *testRepo) sign(payload interface{}, keys ...ed25519.PrivateKey) []byte {
+	data, err := SignMetadata(payload, keys...)
+	require.NoError(r.t, err)
+	return data
+}
+
+func metaFileFor(version int64, data []byte) MetaFile {
+	sum := sha256.Sum256(data)
+	return MetaFile{Version: version, Length: int64(len(data)), Hashes: map[string]string{"sha256": hex.EncodeToString(sum[:])}}
+}
+
+// publish signs a new targets/snapshot/timestamp chain for binary at version.
+func (r *testRepo) publish(version string, binary []byte, url string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expires := time.Now().Add(r.expiresIn).UTC()
+	sum := sha256.Sum256(binary)
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+
+	r.versions[RoleTargets]++
+	targets := r.sign(TargetsMetadata{
+		Type: RoleTargets, Version: r.versions[RoleTargets], Expires: expires,
+		Targets: map[string]TargetFile{platform: {
+			Length: int64(len(binary)),
+			Hashes: map[string]string{"sha256": hex.EncodeToString(sum[:])},
+			Custom: TargetCustom{Version: version, URL: url},
+		}},
+	}, r.roleKeys[RoleTargets])
+
+	r.versions[RoleSnapshot]++
+	snapshot := r.sign(SnapshotMetadata{
+		Type: RoleSnapshot, Version: r.versions[RoleSnapshot], Expires: expires,
+		Meta: map[string]MetaFile{targetsFile: metaFileFor(r.versions[RoleTargets], targets)},
+	}, r.roleKeys[RoleSnapshot])
+
+	r.versions[RoleTimestamp]++
+	timestamp := r.sign(TimestampMetadata{
+		Type: RoleTimestamp, Version: r.versions[RoleTimestamp], Expires: expires,
+		Meta: map[string]MetaFile{snapshotFile: metaFileFor(r.versions[RoleSnapshot], snapshot)},
+	}, r.roleKeys[RoleTimestamp])
+
+	r.files[targetsFile], r.files[snapshotFile], r.files[timestampFile] = targets, snapshot, timestamp
+}
+
+func (r *testRepo) snapshotFiles() map[string][]byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make(map[string][]byte, len(r.files))
+	for k, v := range r.files {
+		out[k] = v
+	}
+	return out
+}
+
+func (r *testRepo) restore(files map[string][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.files = files
+}
+
+func (r *testRepo) Fetch(ctx context.Context, name string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	data, ok := r.files[name]
+	if !ok {
+		return nil, ErrMetadataNotFound
+	}
+	return data, nil
+}
+
+func (r *testRepo) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, err := r.Fetch(req.Context(), strings.TrimPrefix(req.URL.Path, "/"))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+	_, _ = w.Write(data)
+}
+
+func currentPlatform() string { return runtime.GOOS + "/" + runtime.GOARCH }
+
+func TestMetadataClientUpdateAndPersist(t *testing.T) {
+	repo := newTestRepo(t)
+	binary := []byte("agent v1.1.0")
+	repo.publish("v1.1.0", binary, "https://example.com/agentd")
+	dir := t.TempDir()
+
+	c, err := NewMetadataClient(dir, repo.files["1.root.json"])
+	require.NoError(t, err)
+	require.NoError(t, c.Update(context.Background(), repo))
+
+	release, err := c.Release(currentPlatform(), "")
+	require.NoError(t, err)
+	require.Equal(t, "v1.1.0", release.Version)
+	require.Equal(t, "https://example.com/agentd", release.Artifacts[currentPlatform()].URL)
+	require.NoError(t, c.VerifyTarget(currentPlatform(), binary))
+	require.Error(t, c.VerifyTarget(currentPlatform(), []byte("agent v1.1.X")))
+
+	// A restart keeps the trusted versions without the initial root.
+	reloaded, err := NewMetadataClient(dir, nil)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int64{RoleRoot: 1, RoleTimestamp: 1, RoleSnapshot: 1, RoleTargets: 1}, reloaded.Versions())
+}
+
+func TestMetadataClientRejectsRollback(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.publish("v1.1.0", []byte("old"), "")
+	old := repo.snapshotFiles()
+	repo.publish("v1.2.0", []byte("new"), "")
+	dir := t.TempDir()
+
+	c, err := NewMetadataClient(dir, repo.files["1.root.json"])
+	require.NoError(t, err)
+	require.NoError(t, c.Update(context.Background(), repo))
+
+	// A mirror replaying the older, validly signed release is refused, also
+	// after a restart.
+	repo.restore(old)
+	require.ErrorIs(t, c.Update(context.Background(), repo), ErrMetadataRollback)
+	reloaded, err := NewMetadataClient(dir, nil)
+	require.NoError(t, err)
+	require.ErrorIs(t, reloaded.Update(context.Background(), repo), ErrMetadataRollback)
+}
+
+func TestMetadataClientRejectsExpiredMetadata(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.expiresIn = time.Hour
+	repo.publish("v1.1.0", []byte("bin"), "")
+
+	c, err := NewMetadataClient(t.TempDir(), repo.files["1.root.json"])
+	require.NoError(t, err)
+	c.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	require.ErrorIs(t, c.Update(context.Background(), repo), ErrMetadataExpired)
+}
+
+func TestMetadataClientEnforcesThresholdAndPins(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.root = repo.buildRoot(1, 2)
+	repo.files["1.root.json"] = repo.sign(repo.root, repo.rootKeys...)
+	repo.publish("v1.1.0", []byte("bin"), "")
+
+	c, err := NewMetadataClient(t.TempDir(), repo.files["1.root.json"])
+	require.NoError(t, err)
+	err = c.Update(context.Background(), repo)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "threshold is 2")
+
+	// Tampering with targets breaks the hash pinned in snapshot.
+	repo2 := newTestRepo(t)
+	repo2.publish("v1.1.0", []byte("bin"), "")
+	repo2.files[targetsFile] = append([]byte(" "), repo2.files[targetsFile]...)
+	c2, err := NewMetadataClient(t.TempDir(), repo2.files["1.root.json"])
+	require.NoError(t, err)
+	require.Error(t, c2.Update(context.Background(), repo2))
+
+	_, err = NewMetadataClient(t.TempDir(), repo2.sign(repo2.root, genKey(t)))
+	require.Error(t, err, "initial root must be self-signed")
+}
+
+func TestMetadataClientFollowsRootRotation(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.publish("v1.1.0", []byte("bin"), "")
+	c, err := NewMetadataClient(t.TempDir(), repo.files["1.root.json"])
+	require.NoError(t, err)
+	require.NoError(t, c.Update(context.Background(), repo))
+
+	oldRootKeys := repo.rootKeys
+	repo.rootKeys = []ed25519.PrivateKey{genKey(t)}
+	repo.roleKeys[RoleTimestamp] = genKey(t)
+	repo.root = repo.buildRoot(2, 1)
+
+	// Signed only by the new key: not trusted.
+	repo.files["2.root.json"] = repo.sign(repo.root, repo.rootKeys...)
+	require.Error(t, c.Update(context.Background(), repo))
+
+	// Cross-signed by old and new root keys, with a rotated timestamp key.
+	repo.files["2.root.json"] = repo.sign(repo.root, append(oldRootKeys, repo.rootKeys...)...)
+	repo.publish("v1.2.0", []byte("bin2"), "")
+	require.NoError(t, c.Update(context.Background(), repo))
+	require.Equal(t, int64(2), c.Versions()[RoleRoot])
+
+	bundle := c.Bundle()
+	require.Len(t, bundle.Roots, 2)
+	peerClient, err := NewMetadataClient(t.TempDir(), repo.files["1.root.json"])
+	require.NoError(t, err)
+	require.NoError(t, peerClient.Update(context.Background(), bundle))
+	require.Equal(t, c.Versions(), peerClient.Versions())
+}
+
+func newTUFManager(t *testing.T, repo *testRepo, metadataURL string) *Manager {
+	t.Helper()
+	rootPath := t.TempDir() + "/root.json"
+	require.NoError(t, os.WriteFile(rootPath, repo.files["1.root.json"], 0o600))
+	m, err := NewManager(slog.Default(), Config{
+		ServerURL: "http://unused.invalid/release.json",
+		TUF: TUFConfig{
+			Enabled:         true,
+			MetadataURL:     metadataURL,
+			TrustedRootPath: rootPath,
+			MetadataDir:     t.TempDir(),
+		},
+	}, "v1.0.0")
+	require.NoError(t, err)
+	return m
+}
+
+func TestManagerCheckForUpdateWithTUF(t *testing.T) {
+	origDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() { _ = os.Chdir(origDir) }()
+
+	repo := newTestRepo(t)
+	binary := []byte("agent v1.1.0 binary")
+	mux := http.NewServeMux()
+	mux.Handle("/metadata/", http.StripPrefix("/metadata", repo))
+	mux.HandleFunc("/targets/", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(binary) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	repo.publish("v1.1.0", binary, "")
+	m := newTUFManager(t, repo, srv.URL+"/metadata")
+	m.tuf.TargetsURL = srv.URL + "/targets"
+
+	var result string
+	m.OnCheckComplete = func(r, version string, err error) { result = r }
+	m.CheckForUpdate(context.Background())
+	require.Equal(t, "updated", result)
+	written, err := os.ReadFile("agentd.new")
+	require.NoError(t, err)
+	require.Equal(t, binary, written)
+
+	release, _, err := m.GetCurrentRelease()
+	require.NoError(t, err)
+	require.NotNil(t, release.Metadata)
+}
+
+func TestManagerP2PUpdateVerifiesPeerMetadata(t *testing.T) {
+	origDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() { _ = os.Chdir(origDir) }()
+
+	repo := newTestRepo(t)
+	binary := []byte("agent v1.2.0 binary")
+	repo.publish("v1.2.0", binary, "")
+
+	// The serving peer has verified the metadata against the same root.
+	server, err := NewMetadataClient(t.TempDir(), repo.files["1.root.json"])
+	require.NoError(t, err)
+	require.NoError(t, server.Update(context.Background(), repo))
+
+	m := newTUFManager(t, repo, "http://unused.invalid")
+	p1, p2 := peer.ID("peer-a"), peer.ID("peer-b")
+	mockP2P := new(MockP2PNetwork)
+	mockP2P.On("GetConnectedPeers").Return([]peer.ID{p1, p2})
+	// peer-a lies about the version and sends no metadata; peer-b is honest.
+	mockP2P.On("FetchUpdateFromPeer", mock.Anything, p1, "latest").Return(&ReleaseInfo{Version: "v9.9.9"}, binary, nil)
+	mockP2P.On("FetchUpdateFromPeer", mock.Anything, p2, "latest").Return(&ReleaseInfo{Version: "v9.9.9", Metadata: server.Bundle()}, binary, nil)
+	m.SetP2PNetwork(mockP2P)
+
+	release, data, err := m.checkForP2PUpdate(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.0", release.Version, "version comes from verified targets, not the peer")
+	require.Equal(t, binary, data)
+}
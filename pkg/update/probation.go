@@ -0,0 +1,230 @@
+package update
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Files kept next to agentd.new and agentd.rollback while an update is on
+// probation.
+const (
+	rollbackBinaryName = "agentd.rollback"
+	pendingStateName   = "agentd.pending.json"   // written with agentd.new
+	probationStateName = "agentd.probation.json" // written when agentd.new is applied
+	goodMarkerName     = "agentd.good"           // version that passed probation
+	failedVersionsName = "agentd.failed.json"    // versions that failed probation
+)
+
+// ProbationConfig controls post-update health verification. A freshly
+// applied version must be healthy at the end of Window, and must get there
+// within MaxBoots starts, or the previous binary is restored.
+type ProbationConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Window        time.Duration `yaml:"window"`         // defaults to 5m
+	CheckInterval time.Duration `yaml:"check_interval"` // defaults to 15s
+	MaxBoots      int           `yaml:"max_boots"`      // unconfirmed starts before rolling back, defaults to 3
+}
+
+// WithDefaults fills unset fields.
+func (c ProbationConfig) WithDefaults() ProbationConfig {
+	if c.Window <= 0 {
+		c.Window = 5 * time.Minute
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = 15 * time.Second
+	}
+	if c.MaxBoots <= 0 {
+		c.MaxBoots = 3
+	}
+	return c
+}
+
+// probationState tracks one applied version until it is confirmed good.
+type probationState struct {
+	Version         string    `json:"version"`
+	PreviousVersion string    `json:"previous_version"`
+	MaxBoots        int       `json:"max_boots"`
+	Boots           int       `json:"boots"`
+	AppliedAt       time.Time `json:"applied_at,omitempty"`
+}
+
+// FailedVersion records a release that failed probation and is never
+// installed again.
+type FailedVersion struct {
+	Version  string    `json:"version"`
+	Reason   string    `json:"reason"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+func readProbationState(name string) (*probationState, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var state probationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", name, err)
+	}
+	return &state, nil
+}
+
+func writeProbationState(name string, state *probationState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal probation state: %w", err)
+	}
+	return os.WriteFile(name, data, 0600)
+}
+
+// confirmedVersion returns the version recorded in the good marker.
+func confirmedVersion() string {
+	data, err := os.ReadFile(goodMarkerName)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func sameVersion(a, b string) bool {
+	return ensureSemverPrefix(a) == ensureSemverPrefix(b)
+}
+
+func readFailedVersions() []FailedVersion {
+	data, err := os.ReadFile(failedVersionsName)
+	if err != nil {
+		return nil
+	}
+	var failed []FailedVersion
+	if err := json.Unmarshal(data, &failed); err != nil {
+		return nil
+	}
+	return failed
+}
+
+// recordFailedVersion adds version to the list of versions never retried.
+func recordFailedVersion(version, reason string) error {
+	failed := readFailedVersions()
+	for _, f := range failed {
+		if sameVersion(f.Version, version) {
+			return nil
+		}
+	}
+	failed = append(failed, FailedVersion{Version: version, Reason: reason, FailedAt: time.Now().UTC()})
+	data, err := json.Marshal(failed)
+	if err != nil {
+		return fmt.Errorf("failed to marshal failed versions: %w", err)
+	}
+	return os.WriteFile(failedVersionsName, data, 0600)
+}
+
+// isFailedVersion reports whether version previously failed probation.
+func isFailedVersion(version string) bool {
+	for _, f := range readFailedVersions() {
+		if sameVersion(f.Version, version) {
+			return true
+		}
+	}
+	return false
+}
+
+// FailedVersions returns the versions that failed probation.
+func (m *Manager) FailedVersions() []FailedVersion {
+	return readFailedVersions()
+}
+
+// markPending records that agentd.new holds version so that applying it
+// starts a probation.
+func (m *Manager) markPending(version string) error {
+	if !m.probation.Enabled {
+		return nil
+	}
+	return writeProbationState(pendingStateName, &probationState{
+		Version:         version,
+		PreviousVersion: m.currentVersion,
+		MaxBoots:        m.probation.MaxBoots,
+	})
+}
+
+// StartProbation verifies a freshly applied version. If the running version
+// is on probation, check is polled every
+// CheckInterval; when the Window ends with check passing the version is
+// marked good, otherwise the previous binary is restored and the version is
+// recorded as failed. It returns once the probation is decided or ctx ends.
+func (m *Manager) StartProbation(ctx context.Context, check func() error) {
+	state, err := readProbationState(probationStateName)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			m.logger.Warn("Failed to read probation state", "error", err)
+		}
+		return
+	}
+	if !sameVersion(state.Version, m.currentVersion) {
+		return
+	}
+	if sameVersion(confirmedVersion(), state.Version) {
+		_ = os.Remove(probationStateName)
+		return
+	}
+
+	// ApplyPendingUpdate already counted this start.
+	m.logger.Info("Update on probation", "version", state.Version, "previous_version", state.PreviousVersion, "boot", state.Boots, "max_boots", state.MaxBoots, "window", m.probation.Window)
+
+	window := time.NewTimer(m.probation.Window)
+	defer window.Stop()
+	ticker := time.NewTicker(m.probation.CheckInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if lastErr = check(); lastErr != nil {
+				m.logger.Warn("Health check failing during update probation", "version", state.Version, "error", lastErr)
+			}
+		case <-window.C:
+			if lastErr = check(); lastErr == nil {
+				m.confirmVersion(state.Version)
+				return
+			}
+			m.failProbation(state.Version, lastErr)
+			return
+		}
+	}
+}
+
+// confirmVersion writes the good marker and ends the probation.
+func (m *Manager) confirmVersion(version string) {
+	if err := os.WriteFile(goodMarkerName, []byte(version+"\n"), 0600); err != nil {
+		m.logger.Error("Failed to write update good marker", "error", err)
+		return
+	}
+	_ = os.Remove(probationStateName)
+	m.logger.Info("Update passed probation", "version", version)
+	m.reportCheck("confirmed", version, nil)
+}
+
+// failProbation restores the backup binary, records version as failed and
+// triggers a restart.
+func (m *Manager) failProbation(version string, cause error) {
+	m.logger.Error("Update failed probation, rolling back", "version", version, "error", cause)
+	if err := recordFailedVersion(version, cause.Error()); err != nil {
+		m.logger.Error("Failed to record failed version", "version", version, "error", err)
+	}
+	_ = os.Remove(probationStateName)
+	if err := m.Rollback(); err != nil {
+		m.logger.Error("Failed to roll back update", "error", err)
+		m.reportCheck("error", version, err)
+		return
+	}
+	m.reportCheck("rolled_back", version, fmt.Errorf("failed probation: %w", cause))
+	if m.OnUpdateReady != nil {
+		m.OnUpdateReady()
+	}
+}
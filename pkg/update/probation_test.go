@@ -0,0 +1,153 @@
+package update
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// inTempDir runs the test from a fresh working directory, where the update
+// files live.
+func inTempDir(t *testing.T) {
+	t.Helper()
+	origDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	t.Cleanup(func() { _ = os.Chdir(origDir) })
+}
+
+// stubSelfUpdate records applied binaries and restarts instead of replacing
+// the test executable.
+func stubSelfUpdate(t *testing.T) (applied *[][]byte, restarts *int) {
+	t.Helper()
+	applied, restarts = new([][]byte), new(int)
+	origApply, origRestart := applyBinary, restartProcess
+	applyBinary = func(r io.Reader) error {
+		data, err := io.ReadAll(r)
+		*applied = append(*applied, data)
+		return err
+	}
+	restartProcess = func() error {
+		*restarts++
+		return nil
+	}
+	t.Cleanup(func() { applyBinary, restartProcess = origApply, origRestart })
+	return applied, restarts
+}
+
+func newProbationManager(t *testing.T, version string) *Manager {
+	t.Helper()
+	m, err := NewManager(slog.Default(), Config{
+		PublicKey: "0000000000000000000000000000000000000000000000000000000000000000",
+		Probation: ProbationConfig{Enabled: true, Window: 50 * time.Millisecond, CheckInterval: 10 * time.Millisecond},
+	}, version)
+	require.NoError(t, err)
+	return m
+}
+
+func TestApplyPendingUpdateStartsProbation(t *testing.T) {
+	inTempDir(t)
+	applied, restarts := stubSelfUpdate(t)
+
+	require.NoError(t, os.WriteFile(newBinaryName, []byte("v1.2.0 binary"), 0o755))
+	require.NoError(t, newProbationManager(t, "v1.1.0").markPending("v1.2.0"))
+
+	ApplyPendingUpdate()
+	require.Equal(t, [][]byte{[]byte("v1.2.0 binary")}, *applied)
+	require.Equal(t, 1, *restarts)
+	require.NoFileExists(t, newBinaryName)
+	require.NoFileExists(t, pendingStateName)
+
+	state, err := readProbationState(probationStateName)
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.0", state.Version)
+	require.Equal(t, "v1.1.0", state.PreviousVersion)
+	require.Equal(t, 3, state.MaxBoots)
+	require.Zero(t, state.Boots)
+
+	// A restored rollback binary is applied without probation.
+	require.NoError(t, os.Remove(probationStateName))
+	require.NoError(t, os.WriteFile(newBinaryName, []byte("v1.1.0 binary"), 0o755))
+	ApplyPendingUpdate()
+	require.Equal(t, 2, *restarts)
+	require.NoFileExists(t, probationStateName)
+}
+
+func TestStartProbationConfirmsHealthyVersion(t *testing.T) {
+	inTempDir(t)
+	require.NoError(t, writeProbationState(probationStateName, &probationState{Version: "v1.2.0", PreviousVersion: "v1.1.0", MaxBoots: 3}))
+
+	// The previous binary, still running after the swap, leaves the probation alone.
+	old := newProbationManager(t, "v1.1.0")
+	old.StartProbation(context.Background(), func() error { return errors.New("unused") })
+	state, err := readProbationState(probationStateName)
+	require.NoError(t, err)
+	require.Zero(t, state.Boots)
+
+	m := newProbationManager(t, "1.2.0")
+	var results []string
+	m.OnCheckComplete = func(result, version string, err error) { results = append(results, result) }
+	m.StartProbation(context.Background(), func() error { return nil })
+
+	require.Equal(t, []string{"confirmed"}, results)
+	require.Equal(t, "v1.2.0", confirmedVersion())
+	require.NoFileExists(t, probationStateName)
+	ApplyPendingUpdate()
+	require.Empty(t, m.FailedVersions())
+}
+
+func TestStartProbationRollsBackUnhealthyVersion(t *testing.T) {
+	inTempDir(t)
+	require.NoError(t, os.WriteFile(rollbackBinaryName, []byte("v1.1.0 binary"), 0o755))
+	require.NoError(t, writeProbationState(probationStateName, &probationState{Version: "v1.2.0", PreviousVersion: "v1.1.0", MaxBoots: 3}))
+
+	m := newProbationManager(t, "v1.2.0")
+	var results []string
+	var lastErr error
+	m.OnCheckComplete = func(result, version string, err error) { results, lastErr = append(results, result), err }
+	restarts := 0
+	m.OnUpdateReady = func() { restarts++ }
+	m.StartProbation(context.Background(), func() error { return errors.New("failing health checks: p2p") })
+
+	require.Equal(t, []string{"rolled_back"}, results)
+	require.ErrorContains(t, lastErr, "failing health checks: p2p")
+	require.Equal(t, 1, restarts)
+	restored, err := os.ReadFile(newBinaryName)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1.1.0 binary"), restored)
+	require.NoFileExists(t, probationStateName)
+
+	failed := m.FailedVersions()
+	require.Len(t, failed, 1)
+	require.Equal(t, "v1.2.0", failed[0].Version)
+	require.True(t, isFailedVersion("1.2.0"))
+}
+
+func TestApplyPendingUpdateRollsBackCrashLoop(t *testing.T) {
+	inTempDir(t)
+	applied, restarts := stubSelfUpdate(t)
+	require.NoError(t, os.WriteFile(rollbackBinaryName, []byte("v1.1.0 binary"), 0o755))
+	require.NoError(t, writeProbationState(probationStateName, &probationState{Version: "v1.2.0", PreviousVersion: "v1.1.0", MaxBoots: 2}))
+
+	// The new version crashes before the runtime starts, so StartProbation
+	// never runs. Each process start still calls ApplyPendingUpdate first.
+	for boot := 1; boot <= 2; boot++ {
+		ApplyPendingUpdate()
+		require.Empty(t, *applied, "start %d is within max_boots", boot)
+		state, err := readProbationState(probationStateName)
+		require.NoError(t, err)
+		require.Equal(t, boot, state.Boots)
+	}
+
+	ApplyPendingUpdate()
+	require.Equal(t, [][]byte{[]byte("v1.1.0 binary")}, *applied)
+	require.Equal(t, 1, *restarts)
+	require.NoFileExists(t, probationStateName)
+	require.True(t, isFailedVersion("v1.2.0"))
+}
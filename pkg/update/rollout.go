@@ -0,0 +1,490 @@
+package update
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"golang.org/x/mod/semver"
+)
+
+// ErrNotCoordinator is returned by Coordinate on an agent that cannot sign
+// plans the fleet accepts.
+var ErrNotCoordinator = errors.New("agent is not a rollout coordinator")
+
+// Release channels, from earliest to most conservative. An agent follows its
+// own channel and every more conservative one: canary agents take beta and
+// stable releases too, stable agents take only stable releases.
+const (
+	ChannelCanary = "canary"
+	ChannelBeta   = "beta"
+	ChannelStable = "stable"
+)
+
+// Rollout plan states.
+const (
+	RolloutActive   = "active"
+	RolloutHalted   = "halted"
+	RolloutComplete = "complete"
+)
+
+const (
+	rolloutKeyPrefix = "update/rollout/"
+	rolloutPlanTTL   = 7 * 24 * time.Hour
+	rolloutRefresh   = 24 * time.Hour
+)
+
+// RolloutConfig controls staged rollouts. With rollout disabled every agent
+// upgrades as soon as it sees a newer release.
+type RolloutConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Channel          string        `yaml:"channel"`           // canary | beta | stable, defaults to stable
+	Waves            []int         `yaml:"waves"`             // cumulative fleet percentages, defaults to 5, 25, 50, 100
+	WaveInterval     time.Duration `yaml:"wave_interval"`     // soak time before the next wave, defaults to 1h
+	PollInterval     time.Duration `yaml:"poll_interval"`     // how often plans are coordinated and enforced, defaults to 1m
+	MinReports       int           `yaml:"min_reports"`       // upgraded nodes needed before a wave is judged, defaults to 1
+	FailureThreshold float64       `yaml:"failure_threshold"` // unhealthy fraction of upgraded nodes that halts the rollout, defaults to 0.2
+	AutoRollback     bool          `yaml:"auto_rollback"`     // upgraded nodes restore the previous binary when a rollout halts
+	// Coordinators lists the peer IDs whose signed plans are accepted.
+	// Plans from anyone else are ignored, since the control plane does not
+	// authenticate writers.
+	Coordinators []string `yaml:"coordinators"`
+	// ReportPeers lists peers whose fleet health reports count towards a
+	// halt, besides admitted peers. Anyone can publish a fleet status, so
+	// reports from other peers are ignored.
+	ReportPeers []string `yaml:"report_peers"`
+}
+
+// WithDefaults fills unset fields.
+func (c RolloutConfig) WithDefaults() RolloutConfig {
+	if c.Channel == "" {
+		c.Channel = ChannelStable
+	}
+	if len(c.Waves) == 0 {
+		c.Waves = []int{5, 25, 50, 100}
+	}
+	if c.WaveInterval <= 0 {
+		c.WaveInterval = time.Hour
+	}
+	if c.PollInterval <= 0 {
+		c.PollInterval = time.Minute
+	}
+	if c.MinReports <= 0 {
+		c.MinReports = 1
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 0.2
+	}
+	return c
+}
+
+// Validate checks the channel and wave schedule.
+func (c RolloutConfig) Validate() error {
+	c = c.WithDefaults()
+	if channelRank(c.Channel) < 0 {
+		return fmt.Errorf("unknown release channel %q", c.Channel)
+	}
+	prev := 0
+	for _, p := range c.Waves {
+		if p <= prev || p > 100 {
+			return fmt.Errorf("rollout waves must be increasing percentages between 1 and 100, got %v", c.Waves)
+		}
+		prev = p
+	}
+	if prev != 100 {
+		return fmt.Errorf("last rollout wave must be 100, got %d", prev)
+	}
+	if c.FailureThreshold > 1 {
+		return fmt.Errorf("failure_threshold must be a fraction between 0 and 1")
+	}
+	if c.Enabled && len(c.Coordinators) == 0 {
+		return fmt.Errorf("staged rollouts need at least one coordinator peer ID")
+	}
+	for _, id := range c.Coordinators {
+		if _, err := peer.Decode(id); err != nil {
+			return fmt.Errorf("invalid coordinator peer ID %q: %w", id, err)
+		}
+	}
+	for _, id := range c.ReportPeers {
+		if _, err := peer.Decode(id); err != nil {
+			return fmt.Errorf("invalid report peer ID %q: %w", id, err)
+		}
+	}
+	return nil
+}
+
+func channelRank(channel string) int {
+	switch channel {
+	case ChannelCanary:
+		return 0
+	case ChannelBeta:
+		return 1
+	case ChannelStable, "":
+		return 2
+	default:
+		return -1
+	}
+}
+
+// ChannelAccepts reports whether an agent on channel follows a release
+// published to releaseChannel. Releases without a channel are stable.
+func ChannelAccepts(channel, releaseChannel string) bool {
+	rank := channelRank(releaseChannel)
+	return rank >= 0 && rank >= channelRank(channel)
+}
+
+// Bucket places peerID in one of 100 rollout buckets for version. The
+// release version salts the hash so the same agents are not always first.
+func Bucket(peerID, version string) int {
+	sum := sha256.Sum256([]byte(peerID + "\x00" + ensureSemverPrefix(version)))
+	return int(binary.BigEndian.Uint64(sum[:8]) % 100)
+}
+
+// RolloutKey is the control plane key holding the plan for version.
+func RolloutKey(version string) string {
+	return rolloutKeyPrefix + ensureSemverPrefix(version)
+}
+
+// RolloutPlan is the fleet-wide state of one release's rollout.
+type RolloutPlan struct {
+	Version     string    `json:"version"`
+	Wave        int       `json:"wave"`    // index into the configured waves
+	Percent     int       `json:"percent"` // agents in buckets below Percent may upgrade
+	State       string    `json:"state"`
+	Reason      string    `json:"reason,omitempty"`
+	Rollback    bool      `json:"rollback,omitempty"` // upgraded agents should restore the previous binary
+	WaveStarted time.Time `json:"wave_started"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// SignedRolloutPlan is a plan with the coordinator's signature over its
+// JSON encoding. It is what the control plane stores.
+type SignedRolloutPlan struct {
+	Plan      RolloutPlan `json:"plan"`
+	Signer    string      `json:"signer"`
+	Signature []byte      `json:"signature"`
+}
+
+// Verify checks the signature against the public key embedded in Signer.
+func (s *SignedRolloutPlan) Verify() error {
+	id, err := peer.Decode(s.Signer)
+	if err != nil {
+		return fmt.Errorf("invalid signer: %w", err)
+	}
+	pub, err := id.ExtractPublicKey()
+	if err != nil {
+		return fmt.Errorf("signer has no embedded public key: %w", err)
+	}
+	data, err := json.Marshal(s.Plan)
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(data, s.Signature)
+	if err != nil {
+		return fmt.Errorf("verify signature: %w", err)
+	}
+	if !ok {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// NodeReport is one agent's version and health as seen by the coordinator.
+type NodeReport struct {
+	PeerID  string
+	Version string
+	Healthy bool
+}
+
+// RolloutStore holds rollout plans. The decentralized control plane
+// implements it, so plans reach every agent through gossip.
+type RolloutStore interface {
+	Get(key string) ([]byte, bool)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// RolloutState keeps the newest plan accepted for each version across
+// restarts. The agent state store implements it.
+type RolloutState interface {
+	Get(key string, value interface{}) error
+	SetAndSave(key string, value interface{}) error
+}
+
+// Rollout gates upgrades on a staged rollout plan and, on the coordinating
+// agent, advances or halts the plan from fleet health reports.
+type Rollout struct {
+	logger *slog.Logger
+	cfg    RolloutConfig
+	self   string
+	store  RolloutStore
+	key    crypto.PrivKey
+	signer string
+	now    func() time.Time
+
+	mu     sync.Mutex
+	state  RolloutState
+	latest map[string]RolloutPlan // newest accepted plan per version
+}
+
+// NewRollout creates a rollout gate for the agent identified by self.
+func NewRollout(logger *slog.Logger, cfg RolloutConfig, self string, store RolloutStore) *Rollout {
+	return &Rollout{
+		logger: logger,
+		cfg:    cfg.WithDefaults(),
+		self:   self,
+		store:  store,
+		now:    time.Now,
+		latest: make(map[string]RolloutPlan),
+	}
+}
+
+// SetState sets where the newest accepted plans are kept, so that a
+// restarted agent still refuses plans older than those it has seen.
+func (r *Rollout) SetState(state RolloutState) {
+	r.mu.Lock()
+	r.state = state
+	r.mu.Unlock()
+}
+
+// SetSigningKey sets the key this agent signs plans with. Coordinate only
+// works when the key's peer ID is a configured coordinator.
+func (r *Rollout) SetSigningKey(key crypto.PrivKey) error {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("derive signer peer ID: %w", err)
+	}
+	r.key = key
+	r.signer = id.String()
+	return nil
+}
+
+// IsCoordinator reports whether this agent can sign plans the fleet accepts.
+func (r *Rollout) IsCoordinator() bool {
+	return r.key != nil && r.trusted(r.signer)
+}
+
+// ShouldCoordinate reports whether this agent should coordinate now: it is
+// a coordinator and either leads the fleet or is the only coordinator.
+func (r *Rollout) ShouldCoordinate(leader bool) bool {
+	return r.IsCoordinator() && (leader || len(r.cfg.Coordinators) == 1)
+}
+
+func (r *Rollout) trusted(signer string) bool {
+	for _, id := range r.cfg.Coordinators {
+		if id == signer {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan returns the plan for version, if any. Plans that are not signed by a
+// configured coordinator are ignored. Since any peer can republish a signed
+// plan, a plan is only accepted if it was updated after the newest one seen
+// for version; otherwise that newest plan is returned.
+func (r *Rollout) Plan(version string) (*RolloutPlan, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	known, haveKnown := r.knownPlan(version)
+	plan, ok := r.publishedPlan(version)
+	switch {
+	case ok && (!haveKnown || plan.UpdatedAt.After(known.UpdatedAt)):
+		r.remember(version, *plan)
+		return plan, true
+	case ok && plan.UpdatedAt.Before(known.UpdatedAt):
+		r.logger.Warn("Ignoring rollout plan older than one already seen", "version", version, "updated_at", plan.UpdatedAt, "newest", known.UpdatedAt)
+	}
+	if !haveKnown {
+		return nil, false
+	}
+	return &known, true
+}
+
+// knownPlan returns the newest plan accepted for version. r.mu must be held.
+func (r *Rollout) knownPlan(version string) (RolloutPlan, bool) {
+	key := ensureSemverPrefix(version)
+	if plan, ok := r.latest[key]; ok {
+		return plan, true
+	}
+	if r.state == nil {
+		return RolloutPlan{}, false
+	}
+	var plan RolloutPlan
+	if err := r.state.Get(RolloutKey(version), &plan); err != nil {
+		return RolloutPlan{}, false
+	}
+	r.latest[key] = plan
+	return plan, true
+}
+
+// remember records plan as the newest accepted for version. r.mu must be
+// held.
+func (r *Rollout) remember(version string, plan RolloutPlan) {
+	r.latest[ensureSemverPrefix(version)] = plan
+	if r.state == nil {
+		return
+	}
+	if err := r.state.SetAndSave(RolloutKey(version), plan); err != nil {
+		r.logger.Warn("Failed to persist rollout plan", "version", version, "error", err)
+	}
+}
+
+// publishedPlan returns the plan for version on the control plane, if it is
+// signed by a configured coordinator.
+func (r *Rollout) publishedPlan(version string) (*RolloutPlan, bool) {
+	data, ok := r.store.Get(RolloutKey(version))
+	if !ok {
+		return nil, false
+	}
+	var signed SignedRolloutPlan
+	if err := json.Unmarshal(data, &signed); err != nil {
+		r.logger.Warn("Ignoring malformed rollout plan", "version", version, "error", err)
+		return nil, false
+	}
+	if !r.trusted(signed.Signer) {
+		r.logger.Warn("Ignoring rollout plan from untrusted signer", "version", version, "signer", signed.Signer)
+		return nil, false
+	}
+	if err := signed.Verify(); err != nil {
+		r.logger.Warn("Ignoring rollout plan with bad signature", "version", version, "signer", signed.Signer, "error", err)
+		return nil, false
+	}
+	if semver.Compare(ensureSemverPrefix(signed.Plan.Version), ensureSemverPrefix(version)) != 0 {
+		r.logger.Warn("Ignoring rollout plan for another version", "version", version, "plan_version", signed.Plan.Version)
+		return nil, false
+	}
+	return &signed.Plan, true
+}
+
+// Admit reports whether this agent may install release now, and why not.
+// Canary-channel agents take a release as soon as it is published unless
+// its rollout was halted; other agents wait until their bucket is inside
+// the current wave.
+func (r *Rollout) Admit(release *ReleaseInfo) (bool, string) {
+	if !ChannelAccepts(r.cfg.Channel, release.Channel) {
+		return false, fmt.Sprintf("release channel %q is not followed by channel %q", release.Channel, r.cfg.Channel)
+	}
+	plan, ok := r.Plan(release.Version)
+	if ok && plan.State == RolloutHalted {
+		return false, fmt.Sprintf("rollout halted: %s", plan.Reason)
+	}
+	if r.cfg.Channel == ChannelCanary {
+		return true, ""
+	}
+	if !ok {
+		return false, "waiting for rollout plan"
+	}
+	if bucket := Bucket(r.self, release.Version); bucket >= plan.Percent {
+		return false, fmt.Sprintf("bucket %d is outside wave %d (%d%%)", bucket, plan.Wave+1, plan.Percent)
+	}
+	return true, ""
+}
+
+// ShouldRollBack reports whether the plan for version was halted with
+// rollback requested.
+func (r *Rollout) ShouldRollBack(version string) (bool, string) {
+	plan, ok := r.Plan(version)
+	if !ok || plan.State != RolloutHalted || !plan.Rollback {
+		return false, ""
+	}
+	return true, plan.Reason
+}
+
+// Coordinate creates the plan for version if none exists, then halts it
+// when too many upgraded agents are unhealthy or moves it to the next wave
+// once the current one has soaked for WaveInterval. Only one agent (the
+// fleet leader) should coordinate. It returns the resulting plan and
+// whether it changed. It fails with ErrNotCoordinator unless IsCoordinator.
+func (r *Rollout) Coordinate(ctx context.Context, version string, reports []NodeReport) (*RolloutPlan, bool, error) {
+	if !r.IsCoordinator() {
+		return nil, false, ErrNotCoordinator
+	}
+	now := r.now().UTC()
+	plan, ok := r.Plan(version)
+	changed := false
+	if !ok {
+		plan = &RolloutPlan{
+			Version:     version,
+			Percent:     r.cfg.Waves[0],
+			State:       RolloutActive,
+			WaveStarted: now,
+		}
+		changed = true
+	}
+
+	if plan.State == RolloutActive && !changed {
+		target := ensureSemverPrefix(version)
+		upgraded, unhealthy := 0, 0
+		for _, n := range reports {
+			if semver.Compare(ensureSemverPrefix(n.Version), target) != 0 {
+				continue
+			}
+			upgraded++
+			if !n.Healthy {
+				unhealthy++
+			}
+		}
+
+		switch {
+		case upgraded >= r.cfg.MinReports && float64(unhealthy)/float64(upgraded) > r.cfg.FailureThreshold:
+			plan.State = RolloutHalted
+			plan.Rollback = r.cfg.AutoRollback
+			plan.Reason = fmt.Sprintf("%d of %d upgraded agents unhealthy", unhealthy, upgraded)
+			changed = true
+		case now.Sub(plan.WaveStarted) >= r.cfg.WaveInterval:
+			if plan.Wave+1 < len(r.cfg.Waves) {
+				plan.Wave++
+				plan.Percent = r.cfg.Waves[plan.Wave]
+				plan.WaveStarted = now
+			} else {
+				plan.State = RolloutComplete
+			}
+			changed = true
+		}
+	}
+
+	if !changed && now.Sub(plan.UpdatedAt) < rolloutRefresh {
+		return plan, false, nil
+	}
+	// Agents refuse plans that are not newer than the last one they saw,
+	// so never go back in time, even if this coordinator's clock is behind.
+	if !now.After(plan.UpdatedAt) {
+		now = plan.UpdatedAt.Add(time.Millisecond)
+	}
+	plan.UpdatedAt = now
+	data, err := r.sign(*plan)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := r.store.Set(ctx, RolloutKey(version), data, rolloutPlanTTL); err != nil {
+		return nil, false, fmt.Errorf("failed to publish rollout plan: %w", err)
+	}
+	r.mu.Lock()
+	r.remember(version, *plan)
+	r.mu.Unlock()
+	if changed {
+		r.logger.Info("Rollout plan updated", "version", version, "state", plan.State, "wave", plan.Wave+1, "percent", plan.Percent, "reason", plan.Reason)
+	}
+	return plan, changed, nil
+}
+
+// sign encodes plan as a SignedRolloutPlan.
+func (r *Rollout) sign(plan RolloutPlan) ([]byte, error) {
+	payload, err := json.Marshal(plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rollout plan: %w", err)
+	}
+	sig, err := r.key.Sign(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign rollout plan: %w", err)
+	}
+	return json.Marshal(SignedRolloutPlan{Plan: plan, Signer: r.signer, Signature: sig})
+}
@@ -0,0 +1,388 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p/core/crypto"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+type memoryStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemoryStore() *memoryStore { return &memoryStore{data: map[string][]byte{}} }
+
+func (s *memoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok
+}
+
+func (s *memoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	return nil
+}
+
+// memoryState is an in-memory RolloutState.
+type memoryState struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func newMemoryState() *memoryState { return &memoryState{data: map[string][]byte{}} }
+
+func (s *memoryState) Get(key string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	raw, ok := s.data[key]
+	if !ok {
+		return fmt.Errorf("key %q not found", key)
+	}
+	return json.Unmarshal(raw, value)
+}
+
+func (s *memoryState) SetAndSave(key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = raw
+	return nil
+}
+
+// peerInBucket returns a peer ID whose bucket for version satisfies want.
+func peerInBucket(t *testing.T, version string, want func(int) bool) string {
+	t.Helper()
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("peer-%d", i)
+		if want(Bucket(id, version)) {
+			return id
+		}
+	}
+	t.Fatal("no peer found for bucket")
+	return ""
+}
+
+// rolloutKey returns a fresh identity key and its peer ID.
+func rolloutKey(t *testing.T) (crypto.PrivKey, string) {
+	t.Helper()
+	priv, _, err := crypto.GenerateEd25519Key(nil)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	return priv, id.String()
+}
+
+// newCoordinator returns a rollout that signs plans, with cfg changed to
+// trust it. Pass the returned config to the agents that read its plans.
+func newCoordinator(t *testing.T, cfg RolloutConfig, store RolloutStore) (*Rollout, RolloutConfig) {
+	t.Helper()
+	key, id := rolloutKey(t)
+	cfg.Coordinators = []string{id}
+	r := NewRollout(slog.Default(), cfg, id, store)
+	require.NoError(t, r.SetSigningKey(key))
+	return r, cfg
+}
+
+func TestRolloutConfigValidate(t *testing.T) {
+	require.NoError(t, RolloutConfig{}.Validate())
+	require.Error(t, RolloutConfig{Channel: "nightly"}.Validate())
+	require.Error(t, RolloutConfig{Waves: []int{10, 5, 100}}.Validate())
+	require.Error(t, RolloutConfig{Waves: []int{10, 50}}.Validate())
+	require.Error(t, RolloutConfig{FailureThreshold: 1.5}.Validate())
+}
+
+func TestChannelAcceptsAndBucket(t *testing.T) {
+	require.True(t, ChannelAccepts(ChannelCanary, ChannelBeta))
+	require.True(t, ChannelAccepts(ChannelBeta, ""))
+	require.False(t, ChannelAccepts(ChannelStable, ChannelBeta))
+	require.False(t, ChannelAccepts(ChannelCanary, "nightly"))
+
+	require.Equal(t, Bucket("peer-a", "1.2.0"), Bucket("peer-a", "v1.2.0"))
+	counts := make([]int, 4)
+	for i := 0; i < 4000; i++ {
+		b := Bucket(fmt.Sprintf("peer-%d", i), "v1.2.0")
+		require.True(t, b >= 0 && b < 100)
+		counts[b/25]++
+	}
+	for _, c := range counts {
+		require.InDelta(t, 1000, c, 150, "buckets should be roughly uniform")
+	}
+}
+
+func TestRolloutAdmitFollowsPlan(t *testing.T) {
+	store := newMemoryStore()
+	coordinator, cfg := newCoordinator(t, RolloutConfig{Waves: []int{10, 100}, WaveInterval: time.Hour}, store)
+	release := &ReleaseInfo{Version: "v1.2.0"}
+
+	early := NewRollout(slog.Default(), cfg, peerInBucket(t, release.Version, func(b int) bool { return b < 10 }), store)
+	late := NewRollout(slog.Default(), cfg, peerInBucket(t, release.Version, func(b int) bool { return b >= 10 }), store)
+	canary := NewRollout(slog.Default(), RolloutConfig{Channel: ChannelCanary, Coordinators: cfg.Coordinators}, "canary", store)
+
+	ok, reason := early.Admit(release)
+	require.False(t, ok)
+	require.Equal(t, "waiting for rollout plan", reason)
+	ok, _ = canary.Admit(release)
+	require.True(t, ok, "canary channel does not wait for a plan")
+	ok, _ = late.Admit(&ReleaseInfo{Version: "v1.2.0", Channel: ChannelBeta})
+	require.False(t, ok, "stable agents skip beta releases")
+
+	plan, changed, err := coordinator.Coordinate(context.Background(), release.Version, nil)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, 10, plan.Percent)
+
+	ok, _ = early.Admit(release)
+	require.True(t, ok)
+	ok, reason = late.Admit(release)
+	require.False(t, ok)
+	require.Contains(t, reason, "outside wave 1")
+}
+
+func TestRolloutCoordinateAdvancesAndCompletes(t *testing.T) {
+	store := newMemoryStore()
+	r, _ := newCoordinator(t, RolloutConfig{Waves: []int{10, 100}, WaveInterval: time.Hour}, store)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+	ctx := context.Background()
+	healthy := []NodeReport{{PeerID: "a", Version: "1.2.0", Healthy: true}, {PeerID: "b", Version: "v1.1.0", Healthy: false}}
+
+	_, _, err := r.Coordinate(ctx, "v1.2.0", healthy)
+	require.NoError(t, err)
+
+	now = now.Add(30 * time.Minute)
+	plan, changed, err := r.Coordinate(ctx, "v1.2.0", healthy)
+	require.NoError(t, err)
+	require.False(t, changed, "wave has not soaked yet")
+	require.Equal(t, 0, plan.Wave)
+
+	now = now.Add(time.Hour)
+	plan, changed, err = r.Coordinate(ctx, "v1.2.0", healthy)
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, 100, plan.Percent)
+	require.Equal(t, RolloutActive, plan.State)
+
+	now = now.Add(time.Hour)
+	plan, _, err = r.Coordinate(ctx, "v1.2.0", healthy)
+	require.NoError(t, err)
+	require.Equal(t, RolloutComplete, plan.State)
+
+	stored, ok := r.Plan("1.2.0")
+	require.True(t, ok)
+	require.Equal(t, RolloutComplete, stored.State)
+}
+
+func TestRolloutCoordinateHaltsOnUnhealthyUpgrades(t *testing.T) {
+	store := newMemoryStore()
+	r, cfg := newCoordinator(t, RolloutConfig{MinReports: 2, FailureThreshold: 0.4, AutoRollback: true}, store)
+	ctx := context.Background()
+
+	_, _, err := r.Coordinate(ctx, "v1.2.0", nil)
+	require.NoError(t, err)
+
+	// A single failing upgraded node is below MinReports.
+	plan, changed, err := r.Coordinate(ctx, "v1.2.0", []NodeReport{{PeerID: "a", Version: "v1.2.0"}})
+	require.NoError(t, err)
+	require.False(t, changed)
+	require.Equal(t, RolloutActive, plan.State)
+
+	plan, changed, err = r.Coordinate(ctx, "v1.2.0", []NodeReport{
+		{PeerID: "a", Version: "v1.2.0"},
+		{PeerID: "b", Version: "v1.2.0", Healthy: true},
+		{PeerID: "c", Version: "v1.1.0", Healthy: false},
+	})
+	require.NoError(t, err)
+	require.True(t, changed)
+	require.Equal(t, RolloutHalted, plan.State)
+	require.Equal(t, "1 of 2 upgraded agents unhealthy", plan.Reason)
+
+	rollback, _ := r.ShouldRollBack("v1.2.0")
+	require.True(t, rollback)
+	ok, reason := NewRollout(slog.Default(), RolloutConfig{Channel: ChannelCanary, Coordinators: cfg.Coordinators}, "x", store).Admit(&ReleaseInfo{Version: "v1.2.0"})
+	require.False(t, ok)
+	require.Contains(t, reason, "rollout halted")
+}
+
+func TestRolloutIgnoresUnauthenticatedPlans(t *testing.T) {
+	store := newMemoryStore()
+	coordinator, cfg := newCoordinator(t, RolloutConfig{AutoRollback: true}, store)
+	agent := NewRollout(slog.Default(), cfg, peerInBucket(t, "v1.2.0", func(b int) bool { return b >= 5 }), store)
+	ctx := context.Background()
+
+	halted := RolloutPlan{Version: "v1.2.0", Percent: 100, State: RolloutHalted, Rollback: true, Reason: "forged"}
+	unsigned, err := json.Marshal(halted)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, RolloutKey("v1.2.0"), unsigned, 0))
+	_, ok := agent.Plan("v1.2.0")
+	require.False(t, ok, "a bare plan is not authenticated")
+
+	// Any agent can sign, but only configured coordinators are trusted.
+	outsider, _ := newCoordinator(t, RolloutConfig{}, store)
+	forged, err := outsider.sign(halted)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, RolloutKey("v1.2.0"), forged, 0))
+	rollback, _ := agent.ShouldRollBack("v1.2.0")
+	require.False(t, rollback)
+
+	// A trusted plan that was altered after signing.
+	_, _, err = coordinator.Coordinate(ctx, "v1.2.0", nil)
+	require.NoError(t, err)
+	data, _ := store.Get(RolloutKey("v1.2.0"))
+	var signed SignedRolloutPlan
+	require.NoError(t, json.Unmarshal(data, &signed))
+	signed.Plan.Percent = 100
+	tampered, err := json.Marshal(signed)
+	require.NoError(t, err)
+	require.NoError(t, store.Set(ctx, RolloutKey("v1.2.0"), tampered, 0))
+	ok, reason := agent.Admit(&ReleaseInfo{Version: "v1.2.0"})
+	require.False(t, ok)
+	require.Equal(t, "waiting for rollout plan", reason)
+
+	// A trusted plan replayed under another version's key.
+	require.NoError(t, store.Set(ctx, RolloutKey("v1.3.0"), data, 0))
+	_, ok = agent.Plan("v1.3.0")
+	require.False(t, ok)
+
+	_, _, err = agent.Coordinate(ctx, "v1.2.0", nil)
+	require.ErrorIs(t, err, ErrNotCoordinator)
+	require.False(t, agent.ShouldCoordinate(true))
+	require.True(t, coordinator.ShouldCoordinate(false), "a sole coordinator does not need to lead")
+}
+
+func TestRolloutRefusesReplayedOlderPlans(t *testing.T) {
+	store := newMemoryStore()
+	coordinator, cfg := newCoordinator(t, RolloutConfig{MinReports: 1, AutoRollback: true}, store)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	coordinator.now = func() time.Time { return now }
+	self := peerInBucket(t, "v1.2.0", func(b int) bool { return b < 5 })
+	state := newMemoryState()
+	agent := NewRollout(slog.Default(), cfg, self, store)
+	agent.SetState(state)
+	ctx := context.Background()
+
+	_, _, err := coordinator.Coordinate(ctx, "v1.2.0", nil)
+	require.NoError(t, err)
+	active, _ := store.Get(RolloutKey("v1.2.0"))
+	ok, _ := agent.Admit(&ReleaseInfo{Version: "v1.2.0"})
+	require.True(t, ok)
+
+	now = now.Add(time.Minute)
+	plan, _, err := coordinator.Coordinate(ctx, "v1.2.0", []NodeReport{{PeerID: "a", Version: "v1.2.0"}})
+	require.NoError(t, err)
+	require.Equal(t, RolloutHalted, plan.State)
+	rollback, _ := agent.ShouldRollBack("v1.2.0")
+	require.True(t, rollback)
+
+	// Any peer can republish the older, validly signed active plan.
+	require.NoError(t, store.Set(ctx, RolloutKey("v1.2.0"), active, 0))
+	ok, reason := agent.Admit(&ReleaseInfo{Version: "v1.2.0"})
+	require.False(t, ok)
+	require.Contains(t, reason, "rollout halted")
+	rollback, _ = agent.ShouldRollBack("v1.2.0")
+	require.True(t, rollback)
+
+	// The newest plan seen survives a restart.
+	restarted := NewRollout(slog.Default(), cfg, self, store)
+	restarted.SetState(state)
+	ok, reason = restarted.Admit(&ReleaseInfo{Version: "v1.2.0"})
+	require.False(t, ok)
+	require.Contains(t, reason, "rollout halted")
+
+	// The coordinator keeps publishing from the halted plan, too.
+	now = now.Add(48 * time.Hour)
+	plan, _, err = coordinator.Coordinate(ctx, "v1.2.0", nil)
+	require.NoError(t, err)
+	require.Equal(t, RolloutHalted, plan.State)
+}
+
+func TestManagerDefersAndRollsBackWithRollout(t *testing.T) {
+	origDir, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() { _ = os.Chdir(origDir) }()
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	binary := []byte("agent v1.2.0")
+	sum := sha256.Sum256(binary)
+	var srvURL string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/bin" {
+			_, _ = w.Write(binary)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(ReleaseInfo{
+			Version: "v1.2.0",
+			Artifacts: map[string]ArtifactInfo{runtime.GOOS + "/" + runtime.GOARCH: {
+				URL: srvURL + "/bin", Signature: hex.EncodeToString(ed25519.Sign(priv, sum[:])),
+			}},
+		})
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	m, err := NewManager(slog.Default(), Config{ServerURL: srv.URL, PublicKey: hex.EncodeToString(pub)}, "v1.1.0")
+	require.NoError(t, err)
+	store := newMemoryStore()
+	coordinator, cfg := newCoordinator(t, RolloutConfig{AutoRollback: true}, store)
+	self := peerInBucket(t, "v1.2.0", func(b int) bool { return b < 5 })
+	m.SetRollout(NewRollout(slog.Default(), cfg, self, store))
+	var results []string
+	m.OnCheckComplete = func(result, version string, err error) { results = append(results, result) }
+
+	m.CheckForUpdate(context.Background())
+	require.Equal(t, []string{"deferred"}, results)
+	require.Equal(t, "v1.2.0", m.LatestRelease().Version)
+	_, err = os.Stat("agentd.new")
+	require.True(t, os.IsNotExist(err))
+
+	_, _, err = coordinator.Coordinate(context.Background(), "v1.2.0", nil)
+	require.NoError(t, err)
+	m.CheckForUpdate(context.Background())
+	require.Equal(t, []string{"deferred", "updated"}, results)
+
+	// The upgraded agent restarts on v1.2.0; the coordinator then halts.
+	upgraded, err := NewManager(slog.Default(), Config{ServerURL: srv.URL, PublicKey: hex.EncodeToString(pub)}, "v1.2.0")
+	require.NoError(t, err)
+	upgraded.SetRollout(NewRollout(slog.Default(), cfg, self, store))
+	require.NoError(t, os.WriteFile("agentd.rollback", []byte("agent v1.1.0"), 0o755))
+	restarts := 0
+	upgraded.OnUpdateReady = func() { restarts++ }
+
+	require.False(t, upgraded.EnforceRollout())
+	_, _, err = coordinator.Coordinate(context.Background(), "v1.2.0", []NodeReport{{PeerID: self, Version: "v1.2.0"}})
+	require.NoError(t, err)
+	require.True(t, upgraded.EnforceRollout())
+	require.False(t, upgraded.EnforceRollout(), "rollback is started once")
+	require.Equal(t, 1, restarts)
+	restored, err := os.ReadFile("agentd.new")
+	require.NoError(t, err)
+	require.Equal(t, []byte("agent v1.1.0"), restored)
+
+	// The halted release is never installed again.
+	require.True(t, isFailedVersion("v1.2.0"))
+	m.CheckForUpdate(context.Background())
+	require.Equal(t, []string{"deferred", "updated", "skipped"}, results)
+}
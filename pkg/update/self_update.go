@@ -1,17 +1,38 @@
 package update
 
 import (
+	"errors"
+	"io"
 	"log"
 	"os"
+	"time"
 
 	"github.com/inconshreveable/go-update"
 )
 
 const newBinaryName = "agentd.new"
 
+// applyBinary replaces the running executable and restartProcess replaces
+// the running process with it. They are variables so tests can stub them.
+var (
+	applyBinary = func(r io.Reader) error {
+		return update.Apply(r, update.Options{})
+	}
+	restartProcess = reexec
+)
+
 // ApplyPendingUpdate checks for a new binary and applies it.
 // This should be called at the very start of the main function.
+//
+// It first rolls back a version that has used up its probation starts
+// without being confirmed good. After swapping in a binary it restarts the
+// process so the new code runs.
 func ApplyPendingUpdate() {
+	if rollbackUnconfirmedUpdate() {
+		restart()
+		return
+	}
+
 	// Check if a new binary exists
 	_, err := os.Stat(newBinaryName)
 	if os.IsNotExist(err) {
@@ -30,23 +51,95 @@ func ApplyPendingUpdate() {
 		log.Printf("[ERROR] Failed to open new binary: %v", err)
 		return
 	}
-	defer func() { _ = file.Close() }()
 
 	// Use a library to handle the cross-platform complexities of replacing
 	// the currently running executable.
-	err = update.Apply(file, update.Options{})
+	err = applyBinary(file)
+	_ = file.Close()
 	if err != nil {
 		log.Printf("[ERROR] Failed to apply update: %v", err)
 		_ = os.Remove(newBinaryName)
+		if pending, readErr := readProbationState(pendingStateName); readErr == nil {
+			_ = recordFailedVersion(pending.Version, "failed to apply: "+err.Error())
+			_ = os.Remove(pendingStateName)
+		}
 		// Restore from rollback backup if available
-		if _, statErr := os.Stat("agentd.rollback"); statErr == nil {
+		if _, statErr := os.Stat(rollbackBinaryName); statErr == nil {
 			log.Println("[INFO] Restoring from rollback backup")
-			rb, readErr := os.ReadFile("agentd.rollback")
+			rb, readErr := os.ReadFile(rollbackBinaryName)
 			if readErr == nil {
 				if writeErr := os.WriteFile(newBinaryName, rb, 0755); writeErr == nil {
 					log.Println("[INFO] Rollback binary prepared. Restart to apply.")
 				}
 			}
 		}
+		return
+	}
+	_ = os.Remove(newBinaryName)
+
+	// An update downloaded by the manager goes on probation; a restored
+	// rollback binary has no pending record and does not.
+	if pending, readErr := readProbationState(pendingStateName); readErr == nil {
+		pending.AppliedAt = time.Now().UTC()
+		if writeErr := writeProbationState(probationStateName, pending); writeErr != nil {
+			log.Printf("[ERROR] Failed to start update probation: %v", writeErr)
+		} else {
+			log.Printf("[INFO] Version %s applied and on probation", pending.Version)
+		}
+		_ = os.Remove(pendingStateName)
+	} else if !errors.Is(readErr, os.ErrNotExist) {
+		log.Printf("[ERROR] Failed to read pending update state: %v", readErr)
+	}
+
+	restart()
+}
+
+// rollbackUnconfirmedUpdate counts this start of the version on probation
+// and restores agentd.rollback once it has been started MaxBoots times
+// without passing, which is what a crash-looping binary looks like. Starts
+// are counted here, first thing in main, so a binary that crashes while
+// loading its configuration or initialising is caught too. It reports
+// whether the backup was applied.
+func rollbackUnconfirmedUpdate() bool {
+	state, err := readProbationState(probationStateName)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[ERROR] Failed to read probation state: %v", err)
+		}
+		return false
+	}
+	if sameVersion(confirmedVersion(), state.Version) {
+		_ = os.Remove(probationStateName)
+		return false
+	}
+	if state.Boots < state.MaxBoots {
+		state.Boots++
+		if err := writeProbationState(probationStateName, state); err != nil {
+			log.Printf("[ERROR] Failed to record probation start: %v", err)
+		}
+		return false
+	}
+
+	log.Printf("[WARN] Version %s started %d times without passing probation, rolling back to %s", state.Version, state.Boots, state.PreviousVersion)
+	_ = recordFailedVersion(state.Version, "not confirmed healthy within probation starts")
+	_ = os.Remove(probationStateName)
+
+	file, err := os.Open(rollbackBinaryName)
+	if err != nil {
+		log.Printf("[ERROR] Rollback binary not available: %v", err)
+		return false
+	}
+	defer func() { _ = file.Close() }()
+	if err := applyBinary(file); err != nil {
+		log.Printf("[ERROR] Failed to apply rollback binary: %v", err)
+		return false
+	}
+	return true
+}
+
+func restart() {
+	log.Println("[INFO] Restarting to run the updated binary")
+	if err := restartProcess(); err != nil {
+		log.Printf("[ERROR] Failed to restart after update, continuing with the running binary: %v", err)
 	}
 }
@@ -17,6 +17,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/mod/semver"
+
+	"github.com/naviNBRuas/APA/pkg/robustness"
 )
 
 func newTestManager(t *testing.T, version string) *Manager {
@@ -31,6 +33,9 @@ func newTestManager(t *testing.T, version string) *Manager {
 	m, err := NewManager(logger, cfg, version)
 	require.NoError(t, err)
 	require.NotNil(t, m)
+	m.SetDownloadPolicy(robustness.NewPolicy(logger, "update", robustness.PolicyConfig{
+		Retry: robustness.RetryPolicy{MaxAttempts: 3, InitialDelay: time.Millisecond},
+	}))
 	return m
 }
 
@@ -140,7 +145,7 @@ func TestCheckForUpdate_AlreadyUpToDate(t *testing.T) {
 	mockP2P.On("GetConnectedPeers").Return([]peer.ID{})
 	m.SetP2PNetwork(mockP2P)
 
-	m.CheckForUpdate()
+	m.CheckForUpdate(context.Background())
 	assert.False(t, updateCalled, "should not trigger callback when up-to-date")
 }
 
@@ -180,6 +185,35 @@ func TestDownloadFile_ServerError(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDownloadFile_RetriesServerErrors(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("binary"))
+	}))
+	defer server.Close()
+
+	m := newTestManager(t, "v1.0.0")
+	data, err := m.downloadFile(context.Background(), server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("binary"), data)
+	assert.Equal(t, 3, requests)
+
+	// Client errors are not retried.
+	requests = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNotFound)
+	})
+	_, err = m.downloadFile(context.Background(), server.URL)
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+}
+
 func TestPerformUpdate(t *testing.T) {
 	origDir, err := os.Getwd()
 	require.NoError(t, err)
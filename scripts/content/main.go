@@ -0,0 +1,27 @@
+// Command content prints the chunked-transfer manifest root of a file, the
+// value of an artifact's "content" field in a release description.
+//
+//	go run ./scripts/content agentd-v1.2.0-linux-amd64
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/naviNBRuas/APA/pkg/transfer"
+)
+
+func main() {
+	if len(os.Args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: content <file>")
+		os.Exit(2)
+	}
+	data, err := os.ReadFile(os.Args[1])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "content: %v\n", err)
+		os.Exit(1)
+	}
+	m := transfer.BuildManifest(filepath.Base(os.Args[1]), data)
+	fmt.Println(m.Root)
+}
@@ -0,0 +1,77 @@
+// Command delta creates a binary delta between two agent releases and prints
+// the matching "deltas" entry for the release description.
+//
+//	go run ./scripts/delta -from v1.1.0 -base agentd-v1.1.0 -target agentd-v1.2.0 \
+//	    -out agentd-v1.1.0-v1.2.0.delta -url https://releases.example.com/agentd-v1.1.0-v1.2.0.delta
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/naviNBRuas/APA/pkg/update"
+)
+
+func main() {
+	from := flag.String("from", "", "version of the base binary")
+	base := flag.String("base", "", "path to the base binary")
+	target := flag.String("target", "", "path to the new binary")
+	out := flag.String("out", "", "path to write the delta to")
+	url := flag.String("url", "", "URL the delta will be served from")
+	key := flag.String("key", "configs/signing_private.key", "hex ed25519 signing key; empty to skip signing")
+	flag.Parse()
+
+	if *from == "" || *base == "" || *target == "" || *out == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*from, *base, *target, *out, *url, *key); err != nil {
+		fmt.Fprintf(os.Stderr, "delta: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(from, basePath, targetPath, outPath, url, keyPath string) error {
+	base, err := os.ReadFile(basePath)
+	if err != nil {
+		return fmt.Errorf("failed to read base binary: %w", err)
+	}
+	target, err := os.ReadFile(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to read target binary: %w", err)
+	}
+
+	delta, err := update.CreateDelta(base, target)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outPath, delta, 0644); err != nil {
+		return fmt.Errorf("failed to write delta: %w", err)
+	}
+
+	sum := sha256.Sum256(delta)
+	info := update.DeltaInfo{From: from, URL: url, SHA256: hex.EncodeToString(sum[:])}
+	if keyPath != "" {
+		keyHex, err := os.ReadFile(keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to read signing key: %w", err)
+		}
+		key, err := hex.DecodeString(strings.TrimSpace(string(keyHex)))
+		if err != nil || len(key) != ed25519.PrivateKeySize {
+			return fmt.Errorf("invalid signing key in %s", keyPath)
+		}
+		info.Signature = hex.EncodeToString(ed25519.Sign(ed25519.PrivateKey(key), sum[:]))
+	}
+
+	fmt.Fprintf(os.Stderr, "delta is %d bytes (%.1f%% of %d)\n", len(delta), 100*float64(len(delta))/float64(len(target)), len(target))
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(info)
+}
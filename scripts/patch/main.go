@@ -0,0 +1,75 @@
+// Command patch signs a patch with a publisher key and prints it as the
+// "patch" field of a POST /admin/patches request.
+//
+//	go run ./scripts/patch -id netdrv-1.0.1 -target driver -name netdrv.so \
+//	    -version 1.0.1 -severity high -in build/netdrv.so
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/naviNBRuas/APA/pkg/patch"
+)
+
+func main() {
+	id := flag.String("id", "", "patch ID")
+	target := flag.String("target", "", "module, driver or agent")
+	name := flag.String("name", "", "module name, driver file name or agent binary name")
+	version := flag.String("version", "", "version after patching")
+	severity := flag.String("severity", "medium", "critical, high, medium or low")
+	description := flag.String("description", "", "description")
+	in := flag.String("in", "", "path to the patch content")
+	key := flag.String("key", "configs/signing_private.key", "hex ed25519 publisher key")
+	ttl := flag.Duration("ttl", 7*24*time.Hour, "how long peers accept the patch")
+	flag.Parse()
+
+	if *id == "" || *target == "" || *name == "" || *version == "" || *in == "" || *ttl <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	now := time.Now().UTC()
+	p := &patch.Patch{
+		ID:          *id,
+		Name:        *name,
+		Version:     *version,
+		Description: *description,
+		Severity:    *severity,
+		Target:      *target,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(*ttl),
+	}
+	if err := run(p, *in, *key); err != nil {
+		fmt.Fprintf(os.Stderr, "patch: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(p *patch.Patch, inPath, keyPath string) error {
+	content, err := os.ReadFile(inPath)
+	if err != nil {
+		return fmt.Errorf("failed to read patch content: %w", err)
+	}
+	keyHex, err := os.ReadFile(keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to read signing key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(keyHex)))
+	if err != nil || len(key) != ed25519.PrivateKeySize {
+		return fmt.Errorf("invalid signing key in %s", keyPath)
+	}
+
+	p.Content = content
+	patch.SignPatch(p, ed25519.PrivateKey(key))
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
@@ -109,6 +109,21 @@ function bindActions() {
         }
     });
 
+    document.getElementById('refresh-approvals')?.addEventListener('click', loadApprovals);
+    document.getElementById('approval-status')?.addEventListener('change', loadApprovals);
+    document.querySelector('#approvals-table tbody')?.addEventListener('click', async e => {
+        const button = e.target.closest('button[data-decision]');
+        if (!button) return;
+        const { id, decision } = button.dataset;
+        const comment = decision === 'reject' ? (prompt('Reason for rejecting (optional)') ?? '') : '';
+        try {
+            await api(`/api/approvals/${encodeURIComponent(id)}/${decision}`, { method: 'POST', body: JSON.stringify({ comment }) });
+            await loadApprovals();
+        } catch (err) {
+            alert(err.message);
+        }
+    });
+
     const settingsForm = document.getElementById('settings-form');
     settingsForm?.addEventListener('submit', async e => {
         e.preventDefault();
@@ -157,6 +172,7 @@ async function loadAllData() {
         loadStatus(),
         loadModules(),
         loadControllers(),
+        loadApprovals(),
         loadConfig(),
     ]);
 }
@@ -223,6 +239,41 @@ async function loadControllers() {
     }
 }
 
+async function loadApprovals() {
+    try {
+        const status = document.getElementById('approval-status')?.value ?? 'pending';
+        const approvals = await api('/api/approvals' + (status ? `?status=${encodeURIComponent(status)}` : ''));
+        const tbody = document.querySelector('#approvals-table tbody');
+        if (!tbody) return;
+        tbody.innerHTML = '';
+        approvals.forEach(req => {
+            const row = document.createElement('tr');
+            const decision = req.status === 'pending'
+                ? `<button data-id="${escapeHTML(req.id)}" data-decision="approve">Approve</button>
+                   <button data-id="${escapeHTML(req.id)}" data-decision="reject">Reject</button>`
+                : escapeHTML(req.decided_by || '');
+            row.innerHTML = `
+                <td>${escapeHTML(req.action.name)}</td>
+                <td>${escapeHTML(req.action.subject)}</td>
+                <td>${escapeHTML(req.action.reason)}</td>
+                <td>${new Date(req.created_at).toLocaleString()}</td>
+                <td>${new Date(req.expires_at).toLocaleString()}</td>
+                <td>${escapeHTML(req.error ? `${req.status}: ${req.error}` : req.status)}</td>
+                <td>${decision}</td>
+            `;
+            tbody.appendChild(row);
+        });
+    } catch (err) {
+        console.warn('approvals load failed', err);
+    }
+}
+
+// escapeHTML keeps values reported by peers and monitored processes from
+// being interpreted as markup.
+function escapeHTML(value) {
+    return String(value ?? '').replace(/[&<>"']/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;' }[c]));
+}
+
 async function loadConfig() {
     try {
         const cfg = await api('/api/config');